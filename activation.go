@@ -0,0 +1,131 @@
+package novelai
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ActivationReason explains why a lorebook entry was or wasn't activated.
+type ActivationReason string
+
+const (
+	ActivationForced           ActivationReason = "forced"
+	ActivationKeyMatched       ActivationReason = "key matched"
+	ActivationDisabled         ActivationReason = "disabled"
+	ActivationCategoryDisabled ActivationReason = "category disabled"
+	ActivationNoMatch          ActivationReason = "no key matched"
+)
+
+// Activation is the activation result for one lorebook entry.
+type Activation struct {
+	// EntryIndex is the entry's index in Lorebook.Entries.
+	EntryIndex int
+	// Active is true if the entry should be inserted into context.
+	Active bool
+	// Reason explains the result.
+	Reason ActivationReason
+	// Key is the key that matched, if Reason is ActivationKeyMatched.
+	Key string
+	// Position is the offset in the story text where Key matched, or -1.
+	Position int
+}
+
+// Activate determines which lorebook entries are triggered by story text.
+// Entries are matched against the last SearchRange characters of text
+// (DefaultSearchRange if unset). Plain keys match case-insensitively;
+// keys written as /pattern/flags are regular expressions supporting the
+// i, s and m flags. Returns one Activation per entry, in entry order.
+func (lb *Lorebook) Activate(text string) []Activation {
+	disabledCategories := make(map[string]bool)
+	for _, cat := range lb.Categories {
+		if !cat.Enabled {
+			disabledCategories[cat.ID] = true
+		}
+	}
+
+	results := make([]Activation, len(lb.Entries))
+	for i, entry := range lb.Entries {
+		result := Activation{EntryIndex: i, Position: -1}
+		switch {
+		case !entry.Enabled:
+			result.Reason = ActivationDisabled
+		case entry.Category != "" && disabledCategories[entry.Category]:
+			result.Reason = ActivationCategoryDisabled
+		case entry.ForceActivation:
+			result.Active = true
+			result.Reason = ActivationForced
+		default:
+			result.Reason = ActivationNoMatch
+			if key, pos, ok := matchEntryKeys(entry, text); ok {
+				result.Active = true
+				result.Reason = ActivationKeyMatched
+				result.Key = key
+				result.Position = pos
+			}
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// matchEntryKeys returns the first key of entry found in the entry's search
+// range of text, and the offset of the match within text.
+func matchEntryKeys(entry LorebookEntry, text string) (string, int, bool) {
+	searchRange := entry.SearchRange
+	if searchRange <= 0 {
+		searchRange = DefaultSearchRange
+	}
+	start := 0
+	if len(text) > searchRange {
+		start = len(text) - searchRange
+		// Don't start in the middle of a multi-byte character
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+	}
+	window := text[start:]
+
+	for _, key := range entry.Keys {
+		if key == "" {
+			continue
+		}
+		re := keyRegexp(key)
+		if re == nil {
+			continue
+		}
+		if loc := re.FindStringIndex(window); loc != nil {
+			return key, start + loc[0], true
+		}
+	}
+	return "", -1, false
+}
+
+// regexKey matches lorebook keys of the form /pattern/flags.
+var regexKey = regexp.MustCompile(`^/(.+)/([a-z]*)$`)
+
+// keyRegexp compiles a lorebook key. Plain keys become case-insensitive
+// literal patterns. Returns nil for keys that can't be compiled, such as
+// invalid /pattern/flags keys or keys that aren't valid UTF-8.
+func keyRegexp(key string) *regexp.Regexp {
+	var pattern string
+	if m := regexKey.FindStringSubmatch(key); m != nil {
+		var flags string
+		for _, f := range m[2] {
+			if strings.ContainsRune("ism", f) && !strings.ContainsRune(flags, f) {
+				flags += string(f)
+			}
+		}
+		pattern = m[1]
+		if flags != "" {
+			pattern = "(?" + flags + ")" + pattern
+		}
+	} else {
+		pattern = "(?i)" + regexp.QuoteMeta(key)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	return re
+}
@@ -0,0 +1,72 @@
+// Package adapters is thin glue for running NovelAI chat in Discord,
+// Telegram and similar bots. The application implements Channel with its
+// bot library of choice; a Bot then keeps one conversation per chat in a
+// novelai.SessionManager, shows the typing indicator while a reply
+// streams, and posts the reply split to the platform's message limit:
+//
+//	sessions := novelai.NewSessionManager(1000, novelai.FileSessionStore{Dir: "sessions"})
+//	sessions.New = func(id string) *novelai.Conversation {
+//		return novelai.NewConversation("You are a friendly bot.")
+//	}
+//	bot := adapters.NewBot(sessions, adapters.DiscordMessageLimit)
+//
+//	// In the message handler:
+//	err := bot.Handle(ctx, channelID, channel, text)
+package adapters
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Message length limits, in characters, of common chat platforms.
+const (
+	DiscordMessageLimit  = 2000
+	TelegramMessageLimit = 4096
+)
+
+// SplitMessage splits text into messages of at most limit characters,
+// breaking at the last paragraph, line, sentence or word boundary that
+// keeps each message at least half full, and mid-word only if there is
+// none. Whitespace around breaks is dropped. If limit is not positive,
+// DiscordMessageLimit is used.
+func SplitMessage(text string, limit int) []string {
+	if limit <= 0 {
+		limit = DiscordMessageLimit
+	}
+	var parts []string
+	for {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if utf8.RuneCountInString(text) <= limit {
+			if text = strings.TrimRight(text, " \t\r\n"); text != "" {
+				parts = append(parts, text)
+			}
+			return parts
+		}
+		head := text[:runeOffset(text, limit)]
+		at := breakPoint(head)
+		parts = append(parts, strings.TrimRight(text[:at], " \t\r\n"))
+		text = text[at:]
+	}
+}
+
+// breakPoint returns where to end a message that must fit in head.
+func breakPoint(head string) int {
+	for _, sep := range []string{"\n\n", "\n", ". ", "! ", "? ", " "} {
+		if i := strings.LastIndex(head, sep); i >= len(head)/2 {
+			return i + len(sep)
+		}
+	}
+	return len(head)
+}
+
+// runeOffset returns the byte offset of the nth rune of s.
+func runeOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
@@ -0,0 +1,48 @@
+package adapters
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short", "Hello.", 10, []string{"Hello."}},
+		{"empty", "  \n ", 10, nil},
+		{"paragraph", "First para.\n\nSecond para.", 20, []string{"First para.", "Second para."}},
+		{"sentence", "One two. Three four five.", 15, []string{"One two.", "Three four", "five."}},
+		{"word", "alpha beta gamma", 11, []string{"alpha beta", "gamma"}},
+		{"hard cut", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"runes", "ééééé", 2, []string{"éé", "éé", "é"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitMessage(tt.text, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("SplitMessage(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessageDiscordLimit(t *testing.T) {
+	text := strings.Repeat("All work and no play makes Jack a dull boy. ", 200)
+	parts := SplitMessage(text, 0)
+	if len(parts) < 5 {
+		t.Fatalf("Expected several parts, got %d", len(parts))
+	}
+	for i, p := range parts {
+		if n := utf8.RuneCountInString(p); n > DiscordMessageLimit {
+			t.Errorf("part %d has %d characters", i, n)
+		}
+		if !strings.HasSuffix(p, ".") {
+			t.Errorf("part %d does not end at a sentence: %q", i, p[len(p)-10:])
+		}
+	}
+}
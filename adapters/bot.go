@@ -0,0 +1,113 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wbrown/llmapi"
+	"github.com/wbrown/novelai"
+)
+
+// DefaultTypingInterval is how often the typing indicator is renewed while
+// a reply streams. Platforms clear it after a few seconds: Discord after
+// ten, Telegram after five.
+const DefaultTypingInterval = 4 * time.Second
+
+// Channel is a chat the bot replies in, implemented with the platform's
+// bot library.
+type Channel interface {
+	// Typing shows the typing indicator.
+	Typing(ctx context.Context) error
+	// Send posts a message.
+	Send(ctx context.Context, text string) error
+}
+
+// TypingIndicator shows a channel's typing indicator while stream chunks
+// arrive, renewing it at most once per Interval, so that it stops soon
+// after the stream does. Typing errors are ignored; the indicator is
+// cosmetic.
+type TypingIndicator struct {
+	// Interval is the least time between Typing calls. If zero,
+	// DefaultTypingInterval is used.
+	Interval time.Duration
+
+	ctx  context.Context
+	ch   Channel
+	last time.Time
+}
+
+// NewTypingIndicator creates an indicator for ch. Typing calls use ctx.
+func NewTypingIndicator(ctx context.Context, ch Channel) *TypingIndicator {
+	return &TypingIndicator{ctx: ctx, ch: ch}
+}
+
+// Touch shows the indicator unless it was shown less than Interval ago.
+func (t *TypingIndicator) Touch() {
+	interval := t.Interval
+	if interval == 0 {
+		interval = DefaultTypingInterval
+	}
+	if now := time.Now(); now.Sub(t.last) >= interval {
+		t.last = now
+		_ = t.ch.Typing(t.ctx)
+	}
+}
+
+// Callback returns a stream callback that touches the indicator on each
+// chunk, then calls next if it is not nil.
+func (t *TypingIndicator) Callback(next novelai.StreamCallback) novelai.StreamCallback {
+	return func(text string, done bool) {
+		if !done {
+			t.Touch()
+		}
+		if next != nil {
+			next(text, done)
+		}
+	}
+}
+
+// Bot replies to chat messages with one conversation per session, such as
+// per channel or per user, kept in Sessions.
+type Bot struct {
+	// Sessions holds the conversations.
+	Sessions *novelai.SessionManager
+	// Limit is the platform's message length limit. If zero,
+	// DiscordMessageLimit is used.
+	Limit int
+	// TypingInterval is passed to the TypingIndicator of each reply.
+	TypingInterval time.Duration
+	// Sampling overrides the conversations' settings for each reply.
+	Sampling llmapi.Sampling
+}
+
+// NewBot creates a bot keeping its conversations in sessions and splitting
+// replies at limit characters.
+func NewBot(sessions *novelai.SessionManager, limit int) *Bot {
+	return &Bot{Sessions: sessions, Limit: limit}
+}
+
+// Handle replies to text in session sessionID, posting the reply to ch. The
+// typing indicator is shown while the reply streams. Messages for the same
+// session are answered one at a time. Returns novelai.ErrRateLimited if
+// the session is over its rate limit, so that the bot can say so.
+func (b *Bot) Handle(ctx context.Context, sessionID string, ch Channel, text string) error {
+	var reply string
+	err := b.Sessions.Do(ctx, sessionID, func(c *novelai.Conversation) error {
+		typing := NewTypingIndicator(ctx, ch)
+		typing.Interval = b.TypingInterval
+		typing.Touch()
+		var err error
+		reply, _, _, _, _, _, err = c.SendStreaming(text, b.Sampling, typing.Callback(nil))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, part := range SplitMessage(reply, b.Limit) {
+		if err := ch.Send(ctx, part); err != nil {
+			return fmt.Errorf("error sending message: %w", err)
+		}
+	}
+	return nil
+}
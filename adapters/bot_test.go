@@ -0,0 +1,80 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wbrown/novelai"
+)
+
+// fakeChannel records what a bot does in a channel.
+type fakeChannel struct {
+	mu     sync.Mutex
+	typing int
+	sent   []string
+}
+
+func (c *fakeChannel) Typing(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.typing++
+	return nil
+}
+
+func (c *fakeChannel) Send(ctx context.Context, text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, text)
+	return nil
+}
+
+func TestBotHandle(t *testing.T) {
+	fake := novelai.NewFakeBackend().
+		On(`Tell me a story`, novelai.FakeResponse{Text: "Once upon a time. The end.", ChunkDelay: 5 * time.Millisecond})
+	sessions := novelai.NewSessionManager(0, nil)
+	sessions.New = func(id string) *novelai.Conversation {
+		conv := novelai.NewConversation("You are a storyteller.")
+		conv.ApiToken = "test"
+		fake.Install(conv)
+		return conv
+	}
+	sessions.RateBurst, sessions.RateInterval = 1, time.Hour
+	bot := NewBot(sessions, 20)
+	bot.TypingInterval = 10 * time.Millisecond
+
+	ch := &fakeChannel{}
+	if err := bot.Handle(context.Background(), "channel-1", ch, "Tell me a story."); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ch.sent, "|") != "Once upon a time.|The end." {
+		t.Errorf("Unexpected messages: %q", ch.sent)
+	}
+	if ch.typing < 2 {
+		t.Errorf("Expected the typing indicator renewed while streaming, got %d calls", ch.typing)
+	}
+
+	err := bot.Handle(context.Background(), "channel-1", ch, "Tell me a story.")
+	if !errors.Is(err, novelai.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestTypingIndicatorInterval(t *testing.T) {
+	ch := &fakeChannel{}
+	typing := NewTypingIndicator(context.Background(), ch)
+	var got []string
+	cb := typing.Callback(func(text string, done bool) { got = append(got, text) })
+	cb("a", false)
+	cb("b", false)
+	cb("", true)
+	if ch.typing != 1 {
+		t.Errorf("Expected one Typing call within the interval, got %d", ch.typing)
+	}
+	if strings.Join(got, "") != "ab" {
+		t.Errorf("Expected chunks passed on, got %q", got)
+	}
+}
@@ -0,0 +1,156 @@
+package novelai
+
+// DefaultPolicyLogprobs is how many alternatives per token are requested
+// for a Schedule's Policy when Settings.Logprobs is not set.
+const DefaultPolicyLogprobs = 5
+
+// SegmentReport describes a finished segment of a continued reply, for a
+// SamplingPolicy.
+type SegmentReport struct {
+	// Segment is the segment's index, 0 being the first request.
+	Segment int
+	// Text is the segment's reply.
+	Text string
+	// Logprobs are the log probabilities of its tokens, and Entropy their
+	// mean entropy; see Entropy. Logprobs are empty if the model did not
+	// return them.
+	Logprobs []TokenLogprob
+	Entropy  float64
+	// Sampling is the sampling the segment was generated with: the
+	// settings with the segment's overrides applied.
+	Sampling SamplingProfile
+}
+
+// SamplingPolicy adjusts the sampling of a continued reply between
+// segments, from how the last segment went.
+type SamplingPolicy interface {
+	// Adjust returns overrides for the next segment. They replace the
+	// schedule's for the rest of the reply, until the next adjustment.
+	Adjust(last SegmentReport) SamplingProfile
+}
+
+// SamplingPolicyFunc adapts a function to the SamplingPolicy interface.
+type SamplingPolicyFunc func(last SegmentReport) SamplingProfile
+
+// Adjust implements SamplingPolicy.
+func (f SamplingPolicyFunc) Adjust(last SegmentReport) SamplingProfile {
+	return f(last)
+}
+
+// EntropyPolicy is a SamplingPolicy keeping the entropy of a long reply
+// within bounds. When the entropy collapses below Low, as when the model
+// starts looping, the temperature and top-p are raised; when it explodes
+// above High, as when the reply turns incoherent, they are lowered.
+type EntropyPolicy struct {
+	// Low and High bound the healthy mean entropy per token, in nats.
+	Low  float64
+	High float64
+	// TemperatureStep and TopPStep are the adjustments per segment.
+	TemperatureStep float64
+	TopPStep        float64
+	// MinTemperature and MaxTemperature bound the temperature; zero
+	// leaves a bound unset. Top-p stays within (0, 1].
+	MinTemperature float64
+	MaxTemperature float64
+}
+
+// DefaultEntropyPolicy suits prose, whose entropy usually lies between
+// 0.5 and 2.5 nats per token.
+var DefaultEntropyPolicy = EntropyPolicy{
+	Low:             0.4,
+	High:            2.5,
+	TemperatureStep: 0.1,
+	TopPStep:        0.02,
+	MinTemperature:  0.5,
+	MaxTemperature:  1.5,
+}
+
+// Adjust implements SamplingPolicy. A segment without log probabilities
+// is left as it was.
+func (p EntropyPolicy) Adjust(last SegmentReport) SamplingProfile {
+	var sign float64
+	switch {
+	case len(last.Logprobs) == 0:
+		return SamplingProfile{}
+	case last.Entropy < p.Low:
+		sign = 1
+	case last.Entropy > p.High:
+		sign = -1
+	default:
+		return SamplingProfile{}
+	}
+	var out SamplingProfile
+	if p.TemperatureStep != 0 {
+		t := 1.0
+		if last.Sampling.Temperature != nil {
+			t = *last.Sampling.Temperature
+		}
+		t += sign * p.TemperatureStep
+		if p.MaxTemperature != 0 {
+			t = min(t, p.MaxTemperature)
+		}
+		t = max(t, p.MinTemperature)
+		out.Temperature = Float64(t)
+	}
+	if p.TopPStep != 0 {
+		topP := 1.0
+		if last.Sampling.TopP != nil {
+			topP = *last.Sampling.TopP
+		}
+		topP = min(max(topP+sign*p.TopPStep, p.TopPStep), 1)
+		out.TopP = Float64(topP)
+	}
+	return out
+}
+
+// continuation tracks the sampling of the segments of a continued reply.
+type continuation struct {
+	c    *Conversation
+	call SamplingProfile
+	// segment is the index of the next segment, and adjusted the
+	// overrides from the policy's last adjustment.
+	segment   int
+	adjusted  SamplingProfile
+	overrides SamplingProfile
+}
+
+// newContinuation starts a continued reply with the call's overrides.
+func (c *Conversation) newContinuation(call SamplingProfile) *continuation {
+	return &continuation{c: c, call: call}
+}
+
+// next returns the settings and overrides for the next segment.
+func (k *continuation) next() (*Settings, SamplingProfile) {
+	k.overrides = k.c.segmentOverrides(k.call, k.segment).Merge(k.adjusted)
+	settings := &k.c.Settings
+	if k.policy() != nil && settings.Logprobs == 0 {
+		s := *settings
+		s.Logprobs = DefaultPolicyLogprobs
+		settings = &s
+	}
+	return settings, k.overrides
+}
+
+// done reports the segment's reply to the policy, if any.
+func (k *continuation) done(reply string) {
+	if policy := k.policy(); policy != nil {
+		logprobs := k.c.LastLogprobs
+		adjust := policy.Adjust(SegmentReport{
+			Segment:  k.segment,
+			Text:     reply,
+			Logprobs: logprobs,
+			Entropy:  Entropy(logprobs),
+			Sampling: settingsProfile(&k.c.Settings).Merge(k.overrides),
+		})
+		k.adjusted = k.adjusted.Merge(adjust)
+	}
+	k.segment++
+}
+
+// policy returns the schedule's policy, or nil.
+func (k *continuation) policy() SamplingPolicy {
+	if k.c.Schedule == nil {
+		return nil
+	}
+	return k.c.Schedule.Policy
+}
@@ -0,0 +1,92 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+func TestEntropyPolicy(t *testing.T) {
+	p := DefaultEntropyPolicy
+	tokens := []TokenLogprob{{Token: "a"}}
+	tests := []struct {
+		name        string
+		report      SegmentReport
+		temperature *float64
+		topP        *float64
+	}{
+		{"no logprobs", SegmentReport{Entropy: 0}, nil, nil},
+		{"healthy", SegmentReport{Logprobs: tokens, Entropy: 1}, nil, nil},
+		{"collapsed", SegmentReport{Logprobs: tokens, Entropy: 0.1,
+			Sampling: SamplingProfile{Temperature: Float64(0.8), TopP: Float64(0.9)}}, Float64(0.9), Float64(0.92)},
+		{"exploded", SegmentReport{Logprobs: tokens, Entropy: 3}, Float64(0.9), Float64(0.98)},
+		{"bounded", SegmentReport{Logprobs: tokens, Entropy: 0.1,
+			Sampling: SamplingProfile{Temperature: Float64(1.45), TopP: Float64(1)}}, Float64(1.5), Float64(1)},
+	}
+	for _, tt := range tests {
+		got := p.Adjust(tt.report)
+		if !floatPtrNear(got.Temperature, tt.temperature) || !floatPtrNear(got.TopP, tt.topP) {
+			t.Errorf("%s: got %v, %v", tt.name, derefFloat(got.Temperature), derefFloat(got.TopP))
+		}
+	}
+}
+
+func TestSendUntilDonePolicy(t *testing.T) {
+	// Every segment is nearly certain of its tokens, as when looping
+	certain := fmt.Sprintf(`{"tokens":["a"],"token_logprobs":[0],"top_logprobs":[{"a":0,"b":%v}]}`, math.Log(0.001))
+	var reqs []completionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		reqs = append(reqs, req)
+		finish := "length"
+		if len(reqs) == 3 {
+			finish = "stop"
+		}
+		fmt.Fprintf(w, `{"choices":[{"text":"a ","finish_reason":%q,"logprobs":%s}]}`, finish, certain)
+	}))
+	defer server.Close()
+	conv := NewConversation("")
+	conv.ApiToken = "test-token"
+	conv.Endpoint = server.URL
+	conv.Settings.Temperature = 1
+	var reports []SegmentReport
+	conv.Schedule = &Schedule{
+		RepetitionPenaltyStep: 0.1,
+		Policy: SamplingPolicyFunc(func(last SegmentReport) SamplingProfile {
+			reports = append(reports, last)
+			return DefaultEntropyPolicy.Adjust(last)
+		}),
+	}
+
+	if _, _, _, _, _, _, err := conv.SendUntilDone("Write", llmapi.Sampling{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 3 || len(reports) != 3 {
+		t.Fatalf("Expected 3 segments, got %d requests and %d reports", len(reqs), len(reports))
+	}
+	wantTemperature := []float64{1, 1.1, 1.2}
+	for i, req := range reqs {
+		if req.Logprobs != DefaultPolicyLogprobs {
+			t.Errorf("Request %d: expected logprobs requested, got %d", i, req.Logprobs)
+		}
+		if !floatPtrNear(req.Temperature, Float64(wantTemperature[i])) {
+			t.Errorf("Request %d: temperature %v, want %v", i, derefFloat(req.Temperature), wantTemperature[i])
+		}
+	}
+	// The schedule's steps still apply to what the policy leaves alone
+	if !floatPtrNear(reqs[2].RepetitionPenalty, Float64(1.2)) {
+		t.Errorf("Expected the scheduled penalty, got %v", derefFloat(reqs[2].RepetitionPenalty))
+	}
+	if r := reports[1]; r.Segment != 1 || r.Entropy > 0.1 || *r.Sampling.Temperature != 1.1 {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+	if conv.Settings.Logprobs != 0 {
+		t.Error("Expected the settings unchanged")
+	}
+}
@@ -0,0 +1,196 @@
+package novelai
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Scenario modes (ScenarioSettings.Mode).
+const (
+	ModeStory     = 0
+	ModeAdventure = 1
+)
+
+// IsAdventure reports whether the scenario uses text adventure mode.
+func (s *Scenario) IsAdventure() bool {
+	return s.Settings.Mode == ModeAdventure
+}
+
+// StoryGenerator continues story text.
+type StoryGenerator interface {
+	// ContinueStory returns text that continues story.
+	ContinueStory(ctx context.Context, story string) (string, error)
+}
+
+// StoryGeneratorFunc adapts a function to the StoryGenerator interface.
+type StoryGeneratorFunc func(ctx context.Context, story string) (string, error)
+
+// ContinueStory calls f(ctx, story).
+func (f StoryGeneratorFunc) ContinueStory(ctx context.Context, story string) (string, error) {
+	return f(ctx, story)
+}
+
+// StoryGenerator returns a generator that continues stories with scenario s
+// using the native API. Biases are compiled with tok.
+func (c *Client) StoryGenerator(s *Scenario, tok Tokenizer) StoryGenerator {
+	return StoryGeneratorFunc(func(ctx context.Context, story string) (string, error) {
+		req, err := NewGenerateRequest(s, story, tok)
+		if err != nil {
+			return "", err
+		}
+		return c.Generate(ctx, req)
+	})
+}
+
+// AdventureAction is the kind of input in text adventure mode.
+type AdventureAction int
+
+const (
+	// ActionDo is something the player does: "> You open the door."
+	ActionDo AdventureAction = iota
+	// ActionSay is something the player says: "> You say "Hello.""
+	ActionSay
+	// ActionStory is narration added directly to the story.
+	ActionStory
+)
+
+// FormatAdventureInput formats player input the way NovelAI's adventure
+// mode does. Do and say inputs become "> You ..." lines ending in
+// punctuation; story input is returned trimmed. Empty input returns "".
+func FormatAdventureInput(action AdventureAction, text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	switch action {
+	case ActionDo:
+		text = strings.TrimPrefix(text, ">")
+		text = strings.TrimSpace(text)
+		if lower := strings.ToLower(text); lower == "you" || strings.HasPrefix(lower, "you ") {
+			text = strings.TrimSpace(text[3:])
+		}
+		if text == "" {
+			return ""
+		}
+		return "> You " + lowerFirst(endSentence(text))
+	case ActionSay:
+		text = strings.Trim(text, `"“” `)
+		if text == "" {
+			return ""
+		}
+		return `> You say "` + endSentence(upperFirst(text)) + `"`
+	default:
+		return text
+	}
+}
+
+// NormalizeAdventureResponse cleans up generated text in adventure mode:
+// leading whitespace is removed, generation is cut where the model starts
+// writing the player's next action (a line beginning with ">"), and
+// trailing whitespace is removed.
+func NormalizeAdventureResponse(text string) string {
+	text = strings.TrimLeft(text, " \t\r\n")
+	if strings.HasPrefix(text, ">") {
+		return ""
+	}
+	if i := strings.Index(text, "\n>"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimRightFunc(text, unicode.IsSpace)
+}
+
+// AdventureSession plays a scenario in text adventure mode, keeping the
+// story transcript in NovelAI's adventure format.
+type AdventureSession struct {
+	// Story is the transcript so far.
+	Story string
+	// Generator continues the story after each input.
+	Generator StoryGenerator
+	// State, if set, tracks structured game state across turns.
+	State *StateTracker
+}
+
+// NewAdventureSession starts an adventure from the scenario's prompt.
+func NewAdventureSession(s *Scenario, gen StoryGenerator) *AdventureSession {
+	return &AdventureSession{Story: s.Prompt, Generator: gen}
+}
+
+// Do performs a player action and returns the story's response.
+func (a *AdventureSession) Do(ctx context.Context, text string) (string, error) {
+	return a.Act(ctx, ActionDo, text)
+}
+
+// Say speaks as the player and returns the story's response.
+func (a *AdventureSession) Say(ctx context.Context, text string) (string, error) {
+	return a.Act(ctx, ActionSay, text)
+}
+
+// Narrate adds narration to the story and returns the story's response.
+func (a *AdventureSession) Narrate(ctx context.Context, text string) (string, error) {
+	return a.Act(ctx, ActionStory, text)
+}
+
+// Act formats input, generates a response, and appends both to Story.
+// Empty input just continues the story. If generation fails, Story is
+// left unchanged. If State is set, the turn is recorded with it; a state
+// update error is returned along with the response.
+func (a *AdventureSession) Act(ctx context.Context, action AdventureAction, text string) (string, error) {
+	story := a.Story
+	if input := FormatAdventureInput(action, text); input != "" {
+		story = appendLine(story, input) + "\n"
+	}
+
+	generated, err := a.Generator.ContinueStory(ctx, story)
+	if err != nil {
+		return "", err
+	}
+	response := NormalizeAdventureResponse(generated)
+	if response != "" && !strings.HasSuffix(story, "\n") && story != "" {
+		story += " "
+	}
+	a.Story = story + response
+
+	if a.State != nil {
+		if _, err := a.State.Turn(ctx, a.Story); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// appendLine appends line to text on a new line.
+func appendLine(text, line string) string {
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+	if text == "" {
+		return line
+	}
+	return text + "\n" + line
+}
+
+// endSentence adds a period unless text already ends in punctuation.
+func endSentence(text string) string {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	if strings.ContainsRune(`.!?…"'”`, r) {
+		return text
+	}
+	return text + "."
+}
+
+// lowerFirst lowercases the first letter of text, leaving "I" and
+// acronyms alone.
+func lowerFirst(text string) string {
+	first, size := utf8.DecodeRuneInString(text)
+	next, _ := utf8.DecodeRuneInString(text[size:])
+	if first == 'I' && (next == ' ' || next == '\'') || unicode.IsUpper(next) {
+		return text
+	}
+	return string(unicode.ToLower(first)) + text[size:]
+}
+
+// upperFirst uppercases the first letter of text.
+func upperFirst(text string) string {
+	first, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(first)) + text[size:]
+}
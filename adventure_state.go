@@ -0,0 +1,201 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Defaults for StateTracker.
+const (
+	// DefaultStateInterval is the number of turns between state updates.
+	DefaultStateInterval = 3
+	// DefaultStateWindow is how much of the transcript, in bytes counted back
+	// from the end, is shown to the extractor.
+	DefaultStateWindow = 4000
+)
+
+// AdventureState is the structured game state of a text adventure.
+type AdventureState struct {
+	Location   string   `json:"location"`
+	Inventory  []string `json:"inventory"`
+	Characters []string `json:"characters"`
+}
+
+// Empty reports whether no state has been recorded.
+func (st AdventureState) Empty() bool {
+	return st.Location == "" && len(st.Inventory) == 0 && len(st.Characters) == 0
+}
+
+// ContextText formats the state as bracketed context lines.
+func (st AdventureState) ContextText() string {
+	var lines []string
+	if st.Location != "" {
+		lines = append(lines, "[ Location: "+st.Location+" ]")
+	}
+	if len(st.Inventory) > 0 {
+		lines = append(lines, "[ Inventory: "+strings.Join(st.Inventory, ", ")+" ]")
+	}
+	if len(st.Characters) > 0 {
+		lines = append(lines, "[ Characters present: "+strings.Join(st.Characters, ", ")+" ]")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// StateContextConfig returns the context config for the adventure state
+// entry: inserted a few lines from the end of the story, like an author's note.
+func StateContextConfig() *ContextConfig {
+	return &ContextConfig{
+		Prefix:            "",
+		Suffix:            "\n",
+		TokenBudget:       1,
+		ReservedTokens:    0,
+		BudgetPriority:    -200,
+		TrimDirection:     TrimBottom,
+		InsertionType:     InsertNewline,
+		MaximumTrimType:   TrimSentence,
+		InsertionPosition: -3,
+	}
+}
+
+// StateExtractor derives game state from an adventure transcript.
+type StateExtractor interface {
+	// ExtractState returns the state after transcript, given the previous state.
+	ExtractState(ctx context.Context, transcript string, previous AdventureState) (AdventureState, error)
+}
+
+// StateExtractorFunc adapts a function to the StateExtractor interface.
+type StateExtractorFunc func(ctx context.Context, transcript string, previous AdventureState) (AdventureState, error)
+
+// ExtractState calls f(ctx, transcript, previous).
+func (f StateExtractorFunc) ExtractState(ctx context.Context, transcript string, previous AdventureState) (AdventureState, error) {
+	return f(ctx, transcript, previous)
+}
+
+// StatePrompt builds the instruction sent to the model to extract state.
+func StatePrompt(transcript string, previous AdventureState) string {
+	prev, _ := json.Marshal(previous)
+	return "Read the text adventure transcript below and report the current game state " +
+		"as a JSON object with the keys \"location\" (string), \"inventory\" (array of " +
+		"items the player carries) and \"characters\" (array of characters present, " +
+		"not including the player). Respond with only the JSON object.\n\n" +
+		"Previous state: " + string(prev) + "\n\nTranscript:\n" + transcript
+}
+
+// ParseStateReply extracts an AdventureState from a model reply containing
+// a JSON object, ignoring any text around it.
+func ParseStateReply(reply string) (AdventureState, error) {
+	var st AdventureState
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return st, fmt.Errorf("no JSON object in state reply")
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &st); err != nil {
+		return st, fmt.Errorf("error parsing state reply: %w", err)
+	}
+	return st, nil
+}
+
+// NewConversationStateExtractor returns an extractor that asks the chat
+// model for the state. Each extraction uses a fresh history with c's system
+// prompt and settings; token usage is added to c.Usage.
+func NewConversationStateExtractor(c *Conversation) StateExtractor {
+	return StateExtractorFunc(func(ctx context.Context, transcript string, previous AdventureState) (AdventureState, error) {
+		reply, err := c.sideRequest(ctx, StatePrompt(transcript, previous), SamplingProfile{})
+		if err != nil {
+			return previous, err
+		}
+		return ParseStateReply(reply)
+	})
+}
+
+// StateTracker keeps an AdventureState up to date by periodically running
+// an extractor over the transcript, and injects the state into a scenario's
+// context so later generations see it.
+type StateTracker struct {
+	// Scenario receives the state as a context entry.
+	Scenario *Scenario
+	// Extractor derives the state from the transcript.
+	Extractor StateExtractor
+	// Interval is the number of turns between updates (DefaultStateInterval if 0).
+	Interval int
+	// Window limits the transcript shown to the extractor (DefaultStateWindow if 0).
+	Window int
+	// State is the latest extracted state.
+	State AdventureState
+
+	turns      int
+	injected   bool
+	entryIndex int
+}
+
+// NewStateTracker creates a tracker that injects state into s.
+func NewStateTracker(s *Scenario, ex StateExtractor) *StateTracker {
+	return &StateTracker{Scenario: s, Extractor: ex}
+}
+
+// Turn records one adventure turn and updates the state if the interval
+// has elapsed. Returns true if the state was updated.
+func (t *StateTracker) Turn(ctx context.Context, transcript string) (bool, error) {
+	t.turns++
+	interval := t.Interval
+	if interval <= 0 {
+		interval = DefaultStateInterval
+	}
+	if t.turns%interval != 0 {
+		return false, nil
+	}
+	return true, t.Update(ctx, transcript)
+}
+
+// Update extracts the state from transcript now and injects it.
+// On error the previous state is kept.
+func (t *StateTracker) Update(ctx context.Context, transcript string) error {
+	window := t.Window
+	if window <= 0 {
+		window = DefaultStateWindow
+	}
+	st, err := t.Extractor.ExtractState(ctx, transcriptTail(transcript, window), t.State)
+	if err != nil {
+		return fmt.Errorf("error extracting adventure state: %w", err)
+	}
+	t.State = st
+	t.inject()
+	return nil
+}
+
+// inject writes the state into the tracker's context entry, creating it
+// after memory and author's note if needed.
+func (t *StateTracker) inject() {
+	if t.Scenario == nil {
+		return
+	}
+	s := t.Scenario
+	if !t.injected || t.entryIndex >= len(s.Context) {
+		if len(s.Context) == 0 {
+			s.Context = append(s.Context, ContextEntry{ContextCfg: MemoryContextConfig()})
+		}
+		if len(s.Context) == 1 {
+			s.Context = append(s.Context, ContextEntry{ContextCfg: AuthorsNoteContextConfig()})
+		}
+		s.Context = append(s.Context, ContextEntry{ContextCfg: StateContextConfig()})
+		t.entryIndex = len(s.Context) - 1
+		t.injected = true
+	}
+	s.Context[t.entryIndex].Text = t.State.ContextText()
+}
+
+// transcriptTail returns at most the last n bytes of text, starting on a
+// rune boundary.
+func transcriptTail(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	start := len(text) - n
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return text[start:]
+}
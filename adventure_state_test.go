@@ -0,0 +1,135 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestParseStateReply tests extracting state JSON from model replies.
+func TestParseStateReply(t *testing.T) {
+	st, err := ParseStateReply("Sure! ```json\n{\"location\":\"gatehouse\",\"inventory\":[\"torch\"],\"characters\":[\"guard\"]}\n```")
+	if err != nil {
+		t.Fatalf("ParseStateReply failed: %v", err)
+	}
+	if st.Location != "gatehouse" || len(st.Inventory) != 1 || st.Characters[0] != "guard" {
+		t.Errorf("Unexpected state: %+v", st)
+	}
+	if _, err := ParseStateReply("no state here"); err == nil {
+		t.Error("Expected error for reply without JSON")
+	}
+	if _, err := ParseStateReply("{not json}"); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
+
+// TestAdventureStateContextText tests the injected context format.
+func TestAdventureStateContextText(t *testing.T) {
+	st := AdventureState{Location: "cellar", Inventory: []string{"rope", "lamp"}}
+	expected := "[ Location: cellar ]\n[ Inventory: rope, lamp ]"
+	if got := st.ContextText(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if !(AdventureState{}).Empty() || st.Empty() {
+		t.Error("Unexpected Empty result")
+	}
+}
+
+// TestStateTracker tests periodic extraction and context injection.
+func TestStateTracker(t *testing.T) {
+	calls := 0
+	var lastTranscript string
+	ex := StateExtractorFunc(func(ctx context.Context, transcript string, previous AdventureState) (AdventureState, error) {
+		calls++
+		lastTranscript = transcript
+		return AdventureState{
+			Location:  "hall",
+			Inventory: append(previous.Inventory, "key"),
+		}, nil
+	})
+
+	s := NewScenario("State")
+	s.Settings.Mode = ModeAdventure
+	s.Prompt = "You enter the hall."
+	tracker := NewStateTracker(s, ex)
+	tracker.Interval = 2
+	tracker.Window = 10
+
+	gen := StoryGeneratorFunc(func(ctx context.Context, story string) (string, error) {
+		return " Nothing happens.", nil
+	})
+	session := NewAdventureSession(s, gen)
+	session.State = tracker
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if _, err := session.Do(ctx, "wait"); err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 extractions in 4 turns, got %d", calls)
+	}
+	if len(lastTranscript) != 10 || !strings.HasSuffix(session.Story, lastTranscript) {
+		t.Errorf("Expected last 10 bytes of transcript, got %q", lastTranscript)
+	}
+	if len(s.Context) != 3 {
+		t.Fatalf("Expected memory, author's note and state entries, got %d", len(s.Context))
+	}
+	expected := "[ Location: hall ]\n[ Inventory: key, key ]"
+	if s.Context[2].Text != expected {
+		t.Errorf("Expected injected state %q, got %q", expected, s.Context[2].Text)
+	}
+	if !strings.Contains(NewContextBuilder(s).Build(session.Story), "[ Location: hall ]") {
+		t.Error("Expected state in built context")
+	}
+}
+
+// TestStateTrackerError tests that extraction errors keep the previous state.
+func TestStateTrackerError(t *testing.T) {
+	s := NewScenario("State")
+	s.Context = []ContextEntry{{Text: "Memory"}, {Text: "Note"}}
+	tracker := &StateTracker{
+		Scenario: s,
+		State:    AdventureState{Location: "start"},
+		Extractor: StateExtractorFunc(func(context.Context, string, AdventureState) (AdventureState, error) {
+			return AdventureState{}, errors.New("model unavailable")
+		}),
+	}
+	if err := tracker.Update(context.Background(), "story"); err == nil {
+		t.Fatal("Expected extraction error")
+	}
+	if tracker.State.Location != "start" || s.Context[0].Text != "Memory" || len(s.Context) != 2 {
+		t.Error("Expected state and context unchanged after error")
+	}
+}
+
+// TestConversationStateExtractor tests extraction through a chat model.
+func TestConversationStateExtractor(t *testing.T) {
+	fake := NewFakeBackend().On(`game state`, FakeResponse{
+		Text:             `{"location":"dock","inventory":[],"characters":["Ferryman"]}`,
+		PromptTokens:     50,
+		CompletionTokens: 12,
+	})
+	conv := NewConversation("You track game state.")
+	fake.Install(conv)
+	conv.AddMessage("user", "unrelated history")
+
+	st, err := NewConversationStateExtractor(conv).ExtractState(context.Background(), "You reach the dock.", AdventureState{})
+	if err != nil {
+		t.Fatalf("ExtractState failed: %v", err)
+	}
+	if st.Location != "dock" || st.Characters[0] != "Ferryman" {
+		t.Errorf("Unexpected state: %+v", st)
+	}
+	if len(conv.Messages) != 1 {
+		t.Errorf("Expected conversation history untouched, got %d messages", len(conv.Messages))
+	}
+	if conv.Usage.InputTokens != 50 || conv.Usage.OutputTokens != 12 {
+		t.Errorf("Expected usage added to conversation, got %+v", conv.Usage)
+	}
+	if prompt := fake.Requests()[0].Prompt; strings.Contains(prompt, "unrelated history") {
+		t.Error("Expected extraction to use a fresh history")
+	}
+}
@@ -0,0 +1,109 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestFormatAdventureInput tests do, say and story formatting.
+func TestFormatAdventureInput(t *testing.T) {
+	tests := []struct {
+		action   AdventureAction
+		input    string
+		expected string
+	}{
+		{ActionDo, "open the door", "> You open the door."},
+		{ActionDo, "  You Look around!", "> You look around!"},
+		{ActionDo, "> draw your sword", "> You draw your sword."},
+		{ActionDo, "I think so", "> You I think so."},
+		{ActionDo, "NASA calls", "> You NASA calls."},
+		{ActionDo, "you", ""},
+		{ActionSay, "hello there", `> You say "Hello there."`},
+		{ActionSay, `"Who goes there?"`, `> You say "Who goes there?"`},
+		{ActionSay, `""`, ""},
+		{ActionStory, "  Thunder rolls.  ", "Thunder rolls."},
+		{ActionStory, "   ", ""},
+	}
+	for _, tt := range tests {
+		if got := FormatAdventureInput(tt.action, tt.input); got != tt.expected {
+			t.Errorf("FormatAdventureInput(%d, %q): expected %q, got %q", tt.action, tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestNormalizeAdventureResponse tests response cleanup.
+func TestNormalizeAdventureResponse(t *testing.T) {
+	tests := map[string]string{
+		"\n The door creaks open.\n":            "The door creaks open.",
+		"It is dark.\n> You light a torch.\nOK": "It is dark.",
+		"> You wait.":                           "",
+		"Line one.\nLine two.  ":                "Line one.\nLine two.",
+	}
+	for input, expected := range tests {
+		if got := NormalizeAdventureResponse(input); got != expected {
+			t.Errorf("NormalizeAdventureResponse(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+// TestAdventureSession tests the transcript kept across actions.
+func TestAdventureSession(t *testing.T) {
+	var prompts []string
+	replies := []string{" The door creaks open.\n> You step", "\n\"Hello,\" says the guard.", " A bell rings."}
+	gen := StoryGeneratorFunc(func(ctx context.Context, story string) (string, error) {
+		prompts = append(prompts, story)
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	})
+
+	s := NewScenario("Adventure")
+	s.Settings.Mode = ModeAdventure
+	s.Prompt = "You stand before a castle."
+	if !s.IsAdventure() {
+		t.Fatal("Expected adventure scenario")
+	}
+	session := NewAdventureSession(s, gen)
+	ctx := context.Background()
+
+	response, err := session.Do(ctx, "open the door")
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if response != "The door creaks open." {
+		t.Errorf("Unexpected response: %q", response)
+	}
+	if prompts[0] != "You stand before a castle.\n> You open the door.\n" {
+		t.Errorf("Unexpected prompt: %q", prompts[0])
+	}
+
+	if _, err := session.Say(ctx, "hello"); err != nil {
+		t.Fatalf("Say failed: %v", err)
+	}
+	if _, err := session.Narrate(ctx, "Night falls."); err != nil {
+		t.Fatalf("Narrate failed: %v", err)
+	}
+
+	expected := "You stand before a castle.\n" +
+		"> You open the door.\nThe door creaks open.\n" +
+		"> You say \"Hello.\"\n\"Hello,\" says the guard.\n" +
+		"Night falls.\nA bell rings."
+	if session.Story != expected {
+		t.Errorf("Unexpected transcript:\n%s\nexpected:\n%s", session.Story, expected)
+	}
+}
+
+// TestAdventureSessionError tests that failed generations leave the story unchanged.
+func TestAdventureSessionError(t *testing.T) {
+	gen := StoryGeneratorFunc(func(ctx context.Context, story string) (string, error) {
+		return "", errors.New("offline")
+	})
+	session := &AdventureSession{Story: "Start.", Generator: gen}
+	if _, err := session.Do(context.Background(), "wait"); err == nil {
+		t.Fatal("Expected generation error")
+	}
+	if session.Story != "Start." {
+		t.Errorf("Expected story unchanged, got %q", session.Story)
+	}
+}
@@ -0,0 +1,180 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultAnswerAttempts is how many replies SendExtract generates before
+// giving up when none contains an answer.
+const DefaultAnswerAttempts = 3
+
+// ErrNoAnswer is returned when no reply contains an answer.
+var ErrNoAnswer = errors.New("no answer found in reply")
+
+// Extractor finds an answer in a reply, reporting whether there is one.
+type Extractor interface {
+	Extract(reply string) (string, bool)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(reply string) (string, bool)
+
+// Extract implements Extractor.
+func (f ExtractorFunc) Extract(reply string) (string, bool) {
+	return f(reply)
+}
+
+// answerLabel matches a label such as "Answer:" or "Final answer -" at the
+// start of a line.
+var answerLabel = regexp.MustCompile(`(?i)^(?:final\s+)?answer\s*[*_]*\s*[:\-–—]\s*[*_]*\s*`)
+
+// FinalLine extracts the last non-empty line of a reply, outside its think
+// block, without markdown emphasis or a leading "Answer:" label.
+func FinalLine() Extractor {
+	return ExtractorFunc(func(reply string) (string, bool) {
+		_, reply = splitThinking(reply)
+		lines := strings.Split(strings.TrimSpace(reply), "\n")
+		line := strings.Trim(strings.TrimSpace(lines[len(lines)-1]), "*_#> ")
+		line = strings.TrimSpace(answerLabel.ReplaceAllString(line, ""))
+		return line, line != ""
+	})
+}
+
+// BoxedAnswer extracts the content of the last \boxed{...} in a reply, as
+// models trained on math write their final answers.
+func BoxedAnswer() Extractor {
+	return ExtractorFunc(func(reply string) (string, bool) {
+		_, reply = splitThinking(reply)
+		start := strings.LastIndex(reply, `\boxed{`)
+		if start < 0 {
+			return "", false
+		}
+		start += len(`\boxed{`)
+		depth := 1
+		for i := start; i < len(reply); i++ {
+			switch reply[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					answer := strings.TrimSpace(reply[start:i])
+					return answer, answer != ""
+				}
+			}
+		}
+		return "", false
+	})
+}
+
+// JSONField extracts a field of the JSON object in a reply, ignoring any
+// text around it. path names the field, with dots separating nested
+// fields and array indexes, as in "scores.0.value". Strings are returned
+// as is and other values as JSON; a missing or null field is no answer.
+func JSONField(path string) Extractor {
+	return ExtractorFunc(func(reply string) (string, bool) {
+		_, reply = splitThinking(reply)
+		start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+		if start < 0 || end < start {
+			return "", false
+		}
+		var v any
+		if err := json.Unmarshal([]byte(reply[start:end+1]), &v); err != nil {
+			return "", false
+		}
+		for _, key := range strings.Split(path, ".") {
+			switch node := v.(type) {
+			case map[string]any:
+				v = node[key]
+			case []any:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(node) {
+					return "", false
+				}
+				v = node[i]
+			default:
+				return "", false
+			}
+		}
+		switch v := v.(type) {
+		case nil:
+			return "", false
+		case string:
+			return v, true
+		default:
+			data, err := json.Marshal(v)
+			return string(data), err == nil
+		}
+	})
+}
+
+// RegexCapture extracts the first group of the last match of re in a
+// reply, or the whole match if re has no groups. The last match is used
+// as models tend to restate their answer at the end.
+func RegexCapture(re *regexp.Regexp) Extractor {
+	return ExtractorFunc(func(reply string) (string, bool) {
+		_, reply = splitThinking(reply)
+		matches := re.FindAllStringSubmatch(reply, -1)
+		if len(matches) == 0 {
+			return "", false
+		}
+		m := matches[len(matches)-1]
+		if len(m) > 1 {
+			return m[1], true
+		}
+		return m[0], true
+	})
+}
+
+// SendExtract sends a user message and extracts an answer from the reply
+// with ex. A reply without an answer is regenerated, up to attempts
+// replies in all (DefaultAnswerAttempts if zero), and only the last
+// exchange is kept in the history. If no reply has an answer, the last
+// reply is returned with ErrNoAnswer.
+func (c *Conversation) SendExtract(text string, ex Extractor, attempts int) (answer, reply string, err error) {
+	if attempts <= 0 {
+		attempts = DefaultAnswerAttempts
+	}
+	keep := len(c.Messages)
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			c.Messages = c.Messages[:keep]
+			c.dropMessageMeta(keep)
+		}
+		reply, _, _, _, _, _, err = c.send(text, &c.Settings, SamplingProfile{})
+		if err != nil {
+			return "", reply, err
+		}
+		if answer, ok := ex.Extract(reply); ok {
+			return answer, reply, nil
+		}
+	}
+	return "", reply, ErrNoAnswer
+}
+
+// extractAnswer is SendExtract for side requests. Retries of a request at
+// temperature 0 sample at the settings' temperature instead, as repeating
+// it would give the same reply.
+func (c *Conversation) extractAnswer(ctx context.Context, prompt string, overrides SamplingProfile,
+	ex Extractor, attempts int) (answer, reply string, err error) {
+	if attempts <= 0 {
+		attempts = DefaultAnswerAttempts
+	}
+	for i := 0; i < attempts; i++ {
+		if i > 0 && overrides.Temperature != nil && *overrides.Temperature == 0 {
+			overrides.Temperature = nil
+		}
+		reply, err = c.sideRequest(ctx, prompt, overrides)
+		if err != nil {
+			return "", reply, err
+		}
+		if answer, ok := ex.Extract(reply); ok {
+			return answer, reply, nil
+		}
+	}
+	return "", reply, ErrNoAnswer
+}
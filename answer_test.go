@@ -0,0 +1,59 @@
+package novelai
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	tests := []struct {
+		name  string
+		ex    Extractor
+		reply string
+		want  string
+		ok    bool
+	}{
+		{"final line", FinalLine(), "Let me think.\n\n**Answer:** 42\n", "42", true},
+		{"final line think", FinalLine(), "<think>x</think>", "", false},
+		{"boxed", BoxedAnswer(), `So \boxed{1} or rather \boxed{\frac{1}{2}}.`, `\frac{1}{2}`, true},
+		{"boxed unclosed", BoxedAnswer(), `\boxed{\frac{1}{2}`, "", false},
+		{"json string", JSONField("verdict"), "Here:\n```json\n{\"verdict\": \"yes\"}\n```", "yes", true},
+		{"json nested", JSONField("scores.1.value"), `{"scores": [{"value": 1}, {"value": 2.5}]}`, "2.5", true},
+		{"json object", JSONField("a"), `{"a": {"b": true}}`, `{"b":true}`, true},
+		{"json missing", JSONField("a.c"), `{"a": {"b": true}}`, "", false},
+		{"json null", JSONField("a"), `{"a": null}`, "", false},
+		{"json invalid", JSONField("a"), `{"a": }`, "", false},
+		{"regex group", RegexCapture(regexp.MustCompile(`score: (\d+)`)), "score: 3, then score: 7", "7", true},
+		{"regex whole", RegexCapture(regexp.MustCompile(`\d+`)), "about 12 items", "12", true},
+		{"regex none", RegexCapture(regexp.MustCompile(`\d+`)), "none", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.ex.Extract(tt.reply)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSendExtract(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().On(`.`,
+		FakeResponse{Text: "Hard to say."},
+		FakeResponse{Text: `The answer is \boxed{7}.`},
+		FakeResponse{Text: "No idea."})
+	fake.Install(conv)
+
+	answer, reply, err := conv.SendExtract("What is 3+4?", BoxedAnswer(), 0)
+	if err != nil || answer != "7" || reply != `The answer is \boxed{7}.` {
+		t.Errorf("Got %q, %q, %v", answer, reply, err)
+	}
+	if len(conv.Messages) != 2 || conv.Messages[1].Content != reply {
+		t.Errorf("Expected only the last exchange kept, got %+v", conv.Messages)
+	}
+
+	_, reply, err = conv.SendExtract("And 2+2?", BoxedAnswer(), 1)
+	if !errors.Is(err, ErrNoAnswer) || reply != "No idea." || len(fake.Requests()) != 3 {
+		t.Errorf("Expected ErrNoAnswer after one attempt, got %q, %v", reply, err)
+	}
+}
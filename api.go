@@ -1,11 +1,8 @@
 package novelai
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strings"
@@ -21,16 +18,13 @@ var _ llmapi.Conversation = (*Conversation)(nil)
 // This is the default endpoint; it can be overridden per-conversation via SetEndpoint.
 var DefaultCompletionsURL = "https://staging-text.novelai.net/oa/v1/completions"
 
-// DefaultApiToken is set from NAI_API_KEY environment variable during init().
-// It can be overridden by setting it directly or per-conversation.
+// DefaultApiToken is loaded with LoadApiToken the first time the defaults
+// are needed, unless already set. It can be overridden per-conversation.
+//
+// Deprecated: assigning to DefaultApiToken is not safe while conversations
+// are being created. Use SetDefaults or UpdateDefaults instead.
 var DefaultApiToken string
 
-// HTTP retry configuration
-var (
-	retries    = 3
-	retryDelay = 3 * time.Second
-)
-
 // GLM special tokens for conversation structure
 const (
 	glmPrefix    = "[gMASK]<sop>"
@@ -46,21 +40,112 @@ type Conversation struct {
 	Ctx context.Context
 	// System is the system prompt for the conversation.
 	System string
+	// UserPersona, if set, describes the user to the model. It is placed in
+	// the system prompt or as a memory line, as the template directs, and
+	// its name replaces {{user}} in the prompt.
+	UserPersona *Persona
+	// CharName, if set, replaces {{char}} in the prompt.
+	CharName string
+	// Macros configures macro expansion in the prompt, such as a fixed
+	// clock or random source. If nil, macros are expanded with defaults.
+	// Unset names are taken from UserPersona and CharName.
+	Macros *MacroEngine
 	// Messages is the conversation history.
 	Messages []Message
 	// Usage tracks cumulative token consumption.
 	Usage Usage
+	// Turns records the requests that produced replies, for Stats.
+	Turns []TurnRecord
 	// ApiToken is the NovelAI API token for this conversation.
 	ApiToken string
 	// Settings configures generation parameters.
 	Settings Settings
-	// HttpClient is used for API requests.
+	// Profiles are named sampling profiles selectable per call with
+	// SendProfile, in addition to BuiltinProfiles.
+	Profiles map[string]SamplingProfile
+	// HttpClient is used for API requests. For streaming requests, its
+	// Timeout limits the wait for the response to start rather than the
+	// whole stream.
 	HttpClient *http.Client
+	// StreamingClient, if set, is used as is for streaming requests instead
+	// of HttpClient.
+	StreamingClient *http.Client
+	// StreamConfig, if set, configures the proxy, timeouts and reconnects
+	// of streaming requests.
+	StreamConfig *StreamConfig
+	// Retry, if set, replaces DefaultRetryPolicy for this conversation.
+	Retry *RetryPolicy
+	// Clock, if set, replaces SystemClock for waiting between retries and
+	// Experiment intervals.
+	Clock Clock
+	// LastLogprobs are the log probabilities of the last reply's tokens,
+	// when Settings.Logprobs is set and the model returns them.
+	LastLogprobs []TokenLogprob
+	// LastStopSequence is the stop sequence that ended the last reply, or
+	// "" if it ended otherwise or the sequence is not known.
+	LastStopSequence string
+	// Schedule, if set, changes the sampling of each segment of
+	// SendUntilDone and SendStreamingUntilDone.
+	Schedule *Schedule
 	// Tools stores tool definitions (not used by NovelAI API, but stored for interface compliance).
 	Tools []llmapi.ToolDefinition
+	// ToolResults are tool outputs kept as context entries with their own
+	// budget and expiry; see AddToolResult.
+	ToolResults []ToolResult
+	// ToolResultBudget is the total token budget for ToolResults. If zero,
+	// DefaultToolResultBudget is used.
+	ToolResultBudget int
+	// Meta holds application metadata, such as the title and tags set by
+	// GenerateTitle and GenerateTags.
+	Meta map[string]string
 	// Endpoint overrides the default API endpoint URL.
 	// If empty, DefaultCompletionsURL is used.
 	Endpoint string
+	// Queue, if set, gates requests through an account-level RequestQueue.
+	// Conversations sharing an API token should share a queue.
+	Queue *RequestQueue
+	// Priority is this conversation's priority when waiting in Queue.
+	Priority Priority
+	// Codec, if set, replaces DefaultCodec for requests and responses.
+	Codec JSONCodec
+	// MaxBodyBytes limits response bodies and streamed replies; exceeding
+	// it is an error. If zero, DefaultMaxBodyBytes is used. To end long
+	// replies gracefully instead, see Settings.MaxResponseBytes.
+	MaxBodyBytes int64
+	// Classifier, if set, classifies each completed reply in the
+	// background; read the verdicts from Verdicts.
+	Classifier Classifier
+	// Translator, if set, translates user text from Language into
+	// ModelLanguage before it is sent, and replies back into Language. The
+	// history and prompt stay in ModelLanguage.
+	Translator Translator
+	// Language is the user's language. If empty or equal to ModelLanguage,
+	// nothing is translated.
+	Language string
+	// ModelLanguage is the language the prompt is kept in. If empty,
+	// DefaultModelLanguage is used.
+	ModelLanguage string
+	// ThinkingRetention, if set, drops or summarizes the thinking of older
+	// replies after each reply; see PruneThinking.
+	ThinkingRetention *ThinkingRetention
+	// SafetyClassifier, if set, annotates each exchange with the safety
+	// categories found after its reply; see AnnotateSafety.
+	SafetyClassifier SafetyClassifier
+	// OnShutdown, if set, is called by Shutdown once requests have stopped,
+	// to flush usage records or stores the application keeps.
+	OnShutdown func(ctx context.Context) error
+
+	// modelErr is the error of the last SetModel, returned by requests.
+	modelErr error
+	// life tracks requests and background work for Shutdown.
+	life     *lifecycle
+	verdicts chan Verdict
+	// historyFilter, if set, selects the history for the current request;
+	// messages from filterBase on were added by the request and are kept.
+	historyFilter HistoryFilter
+	filterBase    int
+	// lastActive is when the latest reply was received, for {{idle_duration}}.
+	lastActive time.Time
 }
 
 // context returns the conversation's context, defaulting to Background if nil.
@@ -71,24 +156,88 @@ func (c *Conversation) context() context.Context {
 	return context.Background()
 }
 
+// acquireSlot waits for a slot in the conversation's request queue, until
+// ctx is done. Returns a no-op release function if no queue is configured.
+// A SendAsync job requesting with ctx is then marked running.
+func (c *Conversation) acquireSlot(ctx context.Context) (release func(), err error) {
+	release = func() {}
+	if c.Queue != nil {
+		release, err = c.Queue.Acquire(ctx, c.Priority)
+		if err != nil {
+			return nil, fmt.Errorf("error waiting for request queue: %w", err)
+		}
+	}
+	if job, ok := ctx.Value(jobKey{}).(*Job); ok {
+		job.start()
+	}
+	return release, nil
+}
+
 // NewConversation creates a new conversation with the given system prompt.
-// It initializes with DefaultSettings and DefaultApiToken.
+// It initializes with the token and settings from CurrentDefaults. The
+// settings are a deep copy, so changing one conversation's settings, such as
+// its stop sequences, never affects another's.
 func NewConversation(system string) *Conversation {
+	d := CurrentDefaults()
 	return &Conversation{
 		System:     system,
 		Messages:   make([]Message, 0),
-		ApiToken:   DefaultApiToken,
-		Settings:   DefaultSettings,
+		ApiToken:   d.ApiToken,
+		Settings:   d.Settings,
 		HttpClient: &http.Client{Timeout: 120 * time.Second},
+		life:       newLifecycle(),
+	}
+}
+
+// ConversationConfig configures a conversation created with
+// NewConversationWithClient.
+type ConversationConfig struct {
+	// System is the system prompt.
+	System string
+	// ApiToken is the token to authenticate with.
+	ApiToken string
+	// Endpoint, if set, replaces DefaultCompletionsURL.
+	Endpoint string
+	// Settings are the generation settings, used as given; start from
+	// BuiltinSettings() for the usual ones.
+	Settings Settings
+	// Dial, if set, makes the client's connections, such as through
+	// UnixSocketDialer, SOCKS5Dialer or PinnedDialer. It applies when the
+	// client's transport is an *http.Transport, or unset.
+	Dial DialFunc
+}
+
+// NewConversationWithClient creates a conversation from config alone,
+// sending requests with client, or a client with the usual timeout if nil.
+// Unlike NewConversation, it never consults the package defaults, so the
+// environment and token files are not read: use it where they are not
+// available, such as in WASM or a sandbox.
+func NewConversationWithClient(client *http.Client, config ConversationConfig) *Conversation {
+	if client == nil {
+		client = &http.Client{Timeout: 120 * time.Second}
+	}
+	if config.Dial != nil {
+		client = withDial(client, config.Dial)
+	}
+	return &Conversation{
+		System:     config.System,
+		Messages:   make([]Message, 0),
+		ApiToken:   config.ApiToken,
+		Endpoint:   config.Endpoint,
+		Settings:   config.Settings.Clone(),
+		HttpClient: client,
+		life:       newLifecycle(),
 	}
 }
 
 // Send sends a user message and returns the assistant's reply.
 // If text is empty, continues from the last assistant message (for max_tokens continuation).
+// Non-zero sampling fields override Settings for this call; zero fields are
+// unset. Use SendWith to override with an explicit zero.
 //
 // Returns:
 //   - reply: The assistant's response text
-//   - stopReason: Normalized stop reason ("end_turn", "max_tokens", "stop_sequence")
+//   - stopReason: Normalized stop reason, one of the StopReason constants
 //   - inputTokens: Tokens used for this request's input
 //   - outputTokens: Tokens generated in this response
 //   - cacheCreationTokens: Always 0 (NovelAI doesn't report cache stats)
@@ -102,10 +251,79 @@ func (c *Conversation) Send(text string, sampling llmapi.Sampling) (
 	cacheCreationTokens int,
 	cacheReadTokens int,
 	err error,
+) {
+	return c.send(text, &c.Settings, SamplingOverrides(sampling))
+}
+
+// send implements Send using settings in place of c.Settings, with
+// overrides applied on top. A reply shorter than settings.MinTokens is
+// continued, and ThinkingRetention is applied after the reply.
+func (c *Conversation) send(text string, settings *Settings, overrides SamplingProfile) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	return c.sendContext(c.context(), text, settings, overrides)
+}
+
+// sendContext implements send with ctx in place of the conversation's
+// context.
+func (c *Conversation) sendContext(ctx context.Context, text string, settings *Settings, overrides SamplingProfile) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	reply, stopReason, inputTokens, outputTokens, _, _, err = c.sendOnce(ctx, text, settings, overrides)
+	if err != nil {
+		return reply, stopReason, inputTokens, outputTokens, 0, 0, err
+	}
+	reply, stopReason, inputTokens, outputTokens, err = c.reachMinTokens(settings, overrides,
+		reply, stopReason, inputTokens, outputTokens,
+		func(settings *Settings, overrides SamplingProfile) (string, string, int, int, error) {
+			reply, stopReason, inputTokens, outputTokens, _, _, err := c.sendOnce(ctx, "", settings, overrides)
+			return reply, stopReason, inputTokens, outputTokens, err
+		})
+	if err == nil {
+		c.pruneThinking(ctx)
+		c.annotateSafety(ctx)
+	}
+	return reply, stopReason, inputTokens, outputTokens, 0, 0, err
+}
+
+// sendOnce sends a single request for send, with ctx.
+func (c *Conversation) sendOnce(ctx context.Context, text string, settings *Settings, overrides SamplingProfile) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
 ) {
 	if c.ApiToken == "" {
 		return "", "", 0, 0, 0, 0, fmt.Errorf("API token not set")
 	}
+	if c.modelErr != nil {
+		return "", "", 0, 0, 0, 0, c.modelErr
+	}
+	ctx, done, err := c.track(ctx)
+	if err != nil {
+		return "", "", 0, 0, 0, 0, err
+	}
+	defer done()
+
+	// Translate user text into the model's language
+	if text, err = c.translateInput(ctx, text); err != nil {
+		return "", "", 0, 0, 0, 0, err
+	}
 
 	// Add user message if provided
 	if text != "" {
@@ -120,76 +338,47 @@ func (c *Conversation) Send(text string, sampling llmapi.Sampling) (
 	// Build prompt string from system + conversation history
 	prompt := c.buildPrompt()
 
-	// Use sampling overrides if provided, otherwise use conversation defaults
-	temperature := c.Settings.Temperature
-	if sampling.Temperature != 0 {
-		temperature = sampling.Temperature
-	}
-	topP := c.Settings.TopP
-	if sampling.TopP != 0 {
-		topP = sampling.TopP
-	}
-	topK := c.Settings.TopK
-	if sampling.TopK != 0 {
-		topK = sampling.TopK
-	}
-
-	req := completionRequest{
-		Model:             c.Settings.Model,
-		Prompt:            prompt,
-		MaxTokens:         c.Settings.MaxTokens,
-		Temperature:       temperature,
-		TopP:              topP,
-		TopK:              topK,
-		MinP:              c.Settings.MinP,
-		FrequencyPenalty:  c.Settings.FrequencyPenalty,
-		PresencePenalty:   c.Settings.PresencePenalty,
-		RepetitionPenalty: c.Settings.RepetitionPenalty,
-		Stop:              c.Settings.StopSequences,
-	}
+	req := newCompletionRequest(prompt, settings, overrides)
 
 	// Marshal request to JSON
-	jsonData, err := json.Marshal(req)
+	jsonData, err := c.codec().Marshal(req)
 	if err != nil {
 		return "", "", 0, 0, 0, 0, fmt.Errorf("error marshaling request: %w", err)
 	}
 
+	fingerprint, err := req.fingerprint()
+	if err != nil {
+		return "", "", 0, 0, 0, 0, err
+	}
+
 	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(c.context(), "POST", c.endpoint(), bytes.NewBuffer(jsonData))
+	timing := &requestTimer{fingerprint: fingerprint}
+	httpReq, err := newRequest(timing.trace(ctx), "POST", c.endpoint(), c.ApiToken, "application/json", jsonData)
 	if err != nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("error creating request: %w", err)
+		return "", "", 0, 0, 0, 0, err
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.ApiToken)
+	// Wait for our turn if requests are queued
+	timing.wait()
+	release, err := c.acquireSlot(ctx)
+	if err != nil {
+		return "", "", 0, 0, 0, 0, err
+	}
+	defer release()
 
 	// Perform request with retries
-	var resp *http.Response
-	for attempt := 0; attempt <= retries; attempt++ {
-		resp, err = c.HttpClient.Do(httpReq)
-		if err == nil {
-			break
-		}
-		if attempt < retries {
-			time.Sleep(retryDelay)
-			// Recreate request body for retry
-			httpReq, _ = http.NewRequestWithContext(c.context(), "POST", c.endpoint(), bytes.NewBuffer(jsonData))
-			httpReq.Header.Set("Content-Type", "application/json")
-			httpReq.Header.Set("Authorization", "Bearer "+c.ApiToken)
-		}
-	}
+	timing.send()
+	resp, err := doWithRetries(c.HttpClient, httpReq, c.retryPolicy(), clockOr(c.Clock))
 	if err != nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("HTTP error after %d retries: %w", retries, err)
-	}
-	if resp == nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("HTTP response is nil")
+		return "", c.errorStopReason(ctx, ""), 0, 0, 0, 0, err
 	}
 	defer resp.Body.Close()
+	timing.respond()
 
 	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(resp.Body, c.maxBodyBytes())
 	if err != nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("error reading response: %w", err)
+		return "", c.errorStopReason(ctx, ""), 0, 0, 0, 0, fmt.Errorf("error reading response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -198,10 +387,11 @@ func (c *Conversation) Send(text string, sampling llmapi.Sampling) (
 
 	// Parse response
 	var compResp completionResponse
-	if err := json.Unmarshal(body, &compResp); err != nil {
+	if err := c.codec().Unmarshal(body, &compResp); err != nil {
 		return string(body), "", 0, 0, 0, 0, fmt.Errorf("error parsing response: %w", err)
 	}
 
+	c.captureResponse(ctx, body, &compResp)
 	if len(compResp.Choices) == 0 {
 		return "", "", 0, 0, 0, 0, fmt.Errorf("no choices in response")
 	}
@@ -211,75 +401,68 @@ func (c *Conversation) Send(text string, sampling llmapi.Sampling) (
 
 	// Add assistant message to history
 	c.Messages = append(c.Messages, Message{Role: "assistant", Content: reply})
+	c.lastActive = time.Now()
+	c.classifyReply(len(c.Messages) - 1)
 
 	// Normalize stop reason from OpenAI format to common format
 	stopReason = normalizeStopReason(choice.FinishReason)
+	c.LastLogprobs = choice.Logprobs.tokens()
+	c.LastStopSequence = ""
+	if choice.FinishReason == "stop" {
+		c.LastStopSequence = firedStopSequence(reply, req.Stop, choice.StopReason, choice.MatchedStop)
+	}
 
 	// Update usage
 	inputTokens = compResp.Usage.PromptTokens
 	outputTokens = compResp.Usage.CompletionTokens
 	c.Usage.InputTokens += inputTokens
 	c.Usage.OutputTokens += outputTokens
+	c.recordTurn(timing, reply, stopReason, inputTokens, outputTokens)
 
-	return reply, stopReason, inputTokens, outputTokens, 0, 0, nil
+	reply, err = c.translateReply(ctx, reply)
+	return reply, stopReason, inputTokens, outputTokens, 0, 0, err
 }
 
-// buildPrompt constructs a prompt string from the system prompt and conversation history.
-// Uses GLM-4's special token format: [gMASK]<sop><|system|>...<|user|>...<|assistant|>
-// When Settings.Thinking is false, applies ThinkFormat to disable extended thinking.
-func (c *Conversation) buildPrompt() string {
-	var b strings.Builder
-	tf := c.thinkFormat()
-
-	// Start with GLM prefix
-	b.WriteString(glmPrefix)
-
-	// System prompt
-	if c.System != "" {
-		b.WriteString(glmSystem)
-		b.WriteString("\n")
-		b.WriteString(c.System)
-		b.WriteString("\n")
-	}
-
-	// Conversation history
-	for i, msg := range c.Messages {
-		isLastMessage := i == len(c.Messages)-1
-
-		switch msg.Role {
-		case "user":
-			b.WriteString(glmUser)
-			b.WriteString("\n")
-			b.WriteString(msg.Content)
-			// Append user suffix (e.g., /nothink) to last user message if thinking is disabled
-			if isLastMessage && !c.Settings.Thinking && tf.UserSuffix != "" {
-				b.WriteString(tf.UserSuffix)
-			}
-			b.WriteString("\n")
-		case "assistant":
-			b.WriteString(glmAssistant)
-			b.WriteString("\n")
-			b.WriteString(msg.Content)
-			b.WriteString("\n")
-		case "system":
-			// Additional system messages mid-conversation
-			b.WriteString(glmSystem)
-			b.WriteString("\n")
-			b.WriteString(msg.Content)
-			b.WriteString("\n")
-		}
-	}
-
-	// End with assistant token to prompt for response
-	b.WriteString(glmAssistant)
-	b.WriteString("\n")
-
-	// If thinking is disabled, prefill with assistant prefix (e.g., </think> or <think></think>)
-	if !c.Settings.Thinking && tf.AssistantPrefix != "" {
-		b.WriteString(tf.AssistantPrefix)
+// newCompletionRequest builds a request for prompt from settings, with the
+// set fields of overrides taking precedence for this call. Zero-valued
+// sampler settings are omitted so the server default applies; a set
+// override is always sent, even if it is zero.
+func newCompletionRequest(prompt string, settings *Settings, overrides SamplingProfile) completionRequest {
+	p := settingsProfile(settings).Merge(overrides)
+	maxTokens := settings.MaxTokens
+	if p.MaxTokens != nil {
+		maxTokens = *p.MaxTokens
+	}
+	stop := settings.StopSequences
+	if p.StopSequences != nil {
+		stop = p.StopSequences
+	}
+	return completionRequest{
+		Model:             string(settings.Model),
+		Prompt:            prompt,
+		MaxTokens:         maxTokens,
+		Temperature:       p.Temperature,
+		TopP:              p.TopP,
+		TopK:              p.TopK,
+		MinP:              p.MinP,
+		FrequencyPenalty:  p.FrequencyPenalty,
+		PresencePenalty:   p.PresencePenalty,
+		RepetitionPenalty: p.RepetitionPenalty,
+		Stop:              stop,
+		LogitBias:         settings.LogitBias,
+		Logprobs:          settings.Logprobs,
+		Seed:              settings.Seed,
+		Extra:             settings.Extra,
 	}
+}
 
-	return b.String()
+// buildPrompt constructs a prompt string from the system prompt and conversation history
+// using the conversation's PromptTemplate (GLM-4's [gMASK]<sop><|system|>...<|user|>...<|assistant|>
+// format by default). When Settings.Thinking is false, applies ThinkFormat to disable extended thinking.
+// The user persona is added and macros are expanded; the history is not modified.
+func (c *Conversation) buildPrompt() string {
+	return c.promptTemplate().Render(c.systemPrompt(), c.expandMessages(c.promptMessages()),
+		c.Settings.Thinking, c.thinkFormat())
 }
 
 // normalizeStopReason converts OpenAI stop reasons to the common format
@@ -287,18 +470,19 @@ func (c *Conversation) buildPrompt() string {
 func normalizeStopReason(reason string) string {
 	switch reason {
 	case "stop":
-		return "end_turn"
+		return string(StopEndTurn)
 	case "length":
-		return "max_tokens"
+		return string(StopMaxTokens)
 	case "tool_calls":
-		return "tool_use"
+		return string(StopToolUse)
 	default:
 		return reason
 	}
 }
 
-// SendUntilDone repeatedly calls Send until stopReason != "max_tokens".
-// Returns the complete accumulated output.
+// SendUntilDone repeatedly calls Send until the stop reason is not StopMaxTokens.
+// Returns the complete accumulated output. Each segment's sampling follows
+// Schedule, if set.
 func (c *Conversation) SendUntilDone(text string, sampling llmapi.Sampling) (
 	reply string,
 	stopReason string,
@@ -310,15 +494,19 @@ func (c *Conversation) SendUntilDone(text string, sampling llmapi.Sampling) (
 ) {
 	var totalReply string
 	input := text
+	defer c.annotateWhenDone(&err)()
 
+	k := c.newContinuation(SamplingOverrides(sampling))
 	for {
 		var partReply string
 		var inToks, outToks int
 
-		partReply, stopReason, inToks, outToks, _, _, err = c.Send(input, sampling)
+		settings, overrides := k.next()
+		partReply, stopReason, inToks, outToks, _, _, err = c.send(input, settings, overrides)
 		if err != nil {
 			return totalReply, stopReason, inputTokens, outputTokens, 0, 0, err
 		}
+		k.done(partReply)
 
 		totalReply += partReply
 		inputTokens += inToks
@@ -327,7 +515,7 @@ func (c *Conversation) SendUntilDone(text string, sampling llmapi.Sampling) (
 		// Merge consecutive assistant messages
 		c.MergeIfLastTwoAssistant()
 
-		if stopReason != "max_tokens" {
+		if StopReason(stopReason) != StopMaxTokens {
 			break
 		}
 
@@ -354,14 +542,18 @@ func (c *Conversation) MergeIfLastTwoAssistant() {
 		return
 	}
 
-	// Merge: trim trailing whitespace from second-last, append last
-	merged := strings.TrimRight(c.Messages[secondLastIdx].Content, " \t\n\r")
-	merged += strings.TrimSpace(c.Messages[lastIdx].Content)
-
-	c.Messages[secondLastIdx].Content = merged
+	c.mergeMessageMeta(secondLastIdx)
+	c.Messages[secondLastIdx].Content = mergedContent(c.Messages[secondLastIdx].Content,
+		c.Messages[lastIdx].Content)
 	c.Messages = c.Messages[:lastIdx]
 }
 
+// mergedContent returns two replies merged by MergeIfLastTwoAssistant: the
+// first without trailing whitespace, followed by the trimmed second.
+func mergedContent(first, second string) string {
+	return strings.TrimRight(first, " \t\n\r") + strings.TrimSpace(second)
+}
+
 // AddMessage manually adds a message to the conversation history.
 func (c *Conversation) AddMessage(role llmapi.Role, content string) {
 	c.Messages = append(c.Messages, Message{Role: string(role), Content: content})
@@ -395,8 +587,12 @@ func (c *Conversation) GetSystem() string {
 }
 
 // Clear resets the conversation history but keeps the system prompt and settings.
+// Metadata kept for the messages, such as their originals and safety
+// annotations, is dropped.
 func (c *Conversation) Clear() {
 	c.Messages = make([]Message, 0)
+	c.dropMessageMeta(0)
+	c.ToolResults = nil
 	c.Usage = Usage{}
 }
 
@@ -407,9 +603,18 @@ func (c *Conversation) SetContext(ctx context.Context) {
 	c.Ctx = ctx
 }
 
-// SetModel changes the model for subsequent API calls.
+// SetModel changes the model for subsequent API calls. The model must be
+// known or have a registered prompt template, as for UseModel, but its
+// template is not applied. SetModel implements llmapi.Conversation, which
+// has no error to return, so for any other model it leaves the model
+// unchanged and requests fail with the error until a valid model is set.
 func (c *Conversation) SetModel(model string) {
-	c.Settings.Model = model
+	if err := checkModel(Model(model)); err != nil {
+		c.modelErr = fmt.Errorf("error setting model: %w", err)
+		return
+	}
+	c.Settings.Model = Model(model)
+	c.modelErr = nil
 }
 
 // SetEndpoint overrides the API endpoint URL for this conversation.
@@ -428,12 +633,13 @@ func (c *Conversation) endpoint() string {
 }
 
 // thinkFormat returns the effective ThinkFormat for this conversation.
-// Returns Settings.ThinkFormat if set, otherwise ThinkFormatGLM46 for backwards compatibility.
+// Returns Settings.ThinkFormat if set, otherwise the prompt template's
+// (ThinkFormatGLM46 unless a template is configured).
 func (c *Conversation) thinkFormat() *ThinkFormat {
 	if c.Settings.ThinkFormat != nil {
 		return c.Settings.ThinkFormat
 	}
-	return &ThinkFormatGLM46
+	return &c.promptTemplate().Think
 }
 
 // SetThinkFormat sets the think format for this conversation.
@@ -443,27 +649,22 @@ func (c *Conversation) SetThinkFormat(format *ThinkFormat) {
 	c.Settings.ThinkFormat = format
 }
 
-// init loads the API token from environment variable or token files.
+// LoadApiToken returns the API token from the environment or token files,
+// or "" if there is none.
 // Priority: NAI_API_KEY env var > ~/.naitoken > ./.naitoken
-func init() {
+func LoadApiToken() string {
 	// 1. Environment variable (highest priority)
 	if token := os.Getenv("NAI_API_KEY"); token != "" {
-		DefaultApiToken = token
-		return
+		return token
 	}
 
-	// 2. Home directory token file
-	if home, err := os.UserHomeDir(); err == nil {
-		if token := readTokenFile(home + "/.naitoken"); token != "" {
-			DefaultApiToken = token
-			return
+	// 2. Token files, where there is a filesystem
+	for _, path := range tokenFiles() {
+		if token := readTokenFile(path); token != "" {
+			return token
 		}
 	}
-
-	// 3. Current directory token file
-	if token := readTokenFile(".naitoken"); token != "" {
-		DefaultApiToken = token
-	}
+	return ""
 }
 
 // readTokenFile reads a token from a file, returning empty string on error.
@@ -485,8 +686,9 @@ func readTokenFile(path string) string {
 //
 // If content is nil or empty, continues from the last message.
 func (c *Conversation) SendRich(content []llmapi.ContentBlock, sampling llmapi.Sampling) (*llmapi.RichResponse, error) {
-	// Extract text from content blocks
+	// Extract text from content blocks; tool results become context entries
 	text := extractTextFromBlocks(content)
+	c.addToolResultBlocks(content)
 
 	reply, stopReason, inputTokens, outputTokens, _, _, err := c.Send(text, sampling)
 	if err != nil {
@@ -510,8 +712,9 @@ func (c *Conversation) SendRich(content []llmapi.ContentBlock, sampling llmapi.S
 // NovelAI doesn't support rich content natively, so this extracts text and
 // delegates to SendStreaming.
 func (c *Conversation) SendRichStreaming(content []llmapi.ContentBlock, sampling llmapi.Sampling, callback llmapi.StreamCallback) (*llmapi.RichResponse, error) {
-	// Extract text from content blocks
+	// Extract text from content blocks; tool results become context entries
 	text := extractTextFromBlocks(content)
+	c.addToolResultBlocks(content)
 
 	reply, stopReason, inputTokens, outputTokens, _, _, err := c.SendStreaming(text, sampling, callback)
 	if err != nil {
@@ -533,9 +736,13 @@ func (c *Conversation) SendRichStreaming(content []llmapi.ContentBlock, sampling
 
 // AddRichMessage adds a message with multiple content blocks to the history.
 // NovelAI doesn't support rich content, so this extracts text and adds a
-// simple message.
+// simple message. Tool result blocks are stored with AddToolResult instead.
 func (c *Conversation) AddRichMessage(role llmapi.Role, content []llmapi.ContentBlock) {
+	c.addToolResultBlocks(content)
 	text := extractTextFromBlocks(content)
+	if text == "" && onlyToolResults(content) {
+		return
+	}
 	c.Messages = append(c.Messages, Message{Role: string(role), Content: text})
 }
 
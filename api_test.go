@@ -19,11 +19,7 @@ func mockCompletionResponse(text, finishReason string, promptTokens, completionT
 		Object:  "text_completion",
 		Created: 1677652288,
 		Model:   "glm-4-6",
-		Choices: []struct {
-			Index        int    `json:"index"`
-			Text         string `json:"text"`
-			FinishReason string `json:"finish_reason"`
-		}{
+		Choices: []completionChoice{
 			{
 				Index:        0,
 				Text:         text,
@@ -63,6 +59,55 @@ func TestNewConversation(t *testing.T) {
 	}
 }
 
+// TestNewConversationSettingsIndependent tests that conversations don't
+// share settings state with each other or with DefaultSettings.
+func TestNewConversationSettingsIndependent(t *testing.T) {
+	a := NewConversation("")
+	b := NewConversation("")
+
+	a.Settings.StopSequences[0] = "changed"
+	a.Settings.StopSequences = append(a.Settings.StopSequences, "extra")
+	a.Settings.ThinkFormat.UserSuffix = "changed"
+
+	if b.Settings.StopSequences[0] == "changed" || len(b.Settings.StopSequences) != len(DefaultSettings.StopSequences) {
+		t.Errorf("Expected other conversation's stop sequences unchanged, got %v", b.Settings.StopSequences)
+	}
+	if DefaultSettings.StopSequences[0] == "changed" {
+		t.Errorf("Expected DefaultSettings stop sequences unchanged, got %v", DefaultSettings.StopSequences)
+	}
+	if b.Settings.ThinkFormat.UserSuffix == "changed" || ThinkFormatGLM46.UserSuffix == "changed" {
+		t.Error("Expected think formats unchanged")
+	}
+}
+
+// TestSettingsClone tests that Clone copies every slice, map and pointer.
+func TestSettingsClone(t *testing.T) {
+	tmpl := PromptGLM46
+	tmpl.Directives = &Directives{Styles: map[ResponseStyle]string{StylePlain: "plain"}}
+	s := Settings{
+		StopSequences: []string{"a"},
+		LogitBias:     map[int]float64{1: -1},
+		ThinkFormat:   &ThinkFormat{UserSuffix: "/nothink"},
+		Template:      &tmpl,
+	}
+	c := s.Clone()
+	c.StopSequences[0] = "b"
+	c.LogitBias[1] = 1
+	c.ThinkFormat.UserSuffix = ""
+	c.Template.StopSequences[0] = "x"
+	c.Template.Directives.Styles[StylePlain] = "changed"
+
+	if s.StopSequences[0] != "a" || s.LogitBias[1] != -1 || s.ThinkFormat.UserSuffix != "/nothink" {
+		t.Errorf("Expected original settings unchanged, got %+v", s)
+	}
+	if PromptGLM46.StopSequences[0] == "x" || tmpl.Directives.Styles[StylePlain] != "plain" {
+		t.Error("Expected original template unchanged")
+	}
+	if z := (Settings{}).Clone(); z.StopSequences != nil || z.LogitBias != nil || z.ThinkFormat != nil || z.Template != nil {
+		t.Errorf("Expected zero settings to clone to zero, got %+v", z)
+	}
+}
+
 func TestSend(t *testing.T) {
 	// Create mock server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -506,7 +551,7 @@ func TestEndpointOverrideWithMockServer(t *testing.T) {
 // TestContextCancellationMidStream tests cancelling a real streaming request
 // mid-generation. This is an integration test that requires valid API credentials.
 func TestContextCancellationMidStream(t *testing.T) {
-	if DefaultApiToken == "" {
+	if CurrentDefaults().ApiToken == "" {
 		t.Skip("Skipping integration test: NAI_API_KEY not set")
 	}
 
@@ -705,7 +750,7 @@ func TestDefaultSettingsThinkFormat(t *testing.T) {
 // TestStreamingUsageDataIntegration tests that the real NovelAI API returns
 // usage data in streaming mode when stream_options.include_usage is set.
 func TestStreamingUsageDataIntegration(t *testing.T) {
-	if DefaultApiToken == "" {
+	if CurrentDefaults().ApiToken == "" {
 		t.Skip("Skipping integration test: NAI_API_KEY not set")
 	}
 
@@ -0,0 +1,217 @@
+package novelai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+// JobStatus is the state of a background generation.
+type JobStatus string
+
+// Job states.
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// JobResult is the outcome of a background generation.
+type JobResult struct {
+	JobID        string    `json:"job_id"`
+	Status       JobStatus `json:"status"`
+	Reply        string    `json:"reply"`
+	StopReason   string    `json:"stop_reason,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	// Error is Err's message, for serialized results.
+	Error string `json:"error,omitempty"`
+	Err   error  `json:"-"`
+}
+
+// CompletionFunc is called with the result of a job when it finishes.
+type CompletionFunc func(r *JobResult)
+
+// Job is a generation running in the background, started by SendAsync.
+type Job struct {
+	// ID identifies the job, e.g. to match webhook deliveries.
+	ID string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	status JobStatus
+	result *JobResult
+}
+
+// SendAsync starts Send in the background and returns its job at once.
+// When generation finishes, the reply is added to the history as usual
+// and onComplete, if not nil, is called with the result; use
+// Webhook.Notify to post it to a URL. The job is pending until its request
+// has a slot in Queue, and then running. The conversation must not be used
+// until the job is done.
+func (c *Conversation) SendAsync(text string, sampling llmapi.Sampling, onComplete CompletionFunc) *Job {
+	ctx, cancel := context.WithCancel(c.context())
+	job := &Job{ID: newUUID(), cancel: cancel, done: make(chan struct{}), status: JobPending}
+	// The job is pending until its request has a slot in the queue
+	ctx = context.WithValue(ctx, jobKey{}, job)
+	// Shutdown waits for the job, including onComplete
+	ctx, done, err := c.track(ctx)
+	go func() {
+		defer cancel()
+		var reply, stopReason string
+		var inToks, outToks int
+		if err == nil {
+			defer done()
+			reply, stopReason, inToks, outToks, _, _, err = c.sendContext(ctx, text, &c.Settings, SamplingOverrides(sampling))
+		}
+
+		r := &JobResult{
+			JobID:        job.ID,
+			Status:       JobDone,
+			Reply:        reply,
+			StopReason:   stopReason,
+			InputTokens:  inToks,
+			OutputTokens: outToks,
+			Err:          err,
+		}
+		if err != nil {
+			r.Status, r.Error = JobFailed, err.Error()
+		}
+		job.finish(r)
+		if onComplete != nil {
+			onComplete(r)
+		}
+	}()
+	return job
+}
+
+// Status returns the job's current state.
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Done returns a channel that is closed when the job finishes.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result returns the job's result, or false if it has not finished.
+func (j *Job) Result() (*JobResult, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result, j.result != nil
+}
+
+// Wait blocks until the job finishes or ctx is done, and returns the
+// job's result. The error is the job's error, or ctx's if it ended first.
+func (j *Job) Wait(ctx context.Context) (*JobResult, error) {
+	select {
+	case <-j.done:
+		r, _ := j.Result()
+		return r, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel stops the job's request. The job then fails with the
+// cancellation error.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// jobKey is the context key of the Job a request is made for.
+type jobKey struct{}
+
+// start marks the job running.
+func (j *Job) start() {
+	j.mu.Lock()
+	if j.status == JobPending {
+		j.status = JobRunning
+	}
+	j.mu.Unlock()
+}
+
+// finish records the job's result and wakes waiters.
+func (j *Job) finish(r *JobResult) {
+	j.mu.Lock()
+	j.status, j.result = r.Status, r
+	j.mu.Unlock()
+	close(j.done)
+}
+
+// Webhook posts job results as JSON to a URL.
+type Webhook struct {
+	// URL receives a POST with the JobResult for each finished job.
+	URL string
+	// Header is added to each request, e.g. to authenticate with a shared
+	// secret.
+	Header http.Header
+	// HttpClient sends the requests. If nil, a client with a 30 second
+	// timeout is used.
+	HttpClient *http.Client
+	// Retry, if set, replaces DefaultRetryPolicy for deliveries.
+	Retry *RetryPolicy
+	// OnError, if set, is called when Notify fails to deliver a result.
+	OnError func(r *JobResult, err error)
+}
+
+// defaultWebhookClient is used by webhooks without their own HttpClient.
+var defaultWebhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// NewWebhook creates a webhook posting to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url}
+}
+
+// Notify posts r, reporting failure to OnError. Its signature matches
+// CompletionFunc, so it can be passed to SendAsync.
+func (w *Webhook) Notify(r *JobResult) {
+	if err := w.Post(context.Background(), r); err != nil && w.OnError != nil {
+		w.OnError(r, err)
+	}
+}
+
+// Post posts r to the webhook's URL. Responses other than 2xx are errors.
+func (w *Webhook) Post(ctx context.Context, r *JobResult) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("error marshaling job result: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	for key, values := range w.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.HttpClient
+	if client == nil {
+		client = defaultWebhookClient
+	}
+	policy := DefaultRetryPolicy
+	if w.Retry != nil {
+		policy = *w.Retry
+	}
+	resp, err := doWithRetries(client, req, policy, SystemClock)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook error (status %d)", resp.StatusCode)
+	}
+	return nil
+}
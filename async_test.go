@@ -0,0 +1,134 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+func TestSendAsync(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().On(`Hello`, FakeResponse{Text: "Hi!", PromptTokens: 5, CompletionTokens: 2})
+	fake.Install(conv)
+
+	results := make(chan *JobResult, 1)
+	job := conv.SendAsync("Hello", llmapi.Sampling{}, func(r *JobResult) { results <- r })
+	if job.ID == "" {
+		t.Error("Expected a job ID")
+	}
+	r, err := job.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Reply != "Hi!" || r.Status != JobDone || r.InputTokens != 5 || r.OutputTokens != 2 || r.JobID != job.ID {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+	if job.Status() != JobDone {
+		t.Errorf("Status() = %s, want done", job.Status())
+	}
+	if got := <-results; got != r {
+		t.Errorf("Expected the callback to receive the result")
+	}
+	if len(conv.Messages) != 2 {
+		t.Errorf("Expected the exchange in history, got %d messages", len(conv.Messages))
+	}
+}
+
+func TestSendAsyncCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	conv := NewConversation("")
+	conv.ApiToken = "test"
+	conv.SetEndpoint(server.URL)
+	conv.Retry = &RetryPolicy{}
+
+	job := conv.SendAsync("Hello", llmapi.Sampling{}, nil)
+	if _, ok := job.Result(); ok {
+		t.Error("Expected no result while running")
+	}
+	if conv.Ctx != nil {
+		t.Error("Expected the conversation's context unchanged while running")
+	}
+	job.Cancel()
+	r, err := job.Wait(context.Background())
+	if !errors.Is(err, context.Canceled) || r.Status != JobFailed || r.Error == "" {
+		t.Errorf("Expected a cancelled failure, got %+v, %v", r, err)
+	}
+	if conv.Ctx != nil {
+		t.Error("Expected the conversation's context unchanged")
+	}
+}
+
+func TestSendAsyncPending(t *testing.T) {
+	conv := NewConversation("")
+	conv.ApiToken = "test"
+	NewFakeBackend().On(".", FakeResponse{Text: "Hi."}).Install(conv)
+	conv.Queue = NewRequestQueue(1)
+	release, err := conv.Queue.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := conv.SendAsync("Hello", llmapi.Sampling{}, nil)
+	for conv.Queue.Pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if job.Status() != JobPending {
+		t.Errorf("Status() while queued = %s, want pending", job.Status())
+	}
+	release()
+	if r, err := job.Wait(context.Background()); err != nil || r.Status != JobDone {
+		t.Errorf("Expected the job done, got %+v, %v", r, err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan JobResult, 1)
+	var secret string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret = r.Header.Get("X-Secret")
+		var res JobResult
+		if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+			t.Error(err)
+		}
+		received <- res
+	}))
+	defer server.Close()
+
+	conv := NewConversation("")
+	NewFakeBackend().On(`.`, FakeResponse{Text: "Done."}).Install(conv)
+	hook := NewWebhook(server.URL)
+	hook.Header = http.Header{"X-Secret": {"s3cret"}}
+	job := conv.SendAsync("Go", llmapi.Sampling{}, hook.Notify)
+
+	select {
+	case res := <-received:
+		if res.JobID != job.ID || res.Reply != "Done." || res.Status != JobDone || secret != "s3cret" {
+			t.Errorf("Unexpected delivery: %+v, secret %q", res, secret)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook not called")
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var gotErr error
+	hook := &Webhook{URL: server.URL, OnError: func(r *JobResult, err error) { gotErr = err }}
+	hook.Notify(&JobResult{JobID: "x"})
+	if gotErr == nil {
+		t.Error("Expected OnError to be called for a failed delivery")
+	}
+}
@@ -0,0 +1,204 @@
+package novelai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KnownStyles are the values of "[ Style: … ]" tags the story models were
+// trained on. Append to it to accept custom styles in ValidateStyles.
+var KnownStyles = []string{
+	"chat", "text adventure", "prose", "poetry", "screenplay", "dialogue",
+}
+
+// NewATTG creates a header with title and author.
+func NewATTG(title, author string) ATTG {
+	return ATTG{Title: title, Author: author}
+}
+
+// AddTags appends tags not already present, ignoring case and blanks.
+func (a *ATTG) AddTags(tags ...string) {
+	a.Tags = addItems(a.Tags, tags)
+}
+
+// RemoveTags removes tags, ignoring case.
+func (a *ATTG) RemoveTags(tags ...string) {
+	a.Tags = removeItems(a.Tags, tags)
+}
+
+// AddGenres appends genres not already present, ignoring case and blanks.
+func (a *ATTG) AddGenres(genres ...string) {
+	a.Genre = addItems(a.Genre, genres)
+}
+
+// RemoveGenres removes genres, ignoring case.
+func (a *ATTG) RemoveGenres(genres ...string) {
+	a.Genre = removeItems(a.Genre, genres)
+}
+
+// Validate checks that the header survives formatting and parsing: no
+// field may contain brackets or semicolons, and no tag or genre a comma.
+func (a ATTG) Validate() error {
+	if err := validateHeaderField("author", a.Author); err != nil {
+		return err
+	}
+	if err := validateHeaderField("title", a.Title); err != nil {
+		return err
+	}
+	if err := validateHeaderList("tag", a.Tags); err != nil {
+		return err
+	}
+	return validateHeaderList("genre", a.Genre)
+}
+
+// validateHeaderField checks a single-value header field.
+func validateHeaderField(name, v string) error {
+	if strings.ContainsAny(v, "[];") {
+		return fmt.Errorf("invalid %s %q: must not contain brackets or semicolons", name, v)
+	}
+	return nil
+}
+
+// validateHeaderList checks the items of a list header field.
+func validateHeaderList(name string, items []string) error {
+	for _, v := range items {
+		if strings.TrimSpace(v) == "" || strings.ContainsAny(v, "[];,") {
+			return fmt.Errorf("invalid %s %q: must be non-empty without brackets, semicolons or commas", name, v)
+		}
+	}
+	return nil
+}
+
+// SetMemoryHeader returns memory with its ATTG header line replaced by a,
+// or with a prepended if memory has no header. An empty a removes the
+// header.
+func SetMemoryHeader(memory string, a ATTG) string {
+	lines := strings.Split(memory, "\n")
+	for i, line := range lines {
+		if _, ok := ParseATTG(line); ok {
+			return setHeaderLine(lines, i, a.String())
+		}
+	}
+	return prependLine(memory, a.String())
+}
+
+// MemoryHeader returns the ATTG header in memory, if any.
+func MemoryHeader(memory string) (ATTG, bool) {
+	for _, line := range strings.Split(memory, "\n") {
+		if a, ok := ParseATTG(line); ok {
+			return a, true
+		}
+	}
+	return ATTG{}, false
+}
+
+// FormatStyle formats a style tag: "[ Style: chat, poetry ]". Returns ""
+// if styles is empty.
+func FormatStyle(styles ...string) string {
+	if len(styles) == 0 {
+		return ""
+	}
+	return "[ Style: " + strings.Join(styles, ", ") + " ]"
+}
+
+// ParseStyle parses a style tag produced by FormatStyle. Returns false if
+// line is not a style tag.
+func ParseStyle(line string) ([]string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return nil, false
+	}
+	key, value, ok := strings.Cut(strings.Trim(line, "[] "), ":")
+	if !ok || strings.TrimSpace(key) != "Style" {
+		return nil, false
+	}
+	return splitList(value), true
+}
+
+// ValidateStyles checks that each style is one of KnownStyles.
+func ValidateStyles(styles ...string) error {
+	for _, s := range styles {
+		if !containsFold(KnownStyles, s) {
+			return fmt.Errorf("unknown style: %s", s)
+		}
+	}
+	return nil
+}
+
+// SetMemoryStyle returns memory with its style tag replaced by one for
+// styles, or with one added after the ATTG header (or at the top) if
+// memory has none. No styles removes the tag.
+func SetMemoryStyle(memory string, styles ...string) string {
+	tag := FormatStyle(styles...)
+	lines := strings.Split(memory, "\n")
+	for i, line := range lines {
+		if _, ok := ParseStyle(line); ok {
+			return setHeaderLine(lines, i, tag)
+		}
+	}
+	if tag == "" {
+		return memory
+	}
+	for i, line := range lines {
+		if _, ok := ParseATTG(line); ok {
+			lines = append(lines[:i+1], append([]string{tag}, lines[i+1:]...)...)
+			return strings.Join(lines, "\n")
+		}
+	}
+	return prependLine(memory, tag)
+}
+
+// setHeaderLine replaces lines[i] with line, removing it if line is empty.
+func setHeaderLine(lines []string, i int, line string) string {
+	if line == "" {
+		lines = append(lines[:i], lines[i+1:]...)
+	} else {
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// prependLine puts line on its own line before text.
+func prependLine(text, line string) string {
+	if line == "" {
+		return text
+	}
+	if text == "" {
+		return line
+	}
+	return line + "\n" + text
+}
+
+// addItems appends the non-blank items not already in list, ignoring case.
+func addItems(list, items []string) []string {
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item != "" && !containsFold(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// removeItems returns list without items, ignoring case.
+func removeItems(list, items []string) []string {
+	var kept []string
+	for _, v := range list {
+		if !containsFold(items, v) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// containsFold reports whether list contains s, ignoring case and
+// surrounding space.
+func containsFold(list []string, s string) bool {
+	s = strings.TrimSpace(s)
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
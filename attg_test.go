@@ -0,0 +1,87 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestATTGBuilder tests adding, removing and validating header fields.
+func TestATTGBuilder(t *testing.T) {
+	a := NewATTG("The Gull", "Jane Doe")
+	a.AddTags("sea", "Mystery", " ", "SEA")
+	a.AddGenres("Fantasy")
+	if len(a.Tags) != 2 || a.Tags[1] != "Mystery" {
+		t.Errorf("Expected deduplicated tags, got %v", a.Tags)
+	}
+	a.RemoveTags("mystery")
+	if got := a.String(); got != "[ Author: Jane Doe; Title: The Gull; Tags: sea; Genre: Fantasy ]" {
+		t.Errorf("Unexpected header: %q", got)
+	}
+	if err := a.Validate(); err != nil {
+		t.Errorf("Expected valid header, got %v", err)
+	}
+
+	for _, bad := range []ATTG{
+		{Title: "Part 1; Part 2"},
+		{Author: "[anon]"},
+		{Tags: []string{"sea, storms"}},
+		{Genre: []string{""}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", bad)
+		}
+	}
+}
+
+// TestStyleTags tests formatting, parsing and validating style tags.
+func TestStyleTags(t *testing.T) {
+	tag := FormatStyle("chat", "poetry")
+	if tag != "[ Style: chat, poetry ]" {
+		t.Errorf("Unexpected style tag: %q", tag)
+	}
+	styles, ok := ParseStyle(tag)
+	if !ok || len(styles) != 2 || styles[1] != "poetry" {
+		t.Errorf("Unexpected parse: %v (%v)", styles, ok)
+	}
+	if _, ok := ParseStyle("[ Title: x ]"); ok {
+		t.Error("Expected ATTG header not to parse as style")
+	}
+	if FormatStyle() != "" {
+		t.Error("Expected empty style tag")
+	}
+	if err := ValidateStyles("Text Adventure", "chat"); err != nil {
+		t.Errorf("Expected known styles, got %v", err)
+	}
+	if err := ValidateStyles("haiku"); err == nil || !strings.Contains(err.Error(), "haiku") {
+		t.Errorf("Expected unknown style error, got %v", err)
+	}
+}
+
+// TestMemoryHeaders tests updating headers in place in memory text.
+func TestMemoryHeaders(t *testing.T) {
+	memory := SetMemoryHeader("Mara is a sailor.", ATTG{Title: "The Gull"})
+	if memory != "[ Title: The Gull ]\nMara is a sailor." {
+		t.Errorf("Expected header prepended, got %q", memory)
+	}
+	memory = SetMemoryStyle(memory, "prose")
+	if memory != "[ Title: The Gull ]\n[ Style: prose ]\nMara is a sailor." {
+		t.Errorf("Expected style after header, got %q", memory)
+	}
+
+	memory = SetMemoryHeader(memory, ATTG{Title: "The Gull", Genre: []string{"Fantasy"}})
+	memory = SetMemoryStyle(memory, "chat")
+	if memory != "[ Title: The Gull; Genre: Fantasy ]\n[ Style: chat ]\nMara is a sailor." {
+		t.Errorf("Expected header and style replaced, got %q", memory)
+	}
+	if a, ok := MemoryHeader(memory); !ok || a.Genre[0] != "Fantasy" {
+		t.Errorf("Unexpected memory header: %+v (%v)", a, ok)
+	}
+
+	memory = SetMemoryStyle(SetMemoryHeader(memory, ATTG{}))
+	if memory != "Mara is a sailor." {
+		t.Errorf("Expected header and style removed, got %q", memory)
+	}
+	if got := SetMemoryStyle("", "chat"); got != "[ Style: chat ]" {
+		t.Errorf("Unexpected style on empty memory: %q", got)
+	}
+}
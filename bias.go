@@ -0,0 +1,179 @@
+package novelai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tokenizer converts text to token IDs for a specific model.
+// Token IDs differ between models, so biases must be compiled with the
+// tokenizer of the model they will be sent to.
+type Tokenizer interface {
+	Encode(text string) ([]int, error)
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface.
+type TokenizerFunc func(text string) ([]int, error)
+
+// Encode calls f(text).
+func (f TokenizerFunc) Encode(text string) ([]int, error) {
+	return f(text)
+}
+
+// LogitBiasExp is a compiled phrase bias in the native API's logit_bias_exp
+// format. Sequence is the phrase's token IDs.
+type LogitBiasExp struct {
+	Sequence             []int   `json:"sequence"`
+	Bias                 float64 `json:"bias"`
+	EnsureSequenceFinish bool    `json:"ensure_sequence_finish"`
+	GenerateOnce         bool    `json:"generate_once"`
+}
+
+// CompileBiasGroups converts bias group phrases into token sequences using
+// tok. Disabled groups and groups with zero bias are skipped.
+//
+// Phrases follow NovelAI's syntax:
+//   - [1, 2, 3] is a literal list of token IDs
+//   - {text} is encoded exactly as written, without the braces
+//   - any other text is encoded as written and, unless it already starts
+//     with whitespace, also with a leading space so mid-sentence uses match
+func CompileBiasGroups(groups []BiasGroup, tok Tokenizer) ([]LogitBiasExp, error) {
+	var biases []LogitBiasExp
+	for _, group := range groups {
+		if !group.Enabled || group.Bias == 0 {
+			continue
+		}
+		for _, phrase := range group.Phrases {
+			sequences, err := phraseSequences(phrase, tok)
+			if err != nil {
+				return nil, err
+			}
+			for _, seq := range sequences {
+				biases = append(biases, LogitBiasExp{
+					Sequence:             seq,
+					Bias:                 group.Bias,
+					EnsureSequenceFinish: group.EnsureSequenceFinish,
+					GenerateOnce:         group.GenerateOnce,
+				})
+			}
+		}
+	}
+	return biases, nil
+}
+
+// CompileBannedSequences converts banned sequence group phrases into token
+// sequences for the native API's bad_words_ids. Disabled groups are skipped.
+// Phrases use the same syntax as CompileBiasGroups.
+func CompileBannedSequences(groups []BiasGroup, tok Tokenizer) ([][]int, error) {
+	var banned [][]int
+	for _, group := range groups {
+		if !group.Enabled {
+			continue
+		}
+		for _, phrase := range group.Phrases {
+			sequences, err := phraseSequences(phrase, tok)
+			if err != nil {
+				return nil, err
+			}
+			banned = append(banned, sequences...)
+		}
+	}
+	return banned, nil
+}
+
+// LogitBias flattens compiled biases into the per-token logit_bias map
+// accepted by the OpenAI-compatible endpoint. This is best effort: the map
+// can only bias individual tokens, so multi-token sequences bias their first
+// token only, and EnsureSequenceFinish and GenerateOnce are not applied.
+// Biases on the same token are summed.
+func LogitBias(biases []LogitBiasExp) map[int]float64 {
+	if len(biases) == 0 {
+		return nil
+	}
+	result := make(map[int]float64)
+	for _, b := range biases {
+		if len(b.Sequence) > 0 {
+			result[b.Sequence[0]] += b.Bias
+		}
+	}
+	return result
+}
+
+// ActiveBiasGroups returns the scenario's bias groups that apply to story:
+// the scenario's phrase bias groups, plus the lore bias groups of lorebook
+// entries that story activates. Groups marked WhenInactive apply only when
+// their entry is not active.
+func (s *Scenario) ActiveBiasGroups(story string) []BiasGroup {
+	groups := append([]BiasGroup(nil), s.PhraseBiasGroups...)
+	for _, act := range s.Lorebook.Activate(story) {
+		for _, group := range s.Lorebook.Entries[act.EntryIndex].LoreBiasGroups {
+			if group.WhenInactive != act.Active {
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups
+}
+
+// phraseSequences encodes one bias phrase into the token sequences it stands for.
+func phraseSequences(phrase string, tok Tokenizer) ([][]int, error) {
+	if phrase == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(phrase, "[") && strings.HasSuffix(phrase, "]") {
+		ids, err := parseTokenIDs(phrase[1 : len(phrase)-1])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing bias phrase %q: %w", phrase, err)
+		}
+		return [][]int{ids}, nil
+	}
+
+	variants := []string{phrase}
+	if strings.HasPrefix(phrase, "{") && strings.HasSuffix(phrase, "}") {
+		variants = []string{phrase[1 : len(phrase)-1]}
+	} else if !strings.ContainsAny(phrase[:1], " \t\n") {
+		variants = append(variants, " "+phrase)
+	}
+
+	if tok == nil {
+		return nil, fmt.Errorf("error encoding bias phrase %q: no tokenizer", phrase)
+	}
+	var sequences [][]int
+	for _, text := range variants {
+		if text == "" {
+			continue
+		}
+		ids, err := tok.Encode(text)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding bias phrase %q: %w", phrase, err)
+		}
+		if len(ids) > 0 {
+			sequences = append(sequences, ids)
+		}
+	}
+	return sequences, nil
+}
+
+// parseTokenIDs parses a comma-separated list of token IDs.
+func parseTokenIDs(s string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		if id < 0 {
+			return nil, fmt.Errorf("negative token ID %d", id)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no token IDs")
+	}
+	return ids, nil
+}
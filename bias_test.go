@@ -0,0 +1,147 @@
+package novelai
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// byteTokenizer encodes each byte as its own token ID, for tests.
+var byteTokenizer = TokenizerFunc(func(text string) ([]int, error) {
+	ids := make([]int, len(text))
+	for i := 0; i < len(text); i++ {
+		ids[i] = int(text[i])
+	}
+	return ids, nil
+})
+
+// TestCompileBiasGroups tests phrase syntax and group flags.
+func TestCompileBiasGroups(t *testing.T) {
+	groups := []BiasGroup{
+		{Phrases: []string{"ab", "{cd}", "[5, 6]", " e"}, Bias: -1.5, Enabled: true, EnsureSequenceFinish: true},
+		{Phrases: []string{"skipped"}, Bias: 2, Enabled: false},
+		{Phrases: []string{"zero"}, Bias: 0, Enabled: true},
+		{Phrases: []string{"x"}, Bias: 0.5, Enabled: true, GenerateOnce: true},
+	}
+
+	biases, err := CompileBiasGroups(groups, byteTokenizer)
+	if err != nil {
+		t.Fatalf("CompileBiasGroups failed: %v", err)
+	}
+
+	var sequences [][]int
+	for _, b := range biases {
+		sequences = append(sequences, b.Sequence)
+	}
+	expected := [][]int{
+		{'a', 'b'},      // plain phrase
+		{' ', 'a', 'b'}, // and its leading-space variant
+		{'c', 'd'},      // exact phrase
+		{5, 6},          // token IDs
+		{' ', 'e'},      // already starts with a space
+		{'x'},
+		{' ', 'x'},
+	}
+	if !reflect.DeepEqual(sequences, expected) {
+		t.Errorf("Expected sequences %v, got %v", expected, sequences)
+	}
+	if !biases[0].EnsureSequenceFinish || biases[0].GenerateOnce || biases[0].Bias != -1.5 {
+		t.Errorf("Expected first group's flags on %+v", biases[0])
+	}
+	if last := biases[len(biases)-1]; !last.GenerateOnce || last.Bias != 0.5 {
+		t.Errorf("Expected last group's flags on %+v", last)
+	}
+}
+
+// TestCompileBiasGroupsErrors tests invalid token lists and tokenizer failures.
+func TestCompileBiasGroupsErrors(t *testing.T) {
+	bad := []BiasGroup{{Phrases: []string{"[1, x]"}, Bias: 1, Enabled: true}}
+	if _, err := CompileBiasGroups(bad, byteTokenizer); err == nil {
+		t.Error("Expected error for invalid token ID list")
+	}
+
+	text := []BiasGroup{{Phrases: []string{"word"}, Bias: 1, Enabled: true}}
+	if _, err := CompileBiasGroups(text, nil); err == nil {
+		t.Error("Expected error for text phrase without tokenizer")
+	}
+	failing := TokenizerFunc(func(string) ([]int, error) { return nil, errors.New("boom") })
+	if _, err := CompileBiasGroups(text, failing); err == nil {
+		t.Error("Expected tokenizer error to be returned")
+	}
+
+	ids := []BiasGroup{{Phrases: []string{"[7]"}, Bias: 1, Enabled: true}}
+	if biases, err := CompileBiasGroups(ids, nil); err != nil || len(biases) != 1 {
+		t.Errorf("Expected token ID phrase to compile without tokenizer, got %v, %v", biases, err)
+	}
+}
+
+// TestCompileBannedSequences tests conversion to bad_words_ids.
+func TestCompileBannedSequences(t *testing.T) {
+	groups := []BiasGroup{
+		{Phrases: []string{"{no}", "[9]"}, Enabled: true},
+		{Phrases: []string{"off"}, Enabled: false},
+	}
+	banned, err := CompileBannedSequences(groups, byteTokenizer)
+	if err != nil {
+		t.Fatalf("CompileBannedSequences failed: %v", err)
+	}
+	expected := [][]int{{'n', 'o'}, {9}}
+	if !reflect.DeepEqual(banned, expected) {
+		t.Errorf("Expected %v, got %v", expected, banned)
+	}
+}
+
+// TestLogitBias tests flattening into the OA logit_bias map.
+func TestLogitBias(t *testing.T) {
+	bias := LogitBias([]LogitBiasExp{
+		{Sequence: []int{1, 2, 3}, Bias: -1},
+		{Sequence: []int{1}, Bias: 0.25},
+		{Sequence: []int{4}, Bias: 2},
+		{Sequence: nil, Bias: 5},
+	})
+	expected := map[int]float64{1: -0.75, 4: 2}
+	if !reflect.DeepEqual(bias, expected) {
+		t.Errorf("Expected %v, got %v", expected, bias)
+	}
+	if LogitBias(nil) != nil {
+		t.Error("Expected nil map for no biases")
+	}
+
+	data, err := json.Marshal(completionRequest{LogitBias: map[int]float64{42: -100}})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	var decoded map[string]any
+	json.Unmarshal(data, &decoded)
+	if lb, ok := decoded["logit_bias"].(map[string]any); !ok || lb["42"] != -100.0 {
+		t.Errorf("Expected logit_bias {\"42\": -100}, got %s", data)
+	}
+}
+
+// TestActiveBiasGroups tests lore bias selection by entry activation.
+func TestActiveBiasGroups(t *testing.T) {
+	s := NewScenario("Bias")
+	s.PhraseBiasGroups = []BiasGroup{{Phrases: []string{"global"}, Bias: 1, Enabled: true}}
+	s.Lorebook.Entries = []LorebookEntry{
+		{Keys: []string{"dragon"}, Enabled: true, LoreBiasGroups: []BiasGroup{
+			{Phrases: []string{"fire"}, Bias: 1, Enabled: true},
+			{Phrases: []string{"calm"}, Bias: 1, Enabled: true, WhenInactive: true},
+		}},
+	}
+
+	phrases := func(groups []BiasGroup) []string {
+		var out []string
+		for _, g := range groups {
+			out = append(out, g.Phrases...)
+		}
+		return out
+	}
+
+	if got := phrases(s.ActiveBiasGroups("A dragon appears.")); !reflect.DeepEqual(got, []string{"global", "fire"}) {
+		t.Errorf("Expected [global fire] when active, got %v", got)
+	}
+	if got := phrases(s.ActiveBiasGroups("A quiet field.")); !reflect.DeepEqual(got, []string{"global", "calm"}) {
+		t.Errorf("Expected [global calm] when inactive, got %v", got)
+	}
+}
@@ -0,0 +1,82 @@
+package novelai
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultMaxBodyBytes limits the size of a response body or streamed
+// reply when MaxBodyBytes is unset, so a runaway generation cannot grow
+// memory without bound.
+const DefaultMaxBodyBytes = 64 << 20
+
+// sseBufferSize is the initial line buffer of the SSE scanner.
+const sseBufferSize = 64 << 10
+
+var (
+	bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	linePool   = sync.Pool{New: func() any { b := make([]byte, sseBufferSize); return &b }}
+)
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+// putBuffer returns b to the pool. Buffers grown past the default limit are
+// dropped rather than pinned in memory.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() <= DefaultMaxBodyBytes {
+		bufferPool.Put(b)
+	}
+}
+
+// readBody reads all of r into a pooled buffer and returns a copy of it,
+// failing if it is longer than limit bytes.
+func readBody(r io.Reader, limit int64) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	n, err := buf.ReadFrom(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// newSSEScanner returns a scanner over body using a pooled line buffer,
+// accepting lines up to limit bytes, and a func that returns the buffer.
+func newSSEScanner(body io.Reader, limit int64) (*bufio.Scanner, func()) {
+	buf := linePool.Get().(*[]byte)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(*buf, int(min(limit, int64(maxInt))))
+	return scanner, func() { linePool.Put(buf) }
+}
+
+// maxInt is the largest int.
+const maxInt = int(^uint(0) >> 1)
+
+// maxBodyBytes returns MaxBodyBytes, or DefaultMaxBodyBytes if
+// unset.
+func (c *Conversation) maxBodyBytes() int64 {
+	if c.MaxBodyBytes > 0 {
+		return c.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// maxBodyBytes returns MaxBodyBytes, or DefaultMaxBodyBytes if
+// unset.
+func (c *Client) maxBodyBytes() int64 {
+	if c.MaxBodyBytes > 0 {
+		return c.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
@@ -0,0 +1,65 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// TestReadBody tests the response size limit.
+func TestReadBody(t *testing.T) {
+	body, err := readBody(strings.NewReader("hello"), 5)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("Expected body within limit, got %q (%v)", body, err)
+	}
+	if _, err := readBody(strings.NewReader("hello!"), 5); err == nil {
+		t.Error("Expected error for body over limit")
+	}
+}
+
+// TestParseSSEStreamLimit tests that a runaway stream is cut off.
+func TestParseSSEStreamLimit(t *testing.T) {
+	var stream strings.Builder
+	for i := 0; i < 10; i++ {
+		stream.WriteString("data: {\"choices\":[{\"text\":\"abcd\"}]}\n\n")
+	}
+	stream.WriteString("data: [DONE]\n\n")
+
+	conv := NewConversation("")
+	conv.MaxBodyBytes = 10
+	reply, _, _, _, err := conv.parseSSEStream(strings.NewReader(stream.String()), &conv.Settings, nil)
+	if err == nil || !strings.Contains(err.Error(), "exceeds 10 bytes") {
+		t.Errorf("Expected size error, got %v", err)
+	}
+	if reply != "abcdabcd" {
+		t.Errorf("Expected partial reply, got %q", reply)
+	}
+
+	conv.MaxBodyBytes = 0
+	reply, _, _, _, err = conv.parseSSEStream(strings.NewReader(stream.String()), &conv.Settings, nil)
+	if err != nil || len(reply) != 40 {
+		t.Errorf("Expected full reply under default limit, got %d bytes (%v)", len(reply), err)
+	}
+}
+
+// TestMaxBodyBytes tests the limit on conversation and client responses.
+func TestMaxBodyBytes(t *testing.T) {
+	conv, _ := newProfileServer(t)
+	conv.MaxBodyBytes = 8
+	if _, _, _, _, _, _, err := conv.Send("Hi", llmapi.Sampling{}); err == nil ||
+		!strings.Contains(err.Error(), "exceeds 8 bytes") {
+		t.Errorf("Expected size error, got %v", err)
+	}
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"output":"a long generated story"}`)
+	})
+	client.MaxBodyBytes = 16
+	if _, err := client.Generate(context.Background(), &GenerateRequest{Input: "Hi"}); err == nil {
+		t.Error("Expected size error from client")
+	}
+}
@@ -0,0 +1,134 @@
+package novelai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChatML turn markers.
+const (
+	chatMLStart = "<|im_start|>"
+	chatMLEnd   = "<|im_end|>"
+)
+
+// ChatMLOptions controls ToChatML and ParseChatML.
+type ChatMLOptions struct {
+	// StripThinking drops the <think> blocks of assistant messages,
+	// keeping only the visible answer.
+	StripThinking bool
+}
+
+// ToChatML renders the conversation's system prompt and messages as
+// ChatML, for moving conversations to other GLM-serving stacks:
+//
+//	<|im_start|>system
+//	<system prompt><|im_end|>
+//	<|im_start|>user
+//	<message><|im_end|>
+//	<|im_start|>assistant
+//	<think>reasoning</think>
+//	<answer><|im_end|>
+//
+// The thinking of an assistant message is written as one complete think
+// block before the answer, adding the opening tag if the reply left it
+// implied. Everything else is written verbatim, so ParseChatML reads back
+// the same history. Tags are not kept. Returns an error if a message
+// contains a ChatML marker, which would corrupt the format.
+func (c *Conversation) ToChatML(opts ChatMLOptions) (string, error) {
+	var b strings.Builder
+	write := func(role, content string) error {
+		if strings.Contains(content, chatMLStart) || strings.Contains(content, chatMLEnd) {
+			return fmt.Errorf("error exporting %s message: content contains a ChatML marker", role)
+		}
+		fmt.Fprintf(&b, "%s%s\n%s%s\n", chatMLStart, role, content, chatMLEnd)
+		return nil
+	}
+	if c.System != "" {
+		if err := write("system", c.System); err != nil {
+			return "", err
+		}
+	}
+	for _, m := range c.Messages {
+		content := m.Content
+		if m.Role == "assistant" {
+			content = chatMLThinking(content, opts)
+		}
+		if err := write(m.Role, content); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// ParseChatML reads a conversation written by ToChatML or another ChatML
+// source. A leading system message becomes the system prompt. A final
+// empty assistant turn, left open as a generation prompt, is ignored.
+func ParseChatML(text string, opts ChatMLOptions) (system string, messages []Message, err error) {
+	rest := text
+	for first := true; ; first = false {
+		start := strings.Index(rest, chatMLStart)
+		if start < 0 {
+			break
+		}
+		if s := strings.TrimSpace(rest[:start]); s != "" {
+			return "", nil, fmt.Errorf("error parsing ChatML: text outside a message: %q", s)
+		}
+		rest = rest[start+len(chatMLStart):]
+		role, body, _ := strings.Cut(rest, "\n")
+		role = strings.TrimSpace(role)
+		end := strings.Index(body, chatMLEnd)
+		if end < 0 {
+			if role == "assistant" && strings.TrimSpace(body) == "" {
+				rest = ""
+				break
+			}
+			return "", nil, fmt.Errorf("error parsing ChatML: unterminated %s message", role)
+		}
+		content := body[:end]
+		rest = body[end+len(chatMLEnd):]
+		switch role {
+		case "system", "user":
+		case "assistant":
+			content = chatMLThinking(content, opts)
+		default:
+			return "", nil, fmt.Errorf("error parsing ChatML: unknown role %q", role)
+		}
+		if role == "system" && first {
+			system = content
+			continue
+		}
+		messages = append(messages, Message{Role: role, Content: content})
+	}
+	if s := strings.TrimSpace(rest); s != "" {
+		return "", nil, fmt.Errorf("error parsing ChatML: text outside a message: %q", s)
+	}
+	return system, messages, nil
+}
+
+// ImportChatML replaces the conversation's system prompt and messages with
+// those read from ChatML by ParseChatML.
+func (c *Conversation) ImportChatML(text string, opts ChatMLOptions) error {
+	system, messages, err := ParseChatML(text, opts)
+	if err != nil {
+		return err
+	}
+	c.System, c.Messages = system, messages
+	c.dropMessageMeta(0)
+	return nil
+}
+
+// chatMLThinking returns an assistant message with its thinking as one
+// complete block at the start, or without it if opts strips thinking.
+func chatMLThinking(content string, opts ChatMLOptions) string {
+	thinking, visible := splitThinking(content)
+	if thinking == "" {
+		return content
+	}
+	if opts.StripThinking {
+		return strings.TrimSpace(visible)
+	}
+	if !strings.HasPrefix(thinking, thinkOpen) {
+		thinking = thinkOpen + thinking
+	}
+	return thinking + visible
+}
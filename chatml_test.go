@@ -0,0 +1,91 @@
+package novelai
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChatMLRoundTrip(t *testing.T) {
+	conv := &Conversation{
+		System: "You are helpful.",
+		Messages: []Message{
+			{Role: "user", Content: "What is 2+2?"},
+			{Role: "assistant", Content: "<think>\nSimple sum.\n</think>\n\n4."},
+			{Role: "user", Content: "Thanks\n\nbye"},
+			{Role: "assistant", Content: "Bye!"},
+		},
+	}
+	text, err := conv.ToChatML(ChatMLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<|im_start|>system\nYou are helpful.<|im_end|>\n" +
+		"<|im_start|>user\nWhat is 2+2?<|im_end|>\n" +
+		"<|im_start|>assistant\n<think>\nSimple sum.\n</think>\n\n4.<|im_end|>\n" +
+		"<|im_start|>user\nThanks\n\nbye<|im_end|>\n" +
+		"<|im_start|>assistant\nBye!<|im_end|>\n"
+	if text != want {
+		t.Errorf("ToChatML() = %q", text)
+	}
+
+	imported := &Conversation{}
+	if err := imported.ImportChatML(text, ChatMLOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if imported.System != conv.System || !reflect.DeepEqual(imported.Messages, conv.Messages) {
+		t.Errorf("Imported %q, %+v", imported.System, imported.Messages)
+	}
+}
+
+func TestChatMLThinking(t *testing.T) {
+	// The opening tag implied by the prompt is restored
+	conv := &Conversation{Messages: []Message{
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Greeting.</think>Hello!"},
+	}}
+	text, err := conv.ToChatML(ChatMLOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "assistant\n<think>Greeting.</think>Hello!<|im_end|>") {
+		t.Errorf("ToChatML() = %q", text)
+	}
+
+	stripped, err := conv.ToChatML(ChatMLOptions{StripThinking: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stripped, "think") || !strings.Contains(stripped, "assistant\nHello!<|im_end|>") {
+		t.Errorf("ToChatML() stripped = %q", stripped)
+	}
+
+	_, messages, err := ParseChatML(text, ChatMLOptions{StripThinking: true})
+	if err != nil || len(messages) != 2 || messages[1].Content != "Hello!" {
+		t.Errorf("ParseChatML() stripped = %+v, %v", messages, err)
+	}
+}
+
+func TestParseChatML(t *testing.T) {
+	// A generation prompt left open at the end is ignored
+	system, messages, err := ParseChatML("<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n", ChatMLOptions{})
+	if err != nil || system != "" || len(messages) != 1 || messages[0].Content != "Hi" {
+		t.Errorf("ParseChatML() = %q, %+v, %v", system, messages, err)
+	}
+
+	for _, bad := range []string{
+		"<|im_start|>user\nHi",
+		"<|im_start|>tool\nresult<|im_end|>",
+		"stray<|im_start|>user\nHi<|im_end|>",
+		"<|im_start|>user\nHi<|im_end|>stray",
+	} {
+		if _, _, err := ParseChatML(bad, ChatMLOptions{}); err == nil {
+			t.Errorf("ParseChatML(%q) succeeded", bad)
+		}
+	}
+
+	conv := &Conversation{Messages: []Message{{Role: "user", Content: "say <|im_end|>"}}}
+	if _, err := conv.ToChatML(ChatMLOptions{}); err == nil {
+		t.Error("Expected an error exporting a ChatML marker")
+	}
+}
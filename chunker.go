@@ -0,0 +1,167 @@
+package novelai
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// ChunkMode sets where streamed text may be split between callbacks.
+type ChunkMode int
+
+const (
+	// ChunkCharacters never splits a character. Incomplete UTF-8 sequences
+	// are held back, as is a final non-ASCII character until the next chunk
+	// shows whether combining marks, emoji modifiers or joiners continue
+	// it. Text ending in ASCII is passed on at once, so a combining mark
+	// streamed after an ASCII letter is not joined to it; models emit
+	// precomposed characters instead.
+	ChunkCharacters ChunkMode = iota
+	// ChunkWords passes on whole words with their trailing whitespace, for
+	// consumers such as TTS engines that need complete words.
+	ChunkWords
+	// ChunkRaw passes chunks on as they are received.
+	ChunkRaw
+)
+
+// zeroWidthJoiner joins emoji into one character, as in family emoji.
+const zeroWidthJoiner = '\u200d'
+
+// StreamChunker regroups streamed text so that callbacks only see whole
+// characters, or whole words, however the server splits its chunks.
+type StreamChunker struct {
+	// Mode sets where text may be split.
+	Mode ChunkMode
+
+	emit    StreamCallback
+	pending string
+}
+
+// NewStreamChunker creates a chunker passing regrouped text to emit.
+func NewStreamChunker(mode ChunkMode, emit StreamCallback) *StreamChunker {
+	return &StreamChunker{Mode: mode, emit: emit}
+}
+
+// Callback returns a StreamCallback that feeds the chunker and flushes it
+// when the stream is done, passing done on. Use it as the callback of
+// SendStreaming.
+func (ch *StreamChunker) Callback() StreamCallback {
+	return func(text string, done bool) {
+		ch.Write(text)
+		if done {
+			ch.Flush()
+			ch.emit("", true)
+		}
+	}
+}
+
+// Write adds streamed text, passing on what can be split off.
+func (ch *StreamChunker) Write(text string) {
+	ch.pending += text
+	var n int
+	switch ch.Mode {
+	case ChunkRaw:
+		n = len(ch.pending)
+	case ChunkWords:
+		n = lastWordEnd(ch.pending)
+	default:
+		n = characterEnd(ch.pending)
+	}
+	if n > 0 {
+		out := ch.pending[:n]
+		ch.pending = ch.pending[n:]
+		ch.emit(out, false)
+	}
+}
+
+// Flush passes on any held-back text.
+func (ch *StreamChunker) Flush() {
+	if ch.pending != "" {
+		out := ch.pending
+		ch.pending = ""
+		ch.emit(out, false)
+	}
+}
+
+// characterEnd returns the length of the longest prefix of text that can
+// be passed on without splitting a character, as ChunkCharacters describes.
+func characterEnd(text string) int {
+	end := len(text)
+	// Hold back an incomplete UTF-8 sequence
+	for i := end - 1; i >= 0 && i >= end-utf8.UTFMax; i-- {
+		if utf8.RuneStart(text[i]) {
+			if !utf8.FullRuneInString(text[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	if last, _ := utf8.DecodeLastRuneInString(text[:end]); end == 0 || last < utf8.RuneSelf {
+		return end
+	}
+	// Hold back the last character: walk back over extenders to its base,
+	// and on through joiners to the bases they join
+	i := end
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:i])
+		i -= size
+		if extendsCharacter(r) {
+			continue
+		}
+		if prev, _ := utf8.DecodeLastRuneInString(text[:i]); i > 0 && prev == zeroWidthJoiner {
+			continue
+		}
+		if isRegionalIndicator(r) && regionalIndicatorRun(text[:i+size])%2 == 0 {
+			// The second of a flag's pair of regional indicators
+			_, size = utf8.DecodeLastRuneInString(text[:i])
+			i -= size
+		}
+		break
+	}
+	return i
+}
+
+// extendsCharacter reports whether r continues the character before it.
+func extendsCharacter(r rune) bool {
+	switch {
+	case r == zeroWidthJoiner,
+		r >= 0xfe00 && r <= 0xfe0f,   // variation selectors
+		r >= 0x1f3fb && r <= 0x1f3ff, // emoji skin tone modifiers
+		r >= 0xe0020 && r <= 0xe007f: // emoji tag sequences
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// isRegionalIndicator reports whether r is one of the letters that pair
+// into flag emoji.
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// regionalIndicatorRun returns the number of regional indicators at the
+// end of text.
+func regionalIndicatorRun(text string) int {
+	n := 0
+	for text != "" {
+		r, size := utf8.DecodeLastRuneInString(text)
+		if !isRegionalIndicator(r) {
+			break
+		}
+		text = text[:len(text)-size]
+		n++
+	}
+	return n
+}
+
+// lastWordEnd returns the length of text up to the end of its last
+// whitespace, or 0 if it has none.
+func lastWordEnd(text string) int {
+	for i := len(text); i > 0; {
+		r, size := utf8.DecodeLastRuneInString(text[:i])
+		if unicode.IsSpace(r) {
+			return i
+		}
+		i -= size
+	}
+	return 0
+}
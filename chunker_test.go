@@ -0,0 +1,110 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// feed writes chunks to a chunker in mode, returning what it passed on.
+func feed(mode ChunkMode, chunks ...string) []string {
+	var got []string
+	ch := NewStreamChunker(mode, func(text string, done bool) {
+		if text != "" {
+			got = append(got, text)
+		}
+	})
+	for _, c := range chunks {
+		ch.Write(c)
+	}
+	ch.Flush()
+	return got
+}
+
+func TestStreamChunkerCharacters(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{"ascii", []string{"Hello", " world"}, []string{"Hello", " world"}},
+		{"split rune", []string{"caf\xc3", "\xa9 au lait"}, []string{"caf", "é au lait"}},
+		{"combining mark", []string{"café", "\u0301!"}, []string{"caf", "é\u0301!"}},
+		{"skin tone", []string{"Hi 👋", "🏽 there"}, []string{"Hi ", "👋🏽 there"}},
+		{"zwj family", []string{"👩\u200d", "👧 ok"}, []string{"👩\u200d👧 ok"}},
+		{"flag", []string{"Go 🇫", "🇷 now"}, []string{"Go ", "🇫🇷 now"}},
+		{"second flag", []string{"🇫🇷🇩", "🇪."}, []string{"🇫🇷", "🇩🇪."}},
+		{"held to the end", []string{"naïve ñ"}, []string{"naïve ", "ñ"}},
+	}
+	for _, tt := range tests {
+		got := feed(ChunkCharacters, tt.chunks...)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStreamChunkerWords(t *testing.T) {
+	got := feed(ChunkWords, "Hel", "lo wo", "rld, how", " are", " you")
+	want := []string{"Hello ", "world, ", "how ", "are ", "you"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestStreamChunkerRaw(t *testing.T) {
+	got := feed(ChunkRaw, "caf\xc3", "\xa9")
+	if len(got) != 2 || got[0] != "caf\xc3" {
+		t.Errorf("Expected chunks as received, got %q", got)
+	}
+}
+
+func TestStreamChunkerCallback(t *testing.T) {
+	var texts []string
+	var dones int
+	cb := NewStreamChunker(ChunkWords, func(text string, done bool) {
+		texts = append(texts, text)
+		if done {
+			dones++
+		}
+	}).Callback()
+	cb("one tw", false)
+	cb("o", true)
+	if strings.Join(texts, "|") != "one |two|" || dones != 1 {
+		t.Errorf("Got %q with %d done", texts, dones)
+	}
+}
+
+func TestStreamingChunking(t *testing.T) {
+	conv := NewConversation("")
+	NewFakeBackend().On(`.`, FakeResponse{
+		Text:   "Viê\u0323t 👋🏽 friend",
+		Chunks: []string{"Viê", "\u0323t 👋", "🏽 fri", "end"},
+	}).Install(conv)
+
+	var chunks []string
+	reply, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, func(text string, done bool) {
+		if text != "" {
+			chunks = append(chunks, text)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Vi", "ê\u0323t ", "👋🏽 fri", "end"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") || reply != "Viê\u0323t 👋🏽 friend" {
+		t.Errorf("Got %q, reply %q", chunks, reply)
+	}
+
+	conv.Settings.StreamChunking = ChunkWords
+	chunks = nil
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Again", SamplingProfile{}, func(text string, done bool) {
+		if text != "" {
+			chunks = append(chunks, text)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(chunks, "|") != "Viê\u0323t |👋🏽 |friend" {
+		t.Errorf("Unexpected word chunks: %q", chunks)
+	}
+}
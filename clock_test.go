@@ -0,0 +1,108 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	if err := clock.Sleep(context.Background(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	if got := clock.Now(); !got.Equal(start.Add(time.Hour + time.Minute)) {
+		t.Errorf("Now() = %v", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := clock.Sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep with cancelled context = %v", err)
+	}
+	if sleeps := clock.Sleeps(); len(sleeps) != 1 || sleeps[0] != time.Hour {
+		t.Errorf("Sleeps() = %v", sleeps)
+	}
+}
+
+// TestRetryUsesClock tests that retries wait on the conversation's clock
+// rather than sleeping.
+func TestRetryUsesClock(t *testing.T) {
+	conv := NewConversation("")
+	conv.Retry = &RetryPolicy{MaxRetries: 3, Delay: time.Minute}
+	clock := NewFakeClock(time.Now())
+	conv.Clock = clock
+	fake := NewFakeBackend().On(`Hello`, FakeResponse{Text: "Hi."})
+	fake.Install(conv)
+	conv.HttpClient.Transport = &flakyTransport{failures: 2, next: fake}
+
+	start := time.Now()
+	reply, _, _, _, _, _, err := conv.Send("Hello", llmapi.Sampling{})
+	if err != nil || reply != "Hi." {
+		t.Fatalf("Expected reply after retries, got %q, %v", reply, err)
+	}
+	if sleeps := clock.Sleeps(); len(sleeps) != 2 || sleeps[0] != time.Minute || sleeps[1] != time.Minute {
+		t.Errorf("Sleeps() = %v", sleeps)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Retries slept in real time")
+	}
+}
+
+func TestSessionManagerRateLimitClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	m := &SessionManager{RateBurst: 1, RateInterval: time.Hour, Clock: clock}
+	ctx := context.Background()
+	noop := func(*Conversation) error { return nil }
+
+	if err := m.Do(ctx, "a", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Do(ctx, "a", noop); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := m.Do(ctx, "a", noop); err != nil {
+		t.Errorf("Expected the allowance refilled after an hour, got %v", err)
+	}
+}
+
+func TestRequestQueueAgingClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	q := &RequestQueue{MaxConcurrent: 1, AgingInterval: time.Minute, Clock: clock}
+	hold, err := q.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	granted := make(chan string, 2)
+	acquire := func(name string, p Priority) {
+		go func() {
+			release, err := q.Acquire(context.Background(), p)
+			if err != nil {
+				t.Errorf("Acquire(%s): %v", name, err)
+				return
+			}
+			granted <- name
+			release()
+		}()
+	}
+	acquire("background", PriorityBackground)
+	waitForPending(t, q, 1)
+	// Waiting three intervals lifts the background request above a new
+	// interactive one
+	clock.Advance(3 * time.Minute)
+	acquire("interactive", PriorityInteractive)
+	waitForPending(t, q, 2)
+
+	hold()
+	if first := <-granted; first != "background" {
+		t.Errorf("Expected the aged background request first, got %s", first)
+	}
+	<-granted
+}
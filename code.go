@@ -0,0 +1,159 @@
+package novelai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// ErrNoCodeBlock is returned by SendCode when the reply has no code block.
+var ErrNoCodeBlock = errors.New("reply has no code block")
+
+// CodeBlock is a fenced code block from a reply.
+type CodeBlock struct {
+	// Language is the fence's info string, such as "go", or empty.
+	Language string
+	// Code is the block's content, without the fences.
+	Code string
+	// Complete reports whether the block was closed. A reply cut off by
+	// its token limit may end inside a block.
+	Complete bool
+}
+
+// ExtractCodeBlocks returns the fenced code blocks of a reply, in order.
+// Blocks in its think block are skipped.
+func ExtractCodeBlocks(reply string) []CodeBlock {
+	_, reply = splitThinking(reply)
+	var blocks []CodeBlock
+	var fence string
+	var code strings.Builder
+	for _, line := range strings.SplitAfter(reply, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if fence == "" {
+			if f, language, ok := opensFence(trimmed); ok {
+				fence = f
+				blocks = append(blocks, CodeBlock{Language: language})
+				code.Reset()
+			}
+			continue
+		}
+		if closesFence(trimmed, fence) {
+			block := &blocks[len(blocks)-1]
+			block.Code, block.Complete = code.String(), true
+			fence = ""
+			continue
+		}
+		code.WriteString(line)
+	}
+	if fence != "" {
+		blocks[len(blocks)-1].Code = code.String()
+	}
+	return blocks
+}
+
+// CodeValidators check that code in a language parses, by lowercase
+// language name. SendCode uses them; add entries to support more
+// languages.
+var CodeValidators = map[string]func(code string) error{
+	"go":     validateGo,
+	"golang": validateGo,
+	"json":   validateJSON,
+}
+
+// ValidateCode checks that code parses as language. Languages without an
+// entry in CodeValidators are not checked.
+func ValidateCode(language, code string) error {
+	if validate, ok := CodeValidators[strings.ToLower(language)]; ok {
+		return validate(code)
+	}
+	return nil
+}
+
+// validateGo parses code as a Go file, or failing that as declarations or
+// statements, which is how snippets are usually given.
+func validateGo(code string) error {
+	fset := token.NewFileSet()
+	_, err := parser.ParseFile(fset, "", code, 0)
+	if err == nil || strings.HasPrefix(strings.TrimSpace(code), "package ") {
+		return err
+	}
+	if _, e := parser.ParseFile(fset, "", "package main\n"+code, 0); e == nil {
+		return nil
+	}
+	if _, e := parser.ParseFile(fset, "", "package main\nfunc _() {\n"+code+"\n}", 0); e == nil {
+		return nil
+	}
+	return err
+}
+
+// validateJSON parses code as JSON.
+func validateJSON(code string) error {
+	var v any
+	return json.Unmarshal([]byte(code), &v)
+}
+
+// CodeInstruction builds the instruction appended to a request for code
+// in language.
+func CodeInstruction(language string) string {
+	if language == "" {
+		return "Respond with the code in a single fenced code block tagged with its language."
+	}
+	return fmt.Sprintf("Respond with the code in a single fenced code block tagged %q.", language)
+}
+
+// CodeReply is the result of SendCode.
+type CodeReply struct {
+	// Reply is the whole reply.
+	Reply string
+	// Block is the block chosen: the first tagged with the language asked
+	// for, or else the first block.
+	Block CodeBlock
+	// Blocks are all the blocks of the reply.
+	Blocks     []CodeBlock
+	StopReason string
+	// InputTokens and OutputTokens are the request's usage.
+	InputTokens  int
+	OutputTokens int
+}
+
+// SendCode sends a user message asking for code in language, which may be
+// empty, and extracts the code from the reply. The message and reply are
+// kept in the history like those of Send. If validate is set, the code is
+// checked with ValidateCode, and a parse error is returned with the reply.
+func (c *Conversation) SendCode(text, language string, validate bool) (*CodeReply, error) {
+	reply, stopReason, inToks, outToks, _, _, err := c.send(
+		text+"\n\n"+CodeInstruction(language), &c.Settings, SamplingProfile{})
+	if err != nil {
+		return nil, err
+	}
+	r := &CodeReply{
+		Reply:        reply,
+		Blocks:       ExtractCodeBlocks(reply),
+		StopReason:   stopReason,
+		InputTokens:  inToks,
+		OutputTokens: outToks,
+	}
+	if len(r.Blocks) == 0 {
+		return r, ErrNoCodeBlock
+	}
+	r.Block = r.Blocks[0]
+	for _, b := range r.Blocks {
+		if language != "" && strings.EqualFold(b.Language, language) {
+			r.Block = b
+			break
+		}
+	}
+	if validate {
+		lang := r.Block.Language
+		if lang == "" {
+			lang = language
+		}
+		if err := ValidateCode(lang, r.Block.Code); err != nil {
+			return r, fmt.Errorf("error parsing %s code: %w", lang, err)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,79 @@
+package novelai
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExtractCodeBlocks(t *testing.T) {
+	reply := "<think>Maybe:\n```go\nwrong\n```\n</think>Here you go:\n\n```go\nfunc add(a, b int) int {\n\treturn a + b\n}\n```\n\n" +
+		"And the config:\n~~~json title\n{\"a\": 1}\n~~~\n\n````\n```\nnested\n```\n````\n```python\nprint("
+	blocks := ExtractCodeBlocks(reply)
+	want := []CodeBlock{
+		{"go", "func add(a, b int) int {\n\treturn a + b\n}\n", true},
+		{"json", "{\"a\": 1}\n", true},
+		{"", "```\nnested\n```\n", true},
+		{"python", "print(", false},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("Expected %d blocks, got %+v", len(want), blocks)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("Block %d: got %+v, want %+v", i, blocks[i], want[i])
+		}
+	}
+	if blocks := ExtractCodeBlocks("No code here"); len(blocks) != 0 {
+		t.Errorf("Expected no blocks, got %+v", blocks)
+	}
+}
+
+func TestValidateCode(t *testing.T) {
+	tests := []struct {
+		language, code string
+		ok             bool
+	}{
+		{"go", "package main\n\nfunc main() {}\n", true},
+		{"Go", "func add(a, b int) int { return a + b }", true},
+		{"golang", "x := 1\nfmt.Println(x)", true},
+		{"go", "func main() {", false},
+		{"json", `{"a": [1, 2]}`, true},
+		{"json", `{"a": }`, false},
+		{"brainfuck", "not checked", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateCode(tt.language, tt.code); (err == nil) != tt.ok {
+			t.Errorf("ValidateCode(%q, %q) = %v", tt.language, tt.code, err)
+		}
+	}
+}
+
+func TestSendCode(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().On(`.`,
+		FakeResponse{Text: "Sure:\n```json\n{}\n```\n```go\nfunc double(x int) int { return 2 * x }\n```\n"},
+		FakeResponse{Text: "```go\nfunc broken( {\n```"},
+		FakeResponse{Text: "I can't help with that."})
+	fake.Install(conv)
+
+	r, err := conv.SendCode("Write a function doubling an int.", "go", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Block.Language != "go" || !strings.Contains(r.Block.Code, "func double") || len(r.Blocks) != 2 {
+		t.Errorf("Unexpected reply: %+v", r)
+	}
+	if !strings.Contains(fake.Requests()[0].Prompt, CodeInstruction("go")) {
+		t.Error("Expected the code instruction in the prompt")
+	}
+
+	r, err = conv.SendCode("Another one.", "go", true)
+	if err == nil || r == nil || !strings.Contains(r.Block.Code, "broken") {
+		t.Errorf("Expected a parse error with the reply, got %+v, %v", r, err)
+	}
+
+	if _, err := conv.SendCode("And another.", "go", false); !errors.Is(err, ErrNoCodeBlock) {
+		t.Errorf("Expected ErrNoCodeBlock, got %v", err)
+	}
+}
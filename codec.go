@@ -0,0 +1,38 @@
+package novelai
+
+import "encoding/json"
+
+// JSONCodec encodes and decodes the JSON of API requests, responses and
+// streaming chunks. Implementations must behave like encoding/json; sonic's
+// and jsoniter's compatible configurations satisfy it as they are.
+type JSONCodec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// StdJSON is the encoding/json codec.
+var StdJSON JSONCodec = stdJSON{}
+
+// DefaultCodec is used by conversations and clients whose Codec is unset.
+var DefaultCodec = StdJSON
+
+type stdJSON struct{}
+
+func (stdJSON) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (stdJSON) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// codec returns Codec, or DefaultCodec if unset.
+func (c *Conversation) codec() JSONCodec {
+	if c.Codec != nil {
+		return c.Codec
+	}
+	return DefaultCodec
+}
+
+// codec returns Codec, or DefaultCodec if unset.
+func (c *Client) codec() JSONCodec {
+	if c.Codec != nil {
+		return c.Codec
+	}
+	return DefaultCodec
+}
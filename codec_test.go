@@ -0,0 +1,67 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// countingCodec counts calls through to encoding/json.
+type countingCodec struct {
+	marshals, unmarshals atomic.Int32
+}
+
+func (c *countingCodec) Marshal(v any) ([]byte, error) {
+	c.marshals.Add(1)
+	return StdJSON.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v any) error {
+	c.unmarshals.Add(1)
+	return StdJSON.Unmarshal(data, v)
+}
+
+// TestConversationCodec tests that requests, responses and stream chunks
+// go through the conversation's codec.
+func TestConversationCodec(t *testing.T) {
+	conv, _ := newProfileServer(t)
+	codec := &countingCodec{}
+	conv.Codec = codec
+
+	if _, _, _, _, _, _, err := conv.Send("Hi", llmapi.Sampling{}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if codec.marshals.Load() != 1 || codec.unmarshals.Load() != 1 {
+		t.Errorf("Expected 1 marshal and 1 unmarshal, got %d and %d",
+			codec.marshals.Load(), codec.unmarshals.Load())
+	}
+
+	if _, _, _, _, _, _, err := conv.SendStreaming("Again", llmapi.Sampling{}, nil); err != nil {
+		t.Fatalf("SendStreaming failed: %v", err)
+	}
+	if codec.marshals.Load() != 2 || codec.unmarshals.Load() != 2 {
+		t.Errorf("Expected stream request and chunk through codec, got %d and %d",
+			codec.marshals.Load(), codec.unmarshals.Load())
+	}
+}
+
+// TestClientCodec tests that native requests go through the client's codec.
+func TestClientCodec(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"output":"ok"}`)
+	})
+	codec := &countingCodec{}
+	client.Codec = codec
+	out, err := client.Generate(context.Background(), &GenerateRequest{Input: "Hi"})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if out != "ok" || codec.marshals.Load() != 1 || codec.unmarshals.Load() != 1 {
+		t.Errorf("Expected codec used once each way, got %q, %d, %d",
+			out, codec.marshals.Load(), codec.unmarshals.Load())
+	}
+}
@@ -0,0 +1,155 @@
+package novelai
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MetaKeyOriginalPrefix prefixes the metadata keys under which
+// CompactHistory keeps the original text of the messages it changes. The
+// rest of the key is the message index.
+const MetaKeyOriginalPrefix = "original:"
+
+// Tool call markup GLM models write in their replies.
+const (
+	toolCallOpen      = "<tool_call>"
+	toolCallClose     = "</tool_call>"
+	toolResponseOpen  = "<tool_response>"
+	toolResponseClose = "</tool_response>"
+)
+
+// blankLines matches runs of blank lines left behind by removed blocks.
+var blankLines = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+
+// CompactHistory strips <think> blocks and tool call chatter from the
+// assistant messages in the history, shrinking the prompt of long
+// reasoning-heavy conversations while keeping the visible dialogue. The
+// original text of each changed message is kept in Meta under
+// MetaKeyOriginalPrefix and its index; see OriginalMessage. Messages are
+// never removed, so indexes stay valid. Returns the number of messages
+// changed.
+func (c *Conversation) CompactHistory() int {
+	changed := 0
+	for i, m := range c.Messages {
+		if m.Role != "assistant" {
+			continue
+		}
+		compacted := CompactText(m.Content)
+		if compacted == m.Content {
+			continue
+		}
+		key := MetaKeyOriginalPrefix + strconv.Itoa(i)
+		// Keep the first original if compacted more than once
+		if _, ok := c.Meta[key]; !ok {
+			c.SetMeta(key, m.Content)
+		}
+		c.Messages[i].Content = compacted
+		changed++
+	}
+	return changed
+}
+
+// OriginalMessage returns the text of message i as it was before
+// CompactHistory changed it, or its current text if it was not changed.
+// Returns false if there is no message i.
+func (c *Conversation) OriginalMessage(i int) (string, bool) {
+	if i < 0 || i >= len(c.Messages) {
+		return "", false
+	}
+	if original, ok := c.Meta[MetaKeyOriginalPrefix+strconv.Itoa(i)]; ok {
+		return original, true
+	}
+	return c.Messages[i].Content, true
+}
+
+// messageMetaPrefixes are the prefixes of the metadata keys kept for a
+// message, which end in the message's index in Messages.
+var messageMetaPrefixes = []string{MetaKeyOriginalPrefix, MetaKeySafetyPrefix}
+
+// messageMetaIndex returns the message index of a metadata key kept for a
+// message.
+func messageMetaIndex(key string) (int, bool) {
+	for _, prefix := range messageMetaPrefixes {
+		if rest, ok := strings.CutPrefix(key, prefix); ok {
+			i, err := strconv.Atoi(rest)
+			return i, err == nil
+		}
+	}
+	return 0, false
+}
+
+// dropMessageMeta deletes the metadata kept for the messages from index
+// from on, when they are removed from the history, so that later messages
+// at the same indexes do not inherit it.
+func (c *Conversation) dropMessageMeta(from int) {
+	for key := range c.Meta {
+		if i, ok := messageMetaIndex(key); ok && i >= from {
+			delete(c.Meta, key)
+		}
+	}
+}
+
+// mergeMessageMeta updates the metadata of message i as the message after
+// it is merged into it by MergeIfLastTwoAssistant. If either message was
+// changed by CompactHistory or ThinkingRetention, the original of the
+// merged message is the merge of their originals. The safety annotation
+// of message i is dropped, as it does not cover the merged text.
+func (c *Conversation) mergeMessageMeta(i int) {
+	delete(c.Meta, MetaKeySafetyPrefix+strconv.Itoa(i))
+	first := MetaKeyOriginalPrefix + strconv.Itoa(i)
+	second := MetaKeyOriginalPrefix + strconv.Itoa(i+1)
+	_, ok1 := c.Meta[first]
+	_, ok2 := c.Meta[second]
+	if ok1 || ok2 {
+		a, _ := c.OriginalMessage(i)
+		b, _ := c.OriginalMessage(i + 1)
+		c.SetMeta(first, mergedContent(a, b))
+	}
+	c.dropMessageMeta(i + 1)
+}
+
+// CompactText returns text without <think> blocks, tool calls and tool
+// responses. An unterminated block runs to the end of the text, and a
+// closing </think> without an opening tag, as left by a prefilled think
+// block, ends reasoning that began at the start of the text. Text without
+// such blocks is returned unchanged.
+func CompactText(text string) string {
+	out := text
+	if end := strings.Index(out, thinkClose); end >= 0 {
+		if start := strings.Index(out, thinkOpen); start < 0 || start > end {
+			out = out[end+len(thinkClose):]
+		}
+	}
+	out = stripBlocks(out, thinkOpen, thinkClose)
+	out = stripBlocks(out, toolCallOpen, toolCallClose)
+	out = stripBlocks(out, toolResponseOpen, toolResponseClose)
+	if out == text {
+		return text
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(out, "\n\n"))
+}
+
+// stripBlocks removes every block from open to close in text. A block
+// without a closing tag runs to the end of the text.
+func stripBlocks(text, open, close string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, open)
+		if start < 0 {
+			break
+		}
+		b.WriteString(text[:start])
+		end := strings.Index(text[start+len(open):], close)
+		if end < 0 {
+			text = ""
+			break
+		}
+		text = text[start+len(open)+end+len(close):]
+	}
+	if b.Len() == 0 {
+		return text
+	}
+	b.WriteString(text)
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package novelai
+
+import "testing"
+
+func TestCompactText(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "Hello there.\n\n", "Hello there.\n\n"},
+		{"think block", "<think>\nLet me see.\n</think>\n\nThe answer is 4.", "The answer is 4."},
+		{"empty think", "<think></think>\nHi.", "Hi."},
+		{"prefilled think", "reasoning here\n</think>\nHi.", "Hi."},
+		{"unterminated think", "Hi.<think>still thinking", "Hi."},
+		{"tool call", "Checking.\n<tool_call>search\n<arg_key>q</arg_key></tool_call>\n\n\nFound it.", "Checking.\n\nFound it."},
+		{"tool response", "<tool_response>{\"ok\":true}</tool_response>Done.", "Done."},
+		{"all chatter", "<think>x</think><tool_call>y</tool_call>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompactText(tt.in); got != tt.want {
+				t.Errorf("CompactText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactHistory(t *testing.T) {
+	conv := NewConversation("sys")
+	conv.AddMessage("user", "<think>user text is kept</think> Hi")
+	conv.AddMessage("assistant", "<think>plan</think>\nHello!")
+	conv.AddMessage("user", "Bye")
+	conv.AddMessage("assistant", "Goodbye.")
+
+	if n := conv.CompactHistory(); n != 1 {
+		t.Errorf("CompactHistory() = %d, want 1", n)
+	}
+	if got := conv.Messages[1].Content; got != "Hello!" {
+		t.Errorf("compacted reply = %q, want %q", got, "Hello!")
+	}
+	if got := conv.Messages[0].Content; got != "<think>user text is kept</think> Hi" {
+		t.Errorf("user message changed to %q", got)
+	}
+	if got, ok := conv.OriginalMessage(1); !ok || got != "<think>plan</think>\nHello!" {
+		t.Errorf("OriginalMessage(1) = %q, %v", got, ok)
+	}
+	if got, ok := conv.OriginalMessage(3); !ok || got != "Goodbye." {
+		t.Errorf("OriginalMessage(3) = %q, %v, want the unchanged text", got, ok)
+	}
+	if _, ok := conv.OriginalMessage(4); ok {
+		t.Error("OriginalMessage(4) found a message past the end")
+	}
+
+	// Compacting again changes nothing and keeps the first original
+	conv.AddMessage("user", "Again")
+	conv.AddMessage("assistant", "</think>Sure.")
+	if n := conv.CompactHistory(); n != 1 {
+		t.Errorf("second CompactHistory() = %d, want 1", n)
+	}
+	if got, _ := conv.OriginalMessage(1); got != "<think>plan</think>\nHello!" {
+		t.Errorf("OriginalMessage(1) after recompaction = %q", got)
+	}
+	if len(conv.Meta) != 2 {
+		t.Errorf("Meta = %v, want two originals", conv.Meta)
+	}
+}
+
+func TestCompactHistoryMergeAndClear(t *testing.T) {
+	conv := NewConversation("sys")
+	conv.AddMessage("user", "Hi")
+	conv.AddMessage("assistant", "<think>plan</think>Hel")
+	conv.AddMessage("assistant", "lo there.")
+	conv.CompactHistory()
+
+	conv.MergeIfLastTwoAssistant()
+	if got, _ := conv.OriginalMessage(1); got != "<think>plan</think>Hello there." {
+		t.Errorf("original of merged reply = %q", got)
+	}
+	if _, ok := conv.Meta[MetaKeyOriginalPrefix+"2"]; ok {
+		t.Error("original of the merged-away reply was kept")
+	}
+
+	conv.Clear()
+	conv.AddMessage("user", "Again")
+	conv.AddMessage("assistant", "New reply.")
+	if got, _ := conv.OriginalMessage(1); got != "New reply." {
+		t.Errorf("OriginalMessage(1) after Clear = %q, want the new reply", got)
+	}
+}
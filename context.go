@@ -0,0 +1,475 @@
+package novelai
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultContextTokens is the context size used when ContextBuilder.MaxTokens is zero.
+var DefaultContextTokens = 8192
+
+// TokenCounter counts tokens for context budgeting.
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// TokenCounterFunc adapts a function to the TokenCounter interface.
+type TokenCounterFunc func(text string) int
+
+// CountTokens implements TokenCounter.
+func (f TokenCounterFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// EstimateTokens approximates a token count at four bytes per token.
+// It is used when no tokenizer is configured; budgets computed with it
+// are estimates.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// ContextSource identifies where a context entry came from.
+type ContextSource string
+
+const (
+	SourceStory       ContextSource = "story"
+	SourceMemory      ContextSource = "memory"
+	SourceAuthorsNote ContextSource = "authorsNote"
+	SourceContext     ContextSource = "context"
+	SourceLorebook    ContextSource = "lorebook"
+)
+
+// Trim and insertion types used by ContextConfig.
+const (
+	TrimBottom    = "trimBottom"
+	TrimTop       = "trimTop"
+	DoNotTrim     = "doNotTrim"
+	TrimNewline   = "newline"
+	TrimSentence  = "sentence"
+	TrimToken     = "token"
+	InsertNewline = "newline"
+)
+
+// StoryContextConfig returns the default context config for the story text.
+func StoryContextConfig() *ContextConfig {
+	return &ContextConfig{
+		TokenBudget:       1,
+		BudgetPriority:    0,
+		TrimDirection:     TrimTop,
+		InsertionType:     InsertNewline,
+		MaximumTrimType:   TrimSentence,
+		InsertionPosition: -1,
+	}
+}
+
+// ContextReportEntry traces one candidate entry through context assembly.
+type ContextReportEntry struct {
+	// Name is a display name: the lorebook display name, or the source.
+	Name   string        `json:"name"`
+	Source ContextSource `json:"source"`
+	// ID is the lorebook entry ID, if any.
+	ID string `json:"id,omitempty"`
+
+	// Active is true if the entry was activated.
+	Active bool `json:"active"`
+	// Reason explains activation (always "forced" for non-lorebook entries).
+	Reason ActivationReason `json:"reason"`
+	// MatchedKey and MatchPosition describe the key match for lorebook entries.
+	MatchedKey    string `json:"matched_key,omitempty"`
+	MatchPosition int    `json:"match_position"`
+
+	// Priority is the entry's budget priority.
+	Priority int `json:"priority"`
+	// OriginalTokens is the token count before trimming.
+	OriginalTokens int `json:"original_tokens"`
+	// Tokens is the token count of the inserted text.
+	Tokens int `json:"tokens"`
+	// Trimmed is true if the text was shortened to fit its budget.
+	Trimmed bool `json:"trimmed"`
+	// Included is true if any text was inserted into the context.
+	Included bool `json:"included"`
+	// Text is the final inserted text, including prefix and suffix.
+	Text string `json:"text,omitempty"`
+
+	// InsertionPosition and InsertionType are the configured placement.
+	InsertionPosition int    `json:"insertion_position"`
+	InsertionType     string `json:"insertion_type"`
+	// Order is the entry's insertion order, or -1 if not inserted.
+	Order int `json:"order"`
+	// Offset is the byte offset of Text in the final context, or -1.
+	Offset int `json:"offset"`
+}
+
+// ContextReport is a structured trace of context assembly, similar to
+// NovelAI's Context Viewer.
+type ContextReport struct {
+	// Entries lists every candidate entry in priority order.
+	Entries []ContextReportEntry `json:"entries"`
+	// Context is the assembled context text.
+	Context string `json:"context"`
+	// Tokens is the token count of the assembled context.
+	Tokens int `json:"tokens"`
+	// MaxTokens is the context budget used.
+	MaxTokens int `json:"max_tokens"`
+}
+
+// ContextBuilder assembles model context from a scenario and story text,
+// following NovelAI's activation, budgeting and insertion rules.
+//
+// Budgeting: reserved tokens are set aside for every entry first; entries
+// are then processed by descending budget priority, each receiving up to
+// its token budget (1 meaning all of MaxTokens, 0 or less nothing) from
+// the remaining pool plus its own reservation. Entries that don't fit are
+// trimmed by newline, then sentence, then token, up to their maximum trim
+// type. Insertion positions count units of insertion type from the start
+// (0 and up) or end (-1 and down) of the text assembled so far.
+type ContextBuilder struct {
+	// Scenario provides context entries and the lorebook.
+	Scenario *Scenario
+	// Counter counts tokens. If nil, EstimateTokens is used.
+	Counter TokenCounter
+	// MaxTokens is the total context budget. If zero, DefaultContextTokens is used.
+	MaxTokens int
+	// Macros, if set, expands macros such as {{user}} and {{char}} in
+	// context and lorebook entry text.
+	Macros *MacroEngine
+}
+
+// NewContextBuilder creates a builder for the scenario with default settings.
+func NewContextBuilder(s *Scenario) *ContextBuilder {
+	return &ContextBuilder{Scenario: s}
+}
+
+// ContextReport runs activation and budgeting for story text using default
+// builder settings and returns the trace.
+func (s *Scenario) ContextReport(story string) *ContextReport {
+	return NewContextBuilder(s).Report(story)
+}
+
+// Build returns the assembled context for story text.
+func (b *ContextBuilder) Build(story string) string {
+	return b.Report(story).Context
+}
+
+// contextCandidate is an entry under consideration during assembly.
+type contextCandidate struct {
+	report   ContextReportEntry
+	text     string
+	cfg      ContextConfig
+	reserved int
+}
+
+// Report runs activation, budgeting and insertion for story text.
+func (b *ContextBuilder) Report(story string) *ContextReport {
+	maxTokens := b.maxTokens()
+	candidates := b.candidates(story)
+
+	// Order by budget priority; the story goes first among equals so that
+	// other entries are inserted into it.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := candidates[i].cfg.BudgetPriority, candidates[j].cfg.BudgetPriority
+		if pi != pj {
+			return pi > pj
+		}
+		return candidates[i].report.Source == SourceStory && candidates[j].report.Source != SourceStory
+	})
+
+	// Pass 1: set aside reserved tokens for active entries
+	remaining := maxTokens
+	for i := range candidates {
+		c := &candidates[i]
+		if !c.report.Active {
+			continue
+		}
+		c.report.OriginalTokens = b.count(c.text)
+		c.reserved = min(b.resolveBudget(c.cfg.ReservedTokens, maxTokens), c.report.OriginalTokens)
+		remaining -= c.reserved
+	}
+
+	// Pass 2: allocate budgets and trim in priority order
+	for i := range candidates {
+		c := &candidates[i]
+		if !c.report.Active {
+			continue
+		}
+		available := max(remaining+c.reserved, 0)
+		limit := min(b.resolveBudget(c.cfg.TokenBudget, maxTokens), available)
+		text := b.trim(c.text, limit, c.cfg)
+		c.report.Trimmed = text != c.text
+		c.report.Tokens = b.count(text)
+		c.report.Included = text != ""
+		c.text = text
+		remaining = available - c.report.Tokens
+	}
+
+	// Pass 3: insert in priority order
+	var segments []contextSegment
+	order := 0
+	for i := range candidates {
+		c := &candidates[i]
+		c.report.Order = -1
+		c.report.Offset = -1
+		if !c.report.Included {
+			continue
+		}
+		c.report.Text = c.cfg.Prefix + c.text + c.cfg.Suffix
+		segments = insertSegment(segments, i, c.report.Text, c.cfg)
+		c.report.Order = order
+		order++
+	}
+
+	report := &ContextReport{MaxTokens: maxTokens}
+	var assembled strings.Builder
+	for _, seg := range segments {
+		if candidates[seg.owner].report.Offset < 0 {
+			candidates[seg.owner].report.Offset = assembled.Len()
+		}
+		assembled.WriteString(seg.text)
+	}
+	report.Context = assembled.String()
+	report.Tokens = b.count(report.Context)
+	for _, c := range candidates {
+		report.Entries = append(report.Entries, c.report)
+	}
+	return report
+}
+
+// candidates collects the story, context entries and lorebook entries.
+func (b *ContextBuilder) candidates(story string) []contextCandidate {
+	s := b.Scenario
+	if s == nil {
+		s = &Scenario{}
+	}
+
+	storyCfg := StoryContextConfig()
+	if s.StoryContextConfig != nil {
+		storyCfg = s.StoryContextConfig
+	}
+	candidates := []contextCandidate{
+		b.newCandidate(string(SourceStory), SourceStory, story, storyCfg),
+	}
+
+	for i, entry := range s.Context {
+		source := SourceContext
+		switch i {
+		case 0:
+			source = SourceMemory
+		case 1:
+			source = SourceAuthorsNote
+		}
+		cfg := entry.ContextCfg
+		if cfg == nil {
+			cfg = DefaultContextConfig()
+		}
+		c := b.newCandidate(string(source), source, b.expandMacros(entry.Text), cfg)
+		c.report.Active = entry.Text != ""
+		candidates = append(candidates, c)
+	}
+
+	for _, act := range s.Lorebook.Activate(story) {
+		entry := s.Lorebook.Entries[act.EntryIndex]
+		cfg := entry.ContextCfg
+		if cfg == nil {
+			cfg = DefaultContextConfig()
+		}
+		name := entry.DisplayName
+		if name == "" {
+			name = entry.ID
+		}
+		c := b.newCandidate(name, SourceLorebook, b.expandMacros(entry.Text), cfg)
+		c.report.ID = entry.ID
+		c.report.Active = act.Active
+		c.report.Reason = act.Reason
+		c.report.MatchedKey = act.Key
+		c.report.MatchPosition = act.Position
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// newCandidate creates an active candidate with forced activation.
+func (b *ContextBuilder) newCandidate(name string, source ContextSource, text string, cfg *ContextConfig) contextCandidate {
+	return contextCandidate{
+		report: ContextReportEntry{
+			Name:              name,
+			Source:            source,
+			Active:            true,
+			Reason:            ActivationForced,
+			MatchPosition:     -1,
+			Priority:          cfg.BudgetPriority,
+			InsertionPosition: cfg.InsertionPosition,
+			InsertionType:     cfg.InsertionType,
+		},
+		text: text,
+		cfg:  *cfg,
+	}
+}
+
+// expandMacros expands macros in entry text if Macros is set.
+func (b *ContextBuilder) expandMacros(text string) string {
+	if b.Macros == nil {
+		return text
+	}
+	return b.Macros.Expand(text)
+}
+
+// maxTokens returns the effective context budget.
+func (b *ContextBuilder) maxTokens() int {
+	if b.MaxTokens > 0 {
+		return b.MaxTokens
+	}
+	return DefaultContextTokens
+}
+
+// count returns the token count of text.
+func (b *ContextBuilder) count(text string) int {
+	if text == "" {
+		return 0
+	}
+	if b.Counter != nil {
+		return b.Counter.CountTokens(text)
+	}
+	return EstimateTokens(text)
+}
+
+// resolveBudget converts a token budget setting to a token count. A budget
+// of 1 is the whole total and one of 0 or less is nothing; larger values
+// are token counts.
+func (b *ContextBuilder) resolveBudget(budget, total int) int {
+	switch {
+	case budget <= 0:
+		return 0
+	case budget == 1:
+		return total
+	default:
+		return budget
+	}
+}
+
+// trim shortens text to at most limit tokens according to cfg.
+// Returns "" if the text cannot be trimmed to fit.
+func (b *ContextBuilder) trim(text string, limit int, cfg ContextConfig) string {
+	if b.count(text) <= limit {
+		return text
+	}
+	if cfg.TrimDirection == DoNotTrim || limit <= 0 {
+		return ""
+	}
+
+	levels := []string{TrimNewline, TrimSentence, TrimToken}
+	maxLevel := cfg.MaximumTrimType
+	if maxLevel == "" {
+		maxLevel = TrimSentence
+	}
+	for _, level := range levels {
+		units := splitUnits(text, level)
+		if cfg.TrimDirection == TrimTop {
+			for len(units) > 0 && b.count(strings.Join(units, "")) > limit {
+				units = units[1:]
+			}
+		} else {
+			for len(units) > 0 && b.count(strings.Join(units, "")) > limit {
+				units = units[:len(units)-1]
+			}
+		}
+		if trimmed := strings.Join(units, ""); strings.TrimSpace(trimmed) != "" {
+			return trimmed
+		}
+		if level == maxLevel {
+			break
+		}
+	}
+	return ""
+}
+
+// sentencePattern splits text into sentences with trailing whitespace.
+var sentencePattern = regexp.MustCompile(`[^.!?\n]*(?:[.!?]+["')\]]*|\n|$)\s*`)
+
+// splitUnits splits text into pieces that concatenate back to text.
+func splitUnits(text string, unit string) []string {
+	var units []string
+	switch unit {
+	case TrimNewline:
+		units = strings.SplitAfter(text, "\n")
+	case TrimSentence:
+		units = sentencePattern.FindAllString(text, -1)
+	default:
+		units = chunkPattern.FindAllString(text, -1)
+	}
+	// Drop empty pieces produced by the splitters
+	out := units[:0]
+	for _, u := range units {
+		if u != "" {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// contextSegment is a run of assembled context owned by one candidate.
+type contextSegment struct {
+	text  string
+	owner int
+}
+
+// insertSegment inserts text into the assembled segments at the position
+// described by cfg.
+func insertSegment(segments []contextSegment, owner int, text string, cfg ContextConfig) []contextSegment {
+	var full strings.Builder
+	for _, seg := range segments {
+		full.WriteString(seg.text)
+	}
+	assembled := full.String()
+
+	insertionType := cfg.InsertionType
+	if insertionType == "" {
+		insertionType = InsertNewline
+	}
+
+	// Boundaries are the offsets where an insertion may happen, including
+	// the start and end of the text.
+	boundaries := []int{0}
+	offset := 0
+	for _, u := range splitUnits(assembled, insertionType) {
+		offset += len(u)
+		boundaries = append(boundaries, offset)
+	}
+
+	var at int
+	if pos := cfg.InsertionPosition; pos >= 0 {
+		at = boundaries[min(pos, len(boundaries)-1)]
+	} else {
+		at = boundaries[max(len(boundaries)+pos, 0)]
+	}
+
+	// Keep newline-inserted entries on their own line
+	if insertionType == InsertNewline {
+		if at > 0 && assembled[at-1] != '\n' {
+			text = "\n" + text
+		}
+	}
+
+	// Split the segment containing the insertion point
+	var result []contextSegment
+	pos := 0
+	inserted := false
+	for _, seg := range segments {
+		end := pos + len(seg.text)
+		if !inserted && at >= pos && at < end {
+			if at > pos {
+				result = append(result, contextSegment{text: seg.text[:at-pos], owner: seg.owner})
+			}
+			result = append(result, contextSegment{text: text, owner: owner})
+			result = append(result, contextSegment{text: seg.text[at-pos:], owner: seg.owner})
+			inserted = true
+		} else {
+			result = append(result, seg)
+		}
+		pos = end
+	}
+	if !inserted {
+		result = append(result, contextSegment{text: text, owner: owner})
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTestScenario builds a scenario with memory, author's note and lore.
+func newTestScenario(t *testing.T) *Scenario {
+	t.Helper()
+	s := NewScenario("Test")
+	s.Context = []ContextEntry{
+		{Text: "Memory: it is winter.", ContextCfg: MemoryContextConfig()},
+		{Text: "[ Style: terse ]", ContextCfg: AuthorsNoteContextConfig()},
+	}
+	for _, e := range []LorebookEntry{
+		NewLorebookEntry("Alice", "Alice is a knight.", "Alice"),
+		NewLorebookEntry("Castle", "The castle is old.", "/cast(le|ellan)/i"),
+		NewLorebookEntry("Dragon", "Dragons are extinct.", "dragon"),
+	} {
+		if _, err := s.Lorebook.AddEntry(e); err != nil {
+			t.Fatalf("AddEntry failed: %v", err)
+		}
+	}
+	return s
+}
+
+// TestLorebookActivate tests key matching, regex keys and search ranges.
+func TestLorebookActivate(t *testing.T) {
+	s := newTestScenario(t)
+	s.Lorebook.Entries[2].ForceActivation = true
+	story := "Line one.\nALICE walked to the Castle gate."
+
+	acts := s.Lorebook.Activate(story)
+	if !acts[0].Active || acts[0].Key != "Alice" || acts[0].Position != 10 {
+		t.Errorf("Expected Alice to match at 10, got %+v", acts[0])
+	}
+	if !acts[1].Active || acts[1].Reason != ActivationKeyMatched || acts[1].Position != strings.Index(story, "Castle") {
+		t.Errorf("Expected regex key to match Castle, got %+v", acts[1])
+	}
+	if !acts[2].Active || acts[2].Reason != ActivationForced {
+		t.Errorf("Expected forced activation, got %+v", acts[2])
+	}
+
+	// Keys outside the search range don't activate
+	s.Lorebook.Entries[0].SearchRange = 10
+	if acts := s.Lorebook.Activate(story); acts[0].Active {
+		t.Errorf("Expected Alice outside search range to be inactive, got %+v", acts[0])
+	}
+
+	// Disabled categories suppress activation
+	cat := s.Lorebook.AddCategory("Places")
+	s.Lorebook.Categories[0].Enabled = false
+	s.Lorebook.Entries[1].Category = cat
+	if acts := s.Lorebook.Activate(story); acts[1].Reason != ActivationCategoryDisabled {
+		t.Errorf("Expected category disabled, got %+v", acts[1])
+	}
+}
+
+// TestContextReport tests activation tracing and insertion order.
+func TestContextReport(t *testing.T) {
+	s := newTestScenario(t)
+	story := "Alice rode out.\nThe wind howled.\nShe reached the hill.\nNight fell.\nShe slept."
+
+	report := s.ContextReport(story)
+
+	mem := strings.Index(report.Context, "Memory: it is winter.")
+	lore := strings.Index(report.Context, "Alice is a knight.")
+	start := strings.Index(report.Context, "Alice rode out.")
+	note := strings.Index(report.Context, "[ Style: terse ]")
+	if mem != 0 || lore < mem || start < lore || note < start {
+		t.Errorf("Unexpected context layout:\n%s", report.Context)
+	}
+	if !strings.HasSuffix(report.Context, "[ Style: terse ]\nShe reached the hill.\nNight fell.\nShe slept.") {
+		t.Errorf("Expected author's note three lines from the end:\n%s", report.Context)
+	}
+	if strings.Contains(report.Context, "Dragons") || strings.Contains(report.Context, "castle") {
+		t.Errorf("Inactive lore leaked into context:\n%s", report.Context)
+	}
+
+	byName := make(map[string]ContextReportEntry)
+	for _, e := range report.Entries {
+		byName[e.Name] = e
+	}
+	alice := byName["Alice"]
+	if !alice.Included || alice.MatchedKey != "Alice" || alice.Offset != lore || alice.Order != 1 {
+		t.Errorf("Unexpected Alice trace: %+v", alice)
+	}
+	if dragon := byName["Dragon"]; dragon.Active || dragon.Reason != ActivationNoMatch || dragon.Order != -1 {
+		t.Errorf("Unexpected Dragon trace: %+v", dragon)
+	}
+	if report.Entries[0].Source != SourceMemory {
+		t.Errorf("Expected entries in priority order, got %s first", report.Entries[0].Source)
+	}
+}
+
+// TestContextBudgetTrimming tests that the story is trimmed from the top to fit.
+func TestContextBudgetTrimming(t *testing.T) {
+	s := NewScenario("Test")
+	s.Context = []ContextEntry{{Text: "Memory.", ContextCfg: MemoryContextConfig()}}
+
+	b := NewContextBuilder(s)
+	b.Counter = TokenCounterFunc(func(text string) int { return len(strings.Fields(text)) })
+	b.MaxTokens = 5
+
+	report := b.Report("one two.\nthree four.\nfive six.")
+	if report.Context != "Memory.\nthree four.\nfive six." {
+		t.Errorf("Unexpected trimmed context: %q", report.Context)
+	}
+	for _, e := range report.Entries {
+		if e.Source == SourceStory && (!e.Trimmed || e.Tokens != 4 || e.OriginalTokens != 6) {
+			t.Errorf("Unexpected story trace: %+v", e)
+		}
+	}
+	if report.Tokens > b.MaxTokens {
+		t.Errorf("Context exceeds budget: %d > %d", report.Tokens, b.MaxTokens)
+	}
+}
+
+// TestSplitUnits tests that units always reassemble to the original text.
+func TestSplitUnits(t *testing.T) {
+	text := "Hi there! How are you?\nFine. \"Good.\" ok"
+	for _, unit := range []string{TrimNewline, TrimSentence, TrimToken} {
+		if joined := strings.Join(splitUnits(text, unit), ""); joined != text {
+			t.Errorf("splitUnits(%s) lost text: %q", unit, joined)
+		}
+	}
+	if got := splitUnits(text, TrimSentence); len(got) != 5 {
+		t.Errorf("Expected 5 sentences, got %q", got)
+	}
+}
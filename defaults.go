@@ -0,0 +1,72 @@
+package novelai
+
+import "sync"
+
+// Defaults are the package-wide defaults applied by NewConversation and
+// NewClient.
+type Defaults struct {
+	// ApiToken is the token new conversations and clients authenticate with.
+	ApiToken string
+	// Settings are the generation settings new conversations start with.
+	Settings Settings
+}
+
+var (
+	defaultsMu  sync.RWMutex
+	defaultsSet bool
+	defaults    Defaults
+	// tokenOnce loads DefaultApiToken when the defaults are first needed,
+	// rather than when the package is initialized.
+	tokenOnce sync.Once
+)
+
+// SetDefaults replaces the defaults used by NewConversation and NewClient.
+// d is copied, so later changes to it have no effect. It is safe to call
+// while other goroutines create conversations, e.g. when a server adjusts
+// its defaults at runtime.
+//
+// Once SetDefaults has been called, DefaultApiToken and DefaultSettings are
+// no longer consulted.
+func SetDefaults(d Defaults) {
+	d.Settings = d.Settings.Clone()
+	defaultsMu.Lock()
+	defaults, defaultsSet = d, true
+	defaultsMu.Unlock()
+}
+
+// UpdateDefaults applies fn to a copy of the current defaults and installs
+// the result, atomically with respect to other calls to SetDefaults and
+// UpdateDefaults.
+func UpdateDefaults(fn func(*Defaults)) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	d := currentDefaults()
+	fn(&d)
+	d.Settings = d.Settings.Clone()
+	defaults, defaultsSet = d, true
+}
+
+// CurrentDefaults returns a copy of the defaults used by NewConversation and
+// NewClient. Changing it does not affect the defaults; use SetDefaults.
+func CurrentDefaults() Defaults {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return currentDefaults()
+}
+
+// currentDefaults returns a copy of the registered defaults, or of the
+// legacy variables if SetDefaults has not been called. Must be called with
+// defaultsMu held.
+func currentDefaults() Defaults {
+	d := defaults
+	if !defaultsSet {
+		tokenOnce.Do(func() {
+			if DefaultApiToken == "" {
+				DefaultApiToken = LoadApiToken()
+			}
+		})
+		d = Defaults{ApiToken: DefaultApiToken, Settings: DefaultSettings}
+	}
+	d.Settings = d.Settings.Clone()
+	return d
+}
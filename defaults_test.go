@@ -0,0 +1,133 @@
+package novelai
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// restoreDefaults resets the defaults registry after a test.
+func restoreDefaults(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		defaultsMu.Lock()
+		defaults, defaultsSet = Defaults{}, false
+		defaultsMu.Unlock()
+	})
+}
+
+func TestCurrentDefaultsFallsBackToVariables(t *testing.T) {
+	restoreDefaults(t)
+	d := CurrentDefaults()
+	if d.ApiToken != DefaultApiToken {
+		t.Errorf("ApiToken = %q, want DefaultApiToken", d.ApiToken)
+	}
+	if d.Settings.Model != DefaultSettings.Model || d.Settings.MaxTokens != DefaultSettings.MaxTokens {
+		t.Errorf("Settings = %+v, want DefaultSettings", d.Settings)
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	restoreDefaults(t)
+	settings := Settings{Model: ModelErato, MaxTokens: 100, StopSequences: []string{"***"}}
+	SetDefaults(Defaults{ApiToken: "tok", Settings: settings})
+	settings.StopSequences[0] = "changed"
+
+	conv := NewConversation("sys")
+	if conv.ApiToken != "tok" || conv.Settings.Model != ModelErato || conv.Settings.MaxTokens != 100 {
+		t.Errorf("conversation = %q %+v, want the new defaults", conv.ApiToken, conv.Settings)
+	}
+	if conv.Settings.StopSequences[0] != "***" {
+		t.Errorf("StopSequences = %v, SetDefaults did not copy its argument", conv.Settings.StopSequences)
+	}
+	if c := NewClient(); c.ApiToken != "tok" {
+		t.Errorf("client ApiToken = %q, want tok", c.ApiToken)
+	}
+
+	// Conversations must not share state with the defaults
+	conv.Settings.StopSequences[0] = "mutated"
+	if got := CurrentDefaults().Settings.StopSequences[0]; got != "***" {
+		t.Errorf("defaults StopSequences = %q after mutating a conversation", got)
+	}
+}
+
+func TestUpdateDefaults(t *testing.T) {
+	restoreDefaults(t)
+	UpdateDefaults(func(d *Defaults) {
+		d.Settings.Temperature = 0.25
+	})
+	d := CurrentDefaults()
+	if d.Settings.Temperature != 0.25 {
+		t.Errorf("Temperature = %v, want 0.25", d.Settings.Temperature)
+	}
+	if d.Settings.Model != DefaultSettings.Model {
+		t.Errorf("Model = %q, want the unchanged default %q", d.Settings.Model, DefaultSettings.Model)
+	}
+}
+
+func TestDefaultsConcurrentUse(t *testing.T) {
+	restoreDefaults(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				UpdateDefaults(func(d *Defaults) {
+					d.Settings.MaxTokens = i*100 + j
+					d.Settings.StopSequences = append(d.Settings.StopSequences, "x")
+				})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				conv := NewConversation("")
+				conv.Settings.StopSequences = append(conv.Settings.StopSequences[:0], "y")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNewConversationWithClient(t *testing.T) {
+	restoreDefaults(t)
+	SetDefaults(Defaults{ApiToken: "default", Settings: Settings{Model: ModelErato}})
+	client := &http.Client{}
+	settings := BuiltinSettings()
+	conv := NewConversationWithClient(client, ConversationConfig{
+		System:   "sys",
+		ApiToken: "explicit",
+		Endpoint: "http://localhost/v1/completions",
+		Settings: settings,
+	})
+	if conv.HttpClient != client || conv.ApiToken != "explicit" || conv.System != "sys" {
+		t.Errorf("conversation = %q %q, want the config", conv.ApiToken, conv.System)
+	}
+	if conv.Settings.Model != ModelGLM46 || conv.endpoint() != "http://localhost/v1/completions" {
+		t.Errorf("settings = %+v, want the config's", conv.Settings)
+	}
+	if len(settings.StopSequences) > 0 {
+		settings.StopSequences[0] = "changed"
+		if conv.Settings.StopSequences[0] == "changed" {
+			t.Error("Settings were not copied")
+		}
+	}
+
+	if conv := NewConversationWithClient(nil, ConversationConfig{}); conv.HttpClient == nil || conv.ApiToken != "" {
+		t.Errorf("Zero config: client %v, token %q", conv.HttpClient, conv.ApiToken)
+	}
+}
+
+func TestBuiltinSettings(t *testing.T) {
+	restoreDefaults(t)
+	SetDefaults(Defaults{Settings: Settings{Model: ModelErato}})
+	s := BuiltinSettings()
+	if s.Model != ModelGLM46 || s.MaxTokens != 2048 || len(s.StopSequences) != 2 {
+		t.Errorf("BuiltinSettings() = %+v, want the built-in settings", s)
+	}
+	s.StopSequences[0] = "changed"
+	if BuiltinSettings().StopSequences[0] == "changed" {
+		t.Error("BuiltinSettings() shares its stop sequences")
+	}
+}
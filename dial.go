@@ -0,0 +1,193 @@
+package novelai
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DialFunc makes the network connections of requests, as
+// http.Transport.DialContext does. Set one with ConversationConfig.Dial or
+// NewDialTransport to reach the API through a Unix socket, a SOCKS5 proxy
+// or pinned addresses, without building a transport.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewDialTransport returns a copy of http.DefaultTransport making its
+// connections with dial. TLS is still negotiated with the host of each
+// request's URL, whatever address dial connects to.
+func NewDialTransport(dial DialFunc) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dial
+	return t
+}
+
+// withDial returns a copy of client whose transport connects with dial. It
+// applies when the transport is an *http.Transport, or unset; other
+// transports are used as is.
+func withDial(client *http.Client, dial DialFunc) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return client
+	}
+	t = t.Clone()
+	t.DialContext = dial
+	out := *client
+	out.Transport = t
+	return &out
+}
+
+// UnixSocketDialer connects every request to the Unix socket at path, for
+// a local proxy or gateway listening on one. Set the endpoint to an http
+// URL naming the host the gateway expects, such as
+// "http://localhost/oa/v1/completions".
+func UnixSocketDialer(path string) DialFunc {
+	var d net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, "unix", path)
+	}
+}
+
+// PinnedDialer connects to the addresses in pins, keyed by host name,
+// instead of resolving the host, keeping the port requested. Hosts not in
+// pins are resolved as usual. Certificates are still checked against the
+// host name.
+func PinnedDialer(pins map[string]string) DialFunc {
+	var d net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip, ok := pins[host]; ok {
+			addr = net.JoinHostPort(ip, port)
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// SOCKS5Dialer connects through the SOCKS5 proxy at proxyAddr, with
+// username and password authentication if username is set. Host names are
+// resolved by the proxy.
+func SOCKS5Dialer(proxyAddr, username, password string) DialFunc {
+	var d net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to SOCKS5 proxy: %w", err)
+		}
+		// The handshake is bounded by ctx
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		err = socks5Connect(conn, addr, username, password)
+		if !stop() || err != nil {
+			conn.Close()
+			if err == nil {
+				err = ctx.Err()
+			}
+			return nil, fmt.Errorf("error connecting through SOCKS5 proxy: %w", err)
+		}
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+// errSOCKS5 reports a proxy reply that breaks the protocol.
+var errSOCKS5 = errors.New("invalid SOCKS5 reply")
+
+// socks5Connect asks the proxy on conn to connect to addr, as in RFC 1928
+// and RFC 1929.
+func socks5Connect(conn net.Conn, addr, username, password string) error {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portText)
+	}
+	if len(host) > 255 || len(username) > 255 || len(password) > 255 {
+		return fmt.Errorf("host name or credentials too long for SOCKS5")
+	}
+
+	method := byte(0x00)
+	if username != "" {
+		method = 0x02
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return fmt.Errorf("proxy refused authentication method %d", method)
+	}
+	if method == 0x02 {
+		auth := append([]byte{1, byte(len(username))}, username...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("proxy rejected credentials")
+		}
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip.To4() != nil {
+		req = append(append(req, 1), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else {
+		req = append(append(req, 3, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[0] != 5 {
+		return errSOCKS5
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("proxy failed to connect (code %d)", head[1])
+	}
+	// Skip the bound address
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return errSOCKS5
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
@@ -0,0 +1,173 @@
+package novelai
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newDialServer returns a completion server, not yet started.
+func newDialServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mockCompletionResponse("Dialed.", "stop", 5, 2))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sendDialed sends a message through a conversation created with dial.
+func sendDialed(t *testing.T, endpoint string, dial DialFunc) (string, error) {
+	t.Helper()
+	conv := NewConversationWithClient(nil, ConversationConfig{
+		ApiToken: "test-token",
+		Endpoint: endpoint,
+		Settings: BuiltinSettings(),
+		Dial:     dial,
+	})
+	conv.Retry = &RetryPolicy{}
+	reply, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{})
+	return reply, err
+}
+
+func TestUnixSocketDialer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	server := newDialServer(t)
+	server.Listener = l
+	server.Start()
+
+	reply, err := sendDialed(t, "http://localhost/oa/v1/completions", UnixSocketDialer(path))
+	if err != nil || reply != "Dialed." {
+		t.Errorf("reply over Unix socket = %q, %v", reply, err)
+	}
+}
+
+func TestPinnedDialer(t *testing.T) {
+	server := newDialServer(t)
+	server.Start()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	endpoint := "http://api.novelai.invalid:" + port + "/oa/v1/completions"
+	reply, err := sendDialed(t, endpoint, PinnedDialer(map[string]string{"api.novelai.invalid": "127.0.0.1"}))
+	if err != nil || reply != "Dialed." {
+		t.Errorf("reply through pinned address = %q, %v", reply, err)
+	}
+	if _, err := sendDialed(t, endpoint, PinnedDialer(nil)); err == nil {
+		t.Error("unpinned invalid host resolved")
+	}
+}
+
+// socks5Server runs a SOCKS5 proxy requiring user and pass, returning its
+// address and a channel of the addresses it was asked to connect to.
+func socks5Server(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	targets := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 262)
+				io.ReadFull(conn, buf[:2])
+				io.ReadFull(conn, buf[:buf[1]])
+				conn.Write([]byte{5, 2})
+				// Username and password
+				io.ReadFull(conn, buf[:2])
+				user := make([]byte, buf[1])
+				io.ReadFull(conn, user)
+				io.ReadFull(conn, buf[:1])
+				pass := make([]byte, buf[0])
+				io.ReadFull(conn, pass)
+				if string(user) != "user" || string(pass) != "pass" {
+					conn.Write([]byte{1, 1})
+					return
+				}
+				conn.Write([]byte{1, 0})
+				// Connect request
+				io.ReadFull(conn, buf[:4])
+				var host string
+				switch buf[3] {
+				case 1:
+					io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 3:
+					io.ReadFull(conn, buf[:1])
+					name := make([]byte, buf[0])
+					io.ReadFull(conn, name)
+					host = string(name)
+				}
+				io.ReadFull(conn, buf[:2])
+				addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+				targets <- addr
+				if host == "api.novelai.invalid" {
+					addr = strings.Replace(addr, host, "127.0.0.1", 1)
+				}
+				upstream, err := net.Dial("tcp", addr)
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return l.Addr().String(), targets
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	server := newDialServer(t)
+	server.Start()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	proxyAddr, targets := socks5Server(t)
+
+	endpoint := "http://api.novelai.invalid:" + port + "/oa/v1/completions"
+	reply, err := sendDialed(t, endpoint, SOCKS5Dialer(proxyAddr, "user", "pass"))
+	if err != nil || reply != "Dialed." {
+		t.Fatalf("reply through SOCKS5 = %q, %v", reply, err)
+	}
+	if got := <-targets; got != "api.novelai.invalid:"+port {
+		t.Errorf("proxy asked to connect to %q, want the unresolved host", got)
+	}
+
+	if _, err := sendDialed(t, endpoint, SOCKS5Dialer(proxyAddr, "user", "wrong")); err == nil ||
+		!strings.Contains(err.Error(), "rejected credentials") {
+		t.Errorf("wrong password error = %v", err)
+	}
+}
+
+func TestWithDialKeepsCustomTransport(t *testing.T) {
+	fake := NewFakeBackend()
+	client := &http.Client{Transport: fake}
+	if got := withDial(client, PinnedDialer(nil)); got != client {
+		t.Error("custom transport was replaced")
+	}
+
+	plain := &http.Client{}
+	got := withDial(plain, PinnedDialer(nil))
+	if tr, ok := got.Transport.(*http.Transport); !ok || tr.DialContext == nil || plain.Transport != nil {
+		t.Errorf("default transport not copied with the dialer: %#v", got.Transport)
+	}
+}
@@ -0,0 +1,91 @@
+package novelai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResponseStyle names a standard formatting directive; see
+// Settings.ResponseStyle.
+type ResponseStyle string
+
+// Response styles with default directives.
+const (
+	StyleMarkdown ResponseStyle = "markdown"
+	StylePlain    ResponseStyle = "plain"
+	StyleConcise  ResponseStyle = "concise"
+	StyleDetailed ResponseStyle = "detailed"
+)
+
+// Directives are the instruction snippets a template adds to the system
+// prompt for Settings.ResponseLanguage and Settings.ResponseStyle.
+type Directives struct {
+	// Language is the directive for ResponseLanguage, with %s replaced by
+	// the language.
+	Language string
+	// Styles maps each supported ResponseStyle to its directive. Styles
+	// without a directive are ignored.
+	Styles map[ResponseStyle]string
+	// Format, if set, wraps the directives, with %s replaced by them.
+	Format string
+	// Separator is written between the system prompt and the directives.
+	// If empty, a blank line is used.
+	Separator string
+}
+
+// DefaultDirectives are used by templates without their own Directives.
+var DefaultDirectives = Directives{
+	Language: "Always reply in %s.",
+	Styles: map[ResponseStyle]string{
+		StyleMarkdown: "Format your replies with Markdown.",
+		StylePlain:    "Reply in plain text, without Markdown or other markup.",
+		StyleConcise:  "Keep your replies brief and to the point.",
+		StyleDetailed: "Give thorough, detailed replies.",
+	},
+}
+
+// Render returns the directives for language and style, or "" if there
+// are none.
+func (d *Directives) Render(language string, style ResponseStyle) string {
+	var parts []string
+	if language != "" && d.Language != "" {
+		parts = append(parts, fmt.Sprintf(d.Language, language))
+	}
+	if s := d.Styles[style]; s != "" {
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	text := strings.Join(parts, " ")
+	if d.Format != "" {
+		text = fmt.Sprintf(d.Format, text)
+	}
+	return text
+}
+
+// directives returns the template's Directives, or DefaultDirectives.
+func (t *PromptTemplate) directives() *Directives {
+	if t.Directives != nil {
+		return t.Directives
+	}
+	return &DefaultDirectives
+}
+
+// withDirectives appends the directives for the response language and
+// style in settings to system.
+func (c *Conversation) withDirectives(system string) string {
+	d := c.promptTemplate().directives()
+	text := d.Render(c.Settings.ResponseLanguage, c.Settings.ResponseStyle)
+	if text == "" {
+		return system
+	}
+	if system == "" {
+		return text
+	}
+	sep := d.Separator
+	if sep == "" {
+		sep = "\n\n"
+	}
+	return strings.TrimRight(system, "\n") + sep + text
+}
@@ -0,0 +1,39 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDirectivesRender tests phrasing language and style directives.
+func TestDirectivesRender(t *testing.T) {
+	got := DefaultDirectives.Render("Japanese", StyleMarkdown)
+	if got != "Always reply in Japanese. Format your replies with Markdown." {
+		t.Errorf("Unexpected directives: %q", got)
+	}
+	if got := DefaultDirectives.Render("", "unknown"); got != "" {
+		t.Errorf("Expected no directives, got %q", got)
+	}
+	if got := eratoDirectives.Render("French", StyleMarkdown); got != "{ Write in French. }" {
+		t.Errorf("Unexpected Erato directives: %q", got)
+	}
+}
+
+// TestConversationDirectives tests directives in the system prompt.
+func TestConversationDirectives(t *testing.T) {
+	conv := NewConversation("You are a guide.")
+	conv.Settings.ResponseLanguage = "Japanese"
+	conv.Settings.ResponseStyle = StyleConcise
+	conv.AddMessage("user", "Hello")
+
+	want := "You are a guide.\n\nAlways reply in Japanese. Keep your replies brief and to the point.\n"
+	if prompt := conv.RenderPrompt(); !strings.Contains(prompt, want) {
+		t.Errorf("Expected directives after system prompt, got %q", prompt)
+	}
+
+	conv.ApplyTemplate(&PromptErato)
+	conv.System = "[ Title: The Gull ]"
+	if prompt := conv.RenderPrompt(); !strings.HasPrefix(prompt, "[ Title: The Gull ]\n{ Write in Japanese. }\n") {
+		t.Errorf("Expected Erato directive below header, got %q", prompt)
+	}
+}
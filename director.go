@@ -0,0 +1,184 @@
+package novelai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+)
+
+// DirectorTool is an augment-image request type.
+type DirectorTool string
+
+// Director tools.
+const (
+	DirectorEmotion   DirectorTool = "emotion"
+	DirectorColorize  DirectorTool = "colorize"
+	DirectorLineArt   DirectorTool = "lineart"
+	DirectorSketch    DirectorTool = "sketch"
+	DirectorDeclutter DirectorTool = "declutter"
+	DirectorBGRemoval DirectorTool = "bg-removal"
+)
+
+// MaxDirectorDefry is the largest defry value accepted by the emotion and
+// colorize tools.
+const MaxDirectorDefry = 5
+
+// emotionPromptDivider separates the emotion from the extra prompt.
+const emotionPromptDivider = ";;"
+
+// Emotions accepted by the emotion director tool.
+var Emotions = []string{
+	"neutral", "happy", "sad", "angry", "scared", "surprised", "tired",
+	"excited", "nervous", "thinking", "confused", "shy", "disgusted", "smug",
+	"bored", "laughing", "irritated", "aroused", "embarrassed", "worried",
+	"love", "determined", "hurt", "playful",
+}
+
+// AugmentRequest is a director tool request for /ai/augment-image.
+type AugmentRequest struct {
+	ReqType DirectorTool `json:"req_type"`
+	Width   int          `json:"width"`
+	Height  int          `json:"height"`
+	// Image is the base64 source image.
+	Image string `json:"image"`
+	// Prompt guides the emotion and colorize tools.
+	Prompt string `json:"prompt,omitempty"`
+	// Defry (0-5) weakens the emotion and colorize tools' changes.
+	Defry int `json:"defry,omitempty"`
+}
+
+// ImageSize returns the dimensions of a PNG or JPEG image.
+func ImageSize(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading image size: %w", err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// NewAugmentRequest creates a director tool request for image, reading its
+// size from the image.
+func NewAugmentRequest(tool DirectorTool, data []byte) (*AugmentRequest, error) {
+	width, height, err := ImageSize(data)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := EncodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	return &AugmentRequest{ReqType: tool, Width: width, Height: height, Image: encoded}, nil
+}
+
+// NewEmotionRequest creates a request that changes a character's expression
+// to emotion. prompt optionally adds detail; defry (0-5) weakens the change.
+func NewEmotionRequest(data []byte, emotion, prompt string, defry int) (*AugmentRequest, error) {
+	if !isEmotion(emotion) {
+		return nil, fmt.Errorf("unknown emotion: %s", emotion)
+	}
+	req, err := newPromptedAugmentRequest(DirectorEmotion, data, defry)
+	if err != nil {
+		return nil, err
+	}
+	req.Prompt = emotion + emotionPromptDivider + strings.TrimSpace(prompt)
+	return req, nil
+}
+
+// NewColorizeRequest creates a request that colors a sketch or line art.
+// prompt optionally describes the colors; defry (0-5) weakens the change.
+func NewColorizeRequest(data []byte, prompt string, defry int) (*AugmentRequest, error) {
+	req, err := newPromptedAugmentRequest(DirectorColorize, data, defry)
+	if err != nil {
+		return nil, err
+	}
+	req.Prompt = strings.TrimSpace(prompt)
+	return req, nil
+}
+
+// newPromptedAugmentRequest validates defry and creates the request.
+func newPromptedAugmentRequest(tool DirectorTool, data []byte, defry int) (*AugmentRequest, error) {
+	if defry < 0 || defry > MaxDirectorDefry {
+		return nil, fmt.Errorf("defry %d must be between 0 and %d", defry, MaxDirectorDefry)
+	}
+	req, err := NewAugmentRequest(tool, data)
+	if err != nil {
+		return nil, err
+	}
+	req.Defry = defry
+	return req, nil
+}
+
+// isEmotion reports whether emotion is one of Emotions.
+func isEmotion(emotion string) bool {
+	for _, e := range Emotions {
+		if e == emotion {
+			return true
+		}
+	}
+	return false
+}
+
+// AugmentImage runs a director tool and returns the resulting images, PNG
+// encoded. Background removal returns several images; the other tools one.
+func (c *Client) AugmentImage(ctx context.Context, req *AugmentRequest) ([][]byte, error) {
+	body, err := c.post(ctx, c.imageURL()+"/ai/augment-image", req)
+	if err != nil {
+		return nil, err
+	}
+	return unzipImages(body)
+}
+
+// ChangeEmotion changes a character's expression to emotion.
+func (c *Client) ChangeEmotion(ctx context.Context, data []byte, emotion, prompt string, defry int) ([]byte, error) {
+	req, err := NewEmotionRequest(data, emotion, prompt, defry)
+	if err != nil {
+		return nil, err
+	}
+	return c.augmentOne(ctx, req)
+}
+
+// Colorize colors a sketch or line art.
+func (c *Client) Colorize(ctx context.Context, data []byte, prompt string, defry int) ([]byte, error) {
+	req, err := NewColorizeRequest(data, prompt, defry)
+	if err != nil {
+		return nil, err
+	}
+	return c.augmentOne(ctx, req)
+}
+
+// LineArt converts an image to line art.
+func (c *Client) LineArt(ctx context.Context, data []byte) ([]byte, error) {
+	return c.augmentTool(ctx, DirectorLineArt, data)
+}
+
+// Sketch converts an image to a sketch.
+func (c *Client) Sketch(ctx context.Context, data []byte) ([]byte, error) {
+	return c.augmentTool(ctx, DirectorSketch, data)
+}
+
+// Declutter removes text, speech bubbles and other clutter from an image.
+func (c *Client) Declutter(ctx context.Context, data []byte) ([]byte, error) {
+	return c.augmentTool(ctx, DirectorDeclutter, data)
+}
+
+// augmentTool runs a tool that takes no prompt and returns its first image.
+func (c *Client) augmentTool(ctx context.Context, tool DirectorTool, data []byte) ([]byte, error) {
+	req, err := NewAugmentRequest(tool, data)
+	if err != nil {
+		return nil, err
+	}
+	return c.augmentOne(ctx, req)
+}
+
+// augmentOne runs req and returns its first image.
+func (c *Client) augmentOne(ctx context.Context, req *AugmentRequest) ([]byte, error) {
+	images, err := c.AugmentImage(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return images[0], nil
+}
@@ -0,0 +1,92 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestImageSize tests reading image dimensions.
+func TestImageSize(t *testing.T) {
+	w, h, err := ImageSize(testPNG(t, color.White))
+	if err != nil || w != 4 || h != 4 {
+		t.Errorf("Expected 4x4, got %dx%d (%v)", w, h, err)
+	}
+	if _, _, err := ImageSize([]byte("nope")); err == nil {
+		t.Error("Expected error for non-image data")
+	}
+}
+
+// TestNewEmotionRequest tests the emotion prompt format and validation.
+func TestNewEmotionRequest(t *testing.T) {
+	data := testPNG(t, color.White)
+	req, err := NewEmotionRequest(data, "happy", " big smile ", 2)
+	if err != nil {
+		t.Fatalf("NewEmotionRequest failed: %v", err)
+	}
+	if req.ReqType != DirectorEmotion || req.Prompt != "happy;;big smile" || req.Defry != 2 {
+		t.Errorf("Unexpected request: %+v", req)
+	}
+	if req.Width != 4 || req.Height != 4 {
+		t.Errorf("Expected size 4x4, got %dx%d", req.Width, req.Height)
+	}
+
+	if _, err := NewEmotionRequest(data, "elated", "", 0); err == nil {
+		t.Error("Expected error for unknown emotion")
+	}
+	if _, err := NewColorizeRequest(data, "", MaxDirectorDefry+1); err == nil {
+		t.Error("Expected error for defry out of range")
+	}
+}
+
+// TestDirectorTools tests the tool wrappers against a fake endpoint.
+func TestDirectorTools(t *testing.T) {
+	var got []AugmentRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ai/augment-image" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req AugmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid request body: %v", err)
+		}
+		got = append(got, req)
+		w.Write(zipImages(t, map[string]string{"image_0.png": string(req.ReqType)}))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.ApiToken = "test-token"
+	client.ImageURL = server.URL
+	ctx := context.Background()
+	data := testPNG(t, color.White)
+
+	calls := []struct {
+		tool DirectorTool
+		run  func() ([]byte, error)
+	}{
+		{DirectorEmotion, func() ([]byte, error) { return client.ChangeEmotion(ctx, data, "sad", "", 0) }},
+		{DirectorColorize, func() ([]byte, error) { return client.Colorize(ctx, data, "red hair", 1) }},
+		{DirectorLineArt, func() ([]byte, error) { return client.LineArt(ctx, data) }},
+		{DirectorSketch, func() ([]byte, error) { return client.Sketch(ctx, data) }},
+		{DirectorDeclutter, func() ([]byte, error) { return client.Declutter(ctx, data) }},
+	}
+	for i, call := range calls {
+		out, err := call.run()
+		if err != nil {
+			t.Fatalf("%s failed: %v", call.tool, err)
+		}
+		if string(out) != string(call.tool) {
+			t.Errorf("Expected %s output, got %q", call.tool, out)
+		}
+		if got[i].ReqType != call.tool || got[i].Image == "" {
+			t.Errorf("Unexpected request for %s: %+v", call.tool, got[i])
+		}
+	}
+	if got[1].Prompt != "red hair" || got[1].Defry != 1 {
+		t.Errorf("Unexpected colorize request: %+v", got[1])
+	}
+}
@@ -0,0 +1,120 @@
+package novelai
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// encryptedMagic starts data sealed by Encrypt, identifying the format.
+var encryptedMagic = []byte("NAIENC1\x00")
+
+var (
+	// ErrDecrypt is returned when encrypted data cannot be decrypted,
+	// because the key is wrong or the data was altered.
+	ErrDecrypt = errors.New("error decrypting data: wrong key or corrupted data")
+	// ErrNoKey is returned when reading encrypted data without a key.
+	ErrNoKey = errors.New("data is encrypted but no key was given")
+)
+
+// GenerateKey returns a new random 32-byte key for Encrypt, such as for
+// FileSessionStore.Key. Keep it outside the store it protects.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+	return key, nil
+}
+
+// Encrypt seals data with AES-GCM under key, which must be 16, 24 or 32
+// bytes for AES-128, AES-192 or AES-256. The result holds a format marker
+// and a random nonce, and can only be read back with Decrypt and the same
+// key; any change to it is detected.
+func Encrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(encryptedMagic)+gcm.NonceSize(), len(encryptedMagic)+gcm.NonceSize()+len(data)+gcm.Overhead())
+	copy(out, encryptedMagic)
+	nonce := out[len(encryptedMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return gcm.Seal(out, nonce, data, encryptedMagic), nil
+}
+
+// Decrypt opens data sealed by Encrypt with key. Returns ErrDecrypt if the
+// key is wrong or the data was altered.
+func Decrypt(key, data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("error decrypting data: not encrypted")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], encryptedMagic)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// IsEncrypted reports whether data was sealed by Encrypt.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// newGCM returns an AES-GCM cipher for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return gcm, nil
+}
+
+// MarshalSnapshot encodes s for storage as JSON, encrypted with Encrypt if
+// key is not nil.
+func MarshalSnapshot(s *Snapshot, key []byte) ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling snapshot: %w", err)
+	}
+	if key == nil {
+		return data, nil
+	}
+	return Encrypt(key, data)
+}
+
+// ReadSnapshot decodes a snapshot stored by MarshalSnapshot, decrypting it
+// with key if it is encrypted and migrating it as UnmarshalSnapshot does.
+// Unencrypted snapshots are read even when key is set, so that a store can
+// start encrypting without losing its existing sessions. Returns ErrNoKey
+// for an encrypted snapshot if key is nil.
+func ReadSnapshot(data, key []byte) (*Snapshot, error) {
+	if IsEncrypted(data) {
+		if key == nil {
+			return nil, ErrNoKey
+		}
+		var err error
+		if data, err = Decrypt(key, data); err != nil {
+			return nil, err
+		}
+	}
+	return UnmarshalSnapshot(data)
+}
@@ -0,0 +1,80 @@
+package novelai
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte(`{"system":"secret"}`)
+	sealed, err := Encrypt(key, plain)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if !IsEncrypted(sealed) || bytes.Contains(sealed, []byte("secret")) {
+		t.Errorf("Sealed data is not encrypted: %q", sealed)
+	}
+	if again, _ := Encrypt(key, plain); bytes.Equal(again, sealed) {
+		t.Error("Expected a fresh nonce for each encryption")
+	}
+	opened, err := Decrypt(key, sealed)
+	if err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("Decrypt: got %q, %v", opened, err)
+	}
+
+	other, _ := GenerateKey()
+	if _, err := Decrypt(other, sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Wrong key: got %v, want ErrDecrypt", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := Decrypt(key, sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Altered data: got %v, want ErrDecrypt", err)
+	}
+	if _, err := Encrypt([]byte("short"), plain); err == nil {
+		t.Error("Expected an error for an invalid key")
+	}
+}
+
+func TestFileSessionStoreEncrypted(t *testing.T) {
+	key, _ := GenerateKey()
+	dir := t.TempDir()
+	plainStore := FileSessionStore{Dir: dir}
+	store := FileSessionStore{Dir: dir, Key: key}
+
+	// Sessions saved before encryption was enabled still load
+	conv := NewConversation("private system prompt")
+	conv.Messages = append(conv.Messages, Message{Role: "user", Content: "my secret"})
+	if err := plainStore.Save("old", conv.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Load("old")
+	if err != nil || s.System != "private system prompt" {
+		t.Fatalf("Load of unencrypted session: got %+v, %v", s, err)
+	}
+
+	if err := store.Save("new", conv.Snapshot()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, _ := os.ReadFile(store.path("new"))
+	if !IsEncrypted(data) || bytes.Contains(data, []byte("my secret")) {
+		t.Errorf("Session stored in the clear: %q", data)
+	}
+	s, err = store.Load("new")
+	if err != nil || len(s.Messages) != 1 || s.Messages[0].Content != "my secret" {
+		t.Errorf("Load: got %+v, %v", s, err)
+	}
+
+	if _, err := plainStore.Load("new"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Load without key: got %v, want ErrNoKey", err)
+	}
+	other, _ := GenerateKey()
+	if _, err := (FileSessionStore{Dir: dir, Key: other}).Load("new"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Load with wrong key: got %v, want ErrDecrypt", err)
+	}
+}
@@ -0,0 +1,336 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// EntityKind classifies a tracked entity.
+type EntityKind string
+
+// Entity kinds recognized by EntityTracker.
+const (
+	EntityCharacter EntityKind = "character"
+	EntityPlace     EntityKind = "place"
+	EntityItem      EntityKind = "item"
+)
+
+// Defaults for EntityTracker.
+const (
+	// DefaultFactCategory is the name of the lorebook category holding the
+	// fact sheet.
+	DefaultFactCategory = "Facts"
+	// MaxEntityTokens caps the reply of an extraction request.
+	MaxEntityTokens = 400
+	// MaxContradictionTokens caps the reply of a contradiction check.
+	MaxContradictionTokens = 200
+)
+
+// Entity is a named character, place or item and what is known about it.
+type Entity struct {
+	Kind  EntityKind
+	Name  string
+	Facts []string
+}
+
+// Contradiction is a statement in new text that conflicts with a stored
+// fact.
+type Contradiction struct {
+	// Entity is the name of the entity concerned.
+	Entity string
+	// Fact is the stored fact.
+	Fact string
+	// Statement is the conflicting statement in the new text.
+	Statement string
+}
+
+// EntityInstruction builds the instruction to extract entities and facts
+// from text.
+func EntityInstruction(text string) string {
+	return "List the named characters, places and items in the text below, with short " +
+		"lasting facts about each (appearance, role, relationships, location, ownership). " +
+		"Write one per line as: kind | name | fact; fact; ... where kind is character, " +
+		"place or item. Respond with only the list.\n\nText:\n" + text
+}
+
+// ContradictionInstruction builds the instruction to check text against a
+// fact sheet.
+func ContradictionInstruction(facts, text string) string {
+	return "Here are established facts about a story:\n" + facts +
+		"\n\nList each statement in the new text below that contradicts a fact, one per " +
+		"line as: name | fact | statement. If nothing contradicts the facts, respond with " +
+		"only NONE.\n\nNew text:\n" + text
+}
+
+// ParseEntities reads an extraction reply written as EntityInstruction
+// asks. Lines of unknown kinds or without a name are skipped, and entities
+// named more than once are merged.
+func ParseEntities(reply string) []Entity {
+	var entities []Entity
+	for _, line := range strings.Split(reply, "\n") {
+		fields := splitFields(line, 3)
+		if len(fields) < 2 || fields[1] == "" {
+			continue
+		}
+		kind := EntityKind(strings.ToLower(fields[0]))
+		if kind != EntityCharacter && kind != EntityPlace && kind != EntityItem {
+			continue
+		}
+		e := Entity{Kind: kind, Name: fields[1]}
+		if len(fields) == 3 {
+			for _, fact := range strings.Split(fields[2], ";") {
+				e.Facts = addFact(e.Facts, fact)
+			}
+		}
+		entities = mergeEntity(entities, e)
+	}
+	return entities
+}
+
+// ParseContradictions reads a contradiction reply written as
+// ContradictionInstruction asks.
+func ParseContradictions(reply string) []Contradiction {
+	var found []Contradiction
+	for _, line := range strings.Split(reply, "\n") {
+		fields := splitFields(line, 3)
+		if len(fields) == 3 && fields[0] != "" && fields[2] != "" {
+			found = append(found, Contradiction{Entity: fields[0], Fact: fields[1], Statement: fields[2]})
+		}
+	}
+	return found
+}
+
+// splitFields splits a "a | b | c" line into at most n trimmed fields,
+// ignoring list markers.
+func splitFields(line string, n int) []string {
+	line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))
+	if line == "" {
+		return nil
+	}
+	fields := strings.SplitN(line, "|", n)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// addFact adds fact to facts unless it is empty or already present,
+// ignoring case.
+func addFact(facts []string, fact string) []string {
+	fact = strings.TrimSpace(fact)
+	if fact == "" || containsFold(facts, fact) {
+		return facts
+	}
+	return append(facts, fact)
+}
+
+// mergeEntity adds e to entities, merging its facts into an entity of the
+// same name.
+func mergeEntity(entities []Entity, e Entity) []Entity {
+	for i := range entities {
+		if strings.EqualFold(entities[i].Name, e.Name) {
+			for _, fact := range e.Facts {
+				entities[i].Facts = addFact(entities[i].Facts, fact)
+			}
+			return entities
+		}
+	}
+	return append(entities, e)
+}
+
+// EntityTracker keeps a fact sheet of the characters, places and items in
+// a story as lorebook entries in one category, so the facts are activated
+// into context like any other lore. New text is read with the model to
+// extract entities and to flag statements contradicting the sheet.
+//
+// Requests use the conversation's system prompt and settings without its
+// history; their usage is added to it.
+type EntityTracker struct {
+	// Conversation makes the extraction and checking requests.
+	Conversation *Conversation
+	// Lorebook holds the fact sheet.
+	Lorebook *Lorebook
+	// CategoryName names the fact sheet's category, created on first use.
+	// If empty, DefaultFactCategory is used.
+	CategoryName string
+}
+
+// NewEntityTracker creates a tracker keeping its facts in lb.
+func NewEntityTracker(c *Conversation, lb *Lorebook) *EntityTracker {
+	return &EntityTracker{Conversation: c, Lorebook: lb}
+}
+
+// Extract asks the model for the entities in text and their facts.
+func (t *EntityTracker) Extract(ctx context.Context, text string) ([]Entity, error) {
+	reply, err := t.Conversation.sideRequest(ctx, EntityInstruction(text),
+		SamplingProfile{MaxTokens: Int(MaxEntityTokens), Temperature: Float64(0)})
+	if err != nil {
+		return nil, fmt.Errorf("error extracting entities: %w", err)
+	}
+	return ParseEntities(reply), nil
+}
+
+// Check asks the model whether text contradicts the facts of the entities
+// it mentions. Returns nil without a request if it mentions none.
+func (t *EntityTracker) Check(ctx context.Context, text string) ([]Contradiction, error) {
+	var sheet strings.Builder
+	for _, e := range t.mentioned(text) {
+		for _, fact := range e.Facts {
+			fmt.Fprintf(&sheet, "%s | %s\n", e.Name, fact)
+		}
+	}
+	if sheet.Len() == 0 {
+		return nil, nil
+	}
+	reply, err := t.Conversation.sideRequest(ctx, ContradictionInstruction(sheet.String(), text),
+		SamplingProfile{MaxTokens: Int(MaxContradictionTokens), Temperature: Float64(0)})
+	if err != nil {
+		return nil, fmt.Errorf("error checking facts: %w", err)
+	}
+	return ParseContradictions(reply), nil
+}
+
+// Update checks text against the fact sheet, then records the entities
+// extracted from it, and returns the contradictions found.
+func (t *EntityTracker) Update(ctx context.Context, text string) ([]Contradiction, error) {
+	contradictions, err := t.Check(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	entities, err := t.Extract(ctx, text)
+	if err != nil {
+		return contradictions, err
+	}
+	return contradictions, t.Record(entities)
+}
+
+// Record adds entities to the fact sheet, merging new facts into the
+// entries of known entities.
+func (t *EntityTracker) Record(entities []Entity) error {
+	category := t.category()
+	for _, e := range entities {
+		if entry := t.entry(e.Name); entry != nil {
+			known := entityFromEntry(*entry)
+			for _, fact := range e.Facts {
+				known.Facts = addFact(known.Facts, fact)
+			}
+			err := t.Lorebook.UpdateEntry(entry.ID, func(entry *LorebookEntry) {
+				entry.Text = formatEntity(known)
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		entry := NewLorebookEntry(e.Name, formatEntity(e), e.Name)
+		entry.Category = category
+		if _, err := t.Lorebook.AddEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entities returns the fact sheet.
+func (t *EntityTracker) Entities() []Entity {
+	var entities []Entity
+	for _, entry := range t.entries() {
+		entities = append(entities, entityFromEntry(*entry))
+	}
+	return entities
+}
+
+// mentioned returns the tracked entities whose keys appear in text.
+func (t *EntityTracker) mentioned(text string) []Entity {
+	var found []Entity
+	for _, entry := range t.entries() {
+		e := *entry
+		e.SearchRange = len(text)
+		if _, _, ok := matchEntryKeys(e, text); ok {
+			found = append(found, entityFromEntry(e))
+		}
+	}
+	return found
+}
+
+// entry returns the fact sheet entry for name, or nil.
+func (t *EntityTracker) entry(name string) *LorebookEntry {
+	for _, entry := range t.entries() {
+		if strings.EqualFold(entry.DisplayName, name) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// entries returns the entries in the fact sheet's category.
+func (t *EntityTracker) entries() []*LorebookEntry {
+	id := t.categoryID()
+	if id == "" {
+		return nil
+	}
+	var entries []*LorebookEntry
+	for i := range t.Lorebook.Entries {
+		if t.Lorebook.Entries[i].Category == id {
+			entries = append(entries, &t.Lorebook.Entries[i])
+		}
+	}
+	return entries
+}
+
+// categoryID returns the ID of the fact sheet's category, or "" if it
+// does not exist yet.
+func (t *EntityTracker) categoryID() string {
+	name := t.CategoryName
+	if name == "" {
+		name = DefaultFactCategory
+	}
+	for _, cat := range t.Lorebook.Categories {
+		if cat.Name == name {
+			return cat.ID
+		}
+	}
+	return ""
+}
+
+// category returns the ID of the fact sheet's category, creating it if
+// needed.
+func (t *EntityTracker) category() string {
+	if id := t.categoryID(); id != "" {
+		return id
+	}
+	name := t.CategoryName
+	if name == "" {
+		name = DefaultFactCategory
+	}
+	return t.Lorebook.AddCategory(name)
+}
+
+// formatEntity renders an entity as fact sheet entry text: a
+// "Name (kind)" line followed by one "- fact" line per fact.
+func formatEntity(e Entity) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)", e.Name, e.Kind)
+	for _, fact := range e.Facts {
+		b.WriteString("\n- " + fact)
+	}
+	return b.String()
+}
+
+// entityFromEntry parses a fact sheet entry written by formatEntity.
+// Lines not in that format are kept as facts.
+func entityFromEntry(entry LorebookEntry) Entity {
+	e := Entity{Name: entry.DisplayName}
+	lines := strings.Split(entry.Text, "\n")
+	if header := strings.TrimSpace(lines[0]); strings.HasSuffix(header, ")") {
+		if i := strings.LastIndex(header, " ("); i >= 0 {
+			e.Kind = EntityKind(header[i+2 : len(header)-1])
+			lines = lines[1:]
+		}
+	}
+	for _, line := range lines {
+		e.Facts = addFact(e.Facts, strings.TrimPrefix(strings.TrimSpace(line), "- "))
+	}
+	return e
+}
@@ -0,0 +1,81 @@
+package novelai
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseEntities(t *testing.T) {
+	reply := "character | Mara | captain of the Gull; has a scar\n" +
+		"- place | Port Ash | a foggy harbor\n" +
+		"creature | Kraken | huge\n" +
+		"character | mara | Has a scar; fears the sea\n" +
+		"not a line"
+	got := ParseEntities(reply)
+	if len(got) != 2 {
+		t.Fatalf("Expected two entities, got %+v", got)
+	}
+	mara := got[0]
+	if mara.Kind != EntityCharacter || mara.Name != "Mara" || len(mara.Facts) != 3 || mara.Facts[2] != "fears the sea" {
+		t.Errorf("Unexpected merged entity: %+v", mara)
+	}
+	if got[1].Kind != EntityPlace || got[1].Name != "Port Ash" {
+		t.Errorf("Unexpected place: %+v", got[1])
+	}
+}
+
+func TestParseContradictions(t *testing.T) {
+	got := ParseContradictions("Mara | has a scar on her left hand | Her right hand bore the scar.\n")
+	if len(got) != 1 || got[0].Entity != "Mara" || got[0].Statement != "Her right hand bore the scar." {
+		t.Errorf("Unexpected contradictions: %+v", got)
+	}
+	if got := ParseContradictions("NONE"); got != nil {
+		t.Errorf("Expected none, got %+v", got)
+	}
+}
+
+func TestEntityTracker(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().
+		On(`List the named characters`,
+			FakeResponse{Text: "character | Mara | captain of the Gull; scar on her left hand"},
+			FakeResponse{Text: "character | Mara | sails at dawn\nplace | Port Ash | foggy"}).
+		On(`contradicts a fact`, FakeResponse{Text: "Mara | scar on her left hand | The scar on her right hand ached."})
+	fake.Install(conv)
+	lb := &Lorebook{}
+	tracker := NewEntityTracker(conv, lb)
+	ctx := context.Background()
+
+	// Nothing is known yet, so nothing is checked
+	found, err := tracker.Update(ctx, "Mara, captain of the Gull, rubbed the scar on her left hand.")
+	if err != nil || found != nil {
+		t.Fatalf("Update() = %+v, %v", found, err)
+	}
+	if len(fake.Requests()) != 1 {
+		t.Errorf("Expected only an extraction request, got %d requests", len(fake.Requests()))
+	}
+	if len(lb.Categories) != 1 || lb.Categories[0].Name != DefaultFactCategory {
+		t.Fatalf("Expected the fact category, got %+v", lb.Categories)
+	}
+
+	found, err = tracker.Update(ctx, "At dawn Mara sailed from Port Ash. The scar on her right hand ached.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Fact != "scar on her left hand" {
+		t.Errorf("Expected the scar contradiction, got %+v", found)
+	}
+
+	entities := tracker.Entities()
+	if len(entities) != 2 || len(lb.Entries) != 2 {
+		t.Fatalf("Expected Mara and Port Ash, got %+v", entities)
+	}
+	mara := entities[0]
+	if mara.Kind != EntityCharacter || len(mara.Facts) != 3 || mara.Facts[2] != "sails at dawn" {
+		t.Errorf("Expected Mara's facts merged, got %+v", mara)
+	}
+	want := "Mara (character)\n- captain of the Gull\n- scar on her left hand\n- sails at dawn"
+	if lb.Entries[0].Text != want || lb.Entries[0].Keys[0] != "Mara" {
+		t.Errorf("Unexpected entry: %q keys %v", lb.Entries[0].Text, lb.Entries[0].Keys)
+	}
+}
@@ -0,0 +1,249 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Scene break markers.
+const (
+	// Dinkus marks a scene break in NovelAI stories.
+	Dinkus = "***"
+	// Asterism is an alternative scene break marker, normalized to Dinkus.
+	Asterism = "⁂"
+)
+
+// PromptErato lays out a Conversation for Llama 3 Erato, which continues
+// prose rather than chatting: the system prompt is the story header (see
+// ATTG), user messages become instruct blocks, and assistant messages are
+// story text. Generation stops when the model starts a new instruct block.
+// The user persona is written as a memory line below the header.
+var PromptErato = PromptTemplate{
+	Name:          "erato",
+	UserHeader:    "{ ",
+	UserEnd:       " }\n",
+	MessageEnd:    "\n",
+	Think:         ThinkFormatNone,
+	StopSequences: []string{"\n{", "<|endoftext|>"},
+	SceneBreak:    Dinkus,
+	Persona:       PersonaInMemory,
+	Directives:    &eratoDirectives,
+}
+
+// eratoDirectives ask for the response language in an instruct block;
+// chat formatting styles don't apply to prose.
+var eratoDirectives = Directives{
+	Language:  "Write in %s.",
+	Format:    "{ %s }",
+	Separator: "\n",
+}
+
+// ATTG is the Author, Title, Tags, Genre header NovelAI's story models are
+// trained to read at the top of the context.
+type ATTG struct {
+	Author string
+	Title  string
+	Tags   []string
+	Genre  []string
+}
+
+// String formats the header as "[ Author: x; Title: y; Tags: a, b; Genre: c ]",
+// omitting empty fields. Returns "" if all fields are empty.
+func (a ATTG) String() string {
+	var parts []string
+	if a.Author != "" {
+		parts = append(parts, "Author: "+a.Author)
+	}
+	if a.Title != "" {
+		parts = append(parts, "Title: "+a.Title)
+	}
+	if len(a.Tags) > 0 {
+		parts = append(parts, "Tags: "+strings.Join(a.Tags, ", "))
+	}
+	if len(a.Genre) > 0 {
+		parts = append(parts, "Genre: "+strings.Join(a.Genre, ", "))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[ " + strings.Join(parts, "; ") + " ]"
+}
+
+// ParseATTG parses a header line produced by ATTG.String. Unknown fields
+// are ignored. Returns false if line is not a bracketed header.
+func ParseATTG(line string) (ATTG, bool) {
+	var a ATTG
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return a, false
+	}
+	found := false
+	for _, part := range strings.Split(strings.Trim(line, "[] "), ";") {
+		key, value, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Author":
+			a.Author, found = value, true
+		case "Title":
+			a.Title, found = value, true
+		case "Tags":
+			a.Tags, found = splitList(value), true
+		case "Genre":
+			a.Genre, found = splitList(value), true
+		}
+	}
+	return a, found
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// FormatInstruct wraps an instruction in an instruct block: "{ text }".
+func FormatInstruct(text string) string {
+	text = strings.Trim(strings.TrimSpace(text), "{}")
+	return "{ " + strings.TrimSpace(text) + " }"
+}
+
+// IsSceneBreak reports whether line is a scene break: a dinkus ("***",
+// "* * *"), an asterism ("⁂"), or a run of them.
+func IsSceneBreak(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+	stars := 0
+	for _, r := range line {
+		switch r {
+		case '*':
+			stars++
+		case '⁂':
+			stars += 3
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return stars >= 3
+}
+
+// NormalizeSceneBreaks replaces every scene break line in text with marker.
+func NormalizeSceneBreaks(text, marker string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if IsSceneBreak(line) {
+			lines[i] = marker
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// StorySession writes a story with a story model, formatting the context
+// the way Erato expects: the ATTG header and style tag, then memory, then the story,
+// with instructions as instruct blocks and normalized scene breaks.
+type StorySession struct {
+	// Header is written at the top of the context.
+	Header ATTG
+	// Style, if set, is written as a style tag after the header.
+	Style []string
+	// Memory is written after the header.
+	Memory string
+	// Story is the story text so far.
+	Story string
+	// Generator continues the formatted context.
+	Generator StoryGenerator
+
+	// instruction is the pending one-shot instruction, see InsertInstruction.
+	instruction string
+}
+
+// NewStorySession starts a story session with header and opening text.
+func NewStorySession(header ATTG, story string, gen StoryGenerator) *StorySession {
+	return &StorySession{Header: header, Story: story, Generator: gen}
+}
+
+// Context returns the formatted text sent to the generator.
+func (s *StorySession) Context() string {
+	var parts []string
+	if h := s.Header.String(); h != "" {
+		parts = append(parts, h)
+	}
+	if st := FormatStyle(s.Style...); st != "" {
+		parts = append(parts, st)
+	}
+	if m := strings.TrimSpace(s.Memory); m != "" {
+		parts = append(parts, m)
+	}
+	if s.Story != "" {
+		parts = append(parts, NormalizeSceneBreaks(s.Story, Dinkus))
+	}
+	if s.instruction != "" {
+		parts = append(parts, FormatInstruct(s.instruction)+"\n")
+	}
+	return strings.Join(parts, "\n")
+}
+
+// InsertInstruction places an instruct block at the end of the context for
+// the next generation only. Unlike Instruct, the instruction is not kept in
+// Story, and the text generated after it starts on a new line. Inserting
+// again replaces the pending instruction; an empty text clears it.
+func (s *StorySession) InsertInstruction(text string) {
+	s.instruction = strings.TrimSpace(text)
+}
+
+// PendingInstruction returns the instruction set by InsertInstruction that
+// the next generation will see, if any.
+func (s *StorySession) PendingInstruction() string {
+	return s.instruction
+}
+
+// Continue generates more story and appends it, consuming any pending
+// instruction. If generation fails, Story and the pending instruction are
+// left unchanged.
+func (s *StorySession) Continue(ctx context.Context) (string, error) {
+	generated, err := s.Generator.ContinueStory(ctx, s.Context())
+	if err != nil {
+		return "", fmt.Errorf("error continuing story: %w", err)
+	}
+	// Stop where the model starts writing its own instruct block
+	if i := strings.Index(generated, "\n{"); i >= 0 {
+		generated = generated[:i]
+	}
+	if s.instruction != "" {
+		s.instruction = ""
+		if s.Story != "" && !strings.HasSuffix(s.Story, "\n") {
+			s.Story += "\n"
+		}
+	}
+	s.Story += generated
+	return generated, nil
+}
+
+// Instruct adds an instruct block to the story and generates the text that
+// follows it. If generation fails, Story is left unchanged.
+func (s *StorySession) Instruct(ctx context.Context, instruction string) (string, error) {
+	story := s.Story
+	s.Story = appendLine(story, FormatInstruct(instruction)) + "\n"
+	generated, err := s.Continue(ctx)
+	if err != nil {
+		s.Story = story
+		return "", err
+	}
+	return generated, nil
+}
+
+// SceneBreak ends the current scene with a dinkus.
+func (s *StorySession) SceneBreak() {
+	s.Story = appendLine(s.Story, Dinkus) + "\n"
+}
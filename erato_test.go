@@ -0,0 +1,172 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestATTG tests formatting and parsing the story header.
+func TestATTG(t *testing.T) {
+	a := ATTG{Author: "Jane Doe", Title: "The Gull", Tags: []string{"sea", "mystery"}, Genre: []string{"Fantasy"}}
+	want := "[ Author: Jane Doe; Title: The Gull; Tags: sea, mystery; Genre: Fantasy ]"
+	if got := a.String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := (ATTG{Title: "Only"}).String(); got != "[ Title: Only ]" {
+		t.Errorf("Unexpected header: %q", got)
+	}
+	if (ATTG{}).String() != "" {
+		t.Error("Expected empty header for empty ATTG")
+	}
+
+	parsed, ok := ParseATTG(want)
+	if !ok || parsed.Author != "Jane Doe" || parsed.Title != "The Gull" ||
+		len(parsed.Tags) != 2 || parsed.Genre[0] != "Fantasy" {
+		t.Errorf("Unexpected parse: %+v (%v)", parsed, ok)
+	}
+	if _, ok := ParseATTG("Just a line"); ok {
+		t.Error("Expected non-header to fail")
+	}
+	if _, ok := ParseATTG("[ Knowledge: none ]"); ok {
+		t.Error("Expected header without ATTG fields to fail")
+	}
+}
+
+// TestSceneBreaks tests dinkus and asterism handling.
+func TestSceneBreaks(t *testing.T) {
+	for _, line := range []string{"***", " * * * ", "⁂", "*****"} {
+		if !IsSceneBreak(line) {
+			t.Errorf("Expected %q to be a scene break", line)
+		}
+	}
+	for _, line := range []string{"", "**", "*bold*", "* item"} {
+		if IsSceneBreak(line) {
+			t.Errorf("Expected %q not to be a scene break", line)
+		}
+	}
+	got := NormalizeSceneBreaks("End.\n⁂\nStart.\n* * *\n", Dinkus)
+	if got != "End.\n***\nStart.\n***\n" {
+		t.Errorf("Unexpected normalized text: %q", got)
+	}
+}
+
+// TestPromptEratoRender tests the Erato conversation layout.
+func TestPromptEratoRender(t *testing.T) {
+	header := ATTG{Title: "The Gull", Genre: []string{"Fantasy"}}.String()
+	messages := []Message{
+		{Role: "user", Content: "Describe the harbor."},
+		{Role: "assistant", Content: "Fog rolled in.\n⁂\nMorning came."},
+		{Role: "user", Content: "Introduce the ferryman."},
+	}
+	got := PromptErato.Render(header, messages, false, &PromptErato.Think)
+	want := "[ Title: The Gull; Genre: Fantasy ]\n" +
+		"{ Describe the harbor. }\n" +
+		"Fog rolled in.\n***\nMorning came.\n" +
+		"{ Introduce the ferryman. }\n"
+	if got != want {
+		t.Errorf("Unexpected prompt:\n got %q\nwant %q", got, want)
+	}
+
+	conv := NewConversation(header)
+	if err := conv.UseModel(ModelErato); err != nil {
+		t.Fatalf("UseModel failed: %v", err)
+	}
+	if conv.promptTemplate() != &PromptErato || conv.Settings.StopSequences[0] != "\n{" {
+		t.Errorf("Expected Erato template and stops, got %+v", conv.Settings)
+	}
+}
+
+// TestFormatInstruct tests instruct block formatting.
+func TestFormatInstruct(t *testing.T) {
+	for _, in := range []string{"Add a storm", " { Add a storm } ", "{Add a storm}"} {
+		if got := FormatInstruct(in); got != "{ Add a storm }" {
+			t.Errorf("FormatInstruct(%q): got %q", in, got)
+		}
+	}
+}
+
+// TestStorySession tests context formatting, instructions and scene breaks.
+func TestStorySession(t *testing.T) {
+	var contexts []string
+	gen := StoryGeneratorFunc(func(ctx context.Context, story string) (string, error) {
+		contexts = append(contexts, story)
+		return " The ferryman waved.\n{ next", nil
+	})
+	s := NewStorySession(ATTG{Title: "The Gull"}, "Fog rolled in.", gen)
+	s.Memory = "Mara is a sailor."
+
+	if _, err := s.Continue(context.Background()); err != nil {
+		t.Fatalf("Continue failed: %v", err)
+	}
+	if contexts[0] != "[ Title: The Gull ]\nMara is a sailor.\nFog rolled in." {
+		t.Errorf("Unexpected context: %q", contexts[0])
+	}
+	if s.Story != "Fog rolled in. The ferryman waved." {
+		t.Errorf("Expected generation cut at instruct block, got %q", s.Story)
+	}
+
+	s.SceneBreak()
+	if _, err := s.Instruct(context.Background(), "Morning comes"); err != nil {
+		t.Fatalf("Instruct failed: %v", err)
+	}
+	if !strings.Contains(contexts[1], "waved.\n***\n{ Morning comes }\n") {
+		t.Errorf("Expected scene break and instruct block in context, got %q", contexts[1])
+	}
+
+	before := s.Story
+	s.Generator = StoryGeneratorFunc(func(ctx context.Context, story string) (string, error) {
+		return "", errors.New("boom")
+	})
+	if _, err := s.Instruct(context.Background(), "Fail"); err == nil {
+		t.Error("Expected error from generator")
+	}
+	if s.Story != before {
+		t.Errorf("Expected story unchanged on error, got %q", s.Story)
+	}
+}
+
+// TestStorySessionInsertInstruction tests one-shot instructions.
+func TestStorySessionInsertInstruction(t *testing.T) {
+	var contexts []string
+	fail := false
+	gen := StoryGeneratorFunc(func(ctx context.Context, story string) (string, error) {
+		contexts = append(contexts, story)
+		if fail {
+			return "", errors.New("boom")
+		}
+		return "Thunder rolled.", nil
+	})
+	s := NewStorySession(ATTG{}, "Fog rolled in.", gen)
+	s.InsertInstruction(" a storm arrives ")
+
+	fail = true
+	if _, err := s.Continue(context.Background()); err == nil {
+		t.Fatal("Expected error from generator")
+	}
+	if s.PendingInstruction() != "a storm arrives" {
+		t.Errorf("Expected instruction kept after failure, got %q", s.PendingInstruction())
+	}
+
+	fail = false
+	if _, err := s.Continue(context.Background()); err != nil {
+		t.Fatalf("Continue failed: %v", err)
+	}
+	if contexts[1] != "Fog rolled in.\n{ a storm arrives }\n" {
+		t.Errorf("Expected instruction at end of context, got %q", contexts[1])
+	}
+	if s.Story != "Fog rolled in.\nThunder rolled." {
+		t.Errorf("Expected instruction left out of story, got %q", s.Story)
+	}
+	if s.PendingInstruction() != "" {
+		t.Error("Expected instruction consumed")
+	}
+
+	if _, err := s.Continue(context.Background()); err != nil {
+		t.Fatalf("Continue failed: %v", err)
+	}
+	if strings.Contains(contexts[2], "{") {
+		t.Errorf("Expected no instruction in later context, got %q", contexts[2])
+	}
+}
@@ -0,0 +1,345 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExperimentVariant is one system prompt and settings combination tried by
+// an Experiment.
+type ExperimentVariant struct {
+	// Name identifies the variant in the report, and should be unique.
+	Name string
+	// System, if set, replaces the conversation's system prompt.
+	System string
+	// Settings, if set, replace the conversation's settings.
+	Settings *Settings
+	// Overrides are applied on top of the settings, as in SendWith.
+	Overrides SamplingProfile
+}
+
+// JudgeFunc scores a reply to prompt, higher being better, with a reason.
+type JudgeFunc func(ctx context.Context, prompt, reply string) (score float64, reason string, err error)
+
+// ExperimentResult is the outcome of one run of a variant.
+type ExperimentResult struct {
+	Variant string
+	// Run numbers the runs of a variant from 0.
+	Run          int
+	Reply        string
+	StopReason   string
+	InputTokens  int
+	OutputTokens int
+	Latency      time.Duration
+	// Fingerprint identifies the generation inputs of the run's first
+	// request; see PromptFingerprint. Runs with equal fingerprints differ
+	// only by sampling.
+	Fingerprint string
+	// Err is set if the reply failed; the run is then not judged.
+	Err error
+	// Score and Reason are the judge's verdict. Scored is false if there
+	// is no judge, or it failed with JudgeErr.
+	Score    float64
+	Reason   string
+	Scored   bool
+	JudgeErr error
+}
+
+// VariantSummary aggregates the results of a variant.
+type VariantSummary struct {
+	Variant string
+	Runs    int
+	Errors  int
+	// Scored is the number of runs the judge scored, and MeanScore,
+	// MinScore and MaxScore their statistics.
+	Scored    int
+	MeanScore float64
+	MinScore  float64
+	MaxScore  float64
+	// MeanOutputTokens and MeanLatency are over the successful runs.
+	MeanOutputTokens float64
+	MeanLatency      time.Duration
+}
+
+// ExperimentReport holds the results of an Experiment.
+type ExperimentReport struct {
+	// Results are ordered by variant, then run.
+	Results []ExperimentResult
+	// Summaries are in the order of the variants.
+	Summaries []VariantSummary
+}
+
+// Experiment runs the same conversation seed, a history and a prompt,
+// through several variants and compares the replies, for A/B testing
+// prompts and settings.
+type Experiment struct {
+	// Conversation supplies the seed history, the endpoint, API token and
+	// template, and the system prompt and settings of variants that do not
+	// set their own. It is charged the usage of the runs; its history is
+	// not changed.
+	Conversation *Conversation
+	// Prompt is the user message each run replies to.
+	Prompt string
+	// Variants are the combinations tried.
+	Variants []ExperimentVariant
+	// Runs is how many replies are generated per variant. If zero, one.
+	Runs int
+	// Parallel is how many runs are in flight at once. If zero, one.
+	Parallel int
+	// Interval, if set, is the least time between the starts of two
+	// requests, to stay within rate limits. Conversation.Queue, if set,
+	// also applies.
+	Interval time.Duration
+	// Judge, if set, scores each reply. It is never called concurrently.
+	Judge JudgeFunc
+
+	mu   sync.Mutex
+	next time.Time
+	// shared serializes the runs' use of Conversation: copying it,
+	// charging it usage and judging, as judges usually send side requests
+	// from it.
+	shared sync.Mutex
+}
+
+// Run runs every variant Runs times and returns the report. Failed runs
+// are recorded in the report rather than returned. If ctx is cancelled,
+// the runs not yet started are dropped and the report of the others is
+// returned with the context's error.
+func (e *Experiment) Run(ctx context.Context) (*ExperimentReport, error) {
+	if e.Conversation == nil {
+		return nil, fmt.Errorf("experiment has no conversation")
+	}
+	if len(e.Variants) == 0 {
+		return nil, fmt.Errorf("experiment has no variants")
+	}
+	runs := max(e.Runs, 1)
+	results := make([]ExperimentResult, len(e.Variants)*runs)
+	started := make([]bool, len(results))
+	sem := make(chan struct{}, max(e.Parallel, 1))
+	var wg sync.WaitGroup
+	for i := range results {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil || e.wait(ctx) != nil {
+			break
+		}
+		started[i] = true
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			results[i] = e.run(ctx, e.Variants[i/runs], i%runs)
+		}(i)
+	}
+	wg.Wait()
+
+	report := &ExperimentReport{}
+	for i, r := range results {
+		if started[i] {
+			report.Results = append(report.Results, r)
+		}
+	}
+	for _, v := range e.Variants {
+		report.Summaries = append(report.Summaries, summarizeVariant(v.Name, report.Results))
+	}
+	return report, ctx.Err()
+}
+
+// wait blocks until Interval has passed since the last request started.
+func (e *Experiment) wait(ctx context.Context) error {
+	if e.Interval <= 0 {
+		return nil
+	}
+	clock := clockOr(e.Conversation.Clock)
+	e.mu.Lock()
+	now := clock.Now()
+	at := e.next
+	if at.Before(now) {
+		at = now
+	}
+	e.next = at.Add(e.Interval)
+	e.mu.Unlock()
+	return clock.Sleep(ctx, at.Sub(now))
+}
+
+// run generates and judges one reply of variant v.
+func (e *Experiment) run(ctx context.Context, v ExperimentVariant, run int) ExperimentResult {
+	src := e.Conversation
+	e.shared.Lock()
+	conv := *src
+	e.shared.Unlock()
+	conv.Ctx = ctx
+	if v.System != "" {
+		conv.System = v.System
+	}
+	if v.Settings != nil {
+		conv.Settings = v.Settings.Clone()
+	}
+	conv.Messages = copyMessages(src.Messages)
+	conv.ToolResults = nil
+	conv.Usage = Usage{}
+	conv.Turns = nil
+	conv.Classifier = nil
+	conv.Translator = nil
+	conv.ThinkingRetention = nil
+	conv.SafetyClassifier = nil
+
+	r := ExperimentResult{Variant: v.Name, Run: run}
+	start := time.Now()
+	r.Reply, r.StopReason, r.InputTokens, r.OutputTokens, _, _, r.Err = conv.SendWith(e.Prompt, v.Overrides)
+	r.Latency = time.Since(start)
+	if len(conv.Turns) > 0 {
+		r.Fingerprint = conv.Turns[0].Fingerprint
+	}
+	e.shared.Lock()
+	defer e.shared.Unlock()
+	src.Usage.InputTokens += conv.Usage.InputTokens
+	src.Usage.OutputTokens += conv.Usage.OutputTokens
+	if r.Err != nil || e.Judge == nil {
+		return r
+	}
+	r.Score, r.Reason, r.JudgeErr = e.Judge(ctx, e.Prompt, r.Reply)
+	r.Scored = r.JudgeErr == nil
+	return r
+}
+
+// summarizeVariant aggregates the results of the named variant.
+func summarizeVariant(name string, results []ExperimentResult) VariantSummary {
+	s := VariantSummary{Variant: name}
+	var score float64
+	var tokens int
+	var latency time.Duration
+	for _, r := range results {
+		if r.Variant != name {
+			continue
+		}
+		s.Runs++
+		if r.Err != nil {
+			s.Errors++
+			continue
+		}
+		tokens += r.OutputTokens
+		latency += r.Latency
+		if !r.Scored {
+			continue
+		}
+		if s.Scored == 0 || r.Score < s.MinScore {
+			s.MinScore = r.Score
+		}
+		if s.Scored == 0 || r.Score > s.MaxScore {
+			s.MaxScore = r.Score
+		}
+		s.Scored++
+		score += r.Score
+	}
+	if s.Scored > 0 {
+		s.MeanScore = score / float64(s.Scored)
+	}
+	if ok := s.Runs - s.Errors; ok > 0 {
+		s.MeanOutputTokens = float64(tokens) / float64(ok)
+		s.MeanLatency = latency / time.Duration(ok)
+	}
+	return s
+}
+
+// Ranked returns the summaries by mean score, best first. Variants with no
+// scored runs come last.
+func (r *ExperimentReport) Ranked() []VariantSummary {
+	ranked := append([]VariantSummary(nil), r.Summaries...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if (a.Scored > 0) != (b.Scored > 0) {
+			return a.Scored > 0
+		}
+		return a.MeanScore > b.MeanScore
+	})
+	return ranked
+}
+
+// Markdown renders the report as a Markdown comparison table of the
+// variants, best first, followed by the replies of each run.
+func (r *ExperimentReport) Markdown() string {
+	var b strings.Builder
+	b.WriteString("| Variant | Runs | Errors | Mean score | Min | Max | Output tokens | Latency |\n")
+	b.WriteString("|---|---|---|---|---|---|---|---|\n")
+	for _, s := range r.Ranked() {
+		mean, lo, hi := "-", "-", "-"
+		if s.Scored > 0 {
+			mean = strconv.FormatFloat(s.MeanScore, 'f', 2, 64)
+			lo = strconv.FormatFloat(s.MinScore, 'f', 2, 64)
+			hi = strconv.FormatFloat(s.MaxScore, 'f', 2, 64)
+		}
+		fmt.Fprintf(&b, "| %s | %d | %d | %s | %s | %s | %.0f | %s |\n", s.Variant, s.Runs, s.Errors,
+			mean, lo, hi, s.MeanOutputTokens, s.MeanLatency.Round(time.Millisecond))
+	}
+	for _, res := range r.Results {
+		fmt.Fprintf(&b, "\n### %s, run %d\n\n", res.Variant, res.Run+1)
+		switch {
+		case res.Err != nil:
+			fmt.Fprintf(&b, "Error: %v\n", res.Err)
+			continue
+		case res.Scored:
+			fmt.Fprintf(&b, "Score: %g. %s\n\n", res.Score, res.Reason)
+		case res.JudgeErr != nil:
+			fmt.Fprintf(&b, "Judge error: %v\n\n", res.JudgeErr)
+		}
+		writeFenced(&b, res.Reply)
+	}
+	return b.String()
+}
+
+// ScoreInstruction builds the instruction asking a judge to score a reply
+// to prompt from 1 to 10 against criteria.
+func ScoreInstruction(criteria, prompt, reply string) string {
+	if criteria == "" {
+		criteria = "helpfulness, accuracy and style"
+	}
+	return "Rate the reply below to the prompt on " + criteria + ", from 1 (worst) to 10 (best). " +
+		"Respond with the score, then a one-sentence reason.\n\nPrompt:\n" + prompt +
+		"\n\nReply:\n" + reply
+}
+
+// scoreNumber matches the score leading a judge reply.
+var scoreNumber = regexp.MustCompile(`^\D{0,16}?(\d+(?:\.\d+)?)`)
+
+// ParseScore reads a judge reply to ScoreInstruction: its score, and its
+// reason. Reports false if the reply does not start with a score.
+func ParseScore(reply string) (float64, string, bool) {
+	reply = strings.TrimSpace(reply)
+	m := scoreNumber.FindStringSubmatchIndex(reply)
+	if m == nil {
+		return 0, reply, false
+	}
+	score, err := strconv.ParseFloat(reply[m[2]:m[3]], 64)
+	if err != nil {
+		return 0, reply, false
+	}
+	reason := strings.TrimPrefix(reply[m[3]:], "/10")
+	return score, strings.TrimSpace(strings.TrimLeft(reason, "*:.-–—) ")), true
+}
+
+// ScoreJudge returns a JudgeFunc asking the model, in a side request, to
+// score replies from 1 to 10 against criteria; see ScoreInstruction.
+func (c *Conversation) ScoreJudge(criteria string) JudgeFunc {
+	return func(ctx context.Context, prompt, reply string) (float64, string, error) {
+		_, visible := splitThinking(reply)
+		verdict, err := c.sideRequest(ctx, ScoreInstruction(criteria, prompt, strings.TrimSpace(visible)),
+			SamplingProfile{MaxTokens: Int(MaxJudgeTokens), Temperature: Float64(0)})
+		if err != nil {
+			return 0, "", fmt.Errorf("error judging reply: %w", err)
+		}
+		_, verdict = splitThinking(verdict)
+		score, reason, ok := ParseScore(verdict)
+		if !ok {
+			return 0, "", fmt.Errorf("error judging reply: no score in %q", verdict)
+		}
+		return score, reason, nil
+	}
+}
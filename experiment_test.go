@@ -0,0 +1,158 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExperimentRun(t *testing.T) {
+	conv := NewConversation("Be helpful.")
+	conv.AddMessage("user", "Hi")
+	conv.AddMessage("assistant", "Hello!")
+	fake := NewFakeBackend().
+		On("Be terse", FakeResponse{Text: "Paris.", CompletionTokens: 2, PromptTokens: 10}).
+		On("Be verbose", FakeResponse{Text: "The capital of France is Paris.", CompletionTokens: 8, PromptTokens: 10}).
+		On("Be broken", FakeResponse{StatusCode: 400, Body: `{"message":"bad"}`})
+	fake.Install(conv)
+
+	exp := &Experiment{
+		Conversation: conv,
+		Prompt:       "Capital of France?",
+		Variants: []ExperimentVariant{
+			{Name: "terse", System: "Be terse."},
+			{Name: "verbose", System: "Be verbose."},
+			{Name: "broken", System: "Be broken."},
+		},
+		Runs:     2,
+		Parallel: 3,
+		Judge: func(ctx context.Context, prompt, reply string) (float64, string, error) {
+			if prompt != "Capital of France?" {
+				t.Errorf("judge prompt = %q", prompt)
+			}
+			return float64(len(reply)), "length", nil
+		},
+	}
+	report, err := exp.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Results) != 6 {
+		t.Fatalf("got %d results, want 6", len(report.Results))
+	}
+	for i, r := range report.Results {
+		if want := exp.Variants[i/2].Name; r.Variant != want || r.Run != i%2 {
+			t.Errorf("result %d is %s run %d, want %s run %d", i, r.Variant, r.Run, want, i%2)
+		}
+	}
+	if r := report.Results[0]; r.Reply != "Paris." || !r.Scored || r.Score != 6 || r.OutputTokens != 2 {
+		t.Errorf("terse result = %+v", r)
+	}
+	if r := report.Results[4]; r.Err == nil || r.Scored {
+		t.Errorf("broken result = %+v, want an unjudged error", r)
+	}
+
+	ranked := report.Ranked()
+	if ranked[0].Variant != "verbose" || ranked[1].Variant != "terse" || ranked[2].Variant != "broken" {
+		t.Errorf("ranking = %s, %s, %s", ranked[0].Variant, ranked[1].Variant, ranked[2].Variant)
+	}
+	if s := report.Summaries[0]; s.Runs != 2 || s.Scored != 2 || s.MeanScore != 6 || s.MeanOutputTokens != 2 {
+		t.Errorf("terse summary = %+v", s)
+	}
+	if s := report.Summaries[2]; s.Errors != 2 || s.Scored != 0 {
+		t.Errorf("broken summary = %+v", s)
+	}
+
+	// The seed history is sent with each variant's system prompt and kept
+	for _, req := range fake.Requests() {
+		if !strings.Contains(req.Prompt, "Hello!") || strings.Contains(req.Prompt, "Be helpful.") {
+			t.Errorf("request prompt = %q", req.Prompt)
+		}
+	}
+	if len(conv.Messages) != 2 || conv.System != "Be helpful." {
+		t.Errorf("conversation changed: %q, %+v", conv.System, conv.Messages)
+	}
+	if conv.Usage.OutputTokens != 20 {
+		t.Errorf("Usage.OutputTokens = %d, want 20", conv.Usage.OutputTokens)
+	}
+
+	md := report.Markdown()
+	for _, want := range []string{
+		"| verbose | 2 | 0 | 31.00 | 31.00 | 31.00 | 8 |",
+		"| broken | 2 | 2 | - | - | - | 0 |",
+		"### terse, run 1\n\nScore: 6. length\n\n```text\nParis.\n```\n",
+		"### broken, run 2\n\nError: ",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestExperimentInterval(t *testing.T) {
+	conv := NewConversation("sys")
+	NewFakeBackend().On(".", FakeResponse{Text: "ok"}).Install(conv)
+	exp := &Experiment{
+		Conversation: conv,
+		Prompt:       "go",
+		Variants:     []ExperimentVariant{{Name: "a"}, {Name: "b"}},
+		Runs:         2,
+		Parallel:     4,
+		Interval:     20 * time.Millisecond,
+	}
+	start := time.Now()
+	report, err := exp.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 runs 20ms apart took %v", elapsed)
+	}
+	if s := report.Summaries[0]; s.Scored != 0 || s.Runs != 2 {
+		t.Errorf("summary without judge = %+v", s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err = exp.Run(ctx)
+	if !errors.Is(err, context.Canceled) || len(report.Results) != 0 {
+		t.Errorf("cancelled Run = %d results, %v", len(report.Results), err)
+	}
+
+	if _, err := (&Experiment{Conversation: conv}).Run(context.Background()); err == nil {
+		t.Error("Run without variants succeeded")
+	}
+}
+
+func TestParseScore(t *testing.T) {
+	tests := []struct {
+		in     string
+		score  float64
+		reason string
+		ok     bool
+	}{
+		{"8 - Clear and correct.", 8, "Clear and correct.", true},
+		{"Score: 7/10. Too long.", 7, "Too long.", true},
+		{"**9.5**: Excellent", 9.5, "Excellent", true},
+		{"I cannot rate this.", 0, "I cannot rate this.", false},
+	}
+	for _, tt := range tests {
+		score, reason, ok := ParseScore(tt.in)
+		if score != tt.score || reason != tt.reason || ok != tt.ok {
+			t.Errorf("ParseScore(%q) = %v, %q, %v", tt.in, score, reason, ok)
+		}
+	}
+}
+
+func TestScoreJudge(t *testing.T) {
+	conv := NewConversation("sys")
+	NewFakeBackend().
+		On("Rate the reply", FakeResponse{Text: "<think>hmm</think>9 - Accurate."}).
+		Install(conv)
+	score, reason, err := conv.ScoreJudge("accuracy")(context.Background(), "Capital?", "<think>x</think>Paris.")
+	if err != nil || score != 9 || reason != "Accurate." {
+		t.Errorf("ScoreJudge = %v, %q, %v", score, reason, err)
+	}
+}
@@ -0,0 +1,107 @@
+package novelai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// requestFields returns the JSON names of the fields of completionRequest,
+// which Settings.Extra must not set.
+var requestFields = sync.OnceValue(func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(completionRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+})
+
+// ValidateExtra checks fields to be merged into requests, as set in
+// Settings.Extra: each must have a name and a value that encodes as JSON,
+// and must not be a field this package sets, such as "temperature" or
+// "stream". Those are set through Settings and SamplingProfile instead.
+func ValidateExtra(extra map[string]any) error {
+	for _, key := range extraKeys(extra) {
+		switch {
+		case key == "":
+			return fmt.Errorf("extra request field has no name")
+		case requestFields()[key]:
+			return fmt.Errorf("extra request field %q conflicts with a field set from Settings", key)
+		}
+		if _, err := json.Marshal(extra[key]); err != nil {
+			return fmt.Errorf("error encoding extra request field %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the request with the fields of Extra merged in,
+// sorted by name so that the encoding is stable.
+func (r completionRequest) MarshalJSON() ([]byte, error) {
+	type plain completionRequest
+	data, err := json.Marshal(plain(r))
+	if err != nil || len(r.Extra) == 0 {
+		return data, err
+	}
+	if err := ValidateExtra(r.Extra); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.Write(data[:len(data)-1])
+	for _, key := range extraKeys(r.Extra) {
+		name, _ := json.Marshal(key)
+		value, _ := json.Marshal(r.Extra[key])
+		b.WriteByte(',')
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// extraKeys returns the keys of m in order.
+func extraKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cloneExtra returns a deep copy of extra, copying nested maps and slices
+// as decoded from JSON.
+func cloneExtra(extra map[string]any) map[string]any {
+	if extra == nil {
+		return nil
+	}
+	c := make(map[string]any, len(extra))
+	for key, value := range extra {
+		c[key] = cloneJSONValue(value)
+	}
+	return c
+}
+
+// cloneJSONValue returns a deep copy of a JSON-like value.
+func cloneJSONValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return cloneExtra(v)
+	case []any:
+		c := make([]any, len(v))
+		for i, item := range v {
+			c[i] = cloneJSONValue(item)
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,89 @@
+package novelai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSettingsExtra(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = nil
+		json.Unmarshal(data, &body)
+		json.NewEncoder(w).Encode(mockCompletionResponse(`{"ok":true}`, "stop", 5, 2))
+	}))
+	defer server.Close()
+	settings := BuiltinSettings()
+	settings.Extra = map[string]any{
+		"response_format": map[string]any{"type": "json_object"},
+		"guided_regex":    "[a-z]+",
+	}
+	conv := NewConversationWithClient(nil, ConversationConfig{
+		ApiToken: "test-token",
+		Endpoint: server.URL,
+		Settings: settings,
+	})
+
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	format, _ := body["response_format"].(map[string]any)
+	if format["type"] != "json_object" || body["guided_regex"] != "[a-z]+" || body["prompt"] == nil {
+		t.Errorf("request body = %v", body)
+	}
+	// The server does not stream; only the request matters
+	conv.SendStreamingWith("Hello", SamplingProfile{}, nil)
+	if body["guided_regex"] != "[a-z]+" || body["stream"] != true {
+		t.Errorf("streaming request body = %v", body)
+	}
+
+	// Extra fields are part of the generation inputs
+	before, err := conv.PromptFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Settings.Extra["guided_regex"] = "[0-9]+"
+	if after, _ := conv.PromptFingerprint(); after == before {
+		t.Error("fingerprint ignores Extra")
+	}
+
+	// Clones share no nested values
+	clone := conv.Settings.Clone()
+	clone.Extra["response_format"].(map[string]any)["type"] = "text"
+	if format := conv.Settings.Extra["response_format"].(map[string]any); format["type"] != "json_object" {
+		t.Error("Clone shares nested Extra values")
+	}
+}
+
+func TestValidateExtra(t *testing.T) {
+	if err := ValidateExtra(map[string]any{"response_format": map[string]any{"type": "json_object"}}); err != nil {
+		t.Errorf("valid extra: %v", err)
+	}
+	for name, extra := range map[string]map[string]any{
+		"typed field": {"temperature": 0.5},
+		"stream":      {"stream": true},
+		"no name":     {"": 1},
+		"unencodable": {"callback": func() {}},
+	} {
+		if err := ValidateExtra(extra); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	conv := &Conversation{ApiToken: "test-token", Settings: BuiltinSettings()}
+	fake := NewFakeBackend().On("", FakeResponse{Text: "Hi."})
+	fake.Install(conv)
+	conv.Settings.Extra = map[string]any{"max_tokens": 10}
+	_, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{})
+	if err == nil || !strings.Contains(err.Error(), `"max_tokens" conflicts`) {
+		t.Errorf("send with a conflicting field = %v", err)
+	}
+	if len(fake.Requests()) != 0 {
+		t.Error("conflicting request was sent")
+	}
+}
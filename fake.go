@@ -0,0 +1,254 @@
+package novelai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// FakeResponse is a scripted completion returned by FakeBackend.
+type FakeResponse struct {
+	// Text is the completion text.
+	Text string
+	// FinishReason is the raw API finish reason ("stop", "length").
+	// Defaults to "stop".
+	FinishReason string
+	// Chunks overrides how Text is split when streaming.
+	// If nil, Text is split into words with their trailing whitespace.
+	Chunks []string
+	// ChunkDelay is the pause before each streamed chunk.
+	// If zero, FakeBackend.ChunkDelay is used.
+	ChunkDelay time.Duration
+	// PromptTokens and CompletionTokens are reported as usage.
+	// CompletionTokens defaults to the number of chunks.
+	PromptTokens     int
+	CompletionTokens int
+	// StatusCode simulates an HTTP error when set to something other than 200.
+	// Body is returned as the error response body.
+	StatusCode int
+	Body       string
+}
+
+// FakeRequest is a request received by FakeBackend.
+type FakeRequest struct {
+	Prompt string
+	Stream bool
+	Model  string
+}
+
+// fakeRule maps a prompt pattern to a sequence of scripted responses.
+type fakeRule struct {
+	pattern   *regexp.Regexp
+	responses []FakeResponse
+	next      int
+}
+
+// FakeBackend is an http.RoundTripper that answers completion requests with
+// scripted responses, so code built on Conversation can be tested
+// deterministically without network access.
+//
+// Rules are matched against the fully rendered prompt in the order they were
+// added. Each rule returns its responses in sequence, repeating the last one
+// once exhausted. Unmatched prompts receive Default, or an HTTP 404 error if
+// Default is nil.
+type FakeBackend struct {
+	// Default is returned when no rule matches.
+	Default *FakeResponse
+	// ChunkDelay is the default pause between streamed chunks.
+	ChunkDelay time.Duration
+
+	mu       sync.Mutex
+	rules    []*fakeRule
+	requests []FakeRequest
+}
+
+// Compile-time interface check
+var _ http.RoundTripper = (*FakeBackend)(nil)
+
+// chunkPattern splits text into words with trailing whitespace.
+var chunkPattern = regexp.MustCompile(`\s*\S+\s*|\s+`)
+
+// NewFakeBackend creates an empty FakeBackend.
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{}
+}
+
+// On adds a rule returning responses for prompts matching pattern.
+// Panics if pattern is not a valid regular expression.
+func (f *FakeBackend) On(pattern string, responses ...FakeResponse) *FakeBackend {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, &fakeRule{
+		pattern:   regexp.MustCompile(pattern),
+		responses: responses,
+	})
+	return f
+}
+
+// Install points a conversation at the fake backend.
+// Sets a placeholder API token if none is configured.
+func (f *FakeBackend) Install(c *Conversation) {
+	c.HttpClient = &http.Client{Transport: f}
+	if c.ApiToken == "" {
+		c.ApiToken = "fake-token"
+	}
+}
+
+// Requests returns the requests received so far.
+func (f *FakeBackend) Requests() []FakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeRequest(nil), f.requests...)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (f *FakeBackend) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		return nil, fmt.Errorf("fake backend: request has no body")
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("fake backend: error reading request: %w", err)
+	}
+
+	var compReq completionRequest
+	if err := json.Unmarshal(body, &compReq); err != nil {
+		return fakeHTTPResponse(req, http.StatusBadRequest, "text/plain", io.NopCloser(bytes.NewBufferString(err.Error()))), nil
+	}
+
+	resp, ok := f.match(compReq)
+	if !ok {
+		return fakeHTTPResponse(req, http.StatusNotFound, "text/plain",
+			io.NopCloser(bytes.NewBufferString("fake backend: no rule matches prompt"))), nil
+	}
+
+	if resp.StatusCode != 0 && resp.StatusCode != http.StatusOK {
+		return fakeHTTPResponse(req, resp.StatusCode, "text/plain", io.NopCloser(bytes.NewBufferString(resp.Body))), nil
+	}
+
+	finishReason := resp.FinishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	chunks := resp.Chunks
+	if chunks == nil {
+		chunks = chunkPattern.FindAllString(resp.Text, -1)
+	}
+	completionTokens := resp.CompletionTokens
+	if completionTokens == 0 {
+		completionTokens = len(chunks)
+	}
+
+	if !compReq.Stream {
+		out := completionResponse{ID: "cmpl-fake", Object: "text_completion", Created: time.Now().Unix(), Model: compReq.Model}
+		out.Choices = append(out.Choices, completionChoice{Text: resp.Text, FinishReason: finishReason})
+		out.Usage.PromptTokens = resp.PromptTokens
+		out.Usage.CompletionTokens = completionTokens
+		out.Usage.TotalTokens = resp.PromptTokens + completionTokens
+		data, _ := json.Marshal(out)
+		return fakeHTTPResponse(req, http.StatusOK, "application/json", io.NopCloser(bytes.NewReader(data))), nil
+	}
+
+	delay := resp.ChunkDelay
+	if delay == 0 {
+		delay = f.ChunkDelay
+	}
+	includeUsage := compReq.StreamOptions != nil && compReq.StreamOptions.IncludeUsage
+
+	pr, pw := io.Pipe()
+	go func() {
+		ctx := req.Context()
+		write := func(v any) bool {
+			data, _ := json.Marshal(v)
+			_, err := fmt.Fprintf(pw, "data: %s\n\n", data)
+			return err == nil
+		}
+		for _, chunk := range chunks {
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					pw.CloseWithError(ctx.Err())
+					return
+				}
+			}
+			if !write(fakeStreamChunk(compReq.Model, chunk, nil, nil)) {
+				return
+			}
+		}
+		final := fakeStreamChunk(compReq.Model, "", &finishReason, nil)
+		if includeUsage {
+			final = fakeStreamChunk(compReq.Model, "", &finishReason, map[string]int{
+				"prompt_tokens":     resp.PromptTokens,
+				"completion_tokens": completionTokens,
+				"total_tokens":      resp.PromptTokens + completionTokens,
+			})
+		}
+		if !write(final) {
+			return
+		}
+		fmt.Fprint(pw, "data: [DONE]\n\n")
+		pw.Close()
+	}()
+
+	return fakeHTTPResponse(req, http.StatusOK, "text/event-stream", pr), nil
+}
+
+// match records the request and selects a scripted response.
+func (f *FakeBackend) match(req completionRequest) (FakeResponse, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, FakeRequest{Prompt: req.Prompt, Stream: req.Stream, Model: req.Model})
+
+	for _, rule := range f.rules {
+		if !rule.pattern.MatchString(req.Prompt) || len(rule.responses) == 0 {
+			continue
+		}
+		resp := rule.responses[rule.next]
+		if rule.next < len(rule.responses)-1 {
+			rule.next++
+		}
+		return resp, true
+	}
+	if f.Default != nil {
+		return *f.Default, true
+	}
+	return FakeResponse{}, false
+}
+
+// fakeStreamChunk builds one SSE chunk payload in completions format.
+func fakeStreamChunk(model, text string, finishReason *string, usage map[string]int) map[string]any {
+	chunk := map[string]any{
+		"id":      "cmpl-fake",
+		"object":  "text_completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]any{
+			{"index": 0, "text": text, "finish_reason": finishReason},
+		},
+	}
+	if usage != nil {
+		chunk["usage"] = usage
+	}
+	return chunk
+}
+
+// fakeHTTPResponse wraps a body in an http.Response for req.
+func fakeHTTPResponse(req *http.Request, status int, contentType string, body io.ReadCloser) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       body,
+		Request:    req,
+	}
+}
@@ -0,0 +1,126 @@
+package novelai
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+// TestFakeBackendSend tests scripted responses through the full Send path.
+func TestFakeBackendSend(t *testing.T) {
+	fake := NewFakeBackend().
+		On(`(?s)weather.*<\|assistant\|>`, FakeResponse{Text: "Sunny.", PromptTokens: 12}).
+		On(`length`, FakeResponse{Text: "Part one", FinishReason: "length"}, FakeResponse{Text: " and two."})
+
+	conv := NewConversation("System")
+	fake.Install(conv)
+
+	reply, stopReason, inToks, outToks, _, _, err := conv.Send("What's the weather?", llmapi.Sampling{})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if reply != "Sunny." || stopReason != "end_turn" {
+		t.Errorf("Expected (Sunny., end_turn), got (%q, %q)", reply, stopReason)
+	}
+	if inToks != 12 || outToks != 1 {
+		t.Errorf("Expected 12/1 tokens, got %d/%d", inToks, outToks)
+	}
+
+	// Sequential responses drive SendUntilDone's continuation path
+	conv.Clear()
+	reply, stopReason, _, _, _, _, err = conv.SendUntilDone("Test length handling", llmapi.Sampling{})
+	if err != nil {
+		t.Fatalf("SendUntilDone failed: %v", err)
+	}
+	if reply != "Part one and two." || stopReason != "end_turn" {
+		t.Errorf("Expected continued reply, got (%q, %q)", reply, stopReason)
+	}
+
+	reqs := fake.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("Expected 3 recorded requests, got %d", len(reqs))
+	}
+	if !strings.Contains(reqs[0].Prompt, "What's the weather?") {
+		t.Errorf("Expected recorded prompt to contain user text, got %q", reqs[0].Prompt)
+	}
+}
+
+// TestFakeBackendStreaming tests simulated streaming with chunk pacing.
+func TestFakeBackendStreaming(t *testing.T) {
+	fake := NewFakeBackend()
+	fake.Default = &FakeResponse{Text: "One two three", PromptTokens: 4}
+	fake.ChunkDelay = 5 * time.Millisecond
+
+	conv := NewConversation("System")
+	fake.Install(conv)
+
+	var chunks []string
+	var sawDone bool
+	start := time.Now()
+	reply, stopReason, inToks, outToks, _, _, err := conv.SendStreaming("Count", llmapi.Sampling{}, func(text string, done bool) {
+		if done {
+			sawDone = true
+			return
+		}
+		chunks = append(chunks, text)
+	})
+	if err != nil {
+		t.Fatalf("SendStreaming failed: %v", err)
+	}
+
+	if reply != "One two three" || stopReason != "end_turn" {
+		t.Errorf("Expected (One two three, end_turn), got (%q, %q)", reply, stopReason)
+	}
+	if len(chunks) != 3 || chunks[0] != "One " {
+		t.Errorf("Expected 3 word chunks, got %q", chunks)
+	}
+	if !sawDone {
+		t.Error("Expected done callback")
+	}
+	if inToks != 4 || outToks != 3 {
+		t.Errorf("Expected 4/3 tokens, got %d/%d", inToks, outToks)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("Expected paced stream to take at least 15ms, took %v", elapsed)
+	}
+}
+
+// TestFakeBackendErrors tests simulated HTTP errors and unmatched prompts.
+func TestFakeBackendErrors(t *testing.T) {
+	fake := NewFakeBackend().On(`busy`, FakeResponse{StatusCode: 429, Body: "Concurrent generation"})
+
+	conv := NewConversation("System")
+	fake.Install(conv)
+
+	_, _, _, _, _, _, err := conv.Send("busy", llmapi.Sampling{})
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("Expected 429 error, got %v", err)
+	}
+
+	conv.Clear()
+	_, _, _, _, _, _, err = conv.Send("unmatched", llmapi.Sampling{})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected 404 error for unmatched prompt, got %v", err)
+	}
+}
+
+// TestFakeBackendStreamingCancel tests that paced streams observe cancellation.
+func TestFakeBackendStreamingCancel(t *testing.T) {
+	fake := NewFakeBackend()
+	fake.Default = &FakeResponse{Text: strings.Repeat("word ", 100), ChunkDelay: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	conv := NewConversation("System")
+	conv.SetContext(ctx)
+	fake.Install(conv)
+
+	_, _, _, _, _, _, err := conv.SendStreaming("Go", llmapi.Sampling{}, nil)
+	if err == nil {
+		t.Fatal("Expected error from cancelled stream")
+	}
+}
@@ -0,0 +1,34 @@
+package novelai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// PromptFingerprint identifies the generation inputs of the request that
+// would continue the history as it is: a SHA-256 hash, in hex, of the
+// rendered prompt and the generation parameters of Settings. Requests with
+// equal fingerprints ask for the same generation, so the fingerprint can
+// key caches and dedupe or group generations. Streaming does not change
+// it.
+//
+// Each request's fingerprint is kept in its TurnRecord. It fails if the
+// settings cannot be encoded, such as a NaN temperature.
+func (c *Conversation) PromptFingerprint() (string, error) {
+	return newCompletionRequest(c.buildPrompt(), &c.Settings, SamplingProfile{}).fingerprint()
+}
+
+// fingerprint hashes the generation inputs of r. encoding/json writes
+// fields in order and map keys sorted, so the encoding is stable.
+func (r completionRequest) fingerprint() (string, error) {
+	r.Stream = false
+	r.StreamOptions = nil
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("error fingerprinting request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,98 @@
+package novelai
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// fingerprint returns conv's PromptFingerprint, failing t on error.
+func fingerprint(t *testing.T, conv *Conversation) string {
+	t.Helper()
+	fp, err := conv.PromptFingerprint()
+	if err != nil {
+		t.Fatalf("PromptFingerprint: %v", err)
+	}
+	return fp
+}
+
+func TestPromptFingerprint(t *testing.T) {
+	conv := NewConversation("sys")
+	conv.AddMessage("user", "Hello")
+	fp := fingerprint(t, conv)
+	if len(fp) != 64 {
+		t.Fatalf("PromptFingerprint() = %q, want a SHA-256 hex digest", fp)
+	}
+	if again := fingerprint(t, conv); again != fp {
+		t.Errorf("fingerprint changed between calls: %s, %s", fp, again)
+	}
+
+	other := NewConversation("sys")
+	other.AddMessage("user", "Hello")
+	if fingerprint(t, other) != fp {
+		t.Error("equal conversations have different fingerprints")
+	}
+	other.Settings.Temperature += 0.1
+	if fingerprint(t, other) == fp {
+		t.Error("temperature change kept the fingerprint")
+	}
+	other = NewConversation("other sys")
+	other.AddMessage("user", "Hello")
+	if fingerprint(t, other) == fp {
+		t.Error("system prompt change kept the fingerprint")
+	}
+}
+
+func TestPromptFingerprintRecorded(t *testing.T) {
+	conv := NewConversation("sys")
+	NewFakeBackend().On(".", FakeResponse{Text: "Hi."}).Install(conv)
+	conv.AddMessage("user", "Hello")
+	fp := fingerprint(t, conv)
+	if _, _, _, _, _, _, err := conv.SendWith("", SamplingProfile{}); err != nil {
+		t.Fatalf("SendWith: %v", err)
+	}
+
+	// A streamed request with the same inputs has the same fingerprint
+	stream := NewConversation("sys")
+	NewFakeBackend().On(".", FakeResponse{Text: "Hi."}).Install(stream)
+	if _, _, _, _, _, _, err := stream.SendStreamingWith("Hello", SamplingProfile{}, nil); err != nil {
+		t.Fatalf("SendStreamingWith: %v", err)
+	}
+	if conv.Turns[0].Fingerprint != fp || stream.Turns[0].Fingerprint != fp {
+		t.Errorf("recorded fingerprints %q, %q, want %q", conv.Turns[0].Fingerprint, stream.Turns[0].Fingerprint, fp)
+	}
+
+	// Overrides are generation inputs too
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{Temperature: Float64(0)}); err != nil {
+		t.Fatalf("SendWith: %v", err)
+	}
+	if conv.Turns[1].Fingerprint == "" || conv.Turns[1].Fingerprint == fp {
+		t.Errorf("second fingerprint = %q", conv.Turns[1].Fingerprint)
+	}
+
+	exp := &Experiment{Conversation: stream, Prompt: "Again", Runs: 2,
+		Variants: []ExperimentVariant{{Name: "a"}, {Name: "b", System: "other"}}}
+	report, err := exp.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	r := report.Results
+	if r[0].Fingerprint == "" || r[0].Fingerprint != r[1].Fingerprint || r[0].Fingerprint == r[2].Fingerprint {
+		t.Errorf("experiment fingerprints = %q, %q, %q", r[0].Fingerprint, r[1].Fingerprint, r[2].Fingerprint)
+	}
+}
+
+func TestPromptFingerprintUnencodable(t *testing.T) {
+	conv := NewConversation("sys")
+	NewFakeBackend().On(".", FakeResponse{Text: "Hi."}).Install(conv)
+	conv.Settings.Temperature = math.NaN()
+	if _, err := conv.PromptFingerprint(); err == nil {
+		t.Error("PromptFingerprint of a NaN temperature succeeded")
+	}
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err == nil {
+		t.Error("SendWith with a NaN temperature succeeded")
+	}
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Hello", SamplingProfile{}, nil); err == nil {
+		t.Error("SendStreamingWith with a NaN temperature succeeded")
+	}
+}
@@ -0,0 +1,122 @@
+package novelai
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Fuzz targets for the parsers and matchers that consume untrusted input.
+// Run with: go test -fuzz=FuzzScenarioUnmarshal
+// Seed corpora live in testdata/scenarios and testdata/fuzz.
+
+// addScenarioSeeds adds every scenario file in testdata/scenarios to the corpus.
+func addScenarioSeeds(f *testing.F) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "scenarios", "*.scenario"))
+	if err != nil {
+		f.Fatalf("Failed to list scenario seeds: %v", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatalf("Failed to read %s: %v", path, err)
+		}
+		f.Add(data)
+	}
+}
+
+// FuzzScenarioUnmarshal checks that any scenario that decodes can be
+// re-encoded and decoded again without loss.
+func FuzzScenarioUnmarshal(f *testing.F) {
+	addScenarioSeeds(f)
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`{"scenarioVersion":3,"lorebook":{"entries":[{"keys":null}]}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var s Scenario
+		if err := json.Unmarshal(data, &s); err != nil {
+			return
+		}
+		encoded, err := json.Marshal(&s)
+		if err != nil {
+			t.Fatalf("Failed to re-marshal decoded scenario: %v", err)
+		}
+		var again Scenario
+		if err := json.Unmarshal(encoded, &again); err != nil {
+			t.Fatalf("Failed to decode re-marshaled scenario: %v", err)
+		}
+		reencoded, _ := json.Marshal(&again)
+		if string(encoded) != string(reencoded) {
+			t.Errorf("Scenario round trip is unstable:\n%s\n%s", encoded, reencoded)
+		}
+	})
+}
+
+// FuzzParseSSEStream checks that the SSE parser never panics and that the
+// accumulated reply always equals the text delivered to the callback.
+func FuzzParseSSEStream(f *testing.F) {
+	f.Add("data: {\"choices\":[{\"text\":\"Hi\",\"finish_reason\":null}]}\n\ndata: [DONE]\n\n")
+	f.Add("data: {\"choices\":[{\"text\":\"\",\"finish_reason\":\"stop\"}],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1}}\n")
+	f.Add("data: {not json}\ndata: \ndata: [DONE]")
+	f.Add(": keepalive\n\nevent: ping\ndata: {\"choices\":[]}\n")
+
+	f.Fuzz(func(t *testing.T, stream string) {
+		conv := NewConversation("")
+		var delivered strings.Builder
+		reply, _, inputTokens, outputTokens, _ := conv.parseSSEStream(strings.NewReader(stream), &conv.Settings, func(text string, done bool) {
+			delivered.WriteString(text)
+		})
+		if reply != delivered.String() {
+			t.Errorf("Reply %q does not match delivered text %q", reply, delivered.String())
+		}
+		if inputTokens < 0 && !strings.Contains(stream, "-") {
+			t.Errorf("Negative input tokens %d without negative usage in stream", inputTokens)
+		}
+		if outputTokens < 0 && !strings.Contains(stream, "-") {
+			t.Errorf("Negative output tokens %d without negative usage in stream", outputTokens)
+		}
+	})
+}
+
+// FuzzLorebookActivation checks that activation never panics on arbitrary
+// keys and story text, and that reported match positions are in range.
+func FuzzLorebookActivation(f *testing.F) {
+	f.Add("Alice", "Alice walked in.", 1000)
+	f.Add("/gull\\s+rock/i", "They reached GULL  ROCK at dawn.", 20)
+	f.Add("/(unclosed/", "text", 5)
+	f.Add("é", "café au lait", 3)
+
+	f.Fuzz(func(t *testing.T, key string, story string, searchRange int) {
+		lb := Lorebook{Entries: []LorebookEntry{
+			{Keys: []string{key}, Enabled: true, SearchRange: searchRange},
+		}}
+		for _, act := range lb.Activate(story) {
+			if act.Active && (act.Position < 0 || act.Position > len(story)) {
+				t.Errorf("Match position %d out of range for story of length %d", act.Position, len(story))
+			}
+		}
+		NewContextBuilder(&Scenario{Lorebook: lb}).Report(story)
+	})
+}
+
+// FuzzReadImageMetadata checks that malformed PNGs are rejected without
+// panicking or allocating from untrusted lengths.
+func FuzzReadImageMetadata(f *testing.F) {
+	f.Add([]byte("\x89PNG\r\n\x1a\n"))
+	f.Add([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x05tEXtA\x00bcd\x00\x00\x00\x00"))
+	f.Add([]byte("\x89PNG\r\n\x1a\n\xff\xff\xff\xfftEXt"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		meta, err := ReadImageMetadata(data)
+		if err == nil && meta == nil {
+			t.Fatal("Expected metadata or an error")
+		}
+		if text, err := ReadPNGText(data); err == nil {
+			if _, err := WritePNGText(data, text); err != nil {
+				t.Fatalf("Failed to rewrite readable PNG: %v", err)
+			}
+		}
+	})
+}
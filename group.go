@@ -0,0 +1,257 @@
+package novelai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpeakerSelection chooses who speaks next in a GroupChat.
+type SpeakerSelection int
+
+const (
+	// SpeakRoundRobin lets members speak in turn.
+	SpeakRoundRobin SpeakerSelection = iota
+	// SpeakModelChosen asks the model who should speak next, falling back
+	// to round robin if the reply names no member.
+	SpeakModelChosen
+)
+
+// MaxSpeakerTokens caps the reply when the model chooses the next speaker.
+const MaxSpeakerTokens = 16
+
+// GroupMember is a character taking part in a GroupChat.
+type GroupMember struct {
+	// Name identifies the member in the transcript and replaces {{char}}.
+	Name string
+	// System is the member's system prompt. If empty, the group
+	// conversation's system prompt is used.
+	System string
+	// Lorebook, if set, adds the member's entries activated by the recent
+	// transcript to its system prompt.
+	Lorebook *Lorebook
+	// Conversation, if set, supplies the member's settings, template and
+	// API token, and is charged its usage. If nil, the group's is used.
+	Conversation *Conversation
+}
+
+// GroupMessage is one line of a group chat's shared history.
+type GroupMessage struct {
+	Speaker string `json:"speaker"`
+	Content string `json:"content"`
+	// User is true for messages from the user.
+	User bool `json:"user,omitempty"`
+}
+
+// GroupChat coordinates several characters over one shared history. Each
+// member sees its own lines as assistant turns and everyone else's as
+// "Name: text" user turns.
+type GroupChat struct {
+	// Conversation supplies the default system prompt, settings, user
+	// persona and API token, and is charged usage for members without
+	// their own. Its history is not used.
+	Conversation *Conversation
+	// Members take part in the chat.
+	Members []*GroupMember
+	// History is the shared transcript.
+	History []GroupMessage
+	// Selection chooses the next speaker in Step.
+	Selection SpeakerSelection
+
+	// next is the index of the next round-robin speaker.
+	next int
+}
+
+// NewGroupChat creates a group chat with conv's settings and members.
+func NewGroupChat(conv *Conversation, members ...*GroupMember) *GroupChat {
+	return &GroupChat{Conversation: conv, Members: members}
+}
+
+// Member returns the member with the given name, or nil if not found.
+// Names match case-insensitively.
+func (g *GroupChat) Member(name string) *GroupMember {
+	for _, m := range g.Members {
+		if strings.EqualFold(m.Name, strings.TrimSpace(name)) {
+			return m
+		}
+	}
+	return nil
+}
+
+// Say adds a user message to the history.
+func (g *GroupChat) Say(text string) {
+	g.History = append(g.History, GroupMessage{Speaker: g.userName(), Content: text, User: true})
+}
+
+// Step chooses the next speaker with Selection and generates their reply.
+func (g *GroupChat) Step() (*GroupMember, string, error) {
+	m, err := g.NextSpeaker()
+	if err != nil {
+		return nil, "", err
+	}
+	reply, err := g.Reply(m.Name)
+	return m, reply, err
+}
+
+// NextSpeaker chooses the next speaker with Selection.
+func (g *GroupChat) NextSpeaker() (*GroupMember, error) {
+	if len(g.Members) == 0 {
+		return nil, fmt.Errorf("group chat has no members")
+	}
+	if g.Selection == SpeakModelChosen && len(g.History) > 0 {
+		reply, err := g.Conversation.sideRequest(g.Conversation.context(), g.speakerInstruction(),
+			SamplingProfile{MaxTokens: Int(MaxSpeakerTokens), Temperature: Float64(0.3)})
+		if err != nil {
+			return nil, fmt.Errorf("error choosing speaker: %w", err)
+		}
+		if m := g.mentionedMember(reply); m != nil {
+			return m, nil
+		}
+	}
+	m := g.Members[g.next%len(g.Members)]
+	g.next = (g.next + 1) % len(g.Members)
+	return m, nil
+}
+
+// speakerInstruction builds the instruction asking the model to choose the
+// next speaker.
+func (g *GroupChat) speakerInstruction() string {
+	names := make([]string, len(g.Members))
+	for i, m := range g.Members {
+		names[i] = m.Name
+	}
+	return "Based on the conversation below, who should speak next? Choose one of: " +
+		strings.Join(names, ", ") + ". Respond with only the name." +
+		"\n\nConversation:\n" + transcriptTail(g.Transcript(), DefaultSceneWindow)
+}
+
+// mentionedMember returns the member whose name appears first in text, or
+// nil if none does.
+func (g *GroupChat) mentionedMember(text string) *GroupMember {
+	text = strings.ToLower(text)
+	var found *GroupMember
+	first := len(text)
+	for _, m := range g.Members {
+		if i := strings.Index(text, strings.ToLower(m.Name)); i >= 0 && i < first {
+			found, first = m, i
+		}
+	}
+	return found
+}
+
+// Reply generates the next message from the named member and adds it to
+// the history. Generation stops where the model starts another member's
+// line.
+func (g *GroupChat) Reply(name string) (string, error) {
+	m := g.Member(name)
+	if m == nil {
+		return "", fmt.Errorf("group member %s not found", name)
+	}
+	src := m.Conversation
+	if src == nil {
+		src = g.Conversation
+	}
+
+	conv := *src
+	conv.System = g.memberSystem(m, src)
+	conv.CharName = m.Name
+	if conv.UserPersona == nil {
+		conv.UserPersona = g.Conversation.UserPersona
+	}
+	conv.Messages = g.memberMessages(m)
+	conv.ToolResults = nil
+	conv.Usage = Usage{}
+	conv.Turns = nil
+	conv.Classifier = nil
+	conv.Translator = nil
+
+	var stop []string
+	for _, other := range g.speakers() {
+		if !strings.EqualFold(other, m.Name) {
+			stop = append(stop, "\n"+other+":")
+		}
+	}
+	overrides := SamplingProfile{StopSequences: append(append([]string(nil), src.Settings.StopSequences...), stop...)}
+	reply, _, _, _, _, _, err := conv.SendWith("", overrides)
+	src.Usage.InputTokens += conv.Usage.InputTokens
+	src.Usage.OutputTokens += conv.Usage.OutputTokens
+	if err != nil {
+		return "", fmt.Errorf("error generating reply for %s: %w", m.Name, err)
+	}
+
+	reply = strings.TrimSpace(reply)
+	if label, rest, ok := strings.Cut(reply, ":"); ok && strings.EqualFold(strings.TrimSpace(label), m.Name) {
+		reply = strings.TrimSpace(rest)
+	}
+	g.History = append(g.History, GroupMessage{Speaker: m.Name, Content: reply})
+	return reply, nil
+}
+
+// memberSystem returns the member's system prompt with its activated lore.
+func (g *GroupChat) memberSystem(m *GroupMember, src *Conversation) string {
+	system := m.System
+	if system == "" {
+		system = src.System
+	}
+	if m.Lorebook == nil {
+		return system
+	}
+	var lore []string
+	for _, act := range m.Lorebook.Activate(g.Transcript()) {
+		if text := strings.TrimSpace(m.Lorebook.Entries[act.EntryIndex].Text); act.Active && text != "" {
+			lore = append(lore, text)
+		}
+	}
+	if len(lore) == 0 {
+		return system
+	}
+	if system != "" {
+		system += "\n\n"
+	}
+	return system + strings.Join(lore, "\n")
+}
+
+// memberMessages renders the shared history from m's point of view: its
+// own lines as assistant messages, and everyone else's, labeled with the
+// speaker's name, merged into user messages between them.
+func (g *GroupChat) memberMessages(m *GroupMember) []Message {
+	var messages []Message
+	for _, h := range g.History {
+		if !h.User && strings.EqualFold(h.Speaker, m.Name) {
+			messages = append(messages, Message{Role: "assistant", Content: h.Content})
+			continue
+		}
+		line := h.Speaker + ": " + h.Content
+		if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+			messages[n-1].Content += "\n" + line
+			continue
+		}
+		messages = append(messages, Message{Role: "user", Content: line})
+	}
+	return messages
+}
+
+// speakers returns the names of the members and the user.
+func (g *GroupChat) speakers() []string {
+	names := []string{g.userName()}
+	for _, m := range g.Members {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// userName returns the user's persona name, or "User".
+func (g *GroupChat) userName() string {
+	if name := g.Conversation.userName(); name != "" {
+		return name
+	}
+	return "User"
+}
+
+// Transcript formats the shared history as "Name: text" paragraphs.
+func (g *GroupChat) Transcript() string {
+	lines := make([]string, len(g.History))
+	for i, h := range g.History {
+		lines[i] = h.Speaker + ": " + strings.TrimSpace(h.Content)
+	}
+	return strings.Join(lines, "\n\n")
+}
@@ -0,0 +1,82 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGroupChatRoundRobin tests turn order, per-member prompts and the
+// shared transcript.
+func TestGroupChatRoundRobin(t *testing.T) {
+	base := NewConversation("")
+	base.UserPersona = &Persona{Name: "Ana"}
+	lore := &Lorebook{}
+	if _, err := lore.AddEntry(NewLorebookEntry("Tower", "The tower is haunted.", "tower")); err != nil {
+		t.Fatal(err)
+	}
+	fake := NewFakeBackend().
+		On(`You are Rook`, FakeResponse{Text: "Rook: Stay close, {{user}}.", PromptTokens: 5, CompletionTokens: 2}).
+		On(`You are Wren`, FakeResponse{Text: "I'll scout ahead.", PromptTokens: 7, CompletionTokens: 3})
+	fake.Install(base)
+
+	group := NewGroupChat(base,
+		&GroupMember{Name: "Rook", System: "You are {{char}}.", Lorebook: lore},
+		&GroupMember{Name: "Wren", System: "You are {{char}}."})
+	if _, err := group.Reply("Rook"); err == nil {
+		t.Error("Expected error with empty history")
+	}
+	if _, err := group.Reply("Nobody"); err == nil {
+		t.Error("Expected error for unknown member")
+	}
+	group.Say("Let's climb the tower.")
+
+	m, reply, err := group.Step()
+	if err != nil || m.Name != "Rook" || reply != "Stay close, {{user}}." {
+		t.Fatalf("First step: got %v, %q, %v", m, reply, err)
+	}
+	m, reply, err = group.Step()
+	if err != nil || m.Name != "Wren" || reply != "I'll scout ahead." {
+		t.Fatalf("Second step: got %v, %q, %v", m, reply, err)
+	}
+
+	reqs := fake.Requests()
+	if !strings.Contains(reqs[0].Prompt, "You are Rook.\n\nThe tower is haunted.") {
+		t.Errorf("Expected Rook's lore in system prompt, got %q", reqs[0].Prompt)
+	}
+	if !strings.Contains(reqs[1].Prompt, "Ana: Let's climb the tower.\nRook: Stay close, Ana.") {
+		t.Errorf("Expected labeled shared history, got %q", reqs[1].Prompt)
+	}
+	if strings.Contains(reqs[1].Prompt, "haunted") {
+		t.Error("Expected Wren not to see Rook's lore")
+	}
+
+	want := "Ana: Let's climb the tower.\n\nRook: Stay close, {{user}}.\n\nWren: I'll scout ahead."
+	if got := group.Transcript(); got != want {
+		t.Errorf("Expected transcript %q, got %q", want, got)
+	}
+	if base.Usage.InputTokens != 12 || base.Usage.OutputTokens != 5 {
+		t.Errorf("Expected usage charged to base conversation, got %+v", base.Usage)
+	}
+}
+
+// TestGroupChatModelChosen tests model-chosen speaker selection.
+func TestGroupChatModelChosen(t *testing.T) {
+	base := NewConversation("")
+	fake := NewFakeBackend().
+		On(`who should speak next`, FakeResponse{Text: "Wren."}, FakeResponse{Text: "Nobody"})
+	fake.Install(base)
+
+	group := NewGroupChat(base, &GroupMember{Name: "Rook"}, &GroupMember{Name: "Wren"})
+	group.Selection = SpeakModelChosen
+	group.Say("Who goes first?")
+
+	if m, err := group.NextSpeaker(); err != nil || m.Name != "Wren" {
+		t.Fatalf("Expected Wren, got %v, %v", m, err)
+	}
+	if m, err := group.NextSpeaker(); err != nil || m.Name != "Rook" {
+		t.Errorf("Expected round-robin fallback to Rook, got %v, %v", m, err)
+	}
+	if len(base.Messages) != 0 {
+		t.Errorf("Expected base history unchanged, got %d messages", len(base.Messages))
+	}
+}
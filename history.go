@@ -0,0 +1,125 @@
+package novelai
+
+import (
+	"slices"
+
+	"github.com/wbrown/llmapi"
+)
+
+// HistoryFilter selects the part of the history a request sees, for
+// focused queries over long sessions. It receives the stored messages,
+// which it must not modify, and returns those to include in the prompt.
+type HistoryFilter func(messages []Message) []Message
+
+// LastExchanges keeps the last n exchanges: the last n user messages and
+// everything after the first of them.
+func LastExchanges(n int) HistoryFilter {
+	return func(messages []Message) []Message {
+		if n <= 0 {
+			return nil
+		}
+		seen := 0
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Role == "user" {
+				if seen++; seen == n {
+					return messages[i:]
+				}
+			}
+		}
+		return messages
+	}
+}
+
+// WithTag keeps the messages tagged with tag; see TagMessage.
+func WithTag(tag string) HistoryFilter {
+	return func(messages []Message) []Message {
+		var kept []Message
+		for _, m := range messages {
+			if m.HasTag(tag) {
+				kept = append(kept, m)
+			}
+		}
+		return kept
+	}
+}
+
+// ChainFilters applies filters in order, each to the output of the one
+// before.
+func ChainFilters(filters ...HistoryFilter) HistoryFilter {
+	return func(messages []Message) []Message {
+		for _, f := range filters {
+			messages = f(messages)
+		}
+		return messages
+	}
+}
+
+// HasTag reports whether the message is tagged with tag.
+func (m Message) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// TagMessage adds tags to Messages[index], for selecting it later with
+// WithTag. Tags it already has are not repeated.
+func (c *Conversation) TagMessage(index int, tags ...string) {
+	if index < 0 || index >= len(c.Messages) {
+		return
+	}
+	m := &c.Messages[index]
+	for _, tag := range tags {
+		if !m.HasTag(tag) {
+			m.Tags = append(slices.Clip(m.Tags), tag)
+		}
+	}
+}
+
+// SendFiltered is like Send but the prompt includes only the history
+// selected by filter. The new message is always included, and the stored
+// history is not changed: the exchange is appended to it as usual. When
+// continuing the last reply, filter must keep it.
+func (c *Conversation) SendFiltered(text string, filter HistoryFilter, sampling llmapi.Sampling) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	defer c.filterHistory(filter)()
+	return c.send(text, &c.Settings, SamplingOverrides(sampling))
+}
+
+// SendStreamingFiltered is like SendStreaming but the prompt includes only
+// the history selected by filter.
+func (c *Conversation) SendStreamingFiltered(text string, filter HistoryFilter, sampling llmapi.Sampling, callback llmapi.StreamCallback) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	defer c.filterHistory(filter)()
+	return c.sendStreaming(text, &c.Settings, SamplingOverrides(sampling), callback)
+}
+
+// filterHistory applies filter to the current history for the next
+// request and returns a function that removes it.
+func (c *Conversation) filterHistory(filter HistoryFilter) func() {
+	c.historyFilter, c.filterBase = filter, len(c.Messages)
+	return func() { c.historyFilter, c.filterBase = nil, 0 }
+}
+
+// history returns the messages to render: all of Messages, or those
+// selected by the request's history filter followed by the messages the
+// request added.
+func (c *Conversation) history() []Message {
+	if c.historyFilter == nil {
+		return c.Messages
+	}
+	n := min(c.filterBase, len(c.Messages))
+	filtered := c.historyFilter(slices.Clip(c.Messages[:n]))
+	return append(slices.Clone(filtered), c.Messages[n:]...)
+}
@@ -0,0 +1,98 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// historyConversation returns a conversation with three exchanges, the
+// second tagged "cooking".
+func historyConversation() *Conversation {
+	conv := NewConversation("sys")
+	conv.AddMessage("user", "Tell me about ships.")
+	conv.AddMessage("assistant", "Ships float.")
+	conv.AddMessage("user", "How do I boil an egg?")
+	conv.AddMessage("assistant", "Ten minutes in boiling water.")
+	conv.AddMessage("user", "What about planes?")
+	conv.AddMessage("assistant", "Planes fly.")
+	conv.TagMessage(2, "cooking")
+	conv.TagMessage(3, "cooking", "cooking")
+	return conv
+}
+
+func TestHistoryFilters(t *testing.T) {
+	messages := historyConversation().Messages
+	contents := func(ms []Message) string {
+		var out []string
+		for _, m := range ms {
+			out = append(out, m.Content)
+		}
+		return strings.Join(out, "|")
+	}
+
+	tests := []struct {
+		name   string
+		filter HistoryFilter
+		want   string
+	}{
+		{"last exchange", LastExchanges(1), "What about planes?|Planes fly."},
+		{"more exchanges than stored", LastExchanges(5), contents(messages)},
+		{"no exchanges", LastExchanges(0), ""},
+		{"tag", WithTag("cooking"), "How do I boil an egg?|Ten minutes in boiling water."},
+		{"chain", ChainFilters(WithTag("cooking"), LastExchanges(1)), "How do I boil an egg?|Ten minutes in boiling water."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contents(tt.filter(messages)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if tags := messages[3].Tags; len(tags) != 1 {
+		t.Errorf("Expected duplicate tags to be dropped, got %v", tags)
+	}
+}
+
+func TestSendFiltered(t *testing.T) {
+	conv := historyConversation()
+	fake := NewFakeBackend().On(`.`, FakeResponse{Text: "Eggs again."})
+	fake.Install(conv)
+
+	if _, _, _, _, _, _, err := conv.SendFiltered("And poached?", WithTag("cooking"), llmapi.Sampling{}); err != nil {
+		t.Fatal(err)
+	}
+	prompt := fake.Requests()[0].Prompt
+	if strings.Contains(prompt, "Ships") || strings.Contains(prompt, "Planes") {
+		t.Errorf("Expected untagged messages left out, got prompt %q", prompt)
+	}
+	if !strings.Contains(prompt, "boil an egg") || !strings.Contains(prompt, "And poached?") {
+		t.Errorf("Expected tagged history and new message in prompt %q", prompt)
+	}
+	if len(conv.Messages) != 8 || conv.Messages[0].Content != "Tell me about ships." {
+		t.Errorf("Expected full history kept and extended, got %d messages", len(conv.Messages))
+	}
+
+	// The filter applies to one request only
+	if _, _, _, _, _, _, err := conv.SendStreaming("Thanks.", llmapi.Sampling{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if prompt := fake.Requests()[1].Prompt; !strings.Contains(prompt, "Ships") {
+		t.Errorf("Expected full history in the next request, got %q", prompt)
+	}
+}
+
+func TestSendStreamingFiltered(t *testing.T) {
+	conv := historyConversation()
+	fake := NewFakeBackend().On(`.`, FakeResponse{Text: "Jets."})
+	fake.Install(conv)
+
+	if _, _, _, _, _, _, err := conv.SendStreamingFiltered("And rockets?", LastExchanges(1), llmapi.Sampling{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	prompt := fake.Requests()[0].Prompt
+	if strings.Contains(prompt, "Ships") || !strings.Contains(prompt, "Planes fly.") {
+		t.Errorf("Expected only the last exchange in prompt %q", prompt)
+	}
+}
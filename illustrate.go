@@ -0,0 +1,98 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultSceneWindow is how much of the conversation, in bytes counted back
+// from the end, is shown to the model when writing an image prompt.
+const DefaultSceneWindow = 4000
+
+// ScenePrompt is an image prompt written from a story scene.
+type ScenePrompt struct {
+	Prompt   string `json:"prompt"`
+	Negative string `json:"negative"`
+}
+
+// ScenePromptInstruction builds the instruction sent to the model to write
+// an image prompt for scene.
+func ScenePromptInstruction(scene string) string {
+	return "Write an image generation prompt that illustrates the current moment of the " +
+		"story below. Describe the characters, setting, lighting and mood as a " +
+		"comma-separated list of short tags, most important first. Respond with only " +
+		"a JSON object with the keys \"prompt\" (the tags) and \"negative\" (tags for " +
+		"things the image should avoid, or an empty string).\n\nStory:\n" + scene
+}
+
+// ParseScenePrompt extracts a ScenePrompt from a model reply containing a
+// JSON object, ignoring any text around it.
+func ParseScenePrompt(reply string) (ScenePrompt, error) {
+	var sp ScenePrompt
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return sp, fmt.Errorf("no JSON object in scene prompt reply")
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &sp); err != nil {
+		return sp, fmt.Errorf("error parsing scene prompt reply: %w", err)
+	}
+	sp.Prompt = strings.TrimSpace(sp.Prompt)
+	sp.Negative = strings.TrimSpace(sp.Negative)
+	if sp.Prompt == "" {
+		return sp, fmt.Errorf("scene prompt reply has an empty prompt")
+	}
+	return sp, nil
+}
+
+// SceneText formats the end of the conversation as a transcript for
+// ScenePrompt, limited to DefaultSceneWindow bytes.
+func (c *Conversation) SceneText() string {
+	var b strings.Builder
+	for _, m := range c.Messages {
+		if m.Role == "system" || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(strings.TrimSpace(m.Content))
+	}
+	return transcriptTail(b.String(), DefaultSceneWindow)
+}
+
+// ScenePrompt asks the chat model to write an image prompt for the current
+// scene. The request uses a fresh history with c's system prompt and
+// settings, so the conversation is unchanged apart from c.Usage.
+func (c *Conversation) ScenePrompt() (ScenePrompt, error) {
+	scene := c.SceneText()
+	if scene == "" {
+		return ScenePrompt{}, fmt.Errorf("conversation has no scene to illustrate")
+	}
+	reply, err := c.sideRequest(c.Ctx, ScenePromptInstruction(scene), SamplingProfile{})
+	if err != nil {
+		return ScenePrompt{}, fmt.Errorf("error writing scene prompt: %w", err)
+	}
+	return ParseScenePrompt(reply)
+}
+
+// Illustrate writes an image prompt for the current scene with ScenePrompt
+// and generates it with images. The scene's negative prompt is appended to
+// params.NegativePrompt. Returns the generated images and the prompt used.
+func (c *Conversation) Illustrate(images *Client, model string, params ImageParameters) ([][]byte, ScenePrompt, error) {
+	sp, err := c.ScenePrompt()
+	if err != nil {
+		return nil, sp, err
+	}
+	if sp.Negative != "" {
+		if params.NegativePrompt != "" {
+			params.NegativePrompt += ", "
+		}
+		params.NegativePrompt += sp.Negative
+	}
+	imgs, err := images.GenerateImage(c.context(), NewImageRequest(model, sp.Prompt, params))
+	if err != nil {
+		return nil, sp, fmt.Errorf("error illustrating scene: %w", err)
+	}
+	return imgs, sp, nil
+}
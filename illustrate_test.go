@@ -0,0 +1,97 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseScenePrompt tests extracting the prompt JSON from a reply.
+func TestParseScenePrompt(t *testing.T) {
+	sp, err := ParseScenePrompt("Sure!\n{\"prompt\": \" knight, rain \", \"negative\": \"text\"}\n")
+	if err != nil {
+		t.Fatalf("ParseScenePrompt failed: %v", err)
+	}
+	if sp.Prompt != "knight, rain" || sp.Negative != "text" {
+		t.Errorf("Unexpected scene prompt: %+v", sp)
+	}
+
+	for _, reply := range []string{"no json", `{"prompt": 3}`, `{"prompt": "", "negative": "x"}`} {
+		if _, err := ParseScenePrompt(reply); err == nil {
+			t.Errorf("Expected error for %q", reply)
+		}
+	}
+}
+
+// TestSceneText tests that the transcript skips system messages and keeps
+// only the end of long conversations.
+func TestSceneText(t *testing.T) {
+	conv := NewConversation("system")
+	conv.AddMessage("system", "hidden")
+	conv.AddMessage("user", "The knight enters.")
+	conv.AddMessage("assistant", "Rain falls on the castle.")
+
+	got := conv.SceneText()
+	if got != "The knight enters.\n\nRain falls on the castle." {
+		t.Errorf("Unexpected scene text: %q", got)
+	}
+
+	conv.AddMessage("user", strings.Repeat("é", DefaultSceneWindow))
+	if got := conv.SceneText(); len(got) > DefaultSceneWindow || !strings.HasPrefix(got, "é") {
+		t.Errorf("Expected scene text trimmed on a rune boundary, got %d bytes", len(got))
+	}
+}
+
+// TestIllustrate tests the full flow from conversation to image request.
+func TestIllustrate(t *testing.T) {
+	client, requests := newImageServer(t, zipImages(t, map[string]string{"image_0.png": "png"}))
+
+	fake := NewFakeBackend().On(`image generation prompt`, FakeResponse{
+		Text:             `{"prompt":"knight, castle, rain","negative":"sunny"}`,
+		PromptTokens:     40,
+		CompletionTokens: 10,
+	})
+	conv := NewConversation("You are a storyteller.")
+	fake.Install(conv)
+	conv.AddMessage("user", "The knight reaches the castle.")
+	conv.AddMessage("assistant", "Rain lashes the walls.")
+
+	params := DefaultImageParameters()
+	params.NegativePrompt = "lowres"
+	images, sp, err := conv.Illustrate(client, ImageModelV4, params)
+	if err != nil {
+		t.Fatalf("Illustrate failed: %v", err)
+	}
+	if len(images) != 1 || string(images[0]) != "png" {
+		t.Errorf("Unexpected images: %q", images)
+	}
+	if sp.Prompt != "knight, castle, rain" {
+		t.Errorf("Unexpected scene prompt: %+v", sp)
+	}
+
+	req := (*requests)[0]
+	if req.Input != "knight, castle, rain" || req.Model != ImageModelV4 {
+		t.Errorf("Unexpected image request: %+v", req)
+	}
+	if req.Parameters.NegativePrompt != "lowres, sunny" {
+		t.Errorf("Expected combined negative prompt, got %q", req.Parameters.NegativePrompt)
+	}
+
+	if len(conv.Messages) != 2 {
+		t.Errorf("Expected history unchanged, got %d messages", len(conv.Messages))
+	}
+	if conv.Usage.InputTokens != 40 || conv.Usage.OutputTokens != 10 {
+		t.Errorf("Expected usage 40/10, got %+v", conv.Usage)
+	}
+	prompt := fake.Requests()[0].Prompt
+	if !strings.Contains(prompt, "Rain lashes the walls.") {
+		t.Errorf("Expected scene in prompt, got %q", prompt)
+	}
+}
+
+// TestIllustrateEmpty tests that an empty conversation is an error.
+func TestIllustrateEmpty(t *testing.T) {
+	conv := NewConversation("system")
+	if _, _, err := conv.Illustrate(NewClient(), ImageModelV3, DefaultImageParameters()); err == nil {
+		t.Error("Expected error for empty conversation")
+	}
+}
@@ -0,0 +1,173 @@
+package novelai
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultImageURL serves image generation (/ai/generate-image).
+// It can be overridden per-client with Client.ImageURL.
+var DefaultImageURL = "https://image.novelai.net"
+
+// Image models.
+const (
+	ImageModelV3   = "nai-diffusion-3"
+	ImageModelV4   = "nai-diffusion-4-full"
+	ImageModelV4_5 = "nai-diffusion-4-5-full"
+)
+
+// Image samplers.
+const (
+	SamplerEulerAncestral   = "k_euler_ancestral"
+	SamplerEuler            = "k_euler"
+	SamplerDPMPP2SAncestral = "k_dpmpp_2s_ancestral"
+	SamplerDPMPP2M          = "k_dpmpp_2m"
+)
+
+// Image generation actions.
+const (
+	ImageActionGenerate = "generate"
+)
+
+// V4Caption is a prompt in the structured format used by V4 models.
+type V4Caption struct {
+	BaseCaption  string   `json:"base_caption"`
+	CharCaptions []string `json:"char_captions"`
+}
+
+// V4Prompt wraps a V4 caption with its layout options.
+type V4Prompt struct {
+	Caption   V4Caption `json:"caption"`
+	UseCoords bool      `json:"use_coords"`
+	UseOrder  bool      `json:"use_order"`
+}
+
+// ImageParameters are the parameters of an image generation request.
+type ImageParameters struct {
+	Width            int       `json:"width"`
+	Height           int       `json:"height"`
+	Scale            float64   `json:"scale"`
+	Sampler          string    `json:"sampler"`
+	Steps            int       `json:"steps"`
+	NSamples         int       `json:"n_samples"`
+	Seed             int64     `json:"seed,omitempty"`
+	NegativePrompt   string    `json:"negative_prompt,omitempty"`
+	UCPreset         int       `json:"ucPreset"`
+	QualityToggle    bool      `json:"qualityToggle"`
+	NoiseSchedule    string    `json:"noise_schedule,omitempty"`
+	CFGRescale       float64   `json:"cfg_rescale,omitempty"`
+	ParamsVersion    int       `json:"params_version,omitempty"`
+	V4Prompt         *V4Prompt `json:"v4_prompt,omitempty"`
+	V4NegativePrompt *V4Prompt `json:"v4_negative_prompt,omitempty"`
+
+	// Image is the base64 source image for img2img and inpainting.
+	Image string `json:"image,omitempty"`
+	// Mask is the base64 PNG inpainting mask; white areas are redrawn.
+	Mask             string  `json:"mask,omitempty"`
+	Strength         float64 `json:"strength,omitempty"`
+	Noise            float64 `json:"noise,omitempty"`
+	ExtraNoiseSeed   int64   `json:"extra_noise_seed,omitempty"`
+	AddOriginalImage bool    `json:"add_original_image,omitempty"`
+
+	// Vibe transfer reference images (base64) and their settings, by index.
+	ReferenceImageMultiple                []string  `json:"reference_image_multiple,omitempty"`
+	ReferenceInformationExtractedMultiple []float64 `json:"reference_information_extracted_multiple,omitempty"`
+	ReferenceStrengthMultiple             []float64 `json:"reference_strength_multiple,omitempty"`
+}
+
+// DefaultImageParameters returns portrait-sized defaults matching the
+// NovelAI web app.
+func DefaultImageParameters() ImageParameters {
+	return ImageParameters{
+		Width:         832,
+		Height:        1216,
+		Scale:         5,
+		Sampler:       SamplerEulerAncestral,
+		Steps:         28,
+		NSamples:      1,
+		QualityToggle: true,
+		NoiseSchedule: "karras",
+		ParamsVersion: 3,
+	}
+}
+
+// ImageRequest is an image generation request.
+type ImageRequest struct {
+	Input      string          `json:"input"`
+	Model      string          `json:"model"`
+	Action     string          `json:"action"`
+	Parameters ImageParameters `json:"parameters"`
+}
+
+// NewImageRequest creates a text-to-image request. For V4 models the
+// structured prompts are filled in from prompt and params.NegativePrompt.
+func NewImageRequest(model, prompt string, params ImageParameters) *ImageRequest {
+	if strings.HasPrefix(model, "nai-diffusion-4") {
+		if params.V4Prompt == nil {
+			params.V4Prompt = &V4Prompt{Caption: V4Caption{BaseCaption: prompt, CharCaptions: []string{}}, UseOrder: true}
+		}
+		if params.V4NegativePrompt == nil {
+			params.V4NegativePrompt = &V4Prompt{Caption: V4Caption{BaseCaption: params.NegativePrompt, CharCaptions: []string{}}}
+		}
+	}
+	return &ImageRequest{
+		Input:      prompt,
+		Model:      model,
+		Action:     ImageActionGenerate,
+		Parameters: params,
+	}
+}
+
+// GenerateImage sends an image request and returns the generated images,
+// PNG encoded, in sample order.
+func (c *Client) GenerateImage(ctx context.Context, req *ImageRequest) ([][]byte, error) {
+	body, err := c.post(ctx, c.imageURL()+"/ai/generate-image", req)
+	if err != nil {
+		return nil, err
+	}
+	return unzipImages(body)
+}
+
+// unzipImages extracts the files of a zip archive, sorted by name.
+func unzipImages(data []byte) ([][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading image archive: %w", err)
+	}
+	files := append([]*zip.File(nil), zr.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var images [][]byte
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", f.Name, err)
+		}
+		img, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", f.Name, err)
+		}
+		images = append(images, img)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("image archive is empty")
+	}
+	return images, nil
+}
+
+// imageURL returns ImageURL if set, otherwise DefaultImageURL.
+func (c *Client) imageURL() string {
+	if c.ImageURL != "" {
+		return c.ImageURL
+	}
+	return DefaultImageURL
+}
@@ -0,0 +1,137 @@
+package novelai
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Image editing actions.
+const (
+	ImageActionImg2Img = "img2img"
+	ImageActionInfill  = "infill"
+)
+
+// Defaults for image editing.
+const (
+	// DefaultImg2ImgStrength is how much img2img may change the source image.
+	DefaultImg2ImgStrength = 0.7
+	// DefaultVibeInformation is how much information is extracted from a
+	// vibe transfer reference image.
+	DefaultVibeInformation = 1.0
+	// DefaultVibeStrength is how strongly a vibe transfer reference image
+	// influences generation.
+	DefaultVibeStrength = 0.6
+)
+
+// EncodeImage validates that data is a PNG, JPEG or WebP image and returns it
+// base64 encoded, the form the image endpoints take images in.
+func EncodeImage(data []byte) (string, error) {
+	switch ct := http.DetectContentType(data); ct {
+	case "image/png", "image/jpeg", "image/webp":
+		return base64.StdEncoding.EncodeToString(data), nil
+	default:
+		return "", fmt.Errorf("unsupported image type %s", ct)
+	}
+}
+
+// EncodeImageReader reads an image from r and encodes it with EncodeImage.
+func EncodeImageReader(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("error reading image: %w", err)
+	}
+	return EncodeImage(data)
+}
+
+// DecodeImage decodes a base64 image from the API.
+func DecodeImage(encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+	return data, nil
+}
+
+// NewImg2ImgRequest creates a request that redraws image guided by prompt.
+// strength (0-1] controls how much the image may change and noise [0-1)
+// how much noise is added before redrawing.
+func NewImg2ImgRequest(model, prompt string, image []byte, strength, noise float64,
+	params ImageParameters) (*ImageRequest, error) {
+
+	if strength <= 0 || strength > 1 {
+		return nil, fmt.Errorf("img2img strength %v must be in (0, 1]", strength)
+	}
+	if noise < 0 || noise >= 1 {
+		return nil, fmt.Errorf("img2img noise %v must be in [0, 1)", noise)
+	}
+	encoded, err := EncodeImage(image)
+	if err != nil {
+		return nil, err
+	}
+	params.Image = encoded
+	params.Strength = strength
+	params.Noise = noise
+	req := NewImageRequest(model, prompt, params)
+	req.Action = ImageActionImg2Img
+	return req, nil
+}
+
+// NewInpaintRequest creates a request that redraws the parts of image where
+// mask is white, using the inpainting variant of model. mask must be a PNG
+// the same size as image.
+func NewInpaintRequest(model, prompt string, image, mask []byte, params ImageParameters) (*ImageRequest, error) {
+	encoded, err := EncodeImage(image)
+	if err != nil {
+		return nil, err
+	}
+	if ct := http.DetectContentType(mask); ct != "image/png" {
+		return nil, fmt.Errorf("inpainting mask must be a PNG, got %s", ct)
+	}
+	params.Image = encoded
+	params.Mask = base64.StdEncoding.EncodeToString(mask)
+	params.AddOriginalImage = true
+	if params.Strength == 0 {
+		params.Strength = 1
+	}
+	req := NewImageRequest(InpaintingModel(model), prompt, params)
+	req.Action = ImageActionInfill
+	return req, nil
+}
+
+// InpaintingModel returns the inpainting variant of an image model.
+func InpaintingModel(model string) string {
+	if strings.HasSuffix(model, "-inpainting") {
+		return model
+	}
+	return model + "-inpainting"
+}
+
+// AddVibe adds a vibe transfer reference image. information [0-1] is how
+// much detail is taken from the image and strength [0-1] how strongly it
+// steers generation.
+func (p *ImageParameters) AddVibe(image []byte, information, strength float64) error {
+	if information < 0 || information > 1 {
+		return fmt.Errorf("vibe information %v must be in [0, 1]", information)
+	}
+	if strength < 0 || strength > 1 {
+		return fmt.Errorf("vibe strength %v must be in [0, 1]", strength)
+	}
+	encoded, err := EncodeImage(image)
+	if err != nil {
+		return err
+	}
+	p.ReferenceImageMultiple = append(p.ReferenceImageMultiple, encoded)
+	p.ReferenceInformationExtractedMultiple = append(p.ReferenceInformationExtractedMultiple, information)
+	p.ReferenceStrengthMultiple = append(p.ReferenceStrengthMultiple, strength)
+	return nil
+}
+
+// ClearVibes removes all vibe transfer reference images.
+func (p *ImageParameters) ClearVibes() {
+	p.ReferenceImageMultiple = nil
+	p.ReferenceInformationExtractedMultiple = nil
+	p.ReferenceStrengthMultiple = nil
+}
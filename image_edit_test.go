@@ -0,0 +1,127 @@
+package novelai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testPNG returns a small solid PNG.
+func testPNG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestEncodeImage tests base64 encoding and image type validation.
+func TestEncodeImage(t *testing.T) {
+	data := testPNG(t, color.White)
+	encoded, err := EncodeImage(data)
+	if err != nil {
+		t.Fatalf("EncodeImage failed: %v", err)
+	}
+	decoded, err := DecodeImage(encoded)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("Expected round trip, got %v", err)
+	}
+
+	if _, err := EncodeImage([]byte("plain text")); err == nil {
+		t.Error("Expected error for non-image data")
+	}
+	if _, err := EncodeImageReader(bytes.NewReader(data)); err != nil {
+		t.Errorf("EncodeImageReader failed: %v", err)
+	}
+	if _, err := DecodeImage("!!!"); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+}
+
+// TestNewImg2ImgRequest tests img2img parameters and validation.
+func TestNewImg2ImgRequest(t *testing.T) {
+	data := testPNG(t, color.White)
+	req, err := NewImg2ImgRequest(ImageModelV3, "castle", data, 0.5, 0.1, DefaultImageParameters())
+	if err != nil {
+		t.Fatalf("NewImg2ImgRequest failed: %v", err)
+	}
+	if req.Action != ImageActionImg2Img {
+		t.Errorf("Expected action img2img, got %s", req.Action)
+	}
+	p := req.Parameters
+	if p.Strength != 0.5 || p.Noise != 0.1 || p.Image != base64.StdEncoding.EncodeToString(data) {
+		t.Errorf("Unexpected parameters: strength=%v noise=%v", p.Strength, p.Noise)
+	}
+
+	for _, tc := range []struct{ strength, noise float64 }{{0, 0}, {1.5, 0}, {0.5, -0.1}, {0.5, 1}} {
+		if _, err := NewImg2ImgRequest(ImageModelV3, "castle", data, tc.strength, tc.noise, DefaultImageParameters()); err == nil {
+			t.Errorf("Expected error for strength=%v noise=%v", tc.strength, tc.noise)
+		}
+	}
+}
+
+// TestNewInpaintRequest tests the inpainting model, mask and action.
+func TestNewInpaintRequest(t *testing.T) {
+	data := testPNG(t, color.Black)
+	mask := testPNG(t, color.White)
+	req, err := NewInpaintRequest(ImageModelV4, "a hat", data, mask, DefaultImageParameters())
+	if err != nil {
+		t.Fatalf("NewInpaintRequest failed: %v", err)
+	}
+	if req.Model != "nai-diffusion-4-full-inpainting" || req.Action != ImageActionInfill {
+		t.Errorf("Unexpected model/action: %s %s", req.Model, req.Action)
+	}
+	if req.Parameters.Mask == "" || !req.Parameters.AddOriginalImage || req.Parameters.Strength != 1 {
+		t.Errorf("Unexpected parameters: %+v", req.Parameters)
+	}
+	if InpaintingModel(req.Model) != req.Model {
+		t.Error("Expected InpaintingModel to be idempotent")
+	}
+
+	if _, err := NewInpaintRequest(ImageModelV4, "a hat", data, []byte("mask"), DefaultImageParameters()); err == nil {
+		t.Error("Expected error for non-PNG mask")
+	}
+}
+
+// TestAddVibe tests that vibe references are sent as parallel arrays.
+func TestAddVibe(t *testing.T) {
+	client, requests := newImageServer(t, zipImages(t, map[string]string{"image_0.png": "png"}))
+
+	params := DefaultImageParameters()
+	if err := params.AddVibe(testPNG(t, color.White), DefaultVibeInformation, DefaultVibeStrength); err != nil {
+		t.Fatalf("AddVibe failed: %v", err)
+	}
+	if err := params.AddVibe(testPNG(t, color.Black), 0.5, 0.3); err != nil {
+		t.Fatalf("AddVibe failed: %v", err)
+	}
+	if err := params.AddVibe(testPNG(t, color.Black), 2, 0.3); err == nil {
+		t.Error("Expected error for information out of range")
+	}
+
+	if _, err := client.GenerateImage(context.Background(), NewImageRequest(ImageModelV3, "cat", params)); err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	p := (*requests)[0].Parameters
+	if len(p.ReferenceImageMultiple) != 2 {
+		t.Fatalf("Expected 2 reference images, got %d", len(p.ReferenceImageMultiple))
+	}
+	if p.ReferenceInformationExtractedMultiple[1] != 0.5 || p.ReferenceStrengthMultiple[1] != 0.3 {
+		t.Errorf("Unexpected vibe settings: %v %v", p.ReferenceInformationExtractedMultiple, p.ReferenceStrengthMultiple)
+	}
+
+	params.ClearVibes()
+	if len(params.ReferenceImageMultiple) != 0 || len(params.ReferenceStrengthMultiple) != 0 {
+		t.Error("Expected vibes cleared")
+	}
+}
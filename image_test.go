@@ -0,0 +1,111 @@
+package novelai
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// zipImages builds a zip archive holding the given files, as returned by
+// the image endpoint.
+func zipImages(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newImageServer returns a client whose image endpoint returns archive and
+// records each decoded request.
+func newImageServer(t *testing.T, archive []byte) (*Client, *[]ImageRequest) {
+	t.Helper()
+	var requests []ImageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ai/generate-image" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req ImageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid request body: %v", err)
+		}
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/x-zip-compressed")
+		w.Write(archive)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient()
+	client.ApiToken = "test-token"
+	client.ImageURL = server.URL
+	return client, &requests
+}
+
+// TestGenerateImage tests that the archive is unpacked in sample order.
+func TestGenerateImage(t *testing.T) {
+	archive := zipImages(t, map[string]string{"image_1.png": "second", "image_0.png": "first"})
+	client, requests := newImageServer(t, archive)
+
+	params := DefaultImageParameters()
+	params.NSamples = 2
+	images, err := client.GenerateImage(context.Background(), NewImageRequest(ImageModelV3, "1girl, forest", params))
+	if err != nil {
+		t.Fatalf("GenerateImage failed: %v", err)
+	}
+	if len(images) != 2 || string(images[0]) != "first" || string(images[1]) != "second" {
+		t.Errorf("Unexpected images: %q", images)
+	}
+	req := (*requests)[0]
+	if req.Input != "1girl, forest" || req.Model != ImageModelV3 || req.Action != ImageActionGenerate {
+		t.Errorf("Unexpected request: %+v", req)
+	}
+	if req.Parameters.NSamples != 2 || req.Parameters.V4Prompt != nil {
+		t.Errorf("Unexpected parameters: %+v", req.Parameters)
+	}
+}
+
+// TestGenerateImageBadArchive tests that a non-zip response is an error.
+func TestGenerateImageBadArchive(t *testing.T) {
+	client, _ := newImageServer(t, []byte("not a zip"))
+	_, err := client.GenerateImage(context.Background(), NewImageRequest(ImageModelV3, "cat", DefaultImageParameters()))
+	if err == nil {
+		t.Error("Expected error for invalid archive")
+	}
+
+	client, _ = newImageServer(t, zipImages(t, nil))
+	if _, err := client.GenerateImage(context.Background(), NewImageRequest(ImageModelV3, "cat", DefaultImageParameters())); err == nil {
+		t.Error("Expected error for empty archive")
+	}
+}
+
+// TestNewImageRequestV4 tests that V4 models get structured prompts.
+func TestNewImageRequestV4(t *testing.T) {
+	params := DefaultImageParameters()
+	params.NegativePrompt = "blurry"
+	req := NewImageRequest(ImageModelV4_5, "1boy, castle", params)
+
+	p := req.Parameters
+	if p.V4Prompt == nil || p.V4Prompt.Caption.BaseCaption != "1boy, castle" || !p.V4Prompt.UseOrder {
+		t.Errorf("Unexpected v4_prompt: %+v", p.V4Prompt)
+	}
+	if p.V4NegativePrompt == nil || p.V4NegativePrompt.Caption.BaseCaption != "blurry" {
+		t.Errorf("Unexpected v4_negative_prompt: %+v", p.V4NegativePrompt)
+	}
+	data, _ := json.Marshal(req)
+	if !bytes.Contains(data, []byte(`"char_captions":[]`)) {
+		t.Errorf("Expected empty char_captions array, got %s", data)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/wbrown/llmapi"
 )
 
 // Integration tests that hit the real NovelAI API.
@@ -29,7 +31,7 @@ func TestRealAPI_Send(t *testing.T) {
 	conv := NewConversation("You are a helpful assistant. Be very brief.")
 	conv.Settings.MaxTokens = 50
 
-	reply, stopReason, inToks, outToks, err := conv.Send("Say hello in exactly 3 words.")
+	reply, stopReason, inToks, outToks, _, _, err := conv.Send("Say hello in exactly 3 words.", llmapi.Sampling{})
 	skipIfServerError(t, err)
 	if err != nil {
 		t.Fatalf("Send failed: %v", err)
@@ -69,7 +71,7 @@ func TestRealAPI_MultiTurn(t *testing.T) {
 	conv.Settings.Thinking = false // Disable thinking for cleaner output
 
 	// First turn
-	reply1, _, _, _, err := conv.Send("My name is Alice.")
+	reply1, _, _, _, _, _, err := conv.Send("My name is Alice.", llmapi.Sampling{})
 	skipIfServerError(t, err)
 	if err != nil {
 		t.Fatalf("First send failed: %v", err)
@@ -77,7 +79,7 @@ func TestRealAPI_MultiTurn(t *testing.T) {
 	t.Logf("Turn 1: %q", reply1)
 
 	// Second turn - should remember context
-	reply2, _, _, _, err := conv.Send("What is my name?")
+	reply2, _, _, _, _, _, err := conv.Send("What is my name?", llmapi.Sampling{})
 	if err != nil {
 		t.Fatalf("Second send failed: %v", err)
 	}
@@ -109,7 +111,7 @@ func TestRealAPI_Streaming(t *testing.T) {
 		}
 	}
 
-	reply, stopReason, _, _, err := conv.SendStreaming("Count from 1 to 5.", callback)
+	reply, stopReason, _, _, _, _, err := conv.SendStreaming("Count from 1 to 5.", llmapi.Sampling{}, callback)
 	skipIfServerError(t, err)
 	if err != nil {
 		t.Fatalf("SendStreaming failed: %v", err)
@@ -141,7 +143,7 @@ func TestRealAPI_ThinkingEnabled(t *testing.T) {
 	conv.Settings.MaxTokens = 100
 	conv.Settings.Thinking = true // Explicitly enabled (default)
 
-	reply, _, _, _, err := conv.Send("What is 2+2?")
+	reply, _, _, _, _, _, err := conv.Send("What is 2+2?", llmapi.Sampling{})
 	skipIfServerError(t, err)
 	if err != nil {
 		t.Fatalf("Send failed: %v", err)
@@ -162,7 +164,7 @@ func TestRealAPI_ThinkingDisabled(t *testing.T) {
 	conv.Settings.MaxTokens = 100
 	conv.Settings.Thinking = false // Disable thinking
 
-	reply, _, _, _, err := conv.Send("What is 2+2?")
+	reply, _, _, _, _, _, err := conv.Send("What is 2+2?", llmapi.Sampling{})
 	skipIfServerError(t, err)
 	if err != nil {
 		t.Fatalf("Send failed: %v", err)
@@ -190,7 +192,7 @@ func TestRealAPI_StreamingNoThinking(t *testing.T) {
 		}
 	}
 
-	reply, _, _, _, err := conv.SendStreaming("What is 3+3?", callback)
+	reply, _, _, _, _, _, err := conv.SendStreaming("What is 3+3?", llmapi.Sampling{}, callback)
 	skipIfServerError(t, err)
 	if err != nil {
 		t.Fatalf("SendStreaming failed: %v", err)
@@ -206,3 +208,36 @@ func TestRealAPI_StreamingNoThinking(t *testing.T) {
 }
 
 
+
+// TestRealAPI_GLM47StopSequences checks that the GLM-4.7 template's stop
+// sequences end the turn before the model writes the next role token.
+func TestRealAPI_GLM47StopSequences(t *testing.T) {
+	skipIfNoToken(t)
+
+	conv := NewConversation("You are a helpful assistant. Be very brief.")
+	if err := conv.UseModel(ModelGLM47); err != nil {
+		t.Fatalf("UseModel failed: %v", err)
+	}
+	conv.Settings.MaxTokens = 200
+
+	for _, prompt := range []string{"Say hello.", "Now say goodbye."} {
+		reply, stopReason, _, _, _, _, err := conv.Send(prompt, llmapi.Sampling{})
+		skipIfServerError(t, err)
+		if err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		t.Logf("Reply: %q (%s)", reply, stopReason)
+
+		if stopReason != "end_turn" {
+			t.Errorf("Expected end_turn, got %s", stopReason)
+		}
+		for _, stop := range PromptGLM47.StopSequences {
+			if strings.Contains(reply, stop) {
+				t.Errorf("Reply contains stop sequence %q: %q", stop, reply)
+			}
+		}
+		if strings.Contains(reply, "<think>") || strings.Contains(reply, "</think>") {
+			t.Errorf("Expected no think tags with thinking disabled, got %q", reply)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned for a job ID a JobStore does not have.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobRequest is a generation to run in a JobQueue.
+type JobRequest struct {
+	// System is the system prompt.
+	System string `json:"system,omitempty"`
+	// Messages is the history before Text.
+	Messages []Message `json:"messages,omitempty"`
+	// Text is the user message to reply to. If empty, the last message of
+	// Messages is continued.
+	Text string `json:"text,omitempty"`
+	// Settings replace the queue's default settings if set.
+	Settings *Settings `json:"settings,omitempty"`
+	// Sampling overrides the settings for this job.
+	Sampling SamplingProfile `json:"sampling,omitempty"`
+}
+
+// JobRecord is a job as kept in a JobStore.
+type JobRecord struct {
+	ID      string     `json:"id"`
+	Status  JobStatus  `json:"status"`
+	Request JobRequest `json:"request"`
+	// Result is set once the job is done or has failed.
+	Result *JobResult `json:"result,omitempty"`
+	// Attempts is how many times the job has been started.
+	Attempts int       `json:"attempts"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// JobStore persists the jobs of a JobQueue.
+type JobStore interface {
+	// Put creates or replaces a job.
+	Put(rec *JobRecord) error
+	// Get returns a job, or ErrJobNotFound.
+	Get(id string) (*JobRecord, error)
+	// List returns all jobs.
+	List() ([]*JobRecord, error)
+}
+
+// JobQueue runs generation requests durably: jobs are stored before they
+// are accepted, processed by a pool of workers, and resumed after a
+// restart. Jobs interrupted by shutdown go back to pending, and failed
+// jobs are retried up to MaxAttempts times.
+//
+// Set the fields before calling Run; they must not change afterwards.
+type JobQueue struct {
+	// Store keeps the jobs.
+	Store JobStore
+	// Workers is the number of jobs run at once. Values below 1 are
+	// treated as 1. Conversations sharing a token should also share a
+	// RequestQueue, set in New.
+	Workers int
+	// New creates the conversation for a job, before the job's system
+	// prompt, history and settings are applied. Use it to set the token,
+	// request queue and other state jobs do not carry. If nil,
+	// NewConversation is used.
+	New func(req *JobRequest) *Conversation
+	// MaxAttempts is how many times a failing job is tried. If zero, jobs
+	// are tried once.
+	MaxAttempts int
+	// OnComplete, if set, is called with the result of each finished job.
+	OnComplete CompletionFunc
+	// OnError, if set, is called when the store fails.
+	OnError func(id string, err error)
+	// Clock, if set, replaces SystemClock for timestamping jobs.
+	Clock Clock
+
+	mu      sync.Mutex
+	started bool
+	pending []string
+	wake    chan struct{}
+}
+
+// NewJobQueue creates a queue keeping its jobs in store and running them
+// with workers workers.
+func NewJobQueue(store JobStore, workers int) *JobQueue {
+	return &JobQueue{Store: store, Workers: workers}
+}
+
+// Enqueue stores a pending job for req and returns its ID. Jobs enqueued
+// before Run start once it is called.
+func (q *JobQueue) Enqueue(req JobRequest) (string, error) {
+	now := clockOr(q.Clock).Now()
+	rec := &JobRecord{ID: newUUID(), Status: JobPending, Request: req, Created: now, Updated: now}
+	if err := q.Store.Put(rec); err != nil {
+		return "", fmt.Errorf("error storing job: %w", err)
+	}
+	q.mu.Lock()
+	if q.started {
+		q.pending = append(q.pending, rec.ID)
+	}
+	q.mu.Unlock()
+	q.signal()
+	return rec.ID, nil
+}
+
+// Status returns the stored state of job id.
+func (q *JobQueue) Status(id string) (*JobRecord, error) {
+	return q.Store.Get(id)
+}
+
+// Run queues the stored jobs that are pending or were interrupted, oldest
+// first, and processes jobs until ctx is done. Jobs running at that point
+// are cancelled and left pending for the next Run.
+func (q *JobQueue) Run(ctx context.Context) error {
+	// Start before listing, so that jobs enqueued meanwhile are queued by
+	// Enqueue if the listing misses them
+	q.mu.Lock()
+	if q.started {
+		q.mu.Unlock()
+		return fmt.Errorf("job queue already running")
+	}
+	q.started = true
+	q.wake = make(chan struct{}, 1)
+	q.mu.Unlock()
+
+	recs, err := q.Store.List()
+	if err != nil {
+		q.mu.Lock()
+		q.started, q.pending = false, nil
+		q.mu.Unlock()
+		return fmt.Errorf("error listing jobs: %w", err)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Created.Before(recs[j].Created) })
+
+	// Stored jobs go first, then those enqueued since that the listing
+	// missed
+	q.mu.Lock()
+	var pending []string
+	listed := map[string]bool{}
+	for _, rec := range recs {
+		if rec.Status == JobPending || rec.Status == JobRunning {
+			pending = append(pending, rec.ID)
+			listed[rec.ID] = true
+		}
+	}
+	for _, id := range q.pending {
+		if !listed[id] {
+			pending = append(pending, id)
+		}
+	}
+	q.pending = pending
+	q.mu.Unlock()
+	q.signal()
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(q.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	q.mu.Lock()
+	q.started, q.pending = false, nil
+	q.mu.Unlock()
+	return ctx.Err()
+}
+
+// work processes jobs until ctx is done.
+func (q *JobQueue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		id, ok := q.next()
+		if !ok {
+			select {
+			case <-q.wake:
+			case <-ctx.Done():
+			}
+			continue
+		}
+		// Pass the wakeup on in case more jobs are waiting
+		q.signal()
+		q.process(ctx, id)
+	}
+}
+
+// next removes and returns the next pending job ID.
+func (q *JobQueue) next() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return "", false
+	}
+	id := q.pending[0]
+	q.pending = q.pending[1:]
+	return id, true
+}
+
+// signal wakes a waiting worker.
+func (q *JobQueue) signal() {
+	q.mu.Lock()
+	wake := q.wake
+	q.mu.Unlock()
+	if wake == nil {
+		return
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// process runs job id and stores the outcome.
+func (q *JobQueue) process(ctx context.Context, id string) {
+	rec, err := q.Store.Get(id)
+	if err != nil {
+		q.storeError(id, err)
+		return
+	}
+	rec.Status = JobRunning
+	rec.Attempts++
+	rec.Updated = clockOr(q.Clock).Now()
+	if err := q.Store.Put(rec); err != nil {
+		q.storeError(id, err)
+		return
+	}
+
+	conv := q.conversation(&rec.Request)
+	conv.Ctx = ctx
+	reply, stopReason, inToks, outToks, _, _, err := conv.SendWith(rec.Request.Text, rec.Request.Sampling)
+	if ctx.Err() != nil {
+		// Interrupted by shutdown; run again next time
+		rec.Status = JobPending
+		rec.Attempts--
+		rec.Updated = clockOr(q.Clock).Now()
+		q.storeError(id, q.Store.Put(rec))
+		return
+	}
+
+	r := &JobResult{
+		JobID:        id,
+		Status:       JobDone,
+		Reply:        reply,
+		StopReason:   stopReason,
+		InputTokens:  inToks,
+		OutputTokens: outToks,
+		Err:          err,
+	}
+	if err != nil {
+		r.Status, r.Error = JobFailed, err.Error()
+	}
+	retry := err != nil && rec.Attempts < q.MaxAttempts
+	if retry {
+		rec.Status = JobPending
+	} else {
+		rec.Status = r.Status
+	}
+	rec.Result = r
+	rec.Updated = clockOr(q.Clock).Now()
+	if err := q.Store.Put(rec); err != nil {
+		q.storeError(id, err)
+		return
+	}
+	if retry {
+		q.mu.Lock()
+		q.pending = append(q.pending, id)
+		q.mu.Unlock()
+		q.signal()
+		return
+	}
+	if q.OnComplete != nil {
+		q.OnComplete(r)
+	}
+}
+
+// conversation builds the conversation for req.
+func (q *JobQueue) conversation(req *JobRequest) *Conversation {
+	var conv *Conversation
+	if q.New != nil {
+		conv = q.New(req)
+		conv.System = req.System
+	} else {
+		conv = NewConversation(req.System)
+	}
+	conv.Messages = copyMessages(req.Messages)
+	if req.Settings != nil {
+		conv.Settings = req.Settings.Clone()
+	}
+	return conv
+}
+
+// storeError reports a store failure to OnError, if err is not nil.
+func (q *JobQueue) storeError(id string, err error) {
+	if err != nil && q.OnError != nil {
+		q.OnError(id, fmt.Errorf("error storing job: %w", err))
+	}
+}
+
+// FileJobStore stores each job as a JSON file in Dir.
+type FileJobStore struct {
+	Dir string
+	// Redactor, if set, redacts finished jobs before they are stored.
+	Redactor *Redactor
+}
+
+// Put implements JobStore. The file is replaced atomically.
+func (f FileJobStore) Put(rec *JobRecord) error {
+	data, err := json.Marshal(f.Redactor.RedactJob(rec))
+	if err != nil {
+		return fmt.Errorf("error marshaling job: %w", err)
+	}
+	return writeFileAtomic(f.path(rec.ID), data)
+}
+
+// Get implements JobStore.
+func (f FileJobStore) Get(id string) (*JobRecord, error) {
+	return f.read(f.path(id))
+}
+
+// List implements JobStore.
+func (f FileJobStore) List() ([]*JobRecord, error) {
+	entries, err := os.ReadDir(f.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var recs []*JobRecord
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		rec, err := f.read(filepath.Join(f.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// read loads the job in path.
+func (f FileJobStore) read(path string) (*JobRecord, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec JobRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("error parsing job %s: %w", filepath.Base(path), err)
+	}
+	return &rec, nil
+}
+
+// path returns the file for job id.
+func (f FileJobStore) path(id string) string {
+	return filepath.Join(f.Dir, url.PathEscape(id)+".json")
+}
@@ -0,0 +1,191 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runUntil runs q until done returns true, then stops it.
+func runUntil(t *testing.T, q *JobQueue, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- q.Run(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("timed out waiting for jobs")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want context.Canceled", err)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	fake := NewFakeBackend().
+		On(`Write a haiku`, FakeResponse{Text: "Autumn moonlight."}).
+		On(`Continue`, FakeResponse{Text: "And then it rained."})
+	store := FileJobStore{Dir: t.TempDir()}
+	q := NewJobQueue(store, 2)
+	q.New = func(req *JobRequest) *Conversation {
+		conv := NewConversation("")
+		fake.Install(conv)
+		return conv
+	}
+	var mu sync.Mutex
+	var completed []string
+	q.OnComplete = func(r *JobResult) {
+		mu.Lock()
+		completed = append(completed, r.Reply)
+		mu.Unlock()
+	}
+
+	// Enqueued before Run, and a job interrupted by a previous crash
+	first, err := q.Enqueue(JobRequest{System: "You are a poet.", Text: "Write a haiku."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed := &JobRecord{ID: "crashed", Status: JobRunning, Attempts: 1, Created: time.Now(),
+		Request: JobRequest{Messages: []Message{{Role: "user", Content: "Continue the story."}}}}
+	if err := store.Put(crashed); err != nil {
+		t.Fatal(err)
+	}
+
+	runUntil(t, q, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(completed) == 2
+	})
+
+	rec, err := q.Status(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != JobDone || rec.Result.Reply != "Autumn moonlight." || rec.Attempts != 1 {
+		t.Errorf("Unexpected record: %+v", rec)
+	}
+	if rec, _ := q.Status("crashed"); rec.Status != JobDone || rec.Result.Reply != "And then it rained." {
+		t.Errorf("Expected the interrupted job resumed, got %+v", rec)
+	}
+	if _, err := q.Status("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if prompt := fake.Requests()[0].Prompt; prompt == "" {
+		t.Error("Expected a request")
+	}
+}
+
+func TestJobQueueRetry(t *testing.T) {
+	fake := NewFakeBackend().On(`.`,
+		FakeResponse{StatusCode: 500, Body: "overloaded"},
+		FakeResponse{Text: "Finally."})
+	store := FileJobStore{Dir: t.TempDir()}
+	q := NewJobQueue(store, 1)
+	q.MaxAttempts = 2
+	q.New = func(req *JobRequest) *Conversation {
+		conv := NewConversation("")
+		fake.Install(conv)
+		return conv
+	}
+
+	id, err := q.Enqueue(JobRequest{Text: "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runUntil(t, q, func() bool {
+		rec, err := q.Status(id)
+		return err == nil && (rec.Status == JobDone || rec.Status == JobFailed)
+	})
+	rec, _ := q.Status(id)
+	if rec.Status != JobDone || rec.Attempts != 2 || rec.Result.Reply != "Finally." {
+		t.Errorf("Expected success on the second attempt, got %+v", rec)
+	}
+}
+
+func TestJobQueueFailure(t *testing.T) {
+	fake := NewFakeBackend().On(`.`, FakeResponse{StatusCode: 500, Body: "overloaded"})
+	q := NewJobQueue(FileJobStore{Dir: t.TempDir()}, 1)
+	q.New = func(req *JobRequest) *Conversation {
+		conv := NewConversation("")
+		fake.Install(conv)
+		return conv
+	}
+	results := make(chan *JobResult, 1)
+	q.OnComplete = func(r *JobResult) { results <- r }
+
+	id, _ := q.Enqueue(JobRequest{Text: "Hello"})
+	var r *JobResult
+	runUntil(t, q, func() bool {
+		select {
+		case r = <-results:
+			return true
+		default:
+			return false
+		}
+	})
+	rec, _ := q.Status(id)
+	if r.Status != JobFailed || rec.Status != JobFailed || rec.Result.Error == "" {
+		t.Errorf("Expected a failed job, got %+v", rec)
+	}
+}
+
+// listHookStore calls onList before listing its jobs.
+type listHookStore struct {
+	FileJobStore
+	onList func()
+}
+
+func (s listHookStore) List() ([]*JobRecord, error) {
+	recs, err := s.FileJobStore.List()
+	s.onList()
+	return recs, err
+}
+
+// TestJobQueueEnqueueWhileStarting tests a job enqueued while Run lists the
+// stored jobs.
+func TestJobQueueEnqueueWhileStarting(t *testing.T) {
+	fake := NewFakeBackend().On(`.`, FakeResponse{Text: "Done."})
+	var store listHookStore
+	store.Dir = t.TempDir()
+	q := NewJobQueue(nil, 1)
+	q.New = func(req *JobRequest) *Conversation {
+		conv := NewConversation("")
+		fake.Install(conv)
+		return conv
+	}
+	var mu sync.Mutex
+	var completed []string
+	q.OnComplete = func(r *JobResult) {
+		mu.Lock()
+		completed = append(completed, r.JobID)
+		mu.Unlock()
+	}
+	var late string
+	store.onList = func() {
+		var err error
+		if late, err = q.Enqueue(JobRequest{Text: "Late"}); err != nil {
+			t.Error(err)
+		}
+	}
+	q.Store = store
+	stored, err := q.Enqueue(JobRequest{Text: "Stored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runUntil(t, q, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(completed) == 2
+	})
+	if completed[0] != stored || completed[1] != late {
+		t.Errorf("completed %v, want [%s %s]", completed, stored, late)
+	}
+}
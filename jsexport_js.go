@@ -0,0 +1,108 @@
+package novelai
+
+import (
+	"context"
+	"sync"
+	"syscall/js"
+)
+
+// ExportJS makes c available to JavaScript as the global object name, for
+// web frontends embedding the client. The object has the methods:
+//
+//	send(text)           a Promise of the reply
+//	stream(text, onText) a Promise of the reply, calling onText(text, done)
+//	                     as the reply streams in
+//	cancel()             aborts the request in progress
+//
+// Requests go through the browser's fetch, which streams the response
+// body, and run on their own goroutines: blocking in a JavaScript callback
+// would deadlock, as fetch cannot complete until the callback returns.
+// Requests are serialized, as a Conversation is not safe for concurrent
+// use. The returned function removes the object and releases its methods.
+func ExportJS(name string, c *Conversation) (release func()) {
+	var mu sync.Mutex
+	var cancelMu sync.Mutex
+	cancel := context.CancelFunc(func() {})
+
+	// run sends text, streaming to onText if it is a function
+	run := func(text string, onText js.Value) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		prev := c.Ctx
+		ctx, stop := context.WithCancel(c.context())
+		defer stop()
+		cancelMu.Lock()
+		cancel = stop
+		cancelMu.Unlock()
+		c.SetContext(ctx)
+		defer c.SetContext(prev)
+		if onText.Type() != js.TypeFunction {
+			reply, _, _, _, _, _, err := c.SendWith(text, SamplingProfile{})
+			return reply, err
+		}
+		reply, _, _, _, _, _, err := c.SendStreamingWith(text, SamplingProfile{},
+			func(text string, done bool) {
+				onText.Invoke(text, done)
+			})
+		return reply, err
+	}
+
+	funcs := []js.Func{
+		js.FuncOf(func(this js.Value, args []js.Value) any {
+			return jsPromise(func() (any, error) {
+				return run(jsArg(args, 0).String(), js.Undefined())
+			})
+		}),
+		js.FuncOf(func(this js.Value, args []js.Value) any {
+			return jsPromise(func() (any, error) {
+				return run(jsArg(args, 0).String(), jsArg(args, 1))
+			})
+		}),
+		js.FuncOf(func(this js.Value, args []js.Value) any {
+			cancelMu.Lock()
+			defer cancelMu.Unlock()
+			cancel()
+			return nil
+		}),
+	}
+	obj := js.Global().Get("Object").New()
+	obj.Set("send", funcs[0])
+	obj.Set("stream", funcs[1])
+	obj.Set("cancel", funcs[2])
+	js.Global().Set(name, obj)
+
+	return func() {
+		js.Global().Delete(name)
+		for _, f := range funcs {
+			f.Release()
+		}
+	}
+}
+
+// jsArg returns argument i, or undefined if missing.
+func jsArg(args []js.Value, i int) js.Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return js.Undefined()
+}
+
+// jsPromise returns a Promise settled with the result of fn, which runs on
+// its own goroutine.
+func jsPromise(fn func() (any, error)) js.Value {
+	executor := js.FuncOf(func(this js.Value, args []js.Value) any {
+		resolve, reject := args[0], args[1]
+		go func() {
+			v, err := fn()
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(v)
+		}()
+		return nil
+	})
+	// The executor runs before the constructor returns
+	defer executor.Release()
+	return js.Global().Get("Promise").New(executor)
+}
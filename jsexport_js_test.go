@@ -0,0 +1,65 @@
+package novelai
+
+import (
+	"syscall/js"
+	"testing"
+)
+
+// await waits for a Promise, returning its value or rejection.
+func await(p js.Value) (value js.Value, rejected bool) {
+	ch := make(chan bool, 1)
+	then := js.FuncOf(func(this js.Value, args []js.Value) any {
+		value = args[0]
+		ch <- false
+		return nil
+	})
+	catch := js.FuncOf(func(this js.Value, args []js.Value) any {
+		value = args[0]
+		ch <- true
+		return nil
+	})
+	defer then.Release()
+	defer catch.Release()
+	p.Call("then", then, catch)
+	rejected = <-ch
+	return value, rejected
+}
+
+func TestExportJS(t *testing.T) {
+	fake := NewFakeBackend().
+		On(`Please stream`, FakeResponse{Text: "One two three"}).
+		On(`weather`, FakeResponse{Text: "Sunny today."})
+	conv := NewConversationWithClient(nil, ConversationConfig{ApiToken: "test-token", Settings: BuiltinSettings()})
+	fake.Install(conv)
+	release := ExportJS("naiTest", conv)
+	defer release()
+
+	obj := js.Global().Get("naiTest")
+	reply, rejected := await(obj.Call("send", "What's the weather?"))
+	if rejected || reply.String() != "Sunny today." {
+		t.Errorf("send: got %v (rejected %v)", reply, rejected)
+	}
+
+	var streamed string
+	var dones int
+	onText := js.FuncOf(func(this js.Value, args []js.Value) any {
+		streamed += args[0].String()
+		if args[1].Bool() {
+			dones++
+		}
+		return nil
+	})
+	defer onText.Release()
+	reply, rejected = await(obj.Call("stream", "Please stream", onText))
+	if rejected || reply.String() != "One two three" || streamed != "One two three" || dones != 1 {
+		t.Errorf("stream: got %v (rejected %v), streamed %q, done %d times", reply, rejected, streamed, dones)
+	}
+	if len(conv.Messages) != 4 {
+		t.Errorf("Expected 4 messages, got %d", len(conv.Messages))
+	}
+
+	release()
+	if !js.Global().Get("naiTest").IsUndefined() {
+		t.Error("release did not remove the object")
+	}
+}
@@ -0,0 +1,144 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultKeepaliveInterval is the time between keepalive probes if
+// Keepalive.Interval is zero.
+const DefaultKeepaliveInterval = 5 * time.Minute
+
+// KeepaliveEventKind is the outcome of a keepalive probe.
+type KeepaliveEventKind string
+
+const (
+	// KeepaliveValid is emitted when the API accepted the token.
+	KeepaliveValid KeepaliveEventKind = "valid"
+	// KeepaliveExpired is emitted when the API rejected the token.
+	KeepaliveExpired KeepaliveEventKind = "expired"
+	// KeepaliveFailed is emitted when the API was unreachable or failed,
+	// leaving the token's validity unknown.
+	KeepaliveFailed KeepaliveEventKind = "failed"
+)
+
+// KeepaliveEvent is the outcome of a keepalive probe.
+type KeepaliveEvent struct {
+	Kind KeepaliveEventKind
+	// Changed reports that the token's validity differs from the last
+	// probe that could tell, such as the first rejection of a token that
+	// was accepted. The first probe counts as a change.
+	Changed bool
+	// Ping is the result of the probe.
+	Ping *PingResult
+	// Err is the error of the probe, unset for KeepaliveValid.
+	Err error
+	// WarmErr is the error of warming up the text connection, if
+	// Keepalive.WarmText is set and it failed.
+	WarmErr error
+}
+
+// Keepalive configures StartKeepalive.
+type Keepalive struct {
+	// Interval is the time between probes. If zero,
+	// DefaultKeepaliveInterval is used.
+	Interval time.Duration
+	// Timeout limits each probe. If zero, the probe is limited only by
+	// HttpClient.
+	Timeout time.Duration
+	// WarmText also sends a request to the text generation host with each
+	// probe, keeping a connection to it open so that the next generation
+	// skips the connection setup.
+	WarmText bool
+	// OnEvent receives the outcome of each probe. Check for
+	// KeepaliveExpired with Changed set to notice credentials expiring
+	// before a user-facing request fails.
+	OnEvent func(KeepaliveEvent)
+}
+
+// StartKeepalive probes the API with Ping in the background, once at the
+// start and then every Interval, validating the token and keeping a
+// connection warm for long-running services. It runs until stop is called
+// or the client is shut down; stop waits for a probe in flight to end.
+func (c *Client) StartKeepalive(k Keepalive) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, done, err := c.track(ctx)
+	if err != nil {
+		cancel()
+		return func() {}
+	}
+	interval := k.Interval
+	if interval <= 0 {
+		interval = DefaultKeepaliveInterval
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last KeepaliveEventKind
+		for {
+			ev := c.keepaliveProbe(ctx, k)
+			if ctx.Err() != nil {
+				return
+			}
+			if ev.Kind != KeepaliveFailed {
+				ev.Changed = ev.Kind != last
+				last = ev.Kind
+			}
+			if k.OnEvent != nil {
+				k.OnEvent(ev)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-stopped
+	}
+}
+
+// keepaliveProbe pings the API and warms up the text connection if asked.
+func (c *Client) keepaliveProbe(ctx context.Context, k Keepalive) KeepaliveEvent {
+	if k.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, k.Timeout)
+		defer cancel()
+	}
+	ev := KeepaliveEvent{Kind: KeepaliveValid}
+	ev.Ping, ev.Err = c.Ping(ctx)
+	switch {
+	case ev.Err == nil:
+	case ev.Ping.StatusCode == http.StatusUnauthorized || ev.Ping.StatusCode == http.StatusForbidden:
+		ev.Kind = KeepaliveExpired
+	default:
+		ev.Kind = KeepaliveFailed
+	}
+	if k.WarmText {
+		ev.WarmErr = c.warmText(ctx)
+	}
+	return ev
+}
+
+// warmText sends a HEAD request to the text generation host. Any response
+// leaves a connection open for reuse.
+func (c *Client) warmText(ctx context.Context) error {
+	req, err := newRequest(ctx, "HEAD", c.textURL(), c.ApiToken, "", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("error warming text connection: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
@@ -0,0 +1,107 @@
+package novelai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepalive(t *testing.T) {
+	var valid, warmed atomic.Int32
+	valid.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "HEAD":
+			warmed.Add(1)
+		case valid.Load() == 0:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	client := NewClient()
+	client.ApiToken = "token"
+	client.APIURL = server.URL
+	client.TextURL = server.URL
+
+	events := make(chan KeepaliveEvent, 100)
+	stop := client.StartKeepalive(Keepalive{
+		Interval: 10 * time.Millisecond,
+		WarmText: true,
+		OnEvent:  func(ev KeepaliveEvent) { events <- ev },
+	})
+	defer stop()
+
+	ev := <-events
+	if ev.Kind != KeepaliveValid || !ev.Changed || ev.Err != nil || ev.WarmErr != nil {
+		t.Errorf("first event = %+v", ev)
+	}
+	if ev := <-events; ev.Kind != KeepaliveValid || ev.Changed {
+		t.Errorf("second event = %+v", ev)
+	}
+	if warmed.Load() == 0 {
+		t.Error("text connection not warmed")
+	}
+
+	// The token expires: one changed event, then unchanged ones
+	valid.Store(0)
+	for ev = <-events; ev.Kind == KeepaliveValid; ev = <-events {
+	}
+	if ev.Kind != KeepaliveExpired || !ev.Changed || ev.Err == nil {
+		t.Errorf("expiry event = %+v", ev)
+	}
+	if ev := <-events; ev.Kind != KeepaliveExpired || ev.Changed {
+		t.Errorf("event after expiry = %+v", ev)
+	}
+
+	// No probes once stop returns
+	stop()
+	pending := len(events)
+	time.Sleep(30 * time.Millisecond)
+	if len(events) != pending {
+		t.Error("probe after stop")
+	}
+}
+
+func TestKeepaliveFailedKeepsState(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := NewClient()
+	client.APIURL = server.URL
+
+	events := make(chan KeepaliveEvent, 100)
+	stop := client.StartKeepalive(Keepalive{
+		Interval: time.Hour,
+		OnEvent:  func(ev KeepaliveEvent) { events <- ev },
+	})
+	ev := <-events
+	stop()
+	if ev.Kind != KeepaliveFailed || ev.Changed || ev.Err == nil {
+		t.Errorf("unreachable event = %+v", ev)
+	}
+}
+
+func TestKeepaliveStopsOnClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := NewClient()
+	client.APIURL = server.URL
+
+	events := make(chan KeepaliveEvent, 100)
+	stop := client.StartKeepalive(Keepalive{
+		Interval: time.Hour,
+		OnEvent:  func(ev KeepaliveEvent) { events <- ev },
+	})
+	<-events
+	// Close waits for the keepalive to stop rather than for the next tick
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if stop := client.StartKeepalive(Keepalive{}); stop == nil {
+		t.Error("StartKeepalive after Close returned nil")
+	} else {
+		stop()
+	}
+}
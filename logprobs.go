@@ -0,0 +1,62 @@
+package novelai
+
+import "math"
+
+// TokenLogprob is the log probability of a generated token.
+type TokenLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	// Top are the log probabilities of the most likely tokens at this
+	// position, by token, when requested with Settings.Logprobs.
+	Top map[string]float64 `json:"top,omitempty"`
+}
+
+// tokens converts the log probabilities of a response. It returns nil if
+// l is nil.
+func (l *completionLogprobs) tokens() []TokenLogprob {
+	if l == nil {
+		return nil
+	}
+	tokens := make([]TokenLogprob, 0, len(l.Tokens))
+	for i, tok := range l.Tokens {
+		t := TokenLogprob{Token: tok}
+		if i < len(l.TokenLogprobs) {
+			t.Logprob = l.TokenLogprobs[i]
+		}
+		if i < len(l.TopLogprobs) {
+			t.Top = l.TopLogprobs[i]
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// Entropy estimates the mean entropy, in nats, of the distributions that
+// tokens were sampled from. Each distribution is estimated from its top
+// alternatives, renormalized; a token without alternatives counts its
+// surprisal, -Logprob. Low entropy means the model is nearly certain of
+// each token, as when it is looping; high entropy means it is choosing
+// among many, as when it is losing coherence. Returns 0 for no tokens.
+func Entropy(tokens []TokenLogprob) float64 {
+	if len(tokens) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, t := range tokens {
+		if len(t.Top) == 0 {
+			sum -= t.Logprob
+			continue
+		}
+		var total, h float64
+		for _, lp := range t.Top {
+			total += math.Exp(lp)
+		}
+		for _, lp := range t.Top {
+			if p := math.Exp(lp) / total; p > 0 {
+				h -= p * math.Log(p)
+			}
+		}
+		sum += h
+	}
+	return sum / float64(len(tokens))
+}
@@ -0,0 +1,76 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// logprobsJSON is a choice's logprobs for the tokens "Hi" and "!".
+const logprobsJSON = `{"tokens":["Hi","!"],"token_logprobs":[-0.1,-0.5],` +
+	`"top_logprobs":[{"Hi":-0.1,"Hey":-2.4},{"!":-0.5,".":-1.0}]}`
+
+func TestLogprobs(t *testing.T) {
+	var requested []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requested = append(requested, req.Logprobs)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"text\":\"Hi!\",\"logprobs\":%s}]}\n\n", logprobsJSON)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"text\":\"\",\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"text":"Hi!","finish_reason":"stop","logprobs":%s}]}`, logprobsJSON)
+	}))
+	defer server.Close()
+	conv := NewConversation("")
+	conv.ApiToken = "test-token"
+	conv.Endpoint = server.URL
+	conv.Settings.Logprobs = 2
+
+	for _, stream := range []bool{false, true} {
+		conv.LastLogprobs = nil
+		var err error
+		if stream {
+			_, _, _, _, _, _, err = conv.SendStreamingWith("Hello", SamplingProfile{}, nil)
+		} else {
+			_, _, _, _, _, _, err = conv.SendWith("Hello", SamplingProfile{})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lp := conv.LastLogprobs
+		if len(lp) != 2 || lp[0].Token != "Hi" || lp[1].Logprob != -0.5 || lp[1].Top["."] != -1.0 {
+			t.Errorf("Unexpected logprobs (stream %v): %+v", stream, lp)
+		}
+	}
+	if len(requested) != 2 || requested[0] != 2 || requested[1] != 2 {
+		t.Errorf("Expected logprobs requested, got %v", requested)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	uniform := map[string]float64{"a": math.Log(0.25), "b": math.Log(0.25), "c": math.Log(0.25), "d": math.Log(0.25)}
+	tests := []struct {
+		name   string
+		tokens []TokenLogprob
+		want   float64
+	}{
+		{"none", nil, 0},
+		{"uniform", []TokenLogprob{{Top: uniform}}, math.Log(4)},
+		{"certain", []TokenLogprob{{Top: map[string]float64{"a": 0}}}, 0},
+		{"surprisal", []TokenLogprob{{Logprob: -2}, {Top: uniform}}, (2 + math.Log(4)) / 2},
+		// Top alternatives are renormalized
+		{"partial", []TokenLogprob{{Top: map[string]float64{"a": math.Log(0.3), "b": math.Log(0.3)}}}, math.Log(2)},
+	}
+	for _, tt := range tests {
+		if got := Entropy(tt.tokens); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: Entropy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package novelai
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/wbrown/novelai/textsim"
+)
+
+// LoopDetection configures detection of a model stuck repeating the same
+// phrase. The zero value disables it.
+type LoopDetection struct {
+	// NGram is the length, in words, of the phrases compared.
+	NGram int
+	// Window is how many recent words are searched for repeats. If zero,
+	// 32 times NGram is used, or 256 if NGram is zero.
+	Window int
+	// MaxRepeats is how many times a phrase may occur within the window
+	// before the reply counts as looping.
+	MaxRepeats int
+	// NearRepeat, if set, also counts the reply as looping when a
+	// paragraph of at least NGram words is this similar, by
+	// textsim.RougeL, to an earlier one within the window. It catches a
+	// model rewording the same paragraph, which exact phrases miss.
+	NearRepeat float64
+}
+
+// DefaultLoopDetection catches a phrase of eight words repeated four times
+// within the last few paragraphs, which ordinary prose rarely does.
+var DefaultLoopDetection = LoopDetection{NGram: 8, Window: 400, MaxRepeats: 3}
+
+// Enabled reports whether l detects loops.
+func (l LoopDetection) Enabled() bool {
+	return l.NGram > 0 && l.MaxRepeats > 0 || l.NearRepeat > 0
+}
+
+// LoopDetector finds repeated phrases in text as it is streamed.
+type LoopDetector struct {
+	cfg     LoopDetection
+	words   []string
+	partial strings.Builder
+	counts  map[string]int
+	phrase  string
+	// newlines counts the newlines since the last word, and paragraph
+	// holds the words of the paragraph in progress; paragraphs are the
+	// recent complete ones.
+	newlines   int
+	paragraph  []string
+	paragraphs [][]string
+}
+
+// NewLoopDetector creates a detector for cfg.
+func NewLoopDetector(cfg LoopDetection) *LoopDetector {
+	if cfg.Window < cfg.NGram || cfg.Window == 0 {
+		cfg.Window = 32 * cfg.NGram
+		if cfg.Window == 0 {
+			cfg.Window = 256
+		}
+	}
+	return &LoopDetector{cfg: cfg, counts: make(map[string]int)}
+}
+
+// Write adds streamed text and reports whether the text so far is looping.
+// Words split across writes are joined before they are compared.
+func (d *LoopDetector) Write(text string) bool {
+	if !d.cfg.Enabled() || d.phrase != "" {
+		return d.phrase != ""
+	}
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			d.endWord()
+			if r == '\n' {
+				if d.newlines++; d.newlines == 2 {
+					d.endParagraph()
+				}
+			}
+			continue
+		}
+		d.newlines = 0
+		d.partial.WriteRune(unicode.ToLower(r))
+	}
+	return d.phrase != ""
+}
+
+// Looping reports whether a loop has been detected.
+func (d *LoopDetector) Looping() bool {
+	return d.phrase != ""
+}
+
+// Phrase returns the repeated phrase, or "" if no loop was detected.
+func (d *LoopDetector) Phrase() string {
+	return d.phrase
+}
+
+// endWord adds the pending word and counts the phrase it completes.
+func (d *LoopDetector) endWord() {
+	if d.partial.Len() == 0 || d.phrase != "" {
+		return
+	}
+	word := d.partial.String()
+	d.partial.Reset()
+	d.paragraph = append(d.paragraph, word)
+	if d.cfg.NGram == 0 || d.cfg.MaxRepeats == 0 {
+		return
+	}
+	d.words = append(d.words, word)
+
+	n := d.cfg.NGram
+	if len(d.words) > d.cfg.Window {
+		// Forget the phrase starting at the word leaving the window
+		oldest := strings.Join(d.words[:n], " ")
+		if d.counts[oldest]--; d.counts[oldest] <= 0 {
+			delete(d.counts, oldest)
+		}
+		d.words = d.words[1:]
+	}
+	if len(d.words) < n {
+		return
+	}
+	phrase := strings.Join(d.words[len(d.words)-n:], " ")
+	d.counts[phrase]++
+	if d.counts[phrase] > d.cfg.MaxRepeats {
+		d.phrase = phrase
+	}
+}
+
+// endParagraph compares the paragraph just completed with the recent ones,
+// if NearRepeat is set.
+func (d *LoopDetector) endParagraph() {
+	para := d.paragraph
+	d.paragraph = nil
+	if d.cfg.NearRepeat <= 0 || d.phrase != "" || len(para) == 0 || len(para) < d.cfg.NGram {
+		return
+	}
+	text := strings.Join(para, " ")
+	for _, prev := range d.paragraphs {
+		if textsim.RougeL(strings.Join(prev, " "), text) >= d.cfg.NearRepeat {
+			d.phrase = text
+			return
+		}
+	}
+	d.paragraphs = append(d.paragraphs, para)
+	// Keep the paragraphs within the window
+	words := 0
+	for i := len(d.paragraphs) - 1; i >= 0; i-- {
+		if words += len(d.paragraphs[i]); words > d.cfg.Window {
+			d.paragraphs = d.paragraphs[i+1:]
+			break
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// TestLoopDetector tests detecting a repeated phrase across chunks.
+func TestLoopDetector(t *testing.T) {
+	d := NewLoopDetector(LoopDetection{NGram: 3, Window: 50, MaxRepeats: 2})
+	for _, chunk := range []string{"The waves ", "crashed. The wa", "ves crashed. ", "The waves crashed."} {
+		if d.Write(chunk) {
+			t.Fatalf("Unexpected loop after %q", chunk)
+		}
+	}
+	if !d.Write(" The waves crashed. ") {
+		t.Fatal("Expected loop on third occurrence")
+	}
+	if d.Phrase() != "the waves crashed." {
+		t.Errorf("Unexpected phrase: %q", d.Phrase())
+	}
+	if !d.Looping() || !d.Write("anything") {
+		t.Error("Expected detector to stay looping")
+	}
+}
+
+// TestLoopDetectorWindow tests that repeats outside the window are forgotten.
+func TestLoopDetectorWindow(t *testing.T) {
+	d := NewLoopDetector(LoopDetection{NGram: 2, Window: 6, MaxRepeats: 1})
+	d.Write("red sky one two three four five six ")
+	if d.Write("red sky ") {
+		t.Error("Expected repeat outside the window to be ignored")
+	}
+	if !d.Write("red sky ") {
+		t.Error("Expected repeat inside the window to be detected")
+	}
+
+	off := NewLoopDetector(LoopDetection{})
+	if off.Write(strings.Repeat("again ", 100)) {
+		t.Error("Expected zero config to disable detection")
+	}
+}
+
+// TestStreamingLoopDetection tests that a looping stream is cut off.
+func TestStreamingLoopDetection(t *testing.T) {
+	conv, cancelled := newRunawayServer(t, "again ")
+	conv.Settings.LoopDetection = LoopDetection{NGram: 1, MaxRepeats: 3}
+	reply, stop, _, _, _, _, err := conv.SendStreaming("Go", llmapi.Sampling{}, nil)
+	if err != nil {
+		t.Fatalf("SendStreaming failed: %v", err)
+	}
+	if StopReason(stop) != StopLoopDetected {
+		t.Errorf("Expected %s, got %s", StopLoopDetected, stop)
+	}
+	if !strings.HasPrefix(reply, "again ") || len(reply) > 100 {
+		t.Errorf("Expected short partial reply, got %q", reply)
+	}
+	<-cancelled
+}
+
+// TestLoopDetectorNearRepeat tests detecting a reworded paragraph.
+func TestLoopDetectorNearRepeat(t *testing.T) {
+	d := NewLoopDetector(LoopDetection{NGram: 4, NearRepeat: 0.8})
+	if d.Write("The keeper climbed the stairs to the lamp room.\n\nOutside, the storm grew worse.\n\n") {
+		t.Fatal("Unexpected loop in distinct paragraphs")
+	}
+	if d.Write("Yes.\n\nYes.\n\n") {
+		t.Fatal("Unexpected loop in paragraphs shorter than NGram")
+	}
+	if !d.Write("The keeper climbed up the stairs to the lamp room\n\n") {
+		t.Fatal("Expected reworded paragraph to be detected")
+	}
+	if d.Phrase() != "the keeper climbed up the stairs to the lamp room" {
+		t.Errorf("Unexpected phrase: %q", d.Phrase())
+	}
+}
@@ -0,0 +1,183 @@
+package novelai
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NewLorebookEntry creates an enabled entry with default context settings.
+// The ID is assigned when the entry is added to a lorebook.
+func NewLorebookEntry(displayName, text string, keys ...string) LorebookEntry {
+	return LorebookEntry{
+		Text:           text,
+		ContextCfg:     DefaultContextConfig(),
+		DisplayName:    displayName,
+		Keys:           keys,
+		SearchRange:    DefaultSearchRange,
+		Enabled:        true,
+		LoreBiasGroups: []BiasGroup{},
+	}
+}
+
+// AddEntry adds an entry to the lorebook and returns its ID.
+// An ID is generated if the entry has none, LastUpdatedAt is set to now,
+// and the entry is appended to the lorebook order and its category's order.
+// Returns an error if the ID is already in use or the category doesn't exist.
+func (lb *Lorebook) AddEntry(entry LorebookEntry) (string, error) {
+	if entry.ID == "" {
+		entry.ID = newUUID()
+	} else if lb.entryIndex(entry.ID) >= 0 {
+		return "", fmt.Errorf("lorebook entry %s already exists", entry.ID)
+	}
+	if entry.Category != "" && lb.categoryIndex(entry.Category) < 0 {
+		return "", fmt.Errorf("lorebook category %s not found", entry.Category)
+	}
+	if entry.ContextCfg == nil {
+		entry.ContextCfg = DefaultContextConfig()
+	}
+	entry.LastUpdatedAt = time.Now().UnixMilli()
+
+	lb.Entries = append(lb.Entries, entry)
+	lb.Order = append(lb.Order, entry.ID)
+	if entry.Category != "" {
+		cat := &lb.Categories[lb.categoryIndex(entry.Category)]
+		cat.Order = append(cat.Order, entry.ID)
+	}
+	return entry.ID, nil
+}
+
+// Entry returns the entry with the given ID, or nil if not found.
+// The pointer is invalidated by AddEntry and RemoveEntry.
+func (lb *Lorebook) Entry(id string) *LorebookEntry {
+	if i := lb.entryIndex(id); i >= 0 {
+		return &lb.Entries[i]
+	}
+	return nil
+}
+
+// UpdateEntry applies fn to the entry with the given ID and refreshes its
+// LastUpdatedAt. If fn moves the entry to another category, category
+// orders are updated. Changing the ID or moving to an unknown category
+// is an error, in which case the entry is left unchanged.
+func (lb *Lorebook) UpdateEntry(id string, fn func(entry *LorebookEntry)) error {
+	i := lb.entryIndex(id)
+	if i < 0 {
+		return fmt.Errorf("lorebook entry %s not found", id)
+	}
+
+	updated := lb.Entries[i]
+	fn(&updated)
+	if updated.ID != id {
+		return fmt.Errorf("lorebook entry %s: ID cannot be changed", id)
+	}
+	oldCategory := lb.Entries[i].Category
+	if updated.Category != oldCategory {
+		if updated.Category != "" && lb.categoryIndex(updated.Category) < 0 {
+			return fmt.Errorf("lorebook category %s not found", updated.Category)
+		}
+		if oldCategory != "" {
+			if ci := lb.categoryIndex(oldCategory); ci >= 0 {
+				lb.Categories[ci].Order = removeString(lb.Categories[ci].Order, id)
+			}
+		}
+		if updated.Category != "" {
+			cat := &lb.Categories[lb.categoryIndex(updated.Category)]
+			cat.Order = append(cat.Order, id)
+		}
+	}
+
+	updated.LastUpdatedAt = time.Now().UnixMilli()
+	lb.Entries[i] = updated
+	return nil
+}
+
+// RemoveEntry deletes the entry with the given ID from the lorebook,
+// its order and its category's order.
+func (lb *Lorebook) RemoveEntry(id string) error {
+	i := lb.entryIndex(id)
+	if i < 0 {
+		return fmt.Errorf("lorebook entry %s not found", id)
+	}
+	if category := lb.Entries[i].Category; category != "" {
+		if ci := lb.categoryIndex(category); ci >= 0 {
+			lb.Categories[ci].Order = removeString(lb.Categories[ci].Order, id)
+		}
+	}
+	lb.Entries = append(lb.Entries[:i], lb.Entries[i+1:]...)
+	lb.Order = removeString(lb.Order, id)
+	return nil
+}
+
+// FindByKey returns the entries that have key among their activation keys,
+// compared case-insensitively. The pointers are invalidated by AddEntry
+// and RemoveEntry.
+func (lb *Lorebook) FindByKey(key string) []*LorebookEntry {
+	var found []*LorebookEntry
+	for i := range lb.Entries {
+		for _, k := range lb.Entries[i].Keys {
+			if strings.EqualFold(k, key) {
+				found = append(found, &lb.Entries[i])
+				break
+			}
+		}
+	}
+	return found
+}
+
+// AddCategory creates an enabled category and returns its ID.
+func (lb *Lorebook) AddCategory(name string) string {
+	cat := Category{
+		Name:               name,
+		ID:                 newUUID(),
+		Enabled:            true,
+		CategoryBiasGroups: []BiasGroup{},
+		Order:              []string{},
+	}
+	lb.Categories = append(lb.Categories, cat)
+	return cat.ID
+}
+
+// entryIndex returns the index of the entry with the given ID, or -1.
+func (lb *Lorebook) entryIndex(id string) int {
+	for i := range lb.Entries {
+		if lb.Entries[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// categoryIndex returns the index of the category with the given ID, or -1.
+func (lb *Lorebook) categoryIndex(id string) int {
+	for i := range lb.Categories {
+		if lb.Categories[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeString returns s without any occurrences of v.
+func removeString(s []string, v string) []string {
+	out := s[:0]
+	for _, item := range s {
+		if item != v {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID, the ID format NovelAI
+// uses for lorebook entries and categories.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("novelai: crypto/rand failed: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
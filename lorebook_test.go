@@ -0,0 +1,86 @@
+package novelai
+
+import (
+	"testing"
+)
+
+// TestLorebookCRUD tests adding, updating, finding and removing entries.
+func TestLorebookCRUD(t *testing.T) {
+	s := NewScenario("Test")
+	lb := &s.Lorebook
+
+	chars := lb.AddCategory("Characters")
+	places := lb.AddCategory("Places")
+
+	entry := NewLorebookEntry("Alice", "Alice is a knight.", "Alice", "knight")
+	entry.Category = chars
+	id, err := lb.AddEntry(entry)
+	if err != nil {
+		t.Fatalf("AddEntry failed: %v", err)
+	}
+	if id == "" || lb.Entry(id) == nil || lb.Entry(id).LastUpdatedAt == 0 {
+		t.Fatalf("Expected stored entry with ID and timestamp, got %+v", lb.Entry(id))
+	}
+	if len(lb.Order) != 1 || lb.Order[0] != id {
+		t.Errorf("Expected lorebook order [%s], got %v", id, lb.Order)
+	}
+	if cat := lb.Categories[0]; len(cat.Order) != 1 || cat.Order[0] != id {
+		t.Errorf("Expected category order [%s], got %v", id, cat.Order)
+	}
+
+	if _, err := lb.AddEntry(LorebookEntry{ID: id}); err == nil {
+		t.Error("Expected error for duplicate ID")
+	}
+	if _, err := lb.AddEntry(LorebookEntry{Category: "missing"}); err == nil {
+		t.Error("Expected error for unknown category")
+	}
+
+	found := lb.FindByKey("KNIGHT")
+	if len(found) != 1 || found[0].ID != id {
+		t.Errorf("Expected FindByKey to find entry, got %v", found)
+	}
+
+	if err := lb.UpdateEntry(id, func(e *LorebookEntry) {
+		e.Text = "Alice is a retired knight."
+		e.Category = places
+	}); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if lb.Entry(id).Text != "Alice is a retired knight." {
+		t.Errorf("Expected updated text, got %q", lb.Entry(id).Text)
+	}
+	if len(lb.Categories[0].Order) != 0 || len(lb.Categories[1].Order) != 1 {
+		t.Errorf("Expected entry to move categories, got %v / %v", lb.Categories[0].Order, lb.Categories[1].Order)
+	}
+
+	if err := lb.UpdateEntry(id, func(e *LorebookEntry) { e.ID = "other" }); err == nil {
+		t.Error("Expected error when changing ID")
+	}
+	if err := lb.UpdateEntry(id, func(e *LorebookEntry) { e.Category = "missing" }); err == nil {
+		t.Error("Expected error when moving to unknown category")
+	}
+	if lb.Entry(id).Category != places {
+		t.Error("Expected failed update to leave entry unchanged")
+	}
+
+	if err := lb.RemoveEntry(id); err != nil {
+		t.Fatalf("RemoveEntry failed: %v", err)
+	}
+	if len(lb.Entries) != 0 || len(lb.Order) != 0 || len(lb.Categories[1].Order) != 0 {
+		t.Errorf("Expected entry removed everywhere, got %+v", lb)
+	}
+	if err := lb.RemoveEntry(id); err == nil {
+		t.Error("Expected error removing missing entry")
+	}
+}
+
+// TestNewUUID tests the UUID format used for lorebook IDs.
+func TestNewUUID(t *testing.T) {
+	id := newUUID()
+	if len(id) != 36 || id[14] != '4' || id[8] != '-' {
+		t.Errorf("Expected version 4 UUID, got %q", id)
+	}
+	if newUUID() == id {
+		t.Error("Expected unique UUIDs")
+	}
+}
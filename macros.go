@@ -0,0 +1,224 @@
+package novelai
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// macroRef matches a {{name}} or {{name:args}} macro.
+var macroRef = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+
+// diceRoll matches dice notation such as "d20", "2d6" or "1d8+2".
+var diceRoll = regexp.MustCompile(`^(\d*)d(\d+)\s*([+-]\s*\d+)?$`)
+
+// Limits on dice rolls, so that a malformed card cannot stall rendering.
+const (
+	maxDice     = 100
+	maxDiceSide = 1000000
+)
+
+// MacroEngine expands the SillyTavern macro set used by character cards and
+// imported scenarios:
+//
+//	{{user}}, {{char}}           persona and character names
+//	{{time}}, {{date}}           "3:04 PM", "January 2, 2006"
+//	{{weekday}}                  "Monday"
+//	{{isotime}}, {{isodate}}     "15:04", "2006-01-02"
+//	{{idle_duration}}            time since LastActive, e.g. "5 minutes"
+//	{{random:a,b,c}}             a random choice; write {{random::a::b}}
+//	                             for choices that contain commas
+//	{{roll:2d6+1}}               a dice roll; {{roll:20}} rolls 1d20
+//	{{newline}}, {{noop}}        a newline, nothing
+//	{{// comment}}               removed
+//
+// Names are case-insensitive. Unknown macros, and {{user}} or {{char}}
+// without a name, are left in place. The legacy <USER> and <BOT> forms are
+// also replaced.
+type MacroEngine struct {
+	// User and Char replace {{user}} and {{char}}.
+	User string
+	Char string
+	// LastActive is when the conversation was last active, for
+	// {{idle_duration}}. If zero, the idle duration is "just now".
+	LastActive time.Time
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+	// Rand is used for {{random}} and {{roll}}. If nil, the global source
+	// is used.
+	Rand *rand.Rand
+	// Funcs are additional macros by lowercase name. Each receives the text
+	// after the colon, or "" if there is none.
+	Funcs map[string]func(arg string) string
+}
+
+// Expand replaces the macros in text.
+func (m *MacroEngine) Expand(text string) string {
+	if strings.Contains(text, "{{") {
+		text = macroRef.ReplaceAllStringFunc(text, func(ref string) string {
+			if out, ok := m.expand(ref[2 : len(ref)-2]); ok {
+				return out
+			}
+			return ref
+		})
+	}
+	return SubstituteNames(text, m.User, m.Char)
+}
+
+// expand evaluates the body of one macro. Returns false if the macro is
+// unknown or cannot be evaluated.
+func (m *MacroEngine) expand(body string) (string, bool) {
+	if strings.HasPrefix(strings.TrimSpace(body), "//") {
+		return "", true
+	}
+	name, arg, _ := strings.Cut(body, ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if fn, ok := m.Funcs[name]; ok {
+		return fn(arg), true
+	}
+
+	now := m.now()
+	switch name {
+	case "user":
+		return m.User, m.User != ""
+	case "char":
+		return m.Char, m.Char != ""
+	case "time":
+		return now.Format("3:04 PM"), true
+	case "date":
+		return now.Format("January 2, 2006"), true
+	case "weekday":
+		return now.Format("Monday"), true
+	case "isotime":
+		return now.Format("15:04"), true
+	case "isodate":
+		return now.Format("2006-01-02"), true
+	case "idle_duration":
+		if m.LastActive.IsZero() {
+			return "just now", true
+		}
+		return HumanizeDuration(now.Sub(m.LastActive)), true
+	case "random":
+		choices := splitMacroArgs(arg)
+		if len(choices) == 0 {
+			return "", true
+		}
+		return choices[m.intn(len(choices))], true
+	case "roll":
+		total, err := m.Roll(arg)
+		if err != nil {
+			return "", false
+		}
+		return strconv.Itoa(total), true
+	case "newline":
+		return "\n", true
+	case "noop":
+		return "", true
+	}
+	return "", false
+}
+
+// Roll evaluates dice notation such as "d20", "2d6", "1d8+2" or "20"
+// (one die with that many sides).
+func (m *MacroEngine) Roll(dice string) (int, error) {
+	dice = strings.ToLower(strings.TrimSpace(dice))
+	if n, err := strconv.Atoi(dice); err == nil {
+		dice = "d" + strconv.Itoa(n)
+	}
+	match := diceRoll.FindStringSubmatch(dice)
+	if match == nil {
+		return 0, fmt.Errorf("invalid dice notation %q", dice)
+	}
+	count := 1
+	if match[1] != "" {
+		count, _ = strconv.Atoi(match[1])
+	}
+	sides, _ := strconv.Atoi(match[2])
+	if count < 1 || count > maxDice || sides < 1 || sides > maxDiceSide {
+		return 0, fmt.Errorf("dice out of range: %q", dice)
+	}
+	total := 0
+	if match[3] != "" {
+		total, _ = strconv.Atoi(strings.ReplaceAll(match[3], " ", ""))
+	}
+	for i := 0; i < count; i++ {
+		total += m.intn(sides) + 1
+	}
+	return total, nil
+}
+
+// now returns the current time.
+func (m *MacroEngine) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// intn returns a random number in [0, n).
+func (m *MacroEngine) intn(n int) int {
+	if m.Rand != nil {
+		return m.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// splitMacroArgs splits macro arguments on "::" if the macro was written
+// as {{name::a::b}}, else on commas. arg is the text after the first colon.
+func splitMacroArgs(arg string) []string {
+	sep := ","
+	if strings.HasPrefix(arg, ":") {
+		arg, sep = arg[1:], "::"
+	}
+	var args []string
+	for _, a := range strings.Split(arg, sep) {
+		if a = strings.TrimSpace(a); a != "" {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// HumanizeDuration describes d the way chat frontends do: "a few seconds",
+// "a minute", "5 minutes", "an hour", "3 days".
+func HumanizeDuration(d time.Duration) string {
+	switch {
+	case d < 45*time.Second:
+		return "a few seconds"
+	case d < 90*time.Second:
+		return "a minute"
+	case d < 45*time.Minute:
+		return fmt.Sprintf("%d minutes", int(d.Round(time.Minute)/time.Minute))
+	case d < 90*time.Minute:
+		return "an hour"
+	case d < 22*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Round(time.Hour)/time.Hour))
+	case d < 36*time.Hour:
+		return "a day"
+	default:
+		return fmt.Sprintf("%d days", int(d.Round(24*time.Hour)/(24*time.Hour)))
+	}
+}
+
+// macros returns the engine used to render the conversation's prompt:
+// Macros, or a default engine, with names from the persona and CharName
+// and the time of the latest reply.
+func (c *Conversation) macros() *MacroEngine {
+	var m MacroEngine
+	if c.Macros != nil {
+		m = *c.Macros
+	}
+	if m.User == "" {
+		m.User = c.userName()
+	}
+	if m.Char == "" {
+		m.Char = c.CharName
+	}
+	if m.LastActive.IsZero() {
+		m.LastActive = c.lastActive
+	}
+	return &m
+}
@@ -0,0 +1,94 @@
+package novelai
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMacroEngineExpand tests the built-in macros.
+func TestMacroEngineExpand(t *testing.T) {
+	now := time.Date(2026, 3, 2, 15, 4, 0, 0, time.UTC)
+	m := &MacroEngine{
+		User:       "Ana",
+		Char:       "Rook",
+		LastActive: now.Add(-5 * time.Minute),
+		Now:        func() time.Time { return now },
+		Funcs:      map[string]func(string) string{"shout": strings.ToUpper},
+	}
+	tests := map[string]string{
+		"{{char}} meets {{USER}}.":                "Rook meets Ana.",
+		"{{time}} on {{weekday}}, {{date}}":       "3:04 PM on Monday, March 2, 2026",
+		"{{isodate}}T{{isotime}}":                 "2026-03-02T15:04",
+		"Idle for {{idle_duration}}.":             "Idle for 5 minutes.",
+		"a{{newline}}b{{noop}}{{// note}}":        "a\nb",
+		"{{shout:hey}} {{unknown}} {{roll:nope}}": "HEY {{unknown}} {{roll:nope}}",
+	}
+	for in, want := range tests {
+		if got := m.Expand(in); got != want {
+			t.Errorf("Expand(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+// TestMacroEngineRandom tests {{random}} and {{roll}}.
+func TestMacroEngineRandom(t *testing.T) {
+	m := &MacroEngine{Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 20; i++ {
+		got := m.Expand("{{random:red,green}}|{{random::a, b::c}}")
+		first, second, _ := strings.Cut(got, "|")
+		if first != "red" && first != "green" {
+			t.Fatalf("Unexpected random choice %q", first)
+		}
+		if second != "a, b" && second != "c" {
+			t.Fatalf("Unexpected random choice %q", second)
+		}
+		n, err := m.Roll("2d6+1")
+		if err != nil || n < 3 || n > 13 {
+			t.Fatalf("Roll(2d6+1): got %d, %v", n, err)
+		}
+	}
+	if n, err := m.Roll("1"); err != nil || n != 1 {
+		t.Errorf("Roll(1): got %d, %v", n, err)
+	}
+	for _, dice := range []string{"d0", "1000d6", "2x6", ""} {
+		if _, err := m.Roll(dice); err == nil {
+			t.Errorf("Expected error rolling %q", dice)
+		}
+	}
+}
+
+// TestHumanizeDuration tests idle duration wording.
+func TestHumanizeDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		10 * time.Second: "a few seconds",
+		time.Minute:      "a minute",
+		20 * time.Minute: "20 minutes",
+		time.Hour:        "an hour",
+		5 * time.Hour:    "5 hours",
+		30 * time.Hour:   "a day",
+		72 * time.Hour:   "3 days",
+	}
+	for d, want := range tests {
+		if got := HumanizeDuration(d); got != want {
+			t.Errorf("HumanizeDuration(%v): expected %q, got %q", d, want, got)
+		}
+	}
+}
+
+// TestConversationMacros tests macro expansion during prompt assembly.
+func TestConversationMacros(t *testing.T) {
+	conv := NewConversation("Today is {{weekday}}.")
+	conv.CharName = "Rook"
+	conv.Macros = &MacroEngine{Now: func() time.Time { return time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC) }}
+	conv.AddMessage("user", "{{char}}, roll {{roll:1}}.")
+
+	prompt := conv.RenderPrompt()
+	if !strings.Contains(prompt, "Today is Monday.") || !strings.Contains(prompt, "Rook, roll 1.") {
+		t.Errorf("Expected expanded macros, got %q", prompt)
+	}
+	if conv.Messages[0].Content != "{{char}}, roll {{roll:1}}." {
+		t.Errorf("Expected history unchanged, got %q", conv.Messages[0].Content)
+	}
+}
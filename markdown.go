@@ -0,0 +1,301 @@
+package novelai
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MarkdownSnapshot is a view of streamed markdown that renders the way the
+// complete reply will, for progressively rendering formatted output.
+type MarkdownSnapshot struct {
+	// Text is the markdown received so far with its open constructs closed:
+	// an open code fence is closed, as are open bold, italic and inline code
+	// spans. A last line that may yet become a fence, list item, heading or
+	// rule is held back until it is complete, as is a link whose URL is
+	// still arriving.
+	Text string
+	// Stable is the length of the prefix of Text made of complete blocks,
+	// which later snapshots do not change. UIs may keep its rendering and
+	// re-render only the rest.
+	Stable int
+	// InCodeBlock reports whether the text received ends inside a fenced
+	// code block, and Language is the block's info string.
+	InCodeBlock bool
+	Language    string
+	// Done reports whether the stream has ended. Nothing is held back from
+	// the final snapshot.
+	Done bool
+}
+
+// MarkdownStream parses streamed markdown incrementally, passing a
+// render-safe snapshot to emit whenever it changes. Complete lines are
+// parsed once; only the block still arriving is parsed again on each write.
+type MarkdownStream struct {
+	emit func(MarkdownSnapshot)
+
+	mu   sync.Mutex
+	text string
+	done bool
+	// scanned is the length of text parsed into complete lines, and
+	// blockStart the start of the block still open.
+	scanned    int
+	blockStart int
+	// fence is the marker of the open code fence, and language its info
+	// string.
+	fence    string
+	language string
+	last     string
+}
+
+// NewMarkdownStream creates a markdown stream passing snapshots to emit,
+// which may be nil if snapshots are only taken with Snapshot.
+func NewMarkdownStream(emit func(MarkdownSnapshot)) *MarkdownStream {
+	return &MarkdownStream{emit: emit}
+}
+
+// Callback returns a StreamCallback that feeds the stream and closes it
+// when the stream is done. Use it as the callback of SendStreaming.
+func (m *MarkdownStream) Callback() StreamCallback {
+	return func(text string, done bool) {
+		m.Write(text)
+		if done {
+			m.Close()
+		}
+	}
+}
+
+// Write adds streamed text. Writes after Close are ignored.
+func (m *MarkdownStream) Write(text string) {
+	m.mu.Lock()
+	if m.done || text == "" {
+		m.mu.Unlock()
+		return
+	}
+	m.text += text
+	m.scan()
+	m.update()
+}
+
+// Close marks the end of the stream, emitting the final snapshot.
+func (m *MarkdownStream) Close() {
+	m.mu.Lock()
+	if m.done {
+		m.mu.Unlock()
+		return
+	}
+	m.done = true
+	m.last = ""
+	m.update()
+}
+
+// Snapshot returns the current snapshot.
+func (m *MarkdownStream) Snapshot() MarkdownSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot()
+}
+
+// update emits the current snapshot if its text changed, releasing the
+// lock taken by the caller first.
+func (m *MarkdownStream) update() {
+	s := m.snapshot()
+	changed := s.Text != m.last || s.Done
+	m.last = s.Text
+	m.mu.Unlock()
+	if changed && m.emit != nil {
+		m.emit(s)
+	}
+}
+
+// scan parses the complete lines not yet parsed, tracking code fences and
+// where the open block starts.
+func (m *MarkdownStream) scan() {
+	for {
+		end := strings.IndexByte(m.text[m.scanned:], '\n')
+		if end < 0 {
+			return
+		}
+		start := m.scanned
+		m.scanned += end + 1
+		line := m.text[start : m.scanned-1]
+		switch {
+		case m.fence != "":
+			if closesFence(line, m.fence) {
+				m.fence, m.language = "", ""
+				m.blockStart = m.scanned
+			}
+		case strings.TrimSpace(line) == "" || thematicBreak.MatchString(line):
+			m.blockStart = m.scanned
+		default:
+			if fence, language, ok := opensFence(line); ok {
+				m.fence, m.language = fence, language
+				m.blockStart = start
+			} else if blockLine.MatchString(line) {
+				m.blockStart = start
+			}
+		}
+	}
+}
+
+// snapshot renders the current snapshot. Must be called with the lock held.
+func (m *MarkdownStream) snapshot() MarkdownSnapshot {
+	tail := m.text[m.blockStart:]
+	s := MarkdownSnapshot{
+		Stable:      m.blockStart,
+		InCodeBlock: m.fence != "",
+		Language:    m.language,
+		Done:        m.done,
+	}
+	if !m.done {
+		tail = holdBackLine(tail)
+	}
+	if m.fence != "" {
+		if tail != "" && !strings.HasSuffix(tail, "\n") {
+			tail += "\n"
+		}
+		tail += m.fence
+	} else {
+		tail = closeInline(tail, m.done)
+	}
+	s.Text = m.text[:m.blockStart] + tail
+	return s
+}
+
+var (
+	// markerLine matches a line that may still become a fence, list item,
+	// heading, rule or setext underline as more of it arrives.
+	markerLine = regexp.MustCompile("^ {0,3}(?:[-*+=#_ ]*|\\d{1,9}[.)]? *|`{1,2}|~{1,2}|(?:`{3,}|~{3,}).*)$")
+	// blockLine matches the first line of a heading, list item or quote.
+	blockLine = regexp.MustCompile(`^ {0,3}(?:#{1,6}(?:\s|$)|[-*+]\s|\d{1,9}[.)]\s|>)`)
+	// thematicBreak matches a horizontal rule.
+	thematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+)
+
+// holdBackLine removes the last line of text if it is incomplete and may
+// still change how it renders.
+func holdBackLine(text string) string {
+	start := strings.LastIndexByte(text, '\n') + 1
+	if start < len(text) && markerLine.MatchString(text[start:]) {
+		return text[:start]
+	}
+	return text
+}
+
+// opensFence reports whether line opens a code fence, returning its marker
+// and info string.
+func opensFence(line string) (fence, language string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || trimmed == "" || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return "", "", false
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	info := strings.TrimSpace(trimmed[n:])
+	if n < 3 || (trimmed[0] == '`' && strings.Contains(info, "`")) {
+		return "", "", false
+	}
+	if i := strings.IndexFunc(info, unicode.IsSpace); i >= 0 {
+		info = info[:i]
+	}
+	return trimmed[:n], info, true
+}
+
+// closesFence reports whether line closes the code fence opened by fence.
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	rest := strings.TrimLeft(trimmed, fence[:1])
+	return len(trimmed)-len(rest) >= len(fence) && strings.TrimSpace(rest) == ""
+}
+
+// inlineMarker is an open emphasis marker and its offset.
+type inlineMarker struct {
+	marker string
+	at     int
+}
+
+// closeInline closes the emphasis and code spans left open in a block of
+// text. Unless final, a marker with nothing after it yet is removed rather
+// than closed, as is a link whose URL is incomplete.
+func closeInline(text string, final bool) string {
+	if !final {
+		if i := strings.LastIndex(text, "]("); i >= 0 && !strings.Contains(text[i:], ")") {
+			if open := strings.LastIndexByte(text[:i], '['); open >= 0 {
+				text = text[:open]
+			}
+		}
+	}
+	var open []inlineMarker
+	code, codeAt := "", 0
+	for i := 0; i < len(text); {
+		c := text[i]
+		n := runLength(text, i)
+		switch {
+		case c == '\\' && code == "":
+			n = min(2, len(text)-i)
+		case c == '`':
+			if code == "" {
+				code, codeAt = text[i:i+n], i
+			} else if n == len(code) {
+				code = ""
+			}
+		case code != "" || (c != '*' && c != '_'):
+			n = 1
+		default:
+			prev, _ := utf8.DecodeLastRuneInString(text[:i])
+			next, _ := utf8.DecodeRuneInString(text[i+n:])
+			lineStart := strings.TrimLeft(text[strings.LastIndexByte(text[:i], '\n')+1:i], " ") == ""
+			opens := i+n == len(text) || !unicode.IsSpace(next)
+			closes := i > 0 && !unicode.IsSpace(prev)
+			switch {
+			case c == '_' && isWordRune(prev) && isWordRune(next):
+				// Underscores within words, as in snake_case
+			case c == '*' && n == 1 && lineStart && next == ' ':
+				// A list bullet
+			case len(open) > 0 && open[len(open)-1].marker == text[i:i+n] && closes:
+				open = open[:len(open)-1]
+			case opens:
+				open = append(open, inlineMarker{text[i : i+n], i})
+			}
+		}
+		i += n
+	}
+	if code != "" {
+		if !final && strings.TrimSpace(text[codeAt+len(code):]) == "" {
+			return closeInline(text[:codeAt], final)
+		}
+		return text + code
+	}
+	// A marker with nothing after it yet is not closed
+	for len(open) > 0 {
+		last := open[len(open)-1]
+		if strings.TrimSpace(text[last.at+len(last.marker):]) != "" {
+			break
+		}
+		if !final {
+			text = text[:last.at]
+		}
+		open = open[:len(open)-1]
+	}
+	body := strings.TrimRightFunc(text, unicode.IsSpace)
+	var b strings.Builder
+	b.WriteString(body)
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString(open[i].marker)
+	}
+	b.WriteString(text[len(body):])
+	return b.String()
+}
+
+// runLength returns the number of times text[i] repeats from i.
+func runLength(text string, i int) int {
+	n := 1
+	for i+n < len(text) && text[i+n] == text[i] {
+		n++
+	}
+	return n
+}
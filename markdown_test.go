@@ -0,0 +1,131 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// markdownAfter feeds text to a markdown stream and returns its snapshot.
+func markdownAfter(chunks ...string) MarkdownSnapshot {
+	m := NewMarkdownStream(nil)
+	for _, c := range chunks {
+		m.Write(c)
+	}
+	return m.Snapshot()
+}
+
+func TestMarkdownStreamSnapshots(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "Hello there", "Hello there"},
+		{"open bold", "Some **bold te", "Some **bold te**"},
+		{"bold before space", "Some **bold ", "Some **bold** "},
+		{"empty bold", "Some **", "Some "},
+		{"nested", "A *very **strong", "A *very **strong***"},
+		{"closed", "A **b** and *i*", "A **b** and *i*"},
+		{"snake case", "call my_func now", "call my_func now"},
+		{"arithmetic", "2 * 3 is six", "2 * 3 is six"},
+		{"inline code", "Run `go te", "Run `go te`"},
+		{"code ignores emphasis", "Use `a*b", "Use `a*b`"},
+		{"empty code", "Run `", "Run "},
+		{"partial link", "See [the docs](https://exa", "See "},
+		{"link text", "See [the docs", "See [the docs"},
+		{"open fence", "Code:\n\n```go\nfmt.Println(", "Code:\n\n```go\nfmt.Println(\n```"},
+		{"fence line arriving", "Code:\n\n```g", "Code:\n\n"},
+		{"closing fence arriving", "```\nx := 1\n``", "```\nx := 1\n```"},
+		{"closed fence", "```\n**x\n```\nDone", "```\n**x\n```\nDone"},
+		{"list marker arriving", "Items:\n\n- one\n-", "Items:\n\n- one\n"},
+		{"list item", "Items:\n\n- one\n- **tw", "Items:\n\n- one\n- **tw**"},
+		{"bullet asterisk", "* item *it", "* item *it*"},
+		{"ordered marker", "Steps:\n1", "Steps:\n"},
+		{"setext underline", "Title\n--", "Title\n"},
+		{"block boundary", "**open\n\nNew *para", "**open\n\nNew *para*"},
+	}
+	for _, tt := range tests {
+		// Results must not depend on how the text is split
+		for _, s := range []MarkdownSnapshot{markdownAfter(tt.text), markdownAfter(strings.SplitAfter(tt.text, "")...)} {
+			if s.Text != tt.want {
+				t.Errorf("%s: got %q, want %q", tt.name, s.Text, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMarkdownStreamStable(t *testing.T) {
+	text := "Intro with **bold**.\n\n```python\nprint('hi')\n```\n\n- one\n- two *x*\n\nEnd **now**"
+	var snaps []MarkdownSnapshot
+	m := NewMarkdownStream(func(s MarkdownSnapshot) { snaps = append(snaps, s) })
+	for _, c := range strings.SplitAfter(text, "") {
+		m.Write(c)
+	}
+	m.Close()
+
+	var stable string
+	for _, s := range snaps {
+		if !strings.HasPrefix(s.Text, stable) {
+			t.Fatalf("Snapshot %q changed the stable prefix %q", s.Text, stable)
+		}
+		stable = s.Text[:s.Stable]
+		if strings.Count(s.Text, "```")%2 != 0 {
+			t.Errorf("Unbalanced fence in %q", s.Text)
+		}
+	}
+	last := snaps[len(snaps)-1]
+	if !last.Done || last.Text != text {
+		t.Errorf("Unexpected final snapshot: %+v", last)
+	}
+	for i := 1; i < len(snaps); i++ {
+		if snaps[i].Text == snaps[i-1].Text && !snaps[i].Done {
+			t.Errorf("Repeated snapshot %q", snaps[i].Text)
+		}
+	}
+}
+
+func TestMarkdownStreamCodeBlock(t *testing.T) {
+	s := markdownAfter("Here:\n~~~~ rust ignore\nfn main() {\n```\n")
+	if !s.InCodeBlock || s.Language != "rust" || !strings.HasSuffix(s.Text, "```\n~~~~") {
+		t.Errorf("Unexpected snapshot: %+v", s)
+	}
+	s = markdownAfter("Here:\n~~~~ rust ignore\nfn main() {}\n~~~~\n")
+	if s.InCodeBlock || s.Language != "" || s.Stable != len(s.Text) {
+		t.Errorf("Unexpected snapshot: %+v", s)
+	}
+}
+
+func TestMarkdownStreamFinal(t *testing.T) {
+	m := NewMarkdownStream(nil)
+	m.Write("Ends with **")
+	m.Close()
+	m.Write(" ignored")
+	if s := m.Snapshot(); s.Text != "Ends with **" || !s.Done {
+		t.Errorf("Unexpected final snapshot: %+v", s)
+	}
+
+	m = NewMarkdownStream(nil)
+	m.Write("```\ncode")
+	m.Close()
+	if s := m.Snapshot(); s.Text != "```\ncode\n```" {
+		t.Errorf("Expected the fence closed, got %q", s.Text)
+	}
+}
+
+func TestMarkdownStreamCallback(t *testing.T) {
+	conv := NewConversation("")
+	NewFakeBackend().On(`.`, FakeResponse{Text: "A **bold** reply"}).Install(conv)
+	var last MarkdownSnapshot
+	var count int
+	m := NewMarkdownStream(func(s MarkdownSnapshot) {
+		last = s
+		count++
+	})
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, m.Callback()); err != nil {
+		t.Fatal(err)
+	}
+	if !last.Done || last.Text != "A **bold** reply" || count < 2 {
+		t.Errorf("Got %d snapshots, last %+v", count, last)
+	}
+}
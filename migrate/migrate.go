@@ -0,0 +1,88 @@
+// Package migrate upgrades saved conversations to the current save format,
+// so that sessions stored by an older version of the novelai package keep
+// loading after an upgrade.
+//
+// Migrations work on the decoded JSON rather than on the novelai types,
+// which only describe the current format. novelai.UnmarshalSnapshot and
+// FileSessionStore apply them on load; call Snapshot directly to upgrade
+// stored files in place.
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// CurrentSnapshotVersion is the save format version of conversation
+// snapshots produced by Snapshot.
+const CurrentSnapshotVersion = 1
+
+// step upgrades a decoded document by one version.
+type step struct {
+	from        int
+	description string
+	apply       func(doc map[string]any)
+}
+
+// snapshotSteps upgrade the snapshot version, indexed by source version.
+// When a field of the save format changes, bump CurrentSnapshotVersion and
+// add the step from the previous version here.
+var snapshotSteps = []step{
+	{0, "add save format version", snapshotV0},
+}
+
+// Snapshot upgrades a saved conversation snapshot from an older version to
+// the current save format. Snapshots saved before versioning count as
+// version 0. Snapshots already at the current version are returned
+// unchanged.
+//
+// Returns the migrated JSON and a description of each step applied.
+func Snapshot(data []byte) (migrated []byte, applied []string, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("error parsing snapshot JSON: %w", err)
+	}
+
+	version := max(docInt(doc, "version"), 0)
+	if version > CurrentSnapshotVersion {
+		return nil, nil, fmt.Errorf("snapshot version %d is newer than supported version %d",
+			version, CurrentSnapshotVersion)
+	}
+	for ; version < CurrentSnapshotVersion; version++ {
+		s := snapshotSteps[version]
+		s.apply(doc)
+		applied = append(applied, fmt.Sprintf("snapshot v%d→v%d: %s", s.from, s.from+1, s.description))
+	}
+	if len(applied) == 0 {
+		return data, nil, nil
+	}
+	doc["version"] = CurrentSnapshotVersion
+	migrated, err = json.Marshal(doc)
+	if err != nil {
+		return nil, applied, fmt.Errorf("error encoding migrated snapshot: %w", err)
+	}
+	return migrated, applied, nil
+}
+
+// snapshotV0 upgrades unversioned snapshots, whose fields are those of
+// version 1; only the version is added.
+func snapshotV0(doc map[string]any) {}
+
+// docInt reads an integer field from a decoded document, defaulting to 0.
+func docInt(doc map[string]any, key string) int {
+	switch v := doc[key].(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return int(f)
+		}
+	case float64:
+		return int(v)
+	}
+	return 0
+}
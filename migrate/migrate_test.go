@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	// Saved before versioning
+	old := []byte(`{"system":"sys","messages":[{"role":"user","content":"Hi"}],` +
+		`"usage":{"InputTokens":3,"OutputTokens":0},"settings":{"Model":"glm-4-6","MaxTokens":100}}`)
+	migrated, applied, err := Snapshot(old)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if len(applied) != 1 || !strings.Contains(applied[0], "v0→v1") {
+		t.Errorf("applied = %q", applied)
+	}
+	var doc struct {
+		Version  int    `json:"version"`
+		System   string `json:"system"`
+		Settings struct {
+			MaxTokens int
+		} `json:"settings"`
+	}
+	if err := json.Unmarshal(migrated, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != CurrentSnapshotVersion || doc.System != "sys" || doc.Settings.MaxTokens != 100 {
+		t.Errorf("Got %s", migrated)
+	}
+
+	// Current snapshots are unchanged
+	current := []byte(`{"version":1,"system":"sys"}`)
+	if migrated, applied, err := Snapshot(current); err != nil || applied != nil || string(migrated) != string(current) {
+		t.Errorf("Current snapshot: got %s, %q, %v", migrated, applied, err)
+	}
+
+	if _, _, err := Snapshot([]byte(`{"version":99}`)); err == nil {
+		t.Error("Expected an error for a newer version")
+	}
+	if _, _, err := Snapshot([]byte(`{`)); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
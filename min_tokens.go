@@ -0,0 +1,49 @@
+package novelai
+
+// MaxMinTokensContinuations caps how many times a reply is continued to
+// reach Settings.MinTokens.
+const MaxMinTokensContinuations = 3
+
+// continueFunc generates a continuation of the last reply.
+type continueFunc func(settings *Settings, overrides SamplingProfile) (
+	reply, stopReason string, inputTokens, outputTokens int, err error)
+
+// reachMinTokens continues a reply that ended its turn with fewer than
+// settings.MinTokens output tokens, joining each continuation to it in the
+// history, and returns the whole reply with the usage of all requests.
+//
+// A reply usually ends early on a stop sequence the caller added, such as
+// a blank line, so continuations stop only on the template's end-of-turn
+// sequences. A reply the model ended with its end of turn may not go on;
+// continuing stops once a continuation adds nothing.
+func (c *Conversation) reachMinTokens(settings *Settings, overrides SamplingProfile,
+	reply, stopReason string, inputTokens, outputTokens int, next continueFunc) (string, string, int, int, error) {
+	cont := overrides
+	cont.StopSequences = append([]string{}, c.promptTemplate().StopSequences...)
+	for i := 0; i < MaxMinTokensContinuations && StopReason(stopReason) == StopEndTurn && outputTokens < settings.MinTokens; i++ {
+		part, stop, in, out, err := next(settings, cont)
+		inputTokens += in
+		outputTokens += out
+		if err != nil {
+			return reply, stopReason, inputTokens, outputTokens, err
+		}
+		c.joinLastReplies()
+		reply += part
+		stopReason = stop
+		if part == "" {
+			break
+		}
+	}
+	return reply, stopReason, inputTokens, outputTokens, nil
+}
+
+// joinLastReplies appends the last message, a continuation, to the reply
+// before it, as is.
+func (c *Conversation) joinLastReplies() {
+	n := len(c.Messages)
+	if n < 2 || c.Messages[n-1].Role != "assistant" || c.Messages[n-2].Role != "assistant" {
+		return
+	}
+	c.Messages[n-2].Content += c.Messages[n-1].Content
+	c.Messages = c.Messages[:n-1]
+}
@@ -0,0 +1,124 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// minTokensServer replies with a part of 4 tokens that stops early, the
+// parts numbered in turn, and records the requests.
+func minTokensServer(t *testing.T) (*httptest.Server, func() []completionRequest) {
+	var mu sync.Mutex
+	var reqs []completionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		reqs = append(reqs, req)
+		n := len(reqs)
+		mu.Unlock()
+		text := fmt.Sprintf("part %d.", n)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"text\":%q,\"finish_reason\":\"stop\"}],"+
+				"\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":4}}\n\ndata: [DONE]\n\n", text)
+			return
+		}
+		json.NewEncoder(w).Encode(mockCompletionResponse(text, "stop", 10, 4))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []completionRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]completionRequest(nil), reqs...)
+	}
+}
+
+func TestSendMinTokens(t *testing.T) {
+	server, requests := minTokensServer(t)
+	conv := NewConversation("You are helpful.")
+	conv.Endpoint = server.URL
+	conv.ApiToken = "test-token"
+	conv.Settings.MinTokens = 10
+	conv.Settings.StopSequences = append(conv.Settings.StopSequences, "\n\n")
+
+	reply, stopReason, inputTokens, outputTokens, _, _, err := conv.SendWith("Hello", SamplingProfile{})
+	if err != nil {
+		t.Fatalf("SendWith failed: %v", err)
+	}
+	if reply != "part 1.part 2.part 3." || stopReason != "end_turn" {
+		t.Errorf("Got %q, %q", reply, stopReason)
+	}
+	if inputTokens != 30 || outputTokens != 12 {
+		t.Errorf("Got %d input and %d output tokens", inputTokens, outputTokens)
+	}
+
+	// Continuations stop on the template's stop sequences only
+	reqs := requests()
+	if len(reqs) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(reqs))
+	}
+	turnStops := conv.promptTemplate().StopSequences
+	if !reflect.DeepEqual(reqs[1].Stop, turnStops) {
+		t.Errorf("Continuation stops: got %q, want %q", reqs[1].Stop, turnStops)
+	}
+	if reflect.DeepEqual(reqs[0].Stop, turnStops) {
+		t.Errorf("First request should keep the extra stop sequence: %q", reqs[0].Stop)
+	}
+
+	// The parts are one assistant message
+	last := conv.Messages[len(conv.Messages)-1]
+	if last.Role != "assistant" || last.Content != reply || conv.Messages[len(conv.Messages)-2].Role != "user" {
+		t.Errorf("Got history %+v", conv.Messages)
+	}
+}
+
+func TestSendMinTokensCap(t *testing.T) {
+	server, requests := minTokensServer(t)
+	conv := NewConversation("You are helpful.")
+	conv.Endpoint = server.URL
+	conv.ApiToken = "test-token"
+	conv.Settings.MinTokens = 1000
+
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err != nil {
+		t.Fatalf("SendWith failed: %v", err)
+	}
+	if n := len(requests()); n != 1+MaxMinTokensContinuations {
+		t.Errorf("Expected %d requests, got %d", 1+MaxMinTokensContinuations, n)
+	}
+}
+
+func TestSendStreamingMinTokens(t *testing.T) {
+	server, requests := minTokensServer(t)
+	conv := NewConversation("You are helpful.")
+	conv.Endpoint = server.URL
+	conv.ApiToken = "test-token"
+	conv.Settings.MinTokens = 6
+
+	var streamed string
+	var dones int
+	reply, _, _, outputTokens, _, _, err := conv.SendStreamingWith("Hello", SamplingProfile{},
+		func(text string, done bool) {
+			streamed += text
+			if done {
+				dones++
+			}
+		})
+	if err != nil {
+		t.Fatalf("SendStreamingWith failed: %v", err)
+	}
+	if reply != "part 1.part 2." || streamed != reply || outputTokens != 8 {
+		t.Errorf("Got reply %q, streamed %q, %d tokens", reply, streamed, outputTokens)
+	}
+	if dones != 1 {
+		t.Errorf("Expected done once, got %d", dones)
+	}
+	if len(requests()) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(requests()))
+	}
+}
@@ -0,0 +1,91 @@
+package novelai
+
+import "fmt"
+
+// Model is the ID of a text generation model, as sent to the API.
+type Model string
+
+// Text generation models.
+const (
+	// ModelGLM46 is GLM-4.6, NovelAI's chat-tuned model.
+	ModelGLM46 Model = "glm-4-6"
+	// ModelGLM47 is GLM-4.7.
+	ModelGLM47 Model = "glm-4-7"
+	// ModelErato is Llama 3 Erato, a story model.
+	ModelErato Model = "llama-3-erato-v1"
+	// ModelKayra is Kayra, a story model.
+	ModelKayra Model = "kayra-v1"
+)
+
+// ModelInfo describes a known text model.
+type ModelInfo struct {
+	ID   Model
+	Name string
+	// Chat is true for models trained on a chat template, false for story
+	// models that continue raw text.
+	Chat bool
+}
+
+// KnownModels lists the text models this package knows about.
+var KnownModels = []ModelInfo{
+	{ID: ModelGLM46, Name: "GLM-4.6", Chat: true},
+	{ID: ModelGLM47, Name: "GLM-4.7", Chat: true},
+	{ID: ModelErato, Name: "Llama 3 Erato", Chat: false},
+	{ID: ModelKayra, Name: "Kayra", Chat: false},
+}
+
+// LookupModel returns information about a known model.
+func LookupModel(model Model) (ModelInfo, bool) {
+	for _, m := range KnownModels {
+		if m.ID == model {
+			return m, true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// IsChatModel reports whether model is a known chat model.
+func IsChatModel(model Model) bool {
+	m, ok := LookupModel(model)
+	return ok && m.Chat
+}
+
+// IsStoryModel reports whether model is a known story model.
+func IsStoryModel(model Model) bool {
+	m, ok := LookupModel(model)
+	return ok && !m.Chat
+}
+
+// ValidateModel returns an error if model is not a known model.
+func ValidateModel(model Model) error {
+	if _, ok := LookupModel(model); !ok {
+		return fmt.Errorf("unknown model: %q", model)
+	}
+	return nil
+}
+
+// UseModel changes the model for subsequent API calls. It returns an
+// error, leaving the model unchanged, if model is neither a known model
+// nor has a registered prompt template; register a template with
+// RegisterPromptTemplate to use a model newer than this package. If a
+// template is registered for model it is applied with ApplyTemplate.
+func (c *Conversation) UseModel(model Model) error {
+	if err := checkModel(model); err != nil {
+		return err
+	}
+	c.Settings.Model = model
+	c.modelErr = nil
+	if t, ok := LookupPromptTemplate(model); ok {
+		c.ApplyTemplate(t)
+	}
+	return nil
+}
+
+// checkModel returns an error if model is neither a known model nor has a
+// registered prompt template.
+func checkModel(model Model) error {
+	if _, ok := LookupPromptTemplate(model); ok {
+		return nil
+	}
+	return ValidateModel(model)
+}
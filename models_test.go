@@ -0,0 +1,75 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestModelClassification tests the chat and story model helpers.
+func TestModelClassification(t *testing.T) {
+	tests := []struct {
+		model       Model
+		chat, story bool
+	}{
+		{ModelGLM46, true, false},
+		{ModelGLM47, true, false},
+		{ModelErato, false, true},
+		{ModelKayra, false, true},
+		{"gpt-9", false, false},
+	}
+	for _, tc := range tests {
+		if got := IsChatModel(tc.model); got != tc.chat {
+			t.Errorf("IsChatModel(%q): expected %v, got %v", tc.model, tc.chat, got)
+		}
+		if got := IsStoryModel(tc.model); got != tc.story {
+			t.Errorf("IsStoryModel(%q): expected %v, got %v", tc.model, tc.story, got)
+		}
+	}
+	if DefaultSettings.Model != ModelGLM46 {
+		t.Errorf("Expected default model %s, got %s", ModelGLM46, DefaultSettings.Model)
+	}
+}
+
+// TestUseModel tests that unknown models are rejected.
+func TestUseModel(t *testing.T) {
+	conv := NewConversation("system")
+	if err := conv.UseModel(ModelGLM47); err != nil {
+		t.Fatalf("UseModel failed: %v", err)
+	}
+	if conv.Settings.Model != ModelGLM47 {
+		t.Errorf("Expected model %s, got %s", ModelGLM47, conv.Settings.Model)
+	}
+	if err := conv.UseModel("glm-4.7"); err == nil {
+		t.Error("Expected error for unknown model")
+	}
+	if conv.Settings.Model != ModelGLM47 {
+		t.Errorf("Expected model unchanged, got %s", conv.Settings.Model)
+	}
+}
+
+// TestSetModelValidates tests that SetModel keeps the model and fails
+// requests for an unknown model.
+func TestSetModelValidates(t *testing.T) {
+	conv := NewConversation("system")
+	NewFakeBackend().On(".", FakeResponse{Text: "Hi."}).Install(conv)
+	conv.SetModel("glm-4.7")
+	if conv.Settings.Model != ModelGLM46 {
+		t.Errorf("Expected model unchanged, got %s", conv.Settings.Model)
+	}
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err == nil || !strings.Contains(err.Error(), "unknown model") {
+		t.Errorf("Expected the model error from Send, got %v", err)
+	}
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Hello", SamplingProfile{}, nil); err == nil {
+		t.Error("Expected the model error from SendStreaming")
+	}
+
+	// A registered template admits a model the package does not know
+	RegisterPromptTemplate("glm-9-test", &PromptGLM47)
+	conv.SetModel("glm-9-test")
+	if conv.Settings.Model != "glm-9-test" {
+		t.Errorf("Expected the registered model set, got %s", conv.Settings.Model)
+	}
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err != nil {
+		t.Errorf("Send after a valid SetModel: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package novelai
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// verdictBuffer is the capacity of the channel returned by
+// Conversation.Verdicts.
+const verdictBuffer = 16
+
+// Classification is a classifier's judgement of a text.
+type Classification struct {
+	// Allowed reports whether the text may be shown or spoken.
+	Allowed bool
+	// Labels name what was found, such as the matched keywords.
+	Labels []string
+}
+
+// Classifier judges text before it is displayed or sent to TTS.
+type Classifier interface {
+	Classify(ctx context.Context, text string) (Classification, error)
+}
+
+// ClassifierFunc adapts a function to the Classifier interface.
+type ClassifierFunc func(ctx context.Context, text string) (Classification, error)
+
+// Classify calls f(ctx, text).
+func (f ClassifierFunc) Classify(ctx context.Context, text string) (Classification, error) {
+	return f(ctx, text)
+}
+
+// Verdict is the classification of a completed reply.
+type Verdict struct {
+	// Index is the reply's position in Conversation.Messages, or -1 for
+	// text classified with ClassifyAsync.
+	Index int
+	// Text is the classified text.
+	Text string
+	Classification
+	// Err is set if classification failed; Allowed is then false.
+	Err error
+}
+
+// KeywordClassifier returns a classifier that disallows text containing
+// any of words as a whole word, ignoring case. Labels are the matched
+// words, as given.
+func KeywordClassifier(words ...string) Classifier {
+	blocked := make(map[string]string, len(words))
+	for _, w := range words {
+		blocked[strings.ToLower(w)] = w
+	}
+	return ClassifierFunc(func(ctx context.Context, text string) (Classification, error) {
+		c := Classification{Allowed: true}
+		seen := map[string]bool{}
+		split := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' }
+		for _, f := range strings.FieldsFunc(strings.ToLower(text), split) {
+			if w, ok := blocked[f]; ok && !seen[f] {
+				seen[f] = true
+				c.Allowed = false
+				c.Labels = append(c.Labels, w)
+			}
+		}
+		return c, nil
+	})
+}
+
+// ClassifyAsync classifies text in the background and delivers the verdict
+// on the returned channel, which receives exactly one value.
+func ClassifyAsync(ctx context.Context, cl Classifier, text string) <-chan Verdict {
+	ch := make(chan Verdict, 1)
+	go func() { ch <- classify(ctx, cl, -1, text) }()
+	return ch
+}
+
+// classify runs cl, turning errors into a disallowing verdict.
+func classify(ctx context.Context, cl Classifier, index int, text string) Verdict {
+	c, err := cl.Classify(ctx, text)
+	if err != nil {
+		return Verdict{Index: index, Text: text, Err: err}
+	}
+	return Verdict{Index: index, Text: text, Classification: c}
+}
+
+// Verdicts returns the channel on which verdicts for completed replies are
+// delivered when Classifier is set. Replies are classified in the
+// background, so generation never waits on the classifier; read the
+// channel to gate display. Verdicts may arrive out of order once several
+// replies are pending; use Verdict.Index to match them.
+func (c *Conversation) Verdicts() <-chan Verdict {
+	if c.verdicts == nil {
+		c.verdicts = make(chan Verdict, verdictBuffer)
+	}
+	return c.verdicts
+}
+
+// classifyReply classifies the reply at Messages[index] in the background
+// if a Classifier is set. If the channel is full, delivery waits until it
+// is read or the conversation's context is done.
+func (c *Conversation) classifyReply(index int) {
+	if c.Classifier == nil {
+		return
+	}
+	c.Verdicts()
+	ch := c.verdicts
+	ctx, done, err := c.track(c.context())
+	if err != nil {
+		return
+	}
+	cl := c.Classifier
+	text := c.Messages[index].Content
+	go func() {
+		defer done()
+		v := classify(ctx, cl, index, text)
+		select {
+		case ch <- v:
+		case <-ctx.Done():
+		}
+	}()
+}
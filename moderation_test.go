@@ -0,0 +1,71 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+// TestKeywordClassifier tests whole-word, case-insensitive matching.
+func TestKeywordClassifier(t *testing.T) {
+	cl := KeywordClassifier("Darn", "heck")
+	c, err := cl.Classify(context.Background(), "Well, DARN it. Heck, darn!")
+	if err != nil {
+		t.Fatalf("Classify failed: %v", err)
+	}
+	if c.Allowed || len(c.Labels) != 2 || c.Labels[0] != "Darn" || c.Labels[1] != "heck" {
+		t.Errorf("Unexpected classification: %+v", c)
+	}
+	if c, _ := cl.Classify(context.Background(), "Darned hecklers."); !c.Allowed {
+		t.Errorf("Expected partial words allowed, got %+v", c)
+	}
+}
+
+// TestClassifyAsync tests background classification and errors.
+func TestClassifyAsync(t *testing.T) {
+	v := <-ClassifyAsync(context.Background(), KeywordClassifier("heck"), "oh heck")
+	if v.Allowed || v.Index != -1 || v.Text != "oh heck" {
+		t.Errorf("Unexpected verdict: %+v", v)
+	}
+	failing := ClassifierFunc(func(ctx context.Context, text string) (Classification, error) {
+		return Classification{Allowed: true}, errors.New("service down")
+	})
+	if v := <-ClassifyAsync(context.Background(), failing, "hi"); v.Err == nil || v.Allowed {
+		t.Errorf("Expected failed verdict to disallow, got %+v", v)
+	}
+}
+
+// TestConversationVerdicts tests that replies are classified without
+// blocking generation.
+func TestConversationVerdicts(t *testing.T) {
+	conv := NewConversation("")
+	NewFakeBackend().On(".*", FakeResponse{Text: "Oh heck."}).Install(conv)
+	release := make(chan struct{})
+	conv.Classifier = ClassifierFunc(func(ctx context.Context, text string) (Classification, error) {
+		<-release
+		return KeywordClassifier("heck").Classify(ctx, text)
+	})
+
+	reply, _, _, _, _, _, err := conv.Send("Hi", llmapi.Sampling{})
+	if err != nil || reply != "Oh heck." {
+		t.Fatalf("Send failed: %q, %v", reply, err)
+	}
+	select {
+	case v := <-conv.Verdicts():
+		t.Fatalf("Expected verdict to wait for the classifier, got %+v", v)
+	default:
+	}
+	close(release)
+
+	select {
+	case v := <-conv.Verdicts():
+		if v.Index != 1 || v.Allowed || v.Labels[0] != "heck" {
+			t.Errorf("Unexpected verdict: %+v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a verdict")
+	}
+}
@@ -0,0 +1,101 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PrefixVanilla selects no module.
+const PrefixVanilla = "vanilla"
+
+// Module is an AI module (prefix) that can be selected for story generation.
+type Module struct {
+	// ID is the value sent as the request prefix. Set it as a scenario's
+	// Settings.Prefix to select the module.
+	ID string `json:"id"`
+	// Name is the display name, if known.
+	Name string `json:"name,omitempty"`
+	// Official is true for modules provided by NovelAI.
+	Official bool `json:"official"`
+}
+
+// OfficialModules lists NovelAI's official modules.
+var OfficialModules = []Module{
+	{ID: PrefixVanilla, Name: "No Module", Official: true},
+	{ID: "general_crossgenre", Name: "Cross-Genre", Official: true},
+	{ID: "theme_textadventure", Name: "Text Adventure", Official: true},
+	{ID: "special_instruct", Name: "Instruct", Official: true},
+	{ID: "special_proseaugmenter", Name: "Prose Augmenter", Official: true},
+	{ID: "theme_generalfantasy", Name: "General Fantasy", Official: true},
+	{ID: "theme_darkfantasy", Name: "Dark Fantasy", Official: true},
+	{ID: "theme_dragons", Name: "Dragons", Official: true},
+	{ID: "theme_magicacademy", Name: "Magic Academy", Official: true},
+	{ID: "theme_medieval", Name: "Medieval", Official: true},
+	{ID: "theme_pirates", Name: "Pirates", Official: true},
+	{ID: "theme_postapocalyptic", Name: "Post-Apocalyptic", Official: true},
+	{ID: "theme_militaryscifi", Name: "Military Sci-Fi", Official: true},
+	{ID: "theme_superheroes", Name: "Superheroes", Official: true},
+	{ID: "theme_19thcenturyromance", Name: "19th Century Romance", Official: true},
+	{ID: "style_arthurconandoyle", Name: "Arthur Conan Doyle", Official: true},
+	{ID: "style_edgarallanpoe", Name: "Edgar Allan Poe", Official: true},
+	{ID: "style_hplovecraft", Name: "H.P. Lovecraft", Official: true},
+	{ID: "style_julesverne", Name: "Jules Verne", Official: true},
+}
+
+// IsOfficialModule reports whether id names an official module.
+func IsOfficialModule(id string) bool {
+	for _, m := range OfficialModules {
+		if m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// modulePrefix returns the request prefix for a scenario's Prefix setting.
+// An empty prefix means no module.
+func modulePrefix(prefix string) string {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return PrefixVanilla
+	}
+	return prefix
+}
+
+// userObjectsResponse is the response from /user/objects/{type}.
+type userObjectsResponse struct {
+	Objects []struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Meta string `json:"meta"`
+	} `json:"objects"`
+}
+
+// ListModules returns the official modules followed by the account's custom
+// modules. Custom module contents are encrypted with the account keystore,
+// so Name is only set when the module's metadata is stored unencrypted.
+func (c *Client) ListModules(ctx context.Context) ([]Module, error) {
+	body, err := c.do(ctx, "GET", c.apiURL()+"/user/objects/aimodules", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp userObjectsResponse
+	if err := c.codec().Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("error parsing modules response: %w", err)
+	}
+
+	modules := append([]Module(nil), OfficialModules...)
+	for _, obj := range resp.Objects {
+		module := Module{ID: obj.ID}
+		var meta struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal([]byte(obj.Meta), &meta) == nil {
+			module.Name = meta.Name
+		}
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
@@ -0,0 +1,64 @@
+package novelai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestListModules tests merging official and custom modules.
+func TestListModules(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/user/objects/aimodules" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"objects":[
+			{"id":"custom-1","type":"aimodules","meta":"{\"name\":\"My Module\"}","data":"..."},
+			{"id":"custom-2","type":"aimodules","meta":"ZW5jcnlwdGVk","data":"..."}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.ApiToken = "test-token"
+	client.APIURL = server.URL
+
+	modules, err := client.ListModules(context.Background())
+	if err != nil {
+		t.Fatalf("ListModules failed: %v", err)
+	}
+	if len(modules) != len(OfficialModules)+2 {
+		t.Fatalf("Expected %d modules, got %d", len(OfficialModules)+2, len(modules))
+	}
+	custom := modules[len(OfficialModules):]
+	if custom[0].ID != "custom-1" || custom[0].Name != "My Module" || custom[0].Official {
+		t.Errorf("Unexpected first custom module: %+v", custom[0])
+	}
+	if custom[1].ID != "custom-2" || custom[1].Name != "" {
+		t.Errorf("Expected encrypted meta to leave name empty, got %+v", custom[1])
+	}
+}
+
+// TestModulePrefix tests module selection in native requests.
+func TestModulePrefix(t *testing.T) {
+	if !IsOfficialModule("theme_textadventure") || IsOfficialModule("custom-1") {
+		t.Error("Unexpected IsOfficialModule result")
+	}
+
+	s := NewScenario("Modules")
+	s.Settings.Prefix = ""
+	req, err := NewGenerateRequest(s, "story", byteTokenizer)
+	if err != nil {
+		t.Fatalf("NewGenerateRequest failed: %v", err)
+	}
+	if req.Parameters.Prefix != PrefixVanilla {
+		t.Errorf("Expected empty prefix to select %q, got %q", PrefixVanilla, req.Parameters.Prefix)
+	}
+
+	s.Settings.Prefix = "custom-1"
+	req, _ = NewGenerateRequest(s, "story", byteTokenizer)
+	if req.Parameters.Prefix != "custom-1" {
+		t.Errorf("Expected custom module prefix, got %q", req.Parameters.Prefix)
+	}
+}
@@ -0,0 +1,142 @@
+package novelai
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+)
+
+// Module training defaults.
+const (
+	// DefaultModuleLR is the learning rate used by NovelAI's module trainer.
+	DefaultModuleLR = 0.0001
+	// AnlasPerTrainingStep is the Anlas cost of one training step.
+	AnlasPerTrainingStep = 1
+)
+
+// Module training statuses reported by the API.
+const (
+	ModuleStatusPending  = "pending"
+	ModuleStatusTraining = "training"
+	ModuleStatusReady    = "ready"
+	ModuleStatusError    = "error"
+)
+
+// ModuleTrainRequest starts training a custom module.
+type ModuleTrainRequest struct {
+	// Data is the training text, base64 encoded.
+	Data        string  `json:"data"`
+	LR          float64 `json:"lr"`
+	Steps       int     `json:"steps"`
+	Name        string  `json:"name"`
+	Description string  `json:"desc"`
+}
+
+// TrainedModule is a custom module on the account and its training state.
+type TrainedModule struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Model         string    `json:"model"`
+	Status        string    `json:"status"`
+	LR            float64   `json:"lr"`
+	Steps         int       `json:"steps"`
+	Loss          float64   `json:"loss"`
+	LossHistory   []float64 `json:"lossHistory,omitempty"`
+	LastUpdatedAt int64     `json:"lastUpdatedAt"`
+}
+
+// NewModuleTrainRequest creates a training request for text with the
+// default learning rate.
+func NewModuleTrainRequest(name, description string, text []byte, steps int) *ModuleTrainRequest {
+	return &ModuleTrainRequest{
+		Data:        base64.StdEncoding.EncodeToString(text),
+		LR:          DefaultModuleLR,
+		Steps:       steps,
+		Name:        name,
+		Description: description,
+	}
+}
+
+// Validate checks the request before it is sent.
+func (r *ModuleTrainRequest) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("module name is required")
+	}
+	if r.Data == "" {
+		return fmt.Errorf("module training data is empty")
+	}
+	if r.Steps <= 0 {
+		return fmt.Errorf("training steps must be positive, got %d", r.Steps)
+	}
+	if r.LR <= 0 {
+		return fmt.Errorf("learning rate must be positive, got %g", r.LR)
+	}
+	return nil
+}
+
+// Cost returns the estimated Anlas cost of the request.
+func (r *ModuleTrainRequest) Cost() int {
+	return EstimateTrainingCost(r.Steps)
+}
+
+// EstimateTrainingCost returns the Anlas cost of training for steps.
+func EstimateTrainingCost(steps int) int {
+	return max(steps, 0) * AnlasPerTrainingStep
+}
+
+// TrainModule starts training a custom module. Training runs asynchronously;
+// poll TrainedModule until Status is ModuleStatusReady. Only models that
+// support custom modules can be trained.
+func (c *Client) TrainModule(ctx context.Context, req *ModuleTrainRequest) (*TrainedModule, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	body, err := c.post(ctx, c.apiURL()+"/ai/module/train", req)
+	if err != nil {
+		return nil, err
+	}
+	var module TrainedModule
+	if err := c.codec().Unmarshal(body, &module); err != nil {
+		return nil, fmt.Errorf("error parsing module response: %w", err)
+	}
+	return &module, nil
+}
+
+// TrainedModules returns the account's trained custom modules.
+func (c *Client) TrainedModules(ctx context.Context) ([]TrainedModule, error) {
+	body, err := c.do(ctx, "GET", c.apiURL()+"/ai/module/all", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var modules []TrainedModule
+	if err := c.codec().Unmarshal(body, &modules); err != nil {
+		return nil, fmt.Errorf("error parsing modules response: %w", err)
+	}
+	return modules, nil
+}
+
+// TrainedModule returns a custom module by ID.
+func (c *Client) TrainedModule(ctx context.Context, id string) (*TrainedModule, error) {
+	body, err := c.do(ctx, "GET", c.moduleURL(id), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var module TrainedModule
+	if err := c.codec().Unmarshal(body, &module); err != nil {
+		return nil, fmt.Errorf("error parsing module response: %w", err)
+	}
+	return &module, nil
+}
+
+// DeleteModule deletes a custom module by ID.
+func (c *Client) DeleteModule(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", c.moduleURL(id), "", nil)
+	return err
+}
+
+// moduleURL returns the endpoint for a single custom module.
+func (c *Client) moduleURL(id string) string {
+	return c.apiURL() + "/ai/module/" + url.PathEscape(id)
+}
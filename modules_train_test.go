@@ -0,0 +1,103 @@
+package novelai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestModuleTrainingEndpoints tests training, listing, fetching and deleting modules.
+func TestModuleTrainingEndpoints(t *testing.T) {
+	var trained ModuleTrainRequest
+	var deleted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/ai/module/train":
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &trained)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"m1","name":"Sea Stories","status":"pending","steps":200,"lr":0.0001}`))
+		case r.Method == "GET" && r.URL.Path == "/ai/module/all":
+			w.Write([]byte(`[{"id":"m1","status":"training","loss":2.5},{"id":"m2","status":"ready"}]`))
+		case r.Method == "GET" && r.URL.Path == "/ai/module/m1":
+			w.Write([]byte(`{"id":"m1","status":"ready","lossHistory":[3.1,2.4]}`))
+		case r.Method == "DELETE":
+			deleted = r.URL.Path
+			w.Write([]byte(`{}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.ApiToken = "test-token"
+	client.APIURL = server.URL
+	ctx := context.Background()
+
+	req := NewModuleTrainRequest("Sea Stories", "Nautical fiction", []byte("The ship sailed."), 200)
+	if req.Cost() != 200 {
+		t.Errorf("Expected cost 200 Anlas, got %d", req.Cost())
+	}
+	module, err := client.TrainModule(ctx, req)
+	if err != nil {
+		t.Fatalf("TrainModule failed: %v", err)
+	}
+	if module.ID != "m1" || module.Status != ModuleStatusPending {
+		t.Errorf("Unexpected trained module: %+v", module)
+	}
+	if data, _ := base64.StdEncoding.DecodeString(trained.Data); string(data) != "The ship sailed." {
+		t.Errorf("Expected base64 training data, got %q", trained.Data)
+	}
+	if trained.Description != "Nautical fiction" || trained.Steps != 200 {
+		t.Errorf("Unexpected train request: %+v", trained)
+	}
+
+	modules, err := client.TrainedModules(ctx)
+	if err != nil {
+		t.Fatalf("TrainedModules failed: %v", err)
+	}
+	if len(modules) != 2 || modules[0].Loss != 2.5 {
+		t.Errorf("Unexpected modules: %+v", modules)
+	}
+
+	module, err = client.TrainedModule(ctx, "m1")
+	if err != nil {
+		t.Fatalf("TrainedModule failed: %v", err)
+	}
+	if module.Status != ModuleStatusReady || len(module.LossHistory) != 2 {
+		t.Errorf("Unexpected module: %+v", module)
+	}
+
+	if err := client.DeleteModule(ctx, "m/2"); err != nil {
+		t.Fatalf("DeleteModule failed: %v", err)
+	}
+	if deleted != "/ai/module/m/2" {
+		t.Errorf("Expected delete of escaped ID, got %s", deleted)
+	}
+}
+
+// TestModuleTrainRequestValidate tests request validation.
+func TestModuleTrainRequestValidate(t *testing.T) {
+	for name, req := range map[string]*ModuleTrainRequest{
+		"no name":  NewModuleTrainRequest("", "", []byte("x"), 10),
+		"no data":  NewModuleTrainRequest("n", "", nil, 10),
+		"no steps": NewModuleTrainRequest("n", "", []byte("x"), 0),
+		"bad lr":   {Name: "n", Data: "eA==", Steps: 10},
+	} {
+		if err := req.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+	if err := NewModuleTrainRequest("n", "", []byte("x"), 10).Validate(); err != nil {
+		t.Errorf("Expected valid request, got %v", err)
+	}
+	if EstimateTrainingCost(-5) != 0 {
+		t.Error("Expected zero cost for negative steps")
+	}
+}
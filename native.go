@@ -0,0 +1,320 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Base URLs for NovelAI's native APIs.
+// These are the defaults; they can be overridden per-client.
+var (
+	// DefaultTextURL serves text generation (/ai/generate).
+	DefaultTextURL = "https://text.novelai.net"
+	// DefaultAPIURL serves account-level endpoints such as user modules.
+	DefaultAPIURL = "https://api.novelai.net"
+)
+
+// Client calls NovelAI's native APIs, as used by the NovelAI web app.
+// Unlike Conversation, which targets the OpenAI-compatible chat endpoint,
+// Client exposes the full story-mode sampler set, token-level biases and
+// the non-text services.
+type Client struct {
+	// ApiToken is the NovelAI API token.
+	ApiToken string
+	// HttpClient is used for API requests.
+	HttpClient *http.Client
+	// TextURL overrides DefaultTextURL if set.
+	TextURL string
+	// APIURL overrides DefaultAPIURL if set.
+	APIURL string
+	// ImageURL overrides DefaultImageURL if set.
+	ImageURL string
+	// Codec, if set, replaces DefaultCodec for requests and responses.
+	Codec JSONCodec
+	// MaxBodyBytes limits response bodies, including images. If zero,
+	// DefaultMaxBodyBytes is used.
+	MaxBodyBytes int64
+	// Retry, if set, replaces DefaultRetryPolicy for this client.
+	Retry *RetryPolicy
+	// Clock, if set, replaces SystemClock for waiting between retries.
+	Clock Clock
+	// Quota, if set, limits requests made for an end user set on their
+	// context with WithQuotaUser. Requests without one are not limited.
+	// Generate charges the requested MaxLength as tokens, since the
+	// native API does not report usage.
+	Quota *Quota
+
+	// life tracks requests for Shutdown.
+	life *lifecycle
+}
+
+// NewClient creates a client using the token from CurrentDefaults.
+func NewClient() *Client {
+	return &Client{
+		ApiToken:   CurrentDefaults().ApiToken,
+		HttpClient: &http.Client{Timeout: 120 * time.Second},
+		life:       newLifecycle(),
+	}
+}
+
+// GenerateParameters are the sampling parameters of a native /ai/generate request.
+type GenerateParameters struct {
+	UseString                         bool           `json:"use_string"`
+	Temperature                       float64        `json:"temperature,omitempty"`
+	MaxLength                         int            `json:"max_length,omitempty"`
+	MinLength                         int            `json:"min_length,omitempty"`
+	TopK                              int            `json:"top_k,omitempty"`
+	TopP                              float64        `json:"top_p,omitempty"`
+	TopA                              float64        `json:"top_a,omitempty"`
+	TypicalP                          float64        `json:"typical_p,omitempty"`
+	TailFreeSampling                  float64        `json:"tail_free_sampling,omitempty"`
+	MinP                              float64        `json:"min_p,omitempty"`
+	TopG                              int            `json:"top_g,omitempty"`
+	MirostatTau                       float64        `json:"mirostat_tau,omitempty"`
+	MirostatLR                        float64        `json:"mirostat_lr,omitempty"`
+	Math1Temp                         float64        `json:"math1_temp,omitempty"`
+	Math1Quad                         float64        `json:"math1_quad,omitempty"`
+	Math1QuadEntropyScale             float64        `json:"math1_quad_entropy_scale,omitempty"`
+	RepetitionPenalty                 float64        `json:"repetition_penalty,omitempty"`
+	RepetitionPenaltyRange            int            `json:"repetition_penalty_range,omitempty"`
+	RepetitionPenaltySlope            float64        `json:"repetition_penalty_slope,omitempty"`
+	RepetitionPenaltyFrequency        float64        `json:"repetition_penalty_frequency,omitempty"`
+	RepetitionPenaltyPresence         float64        `json:"repetition_penalty_presence,omitempty"`
+	RepetitionPenaltyDefaultWhitelist bool           `json:"repetition_penalty_default_whitelist,omitempty"`
+	PhraseRepPen                      string         `json:"phrase_rep_pen,omitempty"`
+	CFGScale                          float64        `json:"cfg_scale,omitempty"`
+	CFGUC                             string         `json:"cfg_uc,omitempty"`
+	Order                             []int          `json:"order,omitempty"`
+	Prefix                            string         `json:"prefix,omitempty"`
+	StopSequences                     [][]int        `json:"stop_sequences,omitempty"`
+	BadWordsIDs                       [][]int        `json:"bad_words_ids,omitempty"`
+	LogitBiasExp                      []LogitBiasExp `json:"logit_bias_exp,omitempty"`
+	GenerateUntilSentence             bool           `json:"generate_until_sentence,omitempty"`
+}
+
+// GenerateRequest is a native /ai/generate request.
+type GenerateRequest struct {
+	Input      string             `json:"input"`
+	Model      Model              `json:"model"`
+	Parameters GenerateParameters `json:"parameters"`
+}
+
+// generateResponse is the native /ai/generate response with use_string set.
+type generateResponse struct {
+	Output string `json:"output"`
+}
+
+// NativeParameters converts scenario generation parameters to native
+// request parameters. CFG settings are included only if guidance is enabled,
+// and the sampler order lists only enabled samplers (unknown IDs are skipped;
+// see GenerationParams.ValidateOrder). Token-level fields (biases, stop
+// sequences) are left empty; see NewGenerateRequest.
+func NativeParameters(p *GenerationParams) GenerateParameters {
+	if p == nil {
+		p = DefaultGenerationParams()
+	}
+	params := GenerateParameters{
+		UseString:                         true,
+		Temperature:                       p.Temperature,
+		MaxLength:                         p.MaxLength,
+		MinLength:                         p.MinLength,
+		TopK:                              p.TopK,
+		TopP:                              p.TopP,
+		TopA:                              p.TopA,
+		TypicalP:                          p.TypicalP,
+		TailFreeSampling:                  p.TailFreeSampling,
+		MinP:                              p.MinP,
+		TopG:                              p.TopG,
+		MirostatTau:                       p.MirostatTau,
+		MirostatLR:                        p.MirostatLR,
+		Math1Temp:                         p.Math1Temp,
+		Math1Quad:                         p.Math1Quad,
+		Math1QuadEntropyScale:             p.Math1QuadEntropyScale,
+		RepetitionPenalty:                 p.RepetitionPenalty,
+		RepetitionPenaltyRange:            p.RepetitionPenaltyRange,
+		RepetitionPenaltySlope:            p.RepetitionPenaltySlope,
+		RepetitionPenaltyFrequency:        p.RepetitionPenaltyFrequency,
+		RepetitionPenaltyPresence:         p.RepetitionPenaltyPresence,
+		RepetitionPenaltyDefaultWhitelist: p.RepetitionPenaltyDefaultWhitelist,
+		PhraseRepPen:                      p.PhraseRepPen,
+		Order:                             nativeOrder(p.Order),
+	}
+	if CFGEnabled(p) {
+		params.CFGScale = p.CFGScale
+		params.CFGUC = p.CFGUC
+	}
+	return params
+}
+
+// CFGEnabled reports whether p uses classifier-free guidance. A scale of 1
+// (the default) or 0 disables guidance.
+func CFGEnabled(p *GenerationParams) bool {
+	return p != nil && p.CFGScale != 0 && p.CFGScale != 1
+}
+
+// SetCFG enables classifier-free guidance with the given scale and negative
+// prompt. Higher scales push generation further from the negative prompt;
+// a scale of 1 disables guidance. Returns an error if scale is below 1.
+func (p *GenerationParams) SetCFG(scale float64, negative string) error {
+	if scale < 1 {
+		return fmt.Errorf("CFG scale %g must be at least 1", scale)
+	}
+	p.CFGScale = scale
+	p.CFGUC = negative
+	return nil
+}
+
+// NegativePrompt builds a CFG negative prompt from lines of text describing
+// what generation should steer away from, such as an author's note for an
+// unwanted style. Lines are trimmed, blank lines are dropped, and the result
+// ends with a newline so it reads like a context entry.
+func NegativePrompt(lines ...string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// NegativeStylePrompt builds a negative prompt in author's note style,
+// "[ Style: a, b ]", from the styles generation should avoid.
+func NegativeStylePrompt(styles ...string) string {
+	var kept []string
+	for _, style := range styles {
+		if style = strings.TrimSpace(style); style != "" {
+			kept = append(kept, style)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return NegativePrompt("[ Style: " + strings.Join(kept, ", ") + " ]")
+}
+
+// NewGenerateRequest builds a native generation request for continuing story
+// with scenario s. The input is the assembled context (see ContextBuilder),
+// the module is taken from the scenario's Prefix setting, and the scenario's
+// phrase biases, active lore biases and banned sequences are compiled with tok.
+func NewGenerateRequest(s *Scenario, story string, tok Tokenizer) (*GenerateRequest, error) {
+	if p := s.Settings.Parameters; p != nil {
+		if err := p.ValidateOrder(); err != nil {
+			return nil, fmt.Errorf("error in sampler order: %w", err)
+		}
+	}
+	params := NativeParameters(s.Settings.Parameters)
+	params.Prefix = modulePrefix(s.Settings.Prefix)
+
+	biases, err := CompileBiasGroups(s.ActiveBiasGroups(story), tok)
+	if err != nil {
+		return nil, err
+	}
+	params.LogitBiasExp = biases
+
+	banned, err := CompileBannedSequences(s.BannedSequenceGroups, tok)
+	if err != nil {
+		return nil, err
+	}
+	params.BadWordsIDs = banned
+
+	return &GenerateRequest{
+		Input:      NewContextBuilder(s).Build(story),
+		Model:      s.Settings.Model,
+		Parameters: params,
+	}, nil
+}
+
+// Generate sends a native generation request and returns the generated text.
+func (c *Client) Generate(ctx context.Context, req *GenerateRequest) (string, error) {
+	body, err := c.post(ctx, c.textURL()+"/ai/generate", req)
+	if err != nil {
+		return "", err
+	}
+	if user, ok := c.quotaUser(ctx); ok {
+		c.Quota.Record(user, req.Parameters.MaxLength)
+	}
+	var resp generateResponse
+	if err := c.codec().Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("error parsing response: %w", err)
+	}
+	return resp.Output, nil
+}
+
+// post sends payload as JSON to url with retries and returns the response body.
+func (c *Client) post(ctx context.Context, url string, payload any) ([]byte, error) {
+	jsonData, err := c.codec().Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+	return c.do(ctx, "POST", url, "application/json", jsonData)
+}
+
+// do performs an authenticated request with retries and returns the
+// response body. Non-2xx responses are returned as errors.
+func (c *Client) do(ctx context.Context, method, url, contentType string, data []byte) ([]byte, error) {
+	if c.ApiToken == "" {
+		return nil, fmt.Errorf("API token not set")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if user, ok := c.quotaUser(ctx); ok {
+		if err := c.Quota.Allow(user); err != nil {
+			return nil, err
+		}
+	}
+	ctx, done, err := c.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	req, err := newRequest(ctx, method, url, c.ApiToken, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doWithRetries(c.httpClient(), req, c.retryPolicy(), clockOr(c.Clock))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readBody(resp.Body, c.maxBodyBytes())
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// httpClient returns HttpClient, or http.DefaultClient if unset.
+func (c *Client) httpClient() *http.Client {
+	if c.HttpClient != nil {
+		return c.HttpClient
+	}
+	return http.DefaultClient
+}
+
+// textURL returns TextURL if set, otherwise DefaultTextURL.
+func (c *Client) textURL() string {
+	if c.TextURL != "" {
+		return c.TextURL
+	}
+	return DefaultTextURL
+}
+
+// apiURL returns APIURL if set, otherwise DefaultAPIURL.
+func (c *Client) apiURL() string {
+	if c.APIURL != "" {
+		return c.APIURL
+	}
+	return DefaultAPIURL
+}
@@ -0,0 +1,154 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestClient returns a client whose text API is served by handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewClient()
+	client.ApiToken = "test-token"
+	client.TextURL = server.URL
+	return client
+}
+
+// TestClientGenerate tests the native generate request and response.
+func TestClientGenerate(t *testing.T) {
+	var received map[string]any
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ai/generate" {
+			t.Errorf("Expected path /ai/generate, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("Expected bearer token, got %q", r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		w.Write([]byte(`{"output":" and then it rained."}`))
+	})
+
+	req := &GenerateRequest{
+		Input: "It was sunny",
+		Model: "kayra-v1",
+		Parameters: GenerateParameters{
+			UseString:    true,
+			Temperature:  1.1,
+			LogitBiasExp: []LogitBiasExp{{Sequence: []int{1, 2}, Bias: -0.5, GenerateOnce: true}},
+		},
+	}
+	output, err := client.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if output != " and then it rained." {
+		t.Errorf("Unexpected output: %q", output)
+	}
+
+	params := received["parameters"].(map[string]any)
+	if params["use_string"] != true || params["temperature"] != 1.1 {
+		t.Errorf("Unexpected parameters: %v", params)
+	}
+	biases := params["logit_bias_exp"].([]any)
+	bias := biases[0].(map[string]any)
+	if bias["bias"] != -0.5 || bias["generate_once"] != true || bias["ensure_sequence_finish"] != false {
+		t.Errorf("Unexpected logit_bias_exp entry: %v", bias)
+	}
+}
+
+// TestClientGenerateError tests that API errors are returned.
+func TestClientGenerateError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		w.Write([]byte(`{"statusCode":402,"message":"Inactive subscription"}`))
+	})
+
+	_, err := client.Generate(context.Background(), &GenerateRequest{Input: "x"})
+	if err == nil || !strings.Contains(err.Error(), "402") {
+		t.Errorf("Expected status 402 error, got %v", err)
+	}
+
+	client.ApiToken = ""
+	if _, err := client.Generate(context.Background(), &GenerateRequest{}); err == nil {
+		t.Error("Expected error without API token")
+	}
+}
+
+// TestNewGenerateRequest tests building a native request from a scenario.
+func TestNewGenerateRequest(t *testing.T) {
+	s := NewScenario("Native")
+	s.Settings.Model = "kayra-v1"
+	s.Settings.Parameters.Temperature = 0.7
+	s.PhraseBiasGroups = []BiasGroup{{Phrases: []string{"{ok}"}, Bias: 1, Enabled: true}}
+	s.BannedSequenceGroups = []BiasGroup{{Phrases: []string{"[3]"}, Enabled: true}}
+
+	req, err := NewGenerateRequest(s, "The story so far.", byteTokenizer)
+	if err != nil {
+		t.Fatalf("NewGenerateRequest failed: %v", err)
+	}
+	if req.Model != "kayra-v1" || req.Input != "The story so far." {
+		t.Errorf("Unexpected request: model %q, input %q", req.Model, req.Input)
+	}
+	if !req.Parameters.UseString || req.Parameters.Temperature != 0.7 {
+		t.Errorf("Unexpected parameters: %+v", req.Parameters)
+	}
+	if len(req.Parameters.LogitBiasExp) != 1 || len(req.Parameters.BadWordsIDs) != 1 {
+		t.Errorf("Expected 1 bias and 1 banned sequence, got %v and %v",
+			req.Parameters.LogitBiasExp, req.Parameters.BadWordsIDs)
+	}
+}
+
+// TestNativeParametersCFG tests that CFG settings are sent only when enabled.
+func TestNativeParametersCFG(t *testing.T) {
+	p := DefaultGenerationParams()
+	p.CFGUC = "ignored"
+	if params := NativeParameters(p); params.CFGScale != 0 || params.CFGUC != "" {
+		t.Errorf("Expected CFG omitted at scale 1, got scale %g, uc %q", params.CFGScale, params.CFGUC)
+	}
+
+	negative := NegativeStylePrompt("flowery", " ", "purple prose")
+	if negative != "[ Style: flowery, purple prose ]\n" {
+		t.Errorf("Unexpected negative prompt: %q", negative)
+	}
+	if err := p.SetCFG(1.5, negative); err != nil {
+		t.Fatalf("SetCFG failed: %v", err)
+	}
+	if !CFGEnabled(p) {
+		t.Error("Expected CFG enabled at scale 1.5")
+	}
+
+	data, _ := json.Marshal(NativeParameters(p))
+	var decoded map[string]any
+	json.Unmarshal(data, &decoded)
+	if decoded["cfg_scale"] != 1.5 || decoded["cfg_uc"] != negative {
+		t.Errorf("Expected cfg_scale and cfg_uc in request, got %s", data)
+	}
+
+	if err := p.SetCFG(0.5, ""); err == nil {
+		t.Error("Expected error for CFG scale below 1")
+	}
+	if p.CFGScale != 1.5 {
+		t.Errorf("Expected rejected SetCFG to leave scale unchanged, got %g", p.CFGScale)
+	}
+}
+
+// TestNegativePrompt tests line cleanup in negative prompts.
+func TestNegativePrompt(t *testing.T) {
+	if got := NegativePrompt("  cheerful tone ", "", "\tmodern slang\n"); got != "cheerful tone\nmodern slang\n" {
+		t.Errorf("Unexpected negative prompt: %q", got)
+	}
+	if got := NegativePrompt(); got != "" {
+		t.Errorf("Expected empty negative prompt, got %q", got)
+	}
+	if got := NegativeStylePrompt(" "); got != "" {
+		t.Errorf("Expected empty style prompt, got %q", got)
+	}
+}
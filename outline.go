@@ -0,0 +1,235 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Limits for OutlineDriver's side requests.
+const (
+	// DefaultSectionAttempts is how many drafts of a section are judged
+	// before the last one is kept anyway.
+	DefaultSectionAttempts = 3
+	// MaxJudgeTokens caps the reply of a judge pass.
+	MaxJudgeTokens = 64
+	// MaxOutlineSummaryTokens caps the running summary of the story.
+	MaxOutlineSummaryTokens = 400
+)
+
+// OutlineSection is one section, such as a chapter, of an outline.
+type OutlineSection struct {
+	Title   string `json:"title"`
+	Outline string `json:"outline"`
+}
+
+// DraftSection is a generated section.
+type DraftSection struct {
+	OutlineSection
+	// Text is the kept draft.
+	Text string `json:"text"`
+	// Attempts is how many drafts were generated.
+	Attempts int `json:"attempts"`
+	// Passed reports whether the judge accepted the kept draft.
+	Passed bool `json:"passed"`
+	// Verdict is the judge's reason for its last judgement.
+	Verdict string `json:"verdict,omitempty"`
+}
+
+// OutlineProgress is the state of an OutlineDriver run, saved after each
+// section so that a long run can resume where it stopped.
+type OutlineProgress struct {
+	// Sections are the finished sections, in order.
+	Sections []DraftSection `json:"sections"`
+	// Summary summarizes the finished sections.
+	Summary string `json:"summary"`
+}
+
+// Text returns the finished sections joined by blank lines.
+func (p *OutlineProgress) Text() string {
+	texts := make([]string, len(p.Sections))
+	for i, s := range p.Sections {
+		texts[i] = s.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// SectionInstruction builds the instruction to write section s of a story
+// whose earlier sections are summarized by summary. feedback, if set, is
+// the judge's reason for rejecting the previous draft.
+func SectionInstruction(summary string, s OutlineSection, feedback string) string {
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString("Summary of the story so far:\n" + summary + "\n\n")
+	}
+	fmt.Fprintf(&b, "Write the next section of the story, %q, following this outline:\n%s\n\n", s.Title, s.Outline)
+	if feedback != "" {
+		b.WriteString("A previous draft was rejected: " + feedback + "\n\n")
+	}
+	b.WriteString("Respond with only the section's prose.")
+	return b.String()
+}
+
+// JudgeInstruction builds the instruction to check a section against its
+// outline.
+func JudgeInstruction(outline, section string) string {
+	return "Does the section below cover every point of its outline without contradicting it? " +
+		"Answer PASS or FAIL, then a one-sentence reason.\n\nOutline:\n" + outline +
+		"\n\nSection:\n" + section
+}
+
+// OutlineSummaryInstruction builds the instruction to extend the summary
+// of a story with its newest section.
+func OutlineSummaryInstruction(summary, section string) string {
+	if summary == "" {
+		summary = "(none yet)"
+	}
+	return "Update the summary of a story with its newest section. Keep the events, " +
+		"characters and open threads a writer needs to continue it, in a few short paragraphs. " +
+		"Respond with only the summary.\n\nSummary so far:\n" + summary +
+		"\n\nNewest section:\n" + section
+}
+
+// ParseJudgement reads a judge reply: whether it passed, and its reason.
+// Replies that neither pass nor fail count as failing.
+func ParseJudgement(reply string) (bool, string) {
+	reply = strings.TrimSpace(reply)
+	word := strings.ToUpper(strings.TrimLeft(reply, "*#`\"' "))
+	pass := strings.HasPrefix(word, "PASS")
+	reason := reply
+	if pass || strings.HasPrefix(word, "FAIL") {
+		reason = strings.TrimSpace(strings.TrimLeft(reply, "*#`\"' ")[4:])
+		reason = strings.TrimSpace(strings.TrimLeft(reason, "*:.-–— "))
+	}
+	return pass, reason
+}
+
+// judgeVerdict extracts the reply of a judge that passed or failed.
+func judgeVerdict(reply string) (string, bool) {
+	word := strings.ToUpper(strings.TrimLeft(strings.TrimSpace(reply), "*#`\"' "))
+	return reply, strings.HasPrefix(word, "PASS") || strings.HasPrefix(word, "FAIL")
+}
+
+// OutlineDriver writes a long story from an outline, one section at a
+// time. Each section is generated with the earlier sections summarized
+// into the instruction, checked against its outline by a judge pass, and
+// regenerated with the judge's feedback until it passes or MaxAttempts
+// drafts have been tried. The summary is updated after each section, and
+// Checkpoint is called so that an interrupted run can resume.
+//
+// Requests use the conversation's system prompt and settings without its
+// history, and leave the history unchanged; their usage is added to it.
+type OutlineDriver struct {
+	// Conversation generates the sections, judgements and summaries.
+	Conversation *Conversation
+	// Sections is the outline.
+	Sections []OutlineSection
+	// MaxAttempts is how many drafts of a section are tried. If zero,
+	// DefaultSectionAttempts is used.
+	MaxAttempts int
+	// Sampling overrides the settings when writing sections.
+	Sampling SamplingProfile
+	// Progress is the state to resume from. Run updates it.
+	Progress OutlineProgress
+	// Checkpoint, if set, is called with the progress after each section.
+	// A checkpoint error stops the run. See FileCheckpoint.
+	Checkpoint func(p *OutlineProgress) error
+}
+
+// NewOutlineDriver creates a driver writing sections with c.
+func NewOutlineDriver(c *Conversation, sections []OutlineSection) *OutlineDriver {
+	return &OutlineDriver{Conversation: c, Sections: sections}
+}
+
+// Run writes the sections not yet in Progress and returns the progress.
+// On error, the progress up to the last finished section is returned with
+// it.
+func (d *OutlineDriver) Run(ctx context.Context) (*OutlineProgress, error) {
+	if len(d.Progress.Sections) > len(d.Sections) {
+		return &d.Progress, fmt.Errorf("progress has %d sections, outline has %d",
+			len(d.Progress.Sections), len(d.Sections))
+	}
+	for i := len(d.Progress.Sections); i < len(d.Sections); i++ {
+		draft, err := d.writeSection(ctx, d.Sections[i])
+		if err != nil {
+			return &d.Progress, fmt.Errorf("error writing section %d: %w", i+1, err)
+		}
+		summary, err := d.Conversation.sideRequest(ctx,
+			OutlineSummaryInstruction(d.Progress.Summary, draft.Text),
+			SamplingProfile{MaxTokens: Int(MaxOutlineSummaryTokens), Temperature: Float64(0.3)})
+		if err != nil {
+			return &d.Progress, fmt.Errorf("error summarizing section %d: %w", i+1, err)
+		}
+		d.Progress.Sections = append(d.Progress.Sections, *draft)
+		d.Progress.Summary = strings.TrimSpace(summary)
+		if d.Checkpoint != nil {
+			if err := d.Checkpoint(&d.Progress); err != nil {
+				return &d.Progress, fmt.Errorf("error saving checkpoint: %w", err)
+			}
+		}
+	}
+	return &d.Progress, nil
+}
+
+// writeSection drafts and judges a section until a draft passes or the
+// attempts run out, keeping the last draft.
+func (d *OutlineDriver) writeSection(ctx context.Context, s OutlineSection) (*DraftSection, error) {
+	attempts := d.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultSectionAttempts
+	}
+	draft := &DraftSection{OutlineSection: s}
+	for draft.Attempts < attempts {
+		text, err := d.Conversation.sideRequest(ctx,
+			SectionInstruction(d.Progress.Summary, s, draft.Verdict), d.Sampling)
+		if err != nil {
+			return nil, err
+		}
+		draft.Text = strings.TrimSpace(text)
+		draft.Attempts++
+
+		// A judge reply without a verdict is asked again, then counts as failing
+		_, reply, err := d.Conversation.extractAnswer(ctx, JudgeInstruction(s.Outline, draft.Text),
+			SamplingProfile{MaxTokens: Int(MaxJudgeTokens), Temperature: Float64(0)},
+			ExtractorFunc(judgeVerdict), DefaultAnswerAttempts)
+		if err != nil && !errors.Is(err, ErrNoAnswer) {
+			return nil, fmt.Errorf("error judging draft: %w", err)
+		}
+		if draft.Passed, draft.Verdict = ParseJudgement(reply); draft.Passed {
+			break
+		}
+	}
+	return draft, nil
+}
+
+// FileCheckpoint returns a Checkpoint function saving the progress as JSON
+// to path.
+func FileCheckpoint(path string) func(p *OutlineProgress) error {
+	return func(p *OutlineProgress) error {
+		data, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(path, data)
+	}
+}
+
+// ReadOutlineProgress reads progress saved by FileCheckpoint. A missing
+// file yields empty progress, for starting a new run.
+func ReadOutlineProgress(path string) (OutlineProgress, error) {
+	var p OutlineProgress
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("error parsing outline progress: %w", err)
+	}
+	return p, nil
+}
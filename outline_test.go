@@ -0,0 +1,143 @@
+package novelai
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseJudgement(t *testing.T) {
+	tests := []struct {
+		reply  string
+		pass   bool
+		reason string
+	}{
+		{"PASS - covers the storm and the rescue.", true, "covers the storm and the rescue."},
+		{"**FAIL**: the rescue is missing.", false, "the rescue is missing."},
+		{"pass", true, ""},
+		{"I think it is fine.", false, "I think it is fine."},
+	}
+	for _, tt := range tests {
+		pass, reason := ParseJudgement(tt.reply)
+		if pass != tt.pass || reason != tt.reason {
+			t.Errorf("ParseJudgement(%q) = %v, %q, want %v, %q", tt.reply, pass, reason, tt.pass, tt.reason)
+		}
+	}
+}
+
+func TestOutlineDriver(t *testing.T) {
+	conv := NewConversation("You are a novelist.")
+	fake := NewFakeBackend().
+		On(`Does the section below`,
+			FakeResponse{Text: "FAIL: the storm is missing."},
+			FakeResponse{Text: "PASS: all points covered."}).
+		On(`Update the summary`,
+			FakeResponse{Text: "Mara sailed into a storm."},
+			FakeResponse{Text: "Mara sailed into a storm and was rescued."}).
+		On(`Write the next section`,
+			FakeResponse{Text: "Mara set sail."},
+			FakeResponse{Text: "Mara set sail into a storm."},
+			FakeResponse{Text: "A ship rescued her."})
+	fake.Install(conv)
+
+	sections := []OutlineSection{
+		{Title: "Departure", Outline: "Mara sets sail. A storm hits."},
+		{Title: "Rescue", Outline: "Mara is rescued."},
+	}
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "progress.json")
+	d := NewOutlineDriver(conv, sections)
+	d.Checkpoint = FileCheckpoint(checkpoint)
+
+	p, err := d.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Sections) != 2 {
+		t.Fatalf("Expected two sections, got %d", len(p.Sections))
+	}
+	first := p.Sections[0]
+	if first.Text != "Mara set sail into a storm." || first.Attempts != 2 || !first.Passed {
+		t.Errorf("Expected the first section regenerated once, got %+v", first)
+	}
+	if p.Text() != "Mara set sail into a storm.\n\nA ship rescued her." {
+		t.Errorf("Text() = %q", p.Text())
+	}
+	if p.Summary != "Mara sailed into a storm and was rescued." {
+		t.Errorf("Summary = %q", p.Summary)
+	}
+	if len(conv.Messages) != 0 {
+		t.Errorf("Expected the conversation history unchanged, got %d messages", len(conv.Messages))
+	}
+
+	// The regeneration carried the judge's feedback, and the second section
+	// saw the summary of the first
+	var sawFeedback, sawSummary bool
+	for _, req := range fake.Requests() {
+		if strings.Contains(req.Prompt, "Write the next section") {
+			sawFeedback = sawFeedback || strings.Contains(req.Prompt, "rejected: the storm is missing.")
+			sawSummary = sawSummary || strings.Contains(req.Prompt, "Summary of the story so far:\nMara sailed into a storm.")
+		}
+	}
+	if !sawFeedback || !sawSummary {
+		t.Errorf("Expected feedback and summary in section prompts (feedback %v, summary %v)", sawFeedback, sawSummary)
+	}
+
+	// Resuming from the checkpoint has nothing left to do
+	saved, err := ReadOutlineProgress(checkpoint)
+	if err != nil || len(saved.Sections) != 2 {
+		t.Fatalf("ReadOutlineProgress() = %+v, %v", saved, err)
+	}
+	requests := len(fake.Requests())
+	resumed := NewOutlineDriver(conv, sections)
+	resumed.Progress = saved
+	if _, err := resumed.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Requests()) != requests {
+		t.Error("Expected no requests when resuming a finished run")
+	}
+}
+
+func TestOutlineDriverGivesUp(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().
+		On(`Does the section below`, FakeResponse{Text: "FAIL: off topic."}).
+		On(`Update the summary`, FakeResponse{Text: "Summary."}).
+		On(`Write the next section`, FakeResponse{Text: "Draft."})
+	fake.Install(conv)
+
+	d := NewOutlineDriver(conv, []OutlineSection{{Title: "One", Outline: "Something."}})
+	d.MaxAttempts = 2
+	p, err := d.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Sections[0]; s.Passed || s.Attempts != 2 || s.Verdict != "off topic." {
+		t.Errorf("Expected the last failing draft kept after two attempts, got %+v", s)
+	}
+}
+
+func TestOutlineDriverAsksJudgeAgain(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().
+		On(`Does the section below`,
+			FakeResponse{Text: "The section looks fine to me."},
+			FakeResponse{Text: "PASS: covered."}).
+		On(`Update the summary`, FakeResponse{Text: "Summary."}).
+		On(`Write the next section`, FakeResponse{Text: "Draft."})
+	fake.Install(conv)
+
+	d := NewOutlineDriver(conv, []OutlineSection{{Title: "One", Outline: "Something."}})
+	p, err := d.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Sections[0]; !s.Passed || s.Attempts != 1 {
+		t.Errorf("Expected the first draft to pass on the second judgement, got %+v", s)
+	}
+	if n := len(fake.Requests()); n != 4 {
+		t.Errorf("Expected a draft, two judgements and a summary, got %d requests", n)
+	}
+}
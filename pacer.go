@@ -0,0 +1,244 @@
+package novelai
+
+import (
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PaceUnit is the unit a StreamPacer emits at a time.
+type PaceUnit int
+
+const (
+	// PaceCharacter emits one character at a time.
+	PaceCharacter PaceUnit = iota
+	// PaceWord emits one word, with its trailing whitespace, at a time.
+	PaceWord
+)
+
+// Defaults for StreamPacer.
+const (
+	// DefaultCharInterval is the delay between characters.
+	DefaultCharInterval = 15 * time.Millisecond
+	// DefaultWordInterval is the delay between words.
+	DefaultWordInterval = 60 * time.Millisecond
+	// DefaultPaceMaxLag is how far output may fall behind received text
+	// before the pacer speeds up.
+	DefaultPaceMaxLag = 2 * time.Second
+)
+
+// StreamPacer re-paces streamed text into an even cadence for chat UIs, so
+// that display is independent of the chunk sizes the server sends. Text
+// written to the pacer is emitted one unit at a time from a background
+// goroutine. When a burst arrives and the backlog would take longer than
+// MaxLag to show, the interval shrinks so the backlog drains within MaxLag.
+//
+// Set the fields before the first Write; they must not change afterwards.
+type StreamPacer struct {
+	// Unit is the unit emitted at a time.
+	Unit PaceUnit
+	// Interval is the delay between units. If zero, DefaultCharInterval or
+	// DefaultWordInterval is used.
+	Interval time.Duration
+	// MaxLag bounds how far output falls behind. If zero,
+	// DefaultPaceMaxLag is used; if negative, the pacer never speeds up.
+	MaxLag time.Duration
+
+	emit    StreamCallback
+	mu      sync.Mutex
+	pending string
+	closed  bool
+	skip    bool
+	started bool
+	wake    chan struct{}
+	skipped chan struct{}
+	done    chan struct{}
+}
+
+// NewStreamPacer creates a pacer that emits paced text to emit. emit
+// receives done=true once, after all text has been emitted.
+func NewStreamPacer(unit PaceUnit, emit StreamCallback) *StreamPacer {
+	return &StreamPacer{
+		Unit:    unit,
+		emit:    emit,
+		wake:    make(chan struct{}, 1),
+		skipped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Callback returns a StreamCallback that feeds the pacer and closes it when
+// the stream is done. Use it as the callback of SendStreaming.
+func (p *StreamPacer) Callback() StreamCallback {
+	return func(text string, done bool) {
+		p.Write(text)
+		if done {
+			p.Close()
+		}
+	}
+}
+
+// Write queues text for emission. Writes after Close are ignored.
+func (p *StreamPacer) Write(text string) {
+	p.update(func() {
+		if !p.closed {
+			p.pending += text
+		}
+	})
+}
+
+// Close marks the end of the input. Queued text is still emitted.
+func (p *StreamPacer) Close() {
+	p.update(func() { p.closed = true })
+}
+
+// Skip emits all queued text at once and stops pacing for the rest of the
+// stream, for when the user wants to see the whole reply now.
+func (p *StreamPacer) Skip() {
+	p.update(func() {
+		if !p.skip {
+			p.skip = true
+			close(p.skipped)
+		}
+	})
+}
+
+// Wait blocks until the pacer is closed and all text has been emitted.
+func (p *StreamPacer) Wait() {
+	<-p.done
+}
+
+// update applies fn under the lock, starts the emitter if needed and
+// wakes it.
+func (p *StreamPacer) update(fn func()) {
+	p.mu.Lock()
+	fn()
+	if !p.started {
+		p.started = true
+		go p.run()
+	}
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run emits queued units until the pacer is closed and drained. Each unit
+// is emitted one interval after the previous one, or at once if it
+// arrives later than that.
+func (p *StreamPacer) run() {
+	defer close(p.done)
+	var last time.Time
+	for {
+		p.mu.Lock()
+		unit, backlog := p.next()
+		closed, skip := p.closed, p.skip
+		p.mu.Unlock()
+
+		if unit == "" {
+			if closed {
+				p.emit("", true)
+				return
+			}
+			<-p.wake
+			continue
+		}
+		if !skip && !last.IsZero() {
+			if wait := time.Until(last.Add(p.delay(backlog + 1))); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-p.skipped:
+				}
+			}
+		}
+		p.emit(unit, false)
+		last = time.Now()
+	}
+}
+
+// next removes and returns the next unit to emit, and the number of units
+// still queued after it. Incomplete characters and words are held back
+// until more text arrives or the pacer is closed. Must be called with the
+// lock held.
+func (p *StreamPacer) next() (string, int) {
+	if p.pending == "" {
+		return "", 0
+	}
+	if p.skip {
+		unit := p.pending
+		p.pending = ""
+		return unit, 0
+	}
+	var n int
+	if p.Unit == PaceWord {
+		n = wordEnd(p.pending, p.closed)
+	} else if utf8.FullRuneInString(p.pending) || p.closed {
+		_, n = utf8.DecodeRuneInString(p.pending)
+	}
+	unit := p.pending[:n]
+	p.pending = p.pending[n:]
+	return unit, p.countUnits(p.pending)
+}
+
+// delay returns the interval before a unit with backlog units queued,
+// including itself.
+func (p *StreamPacer) delay(backlog int) time.Duration {
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultCharInterval
+		if p.Unit == PaceWord {
+			interval = DefaultWordInterval
+		}
+	}
+	maxLag := p.MaxLag
+	if maxLag == 0 {
+		maxLag = DefaultPaceMaxLag
+	}
+	if maxLag > 0 && backlog > 0 && time.Duration(backlog)*interval > maxLag {
+		return maxLag / time.Duration(backlog)
+	}
+	return interval
+}
+
+// countUnits returns the number of units in text.
+func (p *StreamPacer) countUnits(text string) int {
+	if p.Unit != PaceWord {
+		return utf8.RuneCountInString(text)
+	}
+	n := 0
+	for text != "" {
+		end := wordEnd(text, true)
+		text = text[end:]
+		n++
+	}
+	return n
+}
+
+// wordEnd returns the length of the first word of text with its leading
+// and trailing whitespace, or 0 if the word may not be complete yet. A
+// word is complete once whitespace follows it, or at the end of the input.
+func wordEnd(text string, final bool) int {
+	const (
+		leading = iota
+		word
+		trailing
+	)
+	state := leading
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		switch {
+		case state == leading && !space:
+			state = word
+		case state == word && space:
+			state = trailing
+		case state == trailing && !space:
+			return i
+		}
+	}
+	if state == trailing || final {
+		return len(text)
+	}
+	return 0
+}
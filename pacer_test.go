@@ -0,0 +1,87 @@
+package novelai
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pacedOutput collects what a StreamPacer emits.
+type pacedOutput struct {
+	mu    sync.Mutex
+	units []string
+	dones int
+}
+
+func (o *pacedOutput) emit(text string, done bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if done {
+		o.dones++
+		return
+	}
+	o.units = append(o.units, text)
+}
+
+// TestStreamPacerWords tests word units across chunk boundaries.
+func TestStreamPacerWords(t *testing.T) {
+	out := &pacedOutput{}
+	p := NewStreamPacer(PaceWord, out.emit)
+	p.Interval = time.Millisecond
+	cb := p.Callback()
+	for _, chunk := range []string{"The gu", "lls cr", "y over the ", "harbor."} {
+		cb(chunk, false)
+	}
+	cb("", true)
+	p.Wait()
+
+	want := []string{"The ", "gulls ", "cry ", "over ", "the ", "harbor."}
+	if strings.Join(out.units, "|") != strings.Join(want, "|") || out.dones != 1 {
+		t.Errorf("Expected %q, got %q (%d done)", want, out.units, out.dones)
+	}
+}
+
+// TestStreamPacerCharacters tests character units, including a character
+// split across chunks.
+func TestStreamPacerCharacters(t *testing.T) {
+	out := &pacedOutput{}
+	p := NewStreamPacer(PaceCharacter, out.emit)
+	p.Interval = time.Millisecond
+	p.Write("h\xc3")
+	p.Write("\xa9!")
+	p.Close()
+	p.Write("ignored")
+	p.Wait()
+
+	if strings.Join(out.units, "|") != "h|é|!" {
+		t.Errorf("Unexpected units: %q", out.units)
+	}
+}
+
+// TestStreamPacerCatchUp tests speeding up on a burst and skipping.
+func TestStreamPacerCatchUp(t *testing.T) {
+	out := &pacedOutput{}
+	p := NewStreamPacer(PaceCharacter, out.emit)
+	p.Interval = time.Second
+	p.MaxLag = 50 * time.Millisecond
+	start := time.Now()
+	p.Write(strings.Repeat("x", 20))
+	p.Close()
+	p.Wait()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected backlog drained within MaxLag, took %v", elapsed)
+	}
+
+	out = &pacedOutput{}
+	p = NewStreamPacer(PaceWord, out.emit)
+	p.Interval = time.Hour
+	p.MaxLag = -1
+	p.Write("one two three four ")
+	p.Skip()
+	p.Close()
+	p.Wait()
+	if strings.Join(out.units, "") != "one two three four " {
+		t.Errorf("Expected all text after Skip, got %q", out.units)
+	}
+}
@@ -0,0 +1,104 @@
+package novelai
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Persona describes the user to the model, for character-card style chats.
+type Persona struct {
+	// Name replaces {{user}} in prompts and lore.
+	Name string `json:"name"`
+	// Description tells the model who the user is.
+	Description string `json:"description,omitempty"`
+}
+
+// PersonaPlacement controls where a template writes the user's persona.
+type PersonaPlacement int
+
+const (
+	// PersonaInSystem appends the persona to the system prompt.
+	PersonaInSystem PersonaPlacement = iota
+	// PersonaInMemory writes the persona as a bracketed memory line after
+	// the system prompt, the way story models read character notes.
+	PersonaInMemory
+)
+
+// nameMacro matches the {{user}} and {{char}} macros, in any case, and the
+// legacy <USER> and <BOT> forms used by older character cards.
+var nameMacro = regexp.MustCompile(`(?i)\{\{(user|char)\}\}|<(USER|BOT)>`)
+
+// SubstituteNames replaces {{user}} with user and {{char}} with char in
+// text. Macros whose name is empty are left in place.
+func SubstituteNames(text, user, char string) string {
+	if !strings.Contains(text, "{{") && !strings.Contains(text, "<") {
+		return text
+	}
+	return nameMacro.ReplaceAllStringFunc(text, func(m string) string {
+		name := char
+		if k := strings.ToLower(strings.Trim(m, "{}<>")); k == "user" {
+			name = user
+		}
+		if name == "" {
+			return m
+		}
+		return name
+	})
+}
+
+// String formats the persona as it is written in the system prompt.
+func (p Persona) String() string {
+	desc := strings.TrimSpace(p.Description)
+	if desc == "" {
+		return "The user is " + p.Name + "."
+	}
+	return "The user is " + p.Name + ". " + desc
+}
+
+// MemoryLine formats the persona as a memory line: "[ Name: description ]".
+func (p Persona) MemoryLine() string {
+	desc := strings.TrimSpace(p.Description)
+	if desc == "" {
+		return "[ " + p.Name + " ]"
+	}
+	return "[ " + p.Name + ": " + desc + " ]"
+}
+
+// userName returns the persona's name, or "" if there is no persona.
+func (c *Conversation) userName() string {
+	if c.UserPersona == nil {
+		return ""
+	}
+	return c.UserPersona.Name
+}
+
+// systemPrompt returns the system prompt to render: System with the
+// persona placed according to the template, then any response directives,
+// with macros expanded.
+func (c *Conversation) systemPrompt() string {
+	system := c.System
+	if p := c.UserPersona; p != nil && p.Name != "" {
+		persona, sep := p.String(), "\n\n"
+		if c.promptTemplate().Persona == PersonaInMemory {
+			persona, sep = p.MemoryLine(), "\n"
+		}
+		if system == "" {
+			system = persona
+		} else {
+			system = strings.TrimRight(system, "\n") + sep + persona
+		}
+	}
+	return c.macros().Expand(c.withDirectives(system))
+}
+
+// expandMessages returns messages with macros expanded. The messages
+// themselves are not modified.
+func (c *Conversation) expandMessages(messages []Message) []Message {
+	m := c.macros()
+	result := make([]Message, len(messages))
+	for i, msg := range messages {
+		msg.Content = m.Expand(msg.Content)
+		result[i] = msg
+	}
+	return result
+}
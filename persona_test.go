@@ -0,0 +1,55 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSubstituteNames tests {{user}} and {{char}} replacement.
+func TestSubstituteNames(t *testing.T) {
+	got := SubstituteNames("{{char}} greets {{User}}. <BOT> waves at <USER>.", "Ana", "Rook")
+	if got != "Rook greets Ana. Rook waves at Ana." {
+		t.Errorf("Unexpected substitution: %q", got)
+	}
+	if got := SubstituteNames("{{char}} greets {{user}}.", "", "Rook"); got != "Rook greets {{user}}." {
+		t.Errorf("Expected empty name to leave macro, got %q", got)
+	}
+}
+
+// TestPersonaPrompt tests persona placement and substitution in prompts.
+func TestPersonaPrompt(t *testing.T) {
+	conv := NewConversation("You are {{char}}, talking with {{user}}.")
+	conv.UserPersona = &Persona{Name: "Ana", Description: "A cartographer."}
+	conv.CharName = "Rook"
+	conv.AddMessage("user", "Hello {{char}}.")
+
+	prompt := conv.RenderPrompt()
+	want := "You are Rook, talking with Ana.\n\nThe user is Ana. A cartographer."
+	if !strings.Contains(prompt, want) {
+		t.Errorf("Expected persona in system prompt, got %q", prompt)
+	}
+	if !strings.Contains(prompt, "Hello Rook.") {
+		t.Errorf("Expected substituted message, got %q", prompt)
+	}
+	if conv.Messages[0].Content != "Hello {{char}}." {
+		t.Errorf("Expected history unchanged, got %q", conv.Messages[0].Content)
+	}
+
+	conv.ApplyTemplate(&PromptErato)
+	prompt = conv.RenderPrompt()
+	if !strings.HasPrefix(prompt, "You are Rook, talking with Ana.\n[ Ana: A cartographer. ]\n") {
+		t.Errorf("Expected persona memory line, got %q", prompt)
+	}
+}
+
+// TestContextBuilderNames tests substitution in lorebook entries.
+func TestContextBuilderNames(t *testing.T) {
+	s := &Scenario{}
+	if _, err := s.Lorebook.AddEntry(NewLorebookEntry("Rook", "{{char}} distrusts {{user}}.", "tower")); err != nil {
+		t.Fatal(err)
+	}
+	b := &ContextBuilder{Scenario: s, Macros: &MacroEngine{User: "Ana", Char: "Rook"}}
+	if got := b.Build("They reached the tower."); !strings.Contains(got, "Rook distrusts Ana.") {
+		t.Errorf("Expected substituted lore entry, got %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Perspective is the grammatical person a story is narrated in.
+type Perspective string
+
+// Narrative perspectives.
+const (
+	FirstPerson  Perspective = "first"  // I went
+	SecondPerson Perspective = "second" // you went
+	ThirdPerson  Perspective = "third"  // she went
+)
+
+// verbForms are common verbs following a subject pronoun, in the forms
+// for "I", for "you" and "they", and for "he", "she" and "it". Later rows
+// take precedence where forms collide, so "she's" becomes "I'm".
+var verbForms = [][3]string{
+	{"have", "have", "has"},
+	{"haven't", "haven't", "hasn't"},
+	{"'ve", "'ve", "'s"},
+	{"do", "do", "does"},
+	{"don't", "don't", "doesn't"},
+	{"was", "were", "was"},
+	{"wasn't", "weren't", "wasn't"},
+	{"am", "are", "is"},
+	{"'m", "'re", "'s"},
+}
+
+// verbClass returns the column of verbForms for a subject pronoun.
+func verbClass(p PronounSet) int {
+	switch strings.ToLower(p.Subject) {
+	case "i":
+		return 0
+	case "you", "they", "we":
+		return 1
+	}
+	return 2
+}
+
+// pronounsFor returns the pronouns of perspective p, using third for the
+// third person.
+func pronounsFor(p Perspective, third PronounSet) PronounSet {
+	switch p {
+	case FirstPerson:
+		return PronounsI
+	case SecondPerson:
+		return PronounsYou
+	}
+	return third
+}
+
+// NewPerspectiveRenamer creates a renamer converting narration from one
+// perspective to another by rule: pronouns are replaced, along with the
+// forms of a few common verbs following a subject pronoun ("I am" becomes
+// "she is"), and dialogue in double quotes is left unchanged. third is
+// the pronouns used in the third person.
+//
+// Rules cannot tell the viewpoint character from other people referred to
+// by the same pronouns, nor change other verbs; see PerspectiveConverter
+// for a model-assisted conversion.
+func NewPerspectiveRenamer(from, to Perspective, third PronounSet) *Renamer {
+	src, dst := pronounsFor(from, third), pronounsFor(to, third)
+	oldnew := make([]string, 0, 2*len(verbForms))
+	for _, v := range verbForms {
+		verb, repl := v[verbClass(src)], v[verbClass(dst)]
+		sep := " "
+		if strings.HasPrefix(verb, "'") {
+			sep = ""
+		}
+		oldnew = append(oldnew, src.Subject+sep+verb, dst.Subject+sep+repl)
+	}
+	r := NewRenamer(oldnew...).AddPronouns(src, dst)
+	r.SkipQuotes = true
+	return r
+}
+
+// PerspectiveInstruction builds the instruction to convert the narration
+// of text between perspectives. name, if set, is the viewpoint character,
+// and third their third-person pronouns.
+func PerspectiveInstruction(text string, from, to Perspective, name string, third PronounSet) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Rewrite the text below from %s person to %s person", from, to)
+	switch {
+	case name != "":
+		fmt.Fprintf(&b, " for the viewpoint character, %s (%s/%s)", name, third.Subject, third.Object)
+	case from == ThirdPerson || to == ThirdPerson:
+		fmt.Fprintf(&b, " for the viewpoint character (%s/%s)", third.Subject, third.Object)
+	}
+	b.WriteString(". Change only the pronouns and verb forms that refer to the viewpoint " +
+		"character. Do not change dialogue in quotes, other characters, events or wording. " +
+		"Respond with only the rewritten text.\n\nText:\n" + text)
+	return b.String()
+}
+
+// PerspectiveConverter converts text and history between narrative
+// perspectives, such as from third person to second person for an
+// interactive story. Convert asks the model, falling back to
+// NewPerspectiveRenamer's rules, which Rewrite applies directly.
+//
+// Requests use the conversation's system prompt and settings without its
+// history; their usage is added to it.
+type PerspectiveConverter struct {
+	// Conversation makes the conversion requests. If nil, only the rules
+	// are used.
+	Conversation *Conversation
+	// From and To are the perspectives converted between.
+	From, To Perspective
+	// Name is the viewpoint character's name, given to the model.
+	Name string
+	// Pronouns are the viewpoint character's third-person pronouns. If
+	// unset, PronounsThey is used.
+	Pronouns PronounSet
+}
+
+// NewPerspectiveConverter creates a converter from one perspective to
+// another, making requests with c.
+func NewPerspectiveConverter(c *Conversation, from, to Perspective) *PerspectiveConverter {
+	return &PerspectiveConverter{Conversation: c, From: from, To: to}
+}
+
+// Rewrite implements Rewriter, converting text by rule.
+func (p *PerspectiveConverter) Rewrite(text string) string {
+	return NewPerspectiveRenamer(p.From, p.To, p.pronouns()).Rewrite(text)
+}
+
+// Convert converts text with the model. If there is no conversation or the
+// reply is empty, text is converted by rule instead. If the request fails,
+// the rule-based conversion is returned with the error.
+func (p *PerspectiveConverter) Convert(ctx context.Context, text string) (string, error) {
+	if p.From == p.To || strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+	if p.Conversation == nil {
+		return p.Rewrite(text), nil
+	}
+	reply, err := p.Conversation.sideRequest(ctx,
+		PerspectiveInstruction(text, p.From, p.To, p.Name, p.pronouns()),
+		SamplingProfile{Temperature: Float64(0)})
+	if err != nil {
+		return p.Rewrite(text), fmt.Errorf("error converting perspective: %w", err)
+	}
+	if reply = strings.TrimSpace(reply); reply == "" {
+		return p.Rewrite(text), nil
+	}
+	return reply, nil
+}
+
+// ConvertHistory converts the content of every message in c with Convert.
+// Messages converted before an error keep their new content.
+func (p *PerspectiveConverter) ConvertHistory(ctx context.Context, c *Conversation) error {
+	for i := range c.Messages {
+		text, err := p.Convert(ctx, c.Messages[i].Content)
+		if err != nil {
+			return fmt.Errorf("error converting message %d: %w", i, err)
+		}
+		c.Messages[i].Content = text
+	}
+	return nil
+}
+
+// pronouns returns Pronouns, or PronounsThey if unset.
+func (p *PerspectiveConverter) pronouns() PronounSet {
+	if p.Pronouns.Subject == "" {
+		return PronounsThey
+	}
+	return p.Pronouns
+}
@@ -0,0 +1,104 @@
+package novelai
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPerspectiveRenamer(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to Perspective
+		third    PronounSet
+		in, want string
+	}{
+		{"third to second", ThirdPerson, SecondPerson, PronounsShe,
+			`She opened her pack. "I'm lost," she said, and the map told her nothing she didn't know.`,
+			`You opened your pack. "I'm lost," you said, and the map told you nothing you didn't know.`},
+		{"first to third", FirstPerson, ThirdPerson, PronounsHe,
+			"I am tired, so I sat down. The dog followed me; I was glad it was mine.",
+			"He is tired, so he sat down. The dog followed him; he was glad it was his."},
+		{"second to first", SecondPerson, FirstPerson, PronounsShe,
+			"You're cold. You pull your coat tight and tell yourself you are fine.",
+			"I'm cold. I pull my coat tight and tell myself I am fine."},
+		{"third to first", ThirdPerson, FirstPerson, PronounsShe,
+			"She's late, and she has her reasons. Nobody waits for her.",
+			"I'm late, and I have my reasons. Nobody waits for me."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPerspectiveRenamer(tt.from, tt.to, tt.third).Rewrite(tt.in); got != tt.want {
+				t.Errorf("Rewrite() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerspectiveInstruction(t *testing.T) {
+	got := PerspectiveInstruction("She ran.", ThirdPerson, SecondPerson, "Mara", PronounsShe)
+	for _, want := range []string{"third person to second person", "Mara (she/her)", "Do not change dialogue", "She ran."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Instruction missing %q: %q", want, got)
+		}
+	}
+}
+
+func TestPerspectiveConverter(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().On(`third person to second person`, FakeResponse{Text: " You ran to the docks. \n"})
+	fake.Install(conv)
+	p := NewPerspectiveConverter(conv, ThirdPerson, SecondPerson)
+	p.Name, p.Pronouns = "Mara", PronounsShe
+	ctx := context.Background()
+
+	got, err := p.Convert(ctx, "Mara ran to the docks.")
+	if err != nil || got != "You ran to the docks." {
+		t.Errorf("Convert() = %q, %v", got, err)
+	}
+	if conv.Usage.OutputTokens == 0 || len(conv.Messages) != 0 {
+		t.Errorf("Expected usage without history, got %+v, %d messages", conv.Usage, len(conv.Messages))
+	}
+
+	// Converting to the same perspective makes no request
+	p.To = ThirdPerson
+	if got, _ := p.Convert(ctx, "She ran."); got != "She ran." || len(fake.Requests()) != 1 {
+		t.Errorf("Convert() = %q after %d requests", got, len(fake.Requests()))
+	}
+}
+
+func TestPerspectiveConverterFallback(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().On(`person`, FakeResponse{StatusCode: 400, Body: "bad request"})
+	fake.Install(conv)
+	p := NewPerspectiveConverter(conv, FirstPerson, SecondPerson)
+
+	got, err := p.Convert(context.Background(), "I saw my ship.")
+	if err == nil || got != "You saw your ship." {
+		t.Errorf("Convert() = %q, %v", got, err)
+	}
+
+	p.Conversation = nil
+	if got, err := p.Convert(context.Background(), "I saw my ship."); err != nil || got != "You saw your ship." {
+		t.Errorf("Convert() = %q, %v", got, err)
+	}
+}
+
+func TestPerspectiveConvertHistory(t *testing.T) {
+	conv := NewConversation("Narrate in second person.")
+	conv.AddMessage("user", "I open the door.")
+	conv.AddMessage("assistant", "You were at the door. Behind it, a man waited for you.")
+	p := &PerspectiveConverter{From: SecondPerson, To: ThirdPerson, Pronouns: PronounsHe}
+	if err := p.ConvertHistory(context.Background(), conv); err != nil {
+		t.Fatal(err)
+	}
+	if got := conv.Messages[1].Content; got != "He was at the door. Behind it, a man waited for him." {
+		t.Errorf("Unexpected message: %q", got)
+	}
+	if got := conv.Messages[0].Content; got != "I open the door." {
+		t.Errorf("Unexpected message: %q", got)
+	}
+	if conv.System != "Narrate in second person." {
+		t.Errorf("System prompt changed: %q", conv.System)
+	}
+}
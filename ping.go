@@ -0,0 +1,66 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// pingPath is the endpoint probed by Ping: a small, authenticated account
+// request that generates nothing.
+const pingPath = "/user/subscription"
+
+// PingResult is the outcome of a Ping.
+type PingResult struct {
+	// Reachable reports whether the API responded.
+	Reachable bool
+	// Authorized reports whether the API accepted the token.
+	Authorized bool
+	// StatusCode is the status of the response, or zero if there was none.
+	StatusCode int
+	// Latency is the time from sending the probe to its response.
+	Latency time.Duration
+}
+
+// Ping probes the API with a cheap authenticated request, for health and
+// readiness checks. It is not retried, so Latency is one round trip. The
+// result is always returned; the error is set unless the API is reachable
+// and the token is accepted.
+func (c *Client) Ping(ctx context.Context) (*PingResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r := &PingResult{}
+	ctx, done, err := c.track(ctx)
+	if err != nil {
+		return r, err
+	}
+	defer done()
+	req, err := newRequest(ctx, "GET", c.apiURL()+pingPath, c.ApiToken, "", nil)
+	if err != nil {
+		return r, err
+	}
+	start := time.Now()
+	resp, err := c.httpClient().Do(req)
+	r.Latency = time.Since(start)
+	if err != nil {
+		return r, fmt.Errorf("API unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	r.Reachable, r.StatusCode = true, resp.StatusCode
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		if c.ApiToken == "" {
+			return r, fmt.Errorf("API token not set")
+		}
+		return r, fmt.Errorf("API token rejected (status %d)", resp.StatusCode)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return r, fmt.Errorf("API error (status %d): %s", resp.StatusCode, body)
+	}
+	r.Authorized = true
+	return r, nil
+}
@@ -0,0 +1,65 @@
+package novelai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientPing(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != pingPath || r.Method != "GET" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Write([]byte(`{"tier":3}`))
+		case "Bearer broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("oops"))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	client := NewClient()
+	client.APIURL = server.URL
+	ctx := context.Background()
+
+	client.ApiToken = "good"
+	r, err := client.Ping(ctx)
+	if err != nil || !r.Reachable || !r.Authorized || r.StatusCode != 200 || r.Latency <= 0 {
+		t.Errorf("Ping() = %+v, %v", r, err)
+	}
+
+	client.ApiToken = "bad"
+	r, err = client.Ping(ctx)
+	if err == nil || !strings.Contains(err.Error(), "rejected") || !r.Reachable || r.Authorized {
+		t.Errorf("Ping() = %+v, %v", r, err)
+	}
+
+	client.ApiToken = "broken"
+	r, err = client.Ping(ctx)
+	if err == nil || !strings.Contains(err.Error(), "oops") || r.StatusCode != 500 || r.Authorized {
+		t.Errorf("Ping() = %+v, %v", r, err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 probes without retries, got %d", calls)
+	}
+}
+
+func TestClientPingUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := NewClient()
+	client.ApiToken = "good"
+	client.APIURL = server.URL
+	r, err := client.Ping(context.Background())
+	if err == nil || r.Reachable || r.StatusCode != 0 {
+		t.Errorf("Ping() = %+v, %v", r, err)
+	}
+}
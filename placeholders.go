@@ -0,0 +1,256 @@
+package novelai
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// placeholderKey is the syntax enforced for placeholder keys: a letter or
+// underscore followed by letters, digits or underscores.
+var placeholderKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// placeholderRef matches a ${key} reference in scenario text, or an inline
+// declaration ${key[default]:description}, whose description is optional.
+// The key is captured as written so invalid keys can be reported, then the
+// default and description of an inline declaration.
+var placeholderRef = regexp.MustCompile(`\$\{([^{}\[\]]*)(?:\[([^\]]*)\](?::([^{}]*))?)?\}`)
+
+// ValidPlaceholderKey reports whether key is a valid placeholder key.
+func ValidPlaceholderKey(key string) bool {
+	return placeholderKey.MatchString(key)
+}
+
+// PlaceholderRef is a ${key} reference found in scenario text.
+type PlaceholderRef struct {
+	Key string `json:"key"`
+	// Path locates the text, e.g. "prompt" or "lorebook.entries[2].text".
+	Path string `json:"path"`
+	// Inline is set for an inline declaration, ${key[default]:description},
+	// which declares the key with Default and Description where it is
+	// used.
+	Inline      bool   `json:"inline,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// PlaceholderIssueKind classifies a placeholder problem.
+type PlaceholderIssueKind string
+
+const (
+	// PlaceholderUndeclared is a key referenced in text but not declared.
+	PlaceholderUndeclared PlaceholderIssueKind = "undeclared"
+	// PlaceholderUnused is a key declared but never referenced.
+	PlaceholderUnused PlaceholderIssueKind = "unused"
+	// PlaceholderInvalidKey is a declared or referenced key with invalid syntax.
+	PlaceholderInvalidKey PlaceholderIssueKind = "invalid_key"
+	// PlaceholderDuplicate is a key declared more than once.
+	PlaceholderDuplicate PlaceholderIssueKind = "duplicate"
+)
+
+// PlaceholderIssue is a single problem found by ValidatePlaceholders.
+type PlaceholderIssue struct {
+	Key     string               `json:"key"`
+	Path    string               `json:"path"`
+	Kind    PlaceholderIssueKind `json:"kind"`
+	Message string               `json:"message"`
+}
+
+// String formats the issue for display.
+func (i PlaceholderIssue) String() string {
+	return fmt.Sprintf("%s: %s (%s)", i.Path, i.Message, i.Kind)
+}
+
+// PlaceholderField describes one input of a placeholder form, for frontends
+// that prompt the user for placeholder values before starting a scenario.
+type PlaceholderField struct {
+	Key             string `json:"key"`
+	Description     string `json:"description"`
+	Default         string `json:"default"`
+	LongDescription string `json:"longDescription,omitempty"`
+	// UsedIn lists the paths of the text that references the key.
+	UsedIn []string `json:"usedIn"`
+}
+
+// PlaceholderReferences returns every ${key} reference and inline
+// declaration in the scenario's prompt, context, ephemeral context and
+// lorebook entries, in that order.
+func (s *Scenario) PlaceholderReferences() []PlaceholderRef {
+	var refs []PlaceholderRef
+	scan := func(path, text string) {
+		for _, m := range placeholderRef.FindAllStringSubmatchIndex(text, -1) {
+			ref := PlaceholderRef{Key: text[m[2]:m[3]], Path: path}
+			if m[4] >= 0 {
+				ref.Inline = true
+				ref.Default = text[m[4]:m[5]]
+				if m[6] >= 0 {
+					ref.Description = text[m[6]:m[7]]
+				}
+			}
+			refs = append(refs, ref)
+		}
+	}
+
+	scan("prompt", s.Prompt)
+	for i, entry := range s.Context {
+		scan(fmt.Sprintf("context[%d].text", i), entry.Text)
+	}
+	for i, entry := range s.EphemeralContext {
+		scan(fmt.Sprintf("ephemeralContext[%d].text", i), entry.Text)
+	}
+	for i, entry := range s.Lorebook.Entries {
+		scan(fmt.Sprintf("lorebook.entries[%d].text", i), entry.Text)
+	}
+	return refs
+}
+
+// UndeclaredPlaceholders returns keys referenced in text but neither in
+// Placeholders nor declared inline, in order of first reference.
+func (s *Scenario) UndeclaredPlaceholders() []string {
+	declared := s.declaredPlaceholders()
+	seen := make(map[string]bool)
+	var keys []string
+	for _, ref := range s.PlaceholderReferences() {
+		if !declared[ref.Key] && !seen[ref.Key] {
+			seen[ref.Key] = true
+			keys = append(keys, ref.Key)
+		}
+	}
+	return keys
+}
+
+// UnusedPlaceholders returns declared keys that are never referenced, in
+// declaration order.
+func (s *Scenario) UnusedPlaceholders() []string {
+	referenced := make(map[string]bool)
+	for _, ref := range s.PlaceholderReferences() {
+		referenced[ref.Key] = true
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for _, p := range s.Placeholders {
+		if !referenced[p.Key] && !seen[p.Key] {
+			seen[p.Key] = true
+			keys = append(keys, p.Key)
+		}
+	}
+	return keys
+}
+
+// ValidatePlaceholders checks placeholder declarations against their uses.
+// It reports invalid and duplicate declarations, invalid references,
+// references to undeclared keys, and declarations that are never used.
+// Inline declarations declare their key; declaring a key inline more than
+// once, or also in Placeholders, is not a duplicate. Returns nil if there
+// are no issues.
+func (s *Scenario) ValidatePlaceholders() []PlaceholderIssue {
+	var issues []PlaceholderIssue
+	add := func(key, path string, kind PlaceholderIssueKind, format string, args ...any) {
+		issues = append(issues, PlaceholderIssue{
+			Key:     key,
+			Path:    path,
+			Kind:    kind,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	declared := make(map[string]bool)
+	for i, p := range s.Placeholders {
+		path := fmt.Sprintf("placeholders[%d].key", i)
+		switch {
+		case !ValidPlaceholderKey(p.Key):
+			add(p.Key, path, PlaceholderInvalidKey, "invalid placeholder key %q", p.Key)
+		case declared[p.Key]:
+			add(p.Key, path, PlaceholderDuplicate, "placeholder %s is declared more than once", p.Key)
+		}
+		declared[p.Key] = true
+	}
+
+	refs := s.PlaceholderReferences()
+	for _, ref := range refs {
+		if ref.Inline {
+			declared[ref.Key] = true
+		}
+	}
+	referenced := make(map[string]bool)
+	for _, ref := range refs {
+		referenced[ref.Key] = true
+		switch {
+		case !ValidPlaceholderKey(ref.Key):
+			add(ref.Key, ref.Path, PlaceholderInvalidKey, "invalid placeholder reference ${%s}", ref.Key)
+		case !declared[ref.Key]:
+			add(ref.Key, ref.Path, PlaceholderUndeclared, "placeholder %s is not declared", ref.Key)
+		}
+	}
+
+	for i, p := range s.Placeholders {
+		if !referenced[p.Key] && ValidPlaceholderKey(p.Key) {
+			add(p.Key, fmt.Sprintf("placeholders[%d].key", i), PlaceholderUnused,
+				"placeholder %s is never used", p.Key)
+		}
+	}
+	return issues
+}
+
+// PlaceholderForm returns a form definition with one field per declared
+// placeholder, in declaration order, followed by the keys declared only
+// inline, in order of their first inline declaration. Duplicate
+// declarations are skipped. The result is intended to be marshaled to JSON
+// for a frontend.
+func (s *Scenario) PlaceholderForm() []PlaceholderField {
+	refs := s.PlaceholderReferences()
+	usedIn := make(map[string][]string)
+	for _, ref := range refs {
+		paths := usedIn[ref.Key]
+		if len(paths) == 0 || paths[len(paths)-1] != ref.Path {
+			usedIn[ref.Key] = append(paths, ref.Path)
+		}
+	}
+
+	fields := []PlaceholderField{}
+	seen := make(map[string]bool)
+	for _, p := range s.Placeholders {
+		if seen[p.Key] {
+			continue
+		}
+		seen[p.Key] = true
+		paths := usedIn[p.Key]
+		if paths == nil {
+			paths = []string{}
+		}
+		fields = append(fields, PlaceholderField{
+			Key:             p.Key,
+			Description:     p.Description,
+			Default:         p.DefaultValue,
+			LongDescription: p.LongDescription,
+			UsedIn:          paths,
+		})
+	}
+	for _, ref := range refs {
+		if !ref.Inline || seen[ref.Key] {
+			continue
+		}
+		seen[ref.Key] = true
+		fields = append(fields, PlaceholderField{
+			Key:         ref.Key,
+			Description: ref.Description,
+			Default:     ref.Default,
+			UsedIn:      usedIn[ref.Key],
+		})
+	}
+	return fields
+}
+
+// declaredPlaceholders returns the set of placeholder keys declared in
+// Placeholders or inline.
+func (s *Scenario) declaredPlaceholders() map[string]bool {
+	declared := make(map[string]bool, len(s.Placeholders))
+	for _, p := range s.Placeholders {
+		declared[p.Key] = true
+	}
+	for _, ref := range s.PlaceholderReferences() {
+		if ref.Inline {
+			declared[ref.Key] = true
+		}
+	}
+	return declared
+}
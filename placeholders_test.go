@@ -0,0 +1,157 @@
+package novelai
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// newPlaceholderScenario returns a scenario with one undeclared, one unused
+// and one well-formed placeholder.
+func newPlaceholderScenario() *Scenario {
+	s := NewScenario("Placeholders")
+	s.Prompt = "${name} woke in ${place}."
+	s.Context = []ContextEntry{{Text: "${name} is a sailor. ${name} fears ${bad key}."}}
+	s.Lorebook.Entries = []LorebookEntry{{Text: "${place} is a harbor town."}}
+	s.Placeholders = []Placeholder{
+		{Key: "name", Description: "Your name", DefaultValue: "Ada", LongDescription: "The protagonist."},
+		{Key: "ship", Description: "Ship name", DefaultValue: "Gull"},
+		{Key: "name", Description: "Again"},
+	}
+	return s
+}
+
+// TestValidPlaceholderKey tests the enforced key syntax.
+func TestValidPlaceholderKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"name":     true,
+		"_x1":      true,
+		"Ship_Two": true,
+		"":         false,
+		"1st":      false,
+		"bad key":  false,
+		"a-b":      false,
+	} {
+		if got := ValidPlaceholderKey(key); got != want {
+			t.Errorf("ValidPlaceholderKey(%q): expected %v, got %v", key, want, got)
+		}
+	}
+}
+
+// TestPlaceholderReferences tests reference extraction and set differences.
+func TestPlaceholderReferences(t *testing.T) {
+	s := newPlaceholderScenario()
+
+	refs := s.PlaceholderReferences()
+	if len(refs) != 6 {
+		t.Fatalf("Expected 6 references, got %d: %v", len(refs), refs)
+	}
+	if refs[5].Key != "place" || refs[5].Path != "lorebook.entries[0].text" {
+		t.Errorf("Unexpected last reference: %+v", refs[5])
+	}
+
+	if got := strings.Join(s.UndeclaredPlaceholders(), ","); got != "place,bad key" {
+		t.Errorf("Expected undeclared [place bad key], got %s", got)
+	}
+	if got := strings.Join(s.UnusedPlaceholders(), ","); got != "ship" {
+		t.Errorf("Expected unused [ship], got %s", got)
+	}
+}
+
+// TestValidatePlaceholders tests the issues reported for each problem kind.
+func TestValidatePlaceholders(t *testing.T) {
+	s := newPlaceholderScenario()
+
+	counts := make(map[PlaceholderIssueKind]int)
+	for _, issue := range s.ValidatePlaceholders() {
+		counts[issue.Kind]++
+		if issue.Kind == PlaceholderDuplicate && issue.Path != "placeholders[2].key" {
+			t.Errorf("Expected duplicate at placeholders[2].key, got %s", issue.Path)
+		}
+	}
+	want := map[PlaceholderIssueKind]int{
+		PlaceholderUndeclared: 2, // ${place} in prompt and lorebook
+		PlaceholderUnused:     1,
+		PlaceholderInvalidKey: 1,
+		PlaceholderDuplicate:  1,
+	}
+	for kind, n := range want {
+		if counts[kind] != n {
+			t.Errorf("Expected %d %s issues, got %d", n, kind, counts[kind])
+		}
+	}
+
+	clean := NewScenario("Clean")
+	clean.Prompt = "Hello ${name}"
+	clean.Placeholders = []Placeholder{{Key: "name"}}
+	if issues := clean.ValidatePlaceholders(); issues != nil {
+		t.Errorf("Expected no issues, got %v", issues)
+	}
+}
+
+// TestPlaceholderForm tests the form definition and its JSON encoding.
+func TestPlaceholderForm(t *testing.T) {
+	s := newPlaceholderScenario()
+
+	form := s.PlaceholderForm()
+	if len(form) != 2 {
+		t.Fatalf("Expected 2 fields, got %d", len(form))
+	}
+	name := form[0]
+	if name.Key != "name" || name.Default != "Ada" || name.LongDescription != "The protagonist." {
+		t.Errorf("Unexpected name field: %+v", name)
+	}
+	if strings.Join(name.UsedIn, ",") != "prompt,context[0].text" {
+		t.Errorf("Expected name used in prompt and context[0], got %v", name.UsedIn)
+	}
+
+	data, err := json.Marshal(form[1])
+	if err != nil {
+		t.Fatalf("Failed to marshal field: %v", err)
+	}
+	expected := `{"key":"ship","description":"Ship name","default":"Gull","usedIn":[]}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+// TestInlinePlaceholders tests inline ${key[default]:description}
+// declarations.
+func TestInlinePlaceholders(t *testing.T) {
+	s := NewScenario("Inline")
+	s.Prompt = "Hello ${name[Alice]:Your name}, welcome back, ${name}."
+	s.Lorebook.Entries = []LorebookEntry{{Text: "The ${place[castle]} is old. ${place[keep]}"}}
+
+	refs := s.PlaceholderReferences()
+	if len(refs) != 4 {
+		t.Fatalf("Expected 4 references, got %d: %v", len(refs), refs)
+	}
+	want := PlaceholderRef{Key: "name", Path: "prompt", Inline: true, Default: "Alice", Description: "Your name"}
+	if refs[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, refs[0])
+	}
+	if refs[1].Inline || refs[1].Key != "name" {
+		t.Errorf("Expected a plain reference to name, got %+v", refs[1])
+	}
+	if refs[2].Key != "place" || refs[2].Default != "castle" || refs[2].Description != "" {
+		t.Errorf("Expected place declared without description, got %+v", refs[2])
+	}
+
+	if issues := s.ValidatePlaceholders(); issues != nil {
+		t.Errorf("Expected inline declarations to be valid, got %v", issues)
+	}
+	if undeclared := s.UndeclaredPlaceholders(); undeclared != nil {
+		t.Errorf("Expected no undeclared keys, got %v", undeclared)
+	}
+
+	form := s.PlaceholderForm()
+	if len(form) != 2 || form[0].Key != "name" || form[0].Default != "Alice" || form[0].Description != "Your name" ||
+		form[1].Key != "place" || form[1].Default != "castle" {
+		t.Errorf("Unexpected form: %+v", form)
+	}
+
+	s.Prompt = "${bad key[x]}"
+	if issues := s.ValidatePlaceholders(); len(issues) != 1 || issues[0].Kind != PlaceholderInvalidKey {
+		t.Errorf("Expected an invalid inline key, got %v", issues)
+	}
+}
@@ -0,0 +1,356 @@
+package novelai
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"sort"
+)
+
+// Keys of NovelAI's PNG metadata.
+const (
+	MetaTitle          = "Title"
+	MetaDescription    = "Description"
+	MetaSoftware       = "Software"
+	MetaSource         = "Source"
+	MetaGenerationTime = "Generation time"
+	MetaComment        = "Comment"
+)
+
+// Stealth info signatures, stored in the alpha channel ahead of the data.
+const (
+	stealthCompressed   = "stealth_pngcomp"
+	stealthUncompressed = "stealth_pnginfo"
+)
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ImageMetadata is the generation metadata NovelAI embeds in its images,
+// keyed by the Meta* names. The Comment value holds the generation
+// parameters as JSON; see ImageMetadata.Comment.
+type ImageMetadata map[string]string
+
+// ImageComment is the generation parameters stored in the Comment field.
+type ImageComment struct {
+	Prompt        string  `json:"prompt"`
+	UC            string  `json:"uc,omitempty"`
+	Steps         int     `json:"steps"`
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	Scale         float64 `json:"scale"`
+	Seed          int64   `json:"seed"`
+	Sampler       string  `json:"sampler"`
+	NSamples      int     `json:"n_samples,omitempty"`
+	Strength      float64 `json:"strength,omitempty"`
+	Noise         float64 `json:"noise,omitempty"`
+	NoiseSchedule string  `json:"noise_schedule,omitempty"`
+	CFGRescale    float64 `json:"cfg_rescale,omitempty"`
+	RequestType   string  `json:"request_type,omitempty"`
+}
+
+// Comment decodes the generation parameters in the Comment field.
+func (m ImageMetadata) Comment() (*ImageComment, error) {
+	raw, ok := m[MetaComment]
+	if !ok {
+		return nil, fmt.Errorf("image metadata has no %s", MetaComment)
+	}
+	var c ImageComment
+	if err := json.Unmarshal([]byte(raw), &c); err != nil {
+		return nil, fmt.Errorf("error parsing image comment: %w", err)
+	}
+	return &c, nil
+}
+
+// NewImageMetadata builds metadata describing an image generated by req
+// with seed, in the form NovelAI writes it.
+func NewImageMetadata(req *ImageRequest, seed int64) ImageMetadata {
+	p := req.Parameters
+	comment, _ := json.Marshal(ImageComment{
+		Prompt:        req.Input,
+		UC:            p.NegativePrompt,
+		Steps:         p.Steps,
+		Width:         p.Width,
+		Height:        p.Height,
+		Scale:         p.Scale,
+		Seed:          seed,
+		Sampler:       p.Sampler,
+		NSamples:      p.NSamples,
+		Strength:      p.Strength,
+		Noise:         p.Noise,
+		NoiseSchedule: p.NoiseSchedule,
+		CFGRescale:    p.CFGRescale,
+		RequestType:   req.Action,
+	})
+	return ImageMetadata{
+		MetaTitle:       "NovelAI generated image",
+		MetaDescription: req.Input,
+		MetaSoftware:    "NovelAI",
+		MetaSource:      req.Model,
+		MetaComment:     string(comment),
+	}
+}
+
+// ReadImageMetadata reads NovelAI metadata from a PNG, preferring tEXt
+// chunks and falling back to stealth info in the alpha channel.
+func ReadImageMetadata(data []byte) (ImageMetadata, error) {
+	meta, err := ReadPNGText(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := meta[MetaComment]; ok {
+		return meta, nil
+	}
+	stealth, err := ReadStealthInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if stealth == nil && len(meta) == 0 {
+		return nil, fmt.Errorf("image has no metadata")
+	}
+	for k, v := range stealth {
+		meta[k] = v
+	}
+	return meta, nil
+}
+
+// ReadPNGText returns the tEXt chunks of a PNG.
+func ReadPNGText(data []byte) (ImageMetadata, error) {
+	meta := ImageMetadata{}
+	err := walkPNGChunks(data, func(typ string, body []byte) {
+		if typ != "tEXt" {
+			return
+		}
+		if i := bytes.IndexByte(body, 0); i > 0 {
+			meta[string(body[:i])] = latin1(body[i+1:])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// WritePNGText returns a copy of a PNG with meta stored as tEXt chunks
+// after the header, replacing chunks with the same keys. Values are stored
+// as Latin-1; characters outside it are replaced with '?'.
+func WritePNGText(data []byte, meta ImageMetadata) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	err := walkPNGChunks(data, func(typ string, body []byte) {
+		if typ == "tEXt" {
+			if i := bytes.IndexByte(body, 0); i > 0 {
+				if _, replaced := meta[string(body[:i])]; replaced {
+					return
+				}
+			}
+		}
+		writePNGChunk(&out, typ, body)
+		if typ == "IHDR" {
+			for _, k := range sortedKeys(meta) {
+				writePNGChunk(&out, "tEXt", append(append([]byte(k), 0), toLatin1(meta[k])...))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ReadStealthInfo reads metadata hidden in the least significant bits of
+// a PNG's alpha channel. Returns nil and no error if there is none.
+func ReadStealthInfo(data []byte) (ImageMetadata, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding PNG: %w", err)
+	}
+	bits := newAlphaBits(img)
+
+	sig := string(bits.read(len(stealthCompressed)))
+	if sig != stealthCompressed && sig != stealthUncompressed {
+		return nil, nil
+	}
+	length := bits.read(4)
+	if len(length) < 4 {
+		return nil, fmt.Errorf("stealth info is truncated")
+	}
+	payload := bits.read(int(binary.BigEndian.Uint32(length) / 8))
+	if sig == stealthCompressed {
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing stealth info: %w", err)
+		}
+		if payload, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("error decompressing stealth info: %w", err)
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("error parsing stealth info: %w", err)
+	}
+	meta := ImageMetadata{}
+	for k, raw := range fields {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			meta[k] = s
+		} else {
+			meta[k] = string(raw)
+		}
+	}
+	return meta, nil
+}
+
+// WriteStealthInfo returns a copy of a PNG with meta hidden, gzip
+// compressed, in the least significant bits of the alpha channel. The
+// image is re-encoded as 8-bit RGBA.
+func WriteStealthInfo(data []byte, meta ImageMetadata) ([]byte, error) {
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding PNG: %w", err)
+	}
+	payload, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding stealth info: %w", err)
+	}
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(payload)
+	zw.Close()
+
+	msg := []byte(stealthCompressed)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(compressed.Len()*8))
+	msg = append(msg, compressed.Bytes()...)
+
+	b := src.Bounds()
+	if len(msg)*8 > b.Dx()*b.Dy() {
+		return nil, fmt.Errorf("image too small for %d bytes of stealth info", len(msg))
+	}
+	img := image.NewNRGBA(b)
+	draw.Draw(img, b, src, b.Min, draw.Src)
+
+	i := 0
+	for x := b.Min.X; x < b.Max.X && i < len(msg)*8; x++ {
+		for y := b.Min.Y; y < b.Max.Y && i < len(msg)*8; y++ {
+			bit := msg[i/8] >> (7 - i%8) & 1
+			off := img.PixOffset(x, y) + 3
+			img.Pix[off] = img.Pix[off]&^1 | bit
+			i++
+		}
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, fmt.Errorf("error encoding PNG: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// alphaBits reads alpha channel LSBs column by column, the order stealth
+// info is written in.
+type alphaBits struct {
+	img  image.Image
+	x, y int
+}
+
+func newAlphaBits(img image.Image) *alphaBits {
+	b := img.Bounds()
+	return &alphaBits{img: img, x: b.Min.X, y: b.Min.Y}
+}
+
+// read returns up to n bytes, fewer if the image runs out of pixels.
+func (a *alphaBits) read(n int) []byte {
+	b := a.img.Bounds()
+	remaining := ((b.Max.X-a.x)*b.Dy() - (a.y - b.Min.Y)) / 8
+	out := make([]byte, 0, max(0, min(n, remaining)))
+	for len(out) < n {
+		var v byte
+		for bit := 0; bit < 8; bit++ {
+			if a.x >= b.Max.X {
+				return out
+			}
+			alpha := color.NRGBAModel.Convert(a.img.At(a.x, a.y)).(color.NRGBA).A
+			v = v<<1 | alpha&1
+			if a.y++; a.y >= b.Max.Y {
+				a.y = b.Min.Y
+				a.x++
+			}
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// walkPNGChunks calls fn with the type and body of each chunk of a PNG.
+func walkPNGChunks(data []byte, fn func(typ string, body []byte)) error {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return fmt.Errorf("not a PNG image")
+	}
+	for p := len(pngSignature); p < len(data); {
+		if len(data)-p < 12 {
+			return fmt.Errorf("truncated PNG chunk at offset %d", p)
+		}
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		if n < 0 || n > len(data)-p-12 {
+			return fmt.Errorf("truncated PNG chunk at offset %d", p)
+		}
+		typ := string(data[p+4 : p+8])
+		fn(typ, data[p+8:p+8+n])
+		p += 12 + n
+		if typ == "IEND" {
+			break
+		}
+	}
+	return nil
+}
+
+// writePNGChunk writes a chunk with its length and CRC.
+func writePNGChunk(w *bytes.Buffer, typ string, body []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(body)))
+	w.WriteString(typ)
+	w.Write(body)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(body)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// latin1 decodes ISO-8859-1 text, the encoding of tEXt chunks.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// toLatin1 encodes s as ISO-8859-1, replacing other characters with '?'.
+func toLatin1(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+// sortedKeys returns the keys of meta in a stable order.
+func sortedKeys(meta ImageMetadata) []string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
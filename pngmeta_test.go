@@ -0,0 +1,103 @@
+package novelai
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testImageRequest returns a request to describe in metadata.
+func testImageRequest() *ImageRequest {
+	params := DefaultImageParameters()
+	params.NegativePrompt = "lowres"
+	return NewImageRequest(ImageModelV3, "1girl, café", params)
+}
+
+// TestPNGTextRoundTrip tests writing and reading tEXt metadata.
+func TestPNGTextRoundTrip(t *testing.T) {
+	meta := NewImageMetadata(testImageRequest(), 1234)
+	data, err := WritePNGText(testPNG(t, color.White), meta)
+	if err != nil {
+		t.Fatalf("WritePNGText failed: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Expected valid PNG, got %v", err)
+	}
+
+	got, err := ReadImageMetadata(data)
+	if err != nil {
+		t.Fatalf("ReadImageMetadata failed: %v", err)
+	}
+	if got[MetaDescription] != "1girl, café" || got[MetaSource] != ImageModelV3 {
+		t.Errorf("Unexpected metadata: %v", got)
+	}
+	comment, err := got.Comment()
+	if err != nil {
+		t.Fatalf("Comment failed: %v", err)
+	}
+	if comment.Seed != 1234 || comment.UC != "lowres" || comment.Steps != 28 {
+		t.Errorf("Unexpected comment: %+v", comment)
+	}
+
+	// Rewriting replaces rather than duplicates keys
+	data, err = WritePNGText(data, ImageMetadata{MetaSoftware: "Other"})
+	if err != nil {
+		t.Fatalf("WritePNGText failed: %v", err)
+	}
+	got, _ = ReadPNGText(data)
+	if got[MetaSoftware] != "Other" || got[MetaDescription] != "1girl, café" {
+		t.Errorf("Unexpected metadata after rewrite: %v", got)
+	}
+}
+
+// TestStealthInfoRoundTrip tests hiding metadata in the alpha channel.
+func TestStealthInfoRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	meta := NewImageMetadata(testImageRequest(), 99)
+	data, err := WriteStealthInfo(buf.Bytes(), meta)
+	if err != nil {
+		t.Fatalf("WriteStealthInfo failed: %v", err)
+	}
+	text, _ := ReadPNGText(data)
+	if len(text) != 0 {
+		t.Errorf("Expected no tEXt chunks, got %v", text)
+	}
+
+	got, err := ReadImageMetadata(data)
+	if err != nil {
+		t.Fatalf("ReadImageMetadata failed: %v", err)
+	}
+	if got[MetaDescription] != "1girl, café" {
+		t.Errorf("Unexpected metadata: %v", got)
+	}
+	if comment, err := got.Comment(); err != nil || comment.Seed != 99 {
+		t.Errorf("Unexpected comment: %+v (%v)", comment, err)
+	}
+}
+
+// TestStealthInfoErrors tests images without or with too little room for
+// stealth info.
+func TestStealthInfoErrors(t *testing.T) {
+	plain := testPNG(t, color.White)
+	if meta, err := ReadStealthInfo(plain); err != nil || meta != nil {
+		t.Errorf("Expected no stealth info, got %v (%v)", meta, err)
+	}
+	if _, err := ReadImageMetadata(plain); err == nil {
+		t.Error("Expected error for image without metadata")
+	}
+	if _, err := WriteStealthInfo(plain, ImageMetadata{MetaComment: strings.Repeat("x", 100)}); err == nil {
+		t.Error("Expected error for image too small")
+	}
+	if _, err := ReadPNGText([]byte("GIF89a")); err == nil {
+		t.Error("Expected error for non-PNG data")
+	}
+}
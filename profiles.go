@@ -0,0 +1,208 @@
+package novelai
+
+import (
+	"fmt"
+
+	"github.com/wbrown/llmapi"
+)
+
+// Built-in sampling profile names.
+const (
+	ProfilePrecise  = "precise"
+	ProfileBalanced = "balanced"
+	ProfileCreative = "creative"
+)
+
+// SamplingProfile is a set of generation overrides (samplers, penalties,
+// max tokens and stop sequences), used both for named profiles and for
+// per-call overrides. Nil fields are unset and inherit from the layer
+// below; a set field, including an explicit zero, replaces it. Use Float64
+// and Int to set fields.
+//
+// Precedence, lowest to highest:
+//  1. Conversation.Settings (zero sampler values are omitted from the
+//     request, leaving the server default)
+//  2. The named profile, for SendProfile and SendStreamingProfile
+//  3. Per-call overrides: the SamplingProfile passed to SendWith, or the
+//     non-zero fields of the llmapi.Sampling passed to Send. llmapi.Sampling
+//     cannot express an explicit zero; use SendWith for that.
+type SamplingProfile struct {
+	Temperature       *float64 `json:"temperature,omitempty"`
+	TopP              *float64 `json:"top_p,omitempty"`
+	TopK              *int     `json:"top_k,omitempty"`
+	MinP              *float64 `json:"min_p,omitempty"`
+	FrequencyPenalty  *float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty   *float64 `json:"presence_penalty,omitempty"`
+	RepetitionPenalty *float64 `json:"repetition_penalty,omitempty"`
+	MaxTokens         *int     `json:"max_tokens,omitempty"`
+	// StopSequences replaces Settings.StopSequences if non-nil. An empty,
+	// non-nil slice sends no stop sequences.
+	StopSequences []string `json:"stop_sequences,omitempty"`
+}
+
+// Float64 returns a pointer to v, for setting SamplingProfile fields.
+func Float64(v float64) *float64 { return &v }
+
+// Int returns a pointer to v, for setting SamplingProfile fields.
+func Int(v int) *int { return &v }
+
+// BuiltinProfiles are available on every conversation unless overridden by
+// an entry of the same name in Conversation.Profiles.
+var BuiltinProfiles = map[string]SamplingProfile{
+	ProfilePrecise:  {Temperature: Float64(0.3), TopP: Float64(0.8)},
+	ProfileBalanced: {Temperature: Float64(1.0), TopP: Float64(0.9)},
+	ProfileCreative: {Temperature: Float64(1.3), TopP: Float64(0.98), MinP: Float64(0.05)},
+	ProfileRefine:   {Temperature: Float64(0.5)},
+}
+
+// SamplingOverrides converts llmapi sampling to overrides. Following the
+// llmapi convention, zero fields are treated as unset.
+func SamplingOverrides(s llmapi.Sampling) SamplingProfile {
+	var p SamplingProfile
+	if s.Temperature != 0 {
+		p.Temperature = Float64(s.Temperature)
+	}
+	if s.TopP != 0 {
+		p.TopP = Float64(s.TopP)
+	}
+	if s.TopK != 0 {
+		p.TopK = Int(s.TopK)
+	}
+	return p
+}
+
+// Merge returns p with the set fields of over replacing its own.
+func (p SamplingProfile) Merge(over SamplingProfile) SamplingProfile {
+	if over.Temperature != nil {
+		p.Temperature = over.Temperature
+	}
+	if over.TopP != nil {
+		p.TopP = over.TopP
+	}
+	if over.TopK != nil {
+		p.TopK = over.TopK
+	}
+	if over.MinP != nil {
+		p.MinP = over.MinP
+	}
+	if over.FrequencyPenalty != nil {
+		p.FrequencyPenalty = over.FrequencyPenalty
+	}
+	if over.PresencePenalty != nil {
+		p.PresencePenalty = over.PresencePenalty
+	}
+	if over.RepetitionPenalty != nil {
+		p.RepetitionPenalty = over.RepetitionPenalty
+	}
+	if over.MaxTokens != nil {
+		p.MaxTokens = over.MaxTokens
+	}
+	if over.StopSequences != nil {
+		p.StopSequences = over.StopSequences
+	}
+	return p
+}
+
+// settingsProfile returns the non-zero sampler values of settings as a
+// profile, the base layer for a request.
+func settingsProfile(s *Settings) SamplingProfile {
+	var p SamplingProfile
+	nonZero := func(v float64) *float64 {
+		if v == 0 {
+			return nil
+		}
+		return Float64(v)
+	}
+	p.Temperature = nonZero(s.Temperature)
+	p.TopP = nonZero(s.TopP)
+	if s.TopK != 0 {
+		p.TopK = Int(s.TopK)
+	}
+	p.MinP = nonZero(s.MinP)
+	p.FrequencyPenalty = nonZero(s.FrequencyPenalty)
+	p.PresencePenalty = nonZero(s.PresencePenalty)
+	p.RepetitionPenalty = nonZero(s.RepetitionPenalty)
+	return p
+}
+
+// Profile looks up a sampling profile in c.Profiles, then BuiltinProfiles.
+func (c *Conversation) Profile(name string) (SamplingProfile, bool) {
+	if p, ok := c.Profiles[name]; ok {
+		return p, true
+	}
+	p, ok := BuiltinProfiles[name]
+	return p, ok
+}
+
+// SetProfile adds or replaces a named sampling profile on the conversation.
+func (c *Conversation) SetProfile(name string, p SamplingProfile) {
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]SamplingProfile)
+	}
+	c.Profiles[name] = p
+}
+
+// SendWith is like Send but takes overrides that can set explicit zero
+// values, such as temperature 0 for greedy sampling.
+func (c *Conversation) SendWith(text string, overrides SamplingProfile) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	return c.send(text, &c.Settings, overrides)
+}
+
+// SendStreamingWith is like SendStreaming but takes overrides that can set
+// explicit zero values.
+func (c *Conversation) SendStreamingWith(text string, overrides SamplingProfile, callback llmapi.StreamCallback) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	return c.sendStreaming(text, &c.Settings, overrides, callback)
+}
+
+// SendProfile is like Send but generates with the named sampling profile
+// applied over the conversation's settings for this call only. Non-zero
+// sampling fields still take precedence over the profile.
+func (c *Conversation) SendProfile(profile, text string, sampling llmapi.Sampling) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	p, ok := c.Profile(profile)
+	if !ok {
+		return "", "", 0, 0, 0, 0, fmt.Errorf("unknown sampling profile: %s", profile)
+	}
+	return c.send(text, &c.Settings, p.Merge(SamplingOverrides(sampling)))
+}
+
+// SendStreamingProfile is like SendStreaming but generates with the named
+// sampling profile applied for this call only.
+func (c *Conversation) SendStreamingProfile(profile, text string, sampling llmapi.Sampling, callback llmapi.StreamCallback) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	p, ok := c.Profile(profile)
+	if !ok {
+		return "", "", 0, 0, 0, 0, fmt.Errorf("unknown sampling profile: %s", profile)
+	}
+	return c.sendStreaming(text, &c.Settings, p.Merge(SamplingOverrides(sampling)), callback)
+}
@@ -0,0 +1,204 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// newProfileServer returns a conversation whose requests are recorded.
+// Streaming requests get an SSE reply.
+func newProfileServer(t *testing.T) (*Conversation, *[]completionRequest) {
+	t.Helper()
+	var requests []completionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		requests = append(requests, req)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"text\":\"ok\",\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mockCompletionResponse("ok", "stop", 1, 1))
+	}))
+	t.Cleanup(server.Close)
+
+	conv := NewConversation("system")
+	conv.ApiToken = "test-token"
+	conv.HttpClient = &http.Client{Transport: &redirectTransport{server.URL}}
+	return conv, &requests
+}
+
+// derefFloat returns *v, or -1 if v is nil.
+func derefFloat(v *float64) float64 {
+	if v == nil {
+		return -1
+	}
+	return *v
+}
+
+// TestSamplingProfileMerge tests that only set fields override.
+func TestSamplingProfileMerge(t *testing.T) {
+	base := SamplingProfile{Temperature: Float64(1.0), TopP: Float64(0.9)}
+	got := base.Merge(SamplingProfile{Temperature: Float64(0), MaxTokens: Int(64)})
+	if derefFloat(got.Temperature) != 0 || *got.MaxTokens != 64 {
+		t.Errorf("Expected overrides applied, got %+v", got)
+	}
+	if derefFloat(got.TopP) != 0.9 {
+		t.Errorf("Expected top_p kept, got %v", derefFloat(got.TopP))
+	}
+
+	over := SamplingOverrides(llmapi.Sampling{Temperature: 0.5})
+	if derefFloat(over.Temperature) != 0.5 || over.TopP != nil || over.TopK != nil {
+		t.Errorf("Expected only temperature set, got %+v", over)
+	}
+}
+
+// TestSendProfile tests per-call profiles without changing Settings.
+func TestSendProfile(t *testing.T) {
+	conv, requests := newProfileServer(t)
+	conv.SetProfile("villain", SamplingProfile{Temperature: Float64(1.4), RepetitionPenalty: Float64(1.2)})
+	before := conv.Settings.Temperature
+
+	if _, _, _, _, _, _, err := conv.SendProfile("villain", "Hi", llmapi.Sampling{}); err != nil {
+		t.Fatalf("SendProfile failed: %v", err)
+	}
+	if _, _, _, _, _, _, err := conv.SendProfile(ProfilePrecise, "Hi", llmapi.Sampling{TopP: 0.5}); err != nil {
+		t.Fatalf("SendProfile failed: %v", err)
+	}
+	var streamed strings.Builder
+	_, _, _, _, _, _, err := conv.SendStreamingProfile(ProfileCreative, "Hi", llmapi.Sampling{},
+		func(text string, done bool) { streamed.WriteString(text) })
+	if err != nil {
+		t.Fatalf("SendStreamingProfile failed: %v", err)
+	}
+	if _, _, _, _, _, _, err := conv.Send("Hi", llmapi.Sampling{}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	reqs := *requests
+	if derefFloat(reqs[0].Temperature) != 1.4 || derefFloat(reqs[0].RepetitionPenalty) != 1.2 {
+		t.Errorf("Expected villain profile, got temperature %v penalty %v",
+			derefFloat(reqs[0].Temperature), derefFloat(reqs[0].RepetitionPenalty))
+	}
+	if derefFloat(reqs[1].Temperature) != 0.3 || derefFloat(reqs[1].TopP) != 0.5 {
+		t.Errorf("Expected precise profile with top_p override, got %v %v",
+			derefFloat(reqs[1].Temperature), derefFloat(reqs[1].TopP))
+	}
+	if !reqs[2].Stream || derefFloat(reqs[2].Temperature) != 1.3 {
+		t.Errorf("Expected streaming creative request, got %+v", reqs[2])
+	}
+	if streamed.String() != "ok" {
+		t.Errorf("Expected streamed reply, got %q", streamed.String())
+	}
+	if derefFloat(reqs[3].Temperature) != before || conv.Settings.Temperature != before {
+		t.Errorf("Expected settings unchanged, got %v", derefFloat(reqs[3].Temperature))
+	}
+}
+
+// TestSendProfileUnknown tests that an unknown profile fails before sending.
+func TestSendProfileUnknown(t *testing.T) {
+	conv, requests := newProfileServer(t)
+	if _, _, _, _, _, _, err := conv.SendProfile("missing", "Hi", llmapi.Sampling{}); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+	if len(*requests) != 0 || len(conv.Messages) != 0 {
+		t.Error("Expected nothing sent or recorded")
+	}
+
+	conv.SetProfile(ProfilePrecise, SamplingProfile{Temperature: Float64(0.1)})
+	if p, _ := conv.Profile(ProfilePrecise); derefFloat(p.Temperature) != 0.1 {
+		t.Errorf("Expected conversation profile to override builtin, got %v", derefFloat(p.Temperature))
+	}
+}
+
+// TestSendWithExplicitZero tests that zero overrides are sent while zero
+// settings are omitted.
+func TestSendWithExplicitZero(t *testing.T) {
+	conv, requests := newProfileServer(t)
+	conv.Settings.TopK = 0
+
+	if _, _, _, _, _, _, err := conv.SendWith("Hi", SamplingProfile{Temperature: Float64(0), TopK: Int(0)}); err != nil {
+		t.Fatalf("SendWith failed: %v", err)
+	}
+	_, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{TopP: Float64(0)}, nil)
+	if err != nil {
+		t.Fatalf("SendStreamingWith failed: %v", err)
+	}
+	if _, _, _, _, _, _, err := conv.Send("Hi", llmapi.Sampling{Temperature: 0}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	reqs := *requests
+	if reqs[0].Temperature == nil || *reqs[0].Temperature != 0 || reqs[0].TopK == nil || *reqs[0].TopK != 0 {
+		t.Errorf("Expected explicit zero temperature and top_k, got %v %v", reqs[0].Temperature, reqs[0].TopK)
+	}
+	if reqs[1].TopP == nil || *reqs[1].TopP != 0 {
+		t.Errorf("Expected explicit zero top_p, got %v", reqs[1].TopP)
+	}
+	if derefFloat(reqs[2].Temperature) != conv.Settings.Temperature || reqs[2].TopK != nil {
+		t.Errorf("Expected llmapi zero to inherit settings, got %v %v", derefFloat(reqs[2].Temperature), reqs[2].TopK)
+	}
+}
+
+// TestCompletionRequestZeroJSON tests the wire format of zero overrides.
+func TestCompletionRequestZeroJSON(t *testing.T) {
+	settings := DefaultSettings
+	settings.TopK = 0
+	data, _ := json.Marshal(newCompletionRequest("p", &settings, SamplingProfile{Temperature: Float64(0)}))
+	if !strings.Contains(string(data), `"temperature":0`) {
+		t.Errorf("Expected explicit temperature 0, got %s", data)
+	}
+	if strings.Contains(string(data), `"top_k"`) {
+		t.Errorf("Expected unset top_k omitted, got %s", data)
+	}
+}
+
+// TestSendWithPenaltiesAndStops tests the remaining per-call overrides.
+func TestSendWithPenaltiesAndStops(t *testing.T) {
+	conv, requests := newProfileServer(t)
+	conv.Settings.StopSequences = []string{"<|user|>"}
+
+	_, _, _, _, _, _, err := conv.SendWith("Hi", SamplingProfile{
+		MinP:              Float64(0.1),
+		FrequencyPenalty:  Float64(0.4),
+		PresencePenalty:   Float64(0.2),
+		RepetitionPenalty: Float64(1.1),
+		MaxTokens:         Int(32),
+		StopSequences:     []string{"\n\n"},
+	})
+	if err != nil {
+		t.Fatalf("SendWith failed: %v", err)
+	}
+	if _, _, _, _, _, _, err := conv.SendWith("Hi", SamplingProfile{StopSequences: []string{}}); err != nil {
+		t.Fatalf("SendWith failed: %v", err)
+	}
+	if _, _, _, _, _, _, err := conv.Send("Hi", llmapi.Sampling{}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	reqs := *requests
+	r := reqs[0]
+	if derefFloat(r.MinP) != 0.1 || derefFloat(r.FrequencyPenalty) != 0.4 ||
+		derefFloat(r.PresencePenalty) != 0.2 || derefFloat(r.RepetitionPenalty) != 1.1 {
+		t.Errorf("Unexpected penalties: %+v", r)
+	}
+	if r.MaxTokens != 32 || len(r.Stop) != 1 || r.Stop[0] != "\n\n" {
+		t.Errorf("Expected max tokens 32 and stop [\\n\\n], got %d %q", r.MaxTokens, r.Stop)
+	}
+	if len(reqs[1].Stop) != 0 {
+		t.Errorf("Expected no stop sequences, got %q", reqs[1].Stop)
+	}
+	if reqs[2].MaxTokens != conv.Settings.MaxTokens || len(reqs[2].Stop) != 1 || reqs[2].Stop[0] != "<|user|>" {
+		t.Errorf("Expected settings restored for next call, got %d %q", reqs[2].MaxTokens, reqs[2].Stop)
+	}
+}
@@ -0,0 +1,269 @@
+package novelai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenDecoder is implemented by tokenizers that can turn token IDs back
+// into text. DiffTokens uses it, if available, to show changed text.
+type TokenDecoder interface {
+	Decode(ids []int) (string, error)
+}
+
+// DiffOp is the kind of a TokenDiff chunk.
+type DiffOp int
+
+// Diff operations.
+const (
+	DiffEqual DiffOp = iota
+	DiffDelete
+	DiffInsert
+)
+
+// TokenDiffChunk is a run of tokens that are equal in both renderings,
+// only in the first (deleted), or only in the second (inserted).
+type TokenDiffChunk struct {
+	Op     DiffOp
+	Tokens []int
+	// Text is the decoded tokens, if the tokenizer is a TokenDecoder.
+	Text string
+}
+
+// TokenDiff is a token-level diff between two prompt renderings.
+type TokenDiff []TokenDiffChunk
+
+// DiffTokens tokenizes two renderings of a prompt, such as RenderPrompt
+// before and after a template change, and returns their differences. If
+// tok is nil, text is split into words, whitespace runs and punctuation
+// instead, which still shows formatting changes. The cost grows with the
+// size of the difference, not the prompts.
+func DiffTokens(before, after string, tok Tokenizer) (TokenDiff, error) {
+	if tok == nil {
+		return diffWords(before, after), nil
+	}
+	a, err := tok.Encode(before)
+	if err != nil {
+		return nil, fmt.Errorf("error tokenizing prompt: %w", err)
+	}
+	b, err := tok.Encode(after)
+	if err != nil {
+		return nil, fmt.Errorf("error tokenizing prompt: %w", err)
+	}
+	diff := diffSequences(a, b)
+	if dec, ok := tok.(TokenDecoder); ok {
+		for i := range diff {
+			if diff[i].Text, err = dec.Decode(diff[i].Tokens); err != nil {
+				return nil, fmt.Errorf("error decoding tokens: %w", err)
+			}
+		}
+	}
+	return diff, nil
+}
+
+// Changed reports whether the renderings differ.
+func (d TokenDiff) Changed() bool {
+	for _, c := range d {
+		if c.Op != DiffEqual {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the diff with deletions as [-text-] and insertions as
+// {+text+}. Newlines and tabs inside changes are escaped so whitespace
+// changes are visible. Chunks without text are shown as token IDs.
+func (d TokenDiff) String() string {
+	var b strings.Builder
+	for _, c := range d {
+		text := c.Text
+		if text == "" && len(c.Tokens) > 0 {
+			ids := make([]string, len(c.Tokens))
+			for i, id := range c.Tokens {
+				ids[i] = fmt.Sprintf("#%d", id)
+			}
+			text = strings.Join(ids, " ")
+		}
+		switch c.Op {
+		case DiffEqual:
+			b.WriteString(text)
+		case DiffDelete:
+			b.WriteString("[-" + escapeWhitespace(text) + "-]")
+		case DiffInsert:
+			b.WriteString("{+" + escapeWhitespace(text) + "+}")
+		}
+	}
+	return b.String()
+}
+
+// escapeWhitespace makes newlines, carriage returns and tabs visible.
+func escapeWhitespace(s string) string {
+	return strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+}
+
+// diffWords diffs text split into words, whitespace runs and punctuation,
+// using interned IDs so the sequences can be compared.
+func diffWords(before, after string) TokenDiff {
+	ids := map[string]int{}
+	var words []string
+	intern := func(text string) []int {
+		var seq []int
+		for _, w := range splitWords(text) {
+			id, ok := ids[w]
+			if !ok {
+				id = len(words)
+				ids[w] = id
+				words = append(words, w)
+			}
+			seq = append(seq, id)
+		}
+		return seq
+	}
+	diff := diffSequences(intern(before), intern(after))
+	for i := range diff {
+		var b strings.Builder
+		for _, id := range diff[i].Tokens {
+			b.WriteString(words[id])
+		}
+		diff[i].Text = b.String()
+		diff[i].Tokens = nil
+	}
+	return diff
+}
+
+// splitWords splits text into runs of letters and digits, runs of
+// whitespace, and single other characters.
+func splitWords(text string) []string {
+	var words []string
+	start := 0
+	class := func(r rune) int {
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			return 1
+		case r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 0x7F:
+			return 2
+		}
+		return 0
+	}
+	prev := -1
+	for i, r := range text {
+		c := class(r)
+		if i > start && (c != prev || c == 0) {
+			words = append(words, text[start:i])
+			start = i
+		}
+		prev = c
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// diffSequences returns a shortest edit script from a to b as chunks,
+// using Myers' algorithm on the part between the common prefix and suffix.
+func diffSequences(a, b []int) TokenDiff {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var diff TokenDiff
+	add := func(op DiffOp, tokens ...int) {
+		if n := len(diff); n > 0 && diff[n-1].Op == op {
+			diff[n-1].Tokens = append(diff[n-1].Tokens, tokens...)
+			return
+		}
+		diff = append(diff, TokenDiffChunk{Op: op, Tokens: append([]int(nil), tokens...)})
+	}
+
+	if prefix > 0 {
+		add(DiffEqual, a[:prefix]...)
+	}
+	for _, e := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		add(e.op, e.token)
+	}
+	if suffix > 0 {
+		add(DiffEqual, a[len(a)-suffix:]...)
+	}
+	return diff
+}
+
+// diffEdit is one step of an edit script.
+type diffEdit struct {
+	op    DiffOp
+	token int
+}
+
+// myers returns a shortest edit script turning a into b.
+func myers(a, b []int) []diffEdit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+2)
+	var trace [][]int
+
+search:
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back from the end, recording edits in reverse
+	var edits []diffEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, diffEdit{DiffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, diffEdit{DiffInsert, b[y-1]})
+			} else {
+				edits = append(edits, diffEdit{DiffDelete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
@@ -0,0 +1,97 @@
+package novelai
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// byteCodec is byteTokenizer with decoding.
+type byteCodec struct{}
+
+func (byteCodec) Encode(text string) ([]int, error) { return byteTokenizer(text) }
+
+func (byteCodec) Decode(ids []int) (string, error) {
+	b := make([]byte, len(ids))
+	for i, id := range ids {
+		b[i] = byte(id)
+	}
+	return string(b), nil
+}
+
+// TestDiffTokens tests diffing with a decoding tokenizer.
+func TestDiffTokens(t *testing.T) {
+	diff, err := DiffTokens("<|user|>\nHi<|assistant|>\n", "<|user|>Hi<|assistant|>", byteCodec{})
+	if err != nil {
+		t.Fatalf("DiffTokens failed: %v", err)
+	}
+	if !diff.Changed() {
+		t.Error("Expected a change")
+	}
+	if got := diff.String(); got != `<|user|>[-\n-]Hi<|assistant|>[-\n-]` {
+		t.Errorf("Unexpected diff: %s", got)
+	}
+
+	same, _ := DiffTokens("same", "same", byteCodec{})
+	if same.Changed() || same.String() != "same" {
+		t.Errorf("Expected no change, got %s", same)
+	}
+}
+
+// TestDiffTokensIDs tests that tokenizers without a decoder show IDs.
+func TestDiffTokensIDs(t *testing.T) {
+	diff, err := DiffTokens("ab", "ac", byteTokenizer)
+	if err != nil {
+		t.Fatalf("DiffTokens failed: %v", err)
+	}
+	if got := diff.String(); got != "#97[-#98-]{+#99+}" {
+		t.Errorf("Unexpected diff: %s", got)
+	}
+}
+
+// TestDiffTokensWords tests the fallback word split.
+func TestDiffTokensWords(t *testing.T) {
+	diff, _ := DiffTokens("The fog rolled in.\n", "The mist rolled in. \n", nil)
+	if got := diff.String(); got != `The [-fog-]{+mist+} rolled in.[-\n-]{+ \n+}` {
+		t.Errorf("Unexpected diff: %s", got)
+	}
+}
+
+// TestDiffSequences checks that applying a diff reproduces both inputs.
+func TestDiffSequences(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		a := make([]int, r.Intn(20))
+		b := make([]int, r.Intn(20))
+		for j := range a {
+			a[j] = r.Intn(4)
+		}
+		for j := range b {
+			b[j] = r.Intn(4)
+		}
+		var gotA, gotB []int
+		for _, c := range diffSequences(a, b) {
+			if c.Op != DiffInsert {
+				gotA = append(gotA, c.Tokens...)
+			}
+			if c.Op != DiffDelete {
+				gotB = append(gotB, c.Tokens...)
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("Diff of %v and %v reproduced %v and %v", a, b, gotA, gotB)
+		}
+	}
+}
+
+// TestRenderPrompt tests diffing conversation renderings across templates.
+func TestRenderPrompt(t *testing.T) {
+	conv := NewConversation("Be brief.")
+	conv.AddMessage("user", "Hi")
+	before := conv.RenderPrompt()
+	conv.ApplyTemplate(&PromptGLM47)
+	diff, _ := DiffTokens(before, conv.RenderPrompt(), nil)
+	if !diff.Changed() {
+		t.Error("Expected template change to alter the prompt")
+	}
+}
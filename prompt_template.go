@@ -0,0 +1,187 @@
+package novelai
+
+import (
+	"strings"
+	"sync"
+)
+
+// PromptTemplate describes how a model's prompt is laid out: the
+// turn markers around each message, how thinking is disabled, and the stop
+// sequences that end a turn.
+type PromptTemplate struct {
+	// Name identifies the template.
+	Name string
+	// Prefix starts every prompt.
+	Prefix string
+	// SystemHeader, UserHeader and AssistantHeader open a message of each
+	// role, including any separator before the content.
+	SystemHeader    string
+	UserHeader      string
+	AssistantHeader string
+	// MessageEnd is written after each message's content.
+	MessageEnd string
+	// UserEnd, if set, is written after user messages instead of MessageEnd.
+	UserEnd string
+	// HistoryPrefix is written before the content of past assistant
+	// messages, for models whose template replays an empty reasoning block
+	// for earlier turns.
+	HistoryPrefix string
+	// Think controls how thinking is disabled. Settings.ThinkFormat, if set,
+	// takes precedence.
+	Think ThinkFormat
+	// StopSequences end the assistant's turn.
+	StopSequences []string
+	// SceneBreak, if set, replaces scene break lines (see IsSceneBreak) in
+	// message content.
+	SceneBreak string
+	// Persona controls where Conversation.UserPersona is written.
+	Persona PersonaPlacement
+	// Directives phrase Settings.ResponseLanguage and ResponseStyle for the
+	// model. If nil, DefaultDirectives is used.
+	Directives *Directives
+}
+
+// Predefined prompt templates.
+var (
+	// PromptGLM46 is the GLM-4.6 template: role tokens on their own line,
+	// messages separated by newlines.
+	PromptGLM46 = PromptTemplate{
+		Name:            "glm-4.6",
+		Prefix:          glmPrefix,
+		SystemHeader:    glmSystem + "\n",
+		UserHeader:      glmUser + "\n",
+		AssistantHeader: glmAssistant + "\n",
+		MessageEnd:      "\n",
+		Think:           ThinkFormatGLM46,
+		StopSequences:   []string{glmUser, glmSystem},
+	}
+
+	// PromptGLM47 is the GLM-4.7 template: content follows role tokens
+	// directly with no separators, and past assistant turns replay a closed
+	// think block so history matches what the model was trained on.
+	PromptGLM47 = PromptTemplate{
+		Name:            "glm-4.7",
+		Prefix:          glmPrefix,
+		SystemHeader:    glmSystem,
+		UserHeader:      glmUser,
+		AssistantHeader: glmAssistant,
+		HistoryPrefix:   "</think>",
+		Think:           ThinkFormatGLM47,
+		StopSequences:   []string{glmUser, glmSystem, glmObservation, glmEndOfText},
+	}
+)
+
+// Additional GLM special tokens that end a turn.
+const (
+	glmObservation = "<|observation|>"
+	glmEndOfText   = "<|endoftext|>"
+)
+
+var (
+	templatesMu sync.RWMutex
+	templates   = map[Model]*PromptTemplate{
+		ModelGLM46: &PromptGLM46,
+		ModelGLM47: &PromptGLM47,
+		ModelErato: &PromptErato,
+	}
+)
+
+// RegisterPromptTemplate sets the template used for model, replacing any
+// existing registration. Use it to adopt a new model before this package
+// knows about it.
+func RegisterPromptTemplate(model Model, t *PromptTemplate) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	templates[model] = t
+}
+
+// LookupPromptTemplate returns the template registered for model.
+func LookupPromptTemplate(model Model) (*PromptTemplate, bool) {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	t, ok := templates[model]
+	return t, ok
+}
+
+// Render builds the prompt for system and messages with thinking enabled
+// or disabled by tf, ending with an open assistant turn.
+func (t *PromptTemplate) Render(system string, messages []Message, thinking bool, tf *ThinkFormat) string {
+	var b strings.Builder
+	b.WriteString(t.Prefix)
+
+	if system != "" {
+		t.writeMessage(&b, t.SystemHeader, "", system)
+	}
+
+	for i, msg := range messages {
+		isLastMessage := i == len(messages)-1
+
+		content := msg.Content
+		if t.SceneBreak != "" {
+			content = NormalizeSceneBreaks(content, t.SceneBreak)
+		}
+		switch msg.Role {
+		case "user":
+			// Append user suffix (e.g., /nothink) to last user message if thinking is disabled
+			if isLastMessage && !thinking && tf.UserSuffix != "" {
+				content += tf.UserSuffix
+			}
+			end := t.MessageEnd
+			if t.UserEnd != "" {
+				end = t.UserEnd
+			}
+			b.WriteString(t.UserHeader)
+			b.WriteString(content)
+			b.WriteString(end)
+		case "assistant":
+			t.writeMessage(&b, t.AssistantHeader, t.HistoryPrefix, content)
+		case "system":
+			// Additional system messages mid-conversation
+			t.writeMessage(&b, t.SystemHeader, "", content)
+		}
+	}
+
+	// End with assistant header to prompt for response
+	b.WriteString(t.AssistantHeader)
+
+	// If thinking is disabled, prefill with assistant prefix (e.g., </think> or <think></think>)
+	if !thinking && tf.AssistantPrefix != "" {
+		b.WriteString(tf.AssistantPrefix)
+	}
+	return b.String()
+}
+
+// writeMessage writes one message.
+func (t *PromptTemplate) writeMessage(b *strings.Builder, header, prefix, content string) {
+	b.WriteString(header)
+	b.WriteString(prefix)
+	b.WriteString(content)
+	b.WriteString(t.MessageEnd)
+}
+
+// promptTemplate returns the conversation's template: Settings.Template if
+// set, else the one registered for Settings.Model, else PromptGLM46.
+func (c *Conversation) promptTemplate() *PromptTemplate {
+	if c.Settings.Template != nil {
+		return c.Settings.Template
+	}
+	if t, ok := LookupPromptTemplate(c.Settings.Model); ok {
+		return t
+	}
+	return &PromptGLM46
+}
+
+// ApplyTemplate makes t the conversation's template and resets the think
+// format and stop sequences to the template's.
+func (c *Conversation) ApplyTemplate(t *PromptTemplate) {
+	c.Settings.Template = t
+	tf := t.Think
+	c.Settings.ThinkFormat = &tf
+	c.Settings.StopSequences = append([]string(nil), t.StopSequences...)
+}
+
+// RenderPrompt returns the prompt the next request would send, without the
+// next user message. Compare renderings with DiffTokens.
+func (c *Conversation) RenderPrompt() string {
+	return c.buildPrompt()
+}
@@ -0,0 +1,94 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// testMessages is a short history used by the template tests.
+var testMessages = []Message{
+	{Role: "user", Content: "Hi"},
+	{Role: "assistant", Content: "Hello!"},
+	{Role: "user", Content: "Tell me a story."},
+}
+
+// TestPromptGLM46Render tests the GLM-4.6 layout.
+func TestPromptGLM46Render(t *testing.T) {
+	got := PromptGLM46.Render("Be brief.", testMessages, false, &ThinkFormatGLM46)
+	want := "[gMASK]<sop><|system|>\nBe brief.\n<|user|>\nHi\n<|assistant|>\nHello!\n" +
+		"<|user|>\nTell me a story./nothink\n<|assistant|>\n<think></think>\n"
+	if got != want {
+		t.Errorf("Unexpected prompt:\n got %q\nwant %q", got, want)
+	}
+}
+
+// TestPromptGLM47Render tests the GLM-4.7 layout, with and without thinking.
+func TestPromptGLM47Render(t *testing.T) {
+	got := PromptGLM47.Render("Be brief.", testMessages, false, &PromptGLM47.Think)
+	want := "[gMASK]<sop><|system|>Be brief.<|user|>Hi<|assistant|></think>Hello!" +
+		"<|user|>Tell me a story./nothink<|assistant|></think>"
+	if got != want {
+		t.Errorf("Unexpected prompt:\n got %q\nwant %q", got, want)
+	}
+
+	got = PromptGLM47.Render("", testMessages, true, &PromptGLM47.Think)
+	if strings.Contains(got, "/nothink") || !strings.HasSuffix(got, "Tell me a story.<|assistant|>") {
+		t.Errorf("Expected open assistant turn with thinking enabled, got %q", got)
+	}
+}
+
+// TestConversationTemplateSelection tests that the template follows the
+// model unless one is set explicitly.
+func TestConversationTemplateSelection(t *testing.T) {
+	conv := NewConversation("sys")
+	if conv.promptTemplate() != &PromptGLM46 {
+		t.Errorf("Expected GLM-4.6 template by default, got %s", conv.promptTemplate().Name)
+	}
+	conv.SetModel(string(ModelGLM47))
+	if conv.promptTemplate() != &PromptGLM47 {
+		t.Errorf("Expected GLM-4.7 template for %s, got %s", ModelGLM47, conv.promptTemplate().Name)
+	}
+	conv.Settings.Template = &PromptGLM46
+	if conv.promptTemplate() != &PromptGLM46 {
+		t.Error("Expected explicit template to take precedence")
+	}
+}
+
+// TestUseModelAppliesTemplate tests that UseModel switches the think format
+// and stop sequences along with the template.
+func TestUseModelAppliesTemplate(t *testing.T) {
+	conv := NewConversation("sys")
+	if err := conv.UseModel(ModelGLM47); err != nil {
+		t.Fatalf("UseModel failed: %v", err)
+	}
+	if conv.Settings.Template != &PromptGLM47 || *conv.Settings.ThinkFormat != ThinkFormatGLM47 {
+		t.Errorf("Expected GLM-4.7 template and think format, got %+v", conv.Settings)
+	}
+	if strings.Join(conv.Settings.StopSequences, ",") != strings.Join(PromptGLM47.StopSequences, ",") {
+		t.Errorf("Expected template stop sequences, got %q", conv.Settings.StopSequences)
+	}
+	conv.Settings.StopSequences[0] = "changed"
+	if PromptGLM47.StopSequences[0] == "changed" {
+		t.Error("Expected stop sequences copied from the template")
+	}
+}
+
+// TestRegisterPromptTemplate tests adopting a model unknown to the package.
+func TestRegisterPromptTemplate(t *testing.T) {
+	custom := PromptGLM47
+	custom.Name = "glm-5"
+	RegisterPromptTemplate("glm-5", &custom)
+	defer func() {
+		templatesMu.Lock()
+		delete(templates, "glm-5")
+		templatesMu.Unlock()
+	}()
+
+	conv := NewConversation("sys")
+	if err := conv.UseModel("glm-5"); err != nil {
+		t.Fatalf("Expected registered model accepted, got %v", err)
+	}
+	if conv.promptTemplate().Name != "glm-5" {
+		t.Errorf("Expected registered template, got %s", conv.promptTemplate().Name)
+	}
+}
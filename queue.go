@@ -0,0 +1,193 @@
+package novelai
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority ranks requests waiting in a RequestQueue.
+// Higher priorities are dispatched first; the zero value is PriorityNormal.
+type Priority int
+
+// Predefined request priorities.
+const (
+	// PriorityBackground is for batch work such as offline summarization.
+	PriorityBackground Priority = -1
+	// PriorityNormal is the default priority.
+	PriorityNormal Priority = 0
+	// PriorityInteractive is for live chat turns a user is waiting on.
+	PriorityInteractive Priority = 1
+)
+
+// DefaultAgingInterval is how long a request waits before its effective
+// priority is raised by one level.
+var DefaultAgingInterval = 10 * time.Second
+
+// RequestQueue limits how many generations run concurrently for an account
+// and dispatches waiting requests by priority.
+//
+// NovelAI rejects concurrent generations on the same account ("Concurrent
+// generation" 429 errors), so conversations sharing a token should share a
+// queue. Interactive requests jump ahead of background requests; to prevent
+// starvation, a waiting request gains one priority level per AgingInterval.
+type RequestQueue struct {
+	// MaxConcurrent is the number of requests allowed in flight at once.
+	// Values below 1 are treated as 1.
+	MaxConcurrent int
+	// AgingInterval controls starvation protection. If zero,
+	// DefaultAgingInterval is used. Negative values disable aging.
+	AgingInterval time.Duration
+	// Clock, if set, replaces SystemClock for timing how long requests
+	// wait.
+	Clock Clock
+
+	mu      sync.Mutex
+	active  int
+	seq     uint64
+	waiters []*queueWaiter
+}
+
+// queueWaiter is a request waiting for a slot.
+type queueWaiter struct {
+	priority Priority
+	enqueued time.Time
+	seq      uint64
+	granted  bool
+	ready    chan struct{}
+}
+
+// NewRequestQueue creates a queue allowing maxConcurrent requests in flight.
+func NewRequestQueue(maxConcurrent int) *RequestQueue {
+	return &RequestQueue{MaxConcurrent: maxConcurrent}
+}
+
+// Acquire blocks until a slot is available for a request with the given
+// priority, or until ctx is done. On success the returned release function
+// must be called once the request finishes; calling it more than once is safe.
+func (q *RequestQueue) Acquire(ctx context.Context, priority Priority) (release func(), err error) {
+	q.mu.Lock()
+	if q.active < q.limit() && len(q.waiters) == 0 {
+		q.active++
+		q.mu.Unlock()
+		return q.releaseFunc(), nil
+	}
+
+	w := &queueWaiter{
+		priority: priority,
+		enqueued: clockOr(q.Clock).Now(),
+		seq:      q.seq,
+		ready:    make(chan struct{}),
+	}
+	q.seq++
+	q.waiters = append(q.waiters, w)
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return q.releaseFunc(), nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		if w.granted {
+			// Slot was granted while we were giving up; hand it back.
+			q.mu.Unlock()
+			q.release()
+			return nil, ctx.Err()
+		}
+		q.remove(w)
+		q.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Pending returns the number of requests waiting for a slot.
+func (q *RequestQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiters)
+}
+
+// Active returns the number of requests currently holding a slot.
+func (q *RequestQueue) Active() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.active
+}
+
+// limit returns the effective concurrency limit.
+func (q *RequestQueue) limit() int {
+	if q.MaxConcurrent < 1 {
+		return 1
+	}
+	return q.MaxConcurrent
+}
+
+// agingInterval returns the effective aging interval.
+func (q *RequestQueue) agingInterval() time.Duration {
+	if q.AgingInterval == 0 {
+		return DefaultAgingInterval
+	}
+	return q.AgingInterval
+}
+
+// releaseFunc returns an idempotent release function for one slot.
+func (q *RequestQueue) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(q.release)
+	}
+}
+
+// release frees a slot and dispatches waiting requests.
+func (q *RequestQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	q.dispatch(clockOr(q.Clock).Now())
+}
+
+// dispatch grants slots to the best waiting requests. Caller must hold q.mu.
+func (q *RequestQueue) dispatch(now time.Time) {
+	for q.active < q.limit() && len(q.waiters) > 0 {
+		best := 0
+		for i := 1; i < len(q.waiters); i++ {
+			if q.before(q.waiters[i], q.waiters[best], now) {
+				best = i
+			}
+		}
+		w := q.waiters[best]
+		q.waiters = append(q.waiters[:best], q.waiters[best+1:]...)
+		w.granted = true
+		q.active++
+		close(w.ready)
+	}
+}
+
+// before reports whether a should be dispatched ahead of b.
+// Effective priority wins; ties are broken in FIFO order.
+func (q *RequestQueue) before(a, b *queueWaiter, now time.Time) bool {
+	pa, pb := q.effectivePriority(a, now), q.effectivePriority(b, now)
+	if pa != pb {
+		return pa > pb
+	}
+	return a.seq < b.seq
+}
+
+// effectivePriority returns the waiter's priority after aging.
+func (q *RequestQueue) effectivePriority(w *queueWaiter, now time.Time) Priority {
+	interval := q.agingInterval()
+	if interval < 0 {
+		return w.priority
+	}
+	return w.priority + Priority(now.Sub(w.enqueued)/interval)
+}
+
+// remove deletes a waiter from the queue. Caller must hold q.mu.
+func (q *RequestQueue) remove(w *queueWaiter) {
+	for i, other := range q.waiters {
+		if other == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+// waitForPending polls until the queue has n waiting requests.
+func waitForPending(t *testing.T, q *RequestQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for q.Pending() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d pending requests, have %d", n, q.Pending())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestRequestQueuePriorityOrder tests that interactive requests are
+// dispatched ahead of background requests queued earlier.
+func TestRequestQueuePriorityOrder(t *testing.T) {
+	q := NewRequestQueue(1)
+	q.AgingInterval = -1
+
+	hold, err := q.Acquire(context.Background(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(name string, p Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := q.Acquire(context.Background(), p)
+			if err != nil {
+				t.Errorf("Acquire(%s) failed: %v", name, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			release()
+		}()
+	}
+
+	enqueue("background", PriorityBackground)
+	waitForPending(t, q, 1)
+	enqueue("interactive", PriorityInteractive)
+	waitForPending(t, q, 2)
+
+	hold()
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "interactive" || order[1] != "background" {
+		t.Errorf("Expected [interactive background], got %v", order)
+	}
+}
+
+// TestRequestQueueAging tests that a long-waiting request is promoted
+// past newer higher-priority requests.
+func TestRequestQueueAging(t *testing.T) {
+	q := NewRequestQueue(1)
+	q.AgingInterval = time.Minute
+
+	now := time.Now()
+	old := &queueWaiter{priority: PriorityBackground, enqueued: now.Add(-3 * time.Minute), seq: 0}
+	fresh := &queueWaiter{priority: PriorityInteractive, enqueued: now, seq: 1}
+
+	if !q.before(old, fresh, now) {
+		t.Errorf("Expected aged background request to be dispatched first")
+	}
+
+	q.AgingInterval = -1
+	if q.before(old, fresh, now) {
+		t.Errorf("Expected interactive request first when aging is disabled")
+	}
+}
+
+// TestRequestQueueCancel tests that a cancelled waiter leaves the queue.
+func TestRequestQueueCancel(t *testing.T) {
+	q := NewRequestQueue(1)
+	hold, _ := q.Acquire(context.Background(), PriorityNormal)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := q.Acquire(ctx, PriorityInteractive)
+	if err == nil {
+		t.Fatal("Expected error from cancelled Acquire")
+	}
+	if q.Pending() != 0 {
+		t.Errorf("Expected empty queue after cancellation, got %d pending", q.Pending())
+	}
+
+	hold()
+	hold() // Releasing twice must be safe
+	if q.Active() != 0 {
+		t.Errorf("Expected no active requests, got %d", q.Active())
+	}
+}
+
+// TestSendWithQueue tests that Send acquires and releases a queue slot.
+func TestSendWithQueue(t *testing.T) {
+	q := NewRequestQueue(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q.Active() != 1 {
+			t.Errorf("Expected 1 active request during Send, got %d", q.Active())
+		}
+		resp := mockCompletionResponse("Hi", "stop", 5, 1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	conv := NewConversation("System")
+	conv.ApiToken = "test-token"
+	conv.SetEndpoint(server.URL)
+	conv.Queue = q
+	conv.Priority = PriorityInteractive
+
+	if _, _, _, _, _, _, err := conv.Send("Hello", llmapi.Sampling{}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if q.Active() != 0 {
+		t.Errorf("Expected slot to be released after Send, got %d active", q.Active())
+	}
+}
@@ -0,0 +1,190 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is matched by the QuotaError returned when an end user
+// has used up their quota.
+var ErrQuotaExceeded = errors.New("user quota exceeded")
+
+// QuotaLimits are the limits of one end user. Zero fields are unlimited.
+type QuotaLimits struct {
+	// RequestsPerMinute limits requests to this many at once, refilled
+	// at this many per minute.
+	RequestsPerMinute int
+	// TokensPerDay limits the input and output tokens used to this many
+	// at once, refilled at this many per day. A request is allowed while
+	// any tokens are left, and its usage may take the allowance below
+	// zero; later requests then wait for the deficit to be refilled.
+	TokensPerDay int
+}
+
+// QuotaError reports which limit an end user hit.
+type QuotaError struct {
+	// User is the end user, as passed to WithQuotaUser.
+	User string
+	// Limit names the limit hit: "requests per minute" or "tokens per
+	// day".
+	Limit string
+	// RetryAfter is how long until the user is allowed a request again.
+	RetryAfter time.Duration
+}
+
+// Error implements error.
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("user %s over %s quota, retry after %v", e.User, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// Is reports whether target is ErrQuotaExceeded.
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Quota throttles individual end users of a multi-tenant service, such as
+// the users of a chat bot, with token buckets of requests and tokens. The
+// user a request is for is set on its context with WithQuotaUser. Set it
+// on a SessionManager or Client, or call Allow and Record directly. One
+// Quota may be shared by several of them.
+//
+// Set the fields before first use; they must not change afterwards.
+type Quota struct {
+	// Limits are the limits of every user.
+	Limits QuotaLimits
+	// LimitsFor, if set, returns the limits of a user instead, such as
+	// from the user's plan.
+	LimitsFor func(user string) QuotaLimits
+	// Clock, if set, replaces SystemClock for refilling the buckets.
+	Clock Clock
+
+	mu    sync.Mutex
+	users map[string]*userQuota
+}
+
+// userQuota is the remaining allowance of a user, as of refilled.
+type userQuota struct {
+	requests float64
+	tokens   float64
+	refilled time.Time
+}
+
+// NewQuota creates a quota applying limits to every user.
+func NewQuota(limits QuotaLimits) *Quota {
+	return &Quota{Limits: limits}
+}
+
+// Allow takes one request from the user's allowance. If the user has no
+// requests or tokens left, it returns a QuotaError and takes nothing.
+func (q *Quota) Allow(user string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limits := q.limits(user)
+	u := q.refill(user, limits)
+	if limits.TokensPerDay > 0 && u.tokens <= 0 {
+		return &QuotaError{User: user, Limit: "tokens per day",
+			RetryAfter: refillTime(1-u.tokens, limits.TokensPerDay, 24*time.Hour)}
+	}
+	if limits.RequestsPerMinute > 0 {
+		if u.requests < 1 {
+			return &QuotaError{User: user, Limit: "requests per minute",
+				RetryAfter: refillTime(1-u.requests, limits.RequestsPerMinute, time.Minute)}
+		}
+		u.requests--
+	}
+	return nil
+}
+
+// Record charges tokens used by a request against the user's allowance.
+func (q *Quota) Record(user string, tokens int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limits := q.limits(user)
+	if limits.TokensPerDay <= 0 || tokens <= 0 {
+		return
+	}
+	q.refill(user, limits).tokens -= float64(tokens)
+}
+
+// Remaining returns the requests and tokens the user has left. Unlimited
+// allowances are returned as -1.
+func (q *Quota) Remaining(user string) (requests, tokens int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	limits := q.limits(user)
+	u := q.refill(user, limits)
+	requests, tokens = -1, -1
+	if limits.RequestsPerMinute > 0 {
+		requests = int(u.requests)
+	}
+	if limits.TokensPerDay > 0 {
+		tokens = max(int(u.tokens), 0)
+	}
+	return requests, tokens
+}
+
+// limits returns the limits of user.
+func (q *Quota) limits(user string) QuotaLimits {
+	if q.LimitsFor != nil {
+		return q.LimitsFor(user)
+	}
+	return q.Limits
+}
+
+// refill returns the user's allowance, topped up for the time passed
+// since it was last refilled. Must be called with q.mu held.
+func (q *Quota) refill(user string, limits QuotaLimits) *userQuota {
+	now := clockOr(q.Clock).Now()
+	u, ok := q.users[user]
+	if !ok {
+		if q.users == nil {
+			q.users = make(map[string]*userQuota)
+		}
+		u = &userQuota{
+			requests: float64(limits.RequestsPerMinute),
+			tokens:   float64(limits.TokensPerDay),
+			refilled: now,
+		}
+		q.users[user] = u
+		return u
+	}
+	elapsed := float64(now.Sub(u.refilled))
+	u.requests = min(u.requests+elapsed/float64(time.Minute)*float64(limits.RequestsPerMinute),
+		float64(limits.RequestsPerMinute))
+	u.tokens = min(u.tokens+elapsed/float64(24*time.Hour)*float64(limits.TokensPerDay),
+		float64(limits.TokensPerDay))
+	u.refilled = now
+	return u
+}
+
+// refillTime returns how long a bucket refilled at rate per period takes
+// to gain amount.
+func refillTime(amount float64, rate int, period time.Duration) time.Duration {
+	return time.Duration(amount / float64(rate) * float64(period))
+}
+
+// quotaUserKey is the context key of the end user a request is for.
+type quotaUserKey struct{}
+
+// WithQuotaUser returns a context for requests made on behalf of user,
+// whose Quota they are charged to.
+func WithQuotaUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, quotaUserKey{}, user)
+}
+
+// QuotaUser returns the end user set on ctx by WithQuotaUser.
+func QuotaUser(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(quotaUserKey{}).(string)
+	return user, ok
+}
+
+// quotaUser returns the end user of a request if the client has a Quota.
+func (c *Client) quotaUser(ctx context.Context) (string, bool) {
+	if c.Quota == nil || ctx == nil {
+		return "", false
+	}
+	return QuotaUser(ctx)
+}
@@ -0,0 +1,140 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+func TestQuotaRequestsPerMinute(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	q := &Quota{Limits: QuotaLimits{RequestsPerMinute: 2}, Clock: clock}
+	for i := 0; i < 2; i++ {
+		if err := q.Allow("alice"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	err := q.Allow("alice")
+	var qe *QuotaError
+	if !errors.Is(err, ErrQuotaExceeded) || !errors.As(err, &qe) ||
+		qe.Limit != "requests per minute" || qe.RetryAfter != 30*time.Second {
+		t.Errorf("third request = %v", err)
+	}
+	if err := q.Allow("bob"); err != nil {
+		t.Errorf("other users affected: %v", err)
+	}
+	if requests, tokens := q.Remaining("alice"); requests != 0 || tokens != -1 {
+		t.Errorf("Remaining() = %d, %d", requests, tokens)
+	}
+
+	clock.Advance(30 * time.Second)
+	if err := q.Allow("alice"); err != nil {
+		t.Errorf("after refill: %v", err)
+	}
+}
+
+func TestQuotaTokensPerDay(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	q := &Quota{
+		LimitsFor: func(user string) QuotaLimits {
+			if user == "premium" {
+				return QuotaLimits{}
+			}
+			return QuotaLimits{TokensPerDay: 1000}
+		},
+		Clock: clock,
+	}
+	if err := q.Allow("alice"); err != nil {
+		t.Fatal(err)
+	}
+	// Usage may overdraw the allowance
+	q.Record("alice", 1500)
+	if err := q.Allow("alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected the quota exceeded, got %v", err)
+	}
+	if _, tokens := q.Remaining("alice"); tokens != 0 {
+		t.Errorf("Remaining tokens = %d", tokens)
+	}
+	// The deficit is refilled first
+	clock.Advance(9 * time.Hour)
+	if err := q.Allow("alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected the quota still exceeded, got %v", err)
+	}
+	clock.Advance(9 * time.Hour)
+	if err := q.Allow("alice"); err != nil {
+		t.Errorf("after refill: %v", err)
+	}
+
+	q.Record("premium", 1e6)
+	if err := q.Allow("premium"); err != nil {
+		t.Errorf("unlimited user: %v", err)
+	}
+}
+
+func TestSessionManagerQuota(t *testing.T) {
+	q := NewQuota(QuotaLimits{TokensPerDay: 20})
+	m := &SessionManager{
+		New: func(id string) *Conversation {
+			conv := NewConversation("")
+			NewFakeBackend().On("", FakeResponse{Text: "Hi."}).Install(conv)
+			return conv
+		},
+		Quota: q,
+	}
+	send := func(ctx context.Context, id string) error {
+		return m.Do(ctx, id, func(conv *Conversation) error {
+			_, _, _, _, _, _, err := conv.Send("Hello", llmapi.Sampling{})
+			return err
+		})
+	}
+
+	// The session ID is the user unless the context names one
+	if err := send(context.Background(), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, tokens := q.Remaining("alice"); tokens >= 20 {
+		t.Errorf("Expected the reply's tokens charged, %d left", tokens)
+	}
+	ctx := WithQuotaUser(context.Background(), "bob")
+	for err := error(nil); err == nil; err = send(ctx, "channel") {
+	}
+	if err := send(ctx, "other-channel"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected bob over quota in every session, got %v", err)
+	}
+	if err := send(context.Background(), "channel"); err != nil {
+		t.Errorf("Expected the session usable by others, got %v", err)
+	}
+}
+
+func TestClientQuota(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(map[string]string{"output": " text"})
+	}))
+	defer server.Close()
+	client := &Client{ApiToken: "token", TextURL: server.URL, Quota: NewQuota(QuotaLimits{TokensPerDay: 100})}
+	req := &GenerateRequest{Input: "Once", Model: ModelKayra, Parameters: GenerateParameters{MaxLength: 60}}
+
+	ctx := WithQuotaUser(context.Background(), "alice")
+	for i := 0; i < 2; i++ {
+		if _, err := client.Generate(ctx, req); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if _, err := client.Generate(ctx, req); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected the quota exceeded, got %v", err)
+	}
+	if _, err := client.Generate(context.Background(), req); err != nil {
+		t.Errorf("Expected requests without a user unlimited, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 requests sent, got %d", calls)
+	}
+}
@@ -0,0 +1,141 @@
+package novelai
+
+import (
+	"io"
+	"regexp"
+)
+
+// RedactionRule replaces the matches of Pattern with Replacement, which may
+// refer to submatches as in regexp.Regexp.ReplaceAllString.
+type RedactionRule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Built-in redaction rules.
+var (
+	// RedactEmails replaces email addresses.
+	RedactEmails = RedactionRule{
+		Name:        "email",
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[email]",
+	}
+	// RedactPhoneNumbers replaces phone numbers written with separators or
+	// an international prefix, such as "+1 555-123-4567" or "(020) 7946
+	// 0958". Bare digit runs are left alone, as they are more often not
+	// phone numbers.
+	RedactPhoneNumbers = RedactionRule{
+		Name: "phone",
+		Pattern: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)\s?|\b\d{2,4}[\s.-])` +
+			`\d{3,4}[\s.-]\d{3,4}\b`),
+		Replacement: "[phone]",
+	}
+	// RedactAPITokens replaces API tokens and credentials: NovelAI
+	// persistent tokens, bearer tokens, JWTs and "sk-" style keys.
+	RedactAPITokens = RedactionRule{
+		Name: "token",
+		Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{16,}=*` +
+			`|\bpst-[A-Za-z0-9]{16,}` +
+			`|\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}` +
+			`|\bsk-[A-Za-z0-9_-]{16,}`),
+		Replacement: "[token]",
+	}
+)
+
+// Redactor removes personal data and secrets from text the package keeps
+// outside the conversation: stored sessions and jobs, and logs. It never
+// changes what is sent to the API.
+//
+// A nil Redactor leaves text unchanged.
+type Redactor struct {
+	Rules []RedactionRule
+}
+
+// DefaultRedactor redacts emails, phone numbers and API tokens.
+var DefaultRedactor = &Redactor{Rules: []RedactionRule{RedactAPITokens, RedactEmails, RedactPhoneNumbers}}
+
+// NewRedactor creates a redactor applying rules in order.
+func NewRedactor(rules ...RedactionRule) *Redactor {
+	return &Redactor{Rules: rules}
+}
+
+// Redact returns text with the matches of each rule replaced.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.Rules {
+		text = rule.Pattern.ReplaceAllString(text, rule.Replacement)
+	}
+	return text
+}
+
+// RedactMessages returns a copy of msgs with their content redacted.
+func (r *Redactor) RedactMessages(msgs []Message) []Message {
+	msgs = copyMessages(msgs)
+	for i := range msgs {
+		msgs[i].Content = r.Redact(msgs[i].Content)
+	}
+	return msgs
+}
+
+// RedactSnapshot returns a copy of s with the system prompt, messages and
+// metadata values redacted.
+func (r *Redactor) RedactSnapshot(s *Snapshot) *Snapshot {
+	if r == nil || s == nil {
+		return s
+	}
+	out := *s
+	out.System = r.Redact(s.System)
+	out.Messages = r.RedactMessages(s.Messages)
+	if s.Meta != nil {
+		out.Meta = make(map[string]string, len(s.Meta))
+		for k, v := range s.Meta {
+			out.Meta[k] = r.Redact(v)
+		}
+	}
+	return &out
+}
+
+// RedactJob returns a copy of a finished job with its request and result
+// redacted. Jobs that are still to run are returned as they are, as their
+// request is yet to be sent.
+func (r *Redactor) RedactJob(rec *JobRecord) *JobRecord {
+	if r == nil || rec == nil || rec.Status != JobDone && rec.Status != JobFailed {
+		return rec
+	}
+	out := *rec
+	out.Request.System = r.Redact(rec.Request.System)
+	out.Request.Messages = r.RedactMessages(rec.Request.Messages)
+	out.Request.Text = r.Redact(rec.Request.Text)
+	if rec.Result != nil {
+		result := *rec.Result
+		result.Reply = r.Redact(result.Reply)
+		result.Error = r.Redact(result.Error)
+		out.Result = &result
+	}
+	return &out
+}
+
+// Writer returns a writer redacting each write before passing it to w,
+// for logs such as LogConnections. Each write should hold whole lines, so
+// that no match is split between writes.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return redactWriter{r: r, w: w}
+}
+
+// redactWriter is the writer returned by Redactor.Writer.
+type redactWriter struct {
+	r *Redactor
+	w io.Writer
+}
+
+// Write implements io.Writer. It reports all of p as written when the
+// redacted text is.
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
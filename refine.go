@@ -0,0 +1,71 @@
+package novelai
+
+import "fmt"
+
+// ProfileRefine is the sampling profile used for the refinement pass of
+// SendRefined. Override it with SetProfile.
+const ProfileRefine = "refine"
+
+// DefaultRefineInstruction is used by SendRefined when no instruction is
+// given.
+const DefaultRefineInstruction = "Revise your previous reply to improve it: fix any " +
+	"mistakes, tighten the wording and keep what works. Respond with only the revised reply."
+
+// RefinedReply is the result of SendRefined.
+type RefinedReply struct {
+	// Draft is the first-pass reply.
+	Draft string
+	// Final is the refined reply, stored in the history.
+	Final string
+	// StopReason is the refinement pass's normalized stop reason.
+	StopReason string
+	// InputTokens and OutputTokens are totals for both passes.
+	InputTokens  int
+	OutputTokens int
+}
+
+// SendRefined sends a user message, generates a draft reply, then asks the
+// model to revise it with refineInstruction (DefaultRefineInstruction if
+// empty) using the ProfileRefine sampling profile, which defaults to a
+// lower temperature. Only the final reply is kept in the history, as the
+// answer to text; the draft and the instruction are dropped.
+//
+// If the refinement pass fails, the draft is kept as the reply and
+// returned with the error.
+func (c *Conversation) SendRefined(text, refineInstruction string) (*RefinedReply, error) {
+	if refineInstruction == "" {
+		refineInstruction = DefaultRefineInstruction
+	}
+	// Classify only the reply that is kept
+	cl := c.Classifier
+	c.Classifier = nil
+	defer func() { c.Classifier = cl }()
+
+	var r RefinedReply
+	draft, stopReason, inToks, outToks, _, _, err := c.send(text, &c.Settings, SamplingProfile{})
+	if err != nil {
+		return nil, err
+	}
+	r.Draft, r.StopReason = draft, stopReason
+	r.InputTokens, r.OutputTokens = inToks, outToks
+	draftIndex := len(c.Messages) - 1
+
+	profile, _ := c.Profile(ProfileRefine)
+	final, stopReason, inToks, outToks, _, _, err := c.send(refineInstruction, &c.Settings, profile)
+	r.InputTokens += inToks
+	r.OutputTokens += outToks
+	if err != nil {
+		r.Final = draft
+		err = fmt.Errorf("error refining reply: %w", err)
+	} else {
+		// Replace the draft with the final reply
+		c.dropMessageMeta(draftIndex)
+		c.Messages[draftIndex] = c.Messages[len(c.Messages)-1]
+		r.Final, r.StopReason = final, stopReason
+	}
+	c.dropMessageMeta(draftIndex + 1)
+	c.Messages = c.Messages[:draftIndex+1]
+	c.Classifier = cl
+	c.classifyReply(draftIndex)
+	return &r, err
+}
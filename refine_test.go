@@ -0,0 +1,52 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSendRefined tests the draft and refinement passes and the stored
+// history.
+func TestSendRefined(t *testing.T) {
+	conv := NewConversation("You are a poet.")
+	fake := NewFakeBackend().
+		On(`Tighten it`, FakeResponse{Text: "Waves at dusk.", PromptTokens: 20, CompletionTokens: 4}).
+		On(`Write a line`, FakeResponse{Text: "The waves, they go, at dusk, they go.", PromptTokens: 10, CompletionTokens: 9})
+	fake.Install(conv)
+
+	r, err := conv.SendRefined("Write a line about the sea.", "Tighten it.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Draft != "The waves, they go, at dusk, they go." || r.Final != "Waves at dusk." {
+		t.Errorf("Unexpected replies: %+v", r)
+	}
+	if r.InputTokens != 30 || r.OutputTokens != 13 || r.StopReason != "end_turn" {
+		t.Errorf("Unexpected totals: %+v", r)
+	}
+	if len(conv.Messages) != 2 || conv.Messages[1].Content != "Waves at dusk." {
+		t.Errorf("Expected only the final reply in history, got %+v", conv.Messages)
+	}
+
+	reqs := fake.Requests()
+	if len(reqs) != 2 || !strings.Contains(reqs[1].Prompt, "The waves, they go") {
+		t.Errorf("Expected refinement to see the draft, got %d requests", len(reqs))
+	}
+}
+
+// TestSendRefinedFailure tests keeping the draft when refinement fails.
+func TestSendRefinedFailure(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().
+		On(`Revise your previous reply`, FakeResponse{StatusCode: 500, Body: "overloaded"}).
+		On(`Hello`, FakeResponse{Text: "Hi."})
+	fake.Install(conv)
+
+	r, err := conv.SendRefined("Hello", "")
+	if err == nil {
+		t.Fatal("Expected refinement error")
+	}
+	if r == nil || r.Final != "Hi." || len(conv.Messages) != 2 || conv.Messages[1].Content != "Hi." {
+		t.Errorf("Expected draft kept, got %+v, %+v", r, conv.Messages)
+	}
+}
@@ -0,0 +1,325 @@
+package novelai
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rewriter transforms text, such as a Renamer renaming a character.
+type Rewriter interface {
+	Rewrite(text string) string
+}
+
+// RewriterFunc adapts a function to the Rewriter interface.
+type RewriterFunc func(text string) string
+
+// Rewrite calls f(text).
+func (f RewriterFunc) Rewrite(text string) string {
+	return f(text)
+}
+
+// PronounSet is the forms of a personal pronoun.
+type PronounSet struct {
+	Subject    string // she
+	Object     string // her
+	Determiner string // her (book)
+	Possessive string // hers
+	Reflexive  string // herself
+}
+
+// Common pronoun sets.
+var (
+	PronounsHe   = PronounSet{"he", "him", "his", "his", "himself"}
+	PronounsShe  = PronounSet{"she", "her", "her", "hers", "herself"}
+	PronounsThey = PronounSet{"they", "them", "their", "theirs", "themselves"}
+	PronounsIt   = PronounSet{"it", "it", "its", "its", "itself"}
+	PronounsI    = PronounSet{"I", "me", "my", "mine", "myself"}
+	PronounsYou  = PronounSet{"you", "you", "your", "yours", "yourself"}
+)
+
+// renameRule replaces one word. If alt is set, it replaces the word when
+// it is not followed by another word, for forms like "her" that are both
+// a determiner and a pronoun, or "you" that is both subject and object.
+type renameRule struct {
+	new, alt string
+}
+
+// Renamer replaces whole words, such as character names and pronouns,
+// all at once, so that names can be swapped. Words match regardless of
+// case, and each replacement follows the case of the text it replaces:
+// "ALICE" becomes "MARA", "Alice" becomes "Mara" and "alice" becomes
+// "mara".
+type Renamer struct {
+	// SkipQuotes leaves text in double quotes unchanged, such as dialogue
+	// when changing the perspective of the narration.
+	SkipQuotes bool
+
+	rules   map[string]renameRule
+	pattern *regexp.Regexp
+}
+
+// NewRenamer creates a renamer replacing each old word with the new one
+// that follows it, as in strings.NewReplacer. Panics if given an odd
+// number of arguments.
+func NewRenamer(oldnew ...string) *Renamer {
+	if len(oldnew)%2 == 1 {
+		panic("novelai: NewRenamer: odd argument count")
+	}
+	r := &Renamer{rules: make(map[string]renameRule)}
+	for i := 0; i < len(oldnew); i += 2 {
+		r.rules[strings.ToLower(oldnew[i])] = renameRule{new: oldnew[i+1]}
+	}
+	r.compile()
+	return r
+}
+
+// AddPronouns makes the renamer replace the forms of from with those of
+// to, e.g. when changing a character's gender. Forms shared by two roles,
+// like "her", "his" and "you", are told apart by whether a word follows:
+// "her book" becomes "his book" while "saw her" becomes "saw him". Verbs
+// are not changed, so "she is" becomes "they is". Returns r.
+func (r *Renamer) AddPronouns(from, to PronounSet) *Renamer {
+	// Earlier forms take precedence when a word follows; a later form
+	// sharing the word applies otherwise
+	forms := [][2]string{
+		{from.Determiner, to.Determiner},
+		{from.Subject, to.Subject},
+		{from.Object, to.Object},
+		{from.Possessive, to.Possessive},
+		{from.Reflexive, to.Reflexive},
+	}
+	added := make(map[string]bool)
+	for _, f := range forms {
+		key := strings.ToLower(f[0])
+		if rule := r.rules[key]; added[key] {
+			if rule.alt == "" && rule.new != f[1] {
+				rule.alt = f[1]
+				r.rules[key] = rule
+			}
+			continue
+		}
+		added[key] = true
+		r.rules[key] = renameRule{new: f[1]}
+	}
+	r.compile()
+	return r
+}
+
+// Rewrite returns text with the words replaced.
+func (r *Renamer) Rewrite(text string) string {
+	if r.pattern == nil {
+		return text
+	}
+	var quoted [][2]int
+	if r.SkipQuotes {
+		quoted = quotedRanges(text)
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range r.pattern.FindAllStringIndex(text, -1) {
+		start, end := m[0], m[1]
+		if !wordBoundary(text, start, end) || inRanges(quoted, start) {
+			continue
+		}
+		word := text[start:end]
+		rule := r.rules[strings.ToLower(word)]
+		replacement := rule.new
+		if rule.alt != "" && !followedByWord(text[end:]) {
+			replacement = rule.alt
+		}
+		// "I" is capitalized anywhere, so its case says nothing
+		if startsWithI(word) && !sentenceStart(text[:start]) {
+			word = "i" + word[1:]
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(matchCase(word, replacement))
+		last = end
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// compile builds the pattern matching any of the words, longest first.
+func (r *Renamer) compile() {
+	words := make([]string, 0, len(r.rules))
+	for w := range r.rules {
+		if w != "" {
+			words = append(words, regexp.QuoteMeta(w))
+		}
+	}
+	if len(words) == 0 {
+		r.pattern = nil
+		return
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	r.pattern = regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// wordBoundary reports whether text[start:end] is a whole word.
+func wordBoundary(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordRune(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(after) {
+		return false
+	}
+	return true
+}
+
+// quotedRanges returns the byte ranges of the double-quoted passages in
+// text, straight or curly. An unclosed quote runs to the end of its
+// paragraph.
+func quotedRanges(text string) [][2]int {
+	var ranges [][2]int
+	open := -1
+	for i, r := range text {
+		switch {
+		case open < 0 && (r == '"' || r == '“'):
+			open = i
+		case open >= 0 && (r == '"' || r == '”'):
+			ranges = append(ranges, [2]int{open, i})
+			open = -1
+		case open >= 0 && r == '\n' && strings.HasPrefix(text[i+1:], "\n"):
+			ranges = append(ranges, [2]int{open, i})
+			open = -1
+		}
+	}
+	if open >= 0 {
+		ranges = append(ranges, [2]int{open, len(text)})
+	}
+	return ranges
+}
+
+// inRanges reports whether offset i is within one of ranges.
+func inRanges(ranges [][2]int, i int) bool {
+	for _, r := range ranges {
+		if i > r[0] && i < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// startsWithI reports whether s starts with the pronoun "I".
+func startsWithI(s string) bool {
+	if len(s) == 0 || s[0] != 'I' {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(s[1:])
+	return len(s) == 1 || !isWordRune(next)
+}
+
+// sentenceStart reports whether a word following before starts a sentence.
+func sentenceStart(before string) bool {
+	trimmed := strings.TrimRight(before, " \t\"'“‘(*_")
+	if trimmed == "" {
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(trimmed)
+	return strings.ContainsRune(".!?…:\n", last)
+}
+
+// determinerStops are words that follow an object pronoun rather than a
+// determiner, as in "gave her a book" or "saw her yesterday".
+var determinerStops = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true, "nor": true,
+	"to": true, "of": true, "in": true, "on": true, "at": true, "by": true, "for": true,
+	"from": true, "with": true, "into": true, "onto": true, "up": true, "down": true,
+	"out": true, "off": true, "over": true, "back": true, "away": true, "again": true,
+	"too": true, "as": true, "so": true, "than": true, "that": true, "this": true,
+	"these": true, "those": true, "when": true, "while": true, "before": true,
+	"after": true, "if": true, "now": true, "then": true, "here": true, "there": true,
+	"today": true, "yesterday": true, "tomorrow": true, "tonight": true, "once": true,
+	"is": true, "was": true, "be": true, "go": true, "come": true, "alone": true,
+	"about": true, "around": true, "through": true, "across": true, "behind": true,
+	"all": true, "nothing": true, "something": true, "anything": true, "everything": true,
+	"close": true, "closer": true, "gently": true, "softly": true, "tightly": true,
+	"i": true, "you": true, "he": true, "she": true, "we": true, "they": true, "it": true,
+}
+
+// followedByWord reports whether rest, the text after a pronoun, starts
+// with a word the pronoun determines, as in "her book".
+func followedByWord(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t")
+	end := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) && r != '\'' && r != '-' })
+	if end < 0 {
+		end = len(rest)
+	}
+	word := strings.ToLower(rest[:end])
+	return word != "" && !determinerStops[word]
+}
+
+// matchCase returns replacement in the case of word: upper case if word
+// is, lower case if word is, capitalized if word is, and as given
+// otherwise. A leading pronoun "I" stays capitalized.
+func matchCase(word, replacement string) string {
+	upper, lower := strings.ToUpper(word), strings.ToLower(word)
+	switch {
+	case word == upper && word != lower && utf8.RuneCountInString(word) > 1:
+		return strings.ToUpper(replacement)
+	case word == lower:
+		if startsWithI(replacement) {
+			return "I" + strings.ToLower(replacement[1:])
+		}
+		return strings.ToLower(replacement)
+	}
+	first, size := utf8.DecodeRuneInString(word)
+	if unicode.IsUpper(first) && word[size:] == strings.ToLower(word[size:]) {
+		r, n := utf8.DecodeRuneInString(replacement)
+		return string(unicode.ToUpper(r)) + replacement[n:]
+	}
+	return replacement
+}
+
+// Rewrite applies r to the system prompt and every message.
+func (c *Conversation) Rewrite(r Rewriter) {
+	c.System = r.Rewrite(c.System)
+	for i := range c.Messages {
+		c.Messages[i].Content = r.Rewrite(c.Messages[i].Content)
+	}
+}
+
+// Rewrite applies r to the text, display name and plain keys of every
+// entry. Regular expression keys are left unchanged.
+func (lb *Lorebook) Rewrite(r Rewriter) {
+	for i := range lb.Entries {
+		e := &lb.Entries[i]
+		e.Text = r.Rewrite(e.Text)
+		e.DisplayName = r.Rewrite(e.DisplayName)
+		for j, key := range e.Keys {
+			if !regexKey.MatchString(key) {
+				e.Keys[j] = r.Rewrite(key)
+			}
+		}
+	}
+}
+
+// Rewrite applies r to the scenario's prompt, description, context
+// entries and lorebook.
+func (s *Scenario) Rewrite(r Rewriter) {
+	s.Prompt = r.Rewrite(s.Prompt)
+	s.Description = r.Rewrite(s.Description)
+	for i := range s.Context {
+		s.Context[i].Text = r.Rewrite(s.Context[i].Text)
+	}
+	for i := range s.EphemeralContext {
+		s.EphemeralContext[i].Text = r.Rewrite(s.EphemeralContext[i].Text)
+	}
+	s.Lorebook.Rewrite(r)
+}
@@ -0,0 +1,89 @@
+package novelai
+
+import "testing"
+
+func TestRenamer(t *testing.T) {
+	r := NewRenamer("Alice", "Mara", "Bob", "Alice")
+	tests := []struct {
+		in, want string
+	}{
+		{"Alice met Bob.", "Mara met Alice."},
+		{"ALICE! alice? Alice's hat.", "MARA! mara? Mara's hat."},
+		{"Malice and Bobby stay.", "Malice and Bobby stay."},
+		{"nothing here", "nothing here"},
+	}
+	for _, tt := range tests {
+		if got := r.Rewrite(tt.in); got != tt.want {
+			t.Errorf("Rewrite(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenamerUnicode(t *testing.T) {
+	r := NewRenamer("Zoë", "Ana")
+	if got := r.Rewrite("Zoë smiled; Zoëlle did not."); got != "Ana smiled; Zoëlle did not." {
+		t.Errorf("Rewrite() = %q", got)
+	}
+}
+
+func TestRenamerPronouns(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to PronounSet
+		in, want string
+	}{
+		{"she to he", PronounsShe, PronounsHe,
+			"She took her book and gave it to her. The book is hers; she kept it herself.",
+			"He took his book and gave it to him. The book is his; he kept it himself."},
+		{"her before stop word", PronounsShe, PronounsHe,
+			"I saw her yesterday and told her the news.",
+			"I saw him yesterday and told him the news."},
+		{"he to she", PronounsHe, PronounsShe,
+			"He lost his map. The map was his.",
+			"She lost her map. The map was hers."},
+		{"he to they", PronounsHe, PronounsThey,
+			"HE said his friends saw him.",
+			"THEY said their friends saw them."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRenamer().AddPronouns(tt.from, tt.to)
+			if got := r.Rewrite(tt.in); got != tt.want {
+				t.Errorf("Rewrite() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteConversationAndScenario(t *testing.T) {
+	r := NewRenamer("Alice", "Mara").AddPronouns(PronounsShe, PronounsHe)
+
+	conv := NewConversation("You are Alice.")
+	conv.AddMessage("user", "Where is Alice? Is she home?")
+	conv.Rewrite(r)
+	if conv.System != "You are Mara." || conv.Messages[0].Content != "Where is Mara? Is he home?" {
+		t.Errorf("Unexpected conversation: %q, %q", conv.System, conv.Messages[0].Content)
+	}
+
+	s := NewScenario("Test")
+	s.Prompt = "Alice woke."
+	s.Context = []ContextEntry{{Text: "Alice is a sailor. She fears storms."}}
+	s.Lorebook.AddEntry(NewLorebookEntry("Alice", "Alice has her father's ship.", "Alice", "/ali(ce)?/i"))
+	s.Rewrite(r)
+	if s.Prompt != "Mara woke." || s.Context[0].Text != "Mara is a sailor. He fears storms." {
+		t.Errorf("Unexpected scenario text: %q, %q", s.Prompt, s.Context[0].Text)
+	}
+	e := s.Lorebook.Entries[0]
+	if e.DisplayName != "Mara" || e.Text != "Mara has his father's ship." || e.Keys[0] != "Mara" || e.Keys[1] != "/ali(ce)?/i" {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+}
+
+func TestNewRenamerOddArguments(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic")
+		}
+	}()
+	NewRenamer("Alice")
+}
@@ -0,0 +1,205 @@
+package novelai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wbrown/novelai/textsim"
+)
+
+// ReplayOptions are the settings a conversation is replayed with, besides
+// the model.
+type ReplayOptions struct {
+	// Settings, if set, replace the conversation's settings. The model
+	// passed to Replay, if any, is applied on top.
+	Settings *Settings
+	// Overrides are applied on top of the settings, as in SendWith.
+	Overrides SamplingProfile
+	// OriginalHistory generates each turn following the original replies
+	// rather than the replayed ones, so that every turn is compared from
+	// the same history. By default the replayed replies are kept, as the
+	// new model would see its own replies after migrating.
+	OriginalHistory bool
+}
+
+// ReplayTurn compares an original reply with its replay.
+type ReplayTurn struct {
+	// Index is the index in Messages of the original reply.
+	Index int
+	// User is the user message replied to.
+	User string
+	// Original and Reply are the original and replayed replies.
+	Original     string
+	Reply        string
+	StopReason   string
+	InputTokens  int
+	OutputTokens int
+	// Diff is a word diff from the visible answer of the original reply
+	// to that of the replay; thinking is left out.
+	Diff TokenDiff
+	// Similarity is the ROUGE-L score of the visible answers, from 0 to
+	// 1; see textsim.RougeL.
+	Similarity float64
+	// Err is set if the replay failed. The original reply then stands in
+	// for it in the history of later turns.
+	Err error
+}
+
+// ReplayReport holds the results of Replay.
+type ReplayReport struct {
+	// From and To are the models of the original conversation and the
+	// replay.
+	From Model
+	To   Model
+	// Turns are in the order of the conversation.
+	Turns []ReplayTurn
+}
+
+// Replay generates each assistant reply of conv again against model and
+// opts, from the saved user messages, and compares the replies, for
+// evaluating a move to a new model. If model is "", the model of the
+// settings is kept. Only replies to a user message are replayed; other
+// messages are kept as they are. conv is charged the usage; its history is
+// not changed. Failed turns are recorded in the report rather than
+// returned.
+func Replay(conv *Conversation, model Model, opts ReplayOptions) (*ReplayReport, error) {
+	replay := *conv
+	if opts.Settings != nil {
+		replay.Settings = opts.Settings.Clone()
+	}
+	if model != "" {
+		if err := replay.UseModel(model); err != nil {
+			return nil, err
+		}
+	}
+	replay.Messages = nil
+	replay.ToolResults = nil
+	replay.Usage = Usage{}
+	replay.Turns = nil
+	replay.Classifier = nil
+	replay.Translator = nil
+	replay.ThinkingRetention = nil
+	replay.SafetyClassifier = nil
+	defer func() {
+		conv.Usage.InputTokens += replay.Usage.InputTokens
+		conv.Usage.OutputTokens += replay.Usage.OutputTokens
+	}()
+
+	report := &ReplayReport{From: conv.Settings.Model, To: replay.Settings.Model}
+	var history []Message
+	for i, m := range conv.Messages {
+		if m.Role != "assistant" || len(history) == 0 || history[len(history)-1].Role != "user" {
+			history = append(history, m)
+			continue
+		}
+		t := ReplayTurn{Index: i, User: history[len(history)-1].Content, Original: m.Content}
+		replay.Messages = copyMessages(history)
+		t.Reply, t.StopReason, t.InputTokens, t.OutputTokens, _, _, t.Err = replay.SendWith("", opts.Overrides)
+		if t.Err != nil || opts.OriginalHistory {
+			history = append(history, m)
+		} else {
+			history = replay.Messages
+		}
+		if t.Err == nil {
+			_, before := splitThinking(t.Original)
+			_, after := splitThinking(t.Reply)
+			before, after = strings.TrimSpace(before), strings.TrimSpace(after)
+			t.Diff, _ = DiffTokens(before, after, nil)
+			t.Similarity = textsim.RougeL(before, after)
+		}
+		report.Turns = append(report.Turns, t)
+	}
+	return report, nil
+}
+
+// Changed returns the number of turns whose replay answered differently,
+// not counting failed turns.
+func (r *ReplayReport) Changed() int {
+	n := 0
+	for _, t := range r.Turns {
+		if t.Err == nil && t.Diff.Changed() {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed returns the number of turns whose replay failed.
+func (r *ReplayReport) Failed() int {
+	n := 0
+	for _, t := range r.Turns {
+		if t.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// MeanSimilarity returns the mean Similarity of the turns replayed, or 0
+// if none were.
+func (r *ReplayReport) MeanSimilarity() float64 {
+	var sum float64
+	n := 0
+	for _, t := range r.Turns {
+		if t.Err == nil {
+			sum += t.Similarity
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// Markdown renders the report as a Markdown table of the turns, followed
+// by the original and replayed replies of each turn side by side, and
+// their diff.
+func (r *ReplayReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Replay of %s as %s: %d of %d turns changed, %d failed, mean similarity %.2f.\n\n",
+		modelName(r.From), modelName(r.To), r.Changed(), len(r.Turns), r.Failed(), r.MeanSimilarity())
+	b.WriteString("| Turn | Index | Changed | Similarity | Output tokens | Stop reason |\n")
+	b.WriteString("|---|---|---|---|---|---|\n")
+	for n, t := range r.Turns {
+		if t.Err != nil {
+			fmt.Fprintf(&b, "| %d | %d | error | - | - | - |\n", n+1, t.Index)
+			continue
+		}
+		changed := "no"
+		if t.Diff.Changed() {
+			changed = "yes"
+		}
+		fmt.Fprintf(&b, "| %d | %d | %s | %.2f | %d | %s |\n", n+1, t.Index, changed, t.Similarity,
+			t.OutputTokens, t.StopReason)
+	}
+	for n, t := range r.Turns {
+		fmt.Fprintf(&b, "\n### Turn %d\n\n", n+1)
+		writeFenced(&b, t.User)
+		if t.Err != nil {
+			fmt.Fprintf(&b, "\nError: %v\n", t.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "\n| Original (%s) | Replay (%s) |\n|---|---|\n| %s | %s |\n\n",
+			modelName(r.From), modelName(r.To), markdownCell(t.Original), markdownCell(t.Reply))
+		writeFenced(&b, t.Diff.String())
+	}
+	return b.String()
+}
+
+// modelName returns the display name of a model.
+func modelName(model Model) string {
+	if info, ok := LookupModel(model); ok {
+		return info.Name
+	}
+	if model == "" {
+		return "default model"
+	}
+	return string(model)
+}
+
+// markdownCell escapes text for a Markdown table cell.
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "|", `\|`)
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
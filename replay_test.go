@@ -0,0 +1,146 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+func replayConversation() *Conversation {
+	conv := NewConversation("Be helpful.")
+	conv.AddMessage("user", "Name a color.")
+	conv.AddMessage("assistant", "Red.")
+	conv.AddMessage("user", "Name a fruit.")
+	conv.AddMessage("assistant", "<think>Something sweet.</think>An apple.")
+	return conv
+}
+
+func TestReplay(t *testing.T) {
+	conv := replayConversation()
+	fake := NewFakeBackend().
+		On("Name a fruit", FakeResponse{Text: "<think>Hmm.</think>A pear.", PromptTokens: 20, CompletionTokens: 4}).
+		On("Name a color", FakeResponse{Text: "Blue.", PromptTokens: 10, CompletionTokens: 2})
+	fake.Install(conv)
+	before := copyMessages(conv.Messages)
+
+	report, err := Replay(conv, ModelGLM47, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if report.From != ModelGLM46 || report.To != ModelGLM47 {
+		t.Errorf("models = %s to %s", report.From, report.To)
+	}
+	if len(report.Turns) != 2 {
+		t.Fatalf("got %d turns, want 2", len(report.Turns))
+	}
+	first, second := report.Turns[0], report.Turns[1]
+	if first.Index != 1 || first.User != "Name a color." || first.Original != "Red." || first.Reply != "Blue." {
+		t.Errorf("first turn = %+v", first)
+	}
+	if second.Index != 3 || second.OutputTokens != 4 || !second.Diff.Changed() {
+		t.Errorf("second turn = %+v", second)
+	}
+	if got := second.Diff.String(); strings.Contains(got, "think") || !strings.Contains(got, "{+pear+}") {
+		t.Errorf("second diff = %q, want the visible answers only", got)
+	}
+	if report.Changed() != 2 || report.Failed() != 0 {
+		t.Errorf("changed %d, failed %d", report.Changed(), report.Failed())
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if requests[0].Model != string(ModelGLM47) {
+		t.Errorf("request model = %q", requests[0].Model)
+	}
+	if p := requests[1].Prompt; !strings.Contains(p, "Blue.") || strings.Contains(p, "Red.") {
+		t.Errorf("second prompt does not follow the replayed reply: %q", p)
+	}
+
+	if len(conv.Messages) != len(before) || conv.Messages[3].Content != before[3].Content {
+		t.Errorf("history changed: %+v", conv.Messages)
+	}
+	if conv.Settings.Model != ModelGLM46 {
+		t.Errorf("model changed to %s", conv.Settings.Model)
+	}
+	if conv.Usage.InputTokens != 30 || conv.Usage.OutputTokens != 6 {
+		t.Errorf("usage = %+v, want the replay charged", conv.Usage)
+	}
+}
+
+func TestReplayOriginalHistory(t *testing.T) {
+	conv := replayConversation()
+	fake := NewFakeBackend().
+		On("Name a fruit", FakeResponse{Text: "An apple."}).
+		On("Name a color", FakeResponse{Text: "Blue."})
+	fake.Install(conv)
+
+	settings := conv.Settings.Clone()
+	settings.Temperature = 0.3
+	report, err := Replay(conv, "", ReplayOptions{Settings: &settings, OriginalHistory: true})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if p := fake.Requests()[1].Prompt; !strings.Contains(p, "Red.") || strings.Contains(p, "Blue.") {
+		t.Errorf("second prompt does not follow the original reply: %q", p)
+	}
+	if report.Changed() != 1 {
+		t.Errorf("changed = %d, want 1", report.Changed())
+	}
+	if s := report.Turns[1].Similarity; s != 1 {
+		t.Errorf("similarity of the same answer = %v, want 1", s)
+	}
+}
+
+func TestReplayFailedTurn(t *testing.T) {
+	conv := replayConversation()
+	conv.Retry = &RetryPolicy{}
+	fake := NewFakeBackend().
+		On("Name a fruit", FakeResponse{Text: "An apple."}).
+		On("Name a color", FakeResponse{StatusCode: 400, Body: `{"message":"bad"}`})
+	fake.Install(conv)
+
+	report, err := Replay(conv, ModelGLM47, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if report.Turns[0].Err == nil || report.Failed() != 1 {
+		t.Fatalf("first turn = %+v, want an error", report.Turns[0])
+	}
+	if p := fake.Requests()[1].Prompt; !strings.Contains(p, "Red.") {
+		t.Errorf("second prompt does not fall back to the original reply: %q", p)
+	}
+	if report.Turns[1].Err != nil || report.Turns[1].Diff.Changed() {
+		t.Errorf("second turn = %+v", report.Turns[1])
+	}
+}
+
+func TestReplayUnknownModel(t *testing.T) {
+	if _, err := Replay(replayConversation(), "no-such-model", ReplayOptions{}); err == nil {
+		t.Error("Replay with an unknown model succeeded")
+	}
+}
+
+func TestReplayReportMarkdown(t *testing.T) {
+	conv := replayConversation()
+	NewFakeBackend().
+		On("Name a fruit", FakeResponse{Text: "A pear |\nripe."}).
+		On("Name a color", FakeResponse{Text: "Red."}).
+		Install(conv)
+	report, err := Replay(conv, ModelGLM47, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	md := report.Markdown()
+	for _, want := range []string{
+		"Replay of GLM-4.6 as GLM-4.7: 1 of 2 turns changed, 0 failed",
+		"| 1 | 1 | no | 1.00 |",
+		"| Original (GLM-4.6) | Replay (GLM-4.7) |",
+		`| <think>Something sweet.</think>An apple. | A pear \|<br>ripe. |`,
+		"[-apple-]{+pear |\\nripe+}",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+}
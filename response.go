@@ -0,0 +1,86 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Response is a reply from SendDetailed with the details of the API
+// response that Send does not return.
+type Response struct {
+	// Reply, StopReason, InputTokens and OutputTokens are as returned by
+	// Send.
+	Reply        string
+	StopReason   string
+	InputTokens  int
+	OutputTokens int
+	// ID, Object, Created and Model are the fields of the API response.
+	// For a reply continued to reach Settings.MinTokens, they are those of
+	// the last request.
+	ID      string
+	Object  string
+	Created time.Time
+	Model   string
+	// FinishReason is the finish reason as reported, before normalizing
+	// to StopReason.
+	FinishReason string
+	// Raw is the response body, for fields this package does not decode,
+	// such as vendor extensions. See Decode.
+	Raw json.RawMessage
+}
+
+// Decode unmarshals the response body into v, such as a struct with the
+// vendor fields wanted.
+func (r *Response) Decode(v any) error {
+	if err := json.Unmarshal(r.Raw, v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// SendDetailed is like SendWith but returns the reply as a Response, with
+// the fields and raw JSON of the API response.
+func (c *Conversation) SendDetailed(text string, overrides SamplingProfile) (*Response, error) {
+	r := &Response{}
+	ctx := context.WithValue(c.context(), responseKey{}, responseCapture{c, r})
+	var err error
+	r.Reply, r.StopReason, r.InputTokens, r.OutputTokens, _, _, err =
+		c.sendContext(ctx, text, &c.Settings, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// responseKey is the context key of the responseCapture of SendDetailed.
+type responseKey struct{}
+
+// responseCapture is the Response that the details of the conversation's
+// requests are captured into. Side requests, made on copies of the
+// conversation with the same context, are not captured.
+type responseCapture struct {
+	conv *Conversation
+	r    *Response
+}
+
+// captureResponse records the details of a completion response in the
+// Response on ctx, if it is for c.
+func (c *Conversation) captureResponse(ctx context.Context, body []byte, resp *completionResponse) {
+	capture, ok := ctx.Value(responseKey{}).(responseCapture)
+	if !ok || capture.conv != c {
+		return
+	}
+	r := capture.r
+	r.ID, r.Object, r.Model = resp.ID, resp.Object, resp.Model
+	r.Created = time.Time{}
+	if resp.Created != 0 {
+		r.Created = time.Unix(resp.Created, 0)
+	}
+	r.FinishReason = ""
+	if len(resp.Choices) > 0 {
+		r.FinishReason = resp.Choices[0].FinishReason
+	}
+	r.Raw = json.RawMessage(body)
+}
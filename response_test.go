@@ -0,0 +1,62 @@
+package novelai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendDetailed(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		resp := map[string]any{}
+		if requests == 1 {
+			data, _ := json.Marshal(mockCompletionResponse("<think>Easy.</think>Four.", "stop", 10, 4))
+			json.Unmarshal(data, &resp)
+			resp["system_fingerprint"] = "fp-42"
+		} else {
+			// The side request summarizing the thinking
+			data, _ := json.Marshal(mockCompletionResponse("Summed up.", "stop", 10, 3))
+			json.Unmarshal(data, &resp)
+			resp["id"] = "cmpl-side"
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+	conv := NewConversationWithClient(nil, ConversationConfig{
+		ApiToken: "test-token",
+		Endpoint: server.URL,
+		Settings: BuiltinSettings(),
+	})
+	conv.ThinkingRetention = &ThinkingRetention{Summarize: conv.SummarizeThinking()}
+
+	r, err := conv.SendDetailed("What is 2+2?", SamplingProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Reply != "<think>Easy.</think>Four." || r.StopReason != string(StopEndTurn) ||
+		r.InputTokens != 10 || r.OutputTokens != 4 {
+		t.Errorf("reply = %+v", r)
+	}
+	if requests != 2 {
+		t.Fatalf("Expected a side request, got %d requests", requests)
+	}
+	// The side request is not captured
+	if r.ID != "cmpl-123" || r.Object != "text_completion" || r.Model != "glm-4-6" ||
+		!r.Created.Equal(time.Unix(1677652288, 0)) || r.FinishReason != "stop" {
+		t.Errorf("response fields = %+v", r)
+	}
+	var vendor struct {
+		SystemFingerprint string `json:"system_fingerprint"`
+	}
+	if err := r.Decode(&vendor); err != nil || vendor.SystemFingerprint != "fp-42" {
+		t.Errorf("Decode() = %+v, %v", vendor, err)
+	}
+	if !strings.Contains(string(r.Raw), `"cmpl-123"`) {
+		t.Errorf("Raw = %s", r.Raw)
+	}
+}
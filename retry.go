@@ -0,0 +1,94 @@
+package novelai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how requests that fail before a response arrives,
+// such as on a dropped connection, are retried. Error responses from the
+// API are not retried.
+type RetryPolicy struct {
+	// MaxRetries is how many times a failed request is retried.
+	MaxRetries int
+	// Delay is the wait before each retry.
+	Delay time.Duration
+}
+
+// DefaultRetryPolicy is used by conversations and clients without their
+// own Retry policy.
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, Delay: 3 * time.Second}
+
+// retryPolicy returns Retry, or DefaultRetryPolicy if unset.
+func (c *Conversation) retryPolicy() RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return DefaultRetryPolicy
+}
+
+// retryPolicy returns Retry, or DefaultRetryPolicy if unset.
+func (c *Client) retryPolicy() RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return DefaultRetryPolicy
+}
+
+// newRequest creates an authenticated request with data as its body. The
+// body can be replayed with GetBody, so the request is safe to retry and
+// to follow through redirects.
+func newRequest(ctx context.Context, method, url, token, contentType string, data []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if data != nil {
+		req.ContentLength = int64(len(data))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		req.Body, _ = req.GetBody()
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
+
+// doWithRetries performs req, retrying transport errors as policy allows.
+// The body is rewound with GetBody before each retry. Waiting between
+// retries sleeps on clock, stopping early if the request's context is
+// done.
+func doWithRetries(client *http.Client, req *http.Request, policy RetryPolicy, clock Clock) (*http.Response, error) {
+	var err error
+	attempt := 0
+	for ; attempt <= policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if sleepErr := clock.Sleep(req.Context(), policy.Delay); sleepErr != nil {
+				return nil, fmt.Errorf("HTTP error after %d retries: %w (last error: %v)",
+					attempt-1, sleepErr, err)
+			}
+			if req.GetBody != nil {
+				body, bodyErr := req.GetBody()
+				if bodyErr != nil {
+					return nil, fmt.Errorf("error rewinding request body: %w", bodyErr)
+				}
+				req.Body = body
+			}
+		}
+		var resp *http.Response
+		if resp, err = client.Do(req); err == nil {
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("HTTP error after %d retries: %w", min(attempt, policy.MaxRetries), err)
+}
@@ -0,0 +1,115 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+// flakyTransport fails the first failures requests after consuming part of
+// their body, then passes requests to next.
+type flakyTransport struct {
+	failures int
+	next     http.RoundTripper
+	attempts int
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.attempts++
+	if t.attempts <= t.failures {
+		if req.Body != nil {
+			io.CopyN(io.Discard, req.Body, 10)
+			req.Body.Close()
+		}
+		return nil, errors.New("connection reset")
+	}
+	return t.next.RoundTrip(req)
+}
+
+// fastRetry retries three times without waiting long.
+var fastRetry = &RetryPolicy{MaxRetries: 3, Delay: time.Millisecond}
+
+// TestSendRetriesReplayBody tests that retried requests send the full body.
+func TestSendRetriesReplayBody(t *testing.T) {
+	conv := NewConversation("")
+	conv.Retry = fastRetry
+	fake := NewFakeBackend().On(`Hello`, FakeResponse{Text: "Hi."})
+	fake.Install(conv)
+	flaky := &flakyTransport{failures: 2, next: fake}
+	conv.HttpClient.Transport = flaky
+
+	reply, _, _, _, _, _, err := conv.Send("Hello", llmapi.Sampling{})
+	if err != nil || reply != "Hi." {
+		t.Fatalf("Expected reply after retries, got %q, %v", reply, err)
+	}
+	if flaky.attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", flaky.attempts)
+	}
+
+	flaky.attempts = 0
+	reply, _, _, _, _, _, err = conv.SendStreaming("Hello again", llmapi.Sampling{}, nil)
+	if err != nil || reply != "Hi." {
+		t.Fatalf("Expected streamed reply after retries, got %q, %v", reply, err)
+	}
+
+	flaky.attempts, flaky.failures = 0, fastRetry.MaxRetries+1
+	if _, _, _, _, _, _, err = conv.Send("Hello", llmapi.Sampling{}); err == nil ||
+		!strings.Contains(err.Error(), "after 3 retries") {
+		t.Errorf("Expected error after exhausting retries, got %v", err)
+	}
+	if flaky.attempts != fastRetry.MaxRetries+1 {
+		t.Errorf("Expected %d attempts, got %d", fastRetry.MaxRetries+1, flaky.attempts)
+	}
+
+	// A policy without retries applies to this conversation only
+	conv.Retry = &RetryPolicy{}
+	flaky.attempts = 0
+	if _, _, _, _, _, _, err = conv.Send("Hello", llmapi.Sampling{}); err == nil || flaky.attempts != 1 {
+		t.Errorf("Expected a single attempt, got %d (%v)", flaky.attempts, err)
+	}
+}
+
+// TestClientRetriesReplayBody tests retries of native API requests.
+func TestClientRetriesReplayBody(t *testing.T) {
+	var got string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = string(body)
+		w.Write([]byte(`{"output":"ok"}`))
+	})
+	client.HttpClient = &http.Client{Transport: &flakyTransport{failures: 1, next: http.DefaultTransport}}
+	client.Retry = fastRetry
+
+	if _, err := client.Generate(context.Background(), &GenerateRequest{Input: "It was sunny", Model: ModelErato}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, `"input":"It was sunny"`) {
+		t.Errorf("Expected full body on retry, got %q", got)
+	}
+}
+
+// TestRetryStopsOnCancel tests that waiting between retries ends when the
+// context is cancelled.
+func TestRetryStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := newRequest(ctx, "POST", "http://example.invalid", "token", "application/json", []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &flakyTransport{failures: 10}}
+
+	start := time.Now()
+	if _, err := doWithRetries(client, req, RetryPolicy{MaxRetries: 3, Delay: time.Hour}, SystemClock); err == nil {
+		t.Fatal("Expected error")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Expected retries to stop when the context was cancelled")
+	}
+}
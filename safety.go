@@ -0,0 +1,217 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MetaKeySafetyPrefix prefixes the metadata keys under which the safety
+// annotation of each reply is kept, followed by the reply's index in
+// Messages.
+const MetaKeySafetyPrefix = "safety:"
+
+// SafetyAnnotation is the safety classification of an exchange: a user
+// message and the reply to it.
+type SafetyAnnotation struct {
+	// Categories are the categories found in the exchange, such as
+	// "violence".
+	Categories []string `json:"categories,omitempty"`
+	// Scores are the score of each category judged, from 0 to 1, if the
+	// classifier gives them.
+	Scores map[string]float64 `json:"scores,omitempty"`
+}
+
+// Flagged reports whether category was found, or any category if category
+// is "".
+func (a SafetyAnnotation) Flagged(category string) bool {
+	if category == "" {
+		return len(a.Categories) > 0
+	}
+	return slices.Contains(a.Categories, category)
+}
+
+// SafetyClassifier classifies exchanges for safety annotations.
+type SafetyClassifier interface {
+	ClassifyExchange(ctx context.Context, user, reply string) (SafetyAnnotation, error)
+}
+
+// SafetyClassifierFunc adapts a function to the SafetyClassifier
+// interface.
+type SafetyClassifierFunc func(ctx context.Context, user, reply string) (SafetyAnnotation, error)
+
+// ClassifyExchange calls f(ctx, user, reply).
+func (f SafetyClassifierFunc) ClassifyExchange(ctx context.Context, user, reply string) (SafetyAnnotation, error) {
+	return f(ctx, user, reply)
+}
+
+// KeywordSafetyClassifier returns a local classifier finding a category in
+// an exchange when the user message or reply contains any of its words, as
+// matched by KeywordClassifier. Found categories score 1, the others 0.
+func KeywordSafetyClassifier(categories map[string][]string) SafetyClassifier {
+	classifiers := make(map[string]Classifier, len(categories))
+	for category, words := range categories {
+		classifiers[category] = KeywordClassifier(words...)
+	}
+	return SafetyClassifierFunc(func(ctx context.Context, user, reply string) (SafetyAnnotation, error) {
+		a := SafetyAnnotation{Scores: make(map[string]float64, len(classifiers))}
+		for category, cl := range classifiers {
+			c, err := cl.Classify(ctx, user+"\n"+reply)
+			if err != nil {
+				return SafetyAnnotation{}, err
+			}
+			a.Scores[category] = 0
+			if !c.Allowed {
+				a.Scores[category] = 1
+				a.Categories = append(a.Categories, category)
+			}
+		}
+		slices.Sort(a.Categories)
+		return a, nil
+	})
+}
+
+// SafetyInstruction builds the instruction asking the model to score an
+// exchange for each category.
+func SafetyInstruction(categories []string, user, reply string) string {
+	return "Rate how much the exchange below contains each of these categories, from 0 (not at all) " +
+		"to 1 (clearly): " + strings.Join(categories, ", ") + ". Respond with one line per category, " +
+		"in the form \"category: score\", and nothing else.\n\nUser: " + user + "\n\nAssistant: " + reply
+}
+
+// ParseSafetyScores reads the "category: score" lines of a model's reply
+// to SafetyInstruction, keeping the categories asked for. Scores are
+// clamped to [0, 1].
+func ParseSafetyScores(reply string, categories []string) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, line := range strings.Split(reply, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.Trim(name, " \t-*\"'"))
+		for _, category := range categories {
+			if strings.ToLower(category) != name {
+				continue
+			}
+			if score, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				scores[category] = min(max(score, 0), 1)
+			}
+		}
+	}
+	return scores
+}
+
+// ModelSafetyClassifier returns a classifier asking the model, in a side
+// request, to score each exchange for categories. Categories scoring at
+// least threshold are found. Fails if the reply scores none of them.
+func (c *Conversation) ModelSafetyClassifier(threshold float64, categories ...string) SafetyClassifier {
+	return SafetyClassifierFunc(func(ctx context.Context, user, reply string) (SafetyAnnotation, error) {
+		_, visible := splitThinking(reply)
+		answer, err := c.sideRequest(ctx, SafetyInstruction(categories, user, strings.TrimSpace(visible)),
+			SamplingProfile{Temperature: Float64(0)})
+		if err != nil {
+			return SafetyAnnotation{}, fmt.Errorf("error classifying exchange: %w", err)
+		}
+		_, answer = splitThinking(answer)
+		a := SafetyAnnotation{Scores: ParseSafetyScores(answer, categories)}
+		if len(a.Scores) == 0 {
+			return SafetyAnnotation{}, fmt.Errorf("error classifying exchange: no scores in reply %q", answer)
+		}
+		for _, category := range categories {
+			if score, ok := a.Scores[category]; ok && score >= threshold {
+				a.Categories = append(a.Categories, category)
+			}
+		}
+		return a, nil
+	})
+}
+
+// AnnotateSafety classifies each exchange with a reply not yet annotated
+// using SafetyClassifier, keeping the annotation in Meta under
+// MetaKeySafetyPrefix and the reply's index. Annotations of messages
+// removed or merged from the history are dropped with them. It runs after
+// each reply when SafetyClassifier is set, and once after the last segment
+// of SendUntilDone; call it to annotate restored conversations.
+// Replies whose classification fails are left for the next call. Returns
+// the number of replies annotated and the first error.
+func (c *Conversation) AnnotateSafety() (int, error) {
+	return c.annotateSafety(c.context())
+}
+
+// annotateSafety implements AnnotateSafety, classifying with ctx.
+func (c *Conversation) annotateSafety(ctx context.Context) (int, error) {
+	if c.SafetyClassifier == nil {
+		return 0, nil
+	}
+	annotated := 0
+	var firstErr error
+	user := ""
+	for i, m := range c.Messages {
+		if m.Role == "user" {
+			user = m.Content
+		}
+		if m.Role != "assistant" {
+			continue
+		}
+		key := MetaKeySafetyPrefix + strconv.Itoa(i)
+		if _, done := c.Meta[key]; done {
+			continue
+		}
+		a, err := c.SafetyClassifier.ClassifyExchange(ctx, user, m.Content)
+		var data []byte
+		if err == nil {
+			data, err = json.Marshal(a)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error annotating reply %d: %w", i, err)
+			}
+			continue
+		}
+		c.SetMeta(key, string(data))
+		annotated++
+	}
+	return annotated, firstErr
+}
+
+// annotateWhenDone holds back SafetyClassifier while the segments of a
+// reply are sent and merged by SendUntilDone, so that the merged reply is
+// classified once, as a whole. The returned function restores it and, if
+// *err is nil, annotates the reply.
+func (c *Conversation) annotateWhenDone(err *error) func() {
+	classifier := c.SafetyClassifier
+	c.SafetyClassifier = nil
+	return func() {
+		c.SafetyClassifier = classifier
+		if *err == nil {
+			c.AnnotateSafety()
+		}
+	}
+}
+
+// SafetyAnnotationOf returns the safety annotation of the reply at
+// Messages[i], if it has one.
+func (c *Conversation) SafetyAnnotationOf(i int) (SafetyAnnotation, bool) {
+	var a SafetyAnnotation
+	data, ok := c.Meta[MetaKeySafetyPrefix+strconv.Itoa(i)]
+	if !ok || json.Unmarshal([]byte(data), &a) != nil {
+		return SafetyAnnotation{}, false
+	}
+	return a, true
+}
+
+// FlaggedReplies returns the indices in Messages of the replies whose
+// annotation found category, or any category if category is "".
+func (c *Conversation) FlaggedReplies(category string) []int {
+	var flagged []int
+	for i := range c.Messages {
+		if a, ok := c.SafetyAnnotationOf(i); ok && a.Flagged(category) {
+			flagged = append(flagged, i)
+		}
+	}
+	return flagged
+}
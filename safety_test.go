@@ -0,0 +1,170 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+func TestKeywordSafetyAnnotations(t *testing.T) {
+	conv := &Conversation{ApiToken: "test-token", Settings: BuiltinSettings()}
+	NewFakeBackend().
+		On(`Thanks`, FakeResponse{Text: "You're welcome."}).
+		On(`Tell me a story`, FakeResponse{Text: "The knight drew his sword."}).
+		Install(conv)
+	conv.SafetyClassifier = KeywordSafetyClassifier(map[string][]string{
+		"violence": {"sword", "kill"},
+		"spam":     {"buy"},
+	})
+
+	if _, _, _, _, _, _, err := conv.Send("Tell me a story", llmapi.Sampling{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, _, _, err := conv.SendStreaming("Thanks", llmapi.Sampling{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	a, ok := conv.SafetyAnnotationOf(1)
+	want := SafetyAnnotation{Categories: []string{"violence"}, Scores: map[string]float64{"violence": 1, "spam": 0}}
+	if !ok || !reflect.DeepEqual(a, want) {
+		t.Errorf("annotation of reply 1 = %+v, %v", a, ok)
+	}
+	if a, ok := conv.SafetyAnnotationOf(3); !ok || a.Flagged("") {
+		t.Errorf("annotation of reply 3 = %+v, %v", a, ok)
+	}
+	if _, ok := conv.SafetyAnnotationOf(0); ok {
+		t.Error("user message annotated")
+	}
+	if got := conv.FlaggedReplies("violence"); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("FlaggedReplies(violence) = %v", got)
+	}
+	if got := conv.FlaggedReplies("spam"); got != nil {
+		t.Errorf("FlaggedReplies(spam) = %v", got)
+	}
+
+	// Annotations are kept in snapshots
+	restored := &Conversation{}
+	restored.Restore(conv.Snapshot())
+	if got := restored.FlaggedReplies(""); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("FlaggedReplies() after restore = %v", got)
+	}
+}
+
+func TestAnnotateSafetyContinuedReply(t *testing.T) {
+	sends := map[string]func(*Conversation, string) error{
+		"SendUntilDone": func(c *Conversation, text string) error {
+			_, _, _, _, _, _, err := c.SendUntilDone(text, llmapi.Sampling{})
+			return err
+		},
+		"SendStreamingUntilDone": func(c *Conversation, text string) error {
+			_, _, _, _, _, _, err := c.SendStreamingUntilDone(text, llmapi.Sampling{}, nil)
+			return err
+		},
+	}
+	for name, send := range sends {
+		t.Run(name, func(t *testing.T) {
+			conv := &Conversation{ApiToken: "test-token", Settings: BuiltinSettings()}
+			NewFakeBackend().
+				On(`Thanks`, FakeResponse{Text: "You're welcome."}).
+				On(`Tell me a story`,
+					FakeResponse{Text: "The knight dr", FinishReason: "length"},
+					FakeResponse{Text: "ew his sword."}).
+				Install(conv)
+			var classified []string
+			keywords := KeywordSafetyClassifier(map[string][]string{"violence": {"sword"}})
+			conv.SafetyClassifier = SafetyClassifierFunc(func(ctx context.Context, user, reply string) (SafetyAnnotation, error) {
+				classified = append(classified, reply)
+				return keywords.ClassifyExchange(ctx, user, reply)
+			})
+
+			if err := send(conv, "Tell me a story"); err != nil {
+				t.Fatal(err)
+			}
+			if len(conv.Messages) != 2 {
+				t.Fatalf("got %d messages, want the segments merged", len(conv.Messages))
+			}
+			if !reflect.DeepEqual(classified, []string{"The knight drew his sword."}) {
+				t.Errorf("classified %q, want the merged reply once", classified)
+			}
+			if err := send(conv, "Thanks"); err != nil {
+				t.Fatal(err)
+			}
+			if got := conv.FlaggedReplies(""); !reflect.DeepEqual(got, []int{1}) {
+				t.Errorf("FlaggedReplies() = %v, want the merged reply only", got)
+			}
+			if _, ok := conv.SafetyAnnotationOf(2); ok {
+				t.Error("user message annotated")
+			}
+
+			// Replies after Clear are classified afresh
+			conv.Clear()
+			classified = nil
+			if err := send(conv, "Thanks"); err != nil {
+				t.Fatal(err)
+			}
+			if a, ok := conv.SafetyAnnotationOf(1); !ok || a.Flagged("") || len(classified) != 1 {
+				t.Errorf("annotation after Clear = %+v, %v; classified %q", a, ok, classified)
+			}
+		})
+	}
+}
+
+func TestAnnotateSafetyRetries(t *testing.T) {
+	conv := &Conversation{Messages: []Message{
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello."},
+	}}
+	if n, err := conv.AnnotateSafety(); n != 0 || err != nil {
+		t.Errorf("AnnotateSafety() without a classifier = %d, %v", n, err)
+	}
+
+	fail := true
+	var exchanges [][2]string
+	conv.SafetyClassifier = SafetyClassifierFunc(func(ctx context.Context, user, reply string) (SafetyAnnotation, error) {
+		if fail {
+			return SafetyAnnotation{}, errors.New("classifier down")
+		}
+		exchanges = append(exchanges, [2]string{user, reply})
+		return SafetyAnnotation{}, nil
+	})
+	if n, err := conv.AnnotateSafety(); n != 0 || err == nil {
+		t.Errorf("failing AnnotateSafety() = %d, %v", n, err)
+	}
+	fail = false
+	if n, err := conv.AnnotateSafety(); n != 1 || err != nil {
+		t.Errorf("AnnotateSafety() = %d, %v", n, err)
+	}
+	if n, _ := conv.AnnotateSafety(); n != 0 {
+		t.Errorf("Expected annotated replies skipped, annotated %d", n)
+	}
+	if len(exchanges) != 1 || exchanges[0] != [2]string{"Hi", "Hello."} {
+		t.Errorf("classified %q", exchanges)
+	}
+}
+
+func TestModelSafetyClassifier(t *testing.T) {
+	conv := &Conversation{ApiToken: "test-token", Settings: BuiltinSettings()}
+	fake := NewFakeBackend().
+		On(`Rate how much`, FakeResponse{Text: "- Violence: 0.8\nself-harm: 0.1\nother: 1"}).
+		On(`Hello`, FakeResponse{Text: "<think>Hm.</think>A grim tale."})
+	fake.Install(conv)
+	conv.SafetyClassifier = conv.ModelSafetyClassifier(0.5, "violence", "self-harm")
+
+	if _, _, _, _, _, _, err := conv.Send("Hello", llmapi.Sampling{}); err != nil {
+		t.Fatal(err)
+	}
+	a, ok := conv.SafetyAnnotationOf(1)
+	want := SafetyAnnotation{Categories: []string{"violence"}, Scores: map[string]float64{"violence": 0.8, "self-harm": 0.1}}
+	if !ok || !reflect.DeepEqual(a, want) {
+		t.Errorf("annotation = %+v, %v", a, ok)
+	}
+	if requests := fake.Requests(); len(requests) != 2 {
+		t.Errorf("Expected one side request, got %d requests", len(requests))
+	}
+	if len(conv.Messages) != 2 {
+		t.Errorf("side request changed the history: %+v", conv.Messages)
+	}
+}
@@ -0,0 +1,131 @@
+package novelai
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Sampler IDs accepted in GenerationParams.Order.
+const (
+	SamplerTemperature = "temperature"
+	SamplerTopK        = "top_k"
+	SamplerTopP        = "top_p"
+	SamplerTFS         = "tfs"
+	SamplerTopA        = "top_a"
+	SamplerTypicalP    = "typical_p"
+	SamplerCFG         = "cfg"
+	SamplerTopG        = "top_g"
+	SamplerMirostat    = "mirostat"
+	SamplerMath1       = "math1"
+	SamplerMinP        = "min_p"
+)
+
+// samplerNumbers maps scenario sampler IDs to the native API's numeric IDs.
+var samplerNumbers = func() map[string]int {
+	m := make(map[string]int, len(samplerIDs))
+	for n, id := range samplerIDs {
+		m[id] = n
+	}
+	return m
+}()
+
+// KnownSamplers returns every valid sampler ID, in native ID order.
+func KnownSamplers() []string {
+	ids := make([]string, 0, len(samplerIDs))
+	for _, id := range samplerIDs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return samplerNumbers[ids[i]] < samplerNumbers[ids[j]] })
+	return ids
+}
+
+// ValidateOrder checks that Order contains only known sampler IDs, each at
+// most once.
+func (p *GenerationParams) ValidateOrder() error {
+	seen := make(map[string]bool, len(p.Order))
+	for i, s := range p.Order {
+		if _, ok := samplerNumbers[s.ID]; !ok {
+			return fmt.Errorf("order[%d]: unknown sampler %q", i, s.ID)
+		}
+		if seen[s.ID] {
+			return fmt.Errorf("order[%d]: sampler %q listed more than once", i, s.ID)
+		}
+		seen[s.ID] = true
+	}
+	return nil
+}
+
+// EnabledSamplers returns the IDs of enabled samplers in the order they run.
+func (p *GenerationParams) EnabledSamplers() []string {
+	var ids []string
+	for _, s := range p.Order {
+		if s.Enabled {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
+// SamplerEnabled reports whether the sampler is in Order and enabled.
+func (p *GenerationParams) SamplerEnabled(id string) bool {
+	i := p.samplerIndex(id)
+	return i >= 0 && p.Order[i].Enabled
+}
+
+// SetSamplerEnabled enables or disables a sampler. As in the NovelAI UI,
+// a known sampler missing from Order is appended at the end.
+func (p *GenerationParams) SetSamplerEnabled(id string, enabled bool) error {
+	if _, ok := samplerNumbers[id]; !ok {
+		return fmt.Errorf("unknown sampler %q", id)
+	}
+	if i := p.samplerIndex(id); i >= 0 {
+		p.Order[i].Enabled = enabled
+		return nil
+	}
+	p.Order = append(p.Order, SamplerOrder{ID: id, Enabled: enabled})
+	return nil
+}
+
+// MoveSampler moves a sampler to position index in Order, shifting the
+// samplers in between. Index is clamped to the valid range.
+func (p *GenerationParams) MoveSampler(id string, index int) error {
+	from := p.samplerIndex(id)
+	if from < 0 {
+		return fmt.Errorf("sampler %q not in order", id)
+	}
+	index = max(0, min(index, len(p.Order)-1))
+	s := p.Order[from]
+	p.Order = append(p.Order[:from], p.Order[from+1:]...)
+	p.Order = append(p.Order[:index], append([]SamplerOrder{s}, p.Order[index:]...)...)
+	return nil
+}
+
+// NativeOrder returns the native API's numeric sampler order: the enabled
+// samplers, in order. Returns an error if Order is invalid.
+func (p *GenerationParams) NativeOrder() ([]int, error) {
+	if err := p.ValidateOrder(); err != nil {
+		return nil, err
+	}
+	return nativeOrder(p.Order), nil
+}
+
+// nativeOrder converts enabled samplers to numeric IDs, skipping unknown IDs.
+func nativeOrder(order []SamplerOrder) []int {
+	var ids []int
+	for _, s := range order {
+		if n, ok := samplerNumbers[s.ID]; ok && s.Enabled {
+			ids = append(ids, n)
+		}
+	}
+	return ids
+}
+
+// samplerIndex returns the position of a sampler in Order, or -1.
+func (p *GenerationParams) samplerIndex(id string) int {
+	for i, s := range p.Order {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,87 @@
+package novelai
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSamplerOrderValidation tests unknown and duplicate sampler IDs.
+func TestSamplerOrderValidation(t *testing.T) {
+	p := DefaultGenerationParams()
+	if err := p.ValidateOrder(); err != nil {
+		t.Errorf("Expected default order to be valid, got %v", err)
+	}
+
+	p.Order = append(p.Order, SamplerOrder{ID: "nucleus", Enabled: true})
+	if err := p.ValidateOrder(); err == nil {
+		t.Error("Expected error for unknown sampler")
+	}
+	if _, err := p.NativeOrder(); err == nil {
+		t.Error("Expected NativeOrder to reject unknown sampler")
+	}
+
+	p.Order = []SamplerOrder{{ID: SamplerTopK}, {ID: SamplerTopK}}
+	if err := p.ValidateOrder(); err == nil {
+		t.Error("Expected error for duplicate sampler")
+	}
+
+	s := NewScenario("Bad order")
+	s.Settings.Parameters.Order = []SamplerOrder{{ID: "bogus", Enabled: true}}
+	if _, err := NewGenerateRequest(s, "story", byteTokenizer); err == nil {
+		t.Error("Expected NewGenerateRequest to reject unknown sampler")
+	}
+}
+
+// TestSamplerToggleAndMove tests UI-style sampler editing.
+func TestSamplerToggleAndMove(t *testing.T) {
+	p := DefaultGenerationParams() // temperature, top_k, top_p, min_p (disabled)
+
+	if p.SamplerEnabled(SamplerMinP) {
+		t.Error("Expected min_p disabled by default")
+	}
+	if err := p.SetSamplerEnabled(SamplerMinP, true); err != nil {
+		t.Fatalf("SetSamplerEnabled failed: %v", err)
+	}
+	if err := p.SetSamplerEnabled(SamplerTopK, false); err != nil {
+		t.Fatalf("SetSamplerEnabled failed: %v", err)
+	}
+	if err := p.SetSamplerEnabled(SamplerTFS, true); err != nil {
+		t.Fatalf("SetSamplerEnabled failed: %v", err)
+	}
+	if err := p.SetSamplerEnabled("nope", true); err == nil {
+		t.Error("Expected error enabling unknown sampler")
+	}
+
+	if err := p.MoveSampler(SamplerMinP, 0); err != nil {
+		t.Fatalf("MoveSampler failed: %v", err)
+	}
+	if err := p.MoveSampler(SamplerTemperature, 99); err != nil {
+		t.Fatalf("MoveSampler failed: %v", err)
+	}
+	if err := p.MoveSampler(SamplerMirostat, 0); err == nil {
+		t.Error("Expected error moving sampler not in order")
+	}
+
+	expected := []string{SamplerMinP, SamplerTopP, SamplerTFS, SamplerTemperature}
+	if got := p.EnabledSamplers(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected enabled samplers %v, got %v", expected, got)
+	}
+	order, err := p.NativeOrder()
+	if err != nil {
+		t.Fatalf("NativeOrder failed: %v", err)
+	}
+	if !reflect.DeepEqual(order, []int{10, 2, 3, 0}) {
+		t.Errorf("Expected native order [10 2 3 0], got %v", order)
+	}
+	if got := NativeParameters(p).Order; !reflect.DeepEqual(got, order) {
+		t.Errorf("Expected request order %v, got %v", order, got)
+	}
+}
+
+// TestKnownSamplers tests that sampler IDs are listed in native order.
+func TestKnownSamplers(t *testing.T) {
+	known := KnownSamplers()
+	if len(known) != 11 || known[0] != SamplerTemperature || known[10] != SamplerMinP {
+		t.Errorf("Unexpected known samplers: %v", known)
+	}
+}
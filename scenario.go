@@ -107,7 +107,7 @@ type ScenarioSettings struct {
 	DynamicPenaltyRange bool              `json:"dynamicPenaltyRange,omitempty"`
 	PrefixMode          int               `json:"prefixMode,omitempty"`
 	Mode                int               `json:"mode,omitempty"`
-	Model               string            `json:"model,omitempty"`
+	Model               Model             `json:"model,omitempty"`
 }
 
 // GenerationParams contains sampler settings.
@@ -173,7 +173,7 @@ type MessageSettings struct {
 // NewScenario creates a new scenario with sensible defaults for GLM-4.
 func NewScenario(title string) *Scenario {
 	return &Scenario{
-		ScenarioVersion:  3,
+		ScenarioVersion:  CurrentScenarioVersion,
 		Title:            title,
 		Description:      "",
 		Tags:             []string{},
@@ -187,11 +187,11 @@ func NewScenario(title string) *Scenario {
 			Prefix:        "vanilla",
 			PrefixMode:    0,
 			Mode:          1, // Adventure mode
-			Model:         "glm-4-6",
+			Model:         ModelGLM46,
 			Parameters:    DefaultGenerationParams(),
 		},
 		Lorebook: Lorebook{
-			Version:    6,
+			Version:    CurrentLorebookVersion,
 			Entries:    []LorebookEntry{},
 			Categories: []Category{},
 			Settings:   LorebookSettings{OrderByKeyLocations: false},
@@ -0,0 +1,302 @@
+package novelai
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Markdown section headings written by ToMarkdown.
+const (
+	mdPrompt       = "Prompt"
+	mdMemory       = "Memory"
+	mdAuthorsNote  = "Author's Note"
+	mdPlaceholders = "Placeholders"
+	mdLorebook     = "Lorebook"
+)
+
+// ToMarkdown renders the scenario as Markdown for review, in the layout
+// read back by ScenarioFromMarkdown:
+//
+//	# <title>
+//	Author: <author>
+//	Tags: <tag>, <tag>
+//
+//	<description>
+//
+//	## Prompt, ## Memory, ## Author's Note
+//	<the text in a fenced code block>
+//
+//	## Placeholders
+//	### <key>
+//	Default: <default value>
+//	Description: <description>
+//
+//	<long description>
+//
+//	## Lorebook
+//	#### <entry name>     entries without a category come first
+//	Keys: `<key>`, `<key>`
+//	Enabled: no           only for disabled entries
+//	<the text in a fenced code block>
+//	### <category name>   followed by the category's entries
+//
+// Empty sections are left out. Settings, bias groups and context
+// configuration are not rendered.
+func (s *Scenario) ToMarkdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", s.Title)
+	if s.Author != "" {
+		fmt.Fprintf(&b, "Author: %s\n", s.Author)
+	}
+	if len(s.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(s.Tags, ", "))
+	}
+	if s.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", s.Description)
+	}
+
+	texts := []struct{ heading, text string }{{mdPrompt, s.Prompt}}
+	if len(s.Context) > 0 {
+		texts = append(texts, struct{ heading, text string }{mdMemory, s.Context[0].Text})
+	}
+	if len(s.Context) > 1 {
+		texts = append(texts, struct{ heading, text string }{mdAuthorsNote, s.Context[1].Text})
+	}
+	for _, t := range texts {
+		if t.text != "" {
+			fmt.Fprintf(&b, "\n## %s\n\n", t.heading)
+			writeFenced(&b, t.text)
+		}
+	}
+
+	if len(s.Placeholders) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n", mdPlaceholders)
+		for _, p := range s.Placeholders {
+			fmt.Fprintf(&b, "\n### %s\n", p.Key)
+			fmt.Fprintf(&b, "Default: %s\n", p.DefaultValue)
+			if p.Description != "" {
+				fmt.Fprintf(&b, "Description: %s\n", p.Description)
+			}
+			if p.LongDescription != "" {
+				fmt.Fprintf(&b, "\n%s\n", p.LongDescription)
+			}
+		}
+	}
+
+	lb := &s.Lorebook
+	if len(lb.Entries) > 0 || len(lb.Categories) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n", mdLorebook)
+		for _, e := range lb.Entries {
+			if e.Category == "" || lb.categoryIndex(e.Category) < 0 {
+				writeMarkdownEntry(&b, e)
+			}
+		}
+		for _, cat := range lb.Categories {
+			fmt.Fprintf(&b, "\n### %s\n", cat.Name)
+			for _, e := range lb.Entries {
+				if e.Category == cat.ID {
+					writeMarkdownEntry(&b, e)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// writeMarkdownEntry renders a lorebook entry for ToMarkdown.
+func writeMarkdownEntry(b *strings.Builder, e LorebookEntry) {
+	fmt.Fprintf(b, "\n#### %s\n", e.DisplayName)
+	if len(e.Keys) > 0 {
+		keys := make([]string, len(e.Keys))
+		for i, k := range e.Keys {
+			keys[i] = "`" + k + "`"
+		}
+		fmt.Fprintf(b, "Keys: %s\n", strings.Join(keys, ", "))
+	}
+	if !e.Enabled {
+		b.WriteString("Enabled: no\n")
+	}
+	if e.Text != "" {
+		b.WriteString("\n")
+		writeFenced(b, e.Text)
+	}
+}
+
+// writeFenced writes text in a fenced code block, with a fence longer than
+// any run of backticks in text. A newline is always added before the
+// closing fence, so that the text reads back exactly.
+func writeFenced(b *strings.Builder, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "%stext\n%s\n%s\n", fence, text, fence)
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,4}) (.*)$`)
+	mdField   = regexp.MustCompile(`^(Author|Tags|Default|Description|Keys|Enabled): ?(.*)$`)
+	mdFence   = regexp.MustCompile("^(`{3,})[^`]*$")
+	mdKey     = regexp.MustCompile("`([^`]*)`")
+)
+
+// ScenarioFromMarkdown reads a scenario from Markdown in the layout written
+// by ToMarkdown, on a best-effort basis: unknown sections and lines are
+// ignored, and what the layout does not hold is left at the NewScenario
+// defaults. Memory and the author's note become the first two context
+// entries. Returns an error if the text has no title heading.
+func ScenarioFromMarkdown(text string) (*Scenario, error) {
+	r := &markdownReader{scanner: bufio.NewScanner(strings.NewReader(text))}
+	r.scanner.Buffer(nil, 1<<24)
+
+	var s *Scenario
+	var section string
+	var placeholder *Placeholder
+	var entry *LorebookEntry
+	var category string
+	var paragraph []string
+	var memory, authorsNote string
+
+	// flush ends the placeholder or entry being read
+	flush := func() {
+		if placeholder != nil {
+			placeholder.LongDescription = strings.TrimSpace(strings.Join(paragraph, "\n"))
+			s.Placeholders = append(s.Placeholders, *placeholder)
+			placeholder = nil
+		}
+		if entry != nil {
+			entry.Category = category
+			s.Lorebook.AddEntry(*entry)
+			entry = nil
+		}
+		if s != nil && section == "" && s.Description == "" {
+			s.Description = strings.TrimSpace(strings.Join(paragraph, "\n"))
+		}
+		paragraph = nil
+	}
+
+	for r.next() {
+		line := r.line
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			level, title := len(m[1]), strings.TrimSpace(m[2])
+			if s == nil {
+				if level == 1 {
+					s = NewScenario(title)
+				}
+				continue
+			}
+			flush()
+			switch level {
+			case 2:
+				section, category = title, ""
+			case 3:
+				switch section {
+				case mdPlaceholders:
+					placeholder = &Placeholder{Key: title}
+				case mdLorebook:
+					category = s.Lorebook.AddCategory(title)
+				}
+			case 4:
+				if section == mdLorebook {
+					e := NewLorebookEntry(title, "")
+					entry = &e
+				}
+			}
+			continue
+		}
+		if s == nil {
+			continue
+		}
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			body := r.fenced(m[1])
+			switch {
+			case entry != nil:
+				entry.Text = body
+			case section == mdPrompt:
+				s.Prompt = body
+			case section == mdMemory:
+				memory = body
+			case section == mdAuthorsNote:
+				authorsNote = body
+			}
+			continue
+		}
+		if m := mdField.FindStringSubmatch(line); m != nil && len(paragraph) == 0 {
+			name, value := m[1], strings.TrimSpace(m[2])
+			switch {
+			case section == "" && name == "Author":
+				s.Author = value
+				continue
+			case section == "" && name == "Tags":
+				for _, tag := range strings.Split(value, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						s.Tags = append(s.Tags, tag)
+					}
+				}
+				continue
+			case placeholder != nil && name == "Default":
+				placeholder.DefaultValue = value
+				continue
+			case placeholder != nil && name == "Description":
+				placeholder.Description = value
+				continue
+			case entry != nil && name == "Keys":
+				for _, k := range mdKey.FindAllStringSubmatch(value, -1) {
+					entry.Keys = append(entry.Keys, k[1])
+				}
+				continue
+			case entry != nil && name == "Enabled":
+				entry.Enabled, _ = parseLenientBool(value)
+				continue
+			}
+		}
+		if strings.TrimSpace(line) != "" || len(paragraph) > 0 {
+			paragraph = append(paragraph, line)
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading markdown: %w", err)
+	}
+	if s == nil {
+		return nil, fmt.Errorf("error reading markdown: no scenario title")
+	}
+	flush()
+
+	if memory != "" || authorsNote != "" {
+		s.Context = []ContextEntry{
+			{Text: memory, ContextCfg: MemoryContextConfig()},
+			{Text: authorsNote, ContextCfg: AuthorsNoteContextConfig()},
+		}
+	}
+	return s, nil
+}
+
+// markdownReader reads the lines of a Markdown document.
+type markdownReader struct {
+	scanner *bufio.Scanner
+	line    string
+}
+
+// next reads the next line, reporting false at the end.
+func (r *markdownReader) next() bool {
+	if !r.scanner.Scan() {
+		return false
+	}
+	r.line = r.scanner.Text()
+	return true
+}
+
+// fenced reads the body of a code block up to its closing fence, or to
+// the end of the document if it is not closed.
+func (r *markdownReader) fenced(fence string) string {
+	var lines []string
+	for r.next() {
+		if r.line == fence {
+			break
+		}
+		lines = append(lines, r.line)
+	}
+	return strings.Join(lines, "\n")
+}
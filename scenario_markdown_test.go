@@ -0,0 +1,122 @@
+package novelai
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// markdownScenario returns a scenario using every part of the Markdown
+// layout.
+func markdownScenario(t *testing.T) *Scenario {
+	t.Helper()
+	s := NewScenario("The Lighthouse")
+	s.Author = "wbrown"
+	s.Tags = []string{"mystery", "sea"}
+	s.Description = "A keeper's last night.\n\nBring a coat."
+	s.Prompt = "The lamp went out at ${time}.\n"
+	s.Context = []ContextEntry{
+		{Text: "${name} keeps the lighthouse.", ContextCfg: MemoryContextConfig()},
+		{Text: "[ Style: gothic ]", ContextCfg: AuthorsNoteContextConfig()},
+	}
+	s.Placeholders = []Placeholder{
+		{Key: "name", Description: "Keeper's name", DefaultValue: "Ada", LongDescription: "Used throughout."},
+		{Key: "time", Description: "", DefaultValue: "midnight"},
+	}
+	people := s.Lorebook.AddCategory("People")
+	if _, err := s.Lorebook.AddEntry(NewLorebookEntry("The Sea", "Cold and grey.", "sea", "ocean")); err != nil {
+		t.Fatal(err)
+	}
+	ghost := NewLorebookEntry("Ghost", "Speaks in ```code``` sometimes.", "ghost")
+	ghost.Category = people
+	ghost.Enabled = false
+	if _, err := s.Lorebook.AddEntry(ghost); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScenarioToMarkdown(t *testing.T) {
+	md := markdownScenario(t).ToMarkdown()
+	for _, want := range []string{
+		"# The Lighthouse\nAuthor: wbrown\nTags: mystery, sea\n\nA keeper's last night.\n\nBring a coat.\n",
+		"## Prompt\n\n```text\nThe lamp went out at ${time}.\n\n```\n",
+		"## Memory\n\n```text\n${name} keeps the lighthouse.\n```\n",
+		"## Author's Note\n\n```text\n[ Style: gothic ]\n```\n",
+		"### name\nDefault: Ada\nDescription: Keeper's name\n\nUsed throughout.\n",
+		"## Lorebook\n\n#### The Sea\nKeys: `sea`, `ocean`\n\n```text\nCold and grey.\n```\n",
+		"### People\n\n#### Ghost\nKeys: `ghost`\nEnabled: no\n\n````text\nSpeaks in ```code``` sometimes.\n````\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+
+	empty := NewScenario("Empty").ToMarkdown()
+	if empty != "# Empty\n" {
+		t.Errorf("empty scenario markdown = %q", empty)
+	}
+}
+
+func TestScenarioFromMarkdownRoundTrip(t *testing.T) {
+	s := markdownScenario(t)
+	got, err := ScenarioFromMarkdown(s.ToMarkdown())
+	if err != nil {
+		t.Fatalf("ScenarioFromMarkdown: %v", err)
+	}
+	if got.Title != s.Title || got.Author != s.Author || got.Description != s.Description || got.Prompt != s.Prompt {
+		t.Errorf("header = %q %q %q %q", got.Title, got.Author, got.Description, got.Prompt)
+	}
+	if !reflect.DeepEqual(got.Tags, s.Tags) {
+		t.Errorf("Tags = %v, want %v", got.Tags, s.Tags)
+	}
+	if !reflect.DeepEqual(got.Context, s.Context) {
+		t.Errorf("Context = %+v, want %+v", got.Context, s.Context)
+	}
+	if !reflect.DeepEqual(got.Placeholders, s.Placeholders) {
+		t.Errorf("Placeholders = %+v, want %+v", got.Placeholders, s.Placeholders)
+	}
+	if len(got.Lorebook.Categories) != 1 || got.Lorebook.Categories[0].Name != "People" {
+		t.Fatalf("Categories = %+v", got.Lorebook.Categories)
+	}
+	if len(got.Lorebook.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got.Lorebook.Entries))
+	}
+	for i, e := range got.Lorebook.Entries {
+		want := s.Lorebook.Entries[i]
+		if e.DisplayName != want.DisplayName || e.Text != want.Text || e.Enabled != want.Enabled ||
+			!reflect.DeepEqual(e.Keys, want.Keys) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want)
+		}
+	}
+	if got.Lorebook.Entries[0].Category != "" {
+		t.Error("uncategorized entry got a category")
+	}
+	if got.Lorebook.Entries[1].Category != got.Lorebook.Categories[0].ID {
+		t.Error("entry not in its category")
+	}
+}
+
+func TestScenarioFromMarkdownLenient(t *testing.T) {
+	md := "Notes before the title are ignored.\n\n" +
+		"# Hand Written\n\nA story.\n\n" +
+		"## Appendix\n\nUnknown sections are ignored.\n\n" +
+		"## Lorebook\n\n#### Town\nKeys: `town`\n\n```\nA small town.\n"
+	s, err := ScenarioFromMarkdown(md)
+	if err != nil {
+		t.Fatalf("ScenarioFromMarkdown: %v", err)
+	}
+	if s.Title != "Hand Written" || s.Description != "A story." {
+		t.Errorf("Title, Description = %q, %q", s.Title, s.Description)
+	}
+	if len(s.Context) != 0 {
+		t.Errorf("Context = %+v, want none", s.Context)
+	}
+	if len(s.Lorebook.Entries) != 1 || s.Lorebook.Entries[0].Text != "A small town." || !s.Lorebook.Entries[0].Enabled {
+		t.Errorf("Entries = %+v", s.Lorebook.Entries)
+	}
+
+	if _, err := ScenarioFromMarkdown("no title here"); err == nil {
+		t.Error("ScenarioFromMarkdown without a title succeeded")
+	}
+}
@@ -0,0 +1,80 @@
+package novelai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Current schema versions produced by NewScenario and accepted by
+// MigrateScenario.
+const (
+	CurrentScenarioVersion = 3
+	CurrentLorebookVersion = 6
+)
+
+// DefaultSearchRange is the number of characters of story text, counted
+// back from the end, searched for lorebook keys.
+const DefaultSearchRange = 1000
+
+// samplerIDs maps the native API's numeric sampler identifiers to the
+// string IDs used by scenario files.
+var samplerIDs = map[int]string{
+	0:  SamplerTemperature,
+	1:  SamplerTopK,
+	2:  SamplerTopP,
+	3:  SamplerTFS,
+	4:  SamplerTopA,
+	5:  SamplerTypicalP,
+	6:  SamplerCFG,
+	7:  SamplerTopG,
+	8:  SamplerMirostat,
+	9:  SamplerMath1,
+	10: SamplerMinP,
+}
+
+// MigrateScenario checks the scenarioVersion and lorebookVersion of a
+// scenario document before it is decoded with json.Unmarshal or
+// UnmarshalScenario, returning an error if either is newer than this
+// package supports.
+//
+// No upgrades between versions are defined yet: each needs a fixture
+// exported at its source version to show the schema it assumes. Documents
+// at older versions are returned unchanged, and UnmarshalScenario's report
+// lists the fields it does not know, such as the top-level memory of early
+// scenarios, rather than dropping them silently. Returns the document and
+// a description of each upgrade applied.
+func MigrateScenario(data []byte) (migrated []byte, applied []string, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("error parsing scenario JSON: %w", err)
+	}
+	if version := docInt(doc, "scenarioVersion"); version > CurrentScenarioVersion {
+		return nil, nil, fmt.Errorf("scenario version %d is newer than supported version %d",
+			version, CurrentScenarioVersion)
+	}
+	lorebook, _ := doc["lorebook"].(map[string]any)
+	if version := docInt(lorebook, "lorebookVersion"); version > CurrentLorebookVersion {
+		return nil, nil, fmt.Errorf("lorebook version %d is newer than supported version %d",
+			version, CurrentLorebookVersion)
+	}
+	return data, nil, nil
+}
+
+// docInt reads an integer field from a decoded document, defaulting to 0.
+func docInt(doc map[string]any, key string) int {
+	switch v := doc[key].(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return int(f)
+		}
+	case float64:
+		return int(v)
+	}
+	return 0
+}
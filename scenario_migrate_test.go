@@ -0,0 +1,67 @@
+package novelai
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const legacyScenario = `{
+	"scenarioVersion": 0,
+	"title": "Old Story",
+	"prompt": "Once upon a time.",
+	"memory": "It is winter.",
+	"context": [{"text": "A cold land."}],
+	"lorebook": {"lorebookVersion": 1, "entries": [{"text": "The castle is old.", "keys": ["castle"]}]}
+}`
+
+// TestMigrateScenarioLegacy tests that older documents are passed to the
+// parser unchanged, which reports the fields it does not know.
+func TestMigrateScenarioLegacy(t *testing.T) {
+	data, applied, err := MigrateScenario([]byte(legacyScenario))
+	if err != nil {
+		t.Fatalf("MigrateScenario failed: %v", err)
+	}
+	if len(applied) != 0 || string(data) != legacyScenario {
+		t.Errorf("Expected the document unchanged, got %v", applied)
+	}
+
+	s, report, err := UnmarshalScenario(data, ParseLenient)
+	if err != nil {
+		t.Fatalf("UnmarshalScenario failed: %v", err)
+	}
+	if len(s.Context) != 1 || s.Context[0].Text != "A cold land." || len(s.Lorebook.Entries) != 1 {
+		t.Errorf("Expected context and lorebook kept, got %+v", s)
+	}
+	if ignored := report.IgnoredFields(); len(ignored) != 1 || ignored[0] != "memory" {
+		t.Errorf("Expected memory reported as ignored, got %v", ignored)
+	}
+	if _, _, err := UnmarshalScenario(data, ParseStrict); err == nil {
+		t.Error("Expected strict parsing to reject the unknown field")
+	}
+}
+
+// TestMigrateScenarioCurrent tests that current documents pass through unchanged.
+func TestMigrateScenarioCurrent(t *testing.T) {
+	original, err := os.ReadFile(filepath.Join("testdata", "scenarios", "lighthouse.scenario"))
+	if err != nil {
+		t.Fatalf("Failed to read scenario: %v", err)
+	}
+	data, applied, err := MigrateScenario(original)
+	if err != nil {
+		t.Fatalf("MigrateScenario failed: %v", err)
+	}
+	if len(applied) != 0 || string(data) != string(original) {
+		t.Errorf("Expected no migration, got %v", applied)
+	}
+
+	future, _ := json.Marshal(map[string]any{"scenarioVersion": CurrentScenarioVersion + 1})
+	if _, _, err := MigrateScenario(future); err == nil {
+		t.Error("Expected error for scenario newer than supported")
+	}
+	future, _ = json.Marshal(map[string]any{"lorebook": map[string]any{"lorebookVersion": CurrentLorebookVersion + 1}})
+	if _, _, err := MigrateScenario(future); err == nil {
+		t.Error("Expected error for lorebook newer than supported")
+	}
+}
@@ -0,0 +1,385 @@
+package novelai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScenarioParseMode selects how UnmarshalScenario treats malformed input.
+type ScenarioParseMode int
+
+const (
+	// ParseLenient ignores unknown fields, coerces mistyped values where the
+	// intent is clear, drops values that cannot be coerced, and records every
+	// adjustment in the ParseReport.
+	ParseLenient ScenarioParseMode = iota
+	// ParseStrict fails on the first unknown field or mistyped value.
+	ParseStrict
+)
+
+// ParseIssueKind classifies a problem found while parsing a scenario.
+type ParseIssueKind string
+
+const (
+	// IssueUnknownField is a field not present in the scenario schema.
+	IssueUnknownField ParseIssueKind = "unknown_field"
+	// IssueCoerced is a value converted to the schema's type (e.g. "1.0" to 1.0).
+	IssueCoerced ParseIssueKind = "coerced"
+	// IssueDropped is a value that could not be converted and was discarded.
+	IssueDropped ParseIssueKind = "dropped"
+)
+
+// ParseIssue is a single problem found while parsing a scenario.
+type ParseIssue struct {
+	// Path locates the value, e.g. "lorebook.entries[2].keys".
+	Path    string         `json:"path"`
+	Kind    ParseIssueKind `json:"kind"`
+	Message string         `json:"message"`
+}
+
+// String formats the issue for display.
+func (i ParseIssue) String() string {
+	return fmt.Sprintf("%s: %s (%s)", i.Path, i.Message, i.Kind)
+}
+
+// ParseReport lists the issues found while parsing a scenario.
+type ParseReport struct {
+	Issues []ParseIssue `json:"issues"`
+}
+
+// HasIssues reports whether any issues were found.
+func (r *ParseReport) HasIssues() bool {
+	return len(r.Issues) > 0
+}
+
+// IgnoredFields returns the paths of unknown fields that were ignored.
+func (r *ParseReport) IgnoredFields() []string {
+	var paths []string
+	for _, issue := range r.Issues {
+		if issue.Kind == IssueUnknownField {
+			paths = append(paths, issue.Path)
+		}
+	}
+	return paths
+}
+
+// ReadScenarioFile reads the scenario file at path, checking its schema
+// versions with MigrateScenario first. See UnmarshalScenario for mode and
+// the report.
+func ReadScenarioFile(path string, mode ScenarioParseMode) (*Scenario, *ParseReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading scenario: %w", err)
+	}
+	migrated, _, err := MigrateScenario(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return UnmarshalScenario(migrated, mode)
+}
+
+// UnmarshalScenario parses a scenario file.
+//
+// In ParseLenient mode the returned report lists every field that was
+// ignored, coerced or dropped so authors can fix their files; an error is
+// only returned if data is not valid JSON. In ParseStrict mode the first
+// issue is returned as an error, along with the report so far.
+func UnmarshalScenario(data []byte, mode ScenarioParseMode) (*Scenario, *ParseReport, error) {
+	report := &ParseReport{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, report, fmt.Errorf("error parsing scenario JSON: %w", err)
+	}
+
+	p := &scenarioParser{mode: mode, report: report}
+	cleaned, ok := p.convert(raw, reflect.TypeOf(Scenario{}), "")
+	if p.err != nil {
+		return nil, report, p.err
+	}
+	if !ok {
+		return nil, report, fmt.Errorf("error parsing scenario: top level is not an object")
+	}
+
+	normalized, err := json.Marshal(cleaned)
+	if err != nil {
+		return nil, report, fmt.Errorf("error normalizing scenario: %w", err)
+	}
+	var s Scenario
+	if err := json.Unmarshal(normalized, &s); err != nil {
+		return nil, report, fmt.Errorf("error decoding scenario: %w", err)
+	}
+	return &s, report, nil
+}
+
+// scenarioParser walks a generic JSON tree against a Go type, producing a
+// tree that decodes cleanly into that type.
+type scenarioParser struct {
+	mode   ScenarioParseMode
+	report *ParseReport
+	err    error
+}
+
+// issue records a problem. In strict mode the first issue becomes the error.
+func (p *scenarioParser) issue(path string, kind ParseIssueKind, format string, args ...any) {
+	if path == "" {
+		path = "$"
+	}
+	issue := ParseIssue{Path: path, Kind: kind, Message: fmt.Sprintf(format, args...)}
+	p.report.Issues = append(p.report.Issues, issue)
+	if p.mode == ParseStrict && p.err == nil {
+		p.err = fmt.Errorf("invalid scenario: %s", issue)
+	}
+}
+
+// failed reports whether strict parsing has already failed.
+func (p *scenarioParser) failed() bool {
+	return p.err != nil
+}
+
+// convert returns v adjusted to decode into t, or false if v must be dropped.
+func (p *scenarioParser) convert(v any, t reflect.Type, path string) (any, bool) {
+	if v == nil {
+		return nil, true
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return p.convert(v, t.Elem(), path)
+	case reflect.Interface:
+		return v, true
+	case reflect.Struct:
+		return p.convertStruct(v, t, path)
+	case reflect.Slice:
+		return p.convertSlice(v, t, path)
+	case reflect.Map:
+		if _, ok := v.(map[string]any); ok {
+			return v, true
+		}
+		p.issue(path, IssueDropped, "expected object, got %s", jsonKind(v))
+		return nil, false
+	case reflect.String:
+		switch val := v.(type) {
+		case string:
+			return val, true
+		case json.Number:
+			p.issue(path, IssueCoerced, "expected string, got number %s", val)
+			return val.String(), true
+		case bool:
+			p.issue(path, IssueCoerced, "expected string, got boolean %t", val)
+			return strconv.FormatBool(val), true
+		}
+	case reflect.Bool:
+		switch val := v.(type) {
+		case bool:
+			return val, true
+		case string:
+			if b, ok := parseLenientBool(val); ok {
+				p.issue(path, IssueCoerced, "expected boolean, got string %q", val)
+				return b, true
+			}
+		case json.Number:
+			if f, err := val.Float64(); err == nil && (f == 0 || f == 1) {
+				p.issue(path, IssueCoerced, "expected boolean, got number %s", val)
+				return f == 1, true
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return p.convertInt(v, path)
+	case reflect.Float32, reflect.Float64:
+		switch val := v.(type) {
+		case json.Number:
+			if _, err := val.Float64(); err == nil {
+				return val, true
+			}
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				p.issue(path, IssueCoerced, "expected number, got string %q", val)
+				return f, true
+			}
+		}
+	}
+	p.issue(path, IssueDropped, "expected %s, got %s", typeDescription(t), jsonKind(v))
+	return nil, false
+}
+
+// convertStruct maps object keys onto struct fields by their JSON names.
+func (p *scenarioParser) convertStruct(v any, t reflect.Type, path string) (any, bool) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		p.issue(path, IssueDropped, "expected object, got %s", jsonKind(v))
+		return nil, false
+	}
+
+	fields := jsonFields(t)
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]any, len(obj))
+	for _, key := range keys {
+		if p.failed() {
+			break
+		}
+		fieldPath := joinPath(path, key)
+		name := key
+		field, ok := fields[key]
+		if !ok {
+			if canonical, found := matchFieldFold(fields, key); found {
+				p.issue(fieldPath, IssueCoerced, "field name should be %q", canonical)
+				name, field, ok = canonical, fields[canonical], true
+			}
+		}
+		if !ok {
+			p.issue(fieldPath, IssueUnknownField, "unknown field ignored")
+			continue
+		}
+		if converted, ok := p.convert(obj[key], field.Type, fieldPath); ok {
+			out[name] = converted
+		}
+	}
+	return out, true
+}
+
+// convertSlice converts each element, wrapping a lone value in a slice.
+func (p *scenarioParser) convertSlice(v any, t reflect.Type, path string) (any, bool) {
+	arr, ok := v.([]any)
+	if !ok {
+		p.issue(path, IssueCoerced, "expected array, got %s; wrapped in array", jsonKind(v))
+		if p.failed() {
+			return nil, false
+		}
+		arr = []any{v}
+	}
+	out := make([]any, 0, len(arr))
+	for i, elem := range arr {
+		if p.failed() {
+			break
+		}
+		if converted, ok := p.convert(elem, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); ok {
+			out = append(out, converted)
+		}
+	}
+	return out, true
+}
+
+// convertInt accepts integral numbers, coercing floats and numeric strings.
+func (p *scenarioParser) convertInt(v any, path string) (any, bool) {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, true
+		}
+		parsed, err := val.Float64()
+		if err != nil {
+			break
+		}
+		p.issue(path, IssueCoerced, "expected integer, got %s", val)
+		return int64(math.Round(parsed)), true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			break
+		}
+		p.issue(path, IssueCoerced, "expected integer, got string %q", val)
+		return int64(math.Round(parsed)), true
+	}
+	p.issue(path, IssueDropped, "expected integer, got %s", jsonKind(v))
+	return nil, false
+}
+
+// jsonFields indexes a struct's fields by JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// matchFieldFold finds a field whose JSON name matches key case-insensitively.
+func matchFieldFold(fields map[string]reflect.StructField, key string) (string, bool) {
+	for name := range fields {
+		if strings.EqualFold(name, key) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// parseLenientBool accepts common spellings of boolean values.
+func parseLenientBool(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "1", "yes", "on":
+		return true, true
+	case "false", "0", "no", "off", "":
+		return false, true
+	}
+	return false, false
+}
+
+// joinPath appends a field name to a dotted path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonKind names the JSON type of a decoded value.
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// typeDescription names a Go type in JSON terms.
+func typeDescription(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return t.String()
+}
@@ -0,0 +1,108 @@
+package novelai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const messyScenario = `{
+	"scenarioVersion": "3",
+	"title": "Messy",
+	"prompt": "Once upon a time",
+	"tags": "fantasy",
+	"editorNotes": "not part of the schema",
+	"settings": {
+		"parameters": {"temperature": "0.8", "top_k": 40.0, "max_length": "bad"},
+		"trimResponses": "yes"
+	},
+	"lorebook": {
+		"lorebookVersion": 6,
+		"entries": [{"text": "A dragon", "keys": ["dragon", 7], "Enabled": 1, "color": "red"}]
+	}
+}`
+
+// TestUnmarshalScenarioLenient tests coercion and reporting in lenient mode.
+func TestUnmarshalScenarioLenient(t *testing.T) {
+	s, report, err := UnmarshalScenario([]byte(messyScenario), ParseLenient)
+	if err != nil {
+		t.Fatalf("UnmarshalScenario failed: %v", err)
+	}
+
+	if s.ScenarioVersion != 3 {
+		t.Errorf("Expected coerced scenarioVersion 3, got %d", s.ScenarioVersion)
+	}
+	if len(s.Tags) != 1 || s.Tags[0] != "fantasy" {
+		t.Errorf("Expected tags [fantasy], got %v", s.Tags)
+	}
+	if s.Settings.Parameters.Temperature != 0.8 || s.Settings.Parameters.TopK != 40 {
+		t.Errorf("Expected coerced parameters, got %+v", s.Settings.Parameters)
+	}
+	if !s.Settings.TrimResponses {
+		t.Error("Expected trimResponses coerced to true")
+	}
+	entry := s.Lorebook.Entries[0]
+	if !entry.Enabled {
+		t.Error("Expected miscased Enabled field to be applied")
+	}
+	if len(entry.Keys) != 2 || entry.Keys[1] != "7" {
+		t.Errorf("Expected keys [dragon 7], got %v", entry.Keys)
+	}
+
+	ignored := strings.Join(report.IgnoredFields(), ",")
+	if ignored != "editorNotes,lorebook.entries[0].color" {
+		t.Errorf("Unexpected ignored fields: %s", ignored)
+	}
+
+	var dropped []string
+	for _, issue := range report.Issues {
+		if issue.Kind == IssueDropped {
+			dropped = append(dropped, issue.Path)
+		}
+	}
+	if len(dropped) != 1 || dropped[0] != "settings.parameters.max_length" {
+		t.Errorf("Expected max_length to be dropped, got %v", dropped)
+	}
+}
+
+// TestUnmarshalScenarioStrict tests that strict mode fails on the first issue.
+func TestUnmarshalScenarioStrict(t *testing.T) {
+	_, report, err := UnmarshalScenario([]byte(messyScenario), ParseStrict)
+	if err == nil {
+		t.Fatal("Expected strict parsing to fail")
+	}
+	if len(report.Issues) != 1 {
+		t.Errorf("Expected strict mode to stop at the first issue, got %d", len(report.Issues))
+	}
+	if !strings.Contains(err.Error(), "editorNotes") {
+		t.Errorf("Expected error to name the offending field, got %v", err)
+	}
+
+	_, _, err = UnmarshalScenario([]byte(`{"title": `), ParseLenient)
+	if err == nil {
+		t.Error("Expected error for invalid JSON in lenient mode")
+	}
+}
+
+// TestUnmarshalScenarioExports tests that well-formed exports parse strictly.
+func TestUnmarshalScenarioExports(t *testing.T) {
+	paths, _ := filepath.Glob(filepath.Join("testdata", "scenarios", "*.scenario"))
+	if len(paths) == 0 {
+		t.Fatal("No scenario exports found in testdata")
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		s, report, err := UnmarshalScenario(data, ParseStrict)
+		if err != nil {
+			t.Errorf("%s: strict parse failed: %v", path, err)
+			continue
+		}
+		if report.HasIssues() || s.Title == "" {
+			t.Errorf("%s: unexpected issues %v", path, report.Issues)
+		}
+	}
+}
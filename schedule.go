@@ -0,0 +1,73 @@
+package novelai
+
+// Schedule changes the sampling of each segment of SendUntilDone and
+// SendStreamingUntilDone, such as cooling the temperature or raising the
+// repetition penalty as a long generation continues, to counter the drift
+// into repetition and incoherence of very long replies.
+type Schedule struct {
+	// Segments, if set, are overrides for the segments in turn, the first
+	// applying to the first request. The last applies to any later
+	// segments. They take precedence over the call's sampling.
+	Segments []SamplingProfile
+	// TemperatureStep is added to the temperature for each continuation,
+	// such as -0.05 to cool down as the reply grows. TemperatureLimit, if
+	// set, is the value the steps stop at.
+	TemperatureStep  float64
+	TemperatureLimit float64
+	// RepetitionPenaltyStep is added to the repetition penalty for each
+	// continuation. RepetitionPenaltyLimit, if set, is the value the steps
+	// stop at.
+	RepetitionPenaltyStep  float64
+	RepetitionPenaltyLimit float64
+	// Policy, if set, adjusts the sampling between segments from how the
+	// last one went, such as from its entropy with EntropyPolicy. Its
+	// adjustments take precedence over the other fields. Log probabilities
+	// are requested for it, DefaultPolicyLogprobs per token unless
+	// Settings.Logprobs is set.
+	Policy SamplingPolicy
+}
+
+// Overrides returns the overrides for segment n of a reply, 0 being the
+// first request, given the settings and the call's overrides. Steps apply
+// to the value the segment would otherwise use; a temperature or penalty
+// left to the server default counts as 1.
+func (s *Schedule) Overrides(settings *Settings, overrides SamplingProfile, n int) SamplingProfile {
+	if len(s.Segments) > 0 {
+		overrides = overrides.Merge(s.Segments[min(n, len(s.Segments)-1)])
+	}
+	if n == 0 {
+		return overrides
+	}
+	effective := settingsProfile(settings).Merge(overrides)
+	if s.TemperatureStep != 0 {
+		overrides.Temperature = Float64(scheduleStep(effective.Temperature,
+			s.TemperatureStep, s.TemperatureLimit, n))
+	}
+	if s.RepetitionPenaltyStep != 0 {
+		overrides.RepetitionPenalty = Float64(scheduleStep(effective.RepetitionPenalty,
+			s.RepetitionPenaltyStep, s.RepetitionPenaltyLimit, n))
+	}
+	return overrides
+}
+
+// scheduleStep returns v, or 1 if unset, moved n steps towards limit.
+func scheduleStep(v *float64, step, limit float64, n int) float64 {
+	value := 1.0
+	if v != nil {
+		value = *v
+	}
+	value += step * float64(n)
+	if limit != 0 && (step > 0 && value > limit || step < 0 && value < limit) {
+		value = limit
+	}
+	return value
+}
+
+// segmentOverrides returns the overrides for segment n of a continued
+// reply, following Schedule if set.
+func (c *Conversation) segmentOverrides(overrides SamplingProfile, n int) SamplingProfile {
+	if c.Schedule == nil {
+		return overrides
+	}
+	return c.Schedule.Overrides(&c.Settings, overrides, n)
+}
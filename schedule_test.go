@@ -0,0 +1,111 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+func TestScheduleOverrides(t *testing.T) {
+	settings := Settings{Temperature: 1.2}
+	s := &Schedule{
+		TemperatureStep:        -0.25,
+		TemperatureLimit:       0.8,
+		RepetitionPenaltyStep:  0.05,
+		RepetitionPenaltyLimit: 1.12,
+	}
+	tests := []struct {
+		n           int
+		temperature *float64
+		penalty     *float64
+	}{
+		{0, nil, nil},
+		{1, Float64(0.95), Float64(1.05)},
+		{2, Float64(0.8), Float64(1.1)},
+		{5, Float64(0.8), Float64(1.12)},
+	}
+	for _, tt := range tests {
+		p := s.Overrides(&settings, SamplingProfile{}, tt.n)
+		if !floatPtrNear(p.Temperature, tt.temperature) || !floatPtrNear(p.RepetitionPenalty, tt.penalty) {
+			t.Errorf("Segment %d: got %v, %v", tt.n, derefFloat(p.Temperature), derefFloat(p.RepetitionPenalty))
+		}
+	}
+
+	// Steps start from the call's overrides, and segments replace them
+	s = &Schedule{
+		Segments:        []SamplingProfile{{TopP: Float64(0.9)}, {TopP: Float64(0.8), Temperature: Float64(0.7)}},
+		TemperatureStep: -0.1,
+	}
+	call := SamplingProfile{Temperature: Float64(1)}
+	if p := s.Overrides(&settings, call, 0); *p.Temperature != 1 || *p.TopP != 0.9 {
+		t.Errorf("Segment 0: got %+v", p)
+	}
+	if p := s.Overrides(&settings, call, 3); !floatPtrNear(p.Temperature, Float64(0.4)) || *p.TopP != 0.8 {
+		t.Errorf("Segment 3: got %v, %v", derefFloat(p.Temperature), *p.TopP)
+	}
+}
+
+// floatPtrNear reports whether a and b are both unset or nearly equal.
+func floatPtrNear(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a-*b < 1e-9 && *b-*a < 1e-9
+}
+
+func TestSendUntilDoneSchedule(t *testing.T) {
+	var mu sync.Mutex
+	var reqs []completionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		reqs = append(reqs, req)
+		n := len(reqs)
+		mu.Unlock()
+		finish := "length"
+		if n%3 == 0 {
+			finish = "stop"
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"text\":\"part \",\"finish_reason\":%q}]}\n\ndata: [DONE]\n\n", finish)
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"text":"part ","finish_reason":%q}]}`, finish)
+	}))
+	defer server.Close()
+	conv := NewConversation("")
+	conv.ApiToken = "test-token"
+	conv.Endpoint = server.URL
+	conv.Settings.Temperature = 1
+	conv.Schedule = &Schedule{TemperatureStep: -0.2, RepetitionPenaltyStep: 0.1}
+
+	if _, _, _, _, _, _, err := conv.SendUntilDone("Write", llmapi.Sampling{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, _, _, err := conv.SendStreamingUntilDone("More", llmapi.Sampling{Temperature: 0.9}, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ temperature, penalty *float64 }{
+		{Float64(1), nil},
+		{Float64(0.8), Float64(1.1)},
+		{Float64(0.6), Float64(1.2)},
+		{Float64(0.9), nil},
+		{Float64(0.7), Float64(1.1)},
+		{Float64(0.5), Float64(1.2)},
+	}
+	if len(reqs) != len(want) {
+		t.Fatalf("Expected %d requests, got %d", len(want), len(reqs))
+	}
+	for i, w := range want {
+		if !floatPtrNear(reqs[i].Temperature, w.temperature) || !floatPtrNear(reqs[i].RepetitionPenalty, w.penalty) {
+			t.Errorf("Request %d: got %v, %v", i, derefFloat(reqs[i].Temperature), derefFloat(reqs[i].RepetitionPenalty))
+		}
+	}
+}
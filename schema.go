@@ -0,0 +1,105 @@
+package novelai
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// schemaDialect is the JSON Schema version of the published schemas.
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SnapshotSchema returns the JSON Schema of the conversation save format:
+// a Snapshot, as FileSessionStore saves it. Saves of older versions are
+// upgraded with migrate.Snapshot before they match it. The schema is also
+// published as schema/snapshot.schema.json.
+func SnapshotSchema() []byte {
+	return typeSchema(reflect.TypeOf(Snapshot{}), "NovelAI conversation snapshot")
+}
+
+// ScenarioSchema returns the JSON Schema of a Scenario as this package
+// writes it. Scenarios at older versions may not match it; see
+// MigrateScenario. The schema is also published as
+// schema/scenario.schema.json.
+func ScenarioSchema() []byte {
+	return typeSchema(reflect.TypeOf(Scenario{}), "NovelAI scenario")
+}
+
+// typeSchema generates the schema of the JSON encoding of t. Named structs
+// become definitions, so recursive types are described.
+func typeSchema(t reflect.Type, title string) []byte {
+	b := &schemaBuilder{defs: map[string]any{}}
+	root := b.schema(t)
+	doc := map[string]any{
+		"$schema": schemaDialect,
+		"title":   title,
+		"$defs":   b.defs,
+	}
+	for k, v := range root {
+		doc[k] = v
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic("novelai: error encoding schema: " + err.Error())
+	}
+	return append(data, '\n')
+}
+
+// schemaBuilder collects the definitions of a schema.
+type schemaBuilder struct {
+	defs map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of values of type t. Slices, maps and pointers
+// may be null, as encoding/json writes them when nil.
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]any{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return map[string]any{"anyOf": []any{b.schema(t.Elem()), map[string]any{"type": "null"}}}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": []string{"array", "null"}, "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": []string{"object", "null"}, "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.defs[t.Name()]; !ok {
+			// Reserve the name before recursing into the fields
+			b.defs[t.Name()] = nil
+			b.defs[t.Name()] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// object returns the schema of struct t. No property is required, as
+// missing fields decode as zero values: saves from before a field was added
+// still load.
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	for name, f := range jsonFields(t) {
+		properties[name] = b.schema(f.Type)
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
@@ -0,0 +1,65 @@
+package novelai
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPublishedSchemas checks the published schemas match the types. Run
+// with NOVELAI_UPDATE_GOLDEN=1 to regenerate them.
+func TestPublishedSchemas(t *testing.T) {
+	schemas := map[string][]byte{
+		"snapshot.schema.json": SnapshotSchema(),
+		"scenario.schema.json": ScenarioSchema(),
+	}
+	for name, got := range schemas {
+		path := filepath.Join("schema", name)
+		if os.Getenv("NOVELAI_UPDATE_GOLDEN") == "1" {
+			if err := os.WriteFile(path, got, 0o644); err != nil {
+				t.Fatalf("error writing %s: %v", path, err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("error reading %s: %v", path, err)
+		}
+		if string(want) != string(got) {
+			t.Errorf("%s is out of date; run the tests with NOVELAI_UPDATE_GOLDEN=1", path)
+		}
+	}
+}
+
+func TestSnapshotSchema(t *testing.T) {
+	var schema struct {
+		Ref  string `json:"$ref"`
+		Defs map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(SnapshotSchema(), &schema); err != nil {
+		t.Fatalf("Invalid schema JSON: %v", err)
+	}
+	if schema.Ref != "#/$defs/Snapshot" {
+		t.Errorf("$ref = %q", schema.Ref)
+	}
+
+	// The schema describes every property of a saved snapshot
+	conv := NewConversation("sys")
+	conv.Messages = append(conv.Messages, Message{Role: "user", Content: "Hi"})
+	data, _ := json.Marshal(conv.Snapshot())
+	var saved map[string]json.RawMessage
+	json.Unmarshal(data, &saved)
+	for name := range saved {
+		if _, ok := schema.Defs["Snapshot"].Properties[name]; !ok {
+			t.Errorf("Snapshot property %q missing from schema", name)
+		}
+	}
+	for _, name := range []string{"Message", "Settings", "TurnRecord", "PromptTemplate"} {
+		if _, ok := schema.Defs[name]; !ok {
+			t.Errorf("Definition %s missing", name)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package novelai
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by SessionManager.Do when a session has used
+// up its request allowance.
+var ErrRateLimited = errors.New("session rate limit exceeded")
+
+// SessionStore persists the sessions of a SessionManager, so that evicted
+// sessions and sessions from previous runs can be resumed.
+type SessionStore interface {
+	// Load returns the stored snapshot of session id, or nil if there is
+	// none.
+	Load(id string) (*Snapshot, error)
+	// Save stores the snapshot of session id.
+	Save(id string, s *Snapshot) error
+}
+
+// SessionManager owns the conversations of many sessions, such as one per
+// chat user or channel, keyed by ID. Each session is used by one caller at
+// a time while different sessions run concurrently. The least recently
+// used sessions are evicted once there are more than MaxSessions, after
+// being saved to Store.
+//
+// Set the fields before first use; they must not change afterwards.
+type SessionManager struct {
+	// New creates the conversation for a session, before any stored
+	// snapshot is restored into it. Use it to set what snapshots do not
+	// keep, such as the token, queue and lorebooks. If nil,
+	// NewConversation("") is used.
+	New func(id string) *Conversation
+	// Store, if set, is where sessions are loaded from on first use and
+	// saved to on eviction, Save and Close.
+	Store SessionStore
+	// MaxSessions is how many sessions are kept in memory. If zero, there
+	// is no limit.
+	MaxSessions int
+	// RateBurst and RateInterval limit each session to RateBurst requests
+	// at once, refilled at one per RateInterval. If either is zero, there
+	// is no limit.
+	RateBurst    int
+	RateInterval time.Duration
+	// Clock, if set, replaces SystemClock for refilling the rate limit.
+	Clock Clock
+	// Quota, if set, limits the end user of each call: the user set on
+	// its context with WithQuotaUser, or else the session ID. The tokens
+	// the conversation uses during the call are charged to the user.
+	Quota *Quota
+
+	mu       sync.Mutex
+	sessions map[string]*list.Element
+	lru      list.List
+	// evicting holds sessions removed from memory but not yet saved, so
+	// that they are resumed rather than reloaded from a stale store.
+	evicting map[string]*session
+}
+
+// session is a conversation owned by a SessionManager.
+type session struct {
+	id   string
+	mu   sync.Mutex
+	conv *Conversation
+	// loaded reports whether conv has been created or restored.
+	loaded bool
+	// allowance is the number of requests left, as of refilled.
+	allowance float64
+	refilled  time.Time
+}
+
+// NewSessionManager creates a manager keeping at most maxSessions sessions
+// in memory, saving them to store if it is not nil.
+func NewSessionManager(maxSessions int, store SessionStore) *SessionManager {
+	return &SessionManager{MaxSessions: maxSessions, Store: store}
+}
+
+// Do runs fn with exclusive use of session id's conversation, creating it,
+// or loading it from Store, on first use. The conversation's context is
+// ctx while fn runs. Calls for the same session run one at a time, in no
+// particular order; calls for different sessions run concurrently.
+//
+// If the session is over its rate limit, Do returns ErrRateLimited without
+// calling fn, and if the user is over their Quota, a QuotaError. Errors
+// from fn are returned as is.
+func (m *SessionManager) Do(ctx context.Context, id string, fn func(*Conversation) error) error {
+	s, evicted := m.session(id)
+	if err := m.saveAll(evicted); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.loaded {
+		if err := m.load(s); err != nil {
+			return err
+		}
+	}
+	if !m.allow(s, clockOr(m.Clock).Now()) {
+		return ErrRateLimited
+	}
+	if m.Quota != nil {
+		user, ok := QuotaUser(ctx)
+		if !ok {
+			user = id
+		}
+		if err := m.Quota.Allow(user); err != nil {
+			return err
+		}
+		before := s.conv.Usage
+		defer func() {
+			m.Quota.Record(user, s.conv.Usage.InputTokens-before.InputTokens+
+				s.conv.Usage.OutputTokens-before.OutputTokens)
+		}()
+	}
+	s.conv.Ctx = ctx
+	defer func() { s.conv.Ctx = nil }()
+	return fn(s.conv)
+}
+
+// Len returns the number of sessions in memory.
+func (m *SessionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Evict saves session id to Store, if set, and removes it from memory. It
+// waits for calls using the session to finish. Evicting a session that is
+// not in memory does nothing.
+func (m *SessionManager) Evict(id string) error {
+	m.mu.Lock()
+	el, ok := m.sessions[id]
+	if !ok {
+		m.mu.Unlock()
+		return nil
+	}
+	s := m.remove(el)
+	m.mu.Unlock()
+	return m.saveAll([]*session{s})
+}
+
+// Save saves every session in memory to Store. Sessions in use are saved
+// once their current call finishes.
+func (m *SessionManager) Save() error {
+	if m.Store == nil {
+		return nil
+	}
+	m.mu.Lock()
+	var all []*session
+	for el := m.lru.Front(); el != nil; el = el.Next() {
+		all = append(all, el.Value.(*session))
+	}
+	m.mu.Unlock()
+	var errs []error
+	for _, s := range all {
+		s.mu.Lock()
+		errs = append(errs, m.save(s))
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Close saves every session to Store and removes all sessions from memory.
+func (m *SessionManager) Close() error {
+	m.mu.Lock()
+	var all []*session
+	for m.lru.Len() > 0 {
+		all = append(all, m.remove(m.lru.Front()))
+	}
+	m.mu.Unlock()
+	return m.saveAll(all)
+}
+
+// session returns session id, marking it most recently used, and the
+// sessions evicted to make room for it, which the caller must save.
+func (m *SessionManager) session(id string) (*session, []*session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.sessions[id]; ok {
+		m.lru.MoveToFront(el)
+		return el.Value.(*session), nil
+	}
+	if m.sessions == nil {
+		m.sessions = make(map[string]*list.Element)
+		m.evicting = make(map[string]*session)
+	}
+	s, ok := m.evicting[id]
+	if ok {
+		delete(m.evicting, id)
+	} else {
+		s = &session{id: id}
+	}
+	m.sessions[id] = m.lru.PushFront(s)
+	var evicted []*session
+	for m.MaxSessions > 0 && m.lru.Len() > m.MaxSessions {
+		evicted = append(evicted, m.remove(m.lru.Back()))
+	}
+	return s, evicted
+}
+
+// remove removes a session from memory, keeping it in evicting until it
+// is saved. Must be called with m.mu held.
+func (m *SessionManager) remove(el *list.Element) *session {
+	s := m.lru.Remove(el).(*session)
+	delete(m.sessions, s.id)
+	m.evicting[s.id] = s
+	return s
+}
+
+// saveAll saves removed sessions once they are no longer in use, then
+// forgets them unless they were resumed meanwhile.
+func (m *SessionManager) saveAll(sessions []*session) error {
+	var errs []error
+	for _, s := range sessions {
+		s.mu.Lock()
+		errs = append(errs, m.save(s))
+		s.mu.Unlock()
+		m.mu.Lock()
+		if m.evicting[s.id] == s {
+			delete(m.evicting, s.id)
+		}
+		m.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// load creates the session's conversation and restores its stored
+// snapshot. Must be called with s.mu held.
+func (m *SessionManager) load(s *session) error {
+	conv := NewConversation("")
+	if m.New != nil {
+		conv = m.New(s.id)
+	}
+	if m.Store != nil {
+		snap, err := m.Store.Load(s.id)
+		if err != nil {
+			return fmt.Errorf("error loading session %s: %w", s.id, err)
+		}
+		conv.Restore(snap)
+	}
+	s.conv, s.loaded = conv, true
+	return nil
+}
+
+// save stores the session's snapshot, if it has been loaded. Must be
+// called with s.mu held.
+func (m *SessionManager) save(s *session) error {
+	if m.Store == nil || !s.loaded {
+		return nil
+	}
+	if err := m.Store.Save(s.id, s.conv.Snapshot()); err != nil {
+		return fmt.Errorf("error saving session %s: %w", s.id, err)
+	}
+	return nil
+}
+
+// allow takes one request from the session's allowance, reporting whether
+// there was one. Must be called with s.mu held.
+func (m *SessionManager) allow(s *session, now time.Time) bool {
+	if m.RateBurst <= 0 || m.RateInterval <= 0 {
+		return true
+	}
+	burst := float64(m.RateBurst)
+	if s.refilled.IsZero() {
+		s.allowance = burst
+	} else {
+		s.allowance += float64(now.Sub(s.refilled)) / float64(m.RateInterval)
+		s.allowance = min(s.allowance, burst)
+	}
+	s.refilled = now
+	if s.allowance < 1 {
+		return false
+	}
+	s.allowance--
+	return true
+}
+
+// FileSessionStore stores each session as a JSON snapshot in Dir, named
+// after the escaped session ID.
+type FileSessionStore struct {
+	Dir string
+	// Key, if set, encrypts the sessions at rest with AES-GCM; see
+	// Encrypt and GenerateKey. Unencrypted sessions are still read, and
+	// are encrypted when next saved.
+	Key []byte
+	// Redactor, if set, redacts sessions before they are saved. A session
+	// loaded back has the redacted history.
+	Redactor *Redactor
+}
+
+// Load implements SessionStore.
+func (f FileSessionStore) Load(id string) (*Snapshot, error) {
+	data, err := os.ReadFile(f.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := ReadSnapshot(data, f.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing session: %w", err)
+	}
+	return s, nil
+}
+
+// Save implements SessionStore. The file is replaced atomically.
+func (f FileSessionStore) Save(id string, s *Snapshot) error {
+	data, err := MarshalSnapshot(f.Redactor.RedactSnapshot(s), f.Key)
+	if err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+	return writeFileAtomic(f.path(id), data)
+}
+
+// path returns the file for session id.
+func (f FileSessionStore) path(id string) string {
+	return filepath.Join(f.Dir, url.PathEscape(id)+".json")
+}
+
+// writeFileAtomic writes data to path through a temporary file, so that
+// readers never see a partial file, and syncs it to disk before it
+// replaces path. The directory is created if needed.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Flush to disk before the rename, so a crash leaves the old or the
+	// new file, never a truncated one
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,172 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a SessionStore kept in memory.
+type memoryStore struct {
+	mu    sync.Mutex
+	saved map[string]*Snapshot
+}
+
+func (s *memoryStore) Load(id string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saved[id], nil
+}
+
+func (s *memoryStore) Save(id string, snap *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved == nil {
+		s.saved = make(map[string]*Snapshot)
+	}
+	s.saved[id] = snap
+	return nil
+}
+
+func TestSessionManagerEviction(t *testing.T) {
+	store := &memoryStore{}
+	m := NewSessionManager(2, store)
+	m.New = func(id string) *Conversation { return NewConversation("You talk to " + id + ".") }
+	ctx := context.Background()
+
+	add := func(id, text string) {
+		t.Helper()
+		err := m.Do(ctx, id, func(c *Conversation) error {
+			c.AddMessage("user", text)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("alice", "hi")
+	add("bob", "hello")
+	add("alice", "again")
+	add("carol", "hey") // evicts bob, the least recently used
+
+	if m.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", m.Len())
+	}
+	if snap := store.saved["bob"]; snap == nil || len(snap.Messages) != 1 || snap.System != "You talk to bob." {
+		t.Fatalf("Expected bob saved on eviction, got %+v", snap)
+	}
+	if _, ok := store.saved["alice"]; ok {
+		t.Error("Expected alice to stay in memory")
+	}
+
+	// Bob is restored from the store
+	err := m.Do(ctx, "bob", func(c *Conversation) error {
+		if len(c.Messages) != 1 || c.Messages[0].Content != "hello" {
+			t.Errorf("Expected bob's history restored, got %+v", c.Messages)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 0 || len(store.saved["alice"].Messages) != 2 {
+		t.Errorf("Expected all sessions saved and removed on Close, got %d in memory", m.Len())
+	}
+}
+
+func TestSessionManagerRateLimit(t *testing.T) {
+	m := &SessionManager{RateBurst: 2, RateInterval: time.Hour}
+	ctx := context.Background()
+	noop := func(*Conversation) error { return nil }
+
+	for i := 0; i < 2; i++ {
+		if err := m.Do(ctx, "a", noop); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := m.Do(ctx, "a", noop); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if err := m.Do(ctx, "b", noop); err != nil {
+		t.Errorf("Expected other sessions unaffected, got %v", err)
+	}
+
+	// The allowance refills over time
+	s, _ := m.session("a")
+	if m.allow(s, s.refilled.Add(30*time.Minute)) {
+		t.Error("Expected no request allowed after half an interval")
+	}
+	if !m.allow(s, s.refilled.Add(time.Hour)) {
+		t.Error("Expected a request allowed after a full interval")
+	}
+}
+
+func TestSessionManagerIsolation(t *testing.T) {
+	m := NewSessionManager(0, nil)
+	ctx := context.Background()
+
+	// Different sessions run concurrently: each waits for the other
+	var started sync.WaitGroup
+	started.Add(2)
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			m.Do(ctx, id, func(*Conversation) error {
+				started.Done()
+				started.Wait()
+				return nil
+			})
+		}(id)
+	}
+	wg.Wait()
+
+	// Calls for one session run one at a time
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Do(ctx, "a", func(c *Conversation) error {
+				c.AddMessage("user", "x")
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	m.Do(ctx, "a", func(c *Conversation) error {
+		if len(c.Messages) != 20 {
+			t.Errorf("Expected 20 messages, got %d", len(c.Messages))
+		}
+		if c.Ctx != ctx {
+			t.Error("Expected the conversation to use the call's context")
+		}
+		return nil
+	})
+}
+
+func TestFileSessionStore(t *testing.T) {
+	store := FileSessionStore{Dir: t.TempDir()}
+	if snap, err := store.Load("discord/123"); err != nil || snap != nil {
+		t.Fatalf("Load of missing session = %v, %v", snap, err)
+	}
+
+	conv := NewConversation("sys")
+	conv.AddMessage("user", "hi")
+	if err := store.Save("discord/123", conv.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := store.Load("discord/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.System != "sys" || len(snap.Messages) != 1 || snap.Settings.Model != conv.Settings.Model {
+		t.Errorf("Unexpected snapshot: %+v", snap)
+	}
+}
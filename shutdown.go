@@ -0,0 +1,151 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrShutdown is the cause of requests cancelled by Shutdown or Close, and
+// the error of requests made after them.
+var ErrShutdown = errors.New("shut down")
+
+// lifecycle tracks the requests and background work of a Conversation or
+// Client so that shutting it down can cancel them and wait for them to
+// stop. Copies of a conversation, such as side requests, share it.
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// lifecycleMu guards creating the lifecycle of conversations and clients
+// not made by their constructors.
+var lifecycleMu sync.Mutex
+
+// lifecycleOf returns *life, creating it if needed.
+func lifecycleOf(life **lifecycle) *lifecycle {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	if *life == nil {
+		*life = newLifecycle()
+	}
+	return *life
+}
+
+// track starts work that shutdown waits for. It returns a context derived
+// from parent that shutdown cancels, and a function to call when the work
+// is done. Once shut down it returns ErrShutdown.
+func (l *lifecycle) track(parent context.Context) (context.Context, func(), error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, nil, ErrShutdown
+	}
+	l.wg.Add(1)
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithCancelCause(parent)
+	stop := context.AfterFunc(l.ctx, func() { cancel(ErrShutdown) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		l.wg.Done()
+	}, nil
+}
+
+// shutdown refuses new work, cancels the work running and waits until it
+// has stopped or ctx is done.
+func (l *lifecycle) shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.cancel(ErrShutdown)
+
+	stopped := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting for requests to stop: %w", ctx.Err())
+	}
+}
+
+// track starts work on the conversation that Shutdown waits for; see
+// lifecycle.track.
+func (c *Conversation) track(parent context.Context) (context.Context, func(), error) {
+	return lifecycleOf(&c.life).track(parent)
+}
+
+// Shutdown stops the conversation for a clean service shutdown. It cancels
+// requests in flight, including SendAsync jobs, spoken streams and
+// background classification, with ErrShutdown as the cause, and waits
+// until they have stopped or ctx is done. It then calls OnShutdown to
+// flush what the application keeps, and closes the idle connections of
+// HttpClient and StreamingClient. Requests made afterwards fail with
+// ErrShutdown.
+//
+// Copies of the conversation, such as those made for side requests and
+// experiments, are shut down with it. Calling Shutdown again waits for
+// work still running and flushes again.
+func (c *Conversation) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := lifecycleOf(&c.life).shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if c.OnShutdown != nil {
+		if err := c.OnShutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error flushing on shutdown: %w", err))
+		}
+	}
+	for _, client := range []*http.Client{c.HttpClient, c.StreamingClient} {
+		if client != nil {
+			client.CloseIdleConnections()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close shuts the conversation down, waiting for its requests to stop
+// however long they take. See Shutdown.
+func (c *Conversation) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// track starts a request on the client that Shutdown waits for; see
+// lifecycle.track.
+func (c *Client) track(parent context.Context) (context.Context, func(), error) {
+	return lifecycleOf(&c.life).track(parent)
+}
+
+// Shutdown stops the client for a clean service shutdown. It cancels
+// requests in flight with ErrShutdown as the cause, waits until they have
+// stopped or ctx is done, and closes the idle connections of HttpClient.
+// Requests made afterwards fail with ErrShutdown.
+func (c *Client) Shutdown(ctx context.Context) error {
+	err := lifecycleOf(&c.life).shutdown(ctx)
+	if c.HttpClient != nil {
+		c.HttpClient.CloseIdleConnections()
+	}
+	return err
+}
+
+// Close shuts the client down, waiting for its requests to stop however
+// long they take. See Shutdown.
+func (c *Client) Close() error {
+	return c.Shutdown(context.Background())
+}
@@ -0,0 +1,145 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+// blockingServer returns a completion server that holds each request until
+// the client gives up, announcing it on started. The body is read first so
+// that the server notices the client closing the connection.
+func blockingServer(t *testing.T) (*httptest.Server, <-chan struct{}) {
+	t.Helper()
+	started := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	return server, started
+}
+
+func TestShutdownCancelsRequests(t *testing.T) {
+	server, started := blockingServer(t)
+	conv := NewConversationWithClient(nil, ConversationConfig{
+		ApiToken: "test-token",
+		Endpoint: server.URL,
+		Settings: BuiltinSettings(),
+	})
+	conv.Retry = &RetryPolicy{}
+	var flushed bool
+	conv.OnShutdown = func(ctx context.Context) error {
+		flushed = true
+		return nil
+	}
+
+	// A copy, as made for side requests, is shut down with the original
+	side := *conv
+	side.Messages = nil
+	sent := make(chan error, 2)
+	go func() {
+		_, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{})
+		sent <- err
+	}()
+	go func() {
+		_, _, _, _, _, _, err := side.SendStreamingWith("Hello", SamplingProfile{}, nil)
+		sent <- err
+	}()
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := conv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	// Both requests have returned by the time Shutdown does
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-sent:
+			if !errors.Is(err, ErrShutdown) {
+				t.Errorf("cancelled request error = %v, want ErrShutdown", err)
+			}
+		default:
+			t.Fatal("Shutdown returned before a request stopped")
+		}
+	}
+	if !flushed {
+		t.Error("OnShutdown not called")
+	}
+
+	if _, _, _, _, _, _, err := conv.SendWith("Again", SamplingProfile{}); !errors.Is(err, ErrShutdown) {
+		t.Errorf("send after Shutdown = %v, want ErrShutdown", err)
+	}
+	job := conv.SendAsync("Again", llmapi.Sampling{}, nil)
+	if _, err := job.Wait(ctx); !errors.Is(err, ErrShutdown) {
+		t.Errorf("async send after Shutdown = %v, want ErrShutdown", err)
+	}
+}
+
+func TestShutdownWaitsForBackgroundWork(t *testing.T) {
+	conv := &Conversation{ApiToken: "test-token", Settings: BuiltinSettings()}
+	NewFakeBackend().On("", FakeResponse{Text: "Hi."}).Install(conv)
+	release := make(chan struct{})
+	conv.Classifier = ClassifierFunc(func(ctx context.Context, text string) (Classification, error) {
+		// Ignores cancellation, as a slow classifier might
+		<-release
+		return Classification{Allowed: true}, nil
+	})
+	conv.OnShutdown = func(ctx context.Context) error {
+		return errors.New("store unavailable")
+	}
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := conv.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown with classification running = %v, want deadline exceeded", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "store unavailable") {
+		t.Errorf("Shutdown error %v does not report the flush", err)
+	}
+
+	close(release)
+	if err := conv.Close(); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close once classification stopped = %v, want the flush error", err)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	server, started := blockingServer(t)
+	client := &Client{ApiToken: "test-token", TextURL: server.URL, HttpClient: &http.Client{}, Retry: &RetryPolicy{}}
+
+	generated := make(chan error, 1)
+	go func() {
+		_, err := client.Generate(context.Background(), &GenerateRequest{Input: "Once", Model: "kayra-v1"})
+		generated <- err
+	}()
+	<-started
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case err := <-generated:
+		if !errors.Is(err, ErrShutdown) {
+			t.Errorf("cancelled request error = %v, want ErrShutdown", err)
+		}
+	default:
+		t.Fatal("Close returned before the request stopped")
+	}
+	if _, err := client.Ping(context.Background()); !errors.Is(err, ErrShutdown) {
+		t.Errorf("ping after Close = %v, want ErrShutdown", err)
+	}
+}
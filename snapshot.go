@@ -0,0 +1,178 @@
+package novelai
+
+import (
+	"reflect"
+)
+
+// Snapshot is a point-in-time copy of a conversation's state.
+// Snapshots share no memory with the conversation they were taken from, so
+// they can be kept for rollback, compared with Diff, or restored into a
+// different conversation.
+type Snapshot struct {
+	// Version is the save format version, CurrentSnapshotVersion for
+	// snapshots taken by this package.
+	Version  int               `json:"version"`
+	System   string            `json:"system"`
+	Messages []Message         `json:"messages"`
+	Usage    Usage             `json:"usage"`
+	Turns    []TurnRecord      `json:"turns,omitempty"`
+	Settings Settings          `json:"settings"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+// Snapshot captures the conversation's system prompt, messages, usage,
+// turn records, settings and metadata.
+func (c *Conversation) Snapshot() *Snapshot {
+	return &Snapshot{
+		Version:  CurrentSnapshotVersion,
+		System:   c.System,
+		Messages: copyMessages(c.Messages),
+		Usage:    c.Usage,
+		Turns:    append([]TurnRecord(nil), c.Turns...),
+		Settings: c.Settings.Clone(),
+		Meta:     copyMeta(c.Meta),
+	}
+}
+
+// Restore replaces the conversation's state with the contents of a snapshot.
+// The snapshot is copied, so it can be restored again later.
+func (c *Conversation) Restore(s *Snapshot) {
+	if s == nil {
+		return
+	}
+	c.System = s.System
+	c.Messages = copyMessages(s.Messages)
+	c.Usage = s.Usage
+	c.Turns = append([]TurnRecord(nil), s.Turns...)
+	c.Settings = s.Settings.Clone()
+	c.Meta = copyMeta(s.Meta)
+}
+
+// copyMeta returns a copy of a metadata map, nil if it is empty.
+func copyMeta(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(meta))
+	for k, v := range meta {
+		result[k] = v
+	}
+	return result
+}
+
+// copyMessages returns a copy of a message slice, never nil. The tags of
+// each message are copied too.
+func copyMessages(msgs []Message) []Message {
+	result := make([]Message, len(msgs))
+	copy(result, msgs)
+	for i := range result {
+		if result[i].Tags != nil {
+			result[i].Tags = append([]string(nil), result[i].Tags...)
+		}
+	}
+	return result
+}
+
+// ChangeKind describes how an item differs between two snapshots.
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// MessageChange describes a difference at one position in the history.
+// Old is nil for added messages; New is nil for removed messages.
+type MessageChange struct {
+	Kind  ChangeKind `json:"kind"`
+	Index int        `json:"index"`
+	Old   *Message   `json:"old,omitempty"`
+	New   *Message   `json:"new,omitempty"`
+}
+
+// SettingChange describes a Settings field that differs between snapshots.
+type SettingChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// Changeset is the structured difference between two snapshots.
+type Changeset struct {
+	// SystemChanged is true if the system prompt differs.
+	SystemChanged bool   `json:"system_changed"`
+	OldSystem     string `json:"old_system,omitempty"`
+	NewSystem     string `json:"new_system,omitempty"`
+	// Messages lists per-position history differences in index order.
+	Messages []MessageChange `json:"messages,omitempty"`
+	// Settings lists changed Settings fields in declaration order.
+	Settings []SettingChange `json:"settings,omitempty"`
+	// UsageDelta is b.Usage minus a.Usage.
+	UsageDelta Usage `json:"usage_delta"`
+}
+
+// Empty reports whether the changeset contains no differences.
+func (cs *Changeset) Empty() bool {
+	return !cs.SystemChanged && len(cs.Messages) == 0 && len(cs.Settings) == 0 &&
+		cs.UsageDelta == Usage{}
+}
+
+// Diff compares two snapshots and returns the changes needed to go from a to b.
+// Messages are compared by position: shared indices that differ are reported
+// as modified, and trailing messages as added or removed.
+// A nil snapshot is treated as empty.
+func Diff(a, b *Snapshot) *Changeset {
+	if a == nil {
+		a = &Snapshot{}
+	}
+	if b == nil {
+		b = &Snapshot{}
+	}
+
+	cs := &Changeset{
+		UsageDelta: Usage{
+			InputTokens:  b.Usage.InputTokens - a.Usage.InputTokens,
+			OutputTokens: b.Usage.OutputTokens - a.Usage.OutputTokens,
+		},
+	}
+
+	if a.System != b.System {
+		cs.SystemChanged = true
+		cs.OldSystem = a.System
+		cs.NewSystem = b.System
+	}
+
+	for i := 0; i < len(a.Messages) || i < len(b.Messages); i++ {
+		switch {
+		case i >= len(a.Messages):
+			m := b.Messages[i]
+			cs.Messages = append(cs.Messages, MessageChange{Kind: ChangeAdded, Index: i, New: &m})
+		case i >= len(b.Messages):
+			m := a.Messages[i]
+			cs.Messages = append(cs.Messages, MessageChange{Kind: ChangeRemoved, Index: i, Old: &m})
+		case !reflect.DeepEqual(a.Messages[i], b.Messages[i]):
+			oldMsg, newMsg := a.Messages[i], b.Messages[i]
+			cs.Messages = append(cs.Messages, MessageChange{Kind: ChangeModified, Index: i, Old: &oldMsg, New: &newMsg})
+		}
+	}
+
+	cs.Settings = diffSettings(a.Settings, b.Settings)
+	return cs
+}
+
+// diffSettings compares two Settings values field by field.
+// Pointer fields are compared by the values they point to.
+func diffSettings(a, b Settings) []SettingChange {
+	var changes []SettingChange
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fa, fb := va.Field(i).Interface(), vb.Field(i).Interface()
+		if reflect.DeepEqual(fa, fb) {
+			continue
+		}
+		changes = append(changes, SettingChange{Field: t.Field(i).Name, Old: fa, New: fb})
+	}
+	return changes
+}
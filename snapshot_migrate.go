@@ -0,0 +1,26 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/wbrown/novelai/migrate"
+)
+
+// CurrentSnapshotVersion is the save format version of snapshots taken by
+// Snapshot. Older snapshots are upgraded by the migrate package.
+const CurrentSnapshotVersion = migrate.CurrentSnapshotVersion
+
+// UnmarshalSnapshot decodes a saved snapshot, migrating it to the current
+// save format first with migrate.Snapshot.
+func UnmarshalSnapshot(data []byte) (*Snapshot, error) {
+	migrated, _, err := migrate.Snapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(migrated, &s); err != nil {
+		return nil, fmt.Errorf("error decoding snapshot: %w", err)
+	}
+	return &s, nil
+}
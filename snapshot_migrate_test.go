@@ -0,0 +1,40 @@
+package novelai
+
+import (
+	"testing"
+)
+
+func TestUnmarshalSnapshot(t *testing.T) {
+	// Saved before versioning
+	old := []byte(`{"system":"sys","messages":[{"role":"user","content":"Hi"}],` +
+		`"usage":{"InputTokens":3,"OutputTokens":0},"settings":{"Model":"glm-4-6","MaxTokens":100}}`)
+	s, err := UnmarshalSnapshot(old)
+	if err != nil {
+		t.Fatalf("UnmarshalSnapshot failed: %v", err)
+	}
+	if s.Version != CurrentSnapshotVersion || s.System != "sys" || len(s.Messages) != 1 ||
+		s.Usage.InputTokens != 3 || s.Settings.MaxTokens != 100 {
+		t.Errorf("Got %+v", s)
+	}
+
+	if _, err := UnmarshalSnapshot([]byte(`{"version":99}`)); err == nil {
+		t.Error("Expected an error for a newer version")
+	}
+	if _, err := UnmarshalSnapshot([]byte(`{`)); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestFileSessionStoreMigrates(t *testing.T) {
+	store := FileSessionStore{Dir: t.TempDir()}
+	if err := writeFileAtomic(store.path("old"), []byte(`{"system":"legacy","messages":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Load("old")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.System != "legacy" || s.Version != CurrentSnapshotVersion {
+		t.Errorf("Got %+v", s)
+	}
+}
@@ -0,0 +1,103 @@
+package novelai
+
+import (
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// TestSnapshotRestore tests that Restore rolls back messages, usage and settings.
+func TestSnapshotRestore(t *testing.T) {
+	conv := NewConversation("System")
+	conv.Settings.StopSequences = []string{"<|user|>"}
+	conv.AddMessage(llmapi.RoleUser, "Hello")
+	conv.Messages[0].Tags = []string{"greeting"}
+	conv.Usage.InputTokens = 10
+
+	snap := conv.Snapshot()
+
+	conv.AddMessage(llmapi.RoleAssistant, "Hi")
+	conv.Messages[0].Content = "Changed"
+	conv.Usage.InputTokens = 20
+	conv.Settings.Temperature = 0.2
+	conv.Settings.StopSequences[0] = "<|mutated|>"
+
+	if snap.Messages[0].Content != "Hello" {
+		t.Errorf("Snapshot shares message memory with conversation: %q", snap.Messages[0].Content)
+	}
+	conv.Messages[0].Tags[0] = "mutated"
+	if snap.Messages[0].Tags[0] != "greeting" {
+		t.Errorf("Snapshot shares message tags with conversation: %q", snap.Messages[0].Tags[0])
+	}
+	if snap.Settings.StopSequences[0] != "<|user|>" {
+		t.Errorf("Snapshot shares stop sequences with conversation: %q", snap.Settings.StopSequences[0])
+	}
+
+	conv.Restore(snap)
+
+	if len(conv.Messages) != 1 || conv.Messages[0].Content != "Hello" {
+		t.Errorf("Expected restored history [Hello], got %+v", conv.Messages)
+	}
+	if conv.Usage.InputTokens != 10 {
+		t.Errorf("Expected restored input tokens 10, got %d", conv.Usage.InputTokens)
+	}
+	if conv.Settings.Temperature != DefaultSettings.Temperature {
+		t.Errorf("Expected restored temperature %v, got %v", DefaultSettings.Temperature, conv.Settings.Temperature)
+	}
+
+	// Mutating after restore must not affect the snapshot
+	conv.Messages[0].Content = "Again"
+	conv.Messages[0].Tags[0] = "again"
+	if snap.Messages[0].Content != "Hello" {
+		t.Errorf("Restore shares message memory with snapshot")
+	}
+	if snap.Messages[0].Tags[0] != "greeting" {
+		t.Errorf("Restore shares message tags with snapshot")
+	}
+}
+
+// TestDiff tests the structured changeset between two snapshots.
+func TestDiff(t *testing.T) {
+	conv := NewConversation("System")
+	conv.AddMessage(llmapi.RoleUser, "Hello")
+	conv.AddMessage(llmapi.RoleAssistant, "Hi")
+	a := conv.Snapshot()
+
+	conv.System = "New system"
+	conv.Messages[1].Content = "Hello there"
+	conv.AddMessage(llmapi.RoleUser, "How are you?")
+	conv.Settings.Temperature = 0.5
+	conv.Usage.OutputTokens = 7
+	b := conv.Snapshot()
+
+	cs := Diff(a, b)
+
+	if !cs.SystemChanged || cs.OldSystem != "System" || cs.NewSystem != "New system" {
+		t.Errorf("Expected system change, got %+v", cs)
+	}
+	if len(cs.Messages) != 2 {
+		t.Fatalf("Expected 2 message changes, got %d: %+v", len(cs.Messages), cs.Messages)
+	}
+	if cs.Messages[0].Kind != ChangeModified || cs.Messages[0].Index != 1 || cs.Messages[0].New.Content != "Hello there" {
+		t.Errorf("Expected modified message at index 1, got %+v", cs.Messages[0])
+	}
+	if cs.Messages[1].Kind != ChangeAdded || cs.Messages[1].Index != 2 || cs.Messages[1].Old != nil {
+		t.Errorf("Expected added message at index 2, got %+v", cs.Messages[1])
+	}
+	if len(cs.Settings) != 1 || cs.Settings[0].Field != "Temperature" {
+		t.Errorf("Expected Temperature setting change, got %+v", cs.Settings)
+	}
+	if cs.UsageDelta.OutputTokens != 7 {
+		t.Errorf("Expected output token delta 7, got %d", cs.UsageDelta.OutputTokens)
+	}
+
+	// Reverse diff reports removal
+	rev := Diff(b, a)
+	if rev.Messages[1].Kind != ChangeRemoved || rev.Messages[1].New != nil {
+		t.Errorf("Expected removed message in reverse diff, got %+v", rev.Messages[1])
+	}
+
+	if !Diff(a, a).Empty() {
+		t.Error("Expected empty diff between identical snapshots")
+	}
+}
@@ -0,0 +1,279 @@
+package novelai
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TurnRecord is what was measured of one completed request.
+type TurnRecord struct {
+	// Message is the index of the reply in Messages when it was added.
+	Message int `json:"message"`
+	// Started is when the request was sent.
+	Started time.Time `json:"started"`
+	// Latency is the time from sending the request to having the whole
+	// reply.
+	Latency time.Duration `json:"latency"`
+	// QueueWait is the time spent waiting for the request queue before
+	// sending.
+	QueueWait time.Duration `json:"queue_wait"`
+	// FirstByte is the time from sending the request to the first byte of
+	// the response, including any retries. For non-streaming requests the
+	// reply is generated before the response starts.
+	FirstByte time.Duration `json:"first_byte"`
+	// FirstToken is the time from sending the request to the first
+	// streamed text. It is zero for non-streaming requests.
+	FirstToken time.Duration `json:"first_token"`
+	// StopReason is the normalized stop reason.
+	StopReason   string `json:"stop_reason"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	// ThinkingTokens estimates the output tokens spent thinking, by the
+	// share of the reply's text in its think block.
+	ThinkingTokens int `json:"thinking_tokens"`
+	// Words is the number of words in the reply, outside its think block.
+	Words int `json:"words"`
+	// Fingerprint identifies the request's generation inputs; see
+	// PromptFingerprint.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Generation estimates the time spent generating the reply: from the
+// first streamed text to the end of the stream, or for non-streaming
+// requests, the time to the first byte of the response, which includes
+// the network round trip.
+func (t TurnRecord) Generation() time.Duration {
+	if t.FirstToken > 0 {
+		return t.Latency - t.FirstToken
+	}
+	return t.FirstByte
+}
+
+// Stats summarizes the requests of a conversation, for tuning prompts and
+// settings. Marshal it to export it as JSON, or see WriteCSV.
+type Stats struct {
+	// Turns is the number of completed requests.
+	Turns          int `json:"turns"`
+	InputTokens    int `json:"input_tokens"`
+	OutputTokens   int `json:"output_tokens"`
+	ThinkingTokens int `json:"thinking_tokens"`
+	Words          int `json:"words"`
+	// WordsPerReply is the average words per reply.
+	WordsPerReply float64 `json:"words_per_reply"`
+	// InputTokensPerTurn and OutputTokensPerTurn are averages per request.
+	InputTokensPerTurn  float64 `json:"input_tokens_per_turn"`
+	OutputTokensPerTurn float64 `json:"output_tokens_per_turn"`
+	// ThinkingShare is the estimated fraction of output tokens spent
+	// thinking.
+	ThinkingShare float64 `json:"thinking_share"`
+	// AverageLatency is the average time to a complete reply.
+	AverageLatency time.Duration `json:"average_latency"`
+	// AverageQueueWait and AverageFirstByte are averages over all
+	// requests; AverageFirstToken is over streaming requests only.
+	AverageQueueWait  time.Duration `json:"average_queue_wait"`
+	AverageFirstByte  time.Duration `json:"average_first_byte"`
+	AverageFirstToken time.Duration `json:"average_first_token"`
+	// StopReasons counts the requests by stop reason.
+	StopReasons map[string]int `json:"stop_reasons"`
+	// Records are the requests summarized.
+	Records []TurnRecord `json:"records"`
+}
+
+// Stats summarizes the requests recorded in Turns.
+func (c *Conversation) Stats() *Stats {
+	return ComputeStats(c.Turns)
+}
+
+// ComputeStats summarizes turns, such as those of several conversations.
+func ComputeStats(turns []TurnRecord) *Stats {
+	s := &Stats{
+		Turns:       len(turns),
+		StopReasons: make(map[string]int),
+		Records:     append([]TurnRecord(nil), turns...),
+	}
+	if len(turns) == 0 {
+		return s
+	}
+	var latency, queueWait, firstByte, firstToken time.Duration
+	var streamed int
+	for _, t := range turns {
+		s.InputTokens += t.InputTokens
+		s.OutputTokens += t.OutputTokens
+		s.ThinkingTokens += t.ThinkingTokens
+		s.Words += t.Words
+		s.StopReasons[t.StopReason]++
+		latency += t.Latency
+		queueWait += t.QueueWait
+		firstByte += t.FirstByte
+		if t.FirstToken > 0 {
+			firstToken += t.FirstToken
+			streamed++
+		}
+	}
+	n := float64(len(turns))
+	s.WordsPerReply = float64(s.Words) / n
+	s.InputTokensPerTurn = float64(s.InputTokens) / n
+	s.OutputTokensPerTurn = float64(s.OutputTokens) / n
+	s.AverageLatency = latency / time.Duration(len(turns))
+	s.AverageQueueWait = queueWait / time.Duration(len(turns))
+	s.AverageFirstByte = firstByte / time.Duration(len(turns))
+	if streamed > 0 {
+		s.AverageFirstToken = firstToken / time.Duration(streamed)
+	}
+	if s.OutputTokens > 0 {
+		s.ThinkingShare = float64(s.ThinkingTokens) / float64(s.OutputTokens)
+	}
+	return s
+}
+
+// statsCSVHeader names the columns written by WriteCSV.
+var statsCSVHeader = []string{
+	"turn", "message", "started", "latency_ms", "queue_wait_ms", "first_byte_ms",
+	"first_token_ms", "stop_reason", "input_tokens", "output_tokens", "thinking_tokens", "words",
+	"fingerprint",
+}
+
+// WriteCSV writes the records as CSV, one row per request after a header
+// row. Latencies are in milliseconds.
+func (s *Stats) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(statsCSVHeader); err != nil {
+		return err
+	}
+	for i, t := range s.Records {
+		row := []string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(t.Message),
+			t.Started.UTC().Format(time.RFC3339Nano),
+			strconv.FormatInt(t.Latency.Milliseconds(), 10),
+			strconv.FormatInt(t.QueueWait.Milliseconds(), 10),
+			strconv.FormatInt(t.FirstByte.Milliseconds(), 10),
+			strconv.FormatInt(t.FirstToken.Milliseconds(), 10),
+			t.StopReason,
+			strconv.Itoa(t.InputTokens),
+			strconv.Itoa(t.OutputTokens),
+			strconv.Itoa(t.ThinkingTokens),
+			strconv.Itoa(t.Words),
+			t.Fingerprint,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// requestTimer times the phases of a request for its TurnRecord.
+type requestTimer struct {
+	// fingerprint is the request's PromptFingerprint.
+	fingerprint string
+
+	// queued is when the request started waiting for the queue, and
+	// started when it was sent.
+	queued  time.Time
+	started time.Time
+
+	mu         sync.Mutex
+	firstByte  time.Time
+	firstToken time.Time
+}
+
+// trace returns ctx with a trace noting when response bytes arrive.
+func (t *requestTimer) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: t.respond,
+	})
+}
+
+// wait notes that the request is waiting for the queue.
+func (t *requestTimer) wait() {
+	t.queued = time.Now()
+}
+
+// send notes that the request is being sent.
+func (t *requestTimer) send() {
+	t.started = time.Now()
+}
+
+// respond notes that the response has started, unless it already has.
+// It is called both by the trace and after the request, for transports
+// that do not report to the trace.
+func (t *requestTimer) respond() {
+	t.mu.Lock()
+	if t.firstByte.IsZero() {
+		t.firstByte = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+// stream wraps a stream callback to note when the first text arrives.
+func (t *requestTimer) stream(callback StreamCallback) StreamCallback {
+	return func(text string, done bool) {
+		if text != "" {
+			t.mu.Lock()
+			if t.firstToken.IsZero() {
+				t.firstToken = time.Now()
+			}
+			t.mu.Unlock()
+		}
+		if callback != nil {
+			callback(text, done)
+		}
+	}
+}
+
+// since returns the time from sending the request to at, or zero if at is
+// unset.
+func (t *requestTimer) since(at time.Time) time.Duration {
+	if at.IsZero() {
+		return 0
+	}
+	return at.Sub(t.started)
+}
+
+// recordTurn records a completed request whose reply is the last message.
+func (c *Conversation) recordTurn(timer *requestTimer, reply, stopReason string, inputTokens, outputTokens int) {
+	thinking, visible := splitThinking(reply)
+	timer.mu.Lock()
+	t := TurnRecord{
+		Message:      len(c.Messages) - 1,
+		Started:      timer.started,
+		Latency:      time.Since(timer.started),
+		QueueWait:    timer.started.Sub(timer.queued),
+		FirstByte:    timer.since(timer.firstByte),
+		FirstToken:   timer.since(timer.firstToken),
+		StopReason:   stopReason,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		Words:        len(strings.Fields(visible)),
+		Fingerprint:  timer.fingerprint,
+	}
+	timer.mu.Unlock()
+	if n := len(thinking) + len(visible); n > 0 {
+		t.ThinkingTokens = outputTokens * len(thinking) / n
+	}
+	c.Turns = append(c.Turns, t)
+}
+
+// splitThinking splits a reply into its think block, if any, and the rest.
+// The opening tag may be missing, as it is part of the prompt when
+// thinking is enabled.
+func splitThinking(reply string) (thinking, visible string) {
+	end := strings.Index(reply, "</think>")
+	if end < 0 {
+		return "", reply
+	}
+	end += len("</think>")
+	start := strings.Index(reply[:end], "<think>")
+	if start < 0 {
+		start = 0
+	}
+	return reply[start:end], reply[:start] + reply[end:]
+}
@@ -0,0 +1,163 @@
+package novelai
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConversationStats(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().On(`.`,
+		FakeResponse{Text: "<think>Plan the reply</think>One two three", PromptTokens: 10, CompletionTokens: 20},
+		FakeResponse{Text: "Four five six seven eight", FinishReason: "length", PromptTokens: 30, CompletionTokens: 10})
+	fake.Install(conv)
+
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Go on", SamplingProfile{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s := conv.Stats()
+	if s.Turns != 2 || s.InputTokens != 40 || s.OutputTokens != 30 || s.Words != 8 {
+		t.Errorf("Unexpected totals: %+v", s)
+	}
+	if s.WordsPerReply != 4 || s.InputTokensPerTurn != 20 || s.OutputTokensPerTurn != 15 {
+		t.Errorf("Unexpected averages: %+v", s)
+	}
+	if s.StopReasons["end_turn"] != 1 || s.StopReasons["max_tokens"] != 1 {
+		t.Errorf("Unexpected stop reasons: %v", s.StopReasons)
+	}
+	if first := s.Records[0]; first.Message != 1 || first.ThinkingTokens == 0 || first.Started.IsZero() {
+		t.Errorf("Unexpected record: %+v", first)
+	}
+	if s.ThinkingShare <= 0 || s.ThinkingShare >= 1 {
+		t.Errorf("Unexpected thinking share: %v", s.ThinkingShare)
+	}
+
+	// Side requests are not recorded
+	if _, err := conv.GenerateTitle(); err != nil {
+		t.Fatal(err)
+	}
+	if len(conv.Turns) != 2 {
+		t.Errorf("Expected 2 turns, got %d", len(conv.Turns))
+	}
+
+	// Turns survive a snapshot
+	restored := NewConversation("")
+	restored.Restore(conv.Snapshot())
+	if len(restored.Turns) != 2 {
+		t.Errorf("Expected 2 restored turns, got %d", len(restored.Turns))
+	}
+}
+
+func TestLatencyBreakdown(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if r.Header.Get("Accept") != "text/event-stream" {
+			fmt.Fprint(w, `{"choices":[{"text":"Hi","finish_reason":"stop"}]}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		for _, text := range []string{"Hello", " there"} {
+			time.Sleep(delay)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"text\":%q}]}\n\n", text)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+	conv := NewConversation("")
+	conv.ApiToken = "test-token"
+	conv.Endpoint = server.URL
+
+	if _, _, _, _, _, _, err := conv.SendWith("Hi", SamplingProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Go on", SamplingProfile{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, streamed := conv.Turns[0], conv.Turns[1]
+	if plain.FirstByte < delay || plain.FirstToken != 0 || plain.Latency < plain.FirstByte {
+		t.Errorf("Unexpected non-streaming timing: %+v", plain)
+	}
+	if plain.Generation() != plain.FirstByte {
+		t.Errorf("Generation() = %v, want %v", plain.Generation(), plain.FirstByte)
+	}
+	if streamed.FirstByte < delay || streamed.FirstToken < streamed.FirstByte+delay ||
+		streamed.Latency < streamed.FirstToken+delay {
+		t.Errorf("Unexpected streaming timing: %+v", streamed)
+	}
+	if streamed.Generation() < delay {
+		t.Errorf("Generation() = %v, want at least %v", streamed.Generation(), delay)
+	}
+
+	s := conv.Stats()
+	if s.AverageFirstToken != streamed.FirstToken || s.AverageFirstByte < delay {
+		t.Errorf("Unexpected averages: %+v", s)
+	}
+}
+
+func TestComputeStatsEmpty(t *testing.T) {
+	s := ComputeStats(nil)
+	if s.Turns != 0 || s.WordsPerReply != 0 || s.AverageLatency != 0 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
+
+func TestStatsExport(t *testing.T) {
+	s := ComputeStats([]TurnRecord{
+		{Message: 1, Latency: 1500 * time.Millisecond, StopReason: "end_turn", InputTokens: 5, OutputTokens: 7, Words: 4},
+		{Message: 3, Latency: 500 * time.Millisecond, StopReason: "end_turn", InputTokens: 9, OutputTokens: 3, Words: 2},
+	})
+	if s.AverageLatency != time.Second {
+		t.Errorf("AverageLatency = %v", s.AverageLatency)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Stats
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Turns != 2 || len(decoded.Records) != 2 {
+		t.Errorf("Unexpected JSON round trip: %+v, %v", decoded, err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][3] != "latency_ms" || rows[1][3] != "1500" || rows[2][1] != "3" || len(rows[1]) != 13 {
+		t.Errorf("Unexpected CSV: %v", rows)
+	}
+}
+
+func TestSplitThinking(t *testing.T) {
+	tests := []struct {
+		reply, thinking, visible string
+	}{
+		{"Hello", "", "Hello"},
+		{"<think>hmm</think>Hi", "<think>hmm</think>", "Hi"},
+		{"hmm</think>Hi", "hmm</think>", "Hi"},
+	}
+	for _, tt := range tests {
+		thinking, visible := splitThinking(tt.reply)
+		if thinking != tt.thinking || visible != tt.visible {
+			t.Errorf("splitThinking(%q) = %q, %q", tt.reply, thinking, visible)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package novelai
+
+import "context"
+
+// StopReason is why a reply ended. Send and the other methods return it as
+// a plain string, as llmapi.Conversation requires; convert it with
+// StopReason(reason) to switch over the constants below. New reasons are
+// added here, so a switch with a default case stays correct.
+type StopReason string
+
+// Stop reasons.
+const (
+	// StopEndTurn is a reply the model ended, including on a stop
+	// sequence: the server does not tell them apart.
+	StopEndTurn StopReason = "end_turn"
+	// StopMaxTokens is a reply cut off by Settings.MaxTokens; continue it
+	// by sending an empty message, or use SendUntilDone.
+	StopMaxTokens StopReason = "max_tokens"
+	// StopSequence is a reply ended by a stop sequence, for backends that
+	// report it separately from StopEndTurn.
+	StopSequence StopReason = "stop_sequence"
+	// StopToolUse is a reply ending in a tool call.
+	StopToolUse StopReason = "tool_use"
+	// StopClientTruncated is a streamed reply cut off by
+	// Settings.MaxResponseBytes or Settings.MaxResponseTokens.
+	StopClientTruncated StopReason = "client_truncated"
+	// StopLoopDetected is a streamed reply cut off because the model
+	// started repeating itself; see Settings.LoopDetection.
+	StopLoopDetected StopReason = "loop_detected"
+	// StopCancelled is a reply interrupted by the conversation's context
+	// being cancelled. It comes with the context's error and whatever was
+	// streamed before.
+	StopCancelled StopReason = "cancelled"
+)
+
+// StopReasons lists the known stop reasons.
+var StopReasons = []StopReason{
+	StopEndTurn, StopMaxTokens, StopSequence, StopToolUse,
+	StopClientTruncated, StopLoopDetected, StopCancelled,
+}
+
+// String returns the reason as sent by Send.
+func (r StopReason) String() string {
+	return string(r)
+}
+
+// Known reports whether r is one of StopReasons, rather than a reason
+// passed on from the server as is.
+func (r StopReason) Known() bool {
+	for _, known := range StopReasons {
+		if r == known {
+			return true
+		}
+	}
+	return false
+}
+
+// errorStopReason returns the stop reason of a request that failed:
+// StopCancelled if the request's context ctx was cancelled, and otherwise
+// stopReason.
+func (c *Conversation) errorStopReason(ctx context.Context, stopReason string) string {
+	if ctx.Err() != nil {
+		return string(StopCancelled)
+	}
+	return stopReason
+}
@@ -0,0 +1,22 @@
+package novelai
+
+import "strings"
+
+// firedStopSequence returns the stop sequence that ended reply: the one
+// the server reported, if any, or else the longest of stops that reply
+// ends with, for servers that keep the sequence in the reply. Returns ""
+// if neither says.
+func firedStopSequence(reply string, stops []string, reported ...any) string {
+	for _, r := range reported {
+		if s, ok := r.(string); ok && s != "" {
+			return s
+		}
+	}
+	var fired string
+	for _, stop := range stops {
+		if stop != "" && len(stop) > len(fired) && strings.HasSuffix(reply, stop) {
+			fired = stop
+		}
+	}
+	return fired
+}
@@ -0,0 +1,70 @@
+package novelai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFiredStopSequence(t *testing.T) {
+	stops := []string{"<|user|>", "\n\n", "\n"}
+	tests := []struct {
+		reply    string
+		reported []any
+		want     string
+	}{
+		{"Hello", []any{"<|user|>"}, "<|user|>"},
+		{"Hello", []any{nil, "###"}, "###"},
+		{"Hello", []any{float64(151336)}, ""},
+		{"Hello\n\n", nil, "\n\n"},
+		{"Hello<|user|>", []any{nil}, "<|user|>"},
+		{"Hello", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := firedStopSequence(tt.reply, stops, tt.reported...); got != tt.want {
+			t.Errorf("firedStopSequence(%q, %v) = %q, want %q", tt.reply, tt.reported, got, tt.want)
+		}
+	}
+}
+
+func TestLastStopSequence(t *testing.T) {
+	finish := "stop"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"text\":\"Hi\",\"finish_reason\":%q,\"matched_stop\":\"***\"}]}\n\ndata: [DONE]\n\n", finish)
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"text":"Hi","finish_reason":%q,"stop_reason":"<|user|>"}]}`, finish)
+	}))
+	defer server.Close()
+	conv := NewConversation("System")
+	conv.Endpoint = server.URL
+	conv.ApiToken = "test-token"
+
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	if conv.LastStopSequence != "<|user|>" {
+		t.Errorf("Send: LastStopSequence = %q", conv.LastStopSequence)
+	}
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Again", SamplingProfile{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if conv.LastStopSequence != "***" {
+		t.Errorf("SendStreaming: LastStopSequence = %q", conv.LastStopSequence)
+	}
+
+	// A reply cut off by the token limit ended on no sequence
+	finish = "length"
+	if _, _, _, _, _, _, err := conv.SendWith("More", SamplingProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	if conv.LastStopSequence != "" {
+		t.Errorf("Length: LastStopSequence = %q", conv.LastStopSequence)
+	}
+}
@@ -0,0 +1,62 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStopReason(t *testing.T) {
+	for _, r := range StopReasons {
+		if !r.Known() || r.String() != string(r) {
+			t.Errorf("%q: Known = %v, String = %q", r, r.Known(), r.String())
+		}
+	}
+	if StopReason("content_filter").Known() {
+		t.Error("Unexpected known reason")
+	}
+	if got := normalizeStopReason("length"); StopReason(got) != StopMaxTokens {
+		t.Errorf("normalizeStopReason(length) = %q", got)
+	}
+}
+
+func TestStopCancelled(t *testing.T) {
+	fake := NewFakeBackend()
+	fake.Default = &FakeResponse{Text: "one two three four five six"}
+	fake.ChunkDelay = 20 * time.Millisecond
+	conv := NewConversation("System")
+	fake.Install(conv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conv.SetContext(ctx)
+	reply, stop, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, func(text string, done bool) {
+		if text != "" {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if StopReason(stop) != StopCancelled || reply == "" {
+		t.Errorf("Got %q, %q; want a partial reply with %q", reply, stop, StopCancelled)
+	}
+
+	// Non-streaming
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(mockCompletionResponse("Hello", "stop", 1, 1))
+	}))
+	defer server.Close()
+	conv = NewConversation("System")
+	conv.Endpoint = server.URL
+	conv.ApiToken = "test-token"
+	conv.SetContext(ctx)
+	_, stop, _, _, _, _, err = conv.SendWith("Hi", SamplingProfile{})
+	if !errors.Is(err, context.Canceled) || StopReason(stop) != StopCancelled {
+		t.Errorf("Got %q, %v", stop, err)
+	}
+}
@@ -0,0 +1,118 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// Files written by StoryRunner to its OutputDir.
+const (
+	// StoryFile holds the story so far, rewritten after each round.
+	StoryFile = "story.txt"
+	// ContextReportFile is the name format of each round's context report.
+	ContextReportFile = "context-%03d.json"
+)
+
+// StoryRound is the outcome of one StoryRunner round.
+type StoryRound struct {
+	// Round counts rounds from 1.
+	Round int
+	// Text is the generated continuation.
+	Text string
+	// Report traces the context the round was generated from, including
+	// which lorebook entries the story activated.
+	Report *ContextReport
+	// Length is the story's length in bytes after the round.
+	Length int
+}
+
+// StoryRunner generates a story from a scenario without a user: starting
+// from the scenario's prompt, each round builds the context from the
+// story so far, activating lore as the story introduces it, and appends a
+// continuation from the native API. It runs for Rounds rounds or until
+// the story reaches TargetLength, whichever comes first.
+type StoryRunner struct {
+	// Scenario provides the prompt, context, lorebook and parameters.
+	Scenario *Scenario
+	// Client generates the continuations.
+	Client *Client
+	// Tokenizer compiles the scenario's biases and banned sequences. It
+	// may be nil if the scenario has none.
+	Tokenizer Tokenizer
+	// Rounds is the most rounds to run. If zero, rounds run until
+	// TargetLength is reached.
+	Rounds int
+	// TargetLength, if set, ends the run once the story is at least this
+	// many bytes long.
+	TargetLength int
+	// OutputDir, if set, receives the story as StoryFile after each round
+	// and each round's context report as ContextReportFile.
+	OutputDir string
+	// OnRound, if set, is called after each round.
+	OnRound func(r StoryRound)
+}
+
+// NewStoryRunner creates a runner generating from s with client.
+func NewStoryRunner(s *Scenario, client *Client, tok Tokenizer) *StoryRunner {
+	return &StoryRunner{Scenario: s, Client: client, Tokenizer: tok}
+}
+
+// Run generates the story and returns it. On error, the story generated
+// so far is returned with the error.
+func (r *StoryRunner) Run(ctx context.Context) (string, error) {
+	if r.Rounds <= 0 && r.TargetLength <= 0 {
+		return "", fmt.Errorf("story runner needs Rounds or TargetLength")
+	}
+	story := r.Scenario.Prompt
+	for round := 1; r.Rounds <= 0 || round <= r.Rounds; round++ {
+		if r.TargetLength > 0 && len(story) >= r.TargetLength {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return story, err
+		}
+		req, err := NewGenerateRequest(r.Scenario, story, r.Tokenizer)
+		if err != nil {
+			return story, err
+		}
+		report := NewContextBuilder(r.Scenario).Report(story)
+		text, err := r.Client.Generate(ctx, req)
+		if err != nil {
+			return story, fmt.Errorf("error generating round %d: %w", round, err)
+		}
+		if text == "" {
+			return story, fmt.Errorf("round %d generated no text", round)
+		}
+		story += text
+
+		result := StoryRound{Round: round, Text: text, Report: report, Length: len(story)}
+		if err := r.write(result, story); err != nil {
+			return story, err
+		}
+		if r.OnRound != nil {
+			r.OnRound(result)
+		}
+	}
+	return story, nil
+}
+
+// write saves the story and the round's context report to OutputDir.
+func (r *StoryRunner) write(round StoryRound, story string) error {
+	if r.OutputDir == "" {
+		return nil
+	}
+	report, err := json.MarshalIndent(round.Report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling context report: %w", err)
+	}
+	path := filepath.Join(r.OutputDir, fmt.Sprintf(ContextReportFile, round.Round))
+	if err := writeFileAtomic(path, report); err != nil {
+		return fmt.Errorf("error writing context report: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(r.OutputDir, StoryFile), []byte(story)); err != nil {
+		return fmt.Errorf("error writing story: %w", err)
+	}
+	return nil
+}
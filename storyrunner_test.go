@@ -0,0 +1,108 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// storyServer answers native generation requests with outputs in turn and
+// records the inputs.
+func storyServer(t *testing.T, outputs ...string) (*Client, func() []string) {
+	var mu sync.Mutex
+	var inputs []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req GenerateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		inputs = append(inputs, req.Input)
+		out := outputs[min(len(inputs), len(outputs))-1]
+		json.NewEncoder(w).Encode(map[string]string{"output": out})
+	})
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), inputs...)
+	}
+}
+
+func TestStoryRunner(t *testing.T) {
+	s := NewScenario("Lighthouse")
+	s.Prompt = "The keeper climbed the stairs."
+	s.Lorebook.AddEntry(NewLorebookEntry("Lamp", "The lamp is cursed.", "lamp"))
+	client, inputs := storyServer(t, " He lit the lamp.", " It flickered.")
+
+	dir := t.TempDir()
+	runner := NewStoryRunner(s, client, nil)
+	runner.Rounds = 3
+	runner.OutputDir = dir
+	var rounds []StoryRound
+	runner.OnRound = func(r StoryRound) { rounds = append(rounds, r) }
+
+	story, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "The keeper climbed the stairs. He lit the lamp. It flickered. It flickered."
+	if story != want {
+		t.Errorf("story = %q, want %q", story, want)
+	}
+
+	// Lore activates once the story mentions the lamp
+	in := inputs()
+	if len(in) != 3 || strings.Contains(in[0], "cursed") || !strings.Contains(in[1], "cursed") {
+		t.Errorf("Expected lore in the second round only onwards, got %q", in)
+	}
+	if len(rounds) != 3 || rounds[1].Round != 2 || rounds[2].Length != len(want) {
+		t.Errorf("Unexpected rounds: %+v", rounds)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, StoryFile))
+	if err != nil || string(data) != want {
+		t.Errorf("story file = %q, %v", data, err)
+	}
+	var report ContextReport
+	data, err = os.ReadFile(filepath.Join(dir, "context-002.json"))
+	if err != nil || json.Unmarshal(data, &report) != nil || !strings.Contains(report.Context, "cursed") {
+		t.Errorf("Expected the second round's context report, got %q, %v", data, err)
+	}
+}
+
+func TestStoryRunnerTargetLength(t *testing.T) {
+	s := NewScenario("Loop")
+	s.Prompt = "Start."
+	client, inputs := storyServer(t, " More words.")
+
+	runner := NewStoryRunner(s, client, nil)
+	runner.TargetLength = 30
+	story, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if story != "Start. More words. More words." || len(inputs()) != 2 {
+		t.Errorf("Expected two rounds to reach the target, got %d rounds and %q", len(inputs()), story)
+	}
+
+	if _, err := NewStoryRunner(s, client, nil).Run(context.Background()); err == nil {
+		t.Error("Expected an error without Rounds or TargetLength")
+	}
+}
+
+func TestReadScenarioFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.scenario")
+	data, _ := json.Marshal(NewScenario("File"))
+	os.WriteFile(path, data, 0o644)
+	s, _, err := ReadScenarioFile(path, ParseStrict)
+	if err != nil || s.Title != "File" {
+		t.Errorf("ReadScenarioFile() = %+v, %v", s, err)
+	}
+	if _, _, err := ReadScenarioFile(filepath.Join(t.TempDir(), "missing"), ParseLenient); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
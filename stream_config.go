@@ -0,0 +1,224 @@
+package novelai
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReconnectDelay is the wait before the first reconnect of a dropped
+// stream when StreamConfig.ReconnectDelay is zero.
+const DefaultReconnectDelay = time.Second
+
+// errStreamIdle is the cause of a stream cancelled for sending nothing for
+// longer than StreamConfig.IdleTimeout.
+var errStreamIdle = errors.New("stream idle timeout")
+
+// StreamConfig configures the connection of streaming requests, for
+// networks whose proxies buffer or drop long-lived responses.
+//
+// Set the fields before first use; they must not change afterwards.
+type StreamConfig struct {
+	// Proxy, if set, selects the proxy for streaming requests, as in
+	// http.Transport. It applies when the conversation's transport is an
+	// *http.Transport, or unset; other transports are used as is.
+	Proxy func(*http.Request) (*url.URL, error)
+	// ResponseHeaderTimeout, if set, limits the wait for the response
+	// headers, replacing the timeout taken from HttpClient.
+	ResponseHeaderTimeout time.Duration
+	// IdleTimeout, if set, treats a stream that sends nothing for this
+	// long as dropped. Servers send keepalive comments while generating
+	// slowly; these count as activity.
+	IdleTimeout time.Duration
+	// MaxReconnects is how many times a stream that ends before the reply
+	// does, through an early EOF, a read error or IdleTimeout, is resumed.
+	// The reconnect continues the reply with what was received as part of
+	// the prompt, so the callback sees one uninterrupted reply. If zero, a
+	// dropped stream ends the reply with the text received so far.
+	MaxReconnects int
+	// ReconnectDelay is the wait before the first reconnect, doubled for
+	// each later one. If zero, DefaultReconnectDelay is used.
+	ReconnectDelay time.Duration
+	// ForceHTTP1 makes streaming requests use HTTP/1.1, for middleboxes
+	// that mangle HTTP/2 streams. Like Proxy, it applies to an
+	// *http.Transport or the default transport.
+	ForceHTTP1 bool
+	// OnConnection, if set, is called with the connection details of each
+	// streaming request once its response starts. See LogConnections.
+	OnConnection func(ConnectionInfo)
+
+	mu sync.Mutex
+	// base and configured are the last transport configured and its copy
+	// using Proxy and ForceHTTP1, kept so that connections are reused.
+	base       http.RoundTripper
+	configured http.RoundTripper
+}
+
+// streamConfig returns StreamConfig, or an empty config if unset.
+func (c *Conversation) streamConfig() *StreamConfig {
+	if c.StreamConfig != nil {
+		return c.StreamConfig
+	}
+	return &StreamConfig{}
+}
+
+// transport returns base configured with Proxy and ForceHTTP1, or base if
+// it cannot be.
+func (cfg *StreamConfig) transport(base http.RoundTripper) http.RoundTripper {
+	if cfg.Proxy == nil && !cfg.ForceHTTP1 {
+		return base
+	}
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.configured != nil && cfg.base == base {
+		return cfg.configured
+	}
+	t, ok := base.(*http.Transport)
+	if base == nil {
+		t, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return base
+	}
+	t = t.Clone()
+	if cfg.Proxy != nil {
+		t.Proxy = cfg.Proxy
+	}
+	if cfg.ForceHTTP1 {
+		// A non-nil empty TLSNextProto disables HTTP/2
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	cfg.base, cfg.configured = base, t
+	return t
+}
+
+// reconnectDelay returns the wait before reconnect attempt+1.
+func (cfg *StreamConfig) reconnectDelay(attempt int) time.Duration {
+	delay := cfg.ReconnectDelay
+	if delay <= 0 {
+		delay = DefaultReconnectDelay
+	}
+	return delay << min(attempt, 16)
+}
+
+// sleepContext waits for d, returning false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// idleReader calls onIdle if no data is read from r for timeout.
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newIdleReader starts watching r for inactivity.
+func newIdleReader(r io.Reader, timeout time.Duration, onIdle func()) *idleReader {
+	return &idleReader{r: r, timeout: timeout, timer: time.AfterFunc(timeout, onIdle)}
+}
+
+// Read implements io.Reader, restarting the idle timer on data.
+func (ir *idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.Reset(ir.timeout)
+	}
+	return n, err
+}
+
+// stop stops watching for inactivity.
+func (ir *idleReader) stop() {
+	ir.timer.Stop()
+}
+
+// ConnectionInfo describes the connection of a streaming request, for
+// diagnosing flaky streams.
+type ConnectionInfo struct {
+	// Protocol is the response's protocol, such as "HTTP/1.1" or
+	// "HTTP/2.0".
+	Protocol string
+	// RemoteAddr is the address connected to, which is the proxy's when
+	// there is one.
+	RemoteAddr string
+	// Reused reports whether the connection was reused from an earlier
+	// request, and IdleTime how long it had been idle.
+	Reused   bool
+	IdleTime time.Duration
+	// TLSVersion, CipherSuite and ALPN describe the TLS session; they are
+	// empty without TLS.
+	TLSVersion  string
+	CipherSuite string
+	ALPN        string
+}
+
+// String summarizes the connection on one line.
+func (ci ConnectionInfo) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s to %s", ci.Protocol, ci.RemoteAddr)
+	if ci.TLSVersion != "" {
+		fmt.Fprintf(&b, ", %s %s", ci.TLSVersion, ci.CipherSuite)
+		if ci.ALPN != "" {
+			fmt.Fprintf(&b, " (ALPN %s)", ci.ALPN)
+		}
+	}
+	if ci.Reused {
+		fmt.Fprintf(&b, ", reused after %v idle", ci.IdleTime)
+	} else {
+		b.WriteString(", new connection")
+	}
+	return b.String()
+}
+
+// trace returns ctx with a trace filling in the connection details.
+func (ci *ConnectionInfo) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			ci.Reused, ci.IdleTime = info.Reused, info.IdleTime
+			if info.Conn != nil {
+				ci.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+	})
+}
+
+// setResponse fills in the protocol and TLS details of resp.
+func (ci *ConnectionInfo) setResponse(resp *http.Response) {
+	ci.Protocol = resp.Proto
+	if resp.TLS != nil {
+		ci.TLSVersion = tls.VersionName(resp.TLS.Version)
+		ci.CipherSuite = tls.CipherSuiteName(resp.TLS.CipherSuite)
+		ci.ALPN = resp.TLS.NegotiatedProtocol
+	}
+}
+
+// LogConnections returns an OnConnection function writing each connection
+// to w on one line.
+func LogConnections(w io.Writer) func(ConnectionInfo) {
+	var mu sync.Mutex
+	return func(ci ConnectionInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "novelai: stream connection: %s\n", ci)
+	}
+}
@@ -0,0 +1,211 @@
+package novelai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newDroppingServer returns a conversation streaming from a server that
+// calls drop for each request in turn, then finishes the reply.
+func newDroppingServer(t *testing.T, drops ...func(w http.ResponseWriter, r *http.Request)) (*Conversation, func() []completionRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var reqs []completionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		reqs = append(reqs, req)
+		n := len(reqs)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		if n <= len(drops) {
+			drops[n-1](w, r)
+			return
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"text\":\" world\",\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	conv := NewConversation("")
+	conv.ApiToken = "test-token"
+	conv.Endpoint = server.URL
+	return conv, func() []completionRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]completionRequest(nil), reqs...)
+	}
+}
+
+// sendHello streams "Hello" and ends the response without finishing.
+func sendHello(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "data: {\"choices\":[{\"text\":\"Hello\"}]}\n\n")
+}
+
+func TestStreamReconnect(t *testing.T) {
+	conv, reqs := newDroppingServer(t, sendHello)
+	conv.Settings.MaxTokens = 100
+	conv.StreamConfig = &StreamConfig{MaxReconnects: 2, ReconnectDelay: time.Millisecond}
+	var streamed strings.Builder
+	reply, stop, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, func(text string, done bool) {
+		streamed.WriteString(text)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Hello world" || stop != "end_turn" || streamed.String() != reply {
+		t.Errorf("Got %q (%s), streamed %q", reply, stop, streamed.String())
+	}
+	got := reqs()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(got))
+	}
+	if !strings.HasSuffix(got[1].Prompt, got[0].Prompt[len(got[0].Prompt)-10:]+"Hello") || got[1].MaxTokens != 99 {
+		t.Errorf("Expected resumed prompt and reduced limit, got %q, %d", got[1].Prompt, got[1].MaxTokens)
+	}
+	if last := conv.Messages[len(conv.Messages)-1]; last.Content != "Hello world" {
+		t.Errorf("Unexpected history: %q", last.Content)
+	}
+}
+
+func TestStreamWithoutReconnect(t *testing.T) {
+	conv, reqs := newDroppingServer(t, sendHello)
+	reply, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, nil)
+	if err != nil || reply != "Hello" || len(reqs()) != 1 {
+		t.Errorf("Got %q, %v after %d requests", reply, err, len(reqs()))
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	hang := func(w http.ResponseWriter, r *http.Request) {
+		sendHello(w, r)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+	conv, reqs := newDroppingServer(t, hang)
+	conv.StreamConfig = &StreamConfig{IdleTimeout: 50 * time.Millisecond, MaxReconnects: 1, ReconnectDelay: time.Millisecond}
+	reply, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, nil)
+	if err != nil || reply != "Hello world" || len(reqs()) != 2 {
+		t.Errorf("Got %q, %v after %d requests", reply, err, len(reqs()))
+	}
+
+	// Without reconnects, the idle stream is an error
+	conv, _ = newDroppingServer(t, hang)
+	conv.StreamConfig = &StreamConfig{IdleTimeout: 50 * time.Millisecond}
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, nil); !errors.Is(err, errStreamIdle) {
+		t.Errorf("Expected idle error, got %v", err)
+	}
+}
+
+func TestStreamKeepalive(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 6; i++ {
+			fmt.Fprint(w, ": keepalive\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"text\":\"Hello\",\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}
+	conv, reqs := newDroppingServer(t, slow)
+	conv.StreamConfig = &StreamConfig{IdleTimeout: 60 * time.Millisecond, MaxReconnects: 1}
+	reply, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, nil)
+	if err != nil || reply != "Hello" || len(reqs()) != 1 {
+		t.Errorf("Got %q, %v after %d requests", reply, err, len(reqs()))
+	}
+}
+
+func TestStreamConfigTransport(t *testing.T) {
+	var proxied int
+	conv, _ := newDroppingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	})
+	conv.StreamConfig = &StreamConfig{
+		Proxy: func(r *http.Request) (*url.URL, error) {
+			proxied++
+			return nil, nil
+		},
+		ResponseHeaderTimeout: 20 * time.Millisecond,
+	}
+	conv.Retry = &RetryPolicy{}
+	_, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, nil)
+	if !errors.Is(err, errStreamHeaderTimeout) {
+		t.Errorf("Expected header timeout, got %v", err)
+	}
+	if proxied != 1 {
+		t.Errorf("Expected the proxy to be consulted once, got %d", proxied)
+	}
+
+	// The proxied transport is reused
+	client, _ := conv.streamingClient()
+	again, _ := conv.streamingClient()
+	if client.Transport != again.Transport {
+		t.Error("Expected the proxied transport to be reused")
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	cfg := &StreamConfig{ReconnectDelay: 10 * time.Millisecond}
+	if d := cfg.reconnectDelay(2); d != 40*time.Millisecond {
+		t.Errorf("reconnectDelay(2) = %v", d)
+	}
+	if d := (&StreamConfig{}).reconnectDelay(0); d != DefaultReconnectDelay {
+		t.Errorf("reconnectDelay(0) = %v", d)
+	}
+}
+
+func TestStreamConnectionDiagnostics(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"text\":\"Hi\",\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	send := func(force bool) []ConnectionInfo {
+		var infos []ConnectionInfo
+		conv := NewConversation("")
+		conv.ApiToken = "test-token"
+		conv.Endpoint = server.URL
+		conv.HttpClient = server.Client()
+		conv.StreamConfig = &StreamConfig{
+			ForceHTTP1:   force,
+			OnConnection: func(ci ConnectionInfo) { infos = append(infos, ci) },
+		}
+		for i := 0; i < 2; i++ {
+			if _, _, _, _, _, _, err := conv.SendStreamingWith("Hi", SamplingProfile{}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return infos
+	}
+
+	infos := send(false)
+	if len(infos) != 2 || infos[0].Protocol != "HTTP/2.0" || infos[0].ALPN != "h2" || infos[0].TLSVersion == "" {
+		t.Fatalf("Unexpected HTTP/2 connections: %+v", infos)
+	}
+	if infos[0].Reused || !infos[1].Reused {
+		t.Errorf("Expected the second request to reuse the connection: %+v", infos)
+	}
+
+	infos = send(true)
+	if len(infos) != 2 || infos[0].Protocol != "HTTP/1.1" || infos[0].ALPN == "h2" {
+		t.Fatalf("Unexpected HTTP/1.1 connections: %+v", infos)
+	}
+	if !infos[1].Reused {
+		t.Errorf("Expected the forced transport to be reused: %+v", infos)
+	}
+
+	var log strings.Builder
+	LogConnections(&log)(infos[1])
+	if !strings.Contains(log.String(), "HTTP/1.1 to 127.0.0.1:") || !strings.Contains(log.String(), "reused after") {
+		t.Errorf("Unexpected log line: %q", log.String())
+	}
+}
@@ -0,0 +1,81 @@
+package novelai
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TagIncomplete tags a partial reply kept in the history after its stream
+// failed; see Settings.KeepPartialReplies.
+const TagIncomplete = "incomplete"
+
+// StreamError is returned when a stream fails after text was received, so
+// that the text is not lost. errors.Is and errors.As see through it to
+// Cause.
+type StreamError struct {
+	// PartialText is the reply received before the failure, as passed to
+	// the callback.
+	PartialText string
+	// ChunksReceived is the number of stream chunks with text received.
+	ChunksReceived int
+	// StopReason is the stop reason of the partial reply, such as
+	// StopCancelled, or "" if the stream broke off.
+	StopReason string
+	// InputTokens and OutputTokens are the usage of the partial reply,
+	// as reported or estimated from the chunks.
+	InputTokens  int
+	OutputTokens int
+	// Committed reports whether the partial reply was added to the
+	// history, tagged TagIncomplete.
+	Committed bool
+	// Cause is the error that ended the stream.
+	Cause error
+}
+
+// Error implements error.
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream failed after %d chunks: %v", e.ChunksReceived, e.Cause)
+}
+
+// Unwrap returns Cause.
+func (e *StreamError) Unwrap() error {
+	return e.Cause
+}
+
+// PartialReply returns the partial text of a stream that failed with err,
+// if err is or wraps a StreamError.
+func PartialReply(err error) (string, bool) {
+	var se *StreamError
+	if errors.As(err, &se) {
+		return se.PartialText, true
+	}
+	return "", false
+}
+
+// streamError wraps err, the failure of a stream, in a StreamError if st
+// received text. With settings.KeepPartialReplies, the partial reply is
+// added to the history and its usage counted.
+func (c *Conversation) streamError(err error, st *streamState, settings *Settings, timing *requestTimer) error {
+	reply, stopReason, inputTokens, outputTokens := st.result()
+	if reply == "" {
+		return err
+	}
+	se := &StreamError{
+		PartialText:    reply,
+		ChunksReceived: st.tokenCount,
+		StopReason:     c.errorStopReason(c.context(), stopReason),
+		InputTokens:    inputTokens,
+		OutputTokens:   outputTokens,
+		Cause:          err,
+	}
+	if settings.KeepPartialReplies {
+		c.Messages = append(c.Messages, Message{Role: "assistant", Content: reply, Tags: []string{TagIncomplete}})
+		c.lastActive = time.Now()
+		c.Usage.InputTokens += inputTokens
+		c.Usage.OutputTokens += outputTokens
+		c.recordTurn(timing, reply, se.StopReason, inputTokens, outputTokens)
+		se.Committed = true
+	}
+	return se
+}
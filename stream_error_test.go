@@ -0,0 +1,72 @@
+package novelai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// brokenStreamServer streams two chunks and then breaks off with a
+// malformed chunked response.
+func brokenStreamServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"text\":\"Once upon\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"text\":\" a time\"}]}\n\n")
+		w.(http.Flusher).Flush()
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		buf.WriteString("zz\r\n")
+		buf.Flush()
+		conn.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStreamError(t *testing.T) {
+	conv := NewConversation("System")
+	conv.Endpoint = brokenStreamServer(t).URL
+	conv.ApiToken = "test-token"
+
+	var streamed strings.Builder
+	reply, _, _, _, _, _, err := conv.SendStreamingWith("Tell a story", SamplingProfile{}, func(text string, done bool) {
+		streamed.WriteString(text)
+	})
+	var se *StreamError
+	if !errors.As(err, &se) {
+		t.Fatalf("Expected a StreamError, got %v", err)
+	}
+	if se.PartialText != "Once upon a time" || se.ChunksReceived != 2 || se.Cause == nil || se.Committed {
+		t.Errorf("Got %+v", se)
+	}
+	if reply != se.PartialText || streamed.String() != se.PartialText {
+		t.Errorf("reply %q, streamed %q", reply, streamed.String())
+	}
+	if partial, ok := PartialReply(err); !ok || partial != "Once upon a time" {
+		t.Errorf("PartialReply = %q, %v", partial, ok)
+	}
+	if last := conv.Messages[len(conv.Messages)-1]; last.Role != "user" {
+		t.Errorf("Partial reply added to history: %+v", last)
+	}
+
+	// Kept in the history, marked incomplete
+	conv.Settings.KeepPartialReplies = true
+	_, _, _, _, _, _, err = conv.SendStreamingWith("", SamplingProfile{}, nil)
+	if !errors.As(err, &se) || !se.Committed {
+		t.Fatalf("Expected a committed StreamError, got %v", err)
+	}
+	last := conv.Messages[len(conv.Messages)-1]
+	if last.Role != "assistant" || last.Content != "Once upon a time" || !last.HasTag(TagIncomplete) {
+		t.Errorf("Got last message %+v", last)
+	}
+	if conv.Usage.OutputTokens != 2 || len(conv.Turns) != 1 {
+		t.Errorf("Usage %+v, %d turns", conv.Usage, len(conv.Turns))
+	}
+
+	if _, ok := PartialReply(errors.New("other")); ok {
+		t.Error("PartialReply of an unrelated error")
+	}
+}
@@ -0,0 +1,208 @@
+package novelai
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// StreamEventKind identifies a higher-level streaming event.
+type StreamEventKind string
+
+const (
+	// EventSentence is emitted when a sentence is complete.
+	EventSentence StreamEventKind = "sentence"
+	// EventParagraph is emitted when a paragraph is complete.
+	EventParagraph StreamEventKind = "paragraph"
+	// EventThinkingStart is emitted when a <think> block opens.
+	EventThinkingStart StreamEventKind = "thinking_start"
+	// EventThinkingEnd is emitted when a <think> block closes.
+	EventThinkingEnd StreamEventKind = "thinking_end"
+	// EventDone is emitted once when the stream ends.
+	EventDone StreamEventKind = "done"
+)
+
+// StreamEvent is a natural boundary detected in streamed text.
+type StreamEvent struct {
+	Kind StreamEventKind
+	// Text is the completed sentence or paragraph, trimmed of surrounding
+	// whitespace. Empty for other kinds.
+	Text string
+	// Thinking is true for sentences and paragraphs inside a <think> block.
+	Thinking bool
+}
+
+// Think block tags recognized by StreamAggregator.
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// StreamAggregator turns raw token deltas into sentence, paragraph and
+// thinking events. Sentences end at terminal punctuation (optionally
+// followed by closing quotes or brackets) and whitespace, or at a newline.
+// Paragraphs end at a newline. Events are delivered synchronously from
+// Write and Flush.
+type StreamAggregator struct {
+	// OnEvent receives each event.
+	OnEvent func(StreamEvent)
+
+	pending   string // unscanned text, possibly ending in a partial tag
+	sentence  string // text of the current, incomplete sentence
+	paragraph strings.Builder
+	thinking  bool
+	done      bool
+}
+
+// NewStreamAggregator creates an aggregator that delivers events to onEvent.
+func NewStreamAggregator(onEvent func(StreamEvent)) *StreamAggregator {
+	return &StreamAggregator{OnEvent: onEvent}
+}
+
+// Callback returns a StreamCallback that feeds the aggregator and flushes
+// it when the stream is done. If next is non-nil, every delta is also
+// passed through to it.
+func (a *StreamAggregator) Callback(next StreamCallback) StreamCallback {
+	return func(text string, done bool) {
+		if next != nil {
+			next(text, done)
+		}
+		a.Write(text)
+		if done {
+			a.Flush()
+		}
+	}
+}
+
+// Write adds a token delta.
+func (a *StreamAggregator) Write(delta string) {
+	a.pending += delta
+	for a.pending != "" {
+		tag := thinkOpen
+		if a.thinking {
+			tag = thinkClose
+		}
+		if i := strings.Index(a.pending, tag); i >= 0 {
+			a.feed(a.pending[:i])
+			a.pending = a.pending[i+len(tag):]
+			a.endParagraph()
+			a.thinking = !a.thinking
+			if a.thinking {
+				a.emit(StreamEvent{Kind: EventThinkingStart})
+			} else {
+				a.emit(StreamEvent{Kind: EventThinkingEnd})
+			}
+			continue
+		}
+		// Hold back a suffix that could be the start of the tag
+		keep := partialSuffix(a.pending, tag)
+		a.feed(a.pending[:len(a.pending)-keep])
+		a.pending = a.pending[len(a.pending)-keep:]
+		return
+	}
+}
+
+// Flush completes any pending sentence and paragraph, closes an unclosed
+// think block, and emits EventDone. Later calls do nothing.
+func (a *StreamAggregator) Flush() {
+	if a.done {
+		return
+	}
+	a.feed(a.pending)
+	a.pending = ""
+	a.endParagraph()
+	if a.thinking {
+		a.thinking = false
+		a.emit(StreamEvent{Kind: EventThinkingEnd})
+	}
+	a.done = true
+	a.emit(StreamEvent{Kind: EventDone})
+}
+
+// feed scans text for sentence and paragraph boundaries.
+func (a *StreamAggregator) feed(text string) {
+	a.sentence += text
+	for {
+		end, newline, ok := sentenceBoundary(a.sentence)
+		if !ok {
+			return
+		}
+		raw, rest := a.sentence[:end], a.sentence[end:]
+		a.sentence = ""
+		a.endSentence(raw)
+		if newline {
+			a.endParagraph()
+		}
+		a.sentence = rest
+	}
+}
+
+// endSentence emits a completed sentence and adds it to the paragraph.
+func (a *StreamAggregator) endSentence(raw string) {
+	a.paragraph.WriteString(raw)
+	if text := strings.TrimSpace(raw); text != "" {
+		a.emit(StreamEvent{Kind: EventSentence, Text: text, Thinking: a.thinking})
+	}
+}
+
+// endParagraph emits the current paragraph, including any incomplete sentence.
+func (a *StreamAggregator) endParagraph() {
+	a.endSentence(a.sentence)
+	a.sentence = ""
+	text := strings.TrimSpace(a.paragraph.String())
+	a.paragraph.Reset()
+	if text != "" {
+		a.emit(StreamEvent{Kind: EventParagraph, Text: text, Thinking: a.thinking})
+	}
+}
+
+// emit delivers an event if a handler is set.
+func (a *StreamAggregator) emit(e StreamEvent) {
+	if a.OnEvent != nil {
+		a.OnEvent(e)
+	}
+}
+
+// sentenceBoundary finds the end of the first complete sentence in s.
+// Returns the index just past the sentence (including a terminating newline
+// or space), whether the sentence ended at a newline, and false if no
+// sentence is complete yet.
+func sentenceBoundary(s string) (end int, newline bool, ok bool) {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\n':
+			return i + size, true, true
+		case strings.ContainsRune(".!?…", r):
+			j := i + size
+			for j < len(s) {
+				next, n := utf8.DecodeRuneInString(s[j:])
+				if !strings.ContainsRune(".!?…\"'”’)]", next) {
+					break
+				}
+				j += n
+			}
+			if j == len(s) {
+				// Can't tell yet whether the sentence ends here
+				return 0, false, false
+			}
+			if s[j] == ' ' || s[j] == '\t' {
+				return j + 1, false, true
+			}
+			i = j
+			continue
+		}
+		i += size
+	}
+	return 0, false, false
+}
+
+// partialSuffix returns the length of the longest suffix of s that is a
+// proper prefix of tag.
+func partialSuffix(s, tag string) int {
+	for n := min(len(tag)-1, len(s)); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package novelai
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// collectEvents streams deltas through an aggregator and returns the events.
+func collectEvents(deltas ...string) []StreamEvent {
+	var events []StreamEvent
+	agg := NewStreamAggregator(func(e StreamEvent) { events = append(events, e) })
+	callback := agg.Callback(nil)
+	for _, d := range deltas {
+		callback(d, false)
+	}
+	callback("", true)
+	return events
+}
+
+// TestStreamAggregatorSentences tests sentence and paragraph events.
+func TestStreamAggregatorSentences(t *testing.T) {
+	events := collectEvents("Hel", "lo there", ". It is 3.", "14 o'clock", "! \"Really?\" ", "she asked.\nNew ", "para")
+
+	expected := []StreamEvent{
+		{Kind: EventSentence, Text: "Hello there."},
+		{Kind: EventSentence, Text: "It is 3.14 o'clock!"},
+		{Kind: EventSentence, Text: `"Really?"`},
+		{Kind: EventSentence, Text: "she asked."},
+		{Kind: EventParagraph, Text: `Hello there. It is 3.14 o'clock! "Really?" she asked.`},
+		{Kind: EventSentence, Text: "New para"},
+		{Kind: EventParagraph, Text: "New para"},
+		{Kind: EventDone},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Unexpected events:\n%+v\nexpected:\n%+v", events, expected)
+	}
+}
+
+// TestStreamAggregatorThinking tests think tags split across deltas.
+func TestStreamAggregatorThinking(t *testing.T) {
+	events := collectEvents("<thi", "nk>Let me think. Ok.</th", "ink>\n\nThe answer is 4.")
+
+	var kinds []string
+	for _, e := range events {
+		s := string(e.Kind)
+		if e.Thinking {
+			s += "*"
+		}
+		if e.Text != "" {
+			s += ":" + e.Text
+		}
+		kinds = append(kinds, s)
+	}
+	expected := []string{
+		"thinking_start",
+		"sentence*:Let me think.",
+		"sentence*:Ok.",
+		"paragraph*:Let me think. Ok.",
+		"thinking_end",
+		"sentence:The answer is 4.",
+		"paragraph:The answer is 4.",
+		"done",
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Unexpected events:\n%s\nexpected:\n%s", strings.Join(kinds, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+// TestStreamAggregatorPassThrough tests delta forwarding and unclosed think blocks.
+func TestStreamAggregatorPassThrough(t *testing.T) {
+	var forwarded strings.Builder
+	var events []StreamEvent
+	agg := NewStreamAggregator(func(e StreamEvent) { events = append(events, e) })
+	callback := agg.Callback(func(text string, done bool) { forwarded.WriteString(text) })
+
+	callback("<think>Hmm <", false)
+	callback("", true)
+	agg.Flush()
+
+	if forwarded.String() != "<think>Hmm <" {
+		t.Errorf("Expected deltas forwarded, got %q", forwarded.String())
+	}
+	last := len(events) - 1
+	if events[last].Kind != EventDone || events[last-1].Kind != EventThinkingEnd {
+		t.Errorf("Expected unclosed think block closed before done, got %+v", events)
+	}
+	if events[last-2].Text != "Hmm <" {
+		t.Errorf("Expected held-back partial tag flushed as text, got %+v", events[last-2])
+	}
+	done := 0
+	for _, e := range events {
+		if e.Kind == EventDone {
+			done++
+		}
+	}
+	if done != 1 {
+		t.Errorf("Expected one done event, got %d", done)
+	}
+}
+
+// TestStreamAggregatorSendStreaming tests events from a streamed reply.
+func TestStreamAggregatorSendStreaming(t *testing.T) {
+	fake := NewFakeBackend().On(`.`, FakeResponse{Chunks: []string{"First line", ".\nSecond", " line."}})
+	conv := NewConversation("")
+	fake.Install(conv)
+
+	var paragraphs []string
+	agg := NewStreamAggregator(func(e StreamEvent) {
+		if e.Kind == EventParagraph {
+			paragraphs = append(paragraphs, e.Text)
+		}
+	})
+	if _, _, _, _, _, _, err := conv.SendStreaming("Go", llmapi.Sampling{}, agg.Callback(nil)); err != nil {
+		t.Fatalf("SendStreaming failed: %v", err)
+	}
+	if !reflect.DeepEqual(paragraphs, []string{"First line.", "Second line."}) {
+		t.Errorf("Unexpected paragraphs: %q", paragraphs)
+	}
+}
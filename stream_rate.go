@@ -0,0 +1,121 @@
+package novelai
+
+import (
+	"sync"
+	"time"
+)
+
+// StreamRate limits how fast streamed text reaches the callback, for
+// consumers such as websockets or chat message edits that cannot keep up
+// with fast generations. The zero value disables it.
+type StreamRate struct {
+	// TokensPerSecond, if set, caps the average rate text is passed on.
+	// Tokens are counted as stream chunks; text arriving faster is held
+	// back and passed on joined.
+	TokensPerSecond float64
+	// BatchInterval, if set, passes on text at most once per interval,
+	// joining the chunks received in between.
+	BatchInterval time.Duration
+}
+
+// Enabled reports whether r limits the stream.
+func (r StreamRate) Enabled() bool {
+	return r.TokensPerSecond > 0 || r.BatchInterval > 0
+}
+
+// StreamLimiter passes streamed text on at the pace set by a StreamRate.
+// Text is passed on at once when the rate allows, and otherwise joined
+// with what follows and passed on when it next does, from a timer. Calls
+// to emit are never concurrent.
+type StreamLimiter struct {
+	rate StreamRate
+	emit StreamCallback
+
+	mu      sync.Mutex
+	pending string
+	tokens  int
+	// next is the earliest time text may be passed on again, and timer,
+	// if set, passes on the pending text then.
+	next  time.Time
+	timer *time.Timer
+}
+
+// NewStreamLimiter creates a limiter passing text to emit at rate.
+func NewStreamLimiter(rate StreamRate, emit StreamCallback) *StreamLimiter {
+	return &StreamLimiter{rate: rate, emit: emit}
+}
+
+// Callback returns a StreamCallback that feeds the limiter and, when the
+// stream is done, flushes it and passes done on. Use it as the callback of
+// SendStreaming.
+func (l *StreamLimiter) Callback() StreamCallback {
+	return func(text string, done bool) {
+		l.Write(text)
+		if done {
+			l.Flush()
+			l.emit("", true)
+		}
+	}
+}
+
+// Write adds streamed text, passing it on if the rate allows.
+func (l *StreamLimiter) Write(text string) {
+	if text == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending += text
+	l.tokens++
+	if l.timer != nil {
+		return
+	}
+	wait := time.Until(l.next)
+	if wait <= 0 {
+		l.emitPending()
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(wait, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.timer == t {
+			l.timer = nil
+			l.emitPending()
+		}
+	})
+	l.timer = t
+}
+
+// Flush waits until the rate allows, then passes on any held-back text.
+func (l *StreamLimiter) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if l.pending == "" {
+		return
+	}
+	if wait := time.Until(l.next); wait > 0 {
+		time.Sleep(wait)
+	}
+	l.emitPending()
+}
+
+// emitPending passes on the pending text and sets when text may next be
+// passed on. Must be called with the lock held.
+func (l *StreamLimiter) emitPending() {
+	if l.pending == "" {
+		return
+	}
+	text, tokens := l.pending, l.tokens
+	l.pending, l.tokens = "", 0
+	gap := l.rate.BatchInterval
+	if l.rate.TokensPerSecond > 0 {
+		gap = max(gap, time.Duration(float64(tokens)/l.rate.TokensPerSecond*float64(time.Second)))
+	}
+	l.next = time.Now().Add(gap)
+	l.emit(text, false)
+}
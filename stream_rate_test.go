@@ -0,0 +1,101 @@
+package novelai
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// limiterOutput records what a StreamLimiter passes on and when.
+type limiterOutput struct {
+	mu    sync.Mutex
+	texts []string
+	times []time.Time
+	done  bool
+}
+
+func (o *limiterOutput) emit(text string, done bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if text != "" {
+		o.texts = append(o.texts, text)
+		o.times = append(o.times, time.Now())
+	}
+	o.done = o.done || done
+}
+
+func TestStreamLimiterTokensPerSecond(t *testing.T) {
+	var out limiterOutput
+	l := NewStreamLimiter(StreamRate{TokensPerSecond: 20}, out.emit)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		l.Write("x")
+	}
+	out.mu.Lock()
+	if len(out.texts) != 1 {
+		t.Errorf("Expected the first chunk at once, got %q", out.texts)
+	}
+	out.mu.Unlock()
+	time.Sleep(80 * time.Millisecond)
+	l.Write("y")
+	l.Flush()
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if strings.Join(out.texts, "") != "xxxxxxxxxxy" || len(out.texts) != 3 {
+		t.Fatalf("Unexpected output: %q", out.texts)
+	}
+	// One token allows the next batch after 50ms; nine after 450ms more
+	if d := out.times[1].Sub(start); d < 45*time.Millisecond || d > 80*time.Millisecond {
+		t.Errorf("Second batch after %v", d)
+	}
+	if d := out.times[2].Sub(out.times[1]); d < 440*time.Millisecond {
+		t.Errorf("Flush did not wait for the rate: %v", d)
+	}
+}
+
+func TestStreamLimiterBatchInterval(t *testing.T) {
+	var out limiterOutput
+	cb := NewStreamLimiter(StreamRate{BatchInterval: 40 * time.Millisecond}, out.emit).Callback()
+	for i := 0; i < 20; i++ {
+		cb("ab", false)
+		time.Sleep(5 * time.Millisecond)
+	}
+	cb("", true)
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if strings.Join(out.texts, "") != strings.Repeat("ab", 20) || !out.done {
+		t.Fatalf("Unexpected output: %q, done %v", out.texts, out.done)
+	}
+	if len(out.texts) < 2 || len(out.texts) > 5 {
+		t.Errorf("Expected a few batches, got %d", len(out.texts))
+	}
+	for i := 1; i < len(out.times); i++ {
+		if gap := out.times[i].Sub(out.times[i-1]); gap < 35*time.Millisecond {
+			t.Errorf("Batches %d and %d only %v apart", i-1, i, gap)
+		}
+	}
+}
+
+func TestStreamingRateLimit(t *testing.T) {
+	conv := NewConversation("")
+	NewFakeBackend().On(`.`, FakeResponse{
+		Text:   "one two three four five",
+		Chunks: []string{"one", " two", " three", " four", " five"},
+	}).Install(conv)
+	conv.Settings.StreamRate = StreamRate{BatchInterval: 50 * time.Millisecond}
+
+	var out limiterOutput
+	reply, _, _, _, _, _, err := conv.SendStreamingWith("Count", SamplingProfile{}, out.emit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "one two three four five" || strings.Join(out.texts, "") != reply || !out.done {
+		t.Errorf("Got %q, streamed %q", reply, out.texts)
+	}
+	if len(out.texts) != 2 {
+		t.Errorf("Expected the first chunk, then the rest batched, got %q", out.texts)
+	}
+}
@@ -1,14 +1,15 @@
 package novelai
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/wbrown/llmapi"
 )
@@ -16,11 +17,16 @@ import (
 // StreamCallback is an alias for llmapi.StreamCallback for backwards compatibility.
 type StreamCallback = llmapi.StreamCallback
 
+// sseDataPrefix starts each SSE data line.
+var sseDataPrefix = []byte("data: ")
+
 // SendStreaming sends a message with real-time token streaming via SSE.
 // The callback is invoked for each token received.
 // Sampling parameters override conversation defaults for this call only.
 //
 // Returns the same values as Send, but the callback receives tokens as they arrive.
+// With a Translator, streamed tokens are in the model's language and only the
+// returned reply is translated.
 // cacheCreationTokens and cacheReadTokens are always 0 (NovelAI doesn't report cache stats).
 func (c *Conversation) SendStreaming(text string, sampling llmapi.Sampling, callback llmapi.StreamCallback) (
 	reply string,
@@ -30,10 +36,84 @@ func (c *Conversation) SendStreaming(text string, sampling llmapi.Sampling, call
 	cacheCreationTokens int,
 	cacheReadTokens int,
 	err error,
+) {
+	return c.sendStreaming(text, &c.Settings, SamplingOverrides(sampling), callback)
+}
+
+// sendStreaming implements SendStreaming using settings in place of
+// c.Settings, with overrides applied on top. A reply shorter than
+// settings.MinTokens is continued in the same stream: callback sees done
+// only once, at the end. ThinkingRetention is applied after the reply.
+func (c *Conversation) sendStreaming(text string, settings *Settings, overrides SamplingProfile,
+	callback llmapi.StreamCallback) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
+) {
+	ctx := c.context()
+	segment := callback
+	if settings.MinTokens > 0 && callback != nil {
+		var done bool
+		segment = func(text string, end bool) {
+			if text != "" {
+				callback(text, false)
+			}
+			done = done || end
+		}
+		defer func() {
+			if done {
+				callback("", true)
+			}
+		}()
+	}
+	reply, stopReason, inputTokens, outputTokens, _, _, err = c.streamOnce(ctx, text, settings, overrides, segment)
+	if err != nil {
+		return reply, stopReason, inputTokens, outputTokens, 0, 0, err
+	}
+	reply, stopReason, inputTokens, outputTokens, err = c.reachMinTokens(settings, overrides,
+		reply, stopReason, inputTokens, outputTokens,
+		func(settings *Settings, overrides SamplingProfile) (string, string, int, int, error) {
+			reply, stopReason, inputTokens, outputTokens, _, _, err := c.streamOnce(ctx, "", settings, overrides, segment)
+			return reply, stopReason, inputTokens, outputTokens, err
+		})
+	if err == nil {
+		c.pruneThinking(ctx)
+		c.annotateSafety(ctx)
+	}
+	return reply, stopReason, inputTokens, outputTokens, 0, 0, err
+}
+
+// streamOnce streams a single request for sendStreaming, with ctx.
+func (c *Conversation) streamOnce(ctx context.Context, text string, settings *Settings, overrides SamplingProfile,
+	callback llmapi.StreamCallback) (
+	reply string,
+	stopReason string,
+	inputTokens int,
+	outputTokens int,
+	cacheCreationTokens int,
+	cacheReadTokens int,
+	err error,
 ) {
 	if c.ApiToken == "" {
 		return "", "", 0, 0, 0, 0, fmt.Errorf("API token not set")
 	}
+	if c.modelErr != nil {
+		return "", "", 0, 0, 0, 0, c.modelErr
+	}
+	ctx, done, err := c.track(ctx)
+	if err != nil {
+		return "", "", 0, 0, 0, 0, err
+	}
+	defer done()
+
+	// Translate user text into the model's language
+	if text, err = c.translateInput(ctx, text); err != nil {
+		return "", "", 0, 0, 0, 0, err
+	}
 
 	// Add user message if provided
 	if text != "" {
@@ -47,136 +127,293 @@ func (c *Conversation) SendStreaming(text string, sampling llmapi.Sampling, call
 	// Build prompt string from system + conversation history
 	prompt := c.buildPrompt()
 
-	// Use sampling overrides if provided, otherwise use conversation defaults
-	temperature := c.Settings.Temperature
-	if sampling.Temperature != 0 {
-		temperature = sampling.Temperature
-	}
-	topP := c.Settings.TopP
-	if sampling.TopP != 0 {
-		topP = sampling.TopP
-	}
-	topK := c.Settings.TopK
-	if sampling.TopK != 0 {
-		topK = sampling.TopK
-	}
-
-	req := completionRequest{
-		Model:             c.Settings.Model,
-		Prompt:            prompt,
-		MaxTokens:         c.Settings.MaxTokens,
-		Temperature:       temperature,
-		TopP:              topP,
-		TopK:              topK,
-		MinP:              c.Settings.MinP,
-		FrequencyPenalty:  c.Settings.FrequencyPenalty,
-		PresencePenalty:   c.Settings.PresencePenalty,
-		RepetitionPenalty: c.Settings.RepetitionPenalty,
-		Stop:              c.Settings.StopSequences,
-		Stream:            true,
-		StreamOptions:     &streamOptions{IncludeUsage: true},
-	}
-
-	jsonData, err := json.Marshal(req)
+	req := newCompletionRequest(prompt, settings, overrides)
+	req.Stream = true
+	req.StreamOptions = &streamOptions{IncludeUsage: true}
+	cfg := c.streamConfig()
+
+	// Cancelled on return, aborting the stream if a reply cap ends it early
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	client, headerTimeout := c.streamingClient()
+
+	// Wait for our turn if requests are queued
+	timing := &requestTimer{}
+	timing.wait()
+	release, err := c.acquireSlot(ctx)
 	if err != nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("error marshaling request: %w", err)
+		return "", "", 0, 0, 0, 0, err
 	}
-
-	httpReq, err := http.NewRequestWithContext(c.context(), "POST", c.endpoint(), bytes.NewBuffer(jsonData))
+	defer release()
+	timing.send()
+
+	st := newStreamState(settings)
+	defer st.release()
+	var chunker *StreamChunker
+	var limiter *StreamLimiter
+	if callback != nil {
+		chunker = NewStreamChunker(settings.StreamChunking, callback)
+		callback = chunker.Callback()
+		if settings.StreamRate.Enabled() {
+			limiter = NewStreamLimiter(settings.StreamRate, callback)
+			callback = limiter.Callback()
+		}
+	}
+	callback = timing.stream(callback)
+	for attempt := 0; ; attempt++ {
+		err = c.readStream(ctx, &req, client, headerTimeout, cfg, timing, callback, st)
+		if st.ended || ctx.Err() != nil || attempt >= cfg.MaxReconnects {
+			break
+		}
+		// The stream dropped before the reply ended; resume it with the
+		// partial reply as part of the prompt
+		if !st.resume(&req, prompt) || !sleepContext(ctx, cfg.reconnectDelay(attempt)) {
+			break
+		}
+	}
+	// Pass on what was held back of a stream that ended without done
+	if limiter != nil {
+		limiter.Flush()
+	}
+	if chunker != nil {
+		chunker.Flush()
+	}
+	reply, stopReason, inputTokens, outputTokens = st.result()
 	if err != nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("error creating request: %w", err)
+		return reply, c.errorStopReason(c.context(), stopReason), 0, 0, 0, 0, c.streamError(err, st, settings, timing)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.ApiToken)
-	httpReq.Header.Set("Accept", "text/event-stream")
+	// Add assistant message to history
+	c.Messages = append(c.Messages, Message{Role: "assistant", Content: reply})
+	c.lastActive = time.Now()
+	c.classifyReply(len(c.Messages) - 1)
 
-	// Use a client without timeout for streaming
-	client := &http.Client{Timeout: 0}
-	if c.HttpClient != nil && c.HttpClient.Transport != nil {
-		client.Transport = c.HttpClient.Transport
+	c.LastStopSequence = ""
+	if stopReason == "stop" {
+		c.LastStopSequence = firedStopSequence(reply, req.Stop, st.matchedStop...)
 	}
 
-	// Perform request with retries
-	var resp *http.Response
-	for attempt := 0; attempt <= retries; attempt++ {
-		resp, err = client.Do(httpReq)
-		if err == nil {
-			break
-		}
-		if attempt < retries {
-			time.Sleep(retryDelay)
-			httpReq, _ = http.NewRequestWithContext(c.context(), "POST", c.endpoint(), bytes.NewBuffer(jsonData))
-			httpReq.Header.Set("Content-Type", "application/json")
-			httpReq.Header.Set("Authorization", "Bearer "+c.ApiToken)
-			httpReq.Header.Set("Accept", "text/event-stream")
+	// Normalize stop reason
+	stopReason = normalizeStopReason(stopReason)
+	c.LastLogprobs = st.logprobs
+
+	// Update cumulative usage
+	c.Usage.InputTokens += inputTokens
+	c.Usage.OutputTokens += outputTokens
+	c.recordTurn(timing, reply, stopReason, inputTokens, outputTokens)
+
+	reply, err = c.translateReply(ctx, reply)
+	return reply, stopReason, inputTokens, outputTokens, 0, 0, err
+}
+
+// errStreamHeaderTimeout is the cause of a streaming request cancelled for
+// taking longer than the client's timeout to respond.
+var errStreamHeaderTimeout = errors.New("timed out waiting for stream to start")
+
+// readStream makes one streaming request for req and reads its events into
+// st. If headerTimeout is set, it limits the wait for the response headers;
+// cfg sets the idle timeout and connection diagnostics.
+func (c *Conversation) readStream(ctx context.Context, req *completionRequest, client *http.Client,
+	headerTimeout time.Duration, cfg *StreamConfig, timing *requestTimer, callback StreamCallback, st *streamState) error {
+	jsonData, err := c.codec().Marshal(req)
+	if err != nil {
+		st.ended = true
+		return fmt.Errorf("error marshaling request: %w", err)
+	}
+	if timing.fingerprint == "" {
+		if timing.fingerprint, err = req.fingerprint(); err != nil {
+			st.ended = true
+			return err
 		}
 	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	reqCtx := timing.trace(ctx)
+	var conn ConnectionInfo
+	if cfg.OnConnection != nil {
+		reqCtx = conn.trace(reqCtx)
+	}
+	httpReq, err := newRequest(reqCtx, "POST", c.endpoint(), c.ApiToken, "application/json", jsonData)
 	if err != nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("HTTP error after %d retries: %w", retries, err)
+		st.ended = true
+		return err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	// Perform request with retries, limiting the wait for response headers
+	var timer *time.Timer
+	if headerTimeout > 0 {
+		timer = time.AfterFunc(headerTimeout, func() { cancel(errStreamHeaderTimeout) })
 	}
-	if resp == nil {
-		return "", "", 0, 0, 0, 0, fmt.Errorf("HTTP response is nil")
+	resp, err := doWithRetries(client, httpReq, c.retryPolicy(), clockOr(c.Clock))
+	if timer != nil {
+		timer.Stop()
+	}
+	if err != nil {
+		if context.Cause(ctx) == errStreamHeaderTimeout {
+			return fmt.Errorf("no response within %v: %w", headerTimeout, errStreamHeaderTimeout)
+		}
+		return err
 	}
 	defer resp.Body.Close()
+	timing.respond()
+	if cfg.OnConnection != nil {
+		conn.setResponse(resp)
+		cfg.OnConnection(conn)
+	}
 
 	if resp.StatusCode != http.StatusOK {
+		st.ended = true
 		body, _ := io.ReadAll(resp.Body)
-		return "", "", 0, 0, 0, 0, fmt.Errorf("API error (status %d): %s", resp.StatusCode, body)
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, body)
 	}
 
-	// Parse SSE stream
-	reply, stopReason, inputTokens, outputTokens, err = c.parseSSEStream(resp.Body, callback)
-	if err != nil {
-		return reply, stopReason, 0, 0, 0, 0, err
+	var body io.Reader = resp.Body
+	if cfg.IdleTimeout > 0 {
+		idle := newIdleReader(resp.Body, cfg.IdleTimeout, func() { cancel(errStreamIdle) })
+		defer idle.stop()
+		body = idle
 	}
+	err = c.readSSE(body, st.settings, callback, st)
+	if err != nil && context.Cause(ctx) == errStreamIdle {
+		return fmt.Errorf("error reading stream: %w", errStreamIdle)
+	}
+	return err
+}
 
-	// Add assistant message to history
-	c.Messages = append(c.Messages, Message{Role: "assistant", Content: reply})
+// streamingClient returns the client for streaming requests and how long
+// to wait for the response headers. StreamingClient is used as is if set.
+// Otherwise HttpClient is copied with its Timeout moved to the header wait,
+// since a whole-request timeout would cut off long streams; its transport,
+// redirect policy and cookie jar are kept. StreamConfig's proxy and header
+// timeout take precedence.
+func (c *Conversation) streamingClient() (*http.Client, time.Duration) {
+	cfg := c.streamConfig()
+	if c.StreamingClient != nil {
+		return c.StreamingClient, cfg.ResponseHeaderTimeout
+	}
+	var client http.Client
+	if c.HttpClient != nil {
+		client = *c.HttpClient
+	}
+	headerTimeout := client.Timeout
+	client.Timeout = 0
+	client.Transport = cfg.transport(client.Transport)
+	if cfg.ResponseHeaderTimeout > 0 {
+		headerTimeout = cfg.ResponseHeaderTimeout
+	}
+	return &client, headerTimeout
+}
 
-	// Normalize stop reason
-	stopReason = normalizeStopReason(stopReason)
+// streamState is the progress of a streamed reply, kept across reconnects.
+type streamState struct {
+	settings *Settings
+	text     *bytes.Buffer
+	// tokenCount counts the streamed chunks.
+	tokenCount int
+	loops      *LoopDetector
+	stopReason string
+	// inputTokens and outputTokens are the usage reported by the current
+	// stream; earlierOutput is the output of earlier streams.
+	inputTokens   int
+	outputTokens  int
+	earlierOutput int
+	// ended reports whether the reply ended, with [DONE], a finish reason,
+	// a client-side stop or an error that reconnecting would not fix.
+	ended bool
+	// logprobs are the log probabilities of the tokens streamed, if
+	// requested.
+	logprobs []TokenLogprob
+	// matchedStop is the stop sequence the server reported matching.
+	matchedStop []any
+}
 
-	// Update cumulative usage
-	c.Usage.InputTokens += inputTokens
-	c.Usage.OutputTokens += outputTokens
+// newStreamState starts a streamed reply capped by settings.
+func newStreamState(settings *Settings) *streamState {
+	return &streamState{settings: settings, text: getBuffer(), loops: NewLoopDetector(settings.LoopDetection)}
+}
+
+// release returns the state's buffer to its pool.
+func (st *streamState) release() {
+	putBuffer(st.text)
+}
+
+// result returns the reply so far, its stop reason and its usage.
+func (st *streamState) result() (reply, stopReason string, inputTokens, outputTokens int) {
+	outputTokens = st.earlierOutput + st.outputTokens
+	if outputTokens == 0 {
+		// Use our counted tokens if API didn't provide usage data
+		outputTokens = st.tokenCount
+	}
+	return st.text.String(), st.stopReason, st.inputTokens, outputTokens
+}
 
-	return reply, stopReason, inputTokens, outputTokens, 0, 0, nil
+// resume prepares req to continue the reply after a dropped stream, with
+// the reply so far appended to prompt and the token limit reduced by what
+// was generated. Returns false if the limit is used up.
+func (st *streamState) resume(req *completionRequest, prompt string) bool {
+	_, _, _, generated := st.result()
+	if req.MaxTokens > 0 {
+		left := req.MaxTokens - (generated - st.earlierOutput)
+		if left <= 0 {
+			st.ended = true
+			return false
+		}
+		req.MaxTokens = left
+	}
+	st.earlierOutput = generated
+	st.inputTokens, st.outputTokens = 0, 0
+	req.Prompt = prompt + st.text.String()
+	return true
 }
 
-// parseSSEStream reads Server-Sent Events and calls the callback for each token.
-func (c *Conversation) parseSSEStream(body io.Reader, callback StreamCallback) (
+// parseSSEStream reads Server-Sent Events and calls the callback for each token,
+// stopping early with StopClientTruncated if the reply exceeds the caps in settings.
+func (c *Conversation) parseSSEStream(body io.Reader, settings *Settings, callback StreamCallback) (
 	fullText string,
 	stopReason string,
 	inputTokens int,
 	outputTokens int,
 	err error,
 ) {
-	scanner := bufio.NewScanner(body)
-	var accumulated strings.Builder
-	var tokenCount int
+	st := newStreamState(settings)
+	defer st.release()
+	err = c.readSSE(body, settings, callback, st)
+	fullText, stopReason, inputTokens, outputTokens = st.result()
+	return fullText, stopReason, inputTokens, outputTokens, err
+}
+
+// readSSE reads Server-Sent Events into st, calling the callback for each
+// token. Comment lines, such as proxy keepalives, are ignored.
+func (c *Conversation) readSSE(body io.Reader, settings *Settings, callback StreamCallback, st *streamState) error {
+	limit := c.maxBodyBytes()
+	scanner, release := newSSEScanner(body, limit)
+	defer release()
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := scanner.Bytes()
 
 		// SSE format: "data: {json}" or "data: [DONE]"
-		if !strings.HasPrefix(line, "data: ") {
+		if !bytes.HasPrefix(line, sseDataPrefix) {
 			continue
 		}
 
-		data := strings.TrimPrefix(line, "data: ")
+		data := line[len(sseDataPrefix):]
 
 		// Check for stream end
-		if data == "[DONE]" {
+		if string(data) == "[DONE]" {
 			if callback != nil {
 				callback("", true)
 			}
+			st.ended = true
 			break
 		}
 
 		// Parse chunk
 		var chunk streamChunk
-		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		if err := c.codec().Unmarshal(data, &chunk); err != nil {
 			// Skip malformed chunks
 			continue
 		}
@@ -189,40 +426,58 @@ func (c *Conversation) parseSSEStream(body io.Reader, callback StreamCallback) (
 
 		// Extract text (completions format uses "text" not "delta.content")
 		if choice.Text != "" {
-			accumulated.WriteString(choice.Text)
-			tokenCount++ // Count each chunk as a token
-			if callback != nil {
-				callback(choice.Text, false)
+			text, truncated := capChunk(choice.Text, st.text.Len(), st.tokenCount, settings)
+			if int64(st.text.Len()+len(text)) > limit {
+				st.ended = true
+				return fmt.Errorf("streamed reply exceeds %d bytes", limit)
+			}
+			if text != "" {
+				st.text.WriteString(text)
+				st.tokenCount++ // Count each chunk as a token
+				if callback != nil {
+					callback(text, false)
+				}
+			}
+			var stop StopReason
+			if truncated {
+				stop = StopClientTruncated
+			} else if st.loops.Write(text) {
+				stop = StopLoopDetected
+			}
+			if stop != "" {
+				if callback != nil {
+					callback("", true)
+				}
+				st.stopReason, st.ended = string(stop), true
+				break
 			}
 		}
 
+		st.logprobs = append(st.logprobs, choice.Logprobs.tokens()...)
+
 		// Check for finish reason
 		if choice.FinishReason != nil && *choice.FinishReason != "" {
-			stopReason = *choice.FinishReason
+			st.stopReason, st.ended = *choice.FinishReason, true
+			st.matchedStop = []any{choice.StopReason, choice.MatchedStop}
 		}
 
 		// Capture usage data if API provides it (may override our count)
 		if chunk.Usage != nil {
-			inputTokens = chunk.Usage.PromptTokens
-			outputTokens = chunk.Usage.CompletionTokens
+			st.inputTokens = chunk.Usage.PromptTokens
+			st.outputTokens = chunk.Usage.CompletionTokens
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return accumulated.String(), stopReason, inputTokens, outputTokens, fmt.Errorf("error reading stream: %w", err)
-	}
-
-	// Use our counted tokens if API didn't provide usage data
-	if outputTokens == 0 {
-		outputTokens = tokenCount
+		return fmt.Errorf("error reading stream: %w", err)
 	}
-
-	return accumulated.String(), stopReason, inputTokens, outputTokens, nil
+	return nil
 }
 
 // SendStreamingUntilDone combines streaming with automatic continuation.
-// It streams tokens via callback and continues until stopReason != "max_tokens".
-// Sampling parameters override conversation defaults for this call only.
+// It streams tokens via callback and continues until the stop reason is not StopMaxTokens.
+// Sampling parameters override conversation defaults for this call only,
+// and each segment's sampling follows Schedule, if set.
 // cacheCreationTokens and cacheReadTokens are always 0 (NovelAI doesn't report cache stats).
 func (c *Conversation) SendStreamingUntilDone(text string, sampling llmapi.Sampling, callback llmapi.StreamCallback) (
 	reply string,
@@ -235,15 +490,19 @@ func (c *Conversation) SendStreamingUntilDone(text string, sampling llmapi.Sampl
 ) {
 	var totalReply strings.Builder
 	input := text
+	defer c.annotateWhenDone(&err)()
 
+	k := c.newContinuation(SamplingOverrides(sampling))
 	for {
 		var partReply string
 		var inToks, outToks int
 
-		partReply, stopReason, inToks, outToks, _, _, err = c.SendStreaming(input, sampling, callback)
+		settings, overrides := k.next()
+		partReply, stopReason, inToks, outToks, _, _, err = c.sendStreaming(input, settings, overrides, callback)
 		if err != nil {
 			return totalReply.String(), stopReason, inputTokens, outputTokens, 0, 0, err
 		}
+		k.done(partReply)
 
 		totalReply.WriteString(partReply)
 		inputTokens += inToks
@@ -251,7 +510,7 @@ func (c *Conversation) SendStreamingUntilDone(text string, sampling llmapi.Sampl
 
 		c.MergeIfLastTwoAssistant()
 
-		if stopReason != "max_tokens" {
+		if StopReason(stopReason) != StopMaxTokens {
 			break
 		}
 
@@ -260,3 +519,21 @@ func (c *Conversation) SendStreamingUntilDone(text string, sampling llmapi.Sampl
 
 	return totalReply.String(), stopReason, inputTokens, outputTokens, 0, 0, nil
 }
+
+// capChunk returns the part of a streamed chunk that fits the reply caps in
+// settings, given the bytes and chunks received so far, and whether the cap
+// was reached.
+func capChunk(text string, size, chunks int, settings *Settings) (string, bool) {
+	if settings.MaxResponseTokens > 0 && chunks >= settings.MaxResponseTokens {
+		return "", true
+	}
+	if settings.MaxResponseBytes > 0 && size+len(text) > settings.MaxResponseBytes {
+		n := settings.MaxResponseBytes - size
+		// Don't split a UTF-8 sequence
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		return text[:n], true
+	}
+	return text, false
+}
@@ -0,0 +1,143 @@
+package novelai
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wbrown/llmapi"
+)
+
+// newRunawayServer streams chunk until the client goes away, and reports
+// when it saw the request cancelled.
+func newRunawayServer(t *testing.T, chunk string) (*Conversation, <-chan struct{}) {
+	t.Helper()
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for {
+			if _, err := fmt.Fprintf(w, "data: {\"choices\":[{\"text\":%q}]}\n\n", chunk); err != nil {
+				break
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	conv := NewConversation("")
+	conv.ApiToken = "test-token"
+	conv.Endpoint = server.URL
+	return conv, cancelled
+}
+
+// TestStreamingResponseCaps tests client-side truncation of runaway replies.
+func TestStreamingResponseCaps(t *testing.T) {
+	conv, cancelled := newRunawayServer(t, "abcd")
+	conv.Settings.MaxResponseBytes = 10
+	var streamed strings.Builder
+	done := false
+	reply, stop, _, _, _, _, err := conv.SendStreaming("Go", llmapi.Sampling{}, func(text string, d bool) {
+		streamed.WriteString(text)
+		done = done || d
+	})
+	if err != nil {
+		t.Fatalf("SendStreaming failed: %v", err)
+	}
+	if reply != "abcdabcdab" || StopReason(stop) != StopClientTruncated {
+		t.Errorf("Expected reply cut at 10 bytes, got %q (%s)", reply, stop)
+	}
+	if streamed.String() != reply || !done {
+		t.Errorf("Expected callback to see the partial reply and done, got %q (%v)", streamed.String(), done)
+	}
+	if last := conv.Messages[len(conv.Messages)-1]; last.Content != reply {
+		t.Errorf("Expected partial reply kept in history, got %q", last.Content)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected request cancelled")
+	}
+
+	conv, _ = newRunawayServer(t, "abcd")
+	conv.Settings.MaxResponseTokens = 3
+	reply, stop, _, outputTokens, _, _, err := conv.SendStreaming("Go", llmapi.Sampling{}, nil)
+	if err != nil || reply != "abcdabcdabcd" || StopReason(stop) != StopClientTruncated || outputTokens != 3 {
+		t.Errorf("Expected 3 chunks, got %q (%s, %d tokens, %v)", reply, stop, outputTokens, err)
+	}
+}
+
+// TestCapChunk tests that byte caps don't split UTF-8 sequences.
+func TestCapChunk(t *testing.T) {
+	settings := &Settings{MaxResponseBytes: 4}
+	text, truncated := capChunk("aé…", 1, 1, settings)
+	if text != "aé" || !truncated {
+		t.Errorf("Expected cut before the ellipsis, got %q (%v)", text, truncated)
+	}
+	if text, truncated := capChunk("ab", 0, 0, settings); text != "ab" || truncated {
+		t.Errorf("Expected chunk within cap, got %q (%v)", text, truncated)
+	}
+}
+
+// TestStreamingHonorsHttpClient tests that streaming keeps the configured
+// client's redirect policy and applies its timeout to the response start
+// only.
+func TestStreamingHonorsHttpClient(t *testing.T) {
+	delay := 0 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+			return
+		}
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range []string{"slow ", "but ", "steady"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"text\":%q}]}\n\n", word)
+			w.(http.Flusher).Flush()
+			time.Sleep(40 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	redirects := 0
+	conv := NewConversation("")
+	conv.ApiToken = "test-token"
+	conv.Endpoint = server.URL + "/old"
+	conv.HttpClient = &http.Client{
+		Timeout: 60 * time.Millisecond,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			redirects++
+			return nil
+		},
+	}
+
+	reply, _, _, _, _, _, err := conv.SendStreaming("Go", llmapi.Sampling{}, nil)
+	if err != nil || reply != "slow but steady" {
+		t.Fatalf("Expected stream longer than the timeout to finish, got %q, %v", reply, err)
+	}
+	if redirects != 1 {
+		t.Errorf("Expected CheckRedirect to be used, got %d calls", redirects)
+	}
+
+	delay = 200 * time.Millisecond
+	if _, _, _, _, _, _, err = conv.SendStreaming("Go", llmapi.Sampling{}, nil); err == nil ||
+		!strings.Contains(err.Error(), "no response within") {
+		t.Errorf("Expected header timeout, got %v", err)
+	}
+
+	conv.StreamingClient = &http.Client{}
+	if reply, _, _, _, _, _, err = conv.SendStreaming("Go", llmapi.Sampling{}, nil); err != nil || reply != "slow but steady" {
+		t.Errorf("Expected StreamingClient without timeout to wait, got %q, %v", reply, err)
+	}
+	if redirects != 2 {
+		t.Errorf("Expected StreamingClient to replace HttpClient, got %d redirects", redirects)
+	}
+}
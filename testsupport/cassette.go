@@ -0,0 +1,160 @@
+package testsupport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotRecorded is returned by a replaying Cassette for a request it has
+// no response for, such as one whose prompt changed since recording.
+var ErrNotRecorded = errors.New("no recorded response for request")
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Request is the request body.
+	Request string `json:"request"`
+	Status  int    `json:"status"`
+	// ContentType is the response's content type.
+	ContentType string `json:"content_type,omitempty"`
+	// Response is the response body, including streamed events.
+	Response string `json:"response"`
+}
+
+// Cassette is an http.RoundTripper that records API interactions to a
+// file, and replays them from it, so that tests of real generations run
+// offline and deterministically. Install it as a conversation's
+// HttpClient transport. Requests are matched by method, URL and body; the
+// API token is neither recorded nor matched.
+type Cassette struct {
+	// Path is the file the interactions are kept in.
+	Path string
+	// Recording sends requests through Next and records them. Otherwise
+	// requests are replayed, and those not recorded fail with
+	// ErrNotRecorded.
+	Recording bool
+	// Next sends recorded requests. If nil, http.DefaultTransport is used.
+	Next http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// LoadCassette opens the cassette at path, replaying unless recording. A
+// recording cassette starts empty; a replaying one must exist.
+func LoadCassette(path string, recording bool) (*Cassette, error) {
+	c := &Cassette{Path: path, Recording: recording}
+	if recording {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("cassette %s does not exist; run with %s=1 to record it", path, UpdateEnv)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, fmt.Errorf("error parsing cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Interactions returns the interactions recorded or loaded.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Save writes the recorded interactions to Path.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error encoding cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return fmt.Errorf("error creating cassette directory: %w", err)
+	}
+	if err := os.WriteFile(c.Path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+		req.Body.Close()
+	}
+	if !c.Recording {
+		return c.replay(req, string(body))
+	}
+
+	next := c.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	c.mu.Lock()
+	c.interactions = append(c.interactions, Interaction{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Request:     string(body),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Response:    string(data),
+	})
+	c.mu.Unlock()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// replay returns the recorded response to req.
+func (c *Cassette) replay(req *http.Request, body string) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, in := range c.interactions {
+		if in.Method != req.Method || in.URL != req.URL.String() || in.Request != body {
+			continue
+		}
+		header := http.Header{}
+		if in.ContentType != "" {
+			header.Set("Content-Type", in.ContentType)
+		}
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+			StatusCode: in.Status,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewReader([]byte(in.Response))),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, req.URL)
+}
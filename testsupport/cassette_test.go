@@ -0,0 +1,60 @@
+package testsupport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCassetteRecordReplay tests recording interactions and replaying
+// them without the server.
+func TestCassetteRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"echo":"` + string(body) + `"}`))
+	}))
+	path := filepath.Join(t.TempDir(), "api.cassette.json")
+
+	rec, err := LoadCassette(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != `{"echo":"hello"}` {
+		t.Errorf("recorded response = %s", body)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	play, err := LoadCassette(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: play}
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/json" || string(body) != `{"echo":"hello"}` {
+		t.Errorf("replayed %d %q %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	if _, err := client.Post(server.URL, "text/plain", strings.NewReader("goodbye")); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("unrecorded request error = %v, want ErrNotRecorded", err)
+	}
+	if _, err := LoadCassette(filepath.Join(t.TempDir(), "missing.json"), false); err == nil {
+		t.Error("replaying a missing cassette succeeded")
+	}
+}
@@ -0,0 +1,142 @@
+// Package testsupport helps applications pin the prompts novelai renders,
+// so that upgrading the package cannot silently change established story
+// context.
+//
+// Render the canned conversations with your template and compare them
+// against golden files:
+//
+//	func TestPromptFormat(t *testing.T) {
+//		testsupport.AssertTemplate(t, "testdata", &novelai.PromptGLM47)
+//	}
+//
+// Run the tests with NOVELAI_UPDATE_GOLDEN=1 to write the golden files,
+// then review and commit them.
+//
+// Regression pins the model's replies to a set of prompts in the same way,
+// replaying them offline from recorded API interactions; see Cassette.
+package testsupport
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/novelai"
+)
+
+// UpdateEnv is the environment variable that, when set to 1, makes
+// AssertGolden write golden files instead of comparing against them.
+const UpdateEnv = "NOVELAI_UPDATE_GOLDEN"
+
+// Case is a canned conversation to render.
+type Case struct {
+	Name     string
+	System   string
+	Messages []novelai.Message
+	Thinking bool
+}
+
+// Conversations are canned conversations covering the parts of a prompt
+// template: system prompts, multiple turns, mid-conversation system
+// messages, thinking and scene breaks.
+var Conversations = []Case{
+	{
+		Name:     "single-turn",
+		System:   "You are a helpful assistant.",
+		Messages: []novelai.Message{{Role: "user", Content: "Hello!"}},
+	},
+	{
+		Name:   "multi-turn",
+		System: "You are a storyteller.",
+		Messages: []novelai.Message{
+			{Role: "user", Content: "Begin a story about a lighthouse."},
+			{Role: "assistant", Content: "The lamp had not turned in years.\n\n***\n\nMorning came grey."},
+			{Role: "system", Content: "Keep replies under 100 words."},
+			{Role: "user", Content: "Continue."},
+		},
+	},
+	{
+		Name:     "thinking",
+		Messages: []novelai.Message{{Role: "user", Content: "What is 17 * 23?"}},
+		Thinking: true,
+	},
+}
+
+// RenderConversation renders c with template t as a request would send it.
+func RenderConversation(c Case, t *novelai.PromptTemplate) string {
+	conv := novelai.NewConversation(c.System)
+	conv.ApplyTemplate(t)
+	conv.Settings.Thinking = c.Thinking
+	conv.Messages = append(conv.Messages, c.Messages...)
+	return conv.RenderPrompt()
+}
+
+// RenderScenario renders the story context scenario s builds for story.
+func RenderScenario(s *novelai.Scenario, story string) string {
+	return novelai.NewContextBuilder(s).Build(story)
+}
+
+// AssertTemplate renders each of Conversations with t and compares it with
+// the golden file <dir>/<template name>-<case name>.golden.
+func AssertTemplate(t testing.TB, dir string, tmpl *novelai.PromptTemplate) {
+	t.Helper()
+	for _, c := range Conversations {
+		AssertGolden(t, filepath.Join(dir, tmpl.Name+"-"+c.Name+".golden"), RenderConversation(c, tmpl))
+	}
+}
+
+// AssertGolden fails t if got differs from the contents of the golden file
+// at path, reporting a readable diff. If UpdateEnv is set, it writes got to
+// path instead.
+func AssertGolden(t testing.TB, path, got string) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) == "1" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("error creating golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("error writing golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("golden file %s does not exist; run with %s=1 to create it", path, UpdateEnv)
+	}
+	if err != nil {
+		t.Fatalf("error reading golden file: %v", err)
+	}
+	if diff := Diff(string(want), got); diff != "" {
+		t.Errorf("prompt differs from %s:\n%s", path, diff)
+	}
+}
+
+// Diff describes how got differs from want: the first differing line and
+// a word-level diff with deletions as [-text-] and insertions as {+text+}.
+// Returns "" if they are equal.
+func Diff(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	line := 0
+	for line < len(wantLines) && line < len(gotLines) && wantLines[line] == gotLines[line] {
+		line++
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "first difference at line %d\n", line+1)
+	if line < len(wantLines) {
+		fmt.Fprintf(&b, "  want: %q\n", wantLines[line])
+	}
+	if line < len(gotLines) {
+		fmt.Fprintf(&b, "  got:  %q\n", gotLines[line])
+	}
+	diff, _ := novelai.DiffTokens(want, got, nil)
+	b.WriteString(diff.String())
+	return b.String()
+}
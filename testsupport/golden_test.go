@@ -0,0 +1,51 @@
+package testsupport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/novelai"
+)
+
+// TestTemplates pins the prompts of the built-in templates.
+func TestTemplates(t *testing.T) {
+	for _, tmpl := range []*novelai.PromptTemplate{&novelai.PromptGLM46, &novelai.PromptGLM47, &novelai.PromptErato} {
+		AssertTemplate(t, "testdata", tmpl)
+	}
+}
+
+// TestRenderScenario pins the story context of a scenario.
+func TestRenderScenario(t *testing.T) {
+	s := novelai.NewScenario("Lighthouse")
+	s.Context = []novelai.ContextEntry{{
+		Text:       "[ Title: Lighthouse; Genre: Mystery ]\nThe keeper is missing.",
+		ContextCfg: novelai.MemoryContextConfig(),
+	}}
+	AssertGolden(t, filepath.Join("testdata", "scenario-lighthouse.golden"),
+		RenderScenario(s, "The lamp had not turned in years."))
+}
+
+// TestDiff tests the readable diff.
+func TestDiff(t *testing.T) {
+	if Diff("same", "same") != "" {
+		t.Error("Expected no diff for equal text")
+	}
+	diff := Diff("a\nb c\n", "a\nb d\n")
+	if !strings.Contains(diff, "line 2") || !strings.Contains(diff, "[-c-]{+d+}") {
+		t.Errorf("Unexpected diff: %s", diff)
+	}
+}
+
+// TestAssertGoldenUpdate tests writing and then matching a golden file.
+func TestAssertGoldenUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "prompt.golden")
+	t.Setenv(UpdateEnv, "1")
+	AssertGolden(t, path, "prompt")
+	if data, err := os.ReadFile(path); err != nil || string(data) != "prompt" {
+		t.Fatalf("Expected golden file written, got %q (%v)", data, err)
+	}
+	t.Setenv(UpdateEnv, "")
+	AssertGolden(t, path, "prompt")
+}
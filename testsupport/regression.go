@@ -0,0 +1,194 @@
+package testsupport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wbrown/novelai"
+	"github.com/wbrown/novelai/textsim"
+)
+
+// LiveEnv is the environment variable that, when set to 1, makes a
+// Regression generate its replies with the API instead of replaying them.
+const LiveEnv = "NOVELAI_REGRESSION_LIVE"
+
+// Regression defaults.
+const (
+	// DefaultRegressionSeed seeds the generations of a Regression that
+	// sets no Seed.
+	DefaultRegressionSeed = 1
+	// DefaultSimilarity is the least similarity of a reply to its pinned
+	// output for a Regression that sets no Threshold.
+	DefaultSimilarity = 0.9
+)
+
+// RegressionCase is a prompt whose reply a Regression pins.
+type RegressionCase struct {
+	// Name names the case's files.
+	Name string
+	// System, if set, replaces the conversation's system prompt.
+	System string
+	// Messages are the history before Prompt.
+	Messages []novelai.Message
+	// Prompt is the user message replied to.
+	Prompt string
+}
+
+// Regression pins the replies to a set of prompts, generated with a fixed
+// seed at temperature 0, and fails when a model or prompt format change
+// alters them. For each case it keeps, in Dir:
+//
+//	<name>.golden         the expected reply
+//	<name>.cassette.json  the recorded API interaction
+//
+// Run it in one of three modes:
+//
+//   - By default, replies are replayed from the cassettes, offline. A
+//     request that differs from the recorded one, as when the prompt
+//     format changed, fails with a diff of the prompts.
+//   - With LiveEnv=1, replies are generated with the API and must be at
+//     least Threshold similar to the expected ones, catching model changes.
+//   - With UpdateEnv=1, replies are generated with the API and the
+//     expected replies and cassettes are rewritten. Review and commit them.
+type Regression struct {
+	// Conversation supplies the endpoint, API token, settings, template,
+	// user persona and character name. It is not changed, and its hooks,
+	// such as SafetyClassifier, are not run.
+	Conversation *novelai.Conversation
+	// Cases are the prompts pinned.
+	Cases []RegressionCase
+	// Dir holds the expected replies and cassettes.
+	Dir string
+	// Seed seeds the generations. If zero, DefaultRegressionSeed is used.
+	Seed int
+	// Threshold is the least Similarity of a live reply to the expected
+	// one, from 0 to 1. If zero, DefaultSimilarity is used.
+	Threshold float64
+}
+
+// Run checks every case as a subtest of t.
+func (r *Regression) Run(t *testing.T) {
+	t.Helper()
+	for _, c := range r.Cases {
+		t.Run(c.Name, func(t *testing.T) {
+			r.check(t, c)
+		})
+	}
+}
+
+// check generates the reply of case c and compares it with the expected
+// one, or records it.
+func (r *Regression) check(t *testing.T, c RegressionCase) {
+	update := os.Getenv(UpdateEnv) == "1"
+	live := update || os.Getenv(LiveEnv) == "1"
+	goldenPath := filepath.Join(r.Dir, c.Name+".golden")
+	// Live runs record only to save the cassette when updating
+	cassette, err := LoadCassette(filepath.Join(r.Dir, c.Name+".cassette.json"), live)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := r.generate(c, cassette)
+	if errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("request differs from the recording; the prompt changed:\n%s",
+			r.promptDiff(c, cassette))
+	}
+	if err != nil {
+		t.Fatalf("error generating reply: %v", err)
+	}
+	if update {
+		if err := cassette.Save(); err != nil {
+			t.Fatal(err)
+		}
+		AssertGolden(t, goldenPath, reply)
+		return
+	}
+
+	data, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("error reading expected reply: %v", err)
+	}
+	want := string(data)
+	if !live {
+		if diff := Diff(want, reply); diff != "" {
+			t.Errorf("replayed reply differs from %s:\n%s", goldenPath, diff)
+		}
+		return
+	}
+	threshold := r.Threshold
+	if threshold == 0 {
+		threshold = DefaultSimilarity
+	}
+	if sim := Similarity(want, reply); sim < threshold {
+		t.Errorf("reply is %.2f similar to %s, below %.2f:\n%s", sim, goldenPath, threshold, Diff(want, reply))
+	}
+}
+
+// conversation returns a new conversation to generate case c in, sending
+// its requests through transport. Only what shapes the request is taken
+// from r.Conversation, so its history, metadata, hooks, queue and
+// lifecycle are not touched.
+func (r *Regression) conversation(c RegressionCase, transport http.RoundTripper) *novelai.Conversation {
+	src := r.Conversation
+	system := src.System
+	if c.System != "" {
+		system = c.System
+	}
+	settings := src.Settings.Clone()
+	settings.Seed = r.Seed
+	if settings.Seed == 0 {
+		settings.Seed = DefaultRegressionSeed
+	}
+	conv := novelai.NewConversationWithClient(&http.Client{Transport: transport}, novelai.ConversationConfig{
+		System:   system,
+		ApiToken: src.ApiToken,
+		Endpoint: src.Endpoint,
+		Settings: settings,
+	})
+	if src.UserPersona != nil {
+		persona := *src.UserPersona
+		conv.UserPersona = &persona
+	}
+	conv.CharName = src.CharName
+	conv.Messages = append([]novelai.Message(nil), c.Messages...)
+	// A replay miss is final
+	conv.Retry = &novelai.RetryPolicy{}
+	return conv
+}
+
+// generate generates the reply of case c through cassette.
+func (r *Regression) generate(c RegressionCase, cassette *Cassette) (string, error) {
+	conv := r.conversation(c, cassette)
+	reply, _, _, _, _, _, err := conv.SendWith(c.Prompt, novelai.SamplingProfile{Temperature: novelai.Float64(0)})
+	return reply, err
+}
+
+// promptDiff describes how the prompt of case c differs from the first
+// one recorded in cassette.
+func (r *Regression) promptDiff(c RegressionCase, cassette *Cassette) string {
+	recorded := cassette.Interactions()
+	if len(recorded) == 0 {
+		return "(nothing recorded)"
+	}
+	conv := r.conversation(c, cassette)
+	conv.AddMessage("user", c.Prompt)
+	var req struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := json.Unmarshal([]byte(recorded[0].Request), &req); err != nil || req.Prompt == conv.RenderPrompt() {
+		return fmt.Sprintf("settings changed; recorded request:\n%s", recorded[0].Request)
+	}
+	return Diff(req.Prompt, conv.RenderPrompt())
+}
+
+// Similarity returns how alike two replies are, from 0 to 1: their
+// textsim.RougeL score, which compares their words in order, ignoring case
+// and punctuation.
+func Similarity(a, b string) float64 {
+	return textsim.RougeL(a, b)
+}
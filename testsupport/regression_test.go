@@ -0,0 +1,131 @@
+package testsupport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/novelai"
+)
+
+// completionServer returns a server replying with text, checking that
+// requests are seeded at temperature 0.
+func completionServer(t *testing.T, text string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Temperature *float64 `json:"temperature"`
+			Seed        int      `json:"seed"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Temperature == nil || *req.Temperature != 0 || req.Seed != DefaultRegressionSeed {
+			t.Errorf("request temperature %v, seed %d", req.Temperature, req.Seed)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"text": text, "finish_reason": "stop"}},
+			"usage":   map[string]int{"prompt_tokens": 10, "completion_tokens": 5},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestRegression tests recording, replaying and live-checking replies.
+func TestRegression(t *testing.T) {
+	dir := t.TempDir()
+	server := completionServer(t, "The answer is 4.")
+	conv := novelai.NewConversation("You are a calculator.")
+	conv.Endpoint = server.URL
+	conv.ApiToken = "test-token"
+	classified := 0
+	conv.SafetyClassifier = novelai.SafetyClassifierFunc(
+		func(ctx context.Context, user, reply string) (novelai.SafetyAnnotation, error) {
+			classified++
+			return novelai.SafetyAnnotation{}, nil
+		})
+	conv.ThinkingRetention = &novelai.ThinkingRetention{}
+	reg := &Regression{
+		Conversation: conv,
+		Dir:          dir,
+		Cases: []RegressionCase{{
+			Name:     "sum",
+			Messages: []novelai.Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello."}},
+			Prompt:   "What is 2 + 2?",
+		}},
+	}
+
+	t.Setenv(UpdateEnv, "1")
+	reg.Run(t)
+	if data, err := os.ReadFile(filepath.Join(dir, "sum.golden")); err != nil || string(data) != "The answer is 4." {
+		t.Fatalf("expected reply = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sum.cassette.json")); err != nil {
+		t.Fatalf("cassette not saved: %v", err)
+	}
+
+	// Replaying needs no server
+	t.Setenv(UpdateEnv, "")
+	server.Close()
+	reg.Run(t)
+
+	// A live reply only a little different passes
+	reg.Conversation.Endpoint = completionServer(t, "The answer is 4!").URL
+	t.Setenv(LiveEnv, "1")
+	reg.Run(t)
+	if len(conv.Messages) != 0 {
+		t.Errorf("conversation changed: %+v", conv.Messages)
+	}
+	if classified != 0 || len(conv.Meta) != 0 {
+		t.Errorf("conversation hooks ran: %d classified, meta %v", classified, conv.Meta)
+	}
+}
+
+// TestRegressionPromptDiff tests describing a changed prompt.
+func TestRegressionPromptDiff(t *testing.T) {
+	dir := t.TempDir()
+	conv := novelai.NewConversation("You are a calculator.")
+	conv.Endpoint = completionServer(t, "4").URL
+	conv.ApiToken = "test-token"
+	c := RegressionCase{Name: "sum", Prompt: "What is 2 + 2?"}
+	reg := &Regression{Conversation: conv, Dir: dir, Cases: []RegressionCase{c}}
+	t.Setenv(UpdateEnv, "1")
+	reg.Run(t)
+
+	conv.System = "You are a careful calculator."
+	cassette, err := LoadCassette(filepath.Join(dir, "sum.cassette.json"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.generate(c, cassette); err == nil {
+		t.Fatal("changed prompt was replayed")
+	}
+	if diff := reg.promptDiff(c, cassette); !strings.Contains(diff, "{+careful +}") {
+		t.Errorf("prompt diff = %s", diff)
+	}
+}
+
+// TestSimilarity tests comparing replies.
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"", "", 1, 1},
+		{"same text", "same text", 1, 1},
+		{"The answer is 4.", "the answer is 4!", 1, 1},
+		{"The answer is 4.", "The answer is four.", 0.7, 0.8},
+		{"The cat sat on the mat.", "A dog ran in the park.", 0, 0.5},
+		{"something", "", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := Similarity(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("Similarity(%q, %q) = %.2f, want %.2f to %.2f", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package textsim measures how alike two texts are, for comparing
+// generations: pinning replies in regression tests, dropping near-duplicate
+// candidates and spotting a model repeating itself.
+//
+// Every similarity is from 0, nothing in common, to 1, equal. Word-based
+// measures compare the lowercased words of Words, so they ignore case,
+// punctuation and spacing.
+package textsim
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Words splits text into lowercased runs of letters and digits. Everything
+// else separates words.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Levenshtein returns the edit distance between a and b: the least number
+// of characters inserted, deleted or substituted to turn one into the
+// other. It takes time proportional to the product of their lengths.
+func Levenshtein(a, b string) int {
+	return editDistance([]rune(a), []rune(b))
+}
+
+// NormalizedLevenshtein returns 1 minus the edit distance between a and b
+// divided by the length of the longer, in characters.
+func NormalizedLevenshtein(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longest)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diag := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			next := min(row[j]+1, row[j-1]+1, diag+cost)
+			diag, row[j] = row[j], next
+		}
+	}
+	return row[len(b)]
+}
+
+// Jaccard returns the Jaccard index of the sets of words of a and b: the
+// number of words in both divided by the number in either. Word order and
+// repetition are ignored.
+func Jaccard(a, b string) float64 {
+	sa, sb := wordSet(a), wordSet(b)
+	if len(sa) == 0 && len(sb) == 0 {
+		return 1
+	}
+	both := 0
+	for w := range sa {
+		if sb[w] {
+			both++
+		}
+	}
+	return float64(both) / float64(len(sa)+len(sb)-both)
+}
+
+// wordSet returns the set of words of text.
+func wordSet(text string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range Words(text) {
+		set[w] = true
+	}
+	return set
+}
+
+// RougeL returns the ROUGE-L F1 score of a and b: the harmonic mean of the
+// shares of each one's words in their longest common subsequence. Unlike
+// Jaccard, it rewards words kept in order.
+func RougeL(a, b string) float64 {
+	wa, wb := Words(a), Words(b)
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	return f1(lcsLength(wa, wb), len(wa), len(wb))
+}
+
+// RougeN returns the ROUGE-N F1 score of a and b: the harmonic mean of the
+// shares of each one's n-word sequences found in the other, counting
+// repeats. Texts shorter than n words are compared whole.
+func RougeN(a, b string, n int) float64 {
+	wa, wb := Words(a), Words(b)
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	n = max(1, min(n, len(wa), len(wb)))
+	ga, gb := ngrams(wa, n), ngrams(wb, n)
+	counts := map[string]int{}
+	for _, g := range gb {
+		counts[g]++
+	}
+	common := 0
+	for _, g := range ga {
+		if counts[g] > 0 {
+			counts[g]--
+			common++
+		}
+	}
+	return f1(common, len(ga), len(gb))
+}
+
+// ngrams returns the n-word sequences of words, joined by spaces.
+func ngrams(words []string, n int) []string {
+	if len(words) < n {
+		return nil
+	}
+	grams := make([]string, 0, len(words)-n+1)
+	for i := 0; i+n <= len(words); i++ {
+		grams = append(grams, strings.Join(words[i:i+n], " "))
+	}
+	return grams
+}
+
+// lcsLength returns the length of the longest common subsequence of a and
+// b.
+func lcsLength(a, b []string) int {
+	row := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		diag := 0
+		for j := 1; j <= len(b); j++ {
+			next := max(row[j], row[j-1])
+			if a[i-1] == b[j-1] {
+				next = diag + 1
+			}
+			diag, row[j] = row[j], next
+		}
+	}
+	return row[len(b)]
+}
+
+// f1 returns the F1 score of common items out of na and nb.
+func f1(common, na, nb int) float64 {
+	if common == 0 {
+		return 0
+	}
+	precision := float64(common) / float64(na)
+	recall := float64(common) / float64(nb)
+	return 2 * precision * recall / (precision + recall)
+}
+
+// Dedupe returns the indexes of the texts to keep when dropping near
+// duplicates: each text is kept unless it is at least threshold similar,
+// by sim, to a text kept before it. If sim is nil, RougeL is used.
+func Dedupe(texts []string, threshold float64, sim func(a, b string) float64) []int {
+	if sim == nil {
+		sim = RougeL
+	}
+	var kept []int
+next:
+	for i, text := range texts {
+		for _, k := range kept {
+			if sim(texts[k], text) >= threshold {
+				continue next
+			}
+		}
+		kept = append(kept, i)
+	}
+	return kept
+}
@@ -0,0 +1,109 @@
+package textsim
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	got := Words("The keeper's lamp, at 9pm—unlit!")
+	want := []string{"the", "keeper", "s", "lamp", "at", "9pm", "unlit"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Words = %q, want %q", got, want)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"héllo", "hello", 1},
+	}
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := Levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+	if got := NormalizedLevenshtein("kitten", "sitting"); !near(got, 1-3.0/7) {
+		t.Errorf("NormalizedLevenshtein = %v", got)
+	}
+	if got := NormalizedLevenshtein("", ""); got != 1 {
+		t.Errorf("NormalizedLevenshtein of empty texts = %v, want 1", got)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"the cat sat", "The cat SAT.", 1},
+		{"the cat sat", "the dog sat", 0.5},
+		{"sat cat the the", "the cat sat", 1},
+		{"cat", "", 0},
+	}
+	for _, tt := range tests {
+		if got := Jaccard(tt.a, tt.b); !near(got, tt.want) {
+			t.Errorf("Jaccard(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRouge(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		l, bigrams float64
+	}{
+		{"", "", 1, 1},
+		{"The answer is 4.", "the answer is 4!", 1, 1},
+		// LCS "the cat on the mat" of 6 and 5 words; bigrams share "the cat", "on the", "the mat"
+		{"the cat sat on the mat", "the cat on the mat", 2 * 5.0 / 11, 2 * 3.0 / 9},
+		{"a b c d", "d c b a", 0.25, 0},
+		{"one", "two", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := RougeL(tt.a, tt.b); !near(got, tt.l) {
+			t.Errorf("RougeL(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.l)
+		}
+		if got := RougeN(tt.a, tt.b, 2); !near(got, tt.bigrams) {
+			t.Errorf("RougeN(%q, %q, 2) = %v, want %v", tt.a, tt.b, got, tt.bigrams)
+		}
+	}
+	if got := RougeN("yes", "yes", 3); got != 1 {
+		t.Errorf("RougeN of texts shorter than n = %v, want 1", got)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	texts := []string{
+		"The lamp went out at midnight.",
+		"A ship ran aground on the rocks.",
+		"The lamp went out at midnight!",
+		"the lamp went out, at midnight",
+		"At midnight the lamp went out.",
+	}
+	if got := Dedupe(texts, 0.9, nil); !reflect.DeepEqual(got, []int{0, 1, 4}) {
+		t.Errorf("Dedupe = %v, want [0 1 4]", got)
+	}
+	if got := Dedupe(texts, 0.9, Jaccard); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("Dedupe with Jaccard = %v, want [0 1]", got)
+	}
+	if got := Dedupe(nil, 0.9, nil); got != nil {
+		t.Errorf("Dedupe(nil) = %v", got)
+	}
+}
+
+// near reports whether a and b are equal to within rounding.
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
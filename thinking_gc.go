@@ -0,0 +1,89 @@
+package novelai
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// ThinkingRetention limits how long replies keep their <think> blocks in
+// the history. Reasoning traces are long and rarely matter once a turn has
+// passed, so the thinking of older replies is dropped, or replaced by a
+// summary, keeping the visible answer. As with CompactHistory, the original
+// text is kept in Meta; see OriginalMessage.
+type ThinkingRetention struct {
+	// KeepTurns is how many of the latest replies keep their thinking.
+	KeepTurns int
+	// Summarize, if set, condenses the thinking of older replies, which is
+	// then kept in a short think block. If it is nil or returns "", the
+	// thinking is dropped; if it fails, the reply is left for the next
+	// turn. See SummarizeThinking.
+	Summarize func(ctx context.Context, thinking string) (string, error)
+}
+
+// SummarizeThinking returns a ThinkingRetention.Summarize function asking
+// the model, in a side request, for a one or two sentence summary of a
+// reasoning trace.
+func (c *Conversation) SummarizeThinking() func(ctx context.Context, thinking string) (string, error) {
+	return func(ctx context.Context, thinking string) (string, error) {
+		prompt := "Summarize the conclusions of the reasoning below in one or two sentences. " +
+			"Reply with the summary only.\n\n" + thinking
+		reply, err := c.sideRequest(ctx, prompt, SamplingProfile{Temperature: Float64(0)})
+		if err != nil {
+			return "", err
+		}
+		_, summary := splitThinking(reply)
+		return strings.TrimSpace(summary), nil
+	}
+}
+
+// PruneThinking applies ThinkingRetention to the history, dropping or
+// summarizing the thinking of all but the latest KeepTurns replies.
+// Returns the number of messages changed. It does nothing if
+// ThinkingRetention is nil.
+func (c *Conversation) PruneThinking() int {
+	return c.pruneThinking(c.context())
+}
+
+// pruneThinking implements PruneThinking, summarizing with ctx.
+func (c *Conversation) pruneThinking(ctx context.Context) int {
+	r := c.ThinkingRetention
+	if r == nil {
+		return 0
+	}
+	changed := 0
+	kept := 0
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		m := c.Messages[i]
+		if m.Role != "assistant" {
+			continue
+		}
+		if kept < r.KeepTurns {
+			kept++
+			continue
+		}
+		key := MetaKeyOriginalPrefix + strconv.Itoa(i)
+		if _, done := c.Meta[key]; done {
+			continue
+		}
+		thinking, visible := splitThinking(m.Content)
+		thinking = strings.TrimSuffix(strings.TrimPrefix(thinking, thinkOpen), thinkClose)
+		if strings.TrimSpace(thinking) == "" {
+			continue
+		}
+		content := strings.TrimSpace(visible)
+		if r.Summarize != nil {
+			summary, err := r.Summarize(ctx, strings.TrimSpace(thinking))
+			if err != nil {
+				continue
+			}
+			if summary != "" {
+				content = thinkOpen + summary + thinkClose + "\n" + content
+			}
+		}
+		c.SetMeta(key, m.Content)
+		c.Messages[i].Content = content
+		changed++
+	}
+	return changed
+}
@@ -0,0 +1,101 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPruneThinkingDrops(t *testing.T) {
+	conv := NewConversation("sys")
+	conv.AddMessage("user", "<think>user text is kept</think> Hi")
+	conv.AddMessage("assistant", "<think>\nplan the greeting\n</think>\n\nHello!")
+	conv.AddMessage("user", "Sum?")
+	conv.AddMessage("assistant", "2 and 2\n</think>\nFour.")
+	conv.AddMessage("user", "Bye")
+	conv.AddMessage("assistant", "<think>wave</think>Goodbye.")
+
+	if n := conv.PruneThinking(); n != 0 {
+		t.Errorf("PruneThinking() without a policy = %d, want 0", n)
+	}
+	conv.ThinkingRetention = &ThinkingRetention{KeepTurns: 1}
+	if n := conv.PruneThinking(); n != 2 {
+		t.Errorf("PruneThinking() = %d, want 2", n)
+	}
+	want := []string{"<think>user text is kept</think> Hi", "Hello!", "Sum?", "Four.", "Bye",
+		"<think>wave</think>Goodbye."}
+	for i, w := range want {
+		if got := conv.Messages[i].Content; got != w {
+			t.Errorf("message %d = %q, want %q", i, got, w)
+		}
+	}
+	if got, ok := conv.OriginalMessage(1); !ok || got != "<think>\nplan the greeting\n</think>\n\nHello!" {
+		t.Errorf("OriginalMessage(1) = %q, %v", got, ok)
+	}
+
+	if n := conv.PruneThinking(); n != 0 {
+		t.Errorf("second PruneThinking() = %d, want 0", n)
+	}
+}
+
+func TestPruneThinkingSummarizes(t *testing.T) {
+	conv := NewConversation("sys")
+	conv.AddMessage("user", "Q1")
+	conv.AddMessage("assistant", "<think>long reasoning</think>A1")
+	conv.AddMessage("user", "Q2")
+	conv.AddMessage("assistant", "<think>failing reasoning</think>A2")
+	conv.AddMessage("user", "Q3")
+	conv.AddMessage("assistant", "<think>trivial</think>A3")
+	conv.ThinkingRetention = &ThinkingRetention{
+		Summarize: func(ctx context.Context, thinking string) (string, error) {
+			switch thinking {
+			case "long reasoning":
+				return "short", nil
+			case "failing reasoning":
+				return "", errors.New("boom")
+			}
+			return "", nil
+		},
+	}
+	if n := conv.PruneThinking(); n != 2 {
+		t.Errorf("PruneThinking() = %d, want 2", n)
+	}
+	if got := conv.Messages[1].Content; got != "<think>short</think>\nA1" {
+		t.Errorf("summarized reply = %q", got)
+	}
+	if got := conv.Messages[3].Content; got != "<think>failing reasoning</think>A2" {
+		t.Errorf("reply with failed summary = %q, want it unchanged", got)
+	}
+	if got := conv.Messages[5].Content; got != "A3" {
+		t.Errorf("reply with empty summary = %q, want the thinking dropped", got)
+	}
+}
+
+func TestThinkingRetentionAfterSend(t *testing.T) {
+	conv := NewConversation("sys")
+	NewFakeBackend().
+		On("Summarize the conclusions", FakeResponse{Text: "Greeted the user."}).
+		On("Again", FakeResponse{Text: "<think>second</think>Hi again."}).
+		On("Hello", FakeResponse{Text: "<think>first</think>Hi."}).
+		Install(conv)
+	conv.ThinkingRetention = &ThinkingRetention{KeepTurns: 1, Summarize: conv.SummarizeThinking()}
+
+	if _, _, _, _, _, _, err := conv.SendWith("Hello", SamplingProfile{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := conv.Messages[1].Content; got != "<think>first</think>Hi." {
+		t.Errorf("latest reply = %q, want its thinking kept", got)
+	}
+	if _, _, _, _, _, _, err := conv.SendStreamingWith("Again", SamplingProfile{}, func(string, bool) {}); err != nil {
+		t.Fatalf("SendStreaming: %v", err)
+	}
+	if got := conv.Messages[1].Content; got != "<think>Greeted the user.</think>\nHi." {
+		t.Errorf("older reply = %q, want its thinking summarized", got)
+	}
+	if got := conv.Messages[3].Content; got != "<think>second</think>Hi again." {
+		t.Errorf("latest reply = %q, want its thinking kept", got)
+	}
+	if len(conv.Messages) != 4 {
+		t.Errorf("history has %d messages, want 4", len(conv.Messages))
+	}
+}
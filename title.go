@@ -0,0 +1,137 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Conversation metadata keys set by GenerateTitle and GenerateTags.
+const (
+	MetaKeyTitle = "title"
+	MetaKeyTags  = "tags"
+)
+
+// Limits for generated titles and tags.
+const (
+	// MaxTitleTokens caps the reply of GenerateTitle.
+	MaxTitleTokens = 24
+	// MaxTagTokens caps the reply of GenerateTags.
+	MaxTagTokens = 48
+	// MaxGeneratedTags is the most tags GenerateTags keeps.
+	MaxGeneratedTags = 5
+)
+
+// TitleInstruction builds the instruction sent to the model to title a
+// conversation transcript.
+func TitleInstruction(transcript string) string {
+	return "Write a short title, at most six words, for the conversation below. " +
+		"Respond with only the title, without quotes or punctuation at the end." +
+		"\n\nConversation:\n" + transcript
+}
+
+// TagsInstruction builds the instruction sent to the model to tag a
+// conversation transcript.
+func TagsInstruction(transcript string) string {
+	return fmt.Sprintf("List up to %d short topic tags for the conversation below, "+
+		"most relevant first. Respond with only the tags, lowercase, separated by "+
+		"commas.\n\nConversation:\n%s", MaxGeneratedTags, transcript)
+}
+
+// ParseTitle cleans a model's title reply: the first line, without a
+// "Title:" label, surrounding quotes or trailing punctuation.
+func ParseTitle(reply string) string {
+	title := strings.TrimSpace(reply)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	if label, rest, ok := strings.Cut(title, ":"); ok && strings.EqualFold(strings.TrimSpace(label), "title") {
+		title = rest
+	}
+	title = strings.Trim(strings.TrimSpace(title), "\"'*`“”")
+	return strings.TrimRight(strings.TrimSpace(title), ".!")
+}
+
+// ParseTags cleans a model's tags reply: comma or newline separated,
+// lowercased, deduplicated and limited to MaxGeneratedTags.
+func ParseTags(reply string) []string {
+	fields := strings.FieldsFunc(reply, func(r rune) bool { return r == ',' || r == '\n' })
+	var tags []string
+	for _, f := range fields {
+		f = strings.ToLower(strings.Trim(strings.TrimSpace(f), "#-*.\"'"))
+		tags = addItems(tags, []string{strings.TrimSpace(f)})
+		if len(tags) == MaxGeneratedTags {
+			break
+		}
+	}
+	return tags
+}
+
+// GenerateTitle asks the model for a short title for the conversation and
+// stores it in c.Meta under MetaKeyTitle.
+func (c *Conversation) GenerateTitle() (string, error) {
+	transcript := c.SceneText()
+	if transcript == "" {
+		return "", fmt.Errorf("conversation has no messages to title")
+	}
+	reply, err := c.sideRequest(c.context(), TitleInstruction(transcript),
+		SamplingProfile{MaxTokens: Int(MaxTitleTokens), Temperature: Float64(0.3)})
+	if err != nil {
+		return "", fmt.Errorf("error generating title: %w", err)
+	}
+	title := ParseTitle(reply)
+	if title == "" {
+		return "", fmt.Errorf("title reply was empty")
+	}
+	c.SetMeta(MetaKeyTitle, title)
+	return title, nil
+}
+
+// GenerateTags asks the model for topic tags for the conversation and
+// stores them, comma separated, in c.Meta under MetaKeyTags.
+func (c *Conversation) GenerateTags() ([]string, error) {
+	transcript := c.SceneText()
+	if transcript == "" {
+		return nil, fmt.Errorf("conversation has no messages to tag")
+	}
+	reply, err := c.sideRequest(c.context(), TagsInstruction(transcript),
+		SamplingProfile{MaxTokens: Int(MaxTagTokens), Temperature: Float64(0.3)})
+	if err != nil {
+		return nil, fmt.Errorf("error generating tags: %w", err)
+	}
+	tags := ParseTags(reply)
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("tags reply was empty")
+	}
+	c.SetMeta(MetaKeyTags, strings.Join(tags, ", "))
+	return tags, nil
+}
+
+// SetMeta sets a metadata value on the conversation.
+func (c *Conversation) SetMeta(key, value string) {
+	if c.Meta == nil {
+		c.Meta = make(map[string]string)
+	}
+	c.Meta[key] = value
+}
+
+// sideRequest sends prompt in a fresh history with c's system prompt and
+// settings, adding the token usage to c.Usage. The conversation is
+// otherwise unchanged.
+func (c *Conversation) sideRequest(ctx context.Context, prompt string, overrides SamplingProfile) (string, error) {
+	conv := *c
+	conv.Ctx = ctx
+	conv.Messages = nil
+	conv.ToolResults = nil
+	conv.Usage = Usage{}
+	conv.Turns = nil
+	conv.Classifier = nil
+	conv.Translator = nil
+	conv.ThinkingRetention = nil
+	conv.SafetyClassifier = nil
+	conv.Settings.MinTokens = 0
+	reply, _, _, _, _, _, err := conv.SendWith(prompt, overrides)
+	c.Usage.InputTokens += conv.Usage.InputTokens
+	c.Usage.OutputTokens += conv.Usage.OutputTokens
+	return reply, err
+}
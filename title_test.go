@@ -0,0 +1,79 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseTitle tests cleaning title replies.
+func TestParseTitle(t *testing.T) {
+	tests := map[string]string{
+		"The Lighthouse Keeper":           "The Lighthouse Keeper",
+		"Title: \"Storm at Sea.\"\nExtra": "Storm at Sea",
+		"  **A Quiet Morning**  ":         "A Quiet Morning",
+		"“Lost and Found!”":               "Lost and Found",
+		"Titles are hard: a conversation": "Titles are hard: a conversation",
+	}
+	for in, want := range tests {
+		if got := ParseTitle(in); got != want {
+			t.Errorf("ParseTitle(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+// TestParseTags tests cleaning tag replies.
+func TestParseTags(t *testing.T) {
+	got := ParseTags("#Sailing, weather\n- Storms, sailing, maps, ships, tides, more")
+	want := "sailing,weather,storms,maps,ships"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Expected %s, got %v", want, got)
+	}
+}
+
+// TestGenerateTitleAndTags tests the side requests and stored metadata.
+func TestGenerateTitleAndTags(t *testing.T) {
+	conv := NewConversation("You are a sailor.")
+	fake := NewFakeBackend().
+		On("short title", FakeResponse{Text: "Title: Crossing the Strait", PromptTokens: 10, CompletionTokens: 4}).
+		On("topic tags", FakeResponse{Text: "sailing, Weather", PromptTokens: 10, CompletionTokens: 3})
+	fake.Install(conv)
+
+	if _, err := conv.GenerateTitle(); err == nil {
+		t.Error("Expected error for empty conversation")
+	}
+	conv.AddMessage("user", "How do we cross the strait in a storm?")
+	conv.AddMessage("assistant", "Reef the sails and wait for the tide.")
+
+	title, err := conv.GenerateTitle()
+	if err != nil || title != "Crossing the Strait" {
+		t.Fatalf("GenerateTitle: got %q, %v", title, err)
+	}
+	tags, err := conv.GenerateTags()
+	if err != nil || len(tags) != 2 || tags[1] != "weather" {
+		t.Fatalf("GenerateTags: got %v, %v", tags, err)
+	}
+	if conv.Meta[MetaKeyTitle] != title || conv.Meta[MetaKeyTags] != "sailing, weather" {
+		t.Errorf("Unexpected metadata: %v", conv.Meta)
+	}
+	if len(conv.Messages) != 2 || conv.Usage.InputTokens != 20 || conv.Usage.OutputTokens != 7 {
+		t.Errorf("Expected history unchanged and usage added, got %d messages, %+v", len(conv.Messages), conv.Usage)
+	}
+	if !strings.Contains(fake.Requests()[0].Prompt, "Reef the sails") {
+		t.Error("Expected transcript in the title prompt")
+	}
+}
+
+// TestSnapshotMeta tests that metadata survives snapshots.
+func TestSnapshotMeta(t *testing.T) {
+	conv := NewConversation("")
+	conv.SetMeta(MetaKeyTitle, "Before")
+	snap := conv.Snapshot()
+	conv.SetMeta(MetaKeyTitle, "After")
+	if snap.Meta[MetaKeyTitle] != "Before" {
+		t.Errorf("Expected snapshot isolated from later changes, got %v", snap.Meta)
+	}
+	conv.Restore(snap)
+	if conv.Meta[MetaKeyTitle] != "Before" {
+		t.Errorf("Expected metadata restored, got %v", conv.Meta)
+	}
+}
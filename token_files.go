@@ -0,0 +1,15 @@
+//go:build !js
+
+package novelai
+
+import "os"
+
+// tokenFiles returns the files LoadApiToken reads a token from, in order:
+// ~/.naitoken, then ./.naitoken.
+func tokenFiles() []string {
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, home+"/.naitoken")
+	}
+	return append(paths, ".naitoken")
+}
@@ -0,0 +1,8 @@
+package novelai
+
+// tokenFiles returns no files: in a browser there is no home or working
+// directory to read a token from, so it must be passed in, as with
+// NewConversationWithClient.
+func tokenFiles() []string {
+	return nil
+}
@@ -0,0 +1,169 @@
+package novelai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wbrown/llmapi"
+)
+
+// Defaults for tool results kept as context entries.
+const (
+	// DefaultToolResultBudget is the total token budget for tool results
+	// when Conversation.ToolResultBudget is unset.
+	DefaultToolResultBudget = 2048
+	// DefaultToolResultTTL is how many replies a tool result stays in
+	// context when ToolResult.TTL is unset.
+	DefaultToolResultTTL = 3
+)
+
+// ToolResult is the output of a tool kept as a context entry instead of a
+// chat message, so that it can be trimmed to its own budget and expire
+// rather than stay in the history forever.
+type ToolResult struct {
+	// ToolUseID matches the tool call the result answers.
+	ToolUseID string
+	// Name is the tool's name, shown to the model.
+	Name string
+	// IsError reports whether the tool failed.
+	IsError bool
+	// Entry holds the result text. If Entry.ContextCfg is set, its
+	// TokenBudget, TrimDirection and MaximumTrimType limit this result,
+	// and its Prefix and Suffix wrap it.
+	Entry ContextEntry
+	// TTL is how many assistant replies the result stays in context. If
+	// zero, DefaultToolResultTTL is used; negative keeps it indefinitely.
+	TTL int
+
+	// addedAt is the number of assistant replies when the result was added.
+	addedAt int
+}
+
+// AddToolResult stores a tool result for the next requests, dropping
+// results that have expired.
+func (c *Conversation) AddToolResult(r ToolResult) {
+	r.addedAt = c.replyCount()
+	c.ToolResults = append(c.activeToolResults(), r)
+}
+
+// activeToolResults returns the tool results that have not expired.
+func (c *Conversation) activeToolResults() []ToolResult {
+	replies := c.replyCount()
+	var active []ToolResult
+	for _, r := range c.ToolResults {
+		ttl := r.TTL
+		if ttl == 0 {
+			ttl = DefaultToolResultTTL
+		}
+		if ttl < 0 || replies-r.addedAt < ttl {
+			active = append(active, r)
+		}
+	}
+	return active
+}
+
+// replyCount returns the number of assistant messages in the history.
+func (c *Conversation) replyCount() int {
+	n := 0
+	for _, m := range c.Messages {
+		if m.Role == "assistant" {
+			n++
+		}
+	}
+	return n
+}
+
+// toolResultBudget returns ToolResultBudget, or DefaultToolResultBudget if
+// unset.
+func (c *Conversation) toolResultBudget() int {
+	if c.ToolResultBudget > 0 {
+		return c.ToolResultBudget
+	}
+	return DefaultToolResultBudget
+}
+
+// toolContext renders the active tool results in the order they were
+// added, trimmed to their budgets. Newer results get budget first. Returns
+// "" if there are none.
+func (c *Conversation) toolContext() string {
+	results := c.activeToolResults()
+	b := &ContextBuilder{}
+	remaining := c.toolResultBudget()
+	texts := make([]string, len(results))
+	for i := len(results) - 1; i >= 0 && remaining > 0; i-- {
+		r := results[i]
+		cfg := ContextConfig{TrimDirection: TrimBottom, MaximumTrimType: TrimToken}
+		if r.Entry.ContextCfg != nil {
+			cfg = *r.Entry.ContextCfg
+		}
+		limit := remaining
+		if cfg.TokenBudget > 1 && cfg.TokenBudget < limit {
+			limit = cfg.TokenBudget
+		}
+		label := "Tool result"
+		if r.IsError {
+			label = "Tool error"
+		}
+		header := fmt.Sprintf("[%s: %s]\n", label, r.Name)
+		text := b.trim(r.Entry.Text, limit-b.count(header), cfg)
+		if text == "" {
+			continue
+		}
+		texts[i] = header + cfg.Prefix + text + cfg.Suffix
+		remaining -= b.count(texts[i])
+	}
+	var out []string
+	for _, t := range texts {
+		if t != "" {
+			out = append(out, strings.TrimRight(t, "\n"))
+		}
+	}
+	return strings.Join(out, "\n\n")
+}
+
+// promptMessages returns the messages to render: the history, with active
+// tool results as a system message before the latest user message.
+func (c *Conversation) promptMessages() []Message {
+	history := c.history()
+	tools := c.toolContext()
+	if tools == "" {
+		return history
+	}
+	at := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			at = i
+			break
+		}
+	}
+	messages := make([]Message, 0, len(history)+1)
+	messages = append(messages, history[:at]...)
+	messages = append(messages, Message{Role: "system", Content: tools})
+	return append(messages, history[at:]...)
+}
+
+// addToolResultBlocks stores the tool result blocks in content.
+func (c *Conversation) addToolResultBlocks(content []llmapi.ContentBlock) {
+	for _, block := range content {
+		if block.Type != llmapi.ContentTypeToolResult || block.ToolResult == nil {
+			continue
+		}
+		c.AddToolResult(ToolResult{
+			ToolUseID: block.ToolResult.ToolUseID,
+			// The block carries no tool name; the ID identifies the call
+			Name:    block.ToolResult.ToolUseID,
+			IsError: block.ToolResult.IsError,
+			Entry:   ContextEntry{Text: block.ToolResult.Content},
+		})
+	}
+}
+
+// onlyToolResults reports whether content is non-empty and all tool results.
+func onlyToolResults(content []llmapi.ContentBlock) bool {
+	for _, block := range content {
+		if block.Type != llmapi.ContentTypeToolResult {
+			return false
+		}
+	}
+	return len(content) > 0
+}
@@ -0,0 +1,99 @@
+package novelai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// TestToolResultContext tests where tool results are rendered.
+func TestToolResultContext(t *testing.T) {
+	conv := NewConversation("")
+	conv.AddMessage("user", "What's the weather?")
+	conv.AddToolResult(ToolResult{Name: "weather", Entry: ContextEntry{Text: "Sunny, 21C"}})
+
+	messages := conv.promptMessages()
+	if len(messages) != 2 || messages[0].Role != "system" || messages[1].Role != "user" {
+		t.Fatalf("Expected tool result before the user message, got %+v", messages)
+	}
+	if messages[0].Content != "[Tool result: weather]\nSunny, 21C" {
+		t.Errorf("Unexpected tool context: %q", messages[0].Content)
+	}
+	if len(conv.Messages) != 1 {
+		t.Errorf("Expected history unchanged, got %+v", conv.Messages)
+	}
+	if !strings.Contains(conv.RenderPrompt(), "Sunny, 21C") {
+		t.Error("Expected tool result in the prompt")
+	}
+}
+
+// TestToolResultExpiry tests that results expire after their TTL.
+func TestToolResultExpiry(t *testing.T) {
+	conv := NewConversation("")
+	conv.AddToolResult(ToolResult{Name: "short", TTL: 1, Entry: ContextEntry{Text: "one reply"}})
+	conv.AddToolResult(ToolResult{Name: "forever", TTL: -1, Entry: ContextEntry{Text: "kept"}})
+	conv.AddMessage("user", "Hi")
+	if got := conv.toolContext(); !strings.Contains(got, "one reply") {
+		t.Errorf("Expected result before any reply, got %q", got)
+	}
+
+	conv.AddMessage("assistant", "Hello")
+	conv.AddMessage("user", "Again")
+	got := conv.toolContext()
+	if strings.Contains(got, "one reply") || !strings.Contains(got, "kept") {
+		t.Errorf("Expected short result expired, got %q", got)
+	}
+	conv.AddToolResult(ToolResult{Name: "new", Entry: ContextEntry{Text: "x"}})
+	if len(conv.ToolResults) != 2 {
+		t.Errorf("Expected expired results dropped, got %d", len(conv.ToolResults))
+	}
+}
+
+// TestToolResultBudget tests per-result and total budgets.
+func TestToolResultBudget(t *testing.T) {
+	conv := NewConversation("")
+	conv.AddMessage("user", "Search")
+	long := strings.Repeat("word ", 200)
+	conv.AddToolResult(ToolResult{Name: "old", Entry: ContextEntry{Text: "old result"}})
+	conv.AddToolResult(ToolResult{
+		Name: "search",
+		Entry: ContextEntry{Text: long, ContextCfg: &ContextConfig{
+			TokenBudget: 20, TrimDirection: TrimBottom, MaximumTrimType: TrimToken,
+		}},
+	})
+	got := conv.toolContext()
+	if !strings.Contains(got, "old result") || EstimateTokens(got) > 30 {
+		t.Errorf("Expected long result trimmed to its budget, got %d tokens: %q", EstimateTokens(got), got)
+	}
+
+	conv.ToolResultBudget = 20
+	conv.ToolResults[1].Entry.ContextCfg = nil
+	got = conv.toolContext()
+	if strings.Contains(got, "old result") || EstimateTokens(got) > 20 {
+		t.Errorf("Expected newest result to use the whole budget, got %q", got)
+	}
+}
+
+// TestRichToolResults tests that tool result blocks become context entries.
+func TestRichToolResults(t *testing.T) {
+	conv := NewConversation("")
+	conv.AddMessage("user", "Look it up")
+	conv.AddRichMessage(llmapi.RoleUser, []llmapi.ContentBlock{
+		llmapi.NewToolResultBlock("call_1", "Found 3 results", false),
+	})
+	if len(conv.Messages) != 1 || len(conv.ToolResults) != 1 {
+		t.Fatalf("Expected a tool result and no new message, got %+v / %+v", conv.Messages, conv.ToolResults)
+	}
+	if r := conv.ToolResults[0]; r.ToolUseID != "call_1" || r.Entry.Text != "Found 3 results" {
+		t.Errorf("Unexpected tool result: %+v", r)
+	}
+
+	conv.AddRichMessage(llmapi.RoleUser, []llmapi.ContentBlock{
+		llmapi.NewTextBlock("And this?"),
+		llmapi.NewToolResultBlock("call_2", "Failed", true),
+	})
+	if len(conv.Messages) != 2 || !strings.Contains(conv.toolContext(), "[Tool error: call_2]") {
+		t.Errorf("Expected text kept and error result stored, got %q", conv.toolContext())
+	}
+}
@@ -0,0 +1,86 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultModelLanguage is the language prompts are kept in when
+// Conversation.ModelLanguage is unset.
+const DefaultModelLanguage = "English"
+
+// Translator translates text between languages. Languages are named as the
+// conversation names them, e.g. "Japanese" or "ja".
+type Translator interface {
+	Translate(ctx context.Context, text, from, to string) (string, error)
+}
+
+// TranslatorFunc adapts a function to the Translator interface.
+type TranslatorFunc func(ctx context.Context, text, from, to string) (string, error)
+
+// Translate calls f(ctx, text, from, to).
+func (f TranslatorFunc) Translate(ctx context.Context, text, from, to string) (string, error) {
+	return f(ctx, text, from, to)
+}
+
+// TranslateInstruction builds the instruction sent to the model to
+// translate text.
+func TranslateInstruction(text, from, to string) string {
+	return "Translate the text below from " + from + " to " + to + ". Keep the meaning, " +
+		"tone and formatting. Respond with only the translation.\n\nText:\n" + text
+}
+
+// ModelTranslator translates with a chat model, using a fresh history with
+// Conversation's settings. Token usage is added to Conversation.Usage.
+type ModelTranslator struct {
+	Conversation *Conversation
+}
+
+// Translate implements Translator.
+func (t *ModelTranslator) Translate(ctx context.Context, text, from, to string) (string, error) {
+	reply, err := t.Conversation.sideRequest(ctx, TranslateInstruction(text, from, to),
+		SamplingProfile{Temperature: Float64(0.3)})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reply), nil
+}
+
+// modelLanguage returns ModelLanguage, or DefaultModelLanguage if unset.
+func (c *Conversation) modelLanguage() string {
+	if c.ModelLanguage != "" {
+		return c.ModelLanguage
+	}
+	return DefaultModelLanguage
+}
+
+// translating reports whether user text and replies are translated.
+func (c *Conversation) translating() bool {
+	return c.Translator != nil && c.Language != "" && !strings.EqualFold(c.Language, c.modelLanguage())
+}
+
+// translateInput translates user text into the model's language.
+func (c *Conversation) translateInput(ctx context.Context, text string) (string, error) {
+	if text == "" || !c.translating() {
+		return text, nil
+	}
+	translated, err := c.Translator.Translate(ctx, text, c.Language, c.modelLanguage())
+	if err != nil {
+		return "", fmt.Errorf("error translating message: %w", err)
+	}
+	return translated, nil
+}
+
+// translateReply translates a reply into the user's language. On error the
+// reply is returned untranslated.
+func (c *Conversation) translateReply(ctx context.Context, reply string) (string, error) {
+	if reply == "" || !c.translating() {
+		return reply, nil
+	}
+	translated, err := c.Translator.Translate(ctx, reply, c.modelLanguage(), c.Language)
+	if err != nil {
+		return reply, fmt.Errorf("error translating reply: %w", err)
+	}
+	return translated, nil
+}
@@ -0,0 +1,67 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// TestConversationTranslator tests translating user text and replies.
+func TestConversationTranslator(t *testing.T) {
+	dict := map[string]string{"こんにちは": "Hello", "Hi there!": "やあ！"}
+	var calls []string
+	conv := NewConversation("")
+	conv.Language = "Japanese"
+	conv.Translator = TranslatorFunc(func(ctx context.Context, text, from, to string) (string, error) {
+		calls = append(calls, from+">"+to)
+		if out, ok := dict[text]; ok {
+			return out, nil
+		}
+		return "", errors.New("unknown phrase")
+	})
+	fake := NewFakeBackend().On(`Hello`, FakeResponse{Text: "Hi there!"})
+	fake.Install(conv)
+
+	reply, _, _, _, _, _, err := conv.Send("こんにちは", llmapi.Sampling{})
+	if err != nil || reply != "やあ！" {
+		t.Fatalf("Expected translated reply, got %q, %v", reply, err)
+	}
+	if conv.Messages[0].Content != "Hello" || conv.Messages[1].Content != "Hi there!" {
+		t.Errorf("Expected history in model language, got %+v", conv.Messages)
+	}
+	if strings.Join(calls, ",") != "Japanese>English,English>Japanese" {
+		t.Errorf("Unexpected translation calls: %v", calls)
+	}
+
+	if _, _, _, _, _, _, err := conv.Send("さようなら", llmapi.Sampling{}); err == nil {
+		t.Error("Expected translation error")
+	}
+	if len(conv.Messages) != 2 {
+		t.Errorf("Expected failed message not added, got %d messages", len(conv.Messages))
+	}
+
+	conv.Language = "english"
+	reply, _, _, _, _, _, err = conv.Send("Hello", llmapi.Sampling{})
+	if err != nil || reply != "Hi there!" {
+		t.Errorf("Expected no translation for the model's language, got %q, %v", reply, err)
+	}
+}
+
+// TestModelTranslator tests translating with a side request.
+func TestModelTranslator(t *testing.T) {
+	conv := NewConversation("")
+	fake := NewFakeBackend().On(`from English to French`, FakeResponse{Text: " Bonjour \n", PromptTokens: 6, CompletionTokens: 2})
+	fake.Install(conv)
+
+	tr := &ModelTranslator{Conversation: conv}
+	got, err := tr.Translate(context.Background(), "Hello", "English", "French")
+	if err != nil || got != "Bonjour" {
+		t.Fatalf("Expected Bonjour, got %q, %v", got, err)
+	}
+	if len(conv.Messages) != 0 || conv.Usage.InputTokens != 6 {
+		t.Errorf("Expected history unchanged and usage added, got %d messages, %+v", len(conv.Messages), conv.Usage)
+	}
+}
@@ -0,0 +1,171 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wbrown/llmapi"
+)
+
+// Text-to-speech defaults.
+const (
+	// DefaultVoice is the default v2 voice seed.
+	DefaultVoice = "Aini"
+	// MaxVoiceText is the longest text accepted by a single voice request.
+	MaxVoiceText = 1000
+)
+
+// VoiceOptions configures voice generation.
+type VoiceOptions struct {
+	// Voice is the v2 voice seed, such as "Aini" or "Orea" (DefaultVoice if empty).
+	Voice string
+	// Opus requests WebM/Opus audio instead of MP3. MP3 segments can be
+	// concatenated into one playable stream; Opus segments cannot.
+	Opus bool
+}
+
+// GenerateVoice converts text to speech and returns the encoded audio.
+// Text longer than MaxVoiceText is an error; see SplitVoiceText.
+func (c *Client) GenerateVoice(ctx context.Context, text string, opts VoiceOptions) ([]byte, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("voice text is empty")
+	}
+	if len(text) > MaxVoiceText {
+		return nil, fmt.Errorf("voice text is %d bytes, limit is %d", len(text), MaxVoiceText)
+	}
+	voice := opts.Voice
+	if voice == "" {
+		voice = DefaultVoice
+	}
+	query := url.Values{
+		"text":    {text},
+		"voice":   {"-1"},
+		"seed":    {voice},
+		"opus":    {fmt.Sprint(opts.Opus)},
+		"version": {"v2"},
+	}
+	return c.do(ctx, "GET", c.apiURL()+"/ai/generate-voice?"+query.Encode(), "", nil)
+}
+
+// SplitVoiceText splits text into pieces of at most MaxVoiceText bytes,
+// breaking at sentence ends or spaces where possible.
+func SplitVoiceText(text string) []string {
+	var pieces []string
+	text = strings.TrimSpace(text)
+	for len(text) > MaxVoiceText {
+		cut := strings.LastIndexAny(text[:MaxVoiceText], ".!?…")
+		if cut <= 0 {
+			cut = strings.LastIndexFunc(text[:MaxVoiceText], unicode.IsSpace)
+		} else {
+			cut++
+		}
+		if cut <= 0 {
+			cut = MaxVoiceText
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		pieces = append(pieces, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		pieces = append(pieces, text)
+	}
+	return pieces
+}
+
+// SpokenStream is the audio of a reply being generated by
+// SendStreamingSpoken. Read audio from it as paragraphs are voiced; call
+// Wait for the reply and any error once reading is done.
+type SpokenStream struct {
+	*io.PipeReader
+
+	done         chan struct{}
+	reply        string
+	stopReason   string
+	inputTokens  int
+	outputTokens int
+	err          error
+}
+
+// Wait blocks until text generation and voicing are finished, then returns
+// the reply, stop reason and token counts. The audio must be read (or the
+// stream closed) for Wait to return.
+func (s *SpokenStream) Wait() (reply, stopReason string, inputTokens, outputTokens int, err error) {
+	<-s.done
+	return s.reply, s.stopReason, s.inputTokens, s.outputTokens, s.err
+}
+
+// SendStreamingSpoken streams a reply like SendStreaming and voices each
+// paragraph with tts as soon as it completes, so playback can start before
+// the reply is finished. Thinking is not voiced. Audio segments are written
+// to the returned stream in order.
+//
+// Generation runs in the background; don't use the conversation until Wait
+// returns. callback, if non-nil, receives the raw text deltas.
+func (c *Conversation) SendStreamingSpoken(text string, sampling llmapi.Sampling, tts *Client,
+	opts VoiceOptions, callback StreamCallback) *SpokenStream {
+
+	pr, pw := io.Pipe()
+	stream := &SpokenStream{PipeReader: pr, done: make(chan struct{})}
+	// Shutdown cancels voicing and waits for the stream to finish
+	ctx, done, err := c.track(c.context())
+	if err != nil {
+		stream.err = err
+		pw.CloseWithError(err)
+		close(stream.done)
+		return stream
+	}
+	paragraphs := make(chan string, 16)
+
+	var voiceErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for p := range paragraphs {
+			if voiceErr != nil {
+				continue
+			}
+			for _, piece := range SplitVoiceText(p) {
+				audio, err := tts.GenerateVoice(ctx, piece, opts)
+				if err == nil {
+					_, err = pw.Write(audio)
+				}
+				if err != nil {
+					voiceErr = fmt.Errorf("error voicing reply: %w", err)
+					break
+				}
+			}
+		}
+	}()
+
+	agg := NewStreamAggregator(func(e StreamEvent) {
+		if e.Kind == EventParagraph && !e.Thinking {
+			paragraphs <- e.Text
+		}
+	})
+
+	go func() {
+		defer close(stream.done)
+		defer done()
+		reply, stopReason, in, out, _, _, err := c.SendStreaming(text, sampling, agg.Callback(callback))
+		agg.Flush()
+		close(paragraphs)
+		wg.Wait()
+		if err == nil {
+			err = voiceErr
+		}
+		stream.reply, stream.stopReason = reply, stopReason
+		stream.inputTokens, stream.outputTokens = in, out
+		stream.err = err
+		pw.CloseWithError(err)
+	}()
+	return stream
+}
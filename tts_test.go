@@ -0,0 +1,144 @@
+package novelai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wbrown/llmapi"
+)
+
+// newVoiceServer returns a client whose voice endpoint echoes the text as
+// "audio" and records each request.
+func newVoiceServer(t *testing.T, status int) (*Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var texts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ai/generate-voice" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		mu.Lock()
+		texts = append(texts, q.Get("text"))
+		mu.Unlock()
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("[" + q.Get("seed") + ":" + q.Get("text") + "]"))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient()
+	client.ApiToken = "test-token"
+	client.APIURL = server.URL
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), texts...)
+	}
+}
+
+// TestGenerateVoice tests the voice request parameters and validation.
+func TestGenerateVoice(t *testing.T) {
+	client, _ := newVoiceServer(t, http.StatusOK)
+
+	audio, err := client.GenerateVoice(context.Background(), "Hello.", VoiceOptions{Voice: "Orea"})
+	if err != nil {
+		t.Fatalf("GenerateVoice failed: %v", err)
+	}
+	if string(audio) != "[Orea:Hello.]" {
+		t.Errorf("Unexpected audio: %q", audio)
+	}
+
+	if _, err := client.GenerateVoice(context.Background(), "  ", VoiceOptions{}); err == nil {
+		t.Error("Expected error for empty text")
+	}
+	if _, err := client.GenerateVoice(context.Background(), strings.Repeat("a", MaxVoiceText+1), VoiceOptions{}); err == nil {
+		t.Error("Expected error for text over the limit")
+	}
+}
+
+// TestSplitVoiceText tests splitting long text at natural breaks.
+func TestSplitVoiceText(t *testing.T) {
+	sentence := strings.Repeat("word ", 150) + "end. "
+	pieces := SplitVoiceText(sentence + sentence)
+	if len(pieces) != 2 {
+		t.Fatalf("Expected 2 pieces, got %d", len(pieces))
+	}
+	for _, p := range pieces {
+		if len(p) > MaxVoiceText || !strings.HasSuffix(p, "end.") {
+			t.Errorf("Unexpected piece of length %d ending %q", len(p), p[len(p)-5:])
+		}
+	}
+
+	unbroken := strings.Repeat("é", MaxVoiceText)
+	for _, p := range SplitVoiceText(unbroken) {
+		if len(p) > MaxVoiceText || !strings.HasPrefix(p, "é") {
+			t.Errorf("Expected rune-aligned pieces within the limit, got length %d", len(p))
+		}
+	}
+	if SplitVoiceText("  ") != nil {
+		t.Error("Expected no pieces for blank text")
+	}
+}
+
+// TestSendStreamingSpoken tests voicing a streamed reply paragraph by paragraph.
+func TestSendStreamingSpoken(t *testing.T) {
+	tts, texts := newVoiceServer(t, http.StatusOK)
+	fake := NewFakeBackend().On(`.`, FakeResponse{
+		Chunks:           []string{"<think>Plan.</think>", "First para", "graph.\n", "Second one."},
+		PromptTokens:     7,
+		CompletionTokens: 9,
+	})
+	conv := NewConversation("")
+	fake.Install(conv)
+
+	var deltas strings.Builder
+	stream := conv.SendStreamingSpoken("Speak", llmapi.Sampling{}, tts, VoiceOptions{},
+		func(text string, done bool) { deltas.WriteString(text) })
+
+	audio, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Reading audio failed: %v", err)
+	}
+	reply, _, in, out, err := stream.Wait()
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	if string(audio) != "[Aini:First paragraph.][Aini:Second one.]" {
+		t.Errorf("Unexpected audio: %q", audio)
+	}
+	if got := texts(); len(got) != 2 {
+		t.Errorf("Expected 2 voice requests (thinking skipped), got %q", got)
+	}
+	if reply != deltas.String() || !strings.HasSuffix(reply, "Second one.") {
+		t.Errorf("Unexpected reply %q, deltas %q", reply, deltas.String())
+	}
+	if in != 7 || out != 9 {
+		t.Errorf("Expected usage 7/9, got %d/%d", in, out)
+	}
+}
+
+// TestSendStreamingSpokenVoiceError tests that voice failures are reported.
+func TestSendStreamingSpokenVoiceError(t *testing.T) {
+	tts, _ := newVoiceServer(t, http.StatusTooManyRequests)
+	fake := NewFakeBackend().On(`.`, FakeResponse{Text: "One. Two.\nThree."})
+	conv := NewConversation("")
+	fake.Install(conv)
+
+	stream := conv.SendStreamingSpoken("Speak", llmapi.Sampling{}, tts, VoiceOptions{}, nil)
+	if _, err := io.ReadAll(stream); err == nil {
+		t.Error("Expected read error after voice failure")
+	}
+	if _, _, _, _, err := stream.Wait(); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("Expected status 429 error, got %v", err)
+	}
+}
@@ -20,7 +20,7 @@ var (
 	// Disables thinking by appending /nothink and prefilling empty think block.
 	ThinkFormatGLM46 = ThinkFormat{
 		UserSuffix:      "/nothink",
-		AssistantPrefix: "</think>\n",
+		AssistantPrefix: "<think></think>\n",
 	}
 
 	// ThinkFormatGLM47 is the format for GLM-4.7 models.
@@ -40,8 +40,8 @@ var (
 
 // Settings configures generation parameters for NovelAI.
 type Settings struct {
-	// Model to use for generation (e.g., "glm-4-6", "llama-3-erato-v1")
-	Model string
+	// Model to use for generation (e.g., ModelGLM46, ModelErato)
+	Model Model
 	// MaxTokens is the maximum number of tokens to generate.
 	MaxTokens int
 	// Temperature controls randomness. Range: 0.0 to 2.0.
@@ -60,24 +60,123 @@ type Settings struct {
 	RepetitionPenalty float64
 	// StopSequences are strings that stop generation.
 	StopSequences []string
+	// LogitBias biases individual token IDs. Build it from bias groups with
+	// CompileBiasGroups and LogitBias.
+	LogitBias map[int]float64
 	// Thinking enables GLM's extended thinking mode (<think> blocks).
 	// When false, uses ThinkFormat to disable reasoning output.
 	Thinking bool
 	// ThinkFormat specifies the prompt format for disabling thinking mode.
 	// Different model versions require different formats.
-	// If nil, defaults to ThinkFormatGLM46 for backwards compatibility.
+	// If nil, the prompt template's format is used.
 	ThinkFormat *ThinkFormat
+	// Template lays out the prompt. If nil, the template registered for
+	// Model is used, falling back to PromptGLM46.
+	Template *PromptTemplate
+	// MaxResponseBytes and MaxResponseTokens, if set, cap a streamed reply
+	// client-side: once exceeded, the request is cancelled and the partial
+	// reply is kept with stop reason StopClientTruncated. Tokens are counted
+	// as stream chunks. Use MaxTokens to limit non-streaming requests.
+	MaxResponseBytes  int
+	MaxResponseTokens int
+	// ResponseLanguage and ResponseStyle, if set, add the template's
+	// standard directives for them to the system prompt, e.g. "Always
+	// reply in Japanese." See Directives.
+	ResponseLanguage string
+	ResponseStyle    ResponseStyle
+	// KeepPartialReplies adds the text received before a stream fails to
+	// the history, tagged TagIncomplete, so that it can be continued. The
+	// error is a StreamError either way.
+	KeepPartialReplies bool
+	// LoopDetection, if enabled, cancels a streamed reply once the model
+	// starts repeating itself, keeping the partial reply with stop reason
+	// StopLoopDetected.
+	LoopDetection LoopDetection
+	// StreamChunking sets where streamed text may be split between
+	// callbacks. The zero value, ChunkCharacters, never splits a character.
+	StreamChunking ChunkMode
+	// StreamRate, if enabled, limits how fast streamed text reaches the
+	// callback.
+	StreamRate StreamRate
+	// MinTokens, if set, is the shortest reply wanted, in output tokens. A
+	// reply that ends its turn sooner is continued, up to
+	// MaxMinTokensContinuations times, like a scenario's min_length.
+	MinTokens int
+	// Logprobs, if set, requests the log probability of each generated
+	// token and of up to this many of the most likely alternatives. They
+	// are kept in Conversation.LastLogprobs.
+	Logprobs int
+	// Seed, if set, seeds the sampler, so that requests with the same
+	// prompt and settings generate the same reply, as far as the backend
+	// is deterministic. Combine it with a temperature of 0 for
+	// reproducible replies. Zero means unset and is not sent, so a seed
+	// of 0 cannot be requested.
+	Seed int
+	// Extra, if set, adds fields to each request, for features NovelAI
+	// adds before this package types them, such as response_format or
+	// guided decoding. Values are encoded as JSON. Fields this package
+	// sets cannot be replaced; requests fail if Extra names one. See
+	// ValidateExtra.
+	Extra map[string]any
+}
+
+// Clone returns a deep copy of s that shares no slices, maps or pointers
+// with it, so that changes to one, such as appending a stop sequence, do not
+// affect the other.
+func (s Settings) Clone() Settings {
+	if s.StopSequences != nil {
+		s.StopSequences = append([]string(nil), s.StopSequences...)
+	}
+	if s.LogitBias != nil {
+		bias := make(map[int]float64, len(s.LogitBias))
+		for id, b := range s.LogitBias {
+			bias[id] = b
+		}
+		s.LogitBias = bias
+	}
+	if s.ThinkFormat != nil {
+		tf := *s.ThinkFormat
+		s.ThinkFormat = &tf
+	}
+	if s.Template != nil {
+		t := *s.Template
+		t.StopSequences = append([]string(nil), t.StopSequences...)
+		if t.Directives != nil {
+			d := *t.Directives
+			if d.Styles != nil {
+				d.Styles = make(map[ResponseStyle]string, len(t.Directives.Styles))
+				for style, text := range t.Directives.Styles {
+					d.Styles[style] = text
+				}
+			}
+			t.Directives = &d
+		}
+		s.Template = &t
+	}
+	s.Extra = cloneExtra(s.Extra)
+	return s
 }
 
 // DefaultSettings provides reasonable defaults for NovelAI GLM-4.
-var DefaultSettings = Settings{
-	Model:         "glm-4-6",
-	MaxTokens:     2048,
-	Temperature:   1.0,
-	TopP:          0.9,
-	StopSequences: []string{"<|user|>", "<|system|>"},
-	Thinking:      false,             // Disable thinking by default for faster responses
-	ThinkFormat:   &ThinkFormatGLM46, // Default to GLM-4.6 format
+//
+// Deprecated: modifying DefaultSettings is not safe while conversations are
+// being created. Use SetDefaults or UpdateDefaults instead, and
+// BuiltinSettings to read the built-in settings.
+var DefaultSettings = BuiltinSettings()
+
+// BuiltinSettings returns the package's built-in generation settings for
+// NovelAI GLM-4. Unlike CurrentDefaults, it ignores SetDefaults and does
+// not load the API token.
+func BuiltinSettings() Settings {
+	return Settings{
+		Model:         ModelGLM46,
+		MaxTokens:     2048,
+		Temperature:   1.0,
+		TopP:          0.9,
+		StopSequences: []string{"<|user|>", "<|system|>"},
+		Thinking:      false,             // Disable thinking by default for faster responses
+		ThinkFormat:   &ThinkFormatGLM46, // Default to GLM-4.6 format
+	}
 }
 
 // Message represents a single message in a conversation.
@@ -86,6 +185,9 @@ var DefaultSettings = Settings{
 type Message struct {
 	Role    string `json:"role"`    // "system", "user", "assistant"
 	Content string `json:"content"` // The message text
+	// Tags label the message for HistoryFilters such as WithTag; they are
+	// not sent to the model.
+	Tags []string `json:"tags,omitempty"`
 }
 
 // Usage tracks token consumption for a conversation.
@@ -100,40 +202,62 @@ type streamOptions struct {
 }
 
 // completionRequest is the OpenAI-compatible completions request format for NovelAI.
+// Sampler fields are pointers so an explicit zero override can be sent;
+// nil fields are omitted and the server default applies.
 type completionRequest struct {
-	Model             string         `json:"model"`
-	Prompt            string         `json:"prompt"`
-	MaxTokens         int            `json:"max_tokens,omitempty"`
-	Temperature       float64        `json:"temperature,omitempty"`
-	TopP              float64        `json:"top_p,omitempty"`
-	TopK              int            `json:"top_k,omitempty"`
-	MinP              float64        `json:"min_p,omitempty"`
-	FrequencyPenalty  float64        `json:"frequency_penalty,omitempty"`
-	PresencePenalty   float64        `json:"presence_penalty,omitempty"`
-	RepetitionPenalty float64        `json:"repetition_penalty,omitempty"`
-	Stream            bool           `json:"stream,omitempty"`
-	StreamOptions     *streamOptions `json:"stream_options,omitempty"`
-	Stop              []string       `json:"stop,omitempty"`
+	Model             string          `json:"model"`
+	Prompt            string          `json:"prompt"`
+	MaxTokens         int             `json:"max_tokens,omitempty"`
+	Temperature       *float64        `json:"temperature,omitempty"`
+	TopP              *float64        `json:"top_p,omitempty"`
+	TopK              *int            `json:"top_k,omitempty"`
+	MinP              *float64        `json:"min_p,omitempty"`
+	FrequencyPenalty  *float64        `json:"frequency_penalty,omitempty"`
+	PresencePenalty   *float64        `json:"presence_penalty,omitempty"`
+	RepetitionPenalty *float64        `json:"repetition_penalty,omitempty"`
+	Stream            bool            `json:"stream,omitempty"`
+	StreamOptions     *streamOptions  `json:"stream_options,omitempty"`
+	Stop              []string        `json:"stop,omitempty"`
+	LogitBias         map[int]float64 `json:"logit_bias,omitempty"`
+	Logprobs          int             `json:"logprobs,omitempty"`
+	Seed              int             `json:"seed,omitempty"`
+	// Extra fields are merged into the JSON; see Settings.Extra.
+	Extra map[string]any `json:"-"`
+}
+
+// completionLogprobs are the log probabilities of a completion's tokens.
+type completionLogprobs struct {
+	Tokens        []string             `json:"tokens"`
+	TokenLogprobs []float64            `json:"token_logprobs"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs"`
 }
 
 // completionResponse is the OpenAI-compatible completions response format from NovelAI.
 type completionResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index        int    `json:"index"`
-		Text         string `json:"text"`
-		FinishReason string `json:"finish_reason"` // "stop", "length"
-	} `json:"choices"`
-	Usage struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+	Usage   struct {
 		PromptTokens     int `json:"prompt_tokens"`
 		CompletionTokens int `json:"completion_tokens"`
 		TotalTokens      int `json:"total_tokens"`
 	} `json:"usage"`
 }
 
+// completionChoice is a choice of a completionResponse.
+type completionChoice struct {
+	Index        int                 `json:"index"`
+	Text         string              `json:"text"`
+	FinishReason string              `json:"finish_reason"` // "stop", "length"
+	Logprobs     *completionLogprobs `json:"logprobs"`
+	// StopReason and MatchedStop are the stop sequence matched, as
+	// reported by vLLM and SGLang servers: a string, or a token ID.
+	StopReason  any `json:"stop_reason,omitempty"`
+	MatchedStop any `json:"matched_stop,omitempty"`
+}
+
 // streamChunk represents a single SSE chunk during streaming (completions format).
 type streamChunk struct {
 	ID      string `json:"id"`
@@ -141,9 +265,12 @@ type streamChunk struct {
 	Created int64  `json:"created"`
 	Model   string `json:"model"`
 	Choices []struct {
-		Index        int     `json:"index"`
-		Text         string  `json:"text"`
-		FinishReason *string `json:"finish_reason"`
+		Index        int                 `json:"index"`
+		Text         string              `json:"text"`
+		FinishReason *string             `json:"finish_reason"`
+		Logprobs     *completionLogprobs `json:"logprobs"`
+		StopReason   any                 `json:"stop_reason,omitempty"`
+		MatchedStop  any                 `json:"matched_stop,omitempty"`
 	} `json:"choices"`
 	Usage *struct {
 		PromptTokens     int `json:"prompt_tokens"`
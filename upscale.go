@@ -0,0 +1,111 @@
+package novelai
+
+import (
+	"context"
+	"fmt"
+)
+
+// Upscale limits.
+const (
+	// MaxUpscalePixels is the largest source image area accepted by /ai/upscale.
+	MaxUpscalePixels = 1024 * 1024
+	// FreeUpscalePixels is the largest area upscaled without Anlas cost on
+	// an Opus subscription.
+	FreeUpscalePixels = 640 * 640
+)
+
+// upscaleCosts maps source image areas to Anlas costs, smallest first.
+var upscaleCosts = []struct {
+	pixels int
+	anlas  int
+}{
+	{FreeUpscalePixels, 1},
+	{512 * 1024, 2},
+	{768 * 1024, 3},
+	{MaxUpscalePixels, 5},
+}
+
+// UpscaleRequest is a request for /ai/upscale.
+type UpscaleRequest struct {
+	// Image is the base64 source image.
+	Image  string `json:"image"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Scale is the upscale factor, 2 or 4.
+	Scale int `json:"scale"`
+}
+
+// NewUpscaleRequest creates a request to upscale image by scale, reading
+// its size from the image.
+func NewUpscaleRequest(data []byte, scale int) (*UpscaleRequest, error) {
+	width, height, err := ImageSize(data)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := EncodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	req := &UpscaleRequest{Image: encoded, Width: width, Height: height, Scale: scale}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Validate checks the request before it is sent.
+func (r *UpscaleRequest) Validate() error {
+	if r.Image == "" {
+		return fmt.Errorf("upscale image is empty")
+	}
+	if r.Scale != 2 && r.Scale != 4 {
+		return fmt.Errorf("upscale factor must be 2 or 4, got %d", r.Scale)
+	}
+	_, err := EstimateUpscaleCost(r.Width, r.Height, false)
+	return err
+}
+
+// Cost returns the estimated Anlas cost of the request; opus is whether
+// the account has an Opus subscription.
+func (r *UpscaleRequest) Cost(opus bool) (int, error) {
+	return EstimateUpscaleCost(r.Width, r.Height, opus)
+}
+
+// EstimateUpscaleCost returns the Anlas cost of upscaling an image of the
+// given size, using the same table as the NovelAI web app. Images up to
+// FreeUpscalePixels are free with Opus.
+func EstimateUpscaleCost(width, height int, opus bool) (int, error) {
+	if width <= 0 || height <= 0 {
+		return 0, fmt.Errorf("invalid upscale size %dx%d", width, height)
+	}
+	pixels := width * height
+	if pixels > MaxUpscalePixels {
+		return 0, fmt.Errorf("image %dx%d is larger than the upscale limit of %d pixels",
+			width, height, MaxUpscalePixels)
+	}
+	if opus && pixels <= FreeUpscalePixels {
+		return 0, nil
+	}
+	for _, c := range upscaleCosts {
+		if pixels <= c.pixels {
+			return c.anlas, nil
+		}
+	}
+	return upscaleCosts[len(upscaleCosts)-1].anlas, nil
+}
+
+// UpscaleImage upscales an image and returns it PNG encoded.
+func (c *Client) UpscaleImage(ctx context.Context, req *UpscaleRequest) ([]byte, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	body, err := c.post(ctx, c.apiURL()+"/ai/upscale", req)
+	if err != nil {
+		return nil, err
+	}
+	images, err := unzipImages(body)
+	if err != nil {
+		return nil, err
+	}
+	return images[0], nil
+}
@@ -0,0 +1,98 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestEstimateUpscaleCost tests the cost table and limits.
+func TestEstimateUpscaleCost(t *testing.T) {
+	tests := []struct {
+		width, height int
+		opus          bool
+		want          int
+	}{
+		{512, 512, false, 1},
+		{512, 512, true, 0},
+		{640, 640, true, 0},
+		{512, 1024, true, 2},
+		{768, 1024, false, 3},
+		{1024, 1024, false, 5},
+	}
+	for _, tc := range tests {
+		got, err := EstimateUpscaleCost(tc.width, tc.height, tc.opus)
+		if err != nil {
+			t.Errorf("EstimateUpscaleCost(%d, %d) failed: %v", tc.width, tc.height, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Expected cost %d for %dx%d (opus=%v), got %d", tc.want, tc.width, tc.height, tc.opus, got)
+		}
+	}
+
+	if _, err := EstimateUpscaleCost(1024, 1025, false); err == nil {
+		t.Error("Expected error for image over the limit")
+	}
+	if _, err := EstimateUpscaleCost(0, 512, false); err == nil {
+		t.Error("Expected error for zero width")
+	}
+}
+
+// TestNewUpscaleRequest tests request validation.
+func TestNewUpscaleRequest(t *testing.T) {
+	data := testPNG(t, color.White)
+	req, err := NewUpscaleRequest(data, 4)
+	if err != nil {
+		t.Fatalf("NewUpscaleRequest failed: %v", err)
+	}
+	if req.Width != 4 || req.Height != 4 || req.Scale != 4 {
+		t.Errorf("Unexpected request: %+v", req)
+	}
+	if _, err := NewUpscaleRequest(data, 3); err == nil {
+		t.Error("Expected error for scale 3")
+	}
+	if _, err := NewUpscaleRequest([]byte("text"), 2); err == nil {
+		t.Error("Expected error for non-image data")
+	}
+}
+
+// TestUpscaleImage tests the upscale request and response.
+func TestUpscaleImage(t *testing.T) {
+	var got UpscaleRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ai/upscale" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write(zipImages(t, map[string]string{"image_0.png": "big"}))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.ApiToken = "test-token"
+	client.APIURL = server.URL
+
+	req, err := NewUpscaleRequest(testPNG(t, color.White), 2)
+	if err != nil {
+		t.Fatalf("NewUpscaleRequest failed: %v", err)
+	}
+	out, err := client.UpscaleImage(context.Background(), req)
+	if err != nil {
+		t.Fatalf("UpscaleImage failed: %v", err)
+	}
+	if string(out) != "big" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+	if got.Scale != 2 || got.Width != 4 || got.Image != req.Image {
+		t.Errorf("Unexpected request: %+v", got)
+	}
+
+	req.Scale = 8
+	if _, err := client.UpscaleImage(context.Background(), req); err == nil {
+		t.Error("Expected validation error before sending")
+	}
+}